@@ -0,0 +1,89 @@
+//go:build !windows
+
+// Binary gotpm-bridge serves a constrained subset of the TPM 2.0 API over
+// authenticated HTTPS, for processes that cannot open the TPM device
+// themselves. See package github.com/google/go-tpm/tpm2/bridge for the API.
+//
+// Keys are made available by name with repeated --key flags, for example:
+//
+//	gotpm-bridge --token-file=/etc/tpm-bridge/token \
+//	    --tls-cert=cert.pem --tls-key=key.pem \
+//	    --key=srk=0x81000001 --key=ak=0x81010002
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/bridge"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+var (
+	tpmPath   = flag.String("tpm-path", "/dev/tpm0", "Path to the TPM device (character device or a Unix socket)")
+	listen    = flag.String("listen", "localhost:8443", "Address to listen on")
+	tokenFile = flag.String("token-file", "", "File containing the bearer token clients must present")
+	tlsCert   = flag.String("tls-cert", "", "TLS certificate file")
+	tlsKey    = flag.String("tls-key", "", "TLS private key file")
+	keys      = keyFlags{}
+)
+
+func init() {
+	flag.Var(keys, "key", "Key to expose, as name=handle (may be repeated)")
+}
+
+// keyFlags collects name=handle pairs from repeated --key flags.
+type keyFlags map[string]bridge.Key
+
+func (k keyFlags) String() string {
+	var pairs []string
+	for name, key := range k {
+		pairs = append(pairs, fmt.Sprintf("%s=0x%08x", name, uint32(key.Handle)))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (k keyFlags) Set(v string) error {
+	name, h, ok := strings.Cut(v, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("want name=handle, got %q", v)
+	}
+	handle, err := strconv.ParseUint(h, 0, 32)
+	if err != nil {
+		return fmt.Errorf("invalid handle %q: %v", h, err)
+	}
+	k[name] = bridge.Key{Handle: tpm2.TPMHandle(handle)}
+	return nil
+}
+
+func main() {
+	flag.Parse()
+
+	if *tokenFile == "" || *tlsCert == "" || *tlsKey == "" {
+		fmt.Fprintln(os.Stderr, "--token-file, --tls-cert and --tls-key must be set")
+		os.Exit(1)
+	}
+	token, err := os.ReadFile(*tokenFile)
+	if err != nil {
+		log.Fatalf("reading token: %v", err)
+	}
+
+	t, err := transport.OpenTPM(*tpmPath)
+	if err != nil {
+		log.Fatalf("opening TPM: %v", err)
+	}
+	defer t.Close()
+
+	s, err := bridge.NewServer(t, bridge.BearerToken(strings.TrimSpace(string(token))), keys)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("listening on %s", *listen)
+	log.Fatal(http.ListenAndServeTLS(*listen, *tlsCert, *tlsKey, s))
+}
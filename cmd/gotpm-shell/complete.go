@@ -0,0 +1,77 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// complete returns the possible completions of the last word of line.
+func (s *shell) complete(line string) []string {
+	words := strings.Fields(line)
+	if len(words) == 0 || strings.HasSuffix(line, " ") {
+		words = append(words, "")
+	}
+	prefix := words[len(words)-1]
+
+	var candidates []string
+	if len(words) == 1 {
+		candidates = append(commandNames(), "exit")
+	} else if cmd, ok := commands[words[0]]; ok && cmd.complete != nil {
+		candidates = cmd.complete(s, len(words)-2)
+	}
+
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// completeBanks offers the PCR banks that are active on this TPM.
+func (s *shell) completeBanks(int) []string {
+	banks, err := tpm2.ActivePCRBanks(s.tpm)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, bank := range banks {
+		names = append(names, tpm2.PCRBankName(bank)+":")
+	}
+	return names
+}
+
+// completeHandles offers the handles of the given types that are currently in
+// the TPM.
+func (s *shell) completeHandles(types ...tpm2.TPMHT) []string {
+	var names []string
+	for _, ht := range types {
+		hs, err := tpm2.GetHandles(s.tpm, ht)
+		if err != nil {
+			continue
+		}
+		for _, h := range hs {
+			names = append(names, fmt.Sprintf("0x%08x", uint32(h)))
+		}
+	}
+	return names
+}
+
+func (s *shell) completeObjects(int) []string {
+	return s.completeHandles(tpm2.TPMHTTransient, tpm2.TPMHTPersistent)
+}
+
+func (s *shell) completeNVIndices(int) []string {
+	return s.completeHandles(tpm2.TPMHTNVIndex)
+}
+
+func (s *shell) completeFlushable(int) []string {
+	return s.completeHandles(tpm2.TPMHTTransient, tpm2.TPMHTHMACSession)
+}
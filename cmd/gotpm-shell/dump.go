@@ -0,0 +1,73 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// dump writes an indented, human-readable rendering of a TPM structure.
+// Unexported fields (such as the contents of unions) are included, byte
+// strings are printed in hex and integers in both decimal and hex.
+func dump(w io.Writer, v interface{}) {
+	dumpValue(w, reflect.ValueOf(v), 0)
+	fmt.Fprintln(w)
+}
+
+func dumpValue(w io.Writer, v reflect.Value, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch v.Kind() {
+	case reflect.Invalid:
+		fmt.Fprint(w, "<nil>")
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			fmt.Fprint(w, "<nil>")
+			return
+		}
+		dumpValue(w, v.Elem(), depth)
+	case reflect.Struct:
+		fmt.Fprintf(w, "%s{\n", v.Type().Name())
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			// Skip markers such as marshalByReflection.
+			if f.Type.Size() == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "%s  %s: ", indent, f.Name)
+			dumpValue(w, v.Field(i), depth+1)
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s}", indent)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			for i := range b {
+				b[i] = byte(v.Index(i).Uint())
+			}
+			fmt.Fprintf(w, "%x", b)
+			return
+		}
+		if v.Len() == 0 {
+			fmt.Fprint(w, "[]")
+			return
+		}
+		fmt.Fprintln(w, "[")
+		for i := 0; i < v.Len(); i++ {
+			fmt.Fprintf(w, "%s  ", indent)
+			dumpValue(w, v.Index(i), depth+1)
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s]", indent)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		fmt.Fprintf(w, "%d (0x%x)", v.Uint(), v.Uint())
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		fmt.Fprintf(w, "%d", v.Int())
+	case reflect.Bool:
+		fmt.Fprintf(w, "%t", v.Bool())
+	default:
+		fmt.Fprintf(w, "<%s>", v.Kind())
+	}
+}
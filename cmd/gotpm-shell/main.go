@@ -0,0 +1,47 @@
+//go:build !windows
+
+// Binary gotpm-shell is an interactive shell for exploring a TPM 2.0 device.
+// It can issue common commands, list the handles loaded in the TPM and dump
+// the structures it returns, which is useful when bringing up new hardware.
+//
+// Press tab to complete command names and, where the TPM can tell us, their
+// arguments (for example, loaded handles or active PCR banks).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+var (
+	tpmPath = flag.String("tpm-path", "/dev/tpm0", "Path to the TPM device (character device or a Unix socket)")
+	useSim  = flag.Bool("simulator", false, "Use an in-process TPM simulator instead of a device")
+)
+
+func main() {
+	flag.Parse()
+
+	t, err := openTPM()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "opening TPM: %v\n", err)
+		os.Exit(1)
+	}
+	defer t.Close()
+
+	s := &shell{tpm: t, out: os.Stdout}
+	if err := s.run(newLineReader(os.Stdin, os.Stdout, s.complete)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func openTPM() (transport.TPMCloser, error) {
+	if *useSim {
+		return simulator.OpenSimulator()
+	}
+	return transport.OpenTPM(*tpmPath)
+}
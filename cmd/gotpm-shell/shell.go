@@ -0,0 +1,366 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// errQuit is returned by a command to end the session.
+var errQuit = errors.New("quit")
+
+// A command is a shell command. complete, if set, returns candidates for the
+// argument at the given position; the shell filters them by prefix.
+type command struct {
+	usage    string
+	help     string
+	run      func(s *shell, args []string) error
+	complete func(s *shell, pos int) []string
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"help": {
+			usage:    "help [command]",
+			help:     "List commands, or describe one command.",
+			run:      (*shell).help,
+			complete: func(*shell, int) []string { return commandNames() },
+		},
+		"quit": {
+			usage: "quit",
+			help:  "Leave the shell.",
+			run:   func(*shell, []string) error { return errQuit },
+		},
+		"getrandom": {
+			usage: "getrandom <bytes>",
+			help:  "Get random bytes from the TPM.",
+			run:   (*shell).getRandom,
+		},
+		"pcrread": {
+			usage:    "pcrread <bank:pcrs[+bank:pcrs...]>",
+			help:     "Read PCR values, e.g. 'pcrread sha256:0-7'.",
+			run:      (*shell).pcrRead,
+			complete: (*shell).completeBanks,
+		},
+		"caps": {
+			usage:    "caps <properties|algorithms|commands|pcrs>",
+			help:     "Dump a TPM capability.",
+			run:      (*shell).caps,
+			complete: func(*shell, int) []string { return capNames() },
+		},
+		"handles": {
+			usage:    "handles [transient|persistent|nv|session]",
+			help:     "List the handles of the given type, or of all types.",
+			run:      (*shell).listHandles,
+			complete: func(*shell, int) []string { return handleTypeNames() },
+		},
+		"readpublic": {
+			usage:    "readpublic <handle>",
+			help:     "Dump the public area of a loaded or persistent object.",
+			run:      (*shell).readPublic,
+			complete: (*shell).completeObjects,
+		},
+		"nvreadpublic": {
+			usage:    "nvreadpublic <index>",
+			help:     "Dump the public area of an NV index.",
+			run:      (*shell).nvReadPublic,
+			complete: (*shell).completeNVIndices,
+		},
+		"flush": {
+			usage:    "flush <handle>",
+			help:     "Flush a transient object or session.",
+			run:      (*shell).flush,
+			complete: (*shell).completeFlushable,
+		},
+		"raw": {
+			usage: "raw <hex>",
+			help:  "Send a raw, hex-encoded command and print the response.",
+			run:   (*shell).raw,
+		},
+	}
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// shell holds the state of an interactive session.
+type shell struct {
+	tpm transport.TPM
+	out io.Writer
+}
+
+// lineReader reads one line of input at a time.
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// run reads and executes commands until EOF or quit.
+func (s *shell) run(lr lineReader) error {
+	for {
+		line, err := lr.readLine("tpm> ")
+		if err == io.EOF {
+			fmt.Fprintln(s.out)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.exec(line); err == errQuit {
+			return nil
+		} else if err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+		}
+	}
+}
+
+// exec executes a single command line.
+func (s *shell) exec(line string) error {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return nil
+	}
+	if args[0] == "exit" {
+		return errQuit
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q (try 'help')", args[0])
+	}
+	return cmd.run(s, args[1:])
+}
+
+func (s *shell) help(args []string) error {
+	if len(args) > 0 {
+		cmd, ok := commands[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown command %q", args[0])
+		}
+		fmt.Fprintf(s.out, "%s\n  %s\n", cmd.usage, cmd.help)
+		return nil
+	}
+	for _, name := range commandNames() {
+		fmt.Fprintf(s.out, "  %-45s %s\n", commands[name].usage, commands[name].help)
+	}
+	return nil
+}
+
+func (s *shell) getRandom(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: " + commands["getrandom"].usage)
+	}
+	n, err := strconv.ParseUint(args[0], 0, 16)
+	if err != nil {
+		return fmt.Errorf("invalid byte count: %v", err)
+	}
+	rsp, err := tpm2.GetRandom{BytesRequested: uint16(n)}.Execute(s.tpm)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "%x\n", rsp.RandomBytes.Buffer)
+	return nil
+}
+
+func (s *shell) pcrRead(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: " + commands["pcrread"].usage)
+	}
+	sel, err := tpm2.ParsePCRSelection(args[0])
+	if err != nil {
+		return err
+	}
+	vals, err := tpm2.ReadPCRs(s.tpm, *sel)
+	if err != nil {
+		return err
+	}
+	for _, bank := range sel.PCRSelections {
+		name := tpm2.PCRBankName(bank.Hash)
+		for _, pcr := range vals[bank.Hash].Sorted() {
+			fmt.Fprintf(s.out, "%s:%-2d %x\n", name, pcr, vals[bank.Hash][pcr])
+		}
+	}
+	return nil
+}
+
+// capabilities maps the names accepted by 'caps' to the capability and the
+// first property to ask for.
+var capabilities = map[string]struct {
+	cap  tpm2.TPMCap
+	prop uint32
+}{
+	"properties": {tpm2.TPMCapTPMProperties, uint32(tpm2.TPMPTFamilyIndicator)},
+	"algorithms": {tpm2.TPMCapAlgs, 0},
+	"commands":   {tpm2.TPMCapCommands, 0},
+	"pcrs":       {tpm2.TPMCapPCRs, 0},
+}
+
+func capNames() []string {
+	names := make([]string, 0, len(capabilities))
+	for name := range capabilities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *shell) caps(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: " + commands["caps"].usage)
+	}
+	c, ok := capabilities[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown capability %q", args[0])
+	}
+	rsp, err := tpm2.GetCapability{
+		Capability:    c.cap,
+		Property:      c.prop,
+		PropertyCount: 256,
+	}.Execute(s.tpm)
+	if err != nil {
+		return err
+	}
+	dump(s.out, rsp.CapabilityData)
+	return nil
+}
+
+// handleTypes maps the names accepted by 'handles' to the handle type.
+var handleTypes = map[string]tpm2.TPMHT{
+	"transient":  tpm2.TPMHTTransient,
+	"persistent": tpm2.TPMHTPersistent,
+	"nv":         tpm2.TPMHTNVIndex,
+	"session":    tpm2.TPMHTHMACSession,
+}
+
+func handleTypeNames() []string {
+	names := make([]string, 0, len(handleTypes))
+	for name := range handleTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *shell) listHandles(args []string) error {
+	names := args
+	if len(names) == 0 {
+		names = handleTypeNames()
+	}
+	for _, name := range names {
+		ht, ok := handleTypes[name]
+		if !ok {
+			return fmt.Errorf("unknown handle type %q", name)
+		}
+		hs, err := tpm2.GetHandles(s.tpm, ht)
+		if err != nil {
+			return err
+		}
+		for _, h := range hs {
+			fmt.Fprintf(s.out, "%-10s 0x%08x\n", name, uint32(h))
+		}
+	}
+	return nil
+}
+
+func parseHandle(args []string, usage string) (tpm2.TPMHandle, error) {
+	if len(args) != 1 {
+		return 0, errors.New("usage: " + usage)
+	}
+	h, err := strconv.ParseUint(args[0], 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid handle: %v", err)
+	}
+	return tpm2.TPMHandle(h), nil
+}
+
+func (s *shell) readPublic(args []string) error {
+	h, err := parseHandle(args, commands["readpublic"].usage)
+	if err != nil {
+		return err
+	}
+	rsp, err := tpm2.ReadPublic{ObjectHandle: h}.Execute(s.tpm)
+	if err != nil {
+		return err
+	}
+	pub, err := rsp.OutPublic.Contents()
+	if err != nil {
+		return err
+	}
+	dump(s.out, pub)
+	fmt.Fprintf(s.out, "Name: %x\n", rsp.Name.Buffer)
+	return nil
+}
+
+func (s *shell) nvReadPublic(args []string) error {
+	h, err := parseHandle(args, commands["nvreadpublic"].usage)
+	if err != nil {
+		return err
+	}
+	rsp, err := tpm2.NVReadPublic{NVIndex: h}.Execute(s.tpm)
+	if err != nil {
+		return err
+	}
+	pub, err := rsp.NVPublic.Contents()
+	if err != nil {
+		return err
+	}
+	dump(s.out, pub)
+	fmt.Fprintf(s.out, "Name: %x\n", rsp.NVName.Buffer)
+	return nil
+}
+
+func (s *shell) flush(args []string) error {
+	h, err := parseHandle(args, commands["flush"].usage)
+	if err != nil {
+		return err
+	}
+	_, err = tpm2.FlushContext{FlushHandle: h}.Execute(s.tpm)
+	return err
+}
+
+func (s *shell) raw(args []string) error {
+	cmd, err := hex.DecodeString(strings.Join(args, ""))
+	if err != nil {
+		return fmt.Errorf("invalid hex: %v", err)
+	}
+	rsp, err := s.tpm.Send(cmd)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "%x\n", rsp)
+	return nil
+}
+
+// plainReader reads lines without any editing support, for when input is not
+// a terminal.
+type plainReader struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+func (r *plainReader) readLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.in.Scan() {
+		if err := r.in.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.in.Text(), nil
+}
@@ -0,0 +1,147 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func newTestShell(t *testing.T) (*shell, *bytes.Buffer) {
+	t.Helper()
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	t.Cleanup(func() { thetpm.Close() })
+	var out bytes.Buffer
+	return &shell{tpm: thetpm, out: &out}, &out
+}
+
+func TestExec(t *testing.T) {
+	s, out := newTestShell(t)
+
+	for _, tc := range []struct {
+		line    string
+		wantErr string
+		want    *regexp.Regexp
+	}{
+		{line: "", want: regexp.MustCompile(`^$`)},
+		{line: "nosuchcommand", wantErr: `unknown command "nosuchcommand"`},
+		{line: "getrandom", wantErr: "usage: getrandom"},
+		{line: "getrandom lots", wantErr: "invalid byte count"},
+		{line: "getrandom 8", want: regexp.MustCompile(`^[0-9a-f]{16}\n$`)},
+		{line: "  getrandom   0x4  ", want: regexp.MustCompile(`^[0-9a-f]{8}\n$`)},
+		{line: "pcrread sha256:0-1", want: regexp.MustCompile(`^sha256:0  0{64}\nsha256:1  0{64}\n$`)},
+		{line: "pcrread nosuchbank:0", wantErr: "nosuchbank"},
+		{line: "caps bogus", wantErr: `unknown capability "bogus"`},
+		{line: "handles bogus", wantErr: `unknown handle type "bogus"`},
+		{line: "readpublic zzz", wantErr: "invalid handle"},
+		{line: "flush", wantErr: "usage: flush"},
+		{line: "raw xyz", wantErr: "invalid hex"},
+		// TPM2_GetRandom of 4 bytes.
+		{line: "raw 8001 0000000c 0000017b 0004", want: regexp.MustCompile(`^80010000001000000000` + `0004[0-9a-f]{8}\n$`)},
+		{line: "help getrandom", want: regexp.MustCompile(`^getrandom <bytes>\n  Get random bytes from the TPM.\n$`)},
+	} {
+		out.Reset()
+		err := s.exec(tc.line)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("exec(%q) = %v, want error containing %q", tc.line, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("exec(%q): %v", tc.line, err)
+			continue
+		}
+		if !tc.want.MatchString(out.String()) {
+			t.Errorf("exec(%q) printed %q, want match for %v", tc.line, out.String(), tc.want)
+		}
+	}
+
+	for _, line := range []string{"quit", "exit"} {
+		if err := s.exec(line); err != errQuit {
+			t.Errorf("exec(%q) = %v, want %v", line, err, errQuit)
+		}
+	}
+}
+
+func TestHandles(t *testing.T) {
+	s, out := newTestShell(t)
+
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(s.tpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	h := fmt.Sprintf("0x%08x", uint32(rsp.ObjectHandle))
+
+	if err := s.exec("handles transient"); err != nil {
+		t.Fatalf("handles: %v", err)
+	}
+	if want := fmt.Sprintf("transient  %s\n", h); out.String() != want {
+		t.Errorf("handles printed %q, want %q", out.String(), want)
+	}
+	out.Reset()
+	if err := s.exec("readpublic " + h); err != nil {
+		t.Fatalf("readpublic: %v", err)
+	}
+	if want := fmt.Sprintf("Name: %x\n", rsp.Name.Buffer); !strings.HasSuffix(out.String(), want) {
+		t.Errorf("readpublic printed %q, want suffix %q", out.String(), want)
+	}
+	if got := s.complete("flush 0x8"); len(got) != 1 || got[0] != h {
+		t.Errorf("complete(\"flush 0x8\") = %q, want [%s]", got, h)
+	}
+	if err := s.exec("flush " + h); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if got := s.complete("flush "); len(got) != 0 {
+		t.Errorf("complete(\"flush \") after flush = %q, want none", got)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s, _ := newTestShell(t)
+
+	for _, tc := range []struct {
+		line string
+		want []string
+	}{
+		{"get", []string{"getrandom"}},
+		{"ex", []string{"exit"}},
+		{"caps ", []string{"algorithms", "commands", "pcrs", "properties"}},
+		{"handles p", []string{"persistent"}},
+		{"pcrread sha2", []string{"sha256:"}},
+		{"getrandom ", nil},
+		{"nosuchcommand ", nil},
+	} {
+		got := s.complete(tc.line)
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("complete(%q) = %q, want %q", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	s, out := newTestShell(t)
+
+	in := "getrandom 2\nbogus\nquit\ngetrandom 2\n"
+	lr := &plainReader{in: bufio.NewScanner(strings.NewReader(in)), out: out}
+	if err := s.run(lr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	want := regexp.MustCompile(`^tpm> [0-9a-f]{4}\ntpm> error: unknown command "bogus" \(try 'help'\)\ntpm> $`)
+	if !want.MatchString(out.String()) {
+		t.Errorf("run printed %q, want match for %v", out.String(), want)
+	}
+}
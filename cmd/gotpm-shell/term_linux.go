@@ -0,0 +1,112 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// termReader reads lines from a terminal in raw mode, so that it can offer
+// tab completion.
+type termReader struct {
+	in       *bufio.Reader
+	out      io.Writer
+	fd       int
+	complete func(line string) []string
+}
+
+// newLineReader returns a lineReader for in. If in is a terminal, lines can be
+// edited and completed with complete; otherwise they are read as-is.
+func newLineReader(in *os.File, out io.Writer, complete func(string) []string) lineReader {
+	fd := int(in.Fd())
+	if _, err := unix.IoctlGetTermios(fd, unix.TCGETS); err != nil {
+		return &plainReader{in: bufio.NewScanner(in), out: out}
+	}
+	return &termReader{in: bufio.NewReader(in), out: out, fd: fd, complete: complete}
+}
+
+func (r *termReader) readLine(prompt string) (string, error) {
+	old, err := unix.IoctlGetTermios(r.fd, unix.TCGETS)
+	if err != nil {
+		return "", err
+	}
+	raw := *old
+	raw.Lflag &^= unix.ECHO | unix.ICANON | unix.ISIG
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(r.fd, unix.TCSETS, &raw); err != nil {
+		return "", err
+	}
+	defer unix.IoctlSetTermios(r.fd, unix.TCSETS, old)
+
+	fmt.Fprint(r.out, prompt)
+	var line []byte
+	for {
+		c, err := r.in.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case '\r', '\n':
+			fmt.Fprint(r.out, "\r\n")
+			return string(line), nil
+		case 4: // Ctrl-D
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+		case 3: // Ctrl-C
+			fmt.Fprint(r.out, "^C\r\n"+prompt)
+			line = line[:0]
+		case 127, '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				fmt.Fprint(r.out, "\b \b")
+			}
+		case '\t':
+			line = r.tab(prompt, line)
+		case 27: // Escape sequences such as arrow keys are not supported.
+			r.in.ReadByte()
+			r.in.ReadByte()
+		default:
+			if c >= ' ' {
+				line = append(line, c)
+				r.out.Write([]byte{c})
+			}
+		}
+	}
+}
+
+// tab completes the last word of line. If there is more than one candidate,
+// it extends the word to their common prefix and lists them.
+func (r *termReader) tab(prompt string, line []byte) []byte {
+	matches := r.complete(string(line))
+	if len(matches) == 0 {
+		return line
+	}
+	start := strings.LastIndexAny(string(line), " \t") + 1
+	word := string(line[start:])
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(matches) == 1 && !strings.HasSuffix(common, ":") {
+		common += " "
+	}
+	if len(common) > len(word) {
+		ext := common[len(word):]
+		line = append(line, ext...)
+		fmt.Fprint(r.out, ext)
+	}
+	if len(matches) > 1 {
+		fmt.Fprintf(r.out, "\r\n%s\r\n%s%s", strings.Join(matches, "  "), prompt, line)
+	}
+	return line
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// newLineReader returns a lineReader for in. Tab completion is only
+// supported on Linux.
+func newLineReader(in *os.File, out io.Writer, _ func(string) []string) lineReader {
+	return &plainReader{in: bufio.NewScanner(in), out: out}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// benchMain runs the benchmarks selected by args, writing the report to
+// stdout unless --out says otherwise, and progress to stderr.
+func benchMain(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	tpmPath := fs.String("tpm-path", "/dev/tpmrm0", "Path to the TPM device (character device or a Unix socket); ignored on Windows")
+	useSim := fs.Bool("simulator", false, "Use an in-process TPM simulator instead of a device")
+	duration := fs.Duration("duration", 10*time.Second, "How long to run each benchmark")
+	run := fs.String("run", strings.Join(benchmarkNames(), ","), "Comma-separated benchmarks to run")
+	nvIndex := fs.Uint("nv-index", 0x01800be0, "Free NV index for the nv-write benchmark, which defines and removes it")
+	nvWrites := fs.Int("nv-writes", 1000, "Maximum number of NV writes by the nv-write benchmark")
+	ownerAuth := fs.String("owner-auth", "", "Owner hierarchy password, for defining the NV index")
+	out := fs.String("out", "-", "File to write the JSON report to, or - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+
+	var benchmarks []benchmark
+	for _, name := range strings.Split(*run, ",") {
+		b, ok := benchmarkNamed(strings.TrimSpace(name))
+		if !ok {
+			return fmt.Errorf("unknown benchmark %q; want one of %s", name, strings.Join(benchmarkNames(), ", "))
+		}
+		benchmarks = append(benchmarks, b)
+	}
+
+	var t transport.TPMCloser
+	var err error
+	if *useSim {
+		t, err = simulator.OpenSimulator()
+	} else {
+		t, err = openTPM(*tpmPath)
+	}
+	if err != nil {
+		return fmt.Errorf("opening TPM: %w", err)
+	}
+	defer t.Close()
+
+	r := report{Started: time.Now().UTC(), Duration: duration.String()}
+	if info, err := tpm2.GetDeviceInfo(t); err != nil {
+		fmt.Fprintf(stderr, "reading device info: %v\n", err)
+	} else {
+		r.Device = &device{
+			Manufacturer:    info.ManufacturerName(),
+			VendorString:    info.VendorString,
+			FirmwareVersion: info.FirmwareVersion(),
+			Revision:        fmt.Sprintf("%d.%02d", info.Revision/100, info.Revision%100),
+		}
+	}
+	b := &bench{
+		tpm:       t,
+		duration:  *duration,
+		ownerAuth: []byte(*ownerAuth),
+		nvIndex:   tpm2.TPMHandle(*nvIndex),
+		nvWrites:  *nvWrites,
+	}
+	for _, bm := range benchmarks {
+		fmt.Fprintf(stderr, "running %s...\n", bm.name)
+		r.Results = append(r.Results, b.run(bm))
+	}
+
+	if *out == "-" {
+		return writeReport(stdout, &r)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := writeReport(f, &r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// report is the JSON report.
+type report struct {
+	Started  time.Time `json:"started"`
+	Duration string    `json:"duration_per_benchmark"`
+	Device   *device   `json:"device,omitempty"`
+	Results  []result  `json:"results"`
+}
+
+// device identifies the TPM the report is about.
+type device struct {
+	Manufacturer    string `json:"manufacturer"`
+	VendorString    string `json:"vendor_string"`
+	FirmwareVersion string `json:"firmware_version"`
+	Revision        string `json:"spec_revision"`
+}
+
+func writeReport(w io.Writer, r *report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
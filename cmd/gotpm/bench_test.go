@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestBenchArgs(t *testing.T) {
+	for _, tc := range []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"--run=nosuchbench", "--simulator"}, `unknown benchmark "nosuchbench"`},
+		{[]string{"--duration=soon"}, "invalid value"},
+		{[]string{"--simulator", "extra"}, "unexpected arguments"},
+	} {
+		var stdout, stderr bytes.Buffer
+		err := benchMain(tc.args, &stdout, &stderr)
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("benchMain(%q) = %v, want error containing %q", tc.args, err, tc.wantErr)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("benchMain(%q) wrote a report: %s", tc.args, stdout.String())
+		}
+	}
+	var stderr bytes.Buffer
+	if err := benchMain([]string{"--help"}, &bytes.Buffer{}, &stderr); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("benchMain(--help) = %v, want %v", err, flag.ErrHelp)
+	}
+	if !strings.Contains(stderr.String(), "-nv-writes") {
+		t.Errorf("--help printed %q, want the flags", stderr.String())
+	}
+}
+
+func TestBenchReport(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"--simulator", "--duration=50ms", "--run=random, sign-ecc,nv-write", "--nv-writes=3"}
+	if err := benchMain(args, &stdout, &stderr); err != nil {
+		t.Fatalf("benchMain(%q): %v\n%s", args, err, stderr.String())
+	}
+	var r report
+	if err := json.Unmarshal(stdout.Bytes(), &r); err != nil {
+		t.Fatalf("report is not JSON: %v\n%s", err, stdout.String())
+	}
+	if r.Device == nil || r.Device.Manufacturer == "" || r.Duration != "50ms" {
+		t.Errorf("report header = %+v, %q", r.Device, r.Duration)
+	}
+	var names []string
+	for _, res := range r.Results {
+		names = append(names, res.Name)
+		if res.Error != "" || res.Ops == 0 || res.Latency == nil {
+			t.Errorf("%s result = %+v, want successful operations", res.Name, res)
+		}
+	}
+	if got := strings.Join(names, ","); got != "random,sign-ecc,nv-write" {
+		t.Errorf("report has results %s, want random,sign-ecc,nv-write", got)
+	}
+	if len(r.Results) == 3 {
+		if r.Results[0].BytesPerSecond == 0 {
+			t.Errorf("random result has no throughput")
+		}
+		if ops := r.Results[2].Ops; ops != 3 {
+			t.Errorf("nv-write did %d writes, want --nv-writes=3", ops)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// randomBytes is the number of bytes requested by each GetRandom.
+const randomBytes = 32
+
+// nvSize is the size of the NV index written by the nv-write benchmark.
+const nvSize = 64
+
+// benchmark is one measurement. setup prepares the TPM and returns the
+// operation to time, and a function that undoes setup.
+type benchmark struct {
+	name  string
+	setup func(b *bench) (op func() (opResult, error), cleanup func(), err error)
+}
+
+// opResult is what an operation reports besides its latency.
+type opResult struct {
+	// bytes is the amount of data the operation produced.
+	bytes int
+	// rateLimited is set if the TPM refused the operation to pace it,
+	// so that it should be retried.
+	rateLimited bool
+}
+
+var benchmarks = []benchmark{
+	{"random", setupRandom},
+	{"sign-rsa", func(b *bench) (func() (opResult, error), func(), error) {
+		return b.setupSign(rsaSigningTemplate)
+	}},
+	{"sign-ecc", func(b *bench) (func() (opResult, error), func(), error) {
+		return b.setupSign(eccSigningTemplate)
+	}},
+	{"keygen-rsa", func(b *bench) (func() (opResult, error), func(), error) {
+		return b.setupKeygen(rsaSigningTemplate)
+	}},
+	{"keygen-ecc", func(b *bench) (func() (opResult, error), func(), error) {
+		return b.setupKeygen(eccSigningTemplate)
+	}},
+	{"nv-write", setupNVWrite},
+}
+
+func benchmarkNames() []string {
+	var names []string
+	for _, b := range benchmarks {
+		names = append(names, b.name)
+	}
+	return names
+}
+
+func benchmarkNamed(name string) (benchmark, bool) {
+	for _, b := range benchmarks {
+		if b.name == name {
+			return b, true
+		}
+	}
+	return benchmark{}, false
+}
+
+// result is the outcome of one benchmark in the report.
+type result struct {
+	Name    string  `json:"name"`
+	Ops     int     `json:"ops"`
+	Errors  int     `json:"errors"`
+	Seconds float64 `json:"seconds"`
+	// OpsPerSecond counts successful operations, including the time spent
+	// on failed and rate-limited ones.
+	OpsPerSecond   float64  `json:"ops_per_second"`
+	BytesPerSecond float64  `json:"bytes_per_second,omitempty"`
+	Latency        *latency `json:"latency_ms,omitempty"`
+	// RateLimited counts operations the TPM refused to pace them, and
+	// Backoff is the total time spent waiting before retrying them.
+	RateLimited int     `json:"rate_limited,omitempty"`
+	Backoff     float64 `json:"backoff_seconds,omitempty"`
+	// Error is set if the benchmark could not run, or stopped early.
+	Error string `json:"error,omitempty"`
+}
+
+// latency summarizes the latencies of successful operations, in
+// milliseconds.
+type latency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+func summarize(ds []time.Duration) *latency {
+	if len(ds) == 0 {
+		return nil
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	var sum time.Duration
+	for _, d := range ds {
+		sum += d
+	}
+	pct := func(p int) float64 { return ms(ds[(len(ds)-1)*p/100]) }
+	return &latency{
+		Min:  ms(ds[0]),
+		Mean: ms(sum / time.Duration(len(ds))),
+		P50:  pct(50),
+		P95:  pct(95),
+		P99:  pct(99),
+		Max:  ms(ds[len(ds)-1]),
+	}
+}
+
+// maxErrors stops a benchmark whose operations keep failing.
+const maxErrors = 10
+
+// bench runs benchmarks on a TPM.
+type bench struct {
+	tpm      transport.TPM
+	duration time.Duration
+	// ownerAuth is the owner hierarchy's password.
+	ownerAuth []byte
+	// nvIndex is the free NV index used by the nv-write benchmark, which
+	// writes it at most nvWrites times.
+	nvIndex  tpm2.TPMHandle
+	nvWrites int
+	// recovery is the TPM's NV write recovery time, once known.
+	recovery time.Duration
+}
+
+// run runs bm for b.duration, or until it fails too often.
+func (b *bench) run(bm benchmark) result {
+	r := result{Name: bm.name}
+	op, cleanup, err := bm.setup(b)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	defer cleanup()
+
+	var latencies []time.Duration
+	var bytes int
+	var backoff time.Duration
+	start := time.Now()
+	for time.Since(start) < b.duration {
+		opStart := time.Now()
+		res, err := op()
+		elapsed := time.Since(opStart)
+		if errors.Is(err, errStop) {
+			break
+		}
+		if err != nil {
+			r.Errors++
+			if r.Errors == maxErrors {
+				r.Error = fmt.Sprintf("stopped after %d errors; last: %v", r.Errors, err)
+				break
+			}
+			continue
+		}
+		if res.rateLimited {
+			r.RateLimited++
+			wait := max(b.recovery, time.Millisecond)
+			time.Sleep(wait)
+			backoff += wait
+			continue
+		}
+		latencies = append(latencies, elapsed)
+		bytes += res.bytes
+	}
+	total := time.Since(start)
+
+	r.Ops = len(latencies)
+	r.Seconds = total.Seconds()
+	r.OpsPerSecond = float64(r.Ops) / r.Seconds
+	if bytes > 0 {
+		r.BytesPerSecond = float64(bytes) / r.Seconds
+	}
+	r.Latency = summarize(latencies)
+	r.Backoff = backoff.Seconds()
+	return r
+}
+
+// errStop is returned by an operation to end its benchmark early, without
+// counting an error.
+var errStop = errors.New("stop")
+
+func setupRandom(b *bench) (func() (opResult, error), func(), error) {
+	op := func() (opResult, error) {
+		rsp, err := tpm2.GetRandom{BytesRequested: randomBytes}.Execute(b.tpm)
+		if err != nil {
+			return opResult{}, err
+		}
+		return opResult{bytes: len(rsp.RandomBytes.Buffer)}, nil
+	}
+	return op, func() {}, nil
+}
+
+var (
+	rsaSigningTemplate = tpm2.TPMTPublic{
+		Type:    tpm2.TPMAlgRSA,
+		NameAlg: tpm2.TPMAlgSHA256,
+		ObjectAttributes: tpm2.TPMAObject{
+			SignEncrypt:         true,
+			FixedTPM:            true,
+			FixedParent:         true,
+			SensitiveDataOrigin: true,
+			UserWithAuth:        true,
+		},
+		Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgRSA, &tpm2.TPMSRSAParms{
+			Scheme: tpm2.TPMTRSAScheme{
+				Scheme:  tpm2.TPMAlgRSASSA,
+				Details: tpm2.NewTPMUAsymScheme(tpm2.TPMAlgRSASSA, &tpm2.TPMSSigSchemeRSASSA{HashAlg: tpm2.TPMAlgSHA256}),
+			},
+			KeyBits: 2048,
+		}),
+	}
+	eccSigningTemplate = tpm2.TPMTPublic{
+		Type:    tpm2.TPMAlgECC,
+		NameAlg: tpm2.TPMAlgSHA256,
+		ObjectAttributes: tpm2.TPMAObject{
+			SignEncrypt:         true,
+			FixedTPM:            true,
+			FixedParent:         true,
+			SensitiveDataOrigin: true,
+			UserWithAuth:        true,
+		},
+		Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+			CurveID: tpm2.TPMECCNistP256,
+			Scheme: tpm2.TPMTECCScheme{
+				Scheme:  tpm2.TPMAlgECDSA,
+				Details: tpm2.NewTPMUAsymScheme(tpm2.TPMAlgECDSA, &tpm2.TPMSSigSchemeECDSA{HashAlg: tpm2.TPMAlgSHA256}),
+			},
+		}),
+	}
+)
+
+// createPrimary creates a primary key in the owner hierarchy.
+func (b *bench) createPrimary(template tpm2.TPMTPublic) (*tpm2.CreatePrimaryResponse, func(), error) {
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.AuthHandle{Handle: tpm2.TPMRHOwner, Auth: tpm2.PasswordAuth(b.ownerAuth)},
+		InPublic:      tpm2.New2B(template),
+	}.Execute(b.tpm)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating primary key: %w", err)
+	}
+	flush := func() { tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(b.tpm) }
+	return rsp, flush, nil
+}
+
+// setupSign signs digests with a key made from template.
+func (b *bench) setupSign(template tpm2.TPMTPublic) (func() (opResult, error), func(), error) {
+	key, flush, err := b.createPrimary(template)
+	if err != nil {
+		return nil, nil, err
+	}
+	digest := sha256.Sum256([]byte("gotpm bench"))
+	sign := tpm2.Sign{
+		KeyHandle:  tpm2.NamedHandle{Handle: key.ObjectHandle, Name: key.Name},
+		Digest:     tpm2.TPM2BDigest{Buffer: digest[:]},
+		InScheme:   tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+		Validation: tpm2.TPMTTKHashCheck{Tag: tpm2.TPMSTHashCheck},
+	}
+	op := func() (opResult, error) {
+		_, err := sign.Execute(b.tpm)
+		return opResult{}, err
+	}
+	return op, flush, nil
+}
+
+// setupKeygen creates keys from template under an ECC storage key. Unlike
+// primary keys, which are derived from the hierarchy's seed, these are
+// generated afresh by the TPM's key generator.
+func (b *bench) setupKeygen(template tpm2.TPMTPublic) (func() (opResult, error), func(), error) {
+	parent, flush, err := b.createPrimary(tpm2.ECCSRKTemplate)
+	if err != nil {
+		return nil, nil, err
+	}
+	create := tpm2.Create{
+		ParentHandle: tpm2.NamedHandle{Handle: parent.ObjectHandle, Name: parent.Name},
+		InPublic:     tpm2.New2B(template),
+	}
+	op := func() (opResult, error) {
+		_, err := create.Execute(b.tpm)
+		return opResult{}, err
+	}
+	return op, flush, nil
+}
+
+// setupNVWrite writes to a new NV index as fast as the TPM allows, up to
+// b.nvWrites times.
+func setupNVWrite(b *bench) (func() (opResult, error), func(), error) {
+	recovery, err := tpm2.NVWriteRecovery(b.tpm)
+	if err != nil {
+		// Fall back to polling.
+		recovery = 0
+	}
+	b.recovery = recovery
+
+	owner := tpm2.AuthHandle{Handle: tpm2.TPMRHOwner, Auth: tpm2.PasswordAuth(b.ownerAuth)}
+	def := tpm2.NVDefineSpace{
+		AuthHandle: owner,
+		PublicInfo: tpm2.New2B(tpm2.TPMSNVPublic{
+			NVIndex: b.nvIndex,
+			NameAlg: tpm2.TPMAlgSHA256,
+			Attributes: tpm2.TPMANV{
+				OwnerWrite: true,
+				OwnerRead:  true,
+				AuthWrite:  true,
+				AuthRead:   true,
+				NT:         tpm2.TPMNTOrdinary,
+				NoDA:       true,
+			},
+			DataSize: nvSize,
+		}),
+	}
+	if _, err := def.Execute(b.tpm); err != nil {
+		return nil, nil, fmt.Errorf("defining NV index 0x%08x: %w", uint32(b.nvIndex), err)
+	}
+	pub, err := def.PublicInfo.Contents()
+	if err != nil {
+		return nil, nil, err
+	}
+	name, err := tpm2.NVName(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	index := tpm2.NamedHandle{Handle: pub.NVIndex, Name: *name}
+	cleanup := func() {
+		tpm2.NVUndefineSpace{AuthHandle: owner, NVIndex: index}.Execute(b.tpm)
+	}
+
+	data := make([]byte, nvSize)
+	writes := 0
+	op := func() (opResult, error) {
+		if writes == b.nvWrites {
+			return opResult{}, errStop
+		}
+		writes++
+		// Change the data each time, so the TPM can't skip the write.
+		data[0]++
+		_, err := tpm2.NVWrite{
+			AuthHandle: tpm2.AuthHandle{Handle: index.Handle, Name: index.Name, Auth: tpm2.PasswordAuth(nil)},
+			NVIndex:    index,
+			Data:       tpm2.TPM2BMaxNVBuffer{Buffer: data},
+		}.Execute(b.tpm)
+		if errors.Is(err, tpm2.TPMRCNVRate) {
+			return opResult{rateLimited: true}, nil
+		}
+		return opResult{bytes: nvSize}, err
+	}
+	return op, cleanup, nil
+}
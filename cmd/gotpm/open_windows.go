@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import "github.com/google/go-tpm/tpm2/transport"
+
+// openTPM opens the TPM through TBS. There is only one, so path is ignored.
+func openTPM(path string) (transport.TPMCloser, error) {
+	return transport.OpenTPM()
+}
@@ -25,6 +25,7 @@ import (
 	_ "crypto/sha256"
 	_ "crypto/sha512"
 
+	"github.com/google/go-tpm/tpm2/handles"
 	"github.com/google/go-tpm/tpmutil"
 )
 
@@ -341,21 +342,23 @@ const (
 )
 
 // Allowed ranges of different kinds of Handles (TPM_HANDLE)
-// These constants have type TPMProp for backwards compatibility.
+// These constants have type TPMProp for backwards compatibility. Package
+// github.com/google/go-tpm/tpm2/handles has untyped equivalents, and
+// predicates such as handles.IsPersistent that work with tpmutil.Handle.
 const (
-	PCRFirst           TPMProp = 0x00000000
-	HMACSessionFirst   TPMProp = 0x02000000
-	LoadedSessionFirst TPMProp = 0x02000000
-	PolicySessionFirst TPMProp = 0x03000000
-	ActiveSessionFirst TPMProp = 0x03000000
-	TransientFirst     TPMProp = 0x80000000
-	PersistentFirst    TPMProp = 0x81000000
-	PersistentLast     TPMProp = 0x81FFFFFF
-	PlatformPersistent TPMProp = 0x81800000
-	NVIndexFirst       TPMProp = 0x01000000
-	NVIndexLast        TPMProp = 0x01FFFFFF
-	PermanentFirst     TPMProp = 0x40000000
-	PermanentLast      TPMProp = 0x4000010F
+	PCRFirst           TPMProp = handles.PCRFirst
+	HMACSessionFirst   TPMProp = handles.HMACSessionFirst
+	LoadedSessionFirst TPMProp = handles.HMACSessionFirst
+	PolicySessionFirst TPMProp = handles.PolicySessionFirst
+	ActiveSessionFirst TPMProp = handles.PolicySessionFirst
+	TransientFirst     TPMProp = handles.TransientFirst
+	PersistentFirst    TPMProp = handles.PersistentFirst
+	PersistentLast     TPMProp = handles.PersistentLast
+	PlatformPersistent TPMProp = handles.PlatformPersistentFirst
+	NVIndexFirst       TPMProp = handles.NVIndexFirst
+	NVIndexLast        TPMProp = handles.NVIndexLast
+	PermanentFirst     TPMProp = handles.PermanentFirst
+	PermanentLast      TPMProp = handles.AuthFF
 )
 
 // Reserved Handles.
@@ -27,7 +27,8 @@ import (
 
 // OpenTPM opens a channel to the TPM at the given path. If the file is a
 // device, then it treats it like a normal TPM device, and if the file is a
-// Unix domain socket, then it opens a connection to the socket.
+// Unix domain socket, then it opens a connection to the socket. The path may
+// also be a device, unix or tcp URI, as accepted by tpmutil.OpenTPM.
 //
 // This function may also be invoked with no paths, as tpm2.OpenTPM(). In this
 // case, the default paths on Linux (/dev/tpmrm0 then /dev/tpm0), will be used.
@@ -16,6 +16,7 @@ package tpm2
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -24,6 +25,7 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
 	"hash"
@@ -36,6 +38,7 @@ import (
 
 	"github.com/google/go-tpm-tools/simulator"
 	. "github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
 	"github.com/google/go-tpm/tpmutil"
 )
 
@@ -124,6 +127,21 @@ func TestGetRandom(t *testing.T) {
 	}
 }
 
+func TestGetRandomContext(t *testing.T) {
+	rw := openTPM(t)
+	defer rw.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctxRW := transport.ToReadWriter(transport.WithContext(ctx, transport.FromReadWriter(rw)))
+	if _, err := GetRandom(ctxRW, 16); err != nil {
+		t.Fatalf("GetRandom failed: %v", err)
+	}
+	cancel()
+	if _, err := GetRandom(ctxRW, 16); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetRandom with a canceled context = %v, want %v", err, context.Canceled)
+	}
+}
+
 func TestReadPCRs(t *testing.T) {
 	rw := openTPM(t)
 	defer rw.Close()
@@ -0,0 +1,139 @@
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-tpm/tpmutil"
+)
+
+func TestGetAuditDigest(t *testing.T) {
+	audited := []uint32{ordOIAP, ordOSAP, ordTakeOwnership, ordSign, ordOwnerClear, ordForceClear}
+	wantAD := AuditDigest{
+		Counter: CounterValue{Tag: tagCounterValue, Label: [4]byte{'A', 'U', 'D', 'T'}, Counter: 7},
+		Digest:  Digest{1, 2, 3},
+	}
+	rw := &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		if ord != ordGetAuditDigest {
+			t.Errorf("unexpected ordinal 0x%x", ord)
+			return tpmutil.ResponseCode(errBadOrdinal), nil
+		}
+		var start uint32
+		if _, err := tpmutil.Unpack(body, &start); err != nil {
+			return tpmutil.ResponseCode(errBadParameter), nil
+		}
+		// Return at most two ordinals at a time.
+		var page []byte
+		count := 0
+		more := false
+		for _, o := range audited {
+			if o < start {
+				continue
+			}
+			if count == 2 {
+				more = true
+				break
+			}
+			page = append(page, byte(o>>24), byte(o>>16), byte(o>>8), byte(o))
+			count++
+		}
+		out, _ := tpmutil.Pack(wantAD.Counter, wantAD.Digest, more, tpmutil.U32Bytes(page))
+		return tpmutil.RCSuccess, out
+	}}
+
+	ad, ords, err := GetAuditDigest(rw)
+	if err != nil {
+		t.Fatalf("GetAuditDigest: %v", err)
+	}
+	if *ad != wantAD {
+		t.Errorf("GetAuditDigest() = %+v, want %+v", *ad, wantAD)
+	}
+	if !reflect.DeepEqual(ords, audited) {
+		t.Errorf("GetAuditDigest() ordinals = %x, want %x", ords, audited)
+	}
+}
+
+func TestGetAuditDigestSigned(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	keyAuth := bytes.Repeat([]byte{0x11}, 20)
+	var nonceEven Nonce
+	rw := &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		switch ord {
+		case ordOIAP:
+			rand.Read(nonceEven[:])
+			out, _ := tpmutil.Pack(tpmutil.Handle(0x02000000), nonceEven)
+			return tpmutil.RCSuccess, out
+		case ordFlushSpecific:
+			return tpmutil.RCSuccess, nil
+		case ordGetAuditDigestSigned:
+			var keyHandle tpmutil.Handle
+			var closeAudit bool
+			var antiReplay Nonce
+			var ca commandAuth
+			if _, err := tpmutil.Unpack(body, &keyHandle, &closeAudit, &antiReplay, &ca); err != nil {
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			if want := authHMAC(t, keyAuth, nonceEven, ca.NonceOdd, ca.ContSession, ord, closeAudit, antiReplay); !hmac.Equal(ca.Auth[:], want) {
+				return tpmutil.ResponseCode(errAuthFail), nil
+			}
+			sad := SignedAuditDigest{
+				AuditDigest: AuditDigest{
+					Counter: CounterValue{Tag: tagCounterValue, Counter: 3},
+					Digest:  Digest{0xaa},
+				},
+				OrdinalDigest: Digest{0xbb},
+			}
+			si, err := newAuditSignInfo(antiReplay, &sad)
+			if err != nil {
+				t.Fatalf("newAuditSignInfo: %v", err)
+			}
+			digest := sha1.Sum(si)
+			sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, digest[:])
+			if err != nil {
+				t.Fatalf("SignPKCS1v15: %v", err)
+			}
+			rand.Read(nonceEven[:])
+			ra := responseAuth{NonceEven: nonceEven, ContSession: ca.ContSession}
+			copy(ra.Auth[:], authHMAC(t, keyAuth, ra.NonceEven, ca.NonceOdd, ra.ContSession, uint32(0), ord, sad.Counter, sad.Digest, sad.OrdinalDigest, tpmutil.U32Bytes(sig)))
+			out, _ := tpmutil.Pack(sad.Counter, sad.Digest, sad.OrdinalDigest, tpmutil.U32Bytes(sig), ra)
+			return tpmutil.RCSuccess, out
+		}
+		t.Errorf("unexpected ordinal 0x%x", ord)
+		return tpmutil.ResponseCode(errBadOrdinal), nil
+	}}
+
+	antiReplay := Nonce{9, 9, 9}
+	sad, err := GetAuditDigestSigned(rw, tpmutil.Handle(0x01000000), keyAuth, false, antiReplay)
+	if err != nil {
+		t.Fatalf("GetAuditDigestSigned: %v", err)
+	}
+	if err := VerifyAuditDigestSigned(&key.PublicKey, antiReplay, sad); err != nil {
+		t.Errorf("VerifyAuditDigestSigned: %v", err)
+	}
+	if err := VerifyAuditDigestSigned(&key.PublicKey, Nonce{}, sad); err == nil {
+		t.Error("VerifyAuditDigestSigned accepted the wrong anti-replay nonce")
+	}
+}
@@ -23,9 +23,15 @@ import (
 
 // Supported TPM commands.
 const (
+	tagSignInfo        uint16 = 0x0005
 	tagPCRInfoLong     uint16 = 0x06
+	tagCounterValue    uint16 = 0x000E
+	tagCurrentTicks    uint16 = 0x0014
 	tagNVAttributes    uint16 = 0x0017
 	tagNVDataPublic    uint16 = 0x0018
+	tagDelegations     uint16 = 0x001A
+	tagDelegatePublic  uint16 = 0x001B
+	tagQuoteInfo2      uint16 = 0x0036
 	tagRQUCommand      uint16 = 0x00C1
 	tagRQUAuth1Command uint16 = 0x00C2
 	tagRQUAuth2Command uint16 = 0x00C3
@@ -48,11 +54,15 @@ const (
 	ordGetPubKey                uint32 = 0x00000021
 	ordCreateMigrationBlob      uint32 = 0x00000028
 	ordAuthorizeMigrationKey    uint32 = 0x0000002b
+	ordCreateMaintenanceArchive uint32 = 0x0000002C
+	ordKillMaintenanceFeature   uint32 = 0x0000002E
+	ordReadManuMaintPub         uint32 = 0x00000030
 	ordSign                     uint32 = 0x0000003C
 	ordQuote2                   uint32 = 0x0000003E
 	ordResetLockValue           uint32 = 0x00000040
 	ordLoadKey2                 uint32 = 0x00000041
 	ordGetRandom                uint32 = 0x00000046
+	ordStirRandom               uint32 = 0x00000047
 	ordOwnerClear               uint32 = 0x0000005B
 	ordForceClear               uint32 = 0x0000005D
 	ordGetCapability            uint32 = 0x00000065
@@ -61,14 +71,23 @@ const (
 	ordActivateIdentity         uint32 = 0x0000007A
 	ordReadPubEK                uint32 = 0x0000007C
 	ordOwnerReadInternalPub     uint32 = 0x00000081
+	ordGetAuditDigest           uint32 = 0x00000085
+	ordGetAuditDigestSigned     uint32 = 0x00000086
+	ordSetOrdinalAuditStatus    uint32 = 0x0000008D
 	ordStartup                  uint32 = 0x00000099
 	ordFlushSpecific            uint32 = 0x000000BA
-	ordNVDefineSpace            uint32 = 0x000000CC
 	ordPcrReset                 uint32 = 0x000000C8
+	ordNVDefineSpace            uint32 = 0x000000CC
 	ordNVWriteValue             uint32 = 0x000000CD
 	ordNVWriteValueAuth         uint32 = 0x000000CE
 	ordNVReadValue              uint32 = 0x000000CF
 	ordNVReadValueAuth          uint32 = 0x000000D0
+	ordDelegateManage           uint32 = 0x000000D2
+	ordDelegateCreateOwnerDel   uint32 = 0x000000D5
+	ordDelegateLoadOwnerDel     uint32 = 0x000000D8
+	ordDelegateReadTable        uint32 = 0x000000DB
+	ordGetTicks                 uint32 = 0x000000F1
+	ordTickStampBlob            uint32 = 0x000000F2
 )
 
 // Capability types.
@@ -84,6 +103,7 @@ const (
 
 // SubCapabilities
 const (
+	SubCapPropPCR          uint32 = 0x00000101
 	SubCapPropManufacturer uint32 = 0x00000103
 	SubCapFlagPermanent    uint32 = 0x00000108
 )
@@ -157,6 +177,27 @@ const (
 	etRevoke
 )
 
+// Delegation family operations for TPM_Delegate_Manage.
+const (
+	_ uint32 = iota
+	familyCreate
+	familyEnable
+	familyAdmin
+	familyInvalidate
+)
+
+// Delegation family flags, as found in a FamilyTableEntry.
+const (
+	FamilyFlagEnable            uint32 = 0x00000001
+	FamilyFlagDelegateAdminLock uint32 = 0x00000002
+)
+
+// Delegation types, as found in Delegations.
+const (
+	DelegationTypeOwner uint32 = 0x00000000
+	DelegationTypeKey   uint32 = 0x00000001
+)
+
 // Resource types.
 const (
 	_ uint32 = iota
@@ -324,8 +365,19 @@ const (
 // fixedQuote is the fixed constant string used in quoteInfo.
 var fixedQuote = [4]byte{byte('Q'), byte('U'), byte('O'), byte('T')}
 
+// fixedQuote2 is the fixed constant string used in quoteInfo2.
+var fixedQuote2 = [4]byte{byte('Q'), byte('U'), byte('T'), byte('2')}
+
 // quoteVersion is the fixed version string for quoteInfo.
 const quoteVersion uint32 = 0x01010000
 
+// fixedAuditDigest is the fixed constant string used in the signInfo signed
+// by TPM_GetAuditDigestSigned.
+var fixedAuditDigest = [4]byte{byte('A'), byte('D'), byte('I'), byte('G')}
+
+// fixedTickStamp is the fixed constant string used in the signInfo signed by
+// TPM_TickStampBlob.
+var fixedTickStamp = [4]byte{byte('T'), byte('S'), byte('T'), byte('P')}
+
 // oaepLabel is the label used for OEAP encryption in esRSAEsOAEPSHA1MGF1
 var oaepLabel = []byte{byte('T'), byte('C'), byte('P'), byte('A')}
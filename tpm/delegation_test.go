@@ -0,0 +1,110 @@
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-tpm/tpmutil"
+)
+
+func TestReadDelegateTable(t *testing.T) {
+	families := []FamilyTableEntry{
+		{Tag: 0x0025, Label: 1, FamilyID: 10, VerificationCount: 1, Flags: FamilyFlagEnable},
+		{Tag: 0x0025, Label: 2, FamilyID: 11, VerificationCount: 3, Flags: FamilyFlagDelegateAdminLock},
+	}
+	perms := Delegations{Tag: tagDelegations, DelegateType: DelegationTypeOwner, Per1: 0x40, Per2: 0x1}
+	pub := delegatePublic{
+		Tag:      tagDelegatePublic,
+		RowLabel: 7,
+		PCRInfo: pcrInfoShort{
+			PCRsAtRelease: pcrSelection{Size: 3},
+			LocAtRelease:  LocZero,
+		},
+		Permissions:       perms,
+		FamilyID:          10,
+		VerificationCount: 1,
+	}
+	rw := &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		if ord != ordDelegateReadTable {
+			t.Errorf("unexpected ordinal 0x%x", ord)
+			return tpmutil.ResponseCode(errBadOrdinal), nil
+		}
+		familyTable, _ := tpmutil.Pack(families[0], families[1])
+		delegateTable, _ := tpmutil.Pack(uint32(2), pub)
+		out, _ := tpmutil.Pack(tpmutil.U32Bytes(familyTable), tpmutil.U32Bytes(delegateTable))
+		return tpmutil.RCSuccess, out
+	}}
+
+	gotFamilies, gotRows, err := ReadDelegateTable(rw)
+	if err != nil {
+		t.Fatalf("ReadDelegateTable: %v", err)
+	}
+	if !reflect.DeepEqual(gotFamilies, families) {
+		t.Errorf("ReadDelegateTable() families = %+v, want %+v", gotFamilies, families)
+	}
+	wantRows := []DelegateTableRow{{Index: 2, Label: 7, Permissions: perms, FamilyID: 10, VerificationCount: 1}}
+	if !reflect.DeepEqual(gotRows, wantRows) {
+		t.Errorf("ReadDelegateTable() rows = %+v, want %+v", gotRows, wantRows)
+	}
+}
+
+func TestCreateDelegationFamily(t *testing.T) {
+	ownerAuth := Digest{1, 2, 3, 4}
+	var nonceEven Nonce
+	rw := &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		switch ord {
+		case ordOIAP:
+			rand.Read(nonceEven[:])
+			out, _ := tpmutil.Pack(tpmutil.Handle(0x02000000), nonceEven)
+			return tpmutil.RCSuccess, out
+		case ordFlushSpecific:
+			return tpmutil.RCSuccess, nil
+		case ordDelegateManage:
+			var familyID, op uint32
+			var opData tpmutil.U32Bytes
+			var ca commandAuth
+			if _, err := tpmutil.Unpack(body, &familyID, &op, &opData, &ca); err != nil {
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			if want := authHMAC(t, ownerAuth[:], nonceEven, ca.NonceOdd, ca.ContSession, ord, familyID, op, opData); !hmac.Equal(ca.Auth[:], want) {
+				return tpmutil.ResponseCode(errAuthFail), nil
+			}
+			if op != familyCreate || len(opData) != 1 || opData[0] != 0x42 {
+				t.Errorf("unexpected TPM_Delegate_Manage operation %d with data %x", op, opData)
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			retData := tpmutil.U32Bytes{0, 0, 0, 5}
+			rand.Read(nonceEven[:])
+			ra := responseAuth{NonceEven: nonceEven, ContSession: ca.ContSession}
+			copy(ra.Auth[:], authHMAC(t, ownerAuth[:], ra.NonceEven, ca.NonceOdd, ra.ContSession, uint32(0), ord, retData))
+			out, _ := tpmutil.Pack(retData, ra)
+			return tpmutil.RCSuccess, out
+		}
+		t.Errorf("unexpected ordinal 0x%x", ord)
+		return tpmutil.ResponseCode(errBadOrdinal), nil
+	}}
+
+	id, err := CreateDelegationFamily(rw, ownerAuth, 0x42)
+	if err != nil {
+		t.Fatalf("CreateDelegationFamily: %v", err)
+	}
+	if id != 5 {
+		t.Errorf("CreateDelegationFamily() = %d, want 5", id)
+	}
+}
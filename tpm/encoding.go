@@ -0,0 +1,152 @@
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+//go:generate go test -run TestGeneratedEncoders -update
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// The structures in this package implement tpmutil.SelfMarshaler with
+// explicit encoders, generated into encoding_gen.go, so that tpmutil.Pack
+// and tpmutil.Unpack do not have to walk their fields by reflection. The
+// encoders produce exactly the bytes that the reflection-based packing
+// would; TestEncodersMatchReflection checks every generated structure.
+
+// encodable is implemented by the generated per-structure encoders.
+type encodable interface {
+	encode(e *encoder)
+	decode(d *decoder)
+}
+
+// marshal writes the encoding of v to w in a single Write.
+func marshal(w io.Writer, v encodable) error {
+	var e encoder
+	v.encode(&e)
+	_, err := w.Write(e.buf)
+	return err
+}
+
+// unmarshal reads the encoding of v from r.
+func unmarshal(r io.Reader, v encodable) error {
+	d := decoder{r: r}
+	v.decode(&d)
+	return d.err
+}
+
+// encoder accumulates the big-endian encoding of a structure.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) u8(v uint8) { e.buf = append(e.buf, v) }
+
+func (e *encoder) u16(v uint16) { e.buf = binary.BigEndian.AppendUint16(e.buf, v) }
+
+func (e *encoder) u32(v uint32) { e.buf = binary.BigEndian.AppendUint32(e.buf, v) }
+
+func (e *encoder) u64(v uint64) { e.buf = binary.BigEndian.AppendUint64(e.buf, v) }
+
+func (e *encoder) boolean(v bool) {
+	if v {
+		e.u8(1)
+	} else {
+		e.u8(0)
+	}
+}
+
+func (e *encoder) raw(b []byte) { e.buf = append(e.buf, b...) }
+
+func (e *encoder) u16Bytes(b []byte) {
+	e.u16(uint16(len(b)))
+	e.raw(b)
+}
+
+func (e *encoder) u32Bytes(b []byte) {
+	e.u32(uint32(len(b)))
+	e.raw(b)
+}
+
+// decoder reads the big-endian encoding of a structure. After the first
+// error, every read is a no-op returning zero, and the error is kept in err.
+type decoder struct {
+	r   io.Reader
+	err error
+	tmp [8]byte
+}
+
+// fill reads exactly len(b) bytes into b. Like binary.Read, it fails with
+// io.EOF if nothing could be read and io.ErrUnexpectedEOF on a short read.
+func (d *decoder) fill(b []byte) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = io.ReadFull(d.r, b)
+}
+
+func (d *decoder) u8() uint8 {
+	d.fill(d.tmp[:1])
+	if d.err != nil {
+		return 0
+	}
+	return d.tmp[0]
+}
+
+func (d *decoder) u16() uint16 {
+	d.fill(d.tmp[:2])
+	if d.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(d.tmp[:])
+}
+
+func (d *decoder) u32() uint32 {
+	d.fill(d.tmp[:4])
+	if d.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(d.tmp[:])
+}
+
+func (d *decoder) u64() uint64 {
+	d.fill(d.tmp[:8])
+	if d.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(d.tmp[:])
+}
+
+// boolean decodes a bool the way binary.Read does: any non-zero byte is true.
+func (d *decoder) boolean() bool { return d.u8() != 0 }
+
+// u16Bytes and u32Bytes defer to tpmutil so that size limits and buffer
+// reuse stay the same as with reflection.
+func (d *decoder) u16Bytes(b *tpmutil.U16Bytes) {
+	if d.err != nil {
+		return
+	}
+	d.err = b.TPMUnmarshal(d.r)
+}
+
+func (d *decoder) u32Bytes(b *tpmutil.U32Bytes) {
+	if d.err != nil {
+		return
+	}
+	d.err = b.TPMUnmarshal(d.r)
+}
@@ -0,0 +1,785 @@
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by "go test -run TestGeneratedEncoders -update"; DO NOT EDIT.
+
+package tpm
+
+import (
+	"io"
+
+	"github.com/google/go-tpm/tpmutil"
+)
+
+func (s *pcrSelection) encode(e *encoder) {
+	e.u16(s.Size)
+	e.raw(s.Mask[:])
+}
+
+func (s *pcrSelection) decode(d *decoder) {
+	s.Size = d.u16()
+	d.fill(s.Mask[:])
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *pcrSelection) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *pcrSelection) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *PCRSelection) encode(e *encoder) {
+	e.u16Bytes(s.Mask)
+}
+
+func (s *PCRSelection) decode(d *decoder) {
+	d.u16Bytes(&s.Mask)
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *PCRSelection) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *PCRSelection) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *pcrInfoLong) encode(e *encoder) {
+	e.u16(s.Tag)
+	e.u8(uint8(s.LocAtCreation))
+	e.u8(uint8(s.LocAtRelease))
+	s.PCRsAtCreation.encode(e)
+	s.PCRsAtRelease.encode(e)
+	e.raw(s.DigestAtCreation[:])
+	e.raw(s.DigestAtRelease[:])
+}
+
+func (s *pcrInfoLong) decode(d *decoder) {
+	s.Tag = d.u16()
+	s.LocAtCreation = Locality(d.u8())
+	s.LocAtRelease = Locality(d.u8())
+	s.PCRsAtCreation.decode(d)
+	s.PCRsAtRelease.decode(d)
+	d.fill(s.DigestAtCreation[:])
+	d.fill(s.DigestAtRelease[:])
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *pcrInfoLong) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *pcrInfoLong) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *pcrInfoShort) encode(e *encoder) {
+	s.PCRsAtRelease.encode(e)
+	e.u8(uint8(s.LocAtRelease))
+	e.raw(s.DigestAtRelease[:])
+}
+
+func (s *pcrInfoShort) decode(d *decoder) {
+	s.PCRsAtRelease.decode(d)
+	s.LocAtRelease = Locality(d.u8())
+	d.fill(s.DigestAtRelease[:])
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *pcrInfoShort) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *pcrInfoShort) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *pcrInfo) encode(e *encoder) {
+	s.PcrSelection.encode(e)
+	e.raw(s.DigestAtRelease[:])
+	e.raw(s.DigestAtCreation[:])
+}
+
+func (s *pcrInfo) decode(d *decoder) {
+	s.PcrSelection.decode(d)
+	d.fill(s.DigestAtRelease[:])
+	d.fill(s.DigestAtCreation[:])
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *pcrInfo) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *pcrInfo) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *capVersion) encode(e *encoder) {
+	e.u8(uint8(s.Major))
+	e.u8(uint8(s.Minor))
+	e.u8(s.RevMajor)
+	e.u8(s.RevMinor)
+}
+
+func (s *capVersion) decode(d *decoder) {
+	s.Major = capVersionByte(d.u8())
+	s.Minor = capVersionByte(d.u8())
+	s.RevMajor = d.u8()
+	s.RevMinor = d.u8()
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *capVersion) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *capVersion) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *CapVersionInfo) encode(e *encoder) {
+	e.u16(uint16(s.Tag))
+	s.Version.encode(e)
+	e.u16(s.SpecLevel)
+	e.u8(s.ErrataRev)
+	e.raw(s.TPMVendorID[:])
+	e.u16Bytes(s.VendorSpecific)
+}
+
+func (s *CapVersionInfo) decode(d *decoder) {
+	s.Tag = tpmutil.Tag(d.u16())
+	s.Version.decode(d)
+	s.SpecLevel = d.u16()
+	s.ErrataRev = d.u8()
+	d.fill(s.TPMVendorID[:])
+	d.u16Bytes(&s.VendorSpecific)
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *CapVersionInfo) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *CapVersionInfo) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *PermanentFlags) encode(e *encoder) {
+	e.u16(s.Tag)
+	e.boolean(s.Disable)
+	e.boolean(s.Ownership)
+	e.boolean(s.Deactivated)
+	e.boolean(s.ReadPubEK)
+	e.boolean(s.DisableOwnerClear)
+	e.boolean(s.AllowMaintenance)
+	e.boolean(s.PhysicalPresenceLifetimeLock)
+	e.boolean(s.PhysicalPresenceHWEnable)
+	e.boolean(s.PhysicalPresenceCMDEnable)
+	e.boolean(s.CEKPUsed)
+	e.boolean(s.TPMPost)
+	e.boolean(s.TPMPostLock)
+	e.boolean(s.FIPS)
+	e.boolean(s.Operator)
+	e.boolean(s.EnableRevokeEK)
+	e.boolean(s.NVLocked)
+	e.boolean(s.ReadSRKPub)
+	e.boolean(s.TPMEstablished)
+	e.boolean(s.MaintenanceDone)
+	e.boolean(s.DisableFullDALogicInfo)
+}
+
+func (s *PermanentFlags) decode(d *decoder) {
+	s.Tag = d.u16()
+	s.Disable = d.boolean()
+	s.Ownership = d.boolean()
+	s.Deactivated = d.boolean()
+	s.ReadPubEK = d.boolean()
+	s.DisableOwnerClear = d.boolean()
+	s.AllowMaintenance = d.boolean()
+	s.PhysicalPresenceLifetimeLock = d.boolean()
+	s.PhysicalPresenceHWEnable = d.boolean()
+	s.PhysicalPresenceCMDEnable = d.boolean()
+	s.CEKPUsed = d.boolean()
+	s.TPMPost = d.boolean()
+	s.TPMPostLock = d.boolean()
+	s.FIPS = d.boolean()
+	s.Operator = d.boolean()
+	s.EnableRevokeEK = d.boolean()
+	s.NVLocked = d.boolean()
+	s.ReadSRKPub = d.boolean()
+	s.TPMEstablished = d.boolean()
+	s.MaintenanceDone = d.boolean()
+	s.DisableFullDALogicInfo = d.boolean()
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *PermanentFlags) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *PermanentFlags) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *nvAttributes) encode(e *encoder) {
+	e.u16(s.Tag)
+	e.u32(uint32(s.Attributes))
+}
+
+func (s *nvAttributes) decode(d *decoder) {
+	s.Tag = d.u16()
+	s.Attributes = Permission(d.u32())
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *nvAttributes) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *nvAttributes) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *NVDataPublic) encode(e *encoder) {
+	e.u16(s.Tag)
+	e.u32(s.NVIndex)
+	s.PCRInfoRead.encode(e)
+	s.PCRInfoWrite.encode(e)
+	s.Permission.encode(e)
+	e.boolean(s.ReadSTClear)
+	e.boolean(s.WriteSTClear)
+	e.boolean(s.WriteDefine)
+	e.u32(s.Size)
+}
+
+func (s *NVDataPublic) decode(d *decoder) {
+	s.Tag = d.u16()
+	s.NVIndex = d.u32()
+	s.PCRInfoRead.decode(d)
+	s.PCRInfoWrite.decode(d)
+	s.Permission.decode(d)
+	s.ReadSTClear = d.boolean()
+	s.WriteSTClear = d.boolean()
+	s.WriteDefine = d.boolean()
+	s.Size = d.u32()
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *NVDataPublic) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *NVDataPublic) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *oiapResponse) encode(e *encoder) {
+	e.u32(uint32(s.AuthHandle))
+	e.raw(s.NonceEven[:])
+}
+
+func (s *oiapResponse) decode(d *decoder) {
+	s.AuthHandle = tpmutil.Handle(d.u32())
+	d.fill(s.NonceEven[:])
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *oiapResponse) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *oiapResponse) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *osapCommand) encode(e *encoder) {
+	e.u16(s.EntityType)
+	e.u32(uint32(s.EntityValue))
+	e.raw(s.OddOSAP[:])
+}
+
+func (s *osapCommand) decode(d *decoder) {
+	s.EntityType = d.u16()
+	s.EntityValue = tpmutil.Handle(d.u32())
+	d.fill(s.OddOSAP[:])
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *osapCommand) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *osapCommand) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *osapResponse) encode(e *encoder) {
+	e.u32(uint32(s.AuthHandle))
+	e.raw(s.NonceEven[:])
+	e.raw(s.EvenOSAP[:])
+}
+
+func (s *osapResponse) decode(d *decoder) {
+	s.AuthHandle = tpmutil.Handle(d.u32())
+	d.fill(s.NonceEven[:])
+	d.fill(s.EvenOSAP[:])
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *osapResponse) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *osapResponse) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *sealCommand) encode(e *encoder) {
+	e.u32(uint32(s.KeyHandle))
+	e.raw(s.EncAuth[:])
+}
+
+func (s *sealCommand) decode(d *decoder) {
+	s.KeyHandle = tpmutil.Handle(d.u32())
+	d.fill(s.EncAuth[:])
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *sealCommand) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *sealCommand) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *commandAuth) encode(e *encoder) {
+	e.u32(uint32(s.AuthHandle))
+	e.raw(s.NonceOdd[:])
+	e.u8(s.ContSession)
+	e.raw(s.Auth[:])
+}
+
+func (s *commandAuth) decode(d *decoder) {
+	s.AuthHandle = tpmutil.Handle(d.u32())
+	d.fill(s.NonceOdd[:])
+	s.ContSession = d.u8()
+	d.fill(s.Auth[:])
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *commandAuth) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *commandAuth) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *responseAuth) encode(e *encoder) {
+	e.raw(s.NonceEven[:])
+	e.u8(s.ContSession)
+	e.raw(s.Auth[:])
+}
+
+func (s *responseAuth) decode(d *decoder) {
+	d.fill(s.NonceEven[:])
+	s.ContSession = d.u8()
+	d.fill(s.Auth[:])
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *responseAuth) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *responseAuth) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *keyParams) encode(e *encoder) {
+	e.u32(uint32(s.AlgID))
+	e.u16(s.EncScheme)
+	e.u16(s.SigScheme)
+	e.u32Bytes(s.Params)
+}
+
+func (s *keyParams) decode(d *decoder) {
+	s.AlgID = Algorithm(d.u32())
+	s.EncScheme = d.u16()
+	s.SigScheme = d.u16()
+	d.u32Bytes(&s.Params)
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *keyParams) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *keyParams) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *rsaKeyParams) encode(e *encoder) {
+	e.u32(s.KeyLength)
+	e.u32(s.NumPrimes)
+	e.u32Bytes(s.Exponent)
+}
+
+func (s *rsaKeyParams) decode(d *decoder) {
+	s.KeyLength = d.u32()
+	s.NumPrimes = d.u32()
+	d.u32Bytes(&s.Exponent)
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *rsaKeyParams) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *rsaKeyParams) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *symmetricKeyParams) encode(e *encoder) {
+	e.u32(s.KeyLength)
+	e.u32(s.BlockSize)
+	e.u32Bytes(s.IV)
+}
+
+func (s *symmetricKeyParams) decode(d *decoder) {
+	s.KeyLength = d.u32()
+	s.BlockSize = d.u32()
+	d.u32Bytes(&s.IV)
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *symmetricKeyParams) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *symmetricKeyParams) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *key) encode(e *encoder) {
+	e.u32(s.Version)
+	e.u16(s.KeyUsage)
+	e.u32(uint32(s.KeyFlags))
+	e.u8(s.AuthDataUsage)
+	s.AlgorithmParams.encode(e)
+	e.u32Bytes(s.PCRInfo)
+	e.u32Bytes(s.PubKey)
+	e.u32Bytes(s.EncData)
+}
+
+func (s *key) decode(d *decoder) {
+	s.Version = d.u32()
+	s.KeyUsage = d.u16()
+	s.KeyFlags = KeyFlags(d.u32())
+	s.AuthDataUsage = d.u8()
+	s.AlgorithmParams.decode(d)
+	d.u32Bytes(&s.PCRInfo)
+	d.u32Bytes(&s.PubKey)
+	d.u32Bytes(&s.EncData)
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *key) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *key) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *key12) encode(e *encoder) {
+	e.u16(s.Tag)
+	e.u16(s.Zero)
+	e.u16(s.KeyUsage)
+	e.u32(s.KeyFlags)
+	e.u8(s.AuthDataUsage)
+	s.AlgorithmParams.encode(e)
+	e.u32Bytes(s.PCRInfo)
+	e.u32Bytes(s.PubKey)
+	e.u32Bytes(s.EncData)
+}
+
+func (s *key12) decode(d *decoder) {
+	s.Tag = d.u16()
+	s.Zero = d.u16()
+	s.KeyUsage = d.u16()
+	s.KeyFlags = d.u32()
+	s.AuthDataUsage = d.u8()
+	s.AlgorithmParams.decode(d)
+	d.u32Bytes(&s.PCRInfo)
+	d.u32Bytes(&s.PubKey)
+	d.u32Bytes(&s.EncData)
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *key12) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *key12) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *pubKey) encode(e *encoder) {
+	s.AlgorithmParams.encode(e)
+	e.u32Bytes(s.Key)
+}
+
+func (s *pubKey) decode(d *decoder) {
+	s.AlgorithmParams.decode(d)
+	d.u32Bytes(&s.Key)
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *pubKey) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *pubKey) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *migrationKeyAuth) encode(e *encoder) {
+	s.MigrationKey.encode(e)
+	e.u16(uint16(s.MigrationScheme))
+	e.raw(s.Digest[:])
+}
+
+func (s *migrationKeyAuth) decode(d *decoder) {
+	s.MigrationKey.decode(d)
+	s.MigrationScheme = MigrationScheme(d.u16())
+	d.fill(s.Digest[:])
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *migrationKeyAuth) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *migrationKeyAuth) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *symKey) encode(e *encoder) {
+	e.u32(uint32(s.AlgID))
+	e.u16(s.EncScheme)
+	e.u16Bytes(s.Key)
+}
+
+func (s *symKey) decode(d *decoder) {
+	s.AlgID = Algorithm(d.u32())
+	s.EncScheme = d.u16()
+	d.u16Bytes(&s.Key)
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *symKey) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *symKey) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *tpmStoredData) encode(e *encoder) {
+	e.u32(s.Version)
+	e.u32Bytes(s.Info)
+	e.u32Bytes(s.Enc)
+}
+
+func (s *tpmStoredData) decode(d *decoder) {
+	s.Version = d.u32()
+	d.u32Bytes(&s.Info)
+	d.u32Bytes(&s.Enc)
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *tpmStoredData) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *tpmStoredData) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *quoteInfo) encode(e *encoder) {
+	e.u32(s.Version)
+	e.raw(s.Fixed[:])
+	e.raw(s.CompositeDigest[:])
+	e.raw(s.Nonce[:])
+}
+
+func (s *quoteInfo) decode(d *decoder) {
+	s.Version = d.u32()
+	d.fill(s.Fixed[:])
+	d.fill(s.CompositeDigest[:])
+	d.fill(s.Nonce[:])
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *quoteInfo) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *quoteInfo) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *quoteInfo2) encode(e *encoder) {
+	e.u16(s.Tag)
+	e.raw(s.Fixed[:])
+	e.raw(s.ExternalData[:])
+	s.InfoShort.encode(e)
+}
+
+func (s *quoteInfo2) decode(d *decoder) {
+	s.Tag = d.u16()
+	d.fill(s.Fixed[:])
+	d.fill(s.ExternalData[:])
+	s.InfoShort.decode(d)
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *quoteInfo2) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *quoteInfo2) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *signInfo) encode(e *encoder) {
+	e.u16(s.Tag)
+	e.raw(s.Fixed[:])
+	e.raw(s.Replay[:])
+	e.u32Bytes(s.Data)
+}
+
+func (s *signInfo) decode(d *decoder) {
+	s.Tag = d.u16()
+	d.fill(s.Fixed[:])
+	d.fill(s.Replay[:])
+	d.u32Bytes(&s.Data)
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *signInfo) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *signInfo) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *CounterValue) encode(e *encoder) {
+	e.u16(s.Tag)
+	e.raw(s.Label[:])
+	e.u32(s.Counter)
+}
+
+func (s *CounterValue) decode(d *decoder) {
+	s.Tag = d.u16()
+	d.fill(s.Label[:])
+	s.Counter = d.u32()
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *CounterValue) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *CounterValue) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *AuditDigest) encode(e *encoder) {
+	s.Counter.encode(e)
+	e.raw(s.Digest[:])
+}
+
+func (s *AuditDigest) decode(d *decoder) {
+	s.Counter.decode(d)
+	d.fill(s.Digest[:])
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *AuditDigest) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *AuditDigest) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *SignedAuditDigest) encode(e *encoder) {
+	s.AuditDigest.encode(e)
+	e.raw(s.OrdinalDigest[:])
+	e.raw(s.Signature)
+}
+
+func (s *SignedAuditDigest) decode(d *decoder) {
+	s.AuditDigest.decode(d)
+	d.fill(s.OrdinalDigest[:])
+	d.fill(s.Signature)
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *SignedAuditDigest) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *SignedAuditDigest) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *CurrentTicks) encode(e *encoder) {
+	e.u16(s.Tag)
+	e.u64(s.CurrentTicks)
+	e.u16(s.TickRate)
+	e.raw(s.TickNonce[:])
+}
+
+func (s *CurrentTicks) decode(d *decoder) {
+	s.Tag = d.u16()
+	s.CurrentTicks = d.u64()
+	s.TickRate = d.u16()
+	d.fill(s.TickNonce[:])
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *CurrentTicks) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *CurrentTicks) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *FamilyTableEntry) encode(e *encoder) {
+	e.u16(s.Tag)
+	e.u8(s.Label)
+	e.u32(s.FamilyID)
+	e.u32(s.VerificationCount)
+	e.u32(s.Flags)
+}
+
+func (s *FamilyTableEntry) decode(d *decoder) {
+	s.Tag = d.u16()
+	s.Label = d.u8()
+	s.FamilyID = d.u32()
+	s.VerificationCount = d.u32()
+	s.Flags = d.u32()
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *FamilyTableEntry) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *FamilyTableEntry) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *Delegations) encode(e *encoder) {
+	e.u16(s.Tag)
+	e.u32(s.DelegateType)
+	e.u32(s.Per1)
+	e.u32(s.Per2)
+}
+
+func (s *Delegations) decode(d *decoder) {
+	s.Tag = d.u16()
+	s.DelegateType = d.u32()
+	s.Per1 = d.u32()
+	s.Per2 = d.u32()
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *Delegations) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *Delegations) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *delegatePublic) encode(e *encoder) {
+	e.u16(s.Tag)
+	e.u8(s.RowLabel)
+	s.PCRInfo.encode(e)
+	s.Permissions.encode(e)
+	e.u32(s.FamilyID)
+	e.u32(s.VerificationCount)
+}
+
+func (s *delegatePublic) decode(d *decoder) {
+	s.Tag = d.u16()
+	s.RowLabel = d.u8()
+	s.PCRInfo.decode(d)
+	s.Permissions.decode(d)
+	s.FamilyID = d.u32()
+	s.VerificationCount = d.u32()
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *delegatePublic) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *delegatePublic) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *DelegateTableRow) encode(e *encoder) {
+	e.u32(s.Index)
+	e.u8(s.Label)
+	s.Permissions.encode(e)
+	e.u32(s.FamilyID)
+	e.u32(s.VerificationCount)
+}
+
+func (s *DelegateTableRow) decode(d *decoder) {
+	s.Index = d.u32()
+	s.Label = d.u8()
+	s.Permissions.decode(d)
+	s.FamilyID = d.u32()
+	s.VerificationCount = d.u32()
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *DelegateTableRow) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *DelegateTableRow) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+
+func (s *pcrComposite) encode(e *encoder) {
+	s.Selection.encode(e)
+	e.u32Bytes(s.Values)
+}
+
+func (s *pcrComposite) decode(d *decoder) {
+	s.Selection.decode(d)
+	d.u32Bytes(&s.Values)
+}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *pcrComposite) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *pcrComposite) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
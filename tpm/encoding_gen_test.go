@@ -0,0 +1,192 @@
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpmutil"
+)
+
+var update = flag.Bool("update", false, "regenerate encoding_gen.go")
+
+// encodedTypes lists the structures that get generated encoders. A
+// structure that embeds one of them must be listed too, or it would
+// inherit the embedded structure's TPMMarshal and TPMUnmarshal.
+var encodedTypes = []any{
+	pcrSelection{},
+	PCRSelection{},
+	pcrInfoLong{},
+	pcrInfoShort{},
+	pcrInfo{},
+	capVersion{},
+	CapVersionInfo{},
+	PermanentFlags{},
+	nvAttributes{},
+	NVDataPublic{},
+	oiapResponse{},
+	osapCommand{},
+	osapResponse{},
+	sealCommand{},
+	commandAuth{},
+	responseAuth{},
+	keyParams{},
+	rsaKeyParams{},
+	symmetricKeyParams{},
+	key{},
+	key12{},
+	pubKey{},
+	migrationKeyAuth{},
+	symKey{},
+	tpmStoredData{},
+	quoteInfo{},
+	quoteInfo2{},
+	signInfo{},
+	CounterValue{},
+	AuditDigest{},
+	SignedAuditDigest{},
+	CurrentTicks{},
+	FamilyTableEntry{},
+	Delegations{},
+	delegatePublic{},
+	DelegateTableRow{},
+	pcrComposite{},
+}
+
+var (
+	u16BytesType = reflect.TypeOf(tpmutil.U16Bytes(nil))
+	u32BytesType = reflect.TypeOf(tpmutil.U32Bytes(nil))
+)
+
+// typeName returns the name of t as written inside this package.
+func typeName(t reflect.Type) string {
+	return strings.TrimPrefix(t.String(), "tpm.")
+}
+
+// genField writes the statements that encode and decode one field.
+func genField(enc, dec *strings.Builder, f reflect.StructField, encoded map[reflect.Type]bool) error {
+	t := f.Type
+	name := "s." + f.Name
+	conv := func(method, base string) {
+		if typeName(t) == base || (base == "uint8" && t == reflect.TypeOf(byte(0))) {
+			fmt.Fprintf(enc, "\te.%s(%s)\n", method, name)
+			fmt.Fprintf(dec, "\t%s = d.%s()\n", name, method)
+			return
+		}
+		fmt.Fprintf(enc, "\te.%s(%s(%s))\n", method, base, name)
+		fmt.Fprintf(dec, "\t%s = %s(d.%s())\n", name, typeName(t), method)
+	}
+	switch {
+	case encoded[t]:
+		fmt.Fprintf(enc, "\t%s.encode(e)\n", name)
+		fmt.Fprintf(dec, "\t%s.decode(d)\n", name)
+	case t == u16BytesType:
+		fmt.Fprintf(enc, "\te.u16Bytes(%s)\n", name)
+		fmt.Fprintf(dec, "\td.u16Bytes(&%s)\n", name)
+	case t == u32BytesType:
+		fmt.Fprintf(enc, "\te.u32Bytes(%s)\n", name)
+		fmt.Fprintf(dec, "\td.u32Bytes(&%s)\n", name)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		// Like binary.Write and binary.Read: no length prefix, and the
+		// slice's current length decides how much is read.
+		fmt.Fprintf(enc, "\te.raw(%s)\n", name)
+		fmt.Fprintf(dec, "\td.fill(%s)\n", name)
+	case t.Kind() == reflect.Array && t.Elem().Kind() == reflect.Uint8:
+		fmt.Fprintf(enc, "\te.raw(%s[:])\n", name)
+		fmt.Fprintf(dec, "\td.fill(%s[:])\n", name)
+	case t.Kind() == reflect.Bool:
+		fmt.Fprintf(enc, "\te.boolean(%s)\n", name)
+		fmt.Fprintf(dec, "\t%s = d.boolean()\n", name)
+	case t.Kind() == reflect.Uint8:
+		conv("u8", "uint8")
+	case t.Kind() == reflect.Uint16:
+		conv("u16", "uint16")
+	case t.Kind() == reflect.Uint32:
+		conv("u32", "uint32")
+	case t.Kind() == reflect.Uint64:
+		conv("u64", "uint64")
+	default:
+		return fmt.Errorf("no encoding for field %s of type %v", f.Name, t)
+	}
+	return nil
+}
+
+// generateEncoders returns the contents of encoding_gen.go.
+func generateEncoders() ([]byte, error) {
+	encoded := make(map[reflect.Type]bool)
+	for _, v := range encodedTypes {
+		encoded[reflect.TypeOf(v)] = true
+	}
+
+	license, err := os.ReadFile("encoding.go")
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	out.Write(license[:bytes.Index(license, []byte("package tpm"))])
+	out.WriteString("// Code generated by \"go test -run TestGeneratedEncoders -update\"; DO NOT EDIT.\n\n")
+	out.WriteString("package tpm\n\nimport (\n\t\"io\"\n\n\t\"github.com/google/go-tpm/tpmutil\"\n)\n")
+	for _, v := range encodedTypes {
+		t := reflect.TypeOf(v)
+		var enc, dec strings.Builder
+		for i := 0; i < t.NumField(); i++ {
+			if err := genField(&enc, &dec, t.Field(i), encoded); err != nil {
+				return nil, fmt.Errorf("%v: %w", t, err)
+			}
+		}
+		n := typeName(t)
+		fmt.Fprintf(&out, `
+func (s *%[1]s) encode(e *encoder) {
+%[2]s}
+
+func (s *%[1]s) decode(d *decoder) {
+%[3]s}
+
+// TPMMarshal implements tpmutil.SelfMarshaler.
+func (s *%[1]s) TPMMarshal(w io.Writer) error { return marshal(w, s) }
+
+// TPMUnmarshal implements tpmutil.SelfMarshaler.
+func (s *%[1]s) TPMUnmarshal(r io.Reader) error { return unmarshal(r, s) }
+`, n, enc.String(), dec.String())
+	}
+	return format.Source(out.Bytes())
+}
+
+func TestGeneratedEncoders(t *testing.T) {
+	want, err := generateEncoders()
+	if err != nil {
+		t.Fatalf("generateEncoders: %v", err)
+	}
+	if *update {
+		if err := os.WriteFile("encoding_gen.go", want, 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+		return
+	}
+	got, err := os.ReadFile("encoding_gen.go")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("encoding_gen.go is out of date; run go generate")
+	}
+}
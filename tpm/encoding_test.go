@@ -0,0 +1,148 @@
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// reflectOnly returns a pointer to a copy of v whose type has the same
+// fields but none of the methods, so that tpmutil packs it by reflection.
+// Fields keep their own types, so nested structures still use their
+// encoders; they are checked separately.
+func reflectOnly(v reflect.Value) reflect.Value {
+	t := v.Type()
+	fields := make([]reflect.StructField, t.NumField())
+	for i := range fields {
+		fields[i] = t.Field(i)
+		fields[i].Anonymous = false
+	}
+	mirror := reflect.New(reflect.StructOf(fields))
+	for i := range fields {
+		mirror.Elem().Field(i).Set(v.Field(i))
+	}
+	return mirror
+}
+
+func TestEncodersMatchReflection(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, typ := range encodedTypes {
+		typ := reflect.TypeOf(typ)
+		t.Run(typeName(typ), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				v, ok := quick.Value(typ, rnd)
+				if !ok {
+					t.Fatalf("cannot generate a %v", typ)
+				}
+				ptr := reflect.New(typ)
+				ptr.Elem().Set(v)
+
+				got, err := tpmutil.Pack(ptr.Interface())
+				if err != nil {
+					t.Fatalf("Pack(%+v): %v", v, err)
+				}
+				want, err := tpmutil.Pack(reflectOnly(v).Interface())
+				if err != nil {
+					t.Fatalf("Pack by reflection(%+v): %v", v, err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Fatalf("Pack(%+v) = %x, want %x", v, got, want)
+				}
+
+				// Decoding must consume exactly the encoding and agree
+				// with decoding by reflection.
+				decoded := reflect.New(typ)
+				mirror := reflectOnly(reflect.Zero(typ))
+				if typ == reflect.TypeOf(SignedAuditDigest{}) {
+					// Signature is read to the length it already has.
+					n := len(v.Interface().(SignedAuditDigest).Signature)
+					decoded.Elem().FieldByName("Signature").Set(reflect.ValueOf(make([]byte, n)))
+					mirror.Elem().FieldByName("Signature").Set(reflect.ValueOf(make([]byte, n)))
+				}
+				n, err := tpmutil.Unpack(got, decoded.Interface())
+				if err != nil || n != len(got) {
+					t.Fatalf("Unpack(%x) = %d, %v; want %d, nil", got, n, err, len(got))
+				}
+				if _, err := tpmutil.Unpack(got, mirror.Interface()); err != nil {
+					t.Fatalf("Unpack by reflection(%x): %v", got, err)
+				}
+				if !reflect.DeepEqual(reflectOnly(decoded.Elem()).Interface(), mirror.Interface()) {
+					t.Errorf("Unpack(%x) = %+v, want %+v", got, decoded.Elem(), mirror.Elem())
+				}
+				again, err := tpmutil.Pack(decoded.Interface())
+				if err != nil || !bytes.Equal(again, got) {
+					t.Errorf("Pack(Unpack(%x)) = %x, %v", got, again, err)
+				}
+
+				// Every truncation fails the same way as with reflection.
+				for cut := 0; cut < len(got); cut++ {
+					_, err := tpmutil.Unpack(got[:cut], reflect.New(typ).Interface())
+					_, wantErr := tpmutil.Unpack(got[:cut], reflectOnly(reflect.Zero(typ)).Interface())
+					if (err == nil) != (wantErr == nil) {
+						t.Fatalf("Unpack(%x) = %v, want %v", got[:cut], err, wantErr)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPackByValue(t *testing.T) {
+	// Structures passed by value are packed with their encoders too.
+	ca := commandAuth{AuthHandle: 0x02000000, NonceOdd: Nonce{1}, ContSession: 1, Auth: authValue{2}}
+	byValue, err := tpmutil.Pack(ca)
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	byPointer, err := tpmutil.Pack(&ca)
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	if !bytes.Equal(byValue, byPointer) || len(byValue) != 4+20+1+20 {
+		t.Errorf("Pack(commandAuth) = %x by value and %x by pointer", byValue, byPointer)
+	}
+}
+
+func BenchmarkPackKey12(b *testing.B) {
+	k := key12{
+		Tag:           0x0028,
+		KeyUsage:      keySigning,
+		AuthDataUsage: 1,
+		AlgorithmParams: keyParams{
+			AlgID:     AlgRSA,
+			SigScheme: ssRSASaPKCS1v15SHA1,
+			Params:    make([]byte, 12),
+		},
+		PubKey:  make([]byte, 256),
+		EncData: make([]byte, 256),
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, err := tpmutil.Pack(&k)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var out key12
+		if _, err := tpmutil.Unpack(buf, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// fakeTPM is an io.ReadWriter that hands each command to a handler and
+// returns the handler's response, for testing command logic without a TPM.
+type fakeTPM struct {
+	handler func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte)
+	resp    []byte
+}
+
+func (f *fakeTPM) Write(b []byte) (int, error) {
+	if len(b) < 10 {
+		return 0, errors.New("command too short")
+	}
+	tag := binary.BigEndian.Uint16(b[0:2])
+	ord := binary.BigEndian.Uint32(b[6:10])
+	code, body := f.handler(ord, b[10:])
+	if code != tpmutil.RCSuccess {
+		body = nil
+	}
+	rspTag := tagRSPCommand
+	switch tag {
+	case tagRQUAuth1Command:
+		rspTag = tagRSPAuth1Command
+	case tagRQUAuth2Command:
+		rspTag = tagRSPAuth2Command
+	}
+	var rsp bytes.Buffer
+	binary.Write(&rsp, binary.BigEndian, rspTag)
+	binary.Write(&rsp, binary.BigEndian, uint32(10+len(body)))
+	binary.Write(&rsp, binary.BigEndian, uint32(code))
+	rsp.Write(body)
+	f.resp = rsp.Bytes()
+	return len(b), nil
+}
+
+func (f *fakeTPM) Read(b []byte) (int, error) {
+	n := copy(b, f.resp)
+	f.resp = f.resp[n:]
+	return n, nil
+}
+
+// fakeOSAP answers a TPM_OSAP command for an entity with the given usage
+// auth. It returns the response, the shared secret of the new session and
+// its first even nonce.
+func fakeOSAP(body []byte, handle tpmutil.Handle, auth []byte) ([]byte, []byte, Nonce, error) {
+	var osapc osapCommand
+	if _, err := tpmutil.Unpack(body, &osapc); err != nil {
+		return nil, nil, Nonce{}, err
+	}
+	var nonceEven, evenOSAP Nonce
+	rand.Read(nonceEven[:])
+	rand.Read(evenOSAP[:])
+	mac := hmac.New(sha1.New, auth)
+	mac.Write(evenOSAP[:])
+	mac.Write(osapc.OddOSAP[:])
+	out, err := tpmutil.Pack(osapResponse{AuthHandle: handle, NonceEven: nonceEven, EvenOSAP: evenOSAP})
+	return out, mac.Sum(nil), nonceEven, err
+}
@@ -64,21 +64,96 @@ func newPCRSelection(pcrVals []int) (*pcrSelection, error) {
 // createPCRComposite composes a set of PCRs by prepending a pcrSelection and a
 // length, then computing the SHA1 hash and returning its output.
 func createPCRComposite(mask pcrMask, pcrs []byte) ([]byte, error) {
-	if len(pcrs)%PCRSize != 0 {
-		return nil, errors.New("pcrs must be a multiple of " + strconv.Itoa(PCRSize))
+	d, err := PCRCompositeHash(&PCRSelection{Mask: mask[:]}, pcrs)
+	if err != nil {
+		return nil, err
+	}
+	return d[:], nil
+}
+
+// minPCRSelectSize is the smallest sizeOfSelect that NewPCRSelection uses. The
+// PC Client specification requires TPMs to accept it even if they have fewer
+// PCRs.
+const minPCRSelectSize = 3
+
+// NewPCRSelection returns a selection of the given PCRs. Its mask is large
+// enough for the highest of them, and at least 3 bytes.
+func NewPCRSelection(pcrs []int) (*PCRSelection, error) {
+	size := minPCRSelectSize
+	for _, pcr := range pcrs {
+		if pcr < 0 || pcr >= 8*0xffff {
+			return nil, fmt.Errorf("can't select PCR %d", pcr)
+		}
+		if pcr/8+1 > size {
+			size = pcr/8 + 1
+		}
+	}
+	sel := &PCRSelection{Mask: make(tpmutil.U16Bytes, size)}
+	for _, pcr := range pcrs {
+		sel.Mask[pcr/8] |= 1 << uint(pcr%8)
 	}
+	return sel, nil
+}
+
+// PCRs returns the selected PCRs in ascending order.
+func (s *PCRSelection) PCRs() []int {
+	var pcrs []int
+	for i, b := range s.Mask {
+		for bit := 0; bit < 8; bit++ {
+			if b&(1<<uint(bit)) != 0 {
+				pcrs = append(pcrs, 8*i+bit)
+			}
+		}
+	}
+	return pcrs
+}
 
-	pcrc := pcrComposite{
-		Selection: pcrSelection{3, mask},
-		Values:    pcrs,
+// Validate checks that the selection can be used with a TPM that has numPCRs
+// PCRs, as reported by NumPCRs: every selected PCR must exist, and the mask
+// must be no larger than the TPM needs, unless it is the minimum size.
+func (s *PCRSelection) Validate(numPCRs int) error {
+	if need := (numPCRs + 7) / 8; len(s.Mask) > need && len(s.Mask) > minPCRSelectSize {
+		return fmt.Errorf("PCR selection of %d bytes is too large for a TPM with %d PCRs", len(s.Mask), numPCRs)
 	}
-	b, err := tpmutil.Pack(pcrc)
+	for _, pcr := range s.PCRs() {
+		if pcr >= numPCRs {
+			return fmt.Errorf("PCR %d is selected, but the TPM only has %d PCRs", pcr, numPCRs)
+		}
+	}
+	return nil
+}
+
+// PCRComposite returns the TPM_PCR_COMPOSITE for the given selection and the
+// values of the selected PCRs, concatenated in ascending order of PCR.
+func PCRComposite(sel *PCRSelection, pcrs []byte) ([]byte, error) {
+	if len(pcrs) != PCRSize*len(sel.PCRs()) {
+		return nil, fmt.Errorf("got %d bytes of PCR values for %d PCRs", len(pcrs), len(sel.PCRs()))
+	}
+	return tpmutil.Pack(sel, tpmutil.U32Bytes(pcrs))
+}
+
+// PCRCompositeHash returns the SHA1 hash of the PCRComposite for the given
+// selection and PCR values, which is the digest the TPM uses in PCR_INFO
+// structures and quotes.
+func PCRCompositeHash(sel *PCRSelection, pcrs []byte) (Digest, error) {
+	b, err := PCRComposite(sel, pcrs)
 	if err != nil {
-		return nil, err
+		return Digest{}, err
 	}
+	return sha1.Sum(b), nil
+}
 
-	h := sha1.Sum(b)
-	return h[:], nil
+// NumPCRs returns the number of PCRs the TPM has.
+func NumPCRs(rw io.ReadWriter) (int, error) {
+	raw, err := getCapability(rw, CapProperty, SubCapPropPCR)
+	if err != nil {
+		return 0, err
+	}
+	var n uint32
+	if _, err := tpmutil.Unpack(raw, &n); err != nil {
+		return 0, err
+	}
+	return int(n), nil
 }
 
 // String returns a string representation of a pcrInfoLong.
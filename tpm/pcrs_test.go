@@ -15,7 +15,12 @@
 package tpm
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"reflect"
 	"testing"
+
+	"github.com/google/go-tpm/tpmutil"
 )
 
 func TestPCRMask(t *testing.T) {
@@ -143,3 +148,106 @@ func TestNewPCRInfoLongWithHashes(t *testing.T) {
 		t.Fatal("Couldn't create pcrInfoLong structure")
 	}
 }
+
+func TestNewExportedPCRSelection(t *testing.T) {
+	for _, tc := range []struct {
+		pcrs     []int
+		wantMask []byte
+	}{
+		{nil, []byte{0, 0, 0}},
+		{[]int{0, 7, 23}, []byte{0x81, 0x00, 0x80}},
+		{[]int{24}, []byte{0, 0, 0, 0x01}},
+		{[]int{2, 33}, []byte{0x04, 0, 0, 0, 0x02}},
+	} {
+		sel, err := NewPCRSelection(tc.pcrs)
+		if err != nil {
+			t.Fatalf("NewPCRSelection(%v): %v", tc.pcrs, err)
+		}
+		if !bytes.Equal(sel.Mask, tc.wantMask) {
+			t.Errorf("NewPCRSelection(%v) mask = %x, want %x", tc.pcrs, sel.Mask, tc.wantMask)
+		}
+		if got := sel.PCRs(); !reflect.DeepEqual(got, tc.pcrs) {
+			t.Errorf("NewPCRSelection(%v).PCRs() = %v", tc.pcrs, got)
+		}
+	}
+	if _, err := NewPCRSelection([]int{-1}); err == nil {
+		t.Error("NewPCRSelection accepted PCR -1")
+	}
+}
+
+func TestPCRSelectionValidate(t *testing.T) {
+	for _, tc := range []struct {
+		pcrs    []int
+		numPCRs int
+		ok      bool
+	}{
+		{[]int{0, 23}, 24, true},
+		{[]int{23}, 16, false},
+		{[]int{0}, 16, true},
+		{[]int{24}, 24, false},
+		{[]int{31}, 32, true},
+		{[]int{31}, 24, false},
+	} {
+		sel, err := NewPCRSelection(tc.pcrs)
+		if err != nil {
+			t.Fatalf("NewPCRSelection(%v): %v", tc.pcrs, err)
+		}
+		if err := sel.Validate(tc.numPCRs); (err == nil) != tc.ok {
+			t.Errorf("selection of %v on a TPM with %d PCRs: Validate() = %v", tc.pcrs, tc.numPCRs, err)
+		}
+	}
+}
+
+func TestPCRCompositeHash(t *testing.T) {
+	sel, err := NewPCRSelection([]int{0, 30})
+	if err != nil {
+		t.Fatalf("NewPCRSelection: %v", err)
+	}
+	pcrs := append(bytes.Repeat([]byte{1}, PCRSize), bytes.Repeat([]byte{2}, PCRSize)...)
+	got, err := PCRCompositeHash(sel, pcrs)
+	if err != nil {
+		t.Fatalf("PCRCompositeHash: %v", err)
+	}
+	// TPM_PCR_COMPOSITE: sizeOfSelect, pcrSelect, valueSize, pcrValue.
+	composite := append([]byte{0, 4, 0x01, 0, 0, 0x40, 0, 0, 0, 40}, pcrs...)
+	if want := sha1.Sum(composite); got != want {
+		t.Errorf("PCRCompositeHash() = %x, want %x", got, want)
+	}
+	if _, err := PCRCompositeHash(sel, pcrs[:PCRSize]); err == nil {
+		t.Error("PCRCompositeHash accepted values for the wrong number of PCRs")
+	}
+
+	// The fixed-size selections used by the rest of the package give the
+	// same result.
+	var mask pcrMask
+	mask.setPCR(0)
+	legacy, err := createPCRComposite(mask, pcrs[:PCRSize])
+	if err != nil {
+		t.Fatalf("createPCRComposite: %v", err)
+	}
+	sel, _ = NewPCRSelection([]int{0})
+	if got, _ := PCRCompositeHash(sel, pcrs[:PCRSize]); !bytes.Equal(got[:], legacy) {
+		t.Errorf("PCRCompositeHash() = %x, createPCRComposite() = %x", got, legacy)
+	}
+}
+
+func TestNumPCRs(t *testing.T) {
+	rw := &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		var capArea uint32
+		var subCap tpmutil.U32Bytes
+		if _, err := tpmutil.Unpack(body, &capArea, &subCap); err != nil || ord != ordGetCapability ||
+			capArea != CapProperty || !bytes.Equal(subCap, []byte{0, 0, 1, 1}) {
+			t.Errorf("unexpected command 0x%x: %x", ord, body)
+			return tpmutil.ResponseCode(errBadParameter), nil
+		}
+		out, _ := tpmutil.Pack(tpmutil.U32Bytes{0, 0, 0, 24})
+		return tpmutil.RCSuccess, out
+	}}
+	n, err := NumPCRs(rw)
+	if err != nil {
+		t.Fatalf("NumPCRs: %v", err)
+	}
+	if n != 24 {
+		t.Errorf("NumPCRs() = %d, want 24", n)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"testing"
+
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// newQuotingTPM returns a fake TPM that supports OSAP and TPM_Quote2, signing
+// quotes with key. Its PCRs have the values in pcrValues.
+func newQuotingTPM(t *testing.T, key *rsa.PrivateKey, keyAuth []byte, pcrValues map[int][]byte) *fakeTPM {
+	var nonceEven Nonce
+	var sharedSecret []byte
+	return &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		switch ord {
+		case ordOSAP:
+			var osapc osapCommand
+			if _, err := tpmutil.Unpack(body, &osapc); err != nil {
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			var evenOSAP Nonce
+			rand.Read(nonceEven[:])
+			rand.Read(evenOSAP[:])
+			mac := hmac.New(sha1.New, keyAuth)
+			mac.Write(evenOSAP[:])
+			mac.Write(osapc.OddOSAP[:])
+			sharedSecret = mac.Sum(nil)
+			out, _ := tpmutil.Pack(osapResponse{AuthHandle: 0x02000000, NonceEven: nonceEven, EvenOSAP: evenOSAP})
+			return tpmutil.RCSuccess, out
+		case ordFlushSpecific:
+			return tpmutil.RCSuccess, nil
+		case ordQuote2:
+			var keyHandle tpmutil.Handle
+			var hash Nonce
+			var sel pcrSelection
+			var addVersion byte
+			var ca commandAuth
+			if _, err := tpmutil.Unpack(body, &keyHandle, &hash, &sel, &addVersion, &ca); err != nil {
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			if want := authHMAC(t, sharedSecret, nonceEven, ca.NonceOdd, ca.ContSession, ord, hash, sel, addVersion); !hmac.Equal(ca.Auth[:], want) {
+				return tpmutil.ResponseCode(errAuthFail), nil
+			}
+			var vals []byte
+			for i := 0; i < 24; i++ {
+				if ok, _ := sel.Mask.isPCRSet(i); ok {
+					vals = append(vals, pcrValues[i]...)
+				}
+			}
+			comp, err := createPCRComposite(sel.Mask, vals)
+			if err != nil {
+				t.Fatalf("createPCRComposite: %v", err)
+			}
+			info := pcrInfoShort{PCRsAtRelease: sel, LocAtRelease: LocZero}
+			copy(info.DigestAtRelease[:], comp)
+			var versionInfo []byte
+			if addVersion != 0 {
+				versionInfo, _ = tpmutil.Pack(CapVersionInfo{Tag: 0x0030, SpecLevel: 2, ErrataRev: 3, TPMVendorID: [4]byte{'F', 'A', 'K', 'E'}})
+			}
+			signed, _ := tpmutil.Pack(quoteInfo2{Tag: tagQuoteInfo2, Fixed: fixedQuote2, ExternalData: hash, InfoShort: info})
+			h := sha1.Sum(append(signed, versionInfo...))
+			sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, h[:])
+			if err != nil {
+				t.Fatalf("SignPKCS1v15: %v", err)
+			}
+			rand.Read(nonceEven[:])
+			ra := responseAuth{NonceEven: nonceEven, ContSession: ca.ContSession}
+			copy(ra.Auth[:], authHMAC(t, sharedSecret, ra.NonceEven, ca.NonceOdd, ra.ContSession, uint32(0), ord, info, tpmutil.U32Bytes(versionInfo), tpmutil.U32Bytes(sig)))
+			out, _ := tpmutil.Pack(info, tpmutil.U32Bytes(versionInfo), tpmutil.U32Bytes(sig), ra)
+			return tpmutil.RCSuccess, out
+		}
+		t.Errorf("unexpected ordinal 0x%x", ord)
+		return tpmutil.ResponseCode(errBadOrdinal), nil
+	}}
+}
+
+func TestVerifyQuote2(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	keyAuth := bytes.Repeat([]byte{0x33}, 20)
+	pcrValues := map[int][]byte{
+		0: bytes.Repeat([]byte{0x01}, PCRSize),
+		7: bytes.Repeat([]byte{0x02}, PCRSize),
+	}
+	pcrNums := []int{0, 7}
+	pcrs := append(append([]byte{}, pcrValues[0]...), pcrValues[7]...)
+	data := []byte("nonce")
+
+	for _, addVersion := range []byte{0, 1} {
+		rw := newQuotingTPM(t, key, keyAuth, pcrValues)
+		q, err := Quote2Signed(rw, tpmutil.Handle(0x01000000), data, pcrNums, addVersion, keyAuth)
+		if err != nil {
+			t.Fatalf("Quote2Signed: %v", err)
+		}
+		if (len(q.VersionInfo) != 0) != (addVersion != 0) {
+			t.Errorf("Quote2Signed(addVersion=%d) returned version info %x", addVersion, q.VersionInfo)
+		}
+		if err := VerifyQuote2(&key.PublicKey, data, q, pcrNums, pcrs); err != nil {
+			t.Errorf("VerifyQuote2(addVersion=%d): %v", addVersion, err)
+		}
+		if err := VerifyQuote2(&key.PublicKey, []byte("other"), q, pcrNums, pcrs); err == nil {
+			t.Error("VerifyQuote2 accepted the wrong data")
+		}
+		if err := VerifyQuote2(&key.PublicKey, data, q, []int{0}, pcrValues[0]); err == nil {
+			t.Error("VerifyQuote2 accepted the wrong PCR selection")
+		}
+		if err := VerifyQuote2(&key.PublicKey, data, q, pcrNums, make([]byte, len(pcrs))); err == nil {
+			t.Error("VerifyQuote2 accepted the wrong PCR values")
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/google/go-tpm/tpmutil"
+)
+
+func TestRandReader(t *testing.T) {
+	// The fake TPM returns at most 16 bytes per call, counting up from 0.
+	var next byte
+	calls := 0
+	rw := &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		if ord != ordGetRandom {
+			t.Errorf("unexpected ordinal 0x%x", ord)
+			return tpmutil.ResponseCode(errBadOrdinal), nil
+		}
+		calls++
+		var size uint32
+		if _, err := tpmutil.Unpack(body, &size); err != nil || size > maxGetRandomSize {
+			t.Errorf("bad TPM_GetRandom request: size %d, err %v", size, err)
+			return tpmutil.ResponseCode(errBadParameter), nil
+		}
+		if size > 16 {
+			size = 16
+		}
+		b := make([]byte, size)
+		for i := range b {
+			b[i] = next
+			next++
+		}
+		out, _ := tpmutil.Pack(tpmutil.U32Bytes(b))
+		return tpmutil.RCSuccess, out
+	}}
+
+	got := make([]byte, 200)
+	if _, err := io.ReadFull(NewRandReader(rw), got); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	for i, b := range got {
+		if b != byte(i) {
+			t.Fatalf("byte %d = %d, want %d", i, b, byte(i))
+		}
+	}
+	if want := (len(got) + 15) / 16; calls != want {
+		t.Errorf("RandReader made %d TPM_GetRandom calls, want %d", calls, want)
+	}
+}
+
+func TestStirRandom(t *testing.T) {
+	var stirred []byte
+	calls := 0
+	rw := &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		if ord != ordStirRandom {
+			t.Errorf("unexpected ordinal 0x%x", ord)
+			return tpmutil.ResponseCode(errBadOrdinal), nil
+		}
+		calls++
+		var data tpmutil.U32Bytes
+		if _, err := tpmutil.Unpack(body, &data); err != nil || len(data) > maxStirRandomSize {
+			t.Errorf("bad TPM_StirRandom request: size %d, err %v", len(data), err)
+			return tpmutil.ResponseCode(errBadParameter), nil
+		}
+		stirred = append(stirred, data...)
+		return tpmutil.RCSuccess, nil
+	}}
+
+	data := bytes.Repeat([]byte("entropy"), 100)
+	if err := StirRandom(rw, data); err != nil {
+		t.Fatalf("StirRandom: %v", err)
+	}
+	if !bytes.Equal(stirred, data) {
+		t.Errorf("TPM received %d bytes of entropy, want %d", len(stirred), len(data))
+	}
+	if want := (len(data) + maxStirRandomSize - 1) / maxStirRandomSize; calls != want {
+		t.Errorf("StirRandom made %d calls, want %d", calls, want)
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// newSealingTPM returns a fake TPM that supports OSAP and TPM_Seal. The sealed
+// blob it returns contains the PCR info it was given, unencrypted. If dataAuth
+// is not nil, the decrypted auth value of the sealed data is stored in it.
+func newSealingTPM(t *testing.T, srkAuth []byte, dataAuth *Digest) *fakeTPM {
+	var nonceEven Nonce
+	var sharedSecret []byte
+	return &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		switch ord {
+		case ordOSAP:
+			var osapc osapCommand
+			if _, err := tpmutil.Unpack(body, &osapc); err != nil {
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			var evenOSAP Nonce
+			rand.Read(nonceEven[:])
+			rand.Read(evenOSAP[:])
+			mac := hmac.New(sha1.New, srkAuth)
+			mac.Write(evenOSAP[:])
+			mac.Write(osapc.OddOSAP[:])
+			sharedSecret = mac.Sum(nil)
+			out, _ := tpmutil.Pack(osapResponse{AuthHandle: 0x02000000, NonceEven: nonceEven, EvenOSAP: evenOSAP})
+			return tpmutil.RCSuccess, out
+		case ordFlushSpecific:
+			return tpmutil.RCSuccess, nil
+		case ordSeal:
+			var sc sealCommand
+			var pcrInfo tpmutil.U32Bytes
+			var data tpmutil.U32Bytes
+			var ca commandAuth
+			if _, err := tpmutil.Unpack(body, &sc, &pcrInfo, &data, &ca); err != nil {
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			want := authHMAC(t, sharedSecret, nonceEven, ca.NonceOdd, ca.ContSession, ordSeal, sc.EncAuth, pcrInfo, data)
+			if !hmac.Equal(ca.Auth[:], want) {
+				return tpmutil.ResponseCode(errAuthFail), nil
+			}
+			if dataAuth != nil {
+				var key [20]byte
+				copy(key[:], sharedSecret)
+				*dataAuth = adipEncrypt(key, nonceEven, Digest(sc.EncAuth))
+			}
+			tsd := tpmStoredData{Version: 0x01010000, Info: pcrInfo, Enc: data}
+			rand.Read(nonceEven[:])
+			ra := responseAuth{NonceEven: nonceEven, ContSession: ca.ContSession}
+			copy(ra.Auth[:], authHMAC(t, sharedSecret, ra.NonceEven, ca.NonceOdd, ra.ContSession, uint32(0), ordSeal, tsd))
+			out, _ := tpmutil.Pack(tsd, ra)
+			return tpmutil.RCSuccess, out
+		}
+		t.Errorf("unexpected ordinal 0x%x", ord)
+		return tpmutil.ResponseCode(errBadOrdinal), nil
+	}}
+}
+
+func TestSealWithOptions(t *testing.T) {
+	srkAuth := make([]byte, 20)
+	pcrValues := map[int][]byte{
+		0: bytes.Repeat([]byte{0x01}, PCRSize),
+		7: bytes.Repeat([]byte{0x02}, PCRSize),
+	}
+	var mask pcrMask
+	mask.setPCR(0)
+	mask.setPCR(7)
+	composite, err := createPCRComposite(mask, append(append([]byte{}, pcrValues[0]...), pcrValues[7]...))
+	if err != nil {
+		t.Fatalf("createPCRComposite: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		opts     SealOptions
+		wantInfo interface{}
+	}{
+		{
+			name: "NoPCRs",
+		},
+		{
+			name: "PCRInfoLong",
+			opts: SealOptions{PCRValues: pcrValues, LocalityAtRelease: LocZero},
+			wantInfo: &pcrInfoLong{
+				Tag:            tagPCRInfoLong,
+				LocAtCreation:  LocZero,
+				LocAtRelease:   LocZero,
+				PCRsAtCreation: pcrSelection{3, mask},
+				PCRsAtRelease:  pcrSelection{3, mask},
+			},
+		},
+		{
+			name: "PCRInfo",
+			opts: SealOptions{PCRValues: pcrValues, Version: PCRInfoVersion11},
+			wantInfo: &pcrInfo{
+				PcrSelection: pcrSelection{3, mask},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			switch info := tc.wantInfo.(type) {
+			case *pcrInfoLong:
+				copy(info.DigestAtCreation[:], composite)
+				copy(info.DigestAtRelease[:], composite)
+			case *pcrInfo:
+				copy(info.DigestAtCreation[:], composite)
+				copy(info.DigestAtRelease[:], composite)
+			}
+
+			sealed, err := SealWithOptions(newSealingTPM(t, srkAuth, nil), []byte("secret"), srkAuth, tc.opts)
+			if err != nil {
+				t.Fatalf("SealWithOptions: %v", err)
+			}
+			var tsd tpmStoredData
+			if _, err := tpmutil.Unpack(sealed, &tsd); err != nil {
+				t.Fatalf("Unpack: %v", err)
+			}
+			var want []byte
+			if tc.wantInfo != nil {
+				if want, err = tpmutil.Pack(tc.wantInfo); err != nil {
+					t.Fatalf("Pack: %v", err)
+				}
+			}
+			if !bytes.Equal(tsd.Info, want) {
+				t.Errorf("sealed PCR info = %x, want %x", tsd.Info, want)
+			}
+		})
+	}
+}
+
+func TestSealedPCRs(t *testing.T) {
+	srkAuth := make([]byte, 20)
+	pcrValues := map[int][]byte{
+		0:  make([]byte, PCRSize),
+		7:  make([]byte, PCRSize),
+		16: make([]byte, PCRSize),
+	}
+	all := LocZero | LocOne | LocTwo | LocThree | LocFour
+	for _, tc := range []struct {
+		name     string
+		opts     SealOptions
+		wantPCRs []int
+		wantLoc  Locality
+	}{
+		{"NoPCRs", SealOptions{}, nil, all},
+		{"PCRInfoLong", SealOptions{PCRValues: pcrValues, LocalityAtRelease: LocZero | LocThree}, []int{0, 7, 16}, LocZero | LocThree},
+		{"PCRInfo", SealOptions{PCRValues: pcrValues, Version: PCRInfoVersion11}, []int{0, 7, 16}, all},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sealed, err := SealWithOptions(newSealingTPM(t, srkAuth, nil), []byte("secret"), srkAuth, tc.opts)
+			if err != nil {
+				t.Fatalf("SealWithOptions: %v", err)
+			}
+			pcrs, loc, err := SealedPCRs(sealed)
+			if err != nil {
+				t.Fatalf("SealedPCRs: %v", err)
+			}
+			if fmt.Sprint(pcrs) != fmt.Sprint(tc.wantPCRs) || loc != tc.wantLoc {
+				t.Errorf("SealedPCRs() = %v, %v, want %v, %v", pcrs, loc, tc.wantPCRs, tc.wantLoc)
+			}
+		})
+	}
+
+	if _, _, err := SealedPCRs([]byte{1, 2, 3}); err == nil {
+		t.Error("SealedPCRs() of a truncated blob succeeded, want error")
+	}
+}
+
+func TestSealWithOptionsErrors(t *testing.T) {
+	srkAuth := make([]byte, 20)
+	pcrValues := map[int][]byte{0: make([]byte, PCRSize)}
+	for _, tc := range []struct {
+		name string
+		opts SealOptions
+	}{
+		{"LocalityWithoutPCRs", SealOptions{LocalityAtRelease: LocZero}},
+		{"LocalityWithPCRInfo", SealOptions{PCRValues: pcrValues, Version: PCRInfoVersion11, LocalityAtRelease: LocZero}},
+		{"BadPCRValue", SealOptions{PCRValues: map[int][]byte{0: {1, 2, 3}}}},
+		{"BadPCRIndex", SealOptions{PCRValues: map[int][]byte{24: make([]byte, PCRSize)}}},
+		{"BadVersion", SealOptions{PCRValues: pcrValues, Version: PCRInfoVersion(7)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := SealWithOptions(newSealingTPM(t, srkAuth, nil), []byte("secret"), srkAuth, tc.opts); err == nil {
+				t.Error("SealWithOptions succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestSealDataAuth(t *testing.T) {
+	srkAuth := bytes.Repeat([]byte{0x01}, 20)
+	dataAuth := Digest{0x02, 0x03}
+	for _, tc := range []struct {
+		name string
+		opts SealOptions
+		want Digest
+	}{
+		{"Default", SealOptions{}, Digest(srkAuth)},
+		{"DataAuth", SealOptions{DataAuth: &dataAuth}, dataAuth},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got Digest
+			if _, err := SealWithOptions(newSealingTPM(t, srkAuth, &got), []byte("secret"), srkAuth, tc.opts); err != nil {
+				t.Fatalf("SealWithOptions: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("TPM received data auth %x, want %x", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestADIPEncrypt(t *testing.T) {
+	var secret [20]byte
+	var nonce Nonce
+	rand.Read(secret[:])
+	rand.Read(nonce[:])
+	auth := Digest{0x01, 0x02, 0x03}
+
+	enc := adipEncrypt(secret, nonce, auth)
+	if enc == auth {
+		t.Errorf("adipEncrypt left the auth value unencrypted")
+	}
+	pad := sha1.Sum(append(secret[:], nonce[:]...))
+	for i := range enc {
+		if enc[i] != auth[i]^pad[i] {
+			t.Fatalf("adipEncrypt() = %x, want XOR with SHA1(sharedSecret || nonce)", enc)
+		}
+	}
+	if dec := adipEncrypt(secret, nonce, enc); dec != auth {
+		t.Errorf("decrypting gave %x, want %x", dec, auth)
+	}
+}
+
+// newUnsealingTPM returns a fake TPM that supports OSAP, OIAP and TPM_Unseal
+// of blobs whose Enc field holds the data unencrypted, checking the HMACs of
+// both authorizations against srkAuth and dataAuth.
+func newUnsealingTPM(t *testing.T, srkAuth, dataAuth []byte) *fakeTPM {
+	var srkEven, dataEven Nonce
+	var sharedSecret []byte
+	return &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		switch ord {
+		case ordOSAP:
+			out, secret, even, err := fakeOSAP(body, 0x02000000, srkAuth)
+			if err != nil {
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			sharedSecret, srkEven = secret, even
+			return tpmutil.RCSuccess, out
+		case ordOIAP:
+			rand.Read(dataEven[:])
+			out, _ := tpmutil.Pack(tpmutil.Handle(0x02000001), dataEven)
+			return tpmutil.RCSuccess, out
+		case ordFlushSpecific:
+			return tpmutil.RCSuccess, nil
+		case ordUnseal:
+			var keyHandle tpmutil.Handle
+			var tsd tpmStoredData
+			var ca1, ca2 commandAuth
+			if _, err := tpmutil.Unpack(body, &keyHandle, &tsd, &ca1, &ca2); err != nil {
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			if ca1.AuthHandle != 0x02000000 || ca2.AuthHandle != 0x02000001 {
+				t.Errorf("TPM_Unseal authorized by sessions %x and %x, want the OSAP session first", ca1.AuthHandle, ca2.AuthHandle)
+			}
+			if want := authHMAC(t, sharedSecret, srkEven, ca1.NonceOdd, ca1.ContSession, ord, tsd); !hmac.Equal(ca1.Auth[:], want) {
+				return tpmutil.ResponseCode(errAuthFail), nil
+			}
+			if want := authHMAC(t, dataAuth, dataEven, ca2.NonceOdd, ca2.ContSession, ord, tsd); !hmac.Equal(ca2.Auth[:], want) {
+				return tpmutil.ResponseCode(errAuth2Fail), nil
+			}
+			rand.Read(srkEven[:])
+			rand.Read(dataEven[:])
+			data := tpmutil.U32Bytes(tsd.Enc)
+			ra1 := responseAuth{NonceEven: srkEven, ContSession: ca1.ContSession}
+			copy(ra1.Auth[:], authHMAC(t, sharedSecret, ra1.NonceEven, ca1.NonceOdd, ra1.ContSession, uint32(0), ord, data))
+			ra2 := responseAuth{NonceEven: dataEven, ContSession: ca2.ContSession}
+			copy(ra2.Auth[:], authHMAC(t, dataAuth, ra2.NonceEven, ca2.NonceOdd, ra2.ContSession, uint32(0), ord, data))
+			out, _ := tpmutil.Pack(data, ra1, ra2)
+			return tpmutil.RCSuccess, out
+		}
+		t.Errorf("unexpected ordinal 0x%x", ord)
+		return tpmutil.ResponseCode(errBadOrdinal), nil
+	}}
+}
+
+func TestUnsealWithAuth(t *testing.T) {
+	srkAuth := bytes.Repeat([]byte{0x01}, 20)
+	dataAuth := Digest{0x02, 0x03}
+	sealed, err := tpmutil.Pack(tpmStoredData{Version: 0x01010000, Enc: []byte("secret")})
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+
+	got, err := UnsealWithAuth(newUnsealingTPM(t, srkAuth, dataAuth[:]), sealed, srkAuth, dataAuth)
+	if err != nil {
+		t.Fatalf("UnsealWithAuth: %v", err)
+	}
+	if string(got) != "secret" {
+		t.Errorf("UnsealWithAuth() = %q, want %q", got, "secret")
+	}
+
+	_, err = UnsealWithAuth(newUnsealingTPM(t, srkAuth, dataAuth[:]), sealed, srkAuth, Digest{0x04})
+	if !errors.Is(err, tpmError(errAuth2Fail)) {
+		t.Errorf("UnsealWithAuth with the wrong data auth returned %v, want %v", err, tpmError(errAuth2Fail))
+	}
+}
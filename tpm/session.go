@@ -0,0 +1,269 @@
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"errors"
+	"io"
+
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// EntityType identifies the kind of entity an OSAP session is bound to.
+type EntityType uint16
+
+// Entity types that can be used with NewOSAPSession.
+const (
+	EntityKeyHandle = EntityType(etKeyHandle)
+	EntityOwner     = EntityType(etOwner)
+	EntityData      = EntityType(etData)
+	EntitySRK       = EntityType(etSRK)
+	EntityKey       = EntityType(etKey)
+)
+
+// errSessionClosed is returned when a closed AuthSession is used.
+var errSessionClosed = errors.New("authorization session is closed")
+
+// errNotOSAP is returned when ADIP encryption is asked of an OIAP session.
+var errNotOSAP = errors.New("ADIP encryption requires an OSAP session")
+
+// An AuthSession is an OIAP or OSAP authorization session. It computes the
+// HMAC for each command it authorizes, rolls the nonces from one command to
+// the next and checks the HMAC of each response, so that callers don't have
+// to deal with commandAuth and responseAuth structures directly.
+//
+// An AuthSession is not safe for concurrent use.
+type AuthSession struct {
+	rw        io.ReadWriter
+	handle    tpmutil.Handle
+	nonceEven Nonce
+	// key is the HMAC key: the usage auth of the entity for OIAP, or the
+	// shared secret for OSAP.
+	key []byte
+	// nonceOdd, if set, is the odd nonce of the next command, chosen early
+	// by encryptAuthOdd.
+	nonceOdd *Nonce
+	osap     bool
+	closed   bool
+}
+
+// NewOIAPSession starts an OIAP session that authorizes commands with the
+// given usage auth. OIAP sessions can be used with any entity, but every
+// command run in the session must use the same auth value.
+func NewOIAPSession(rw io.ReadWriter, auth []byte) (*AuthSession, error) {
+	oiapr, err := oiap(rw)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthSession{
+		rw:        rw,
+		handle:    oiapr.AuthHandle,
+		nonceEven: oiapr.NonceEven,
+		key:       append([]byte(nil), auth...),
+	}, nil
+}
+
+// NewOSAPSession starts an OSAP session bound to the given entity, using its
+// usage auth to derive the session's shared secret.
+func NewOSAPSession(rw io.ReadWriter, entityType EntityType, entity tpmutil.Handle, auth []byte) (*AuthSession, error) {
+	sharedSecret, osapr, err := newOSAPSession(rw, uint16(entityType), entity, auth)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(sharedSecret[:])
+	return &AuthSession{
+		rw:        rw,
+		handle:    osapr.AuthHandle,
+		nonceEven: osapr.NonceEven,
+		key:       append([]byte(nil), sharedSecret[:]...),
+		osap:      true,
+	}, nil
+}
+
+// Handle returns the TPM handle of the session.
+func (s *AuthSession) Handle() tpmutil.Handle {
+	return s.handle
+}
+
+// EncryptAuth encrypts a new auth value for the entity bound to an OSAP
+// session with the XOR ADIP, as used by the encAuth parameters of commands
+// such as TPM_Seal and TPM_CreateWrapKey:
+//
+//	encAuth = XOR(auth, SHA1(sharedSecret || nonceEven))
+//
+// where nonceEven is the most recent even nonce received from the TPM.
+func (s *AuthSession) EncryptAuth(auth Digest) (Digest, error) {
+	if s.closed {
+		return Digest{}, errSessionClosed
+	}
+	if !s.osap {
+		return Digest{}, errNotOSAP
+	}
+	var key [20]byte
+	copy(key[:], s.key)
+	defer zeroBytes(key[:])
+	return adipEncrypt(key, s.nonceEven, auth), nil
+}
+
+// encryptAuthOdd is like EncryptAuth, but encrypts with the odd nonce of the
+// next command run in the session instead of the even nonce. Commands that
+// insert two auth values, such as TPM_CreateWrapKey, encrypt the second one
+// this way.
+func (s *AuthSession) encryptAuthOdd(auth Digest) (Digest, error) {
+	if s.closed {
+		return Digest{}, errSessionClosed
+	}
+	if !s.osap {
+		return Digest{}, errNotOSAP
+	}
+	if s.nonceOdd == nil {
+		var odd Nonce
+		if _, err := rand.Read(odd[:]); err != nil {
+			return Digest{}, err
+		}
+		s.nonceOdd = &odd
+	}
+	var key [20]byte
+	copy(key[:], s.key)
+	defer zeroBytes(key[:])
+	return adipEncrypt(key, *s.nonceOdd, auth), nil
+}
+
+// adipEncrypt encrypts auth with the XOR ADIP, using the shared secret of an
+// OSAP session and a nonce:
+//
+//	encAuth = XOR(auth, SHA1(sharedSecret || nonce))
+//
+// The nonce is normally the last even nonce from the TPM. A command that
+// inserts two auth values encrypts the second with its odd nonce instead, so
+// that the two keystreams differ.
+func adipEncrypt(sharedSecret [20]byte, nonce Nonce, auth Digest) Digest {
+	h := sha1.New()
+	h.Write(sharedSecret[:])
+	h.Write(nonce[:])
+	pad := h.Sum(nil)
+	defer zeroBytes(pad)
+	var enc Digest
+	for i := range enc {
+		enc[i] = auth[i] ^ pad[i]
+	}
+	return enc
+}
+
+// RunCommand runs an auth1 command authorized by the session. The handles are
+// sent in front of the parameters but, as required by the TPM 1.2
+// specification, aren't covered by the HMAC. The out values are unpacked from
+// the response parameters and used to verify the response HMAC. The session
+// is kept open after the command, with its nonces updated, so that it can
+// authorize further commands.
+func (s *AuthSession) RunCommand(ord uint32, handles, params, out []interface{}) error {
+	return runCommand([]*AuthSession{s}, ord, handles, params, nil, out)
+}
+
+// RunCommand2 is like RunCommand, but runs an auth2 command, such as
+// TPM_Unseal or TPM_ActivateIdentity, which needs a second authorization:
+// s provides the first, usually for the key handle, and second provides the
+// other. Both sessions must have been started on the same TPM. Both HMAC the
+// same parameters, and both are kept open after the command.
+func (s *AuthSession) RunCommand2(second *AuthSession, ord uint32, handles, params, out []interface{}) error {
+	return runCommand([]*AuthSession{s, second}, ord, handles, params, nil, out)
+}
+
+// runCommand runs a command authorized by one or two sessions, in the order
+// in which the command takes their authorizations. The outHandles are
+// unpacked from the response in front of the out values and, like the
+// command's handles, aren't covered by the HMAC.
+func runCommand(sessions []*AuthSession, ord uint32, handles, params, outHandles, out []interface{}) error {
+	for _, s := range sessions {
+		if s.closed {
+			return errSessionClosed
+		}
+	}
+
+	authIn := append([]interface{}{ord}, params...)
+	cas := make([]*commandAuth, len(sessions))
+	for i, s := range sessions {
+		ca, err := newCommandAuth(s.handle, s.nonceEven, s.nonceOdd, s.key, authIn, true)
+		if err != nil {
+			return err
+		}
+		s.nonceOdd = nil
+		cas[i] = ca
+	}
+
+	var in []interface{}
+	in = append(in, handles...)
+	in = append(in, params...)
+	ras := make([]responseAuth, len(sessions))
+	// Copy out so that appending the response auths can't write into the
+	// caller's array.
+	outAuth := append(append([]interface{}(nil), outHandles...), out...)
+	for i := range sessions {
+		in = append(in, cas[i])
+		outAuth = append(outAuth, &ras[i])
+	}
+	tag := uint16(tagRQUAuth1Command)
+	if len(sessions) == 2 {
+		tag = tagRQUAuth2Command
+	}
+	ret, err := submitTPMRequest(sessions[0].rw, tag, ord, in, outAuth)
+	if err != nil {
+		var tpmErr tpmError
+		if errors.As(err, &tpmErr) {
+			// A failed command terminates the authorization sessions.
+			for _, s := range sessions {
+				s.invalidate()
+			}
+		}
+		return err
+	}
+
+	raIn := append([]interface{}{ret, ord}, out...)
+	for i, s := range sessions {
+		if err := ras[i].verify(cas[i].NonceOdd, s.key, raIn); err != nil {
+			// The response can't be trusted, nor can the nonces it
+			// carries, so the sessions can't authorize anything else.
+			for _, s := range sessions {
+				s.Close()
+			}
+			return err
+		}
+	}
+	for i, s := range sessions {
+		s.nonceEven = ras[i].NonceEven
+		if ras[i].ContSession == 0 {
+			s.invalidate()
+		}
+	}
+	return nil
+}
+
+// Close flushes the session from the TPM, if it's still open, and zeroes its
+// secrets.
+func (s *AuthSession) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.invalidate()
+	return flushSpecific(s.rw, s.handle, rtAuth)
+}
+
+// invalidate marks the session as closed and zeroes its secrets.
+func (s *AuthSession) invalidate() {
+	s.closed = true
+	zeroBytes(s.key)
+}
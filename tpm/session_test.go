@@ -0,0 +1,281 @@
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"errors"
+	"testing"
+
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// authHMAC computes HMAC-SHA1(key, SHA1(params) || even || odd || cont).
+func authHMAC(t *testing.T, key []byte, even, odd Nonce, cont byte, params ...interface{}) []byte {
+	t.Helper()
+	b, err := tpmutil.Pack(params...)
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	digest := sha1.Sum(b)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(digest[:])
+	mac.Write(even[:])
+	mac.Write(odd[:])
+	mac.Write([]byte{cont})
+	return mac.Sum(nil)
+}
+
+// newSigningTPM returns a fake TPM that supports OIAP and TPM_Sign, checking
+// command HMACs against the given usage auth. If tamper is set, the TPM
+// returns an invalid response HMAC.
+func newSigningTPM(t *testing.T, usageAuth []byte, tamper bool) *fakeTPM {
+	var nonceEven Nonce
+	roll := func() {
+		if _, err := rand.Read(nonceEven[:]); err != nil {
+			t.Fatalf("rand.Read: %v", err)
+		}
+	}
+	return &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		switch ord {
+		case ordOIAP:
+			roll()
+			out, _ := tpmutil.Pack(tpmutil.Handle(0x02000000), nonceEven)
+			return tpmutil.RCSuccess, out
+		case ordFlushSpecific:
+			return tpmutil.RCSuccess, nil
+		case ordSign:
+			var keyHandle tpmutil.Handle
+			var data tpmutil.U32Bytes
+			var ca commandAuth
+			if _, err := tpmutil.Unpack(body, &keyHandle, &data, &ca); err != nil {
+				t.Errorf("Unpack: %v", err)
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			want := authHMAC(t, usageAuth, nonceEven, ca.NonceOdd, ca.ContSession, ordSign, data)
+			if !hmac.Equal(ca.Auth[:], want) {
+				return tpmutil.ResponseCode(errAuthFail), nil
+			}
+			roll()
+			sig := tpmutil.U32Bytes(append([]byte("sig:"), data...))
+			ra := responseAuth{NonceEven: nonceEven, ContSession: ca.ContSession}
+			copy(ra.Auth[:], authHMAC(t, usageAuth, ra.NonceEven, ca.NonceOdd, ra.ContSession, uint32(0), ordSign, sig))
+			if tamper {
+				ra.Auth[0] ^= 0xff
+			}
+			out, _ := tpmutil.Pack(sig, ra)
+			return tpmutil.RCSuccess, out
+		}
+		t.Errorf("unexpected ordinal 0x%x", ord)
+		return tpmutil.ResponseCode(errBadOrdinal), nil
+	}}
+}
+
+func TestOIAPSessionRunCommand(t *testing.T) {
+	usageAuth := bytes.Repeat([]byte{0x5a}, 20)
+	rw := newSigningTPM(t, usageAuth, false)
+	sess, err := NewOIAPSession(rw, usageAuth)
+	if err != nil {
+		t.Fatalf("NewOIAPSession: %v", err)
+	}
+	defer sess.Close()
+
+	// Run several commands in the same session, to check that the nonces
+	// roll correctly.
+	for _, msg := range []string{"one", "two", "three"} {
+		var sig tpmutil.U32Bytes
+		handles := []interface{}{tpmutil.Handle(0x01000000)}
+		params := []interface{}{tpmutil.U32Bytes(msg)}
+		if err := sess.RunCommand(ordSign, handles, params, []interface{}{&sig}); err != nil {
+			t.Fatalf("RunCommand(%q): %v", msg, err)
+		}
+		if want := "sig:" + msg; string(sig) != want {
+			t.Errorf("RunCommand(%q) = %q, want %q", msg, sig, want)
+		}
+	}
+}
+
+func TestOIAPSessionWrongAuth(t *testing.T) {
+	rw := newSigningTPM(t, bytes.Repeat([]byte{0x5a}, 20), false)
+	sess, err := NewOIAPSession(rw, bytes.Repeat([]byte{0xa5}, 20))
+	if err != nil {
+		t.Fatalf("NewOIAPSession: %v", err)
+	}
+	defer sess.Close()
+
+	var sig tpmutil.U32Bytes
+	params := []interface{}{tpmutil.U32Bytes("data")}
+	err = sess.RunCommand(ordSign, []interface{}{tpmutil.Handle(0x01000000)}, params, []interface{}{&sig})
+	if !errors.Is(err, tpmError(errAuthFail)) {
+		t.Fatalf("RunCommand with the wrong auth returned %v, want %v", err, tpmError(errAuthFail))
+	}
+	// The TPM terminates the session on failure.
+	err = sess.RunCommand(ordSign, []interface{}{tpmutil.Handle(0x01000000)}, params, []interface{}{&sig})
+	if !errors.Is(err, errSessionClosed) {
+		t.Errorf("RunCommand after failure returned %v, want %v", err, errSessionClosed)
+	}
+}
+
+func TestOIAPSessionBadResponseAuth(t *testing.T) {
+	usageAuth := bytes.Repeat([]byte{0x5a}, 20)
+	rw := newSigningTPM(t, usageAuth, true)
+	sess, err := NewOIAPSession(rw, usageAuth)
+	if err != nil {
+		t.Fatalf("NewOIAPSession: %v", err)
+	}
+	defer sess.Close()
+
+	var sig tpmutil.U32Bytes
+	params := []interface{}{tpmutil.U32Bytes("data")}
+	if err := sess.RunCommand(ordSign, []interface{}{tpmutil.Handle(0x01000000)}, params, []interface{}{&sig}); err == nil {
+		t.Error("RunCommand accepted a response with an invalid HMAC")
+	}
+	// The session can't be trusted after that.
+	err = sess.RunCommand(ordSign, []interface{}{tpmutil.Handle(0x01000000)}, params, []interface{}{&sig})
+	if !errors.Is(err, errSessionClosed) {
+		t.Errorf("RunCommand after a bad response HMAC returned %v, want %v", err, errSessionClosed)
+	}
+}
+
+func TestRunCommandKeepsOut(t *testing.T) {
+	usageAuth := bytes.Repeat([]byte{0x5a}, 20)
+	rw := newSigningTPM(t, usageAuth, false)
+	sess, err := NewOIAPSession(rw, usageAuth)
+	if err != nil {
+		t.Fatalf("NewOIAPSession: %v", err)
+	}
+	defer sess.Close()
+
+	// An out slice with spare capacity must not have the response auth
+	// appended into its backing array.
+	var sig, other tpmutil.U32Bytes
+	out := make([]interface{}, 1, 2)
+	out[0] = &sig
+	backing := out[:2]
+	backing[1] = &other
+	params := []interface{}{tpmutil.U32Bytes("data")}
+	if err := sess.RunCommand(ordSign, []interface{}{tpmutil.Handle(0x01000000)}, params, out); err != nil {
+		t.Fatalf("RunCommand: %v", err)
+	}
+	if backing[1] != &other {
+		t.Errorf("RunCommand overwrote the spare capacity of out")
+	}
+}
+
+func TestCreateWrapKeyEncryptsAuths(t *testing.T) {
+	srkAuth := bytes.Repeat([]byte{0x01}, 20)
+	usageAuth := Digest{0x02}
+	migrationAuth := Digest{0x03}
+	var nonceEven Nonce
+	var sharedSecret []byte
+	var gotUsage, gotMigration Digest
+	rw := &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		switch ord {
+		case ordOSAP:
+			out, secret, even, err := fakeOSAP(body, 0x02000000, srkAuth)
+			if err != nil {
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			sharedSecret, nonceEven = secret, even
+			return tpmutil.RCSuccess, out
+		case ordFlushSpecific:
+			return tpmutil.RCSuccess, nil
+		case ordCreateWrapKey:
+			var parent tpmutil.Handle
+			var encUsage, encMigration Digest
+			var k key
+			var ca commandAuth
+			if _, err := tpmutil.Unpack(body, &parent, &encUsage, &encMigration, &k, &ca); err != nil {
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			if want := authHMAC(t, sharedSecret, nonceEven, ca.NonceOdd, ca.ContSession, ord, encUsage, encMigration, k); !hmac.Equal(ca.Auth[:], want) {
+				return tpmutil.ResponseCode(errAuthFail), nil
+			}
+			var secret [20]byte
+			copy(secret[:], sharedSecret)
+			// The second auth value is encrypted with the odd nonce of
+			// the command.
+			gotUsage = adipEncrypt(secret, nonceEven, encUsage)
+			gotMigration = adipEncrypt(secret, ca.NonceOdd, encMigration)
+			rand.Read(nonceEven[:])
+			ra := responseAuth{NonceEven: nonceEven}
+			copy(ra.Auth[:], authHMAC(t, sharedSecret, ra.NonceEven, ca.NonceOdd, ra.ContSession, uint32(0), ord, k))
+			out, _ := tpmutil.Pack(k, ra)
+			return tpmutil.RCSuccess, out
+		}
+		t.Errorf("unexpected ordinal 0x%x", ord)
+		return tpmutil.ResponseCode(errBadOrdinal), nil
+	}}
+
+	if _, err := CreateWrapKey(rw, srkAuth, usageAuth, migrationAuth, nil); err != nil {
+		t.Fatalf("CreateWrapKey: %v", err)
+	}
+	if gotUsage != usageAuth || gotMigration != migrationAuth {
+		t.Errorf("TPM received auths %x and %x, want %x and %x", gotUsage, gotMigration, usageAuth, migrationAuth)
+	}
+}
+
+func TestLoadKey2Handle(t *testing.T) {
+	srkAuth := bytes.Repeat([]byte{0x01}, 20)
+	const loaded = tpmutil.Handle(0x01000042)
+	var nonceEven Nonce
+	var sharedSecret []byte
+	rw := &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		switch ord {
+		case ordOSAP:
+			out, secret, even, err := fakeOSAP(body, 0x02000000, srkAuth)
+			if err != nil {
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			sharedSecret, nonceEven = secret, even
+			return tpmutil.RCSuccess, out
+		case ordFlushSpecific:
+			return tpmutil.RCSuccess, nil
+		case ordLoadKey2:
+			var parent tpmutil.Handle
+			var k key
+			var ca commandAuth
+			if _, err := tpmutil.Unpack(body, &parent, &k, &ca); err != nil {
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			if want := authHMAC(t, sharedSecret, nonceEven, ca.NonceOdd, ca.ContSession, ord, k); !hmac.Equal(ca.Auth[:], want) {
+				return tpmutil.ResponseCode(errAuthFail), nil
+			}
+			rand.Read(nonceEven[:])
+			// The handle of the loaded key isn't covered by the HMAC.
+			ra := responseAuth{NonceEven: nonceEven, ContSession: ca.ContSession}
+			copy(ra.Auth[:], authHMAC(t, sharedSecret, ra.NonceEven, ca.NonceOdd, ra.ContSession, uint32(0), ord))
+			out, _ := tpmutil.Pack(loaded, ra)
+			return tpmutil.RCSuccess, out
+		}
+		t.Errorf("unexpected ordinal 0x%x", ord)
+		return tpmutil.ResponseCode(errBadOrdinal), nil
+	}}
+
+	blob, err := tpmutil.Pack(&key{Version: 0x01010000, KeyUsage: keySigning})
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	h, err := LoadKey2(rw, blob, srkAuth)
+	if err != nil {
+		t.Fatalf("LoadKey2: %v", err)
+	}
+	if h != loaded {
+		t.Errorf("LoadKey2() = %x, want %x", h, loaded)
+	}
+}
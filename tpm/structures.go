@@ -45,6 +45,15 @@ type pcrSelection struct {
 	Mask pcrMask
 }
 
+// A PCRSelection is a TPM_PCR_SELECTION of any size. The selections used
+// internally by this package always cover 24 PCRs; PCRSelection grows to
+// cover TPMs with more.
+type PCRSelection struct {
+	// Mask selects PCR i with bit i%8 of byte i/8. Its length is the
+	// selection's sizeOfSelect.
+	Mask tpmutil.U16Bytes
+}
+
 // pcrInfoLong stores detailed information about PCRs.
 type pcrInfoLong struct {
 	Tag              uint16
@@ -387,6 +396,131 @@ type quoteInfo struct {
 	Nonce Nonce
 }
 
+// A quoteInfo2 structure is the structure signed by TPM_Quote2, followed by
+// the TPM_CAP_VERSION_INFO if the caller asked for it.
+type quoteInfo2 struct {
+	// The Tag must be tagQuoteInfo2.
+	Tag uint16
+
+	// Fixed is always 'QUT2'.
+	Fixed [4]byte
+
+	// ExternalData is the SHA1 hash of the data to sign.
+	ExternalData Nonce
+
+	// InfoShort describes the quoted PCRs and their composite digest.
+	InfoShort pcrInfoShort
+}
+
+// A SignedQuote2 is the result of TPM_Quote2.
+type SignedQuote2 struct {
+	// PCRInfo is the TPM_PCR_INFO_SHORT describing the quoted PCRs.
+	PCRInfo []byte
+
+	// VersionInfo is the TPM_CAP_VERSION_INFO that was signed with the
+	// quote, or empty if the caller didn't ask for it.
+	VersionInfo []byte
+
+	// Signature is the signature over the quoteInfo2 structure and
+	// VersionInfo.
+	Signature []byte
+}
+
+// A signInfo is the structure signed by the TPM for commands such as
+// TPM_GetAuditDigestSigned.
+type signInfo struct {
+	// The Tag must be tagSignInfo.
+	Tag uint16
+
+	// Fixed identifies the command that produced the signature.
+	Fixed [4]byte
+
+	// Replay is the anti-replay nonce supplied by the caller.
+	Replay Nonce
+
+	// Data is the command-specific data being signed.
+	Data tpmutil.U32Bytes
+}
+
+// A CounterValue is a TPM monotonic counter value, such as the audit counter.
+type CounterValue struct {
+	Tag     uint16
+	Label   [4]byte
+	Counter uint32
+}
+
+// An AuditDigest is the state of the TPM's audit log: the current audit
+// digest and the audit counter value it was accumulated under.
+type AuditDigest struct {
+	Counter CounterValue
+	Digest  Digest
+}
+
+// A SignedAuditDigest is the audit state signed by TPM_GetAuditDigestSigned.
+type SignedAuditDigest struct {
+	AuditDigest
+
+	// OrdinalDigest is the digest of the list of audited ordinals.
+	OrdinalDigest Digest
+
+	// Signature is the signature over the signInfo structure.
+	Signature []byte
+}
+
+// CurrentTicks is the value of the TPM's tick counter. The TickNonce is
+// changed by the TPM every time the tick counter is reset (for example, on
+// power loss), so tick values can only be compared if their nonces match.
+type CurrentTicks struct {
+	Tag uint16
+
+	// CurrentTicks is the number of ticks since the start of the session.
+	CurrentTicks uint64
+
+	// TickRate is the number of microseconds per tick.
+	TickRate uint16
+
+	// TickNonce identifies the tick session.
+	TickNonce Nonce
+}
+
+// A FamilyTableEntry is a row of the TPM's delegation family table.
+type FamilyTableEntry struct {
+	Tag               uint16
+	Label             byte
+	FamilyID          uint32
+	VerificationCount uint32
+	Flags             uint32
+}
+
+// Delegations is the set of permissions granted by a delegation. Per1 and Per2
+// are bitmasks of the delegable ordinals, as defined in section 20.2 of part 2
+// of the TPM 1.2 specification.
+type Delegations struct {
+	Tag          uint16
+	DelegateType uint32
+	Per1         uint32
+	Per2         uint32
+}
+
+// A delegatePublic is the public part of a delegation.
+type delegatePublic struct {
+	Tag               uint16
+	RowLabel          byte
+	PCRInfo           pcrInfoShort
+	Permissions       Delegations
+	FamilyID          uint32
+	VerificationCount uint32
+}
+
+// A DelegateTableRow is a row of the TPM's delegation table.
+type DelegateTableRow struct {
+	Index             uint32
+	Label             byte
+	Permissions       Delegations
+	FamilyID          uint32
+	VerificationCount uint32
+}
+
 // A pcrComposite stores a selection of PCRs with the selected PCR values.
 type pcrComposite struct {
 	Selection pcrSelection
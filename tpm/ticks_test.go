@@ -0,0 +1,108 @@
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"testing"
+
+	"github.com/google/go-tpm/tpmutil"
+)
+
+func TestReadCurrentTicks(t *testing.T) {
+	want := CurrentTicks{Tag: tagCurrentTicks, CurrentTicks: 123456789, TickRate: 1000, TickNonce: Nonce{1, 2, 3}}
+	rw := &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		if ord != ordGetTicks {
+			t.Errorf("unexpected ordinal 0x%x", ord)
+			return tpmutil.ResponseCode(errBadOrdinal), nil
+		}
+		out, _ := tpmutil.Pack(want)
+		return tpmutil.RCSuccess, out
+	}}
+
+	ct, err := ReadCurrentTicks(rw)
+	if err != nil {
+		t.Fatalf("ReadCurrentTicks: %v", err)
+	}
+	if *ct != want {
+		t.Errorf("ReadCurrentTicks() = %+v, want %+v", *ct, want)
+	}
+}
+
+func TestTickStampBlob(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	keyAuth := bytes.Repeat([]byte{0x22}, 20)
+	ticks := CurrentTicks{Tag: tagCurrentTicks, CurrentTicks: 42, TickRate: 1, TickNonce: Nonce{7}}
+	var nonceEven Nonce
+	rw := &fakeTPM{handler: func(ord uint32, body []byte) (tpmutil.ResponseCode, []byte) {
+		switch ord {
+		case ordOIAP:
+			rand.Read(nonceEven[:])
+			out, _ := tpmutil.Pack(tpmutil.Handle(0x02000000), nonceEven)
+			return tpmutil.RCSuccess, out
+		case ordFlushSpecific:
+			return tpmutil.RCSuccess, nil
+		case ordTickStampBlob:
+			var keyHandle tpmutil.Handle
+			var antiReplay Nonce
+			var digest Digest
+			var ca commandAuth
+			if _, err := tpmutil.Unpack(body, &keyHandle, &antiReplay, &digest, &ca); err != nil {
+				return tpmutil.ResponseCode(errBadParameter), nil
+			}
+			if want := authHMAC(t, keyAuth, nonceEven, ca.NonceOdd, ca.ContSession, ord, antiReplay, digest); !hmac.Equal(ca.Auth[:], want) {
+				return tpmutil.ResponseCode(errAuthFail), nil
+			}
+			data, _ := tpmutil.Pack(digest, ticks)
+			si, _ := tpmutil.Pack(signInfo{Tag: tagSignInfo, Fixed: fixedTickStamp, Replay: antiReplay, Data: data})
+			h := sha1.Sum(si)
+			sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, h[:])
+			if err != nil {
+				t.Fatalf("SignPKCS1v15: %v", err)
+			}
+			rand.Read(nonceEven[:])
+			ra := responseAuth{NonceEven: nonceEven, ContSession: ca.ContSession}
+			copy(ra.Auth[:], authHMAC(t, keyAuth, ra.NonceEven, ca.NonceOdd, ra.ContSession, uint32(0), ord, ticks, tpmutil.U32Bytes(sig)))
+			out, _ := tpmutil.Pack(ticks, tpmutil.U32Bytes(sig), ra)
+			return tpmutil.RCSuccess, out
+		}
+		t.Errorf("unexpected ordinal 0x%x", ord)
+		return tpmutil.ResponseCode(errBadOrdinal), nil
+	}}
+
+	antiReplay := Nonce{5, 5}
+	digest := Digest{0xde, 0xad}
+	ct, sig, err := TickStampBlob(rw, tpmutil.Handle(0x01000000), keyAuth, antiReplay, digest)
+	if err != nil {
+		t.Fatalf("TickStampBlob: %v", err)
+	}
+	if *ct != ticks {
+		t.Errorf("TickStampBlob() ticks = %+v, want %+v", *ct, ticks)
+	}
+	if err := VerifyTickStamp(&key.PublicKey, antiReplay, digest, ct, sig); err != nil {
+		t.Errorf("VerifyTickStamp: %v", err)
+	}
+	if err := VerifyTickStamp(&key.PublicKey, antiReplay, Digest{}, ct, sig); err == nil {
+		t.Error("VerifyTickStamp accepted the wrong digest")
+	}
+}
@@ -13,6 +13,11 @@
 // limitations under the License.
 
 // Package tpm supports direct communication with a tpm device under Linux.
+//
+// Commands take an io.ReadWriter rather than a device file, so besides the
+// channel returned by OpenTPM they work over any transport that carries
+// whole TPM commands and responses, such as a simulator connection
+// (tpmutil/mssim), a socket or a proxy.
 package tpm
 
 import (
@@ -100,6 +105,65 @@ func GetRandom(rw io.ReadWriter, size uint32) ([]byte, error) {
 	return b, nil
 }
 
+// maxStirRandomSize is the largest amount of data accepted by a single
+// TPM_StirRandom command.
+const maxStirRandomSize = 255
+
+// StirRandom adds entropy to the state of the TPM's random number generator.
+// Data larger than the TPM accepts in one command is sent in several
+// commands.
+func StirRandom(rw io.ReadWriter, data []byte) error {
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > maxStirRandomSize {
+			chunk = chunk[:maxStirRandomSize]
+		}
+		in := []interface{}{tpmutil.U32Bytes(chunk)}
+		if _, err := submitTPMRequest(rw, tagRQUCommand, ordStirRandom, in, nil); err != nil {
+			return err
+		}
+		data = data[len(chunk):]
+	}
+	return nil
+}
+
+// maxGetRandomSize is the largest amount of random data requested from the
+// TPM in one TPM_GetRandom command by RandReader. TPMs may return less than
+// requested.
+const maxGetRandomSize = 128
+
+// RandReader is an io.Reader that reads random bytes from the TPM, splitting
+// large reads into as many TPM_GetRandom commands as necessary.
+type RandReader struct {
+	rw io.ReadWriter
+}
+
+// NewRandReader returns a RandReader that uses the given TPM.
+func NewRandReader(rw io.ReadWriter) *RandReader {
+	return &RandReader{rw: rw}
+}
+
+// Read fills p with random bytes from the TPM. It only returns fewer than
+// len(p) bytes along with an error.
+func (r *RandReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		size := len(p) - n
+		if size > maxGetRandomSize {
+			size = maxGetRandomSize
+		}
+		b, err := GetRandom(r.rw, uint32(size))
+		if err != nil {
+			return n, err
+		}
+		if len(b) == 0 {
+			return n, errors.New("TPM returned no random bytes")
+		}
+		n += copy(p[n:], b)
+	}
+	return n, nil
+}
+
 // LoadKey2 loads a key blob (a serialized TPM_KEY or TPM_KEY12) into the TPM
 // and returns a handle for this key.
 func LoadKey2(rw io.ReadWriter, keyBlob []byte, srkAuth []byte) (tpmutil.Handle, error) {
@@ -109,34 +173,23 @@ func LoadKey2(rw io.ReadWriter, keyBlob []byte, srkAuth []byte) (tpmutil.Handle,
 		return 0, err
 	}
 
-	// Run OSAP for the SRK, reading a random OddOSAP for our initial
-	// command and getting back a secret and a handle. LoadKey2 needs an
-	// OSAP session for the SRK because the private part of a TPM_KEY or
-	// TPM_KEY12 is sealed against the SRK.
-	sharedSecret, osapr, err := newOSAPSession(rw, etSRK, khSRK, srkAuth)
+	// LoadKey2 needs an OSAP session for the SRK because the private part of
+	// a TPM_KEY or TPM_KEY12 is sealed against the SRK.
+	sess, err := NewOSAPSession(rw, EntitySRK, khSRK, srkAuth)
 	if err != nil {
 		return 0, err
 	}
-	defer osapr.Close(rw)
-	defer zeroBytes(sharedSecret[:])
+	defer sess.Close()
 
-	authIn := []interface{}{ordLoadKey2, k}
-	ca, err := newCommandAuth(osapr.AuthHandle, osapr.NonceEven, nil, sharedSecret[:], authIn)
-	if err != nil {
+	// We always load our keys with the SRK as the parent key. The handle of
+	// the loaded key isn't covered by the response HMAC.
+	// TODO(tmroeder): support key12, too.
+	var handle tpmutil.Handle
+	handles := []interface{}{khSRK}
+	outHandles := []interface{}{&handle}
+	if err := runCommand([]*AuthSession{sess}, ordLoadKey2, handles, []interface{}{k}, outHandles, nil); err != nil {
 		return 0, err
 	}
-
-	handle, ra, ret, err := loadKey2(rw, &k, ca)
-	if err != nil {
-		return 0, err
-	}
-
-	// Check the response authentication.
-	raIn := []interface{}{ret, ordLoadKey2}
-	if err := ra.verify(ca.NonceOdd, sharedSecret[:], raIn); err != nil {
-		return 0, err
-	}
-
 	return handle, nil
 }
 
@@ -144,14 +197,22 @@ func LoadKey2(rw io.ReadWriter, keyBlob []byte, srkAuth []byte) (tpmutil.Handle,
 // under the key associated with the handle and for the pcr values
 // specified in the call.
 func Quote2(rw io.ReadWriter, handle tpmutil.Handle, data []byte, pcrVals []int, addVersion byte, aikAuth []byte) ([]byte, error) {
-	// Run OSAP for the handle, reading a random OddOSAP for our initial
-	// command and getting back a secret and a response.
-	sharedSecret, osapr, err := newOSAPSession(rw, etKeyHandle, handle, aikAuth)
+	q, err := Quote2Signed(rw, handle, data, pcrVals, addVersion, aikAuth)
+	if err != nil {
+		return nil, err
+	}
+	return q.Signature, nil
+}
+
+// Quote2Signed performs the same quote as Quote2, but also returns the PCR
+// information and version information that the TPM signed, which
+// VerifyQuote2 needs to check the signature.
+func Quote2Signed(rw io.ReadWriter, handle tpmutil.Handle, data []byte, pcrVals []int, addVersion byte, aikAuth []byte) (*SignedQuote2, error) {
+	sess, err := NewOSAPSession(rw, EntityKeyHandle, handle, aikAuth)
 	if err != nil {
 		return nil, err
 	}
-	defer osapr.Close(rw)
-	defer zeroBytes(sharedSecret[:])
+	defer sess.Close()
 
 	// Hash the data to get the value to pass to quote2.
 	hash := sha1.Sum(data)
@@ -159,61 +220,55 @@ func Quote2(rw io.ReadWriter, handle tpmutil.Handle, data []byte, pcrVals []int,
 	if err != nil {
 		return nil, err
 	}
-	authIn := []interface{}{ordQuote2, hash, pcrSel, addVersion}
-	ca, err := newCommandAuth(osapr.AuthHandle, osapr.NonceEven, nil, sharedSecret[:], authIn)
-	if err != nil {
+	var pcrShort pcrInfoShort
+	var capBytes, sig tpmutil.U32Bytes
+	handles := []interface{}{handle}
+	params := []interface{}{hash, pcrSel, addVersion}
+	out := []interface{}{&pcrShort, &capBytes, &sig}
+	if err := sess.RunCommand(ordQuote2, handles, params, out); err != nil {
 		return nil, err
 	}
 
-	// TODO(tmroeder): use the returned CapVersion.
-	pcrShort, _, capBytes, sig, ra, ret, err := quote2(rw, handle, hash, pcrSel, addVersion, ca)
-	if err != nil {
-		return nil, err
+	// Check that the version information, if any, is well formed.
+	if len(capBytes) != 0 {
+		var capInfo CapVersionInfo
+		if err := capInfo.Decode(capBytes); err != nil {
+			return nil, err
+		}
 	}
 
-	// Check response authentication.
-	raIn := []interface{}{ret, ordQuote2, pcrShort, tpmutil.U32Bytes(capBytes), tpmutil.U32Bytes(sig)}
-	if err := ra.verify(ca.NonceOdd, sharedSecret[:], raIn); err != nil {
+	info, err := tpmutil.Pack(pcrShort)
+	if err != nil {
 		return nil, err
 	}
-
-	return sig, nil
+	return &SignedQuote2{PCRInfo: info, VersionInfo: capBytes, Signature: sig}, nil
 }
 
 // GetPubKey retrieves an opaque blob containing a public key corresponding to
 // a handle from the TPM.
 func GetPubKey(rw io.ReadWriter, keyHandle tpmutil.Handle, srkAuth []byte) ([]byte, error) {
-	// Run OSAP for the handle, reading a random OddOSAP for our initial
-	// command and getting back a secret and a response.
-	sharedSecret, osapr, err := newOSAPSession(rw, etKeyHandle, keyHandle, srkAuth)
+	pk, err := readPubKey(rw, EntityKeyHandle, keyHandle, srkAuth)
 	if err != nil {
 		return nil, err
 	}
-	defer osapr.Close(rw)
-	defer zeroBytes(sharedSecret[:])
 
-	authIn := []interface{}{ordGetPubKey}
-	ca, err := newCommandAuth(osapr.AuthHandle, osapr.NonceEven, nil, sharedSecret[:], authIn)
-	if err != nil {
-		return nil, err
-	}
+	return tpmutil.Pack(*pk)
+}
 
-	pk, ra, ret, err := getPubKey(rw, keyHandle, ca)
+// readPubKey runs TPM_GetPubKey for keyHandle in an OSAP session for the
+// given entity and checks the response auth.
+func readPubKey(rw io.ReadWriter, entityType EntityType, keyHandle tpmutil.Handle, auth []byte) (*pubKey, error) {
+	sess, err := NewOSAPSession(rw, entityType, keyHandle, auth)
 	if err != nil {
 		return nil, err
 	}
+	defer sess.Close()
 
-	// Check response authentication for TPM_GetPubKey.
-	raIn := []interface{}{ret, ordGetPubKey, pk}
-	if err := ra.verify(ca.NonceOdd, sharedSecret[:], raIn); err != nil {
+	var pk pubKey
+	if err := sess.RunCommand(ordGetPubKey, []interface{}{keyHandle}, nil, []interface{}{&pk}); err != nil {
 		return nil, err
 	}
-
-	b, err := tpmutil.Pack(*pk)
-	if err != nil {
-		return nil, err
-	}
-	return b, err
+	return &pk, nil
 }
 
 // newOSAPSession starts a new OSAP session and derives a shared key from it.
@@ -257,8 +312,10 @@ func newOSAPSession(rw io.ReadWriter, entityType uint16, entityValue tpmutil.Han
 
 // newCommandAuth creates a new commandAuth structure over the given
 // parameters, using the given secret and the given odd nonce, if provided,
-// for the HMAC. If no odd nonce is provided, one is randomly generated.
-func newCommandAuth(authHandle tpmutil.Handle, nonceEven Nonce, nonceOdd *Nonce, key []byte, params []interface{}) (*commandAuth, error) {
+// for the HMAC. If no odd nonce is provided, one is randomly generated. If
+// contSession is set, the TPM is asked to keep the session open after the
+// command.
+func newCommandAuth(authHandle tpmutil.Handle, nonceEven Nonce, nonceOdd *Nonce, key []byte, params []interface{}, contSession bool) (*commandAuth, error) {
 	// Auth = HMAC-SHA1(key, SHA1(params) || NonceEven || NonceOdd || ContSession)
 	digestBytes, err := tpmutil.Pack(params...)
 	if err != nil {
@@ -280,6 +337,9 @@ func newCommandAuth(authHandle tpmutil.Handle, nonceEven Nonce, nonceOdd *Nonce,
 		AuthHandle: authHandle,
 		NonceOdd:   odd,
 	}
+	if contSession {
+		ca.ContSession = 1
+	}
 
 	authBytes, err := tpmutil.Pack(digest, nonceEven, ca.NonceOdd, ca.ContSession)
 	if err != nil {
@@ -327,61 +387,50 @@ func zeroBytes(b []byte) {
 	}
 }
 
-func sealHelper(rw io.ReadWriter, pcrInfo *pcrInfoLong, data []byte, srkAuth []byte) ([]byte, error) {
-	// Run OSAP for the SRK, reading a random OddOSAP for our initial
-	// command and getting back a secret and a handle.
-	sharedSecret, osapr, err := newOSAPSession(rw, etSRK, khSRK, srkAuth)
-	if err != nil {
-		return nil, err
-	}
-	defer osapr.Close(rw)
-	defer zeroBytes(sharedSecret[:])
+// srkDataAuth returns the auth value that Seal gives sealed data: that of the
+// SRK, so that Unseal can use srkAuth for both.
+func srkDataAuth(srkAuth []byte) Digest {
+	var d Digest
+	copy(d[:], srkAuth)
+	return d
+}
 
-	// EncAuth for a seal command is computed as
-	//
-	// encAuth = XOR(srkAuth, SHA1(sharedSecret || <lastEvenNonce>))
-	//
-	// In this case, the last even nonce is NonceEven from OSAP.
-	xorData, err := tpmutil.Pack(sharedSecret, osapr.NonceEven)
+// sealHelper seals data under the SRK, protected by dataAuth. The pcrInfo must
+// be a *pcrInfoLong, a *pcrInfo or nil.
+func sealHelper(rw io.ReadWriter, pcrInfo interface{}, data []byte, srkAuth []byte, dataAuth Digest) ([]byte, error) {
+	sess, err := NewOSAPSession(rw, EntitySRK, khSRK, srkAuth)
 	if err != nil {
 		return nil, err
 	}
-	defer zeroBytes(xorData)
+	defer sess.Close()
 
-	encAuthData := sha1.Sum(xorData)
-	sc := &sealCommand{KeyHandle: khSRK}
-	for i := range sc.EncAuth {
-		sc.EncAuth[i] = srkAuth[i] ^ encAuthData[i]
-	}
-
-	// The digest input for seal authentication is
-	//
-	// digest = SHA1(ordSeal || encAuth || binary.Size(pcrInfo) || pcrInfo ||
-	//               len(data) || data)
+	// EncAuth for a seal command is computed as
 	//
-	authIn := []interface{}{ordSeal, sc.EncAuth, uint32(binary.Size(pcrInfo)), pcrInfo, tpmutil.U32Bytes(data)}
-	ca, err := newCommandAuth(osapr.AuthHandle, osapr.NonceEven, nil, sharedSecret[:], authIn)
-	if err != nil {
-		return nil, err
-	}
-
-	sealed, ra, ret, err := seal(rw, sc, pcrInfo, data, ca)
+	// encAuth = XOR(dataAuth, SHA1(sharedSecret || <lastEvenNonce>))
+	encAuth, err := sess.EncryptAuth(dataAuth)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check the response authentication.
-	raIn := []interface{}{ret, ordSeal, sealed}
-	if err := ra.verify(ca.NonceOdd, sharedSecret[:], raIn); err != nil {
-		return nil, err
+	params := []interface{}{encAuth}
+	if pcrInfo == nil {
+		params = append(params, uint32(0))
+	} else {
+		pcrsize := binary.Size(pcrInfo)
+		if pcrsize < 0 {
+			return nil, errors.New("couldn't compute the size of the PCR info")
+		}
+		// TODO(tmroeder): special-case pcrInfoLong in pack/unpack so we don't have
+		// to write out the length explicitly here.
+		params = append(params, uint32(pcrsize), pcrInfo)
 	}
-
-	sealedBytes, err := tpmutil.Pack(*sealed)
-	if err != nil {
+	params = append(params, tpmutil.U32Bytes(data))
+	var sealed tpmStoredData
+	if err := sess.RunCommand(ordSeal, []interface{}{khSRK}, params, []interface{}{&sealed}); err != nil {
 		return nil, err
 	}
 
-	return sealedBytes, nil
+	return tpmutil.Pack(sealed)
 }
 
 // Seal encrypts data against a given locality and PCRs and returns the sealed data.
@@ -390,7 +439,7 @@ func Seal(rw io.ReadWriter, loc Locality, pcrs []int, data []byte, srkAuth []byt
 	if err != nil {
 		return nil, err
 	}
-	return sealHelper(rw, pcrInfo, data, srkAuth)
+	return sealHelper(rw, pcrInfo, data, srkAuth, srkDataAuth(srkAuth))
 }
 
 // Reseal takes a pre-calculated PCR map and locality in order to seal data
@@ -402,100 +451,222 @@ func Reseal(rw io.ReadWriter, loc Locality, pcrs map[int][]byte, data []byte, sr
 	if err != nil {
 		return nil, err
 	}
-	return sealHelper(rw, pcrInfo, data, srkAuth)
+	return sealHelper(rw, pcrInfo, data, srkAuth, srkDataAuth(srkAuth))
+}
+
+// PCRInfoVersion selects the PCR_INFO structure used to bind sealed data to
+// PCR values. Other TPM software stacks expect a particular version: sealed
+// blobs bound with a TPM_PCR_INFO_LONG are TPM_STORED_DATA12 structures, while
+// those bound with a TPM_PCR_INFO are TPM 1.1 TPM_STORED_DATA structures.
+//
+// Note that TPM_Seal doesn't accept the TPM_PCR_INFO_SHORT structure: it can't
+// record the PCR values at creation, which the TPM needs to report in the
+// sealed blob.
+type PCRInfoVersion int
+
+// PCR_INFO versions supported for sealing.
+const (
+	// PCRInfoLongVersion seals with a TPM_PCR_INFO_LONG, which supports
+	// localities. This is what Seal and Reseal use.
+	PCRInfoLongVersion PCRInfoVersion = iota
+	// PCRInfoVersion11 seals with a TPM 1.1 TPM_PCR_INFO, which doesn't
+	// support localities.
+	PCRInfoVersion11
+)
+
+// SealOptions configures SealWithOptions.
+type SealOptions struct {
+	// PCRs are the PCRs to bind the sealed data to, using their current
+	// values. If PCRValues is set, PCRs is ignored. If neither is set, the
+	// data isn't bound to any PCRs.
+	PCRs []int
+	// PCRValues binds the sealed data to precalculated PCR values, as
+	// Reseal does.
+	PCRValues map[int][]byte
+	// Version is the PCR_INFO structure used to bind the data to the PCRs.
+	Version PCRInfoVersion
+	// LocalityAtRelease is the set of localities the data can be unsealed
+	// from. It only applies to PCRInfoLongVersion, and defaults to all
+	// localities.
+	LocalityAtRelease Locality
+	// DataAuth, if set, is the auth value of the sealed data, which
+	// UnsealWithAuth needs to unseal it. It is sent to the TPM encrypted with
+	// the XOR ADIP. If DataAuth is nil, the data has the SRK's auth value,
+	// as with Seal.
+	DataAuth *Digest
+}
+
+// SealWithOptions encrypts data under the SRK, binding it to PCR values and
+// localities as described by opts, and returns the sealed data.
+func SealWithOptions(rw io.ReadWriter, data []byte, srkAuth []byte, opts SealOptions) ([]byte, error) {
+	dataAuth := srkDataAuth(srkAuth)
+	if opts.DataAuth != nil {
+		dataAuth = *opts.DataAuth
+	}
+	if len(opts.PCRs) == 0 && len(opts.PCRValues) == 0 {
+		if opts.LocalityAtRelease != 0 {
+			return nil, errors.New("localities can only be set when sealing to PCRs")
+		}
+		return sealHelper(rw, nil, data, srkAuth, dataAuth)
+	}
+
+	var mask pcrMask
+	var pcrVals []byte
+	if len(opts.PCRValues) != 0 {
+		// The composite is computed over the PCRs in ascending order.
+		for i := 0; i < 8*len(mask); i++ {
+			v, ok := opts.PCRValues[i]
+			if !ok {
+				continue
+			}
+			if err := mask.setPCR(i); err != nil {
+				return nil, err
+			}
+			pcrVals = append(pcrVals, v...)
+		}
+		if len(pcrVals) != PCRSize*len(opts.PCRValues) {
+			return nil, fmt.Errorf("PCR values must be for PCRs 0 to 23 and %d bytes long", PCRSize)
+		}
+	} else {
+		for _, pcr := range opts.PCRs {
+			if err := mask.setPCR(pcr); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if pcrVals, err = FetchPCRValues(rw, opts.PCRs); err != nil {
+			return nil, err
+		}
+	}
+
+	switch opts.Version {
+	case PCRInfoLongVersion:
+		release := opts.LocalityAtRelease
+		if release == 0 {
+			release = LocZero | LocOne | LocTwo | LocThree | LocFour
+		}
+		pcri, err := createPCRInfoLong(release, mask, pcrVals)
+		if err != nil {
+			return nil, err
+		}
+		return sealHelper(rw, pcri, data, srkAuth, dataAuth)
+	case PCRInfoVersion11:
+		if opts.LocalityAtRelease != 0 {
+			return nil, errors.New("TPM_PCR_INFO doesn't support localities")
+		}
+		d, err := createPCRComposite(mask, pcrVals)
+		if err != nil {
+			return nil, err
+		}
+		pcri := &pcrInfo{PcrSelection: pcrSelection{3, mask}}
+		copy(pcri.DigestAtRelease[:], d)
+		copy(pcri.DigestAtCreation[:], d)
+		return sealHelper(rw, pcri, data, srkAuth, dataAuth)
+	default:
+		return nil, fmt.Errorf("unsupported PCR info version %d", opts.Version)
+	}
 }
 
 // Unseal decrypts data encrypted by the TPM.
 func Unseal(rw io.ReadWriter, sealed []byte, srkAuth []byte) ([]byte, error) {
-	// Run OSAP for the SRK, reading a random OddOSAP for our initial
-	// command and getting back a secret and a handle.
-	sharedSecret, osapr, err := newOSAPSession(rw, etSRK, khSRK, srkAuth)
-	if err != nil {
-		return nil, err
+	return unsealHelper(rw, sealed, srkAuth, srkAuth)
+}
+
+// UnsealWithAuth decrypts data sealed by SealWithOptions with a DataAuth
+// different from the SRK's auth value.
+func UnsealWithAuth(rw io.ReadWriter, sealed []byte, srkAuth []byte, dataAuth Digest) ([]byte, error) {
+	defer zeroBytes(dataAuth[:])
+	return unsealHelper(rw, sealed, srkAuth, dataAuth[:])
+}
+
+// SealedPCRs returns the PCRs that sealed data is bound to, in ascending
+// order, and the localities it can be unsealed from. Data sealed with a TPM
+// 1.1 TPM_PCR_INFO, or without PCRs, can be unsealed from any locality.
+func SealedPCRs(sealed []byte) ([]int, Locality, error) {
+	allLocalities := LocZero | LocOne | LocTwo | LocThree | LocFour
+	var tsd tpmStoredData
+	if _, err := tpmutil.Unpack(sealed, &tsd); err != nil {
+		return nil, 0, errors.New("couldn't convert the sealed data into a tpmStoredData struct")
+	}
+	if len(tsd.Info) == 0 {
+		return nil, allLocalities, nil
 	}
-	defer osapr.Close(rw)
-	defer zeroBytes(sharedSecret[:])
 
-	// The unseal command needs an OIAP session in addition to the OSAP session.
-	oiapr, err := oiap(rw)
-	if err != nil {
-		return nil, err
+	var mask pcrMask
+	loc := allLocalities
+	if len(tsd.Info) >= 2 && binary.BigEndian.Uint16(tsd.Info) == tagPCRInfoLong {
+		var pcri pcrInfoLong
+		if _, err := tpmutil.Unpack(tsd.Info, &pcri); err != nil {
+			return nil, 0, fmt.Errorf("couldn't parse the TPM_PCR_INFO_LONG of the sealed data: %v", err)
+		}
+		mask, loc = pcri.PCRsAtRelease.Mask, pcri.LocAtRelease
+	} else {
+		var pcri pcrInfo
+		if _, err := tpmutil.Unpack(tsd.Info, &pcri); err != nil {
+			return nil, 0, fmt.Errorf("couldn't parse the TPM_PCR_INFO of the sealed data: %v", err)
+		}
+		mask = pcri.PcrSelection.Mask
 	}
-	defer oiapr.Close(rw)
+	var pcrs []int
+	for i := 0; i < 8*len(mask); i++ {
+		if set, _ := mask.isPCRSet(i); set {
+			pcrs = append(pcrs, i)
+		}
+	}
+	return pcrs, loc, nil
+}
 
+// unsealHelper unseals data sealed under the SRK, authorizing the SRK with
+// srkAuth and the sealed data with dataAuth.
+func unsealHelper(rw io.ReadWriter, sealed []byte, srkAuth []byte, dataAuth []byte) ([]byte, error) {
 	// Convert the sealed value into a tpmStoredData.
 	var tsd tpmStoredData
 	if _, err := tpmutil.Unpack(sealed, &tsd); err != nil {
 		return nil, errors.New("couldn't convert the sealed data into a tpmStoredData struct")
 	}
 
-	// The digest for auth1 and auth2 for the unseal command is computed as
-	// digest = SHA1(ordUnseal || tsd)
-	authIn := []interface{}{ordUnseal, tsd}
-
-	// The first commandAuth uses the shared secret as an HMAC key.
-	ca1, err := newCommandAuth(osapr.AuthHandle, osapr.NonceEven, nil, sharedSecret[:], authIn)
-	if err != nil {
-		return nil, err
-	}
-
-	// The second commandAuth is based on OIAP instead of OSAP and uses the
-	// SRK auth value as an HMAC key instead of the shared secret.
-	ca2, err := newCommandAuth(oiapr.AuthHandle, oiapr.NonceEven, nil, srkAuth, authIn)
+	sess, err := NewOSAPSession(rw, EntitySRK, khSRK, srkAuth)
 	if err != nil {
 		return nil, err
 	}
+	defer sess.Close()
 
-	unsealed, ra1, ra2, ret, err := unseal(rw, khSRK, &tsd, ca1, ca2)
+	// The unseal command needs an OIAP session for the sealed data, with its
+	// auth value, in addition to the OSAP session for the SRK.
+	dataSess, err := NewOIAPSession(rw, dataAuth)
 	if err != nil {
 		return nil, err
 	}
+	defer dataSess.Close()
 
-	// Check the response authentication.
-	raIn := []interface{}{ret, ordUnseal, tpmutil.U32Bytes(unsealed)}
-	if err := ra1.verify(ca1.NonceOdd, sharedSecret[:], raIn); err != nil {
-		return nil, err
-	}
-
-	if err := ra2.verify(ca2.NonceOdd, srkAuth, raIn); err != nil {
+	var unsealed tpmutil.U32Bytes
+	params := []interface{}{tsd}
+	if err := sess.RunCommand2(dataSess, ordUnseal, []interface{}{khSRK}, params, []interface{}{&unsealed}); err != nil {
 		return nil, err
 	}
-
 	return unsealed, nil
 }
 
 // Quote produces a TPM quote for the given data under the given PCRs. It uses
 // AIK auth and a given AIK handle.
 func Quote(rw io.ReadWriter, handle tpmutil.Handle, data []byte, pcrNums []int, aikAuth []byte) ([]byte, []byte, error) {
-	// Run OSAP for the handle, reading a random OddOSAP for our initial
-	// command and getting back a secret and a response.
-	sharedSecret, osapr, err := newOSAPSession(rw, etKeyHandle, handle, aikAuth)
+	sess, err := NewOSAPSession(rw, EntityKeyHandle, handle, aikAuth)
 	if err != nil {
 		return nil, nil, err
 	}
-	defer osapr.Close(rw)
-	defer zeroBytes(sharedSecret[:])
+	defer sess.Close()
 
-	// Hash the data to get the value to pass to quote2.
+	// Hash the data to get the value to pass to quote.
 	hash := sha1.Sum(data)
 	pcrSel, err := newPCRSelection(pcrNums)
 	if err != nil {
 		return nil, nil, err
 	}
-	authIn := []interface{}{ordQuote, hash, pcrSel}
-	ca, err := newCommandAuth(osapr.AuthHandle, osapr.NonceEven, nil, sharedSecret[:], authIn)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	pcrc, sig, ra, ret, err := quote(rw, handle, hash, pcrSel, ca)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	// Check response authentication.
-	raIn := []interface{}{ret, ordQuote, pcrc, tpmutil.U32Bytes(sig)}
-	if err := ra.verify(ca.NonceOdd, sharedSecret[:], raIn); err != nil {
+	var pcrc pcrComposite
+	var sig tpmutil.U32Bytes
+	handles := []interface{}{handle}
+	params := []interface{}{hash, pcrSel}
+	if err := sess.RunCommand(ordQuote, handles, params, []interface{}{&pcrc, &sig}); err != nil {
 		return nil, nil, err
 	}
 
@@ -510,40 +681,30 @@ func Quote(rw io.ReadWriter, handle tpmutil.Handle, data []byte, pcrNums []int,
 // AIK is sealed against the SRK.
 // TODO(tmroeder): currently, this code can only create 2048-bit RSA keys.
 func MakeIdentity(rw io.ReadWriter, srkAuth []byte, ownerAuth []byte, aikAuth []byte, pk crypto.PublicKey, label []byte) ([]byte, error) {
-	// Run OSAP for the SRK, reading a random OddOSAP for our initial command
-	// and getting back a secret and a handle.
-	sharedSecretSRK, osaprSRK, err := newOSAPSession(rw, etSRK, khSRK, srkAuth)
+	srkSess, err := NewOSAPSession(rw, EntitySRK, khSRK, srkAuth)
 	if err != nil {
 		return nil, err
 	}
-	defer osaprSRK.Close(rw)
-	defer zeroBytes(sharedSecretSRK[:])
+	defer srkSess.Close()
 
-	// Run OSAP for the Owner, reading a random OddOSAP for our initial command
-	// and getting back a secret and a handle.
-	sharedSecretOwn, osaprOwn, err := newOSAPSession(rw, etOwner, khOwner, ownerAuth)
+	ownerSess, err := NewOSAPSession(rw, EntityOwner, khOwner, ownerAuth)
 	if err != nil {
 		return nil, err
 	}
-	defer osaprOwn.Close(rw)
-	defer zeroBytes(sharedSecretOwn[:])
+	defer ownerSess.Close()
 
 	// EncAuth for a MakeIdentity command is computed as
 	//
 	// encAuth = XOR(aikAuth, SHA1(sharedSecretOwn || <lastEvenNonce>))
 	//
-	// In this case, the last even nonce is NonceEven from OSAP for the Owner.
-	xorData, err := tpmutil.Pack(sharedSecretOwn, osaprOwn.NonceEven)
+	// where the shared secret and nonce are those of the owner's session.
+	var aikAuthDigest Digest
+	copy(aikAuthDigest[:], aikAuth)
+	defer zeroBytes(aikAuthDigest[:])
+	encAuth, err := ownerSess.EncryptAuth(aikAuthDigest)
 	if err != nil {
 		return nil, err
 	}
-	defer zeroBytes(xorData)
-
-	encAuthData := sha1.Sum(xorData)
-	var encAuth Digest
-	for i := range encAuth {
-		encAuth[i] = aikAuth[i] ^ encAuthData[i]
-	}
 
 	var caDigest Digest
 	if (pk != nil) != (label != nil) {
@@ -592,43 +753,15 @@ func MakeIdentity(rw io.ReadWriter, srkAuth []byte, ownerAuth []byte, aikAuth []
 		AlgorithmParams: aikParams,
 	}
 
-	// The digest input for MakeIdentity authentication is
-	//
-	// digest = SHA1(ordMakeIdentity || encAuth || caDigest || aik)
-	//
-	authIn := []interface{}{ordMakeIdentity, encAuth, caDigest, aik}
-	ca1, err := newCommandAuth(osaprSRK.AuthHandle, osaprSRK.NonceEven, nil, sharedSecretSRK[:], authIn)
-	if err != nil {
-		return nil, err
-	}
-
-	ca2, err := newCommandAuth(osaprOwn.AuthHandle, osaprOwn.NonceEven, nil, sharedSecretOwn[:], authIn)
-	if err != nil {
-		return nil, err
-	}
-
-	k, sig, ra1, ra2, ret, err := makeIdentity(rw, encAuth, caDigest, aik, ca1, ca2)
-	if err != nil {
-		return nil, err
-	}
-
-	// Check response authentication.
-	raIn := []interface{}{ret, ordMakeIdentity, k, tpmutil.U32Bytes(sig)}
-	if err := ra1.verify(ca1.NonceOdd, sharedSecretSRK[:], raIn); err != nil {
-		return nil, err
-	}
-
-	if err := ra2.verify(ca2.NonceOdd, sharedSecretOwn[:], raIn); err != nil {
+	var k key
+	var sig tpmutil.U32Bytes
+	params := []interface{}{encAuth, caDigest, aik}
+	if err := srkSess.RunCommand2(ownerSess, ordMakeIdentity, nil, params, []interface{}{&k, &sig}); err != nil {
 		return nil, err
 	}
 
 	// TODO(tmroeder): check the signature against the pubEK.
-	blob, err := tpmutil.Pack(k)
-	if err != nil {
-		return nil, err
-	}
-
-	return blob, nil
+	return tpmutil.Pack(k)
 }
 
 func unloadTrspiCred(blob []byte) ([]byte, error) {
@@ -670,46 +803,24 @@ func unloadTrspiCred(blob []byte) ([]byte, error) {
 // ActivateIdentity asks the TPM to decrypt an EKPub encrypted symmetric session key
 // which it uses to decrypt the symmetrically encrypted secret.
 func ActivateIdentity(rw io.ReadWriter, aikAuth []byte, ownerAuth []byte, aik tpmutil.Handle, asym, sym []byte) ([]byte, error) {
-	// Run OIAP for the AIK.
-	oiaprAIK, err := oiap(rw)
+	aikSess, err := NewOIAPSession(rw, aikAuth)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start OIAP session: %v", err)
 	}
+	defer aikSess.Close()
 
-	// Run OSAP for the owner, reading a random OddOSAP for our initial command
-	// and getting back a secret and a handle.
-	sharedSecretOwn, osaprOwn, err := newOSAPSession(rw, etOwner, khOwner, ownerAuth)
+	ownerSess, err := NewOSAPSession(rw, EntityOwner, khOwner, ownerAuth)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start OSAP session: %v", err)
 	}
-	defer osaprOwn.Close(rw)
-	defer zeroBytes(sharedSecretOwn[:])
+	defer ownerSess.Close()
 
-	authIn := []interface{}{ordActivateIdentity, tpmutil.U32Bytes(asym)}
-	ca1, err := newCommandAuth(oiaprAIK.AuthHandle, oiaprAIK.NonceEven, nil, aikAuth, authIn)
-	if err != nil {
-		return nil, fmt.Errorf("newCommandAuth failed: %v", err)
-	}
-	ca2, err := newCommandAuth(osaprOwn.AuthHandle, osaprOwn.NonceEven, nil, sharedSecretOwn[:], authIn)
-	if err != nil {
-		return nil, fmt.Errorf("newCommandAuth failed: %v", err)
-	}
-
-	symkey, ra1, ra2, ret, err := activateIdentity(rw, aik, asym, ca1, ca2)
-	if err != nil {
+	var symkey symKey
+	params := []interface{}{tpmutil.U32Bytes(asym)}
+	if err := aikSess.RunCommand2(ownerSess, ordActivateIdentity, []interface{}{aik}, params, []interface{}{&symkey}); err != nil {
 		return nil, fmt.Errorf("activateIdentity failed: %v", err)
 	}
 
-	// Check response authentication.
-	raIn := []interface{}{ret, ordActivateIdentity, symkey}
-	if err := ra1.verify(ca1.NonceOdd, aikAuth, raIn); err != nil {
-		return nil, fmt.Errorf("aik resAuth failed to verify: %v", err)
-	}
-
-	if err := ra2.verify(ca2.NonceOdd, sharedSecretOwn[:], raIn); err != nil {
-		return nil, fmt.Errorf("owner resAuth failed to verify: %v", err)
-	}
-
 	cred, err := unloadTrspiCred(sym)
 	if err != nil {
 		return nil, fmt.Errorf("unloadTrspiCred failed: %v", err)
@@ -757,84 +868,83 @@ func ActivateIdentity(rw io.ReadWriter, aikAuth []byte, ownerAuth []byte, aik tp
 // the dictionary-attack defenses to time out. This requires owner
 // authentication.
 func ResetLockValue(rw io.ReadWriter, ownerAuth Digest) error {
-	// Run OSAP for the Owner, reading a random OddOSAP for our initial command
-	// and getting back a secret and a handle.
-	sharedSecretOwn, osaprOwn, err := newOSAPSession(rw, etOwner, khOwner, ownerAuth[:])
-	if err != nil {
-		return err
-	}
-	defer osaprOwn.Close(rw)
-	defer zeroBytes(sharedSecretOwn[:])
-
-	// The digest input for ResetLockValue auth is
-	//
-	// digest = SHA1(ordResetLockValue)
-	//
-	authIn := []interface{}{ordResetLockValue}
-	ca, err := newCommandAuth(osaprOwn.AuthHandle, osaprOwn.NonceEven, nil, sharedSecretOwn[:], authIn)
-	if err != nil {
-		return err
-	}
-
-	ra, ret, err := resetLockValue(rw, ca)
+	sess, err := NewOSAPSession(rw, EntityOwner, khOwner, ownerAuth[:])
 	if err != nil {
 		return err
 	}
+	defer sess.Close()
 
-	// Check response authentication.
-	raIn := []interface{}{ret, ordResetLockValue}
-	if err := ra.verify(ca.NonceOdd, sharedSecretOwn[:], raIn); err != nil {
-		return err
-	}
-
-	return nil
+	return sess.RunCommand(ordResetLockValue, nil, nil, nil)
 }
 
-// ownerReadInternalHelper sets up command auth and checks response auth for
-// OwnerReadInternalPub. It's not exported because OwnerReadInternalPub only
+// ownerReadInternalHelper runs OwnerReadInternalPub in an owner session. It's not exported because OwnerReadInternalPub only
 // supports two fixed key handles: khEK and khSRK.
 func ownerReadInternalHelper(rw io.ReadWriter, kh tpmutil.Handle, ownerAuth Digest) (*pubKey, error) {
-	// Run OSAP for the Owner, reading a random OddOSAP for our initial command
-	// and getting back a secret and a handle.
-	sharedSecretOwn, osaprOwn, err := newOSAPSession(rw, etOwner, khOwner, ownerAuth[:])
+	sess, err := NewOSAPSession(rw, EntityOwner, khOwner, ownerAuth[:])
 	if err != nil {
 		return nil, err
 	}
-	defer osaprOwn.Close(rw)
-	defer zeroBytes(sharedSecretOwn[:])
+	defer sess.Close()
 
-	// The digest input for OwnerReadInternalPub is
-	//
-	// digest = SHA1(ordOwnerReadInternalPub || kh)
-	//
-	authIn := []interface{}{ordOwnerReadInternalPub, kh}
-	ca, err := newCommandAuth(osaprOwn.AuthHandle, osaprOwn.NonceEven, nil, sharedSecretOwn[:], authIn)
-	if err != nil {
+	// The key handle is a parameter of TPM_OwnerReadInternalPub, so it is
+	// covered by the HMAC.
+	var pk pubKey
+	if err := sess.RunCommand(ordOwnerReadInternalPub, nil, []interface{}{kh}, []interface{}{&pk}); err != nil {
 		return nil, err
 	}
+	return &pk, nil
+}
 
-	pk, ra, ret, err := ownerReadInternalPub(rw, kh, ca)
+// OwnerReadSRK uses owner auth to get a blob representing the SRK.
+func OwnerReadSRK(rw io.ReadWriter, ownerAuth Digest) ([]byte, error) {
+	pk, err := ownerReadInternalHelper(rw, khSRK, ownerAuth)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check response authentication.
-	raIn := []interface{}{ret, ordOwnerReadInternalPub, pk}
-	if err := ra.verify(ca.NonceOdd, sharedSecretOwn[:], raIn); err != nil {
+	return tpmutil.Pack(pk)
+}
+
+// OwnerReadSRKPub uses owner auth to read the public part of the SRK. It
+// works whether or not the TPM allows reading the SRK without owner auth.
+func OwnerReadSRKPub(rw io.ReadWriter, ownerAuth Digest) (*rsa.PublicKey, error) {
+	pk, err := ownerReadInternalHelper(rw, khSRK, ownerAuth)
+	if err != nil {
 		return nil, err
 	}
 
-	return pk, nil
+	return pk.unmarshalRSAPublicKey()
 }
 
-// OwnerReadSRK uses owner auth to get a blob representing the SRK.
-func OwnerReadSRK(rw io.ReadWriter, ownerAuth Digest) ([]byte, error) {
-	pk, err := ownerReadInternalHelper(rw, khSRK, ownerAuth)
+// ReadSRKPub uses SRK auth to read the public part of the SRK. The TPM only
+// allows this if its readSRKPub permanent flag is set (see
+// PermanentFlags.ReadSRKPub); otherwise it fails with TPM_INVALID_KEYHANDLE
+// and callers must use OwnerReadSRKPub instead.
+func ReadSRKPub(rw io.ReadWriter, srkAuth []byte) (*rsa.PublicKey, error) {
+	pk, err := readPubKey(rw, EntitySRK, khSRK, srkAuth)
 	if err != nil {
 		return nil, err
 	}
 
-	return tpmutil.Pack(pk)
+	return pk.unmarshalRSAPublicKey()
+}
+
+// WellKnownSecret returns the auth value of 20 bytes of zeros that TSS
+// stacks and tpm-tools (with -z) give the SRK, and often the owner, when no
+// password is set. Functions that take SRK auth assume it for the khSRK
+// parent.
+func WellKnownSecret() Digest {
+	return Digest{}
+}
+
+// PasswordAuth derives an auth value from a password the way the TSS and the
+// examples in this repository do: it returns the SHA1 hash of password, or
+// WellKnownSecret() if password is empty.
+func PasswordAuth(password string) Digest {
+	if password == "" {
+		return WellKnownSecret()
+	}
+	return sha1.Sum([]byte(password))
 }
 
 // ReadEKCert reads the EKCert from the NVRAM.
@@ -921,40 +1031,24 @@ func ReadEKCert(rw io.ReadWriter, ownAuth Digest) ([]byte, error) {
 // NVDefineSpace implements the reservation of NVRAM as specified in:
 // TPM-Main-Part-3-Commands_v1.2_rev116_01032011, P. 212
 func NVDefineSpace(rw io.ReadWriter, nvData NVDataPublic, ownAuth []byte) error {
-	var ra *responseAuth
-	var ret uint32
 	if ownAuth == nil {
-	} else {
-		sharedSecretOwn, osaprOwn, err := newOSAPSession(rw, etOwner, khOwner, ownAuth[:])
-		if err != nil {
-			return fmt.Errorf("failed to start new auth session: %v", err)
-		}
-		defer osaprOwn.Close(rw)
-		defer zeroBytes(sharedSecretOwn[:])
-
-		// encAuth: NV_Define_Space is a special case where no encryption is used.
-		// See spec: TPM-Main-Part-1-Design-Principles_v1.2_rev116_01032011, P. 81
-		xorData, err := tpmutil.Pack(sharedSecretOwn, osaprOwn.NonceEven)
-		if err != nil {
-			return err
-		}
-		defer zeroBytes(xorData)
-
-		encAuthData := sha1.Sum(xorData)
+		return nil
+	}
+	sess, err := NewOSAPSession(rw, EntityOwner, khOwner, ownAuth)
+	if err != nil {
+		return fmt.Errorf("failed to start new auth session: %v", err)
+	}
+	defer sess.Close()
 
-		authIn := []interface{}{ordNVDefineSpace, nvData, encAuthData}
-		ca, err := newCommandAuth(osaprOwn.AuthHandle, osaprOwn.NonceEven, nil, sharedSecretOwn[:], authIn)
-		if err != nil {
-			return err
-		}
-		ra, ret, err = nvDefineSpace(rw, nvData, encAuthData, ca)
-		if err != nil {
-			return fmt.Errorf("failed to define space in NVRAM: %v", err)
-		}
-		raIn := []interface{}{ret, ordNVDefineSpace}
-		if err := ra.verify(ca.NonceOdd, sharedSecretOwn[:], raIn); err != nil {
-			return fmt.Errorf("failed to verify authenticity of response: %v", err)
-		}
+	// encAuth: NV_Define_Space is a special case where no encryption is used,
+	// so encAuth is the ADIP pad itself, SHA1(sharedSecret || nonceEven).
+	// See spec: TPM-Main-Part-1-Design-Principles_v1.2_rev116_01032011, P. 81
+	encAuth, err := sess.EncryptAuth(Digest{})
+	if err != nil {
+		return err
+	}
+	if err := sess.RunCommand(ordNVDefineSpace, nil, []interface{}{nvData, encAuth}, nil); err != nil {
+		return fmt.Errorf("failed to define space in NVRAM: %v", err)
 	}
 	return nil
 }
@@ -966,32 +1060,23 @@ func NVDefineSpace(rw io.ReadWriter, nvData NVDataPublic, ownAuth []byte) error
 // See TPM-Main-Part-3-Commands-20.4
 func NVReadValue(rw io.ReadWriter, index, offset, len uint32, ownAuth []byte) ([]byte, error) {
 	if ownAuth == nil {
-		data, _, _, err := nvReadValue(rw, index, offset, len, nil)
+		data, err := nvReadValue(rw, index, offset, len)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read from NVRAM: %v", err)
 		}
 		return data, nil
 	}
-	sharedSecretOwn, osaprOwn, err := newOSAPSession(rw, etOwner, khOwner, ownAuth[:])
+	sess, err := NewOSAPSession(rw, EntityOwner, khOwner, ownAuth)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start new auth session: %v", err)
 	}
-	defer osaprOwn.Close(rw)
-	defer zeroBytes(sharedSecretOwn[:])
-	authIn := []interface{}{ordNVReadValue, index, offset, len}
-	ca, err := newCommandAuth(osaprOwn.AuthHandle, osaprOwn.NonceEven, nil, sharedSecretOwn[:], authIn)
-	if err != nil {
-		return nil, fmt.Errorf("failed to construct owner auth fields: %v", err)
-	}
-	data, ra, ret, err := nvReadValue(rw, index, offset, len, ca)
-	if err != nil {
+	defer sess.Close()
+
+	var data tpmutil.U32Bytes
+	params := []interface{}{index, offset, len}
+	if err := sess.RunCommand(ordNVReadValue, nil, params, []interface{}{&data}); err != nil {
 		return nil, fmt.Errorf("failed to read from NVRAM: %v", err)
 	}
-	raIn := []interface{}{ret, ordNVReadValue, tpmutil.U32Bytes(data)}
-	if err := ra.verify(ca.NonceOdd, sharedSecretOwn[:], raIn); err != nil {
-		return nil, fmt.Errorf("failed to verify authenticity of response: %v", err)
-	}
-
 	return data, nil
 }
 
@@ -1003,26 +1088,17 @@ func NVReadValueAuth(rw io.ReadWriter, index, offset, len uint32, auth []byte) (
 	if auth == nil {
 		return nil, fmt.Errorf("no auth value given but mandatory")
 	}
-	sharedSecret, osapr, err := newOSAPSession(rw, etOwner, khOwner, auth[:])
+	sess, err := NewOSAPSession(rw, EntityOwner, khOwner, auth)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start new auth session: %v", err)
 	}
-	defer osapr.Close(rw)
-	defer zeroBytes(sharedSecret[:])
-	authIn := []interface{}{ordNVReadValueAuth, index, offset, len}
-	ca, err := newCommandAuth(osapr.AuthHandle, osapr.NonceEven, nil, sharedSecret[:], authIn)
-	if err != nil {
-		return nil, fmt.Errorf("failed to construct auth fields: %v", err)
-	}
-	data, ra, ret, err := nvReadValue(rw, index, offset, len, ca)
-	if err != nil {
+	defer sess.Close()
+
+	var data tpmutil.U32Bytes
+	params := []interface{}{index, offset, len}
+	if err := sess.RunCommand(ordNVReadValueAuth, nil, params, []interface{}{&data}); err != nil {
 		return nil, fmt.Errorf("failed to read from NVRAM: %v", err)
 	}
-	raIn := []interface{}{ret, ordNVReadValueAuth, tpmutil.U32Bytes(data)}
-	if err := ra.verify(ca.NonceOdd, sharedSecret[:], raIn); err != nil {
-		return nil, fmt.Errorf("failed to verify authenticity of response: %v", err)
-	}
-
 	return data, nil
 }
 
@@ -1030,30 +1106,21 @@ func NVReadValueAuth(rw io.ReadWriter, index, offset, len uint32, auth []byte) (
 // See TPM-Main-Part-3-Commands_v1.2_rev116_01032011, P216
 func NVWriteValue(rw io.ReadWriter, index, offset uint32, data []byte, ownAuth []byte) error {
 	if ownAuth == nil {
-		if _, _, _, err := nvWriteValue(rw, index, offset, uint32(len(data)), data, nil); err != nil {
+		if err := nvWriteValue(rw, index, offset, data); err != nil {
 			return fmt.Errorf("failed to write to NVRAM: %v", err)
 		}
 		return nil
 	}
-	sharedSecretOwn, osaprOwn, err := newOSAPSession(rw, etOwner, khOwner, ownAuth[:])
+	sess, err := NewOSAPSession(rw, EntityOwner, khOwner, ownAuth)
 	if err != nil {
 		return fmt.Errorf("failed to start new auth session: %v", err)
 	}
-	defer osaprOwn.Close(rw)
-	defer zeroBytes(sharedSecretOwn[:])
-	authIn := []interface{}{ordNVWriteValue, index, offset, len(data), data}
-	ca, err := newCommandAuth(osaprOwn.AuthHandle, osaprOwn.NonceEven, nil, sharedSecretOwn[:], authIn)
-	if err != nil {
-		return fmt.Errorf("failed to construct owner auth fields: %v", err)
-	}
-	data, ra, ret, err := nvWriteValue(rw, index, offset, uint32(len(data)), data, ca)
-	if err != nil {
+	defer sess.Close()
+
+	params := []interface{}{index, offset, tpmutil.U32Bytes(data)}
+	if err := sess.RunCommand(ordNVWriteValue, nil, params, nil); err != nil {
 		return fmt.Errorf("failed to write to NVRAM: %v", err)
 	}
-	raIn := []interface{}{ret, ordNVWriteValue, tpmutil.U32Bytes(data)}
-	if err := ra.verify(ca.NonceOdd, sharedSecretOwn[:], raIn); err != nil {
-		return fmt.Errorf("failed to verify authenticity of response: %v", err)
-	}
 	return nil
 }
 
@@ -1066,25 +1133,16 @@ func NVWriteValueAuth(rw io.ReadWriter, index, offset uint32, data []byte, auth
 	if auth == nil {
 		return fmt.Errorf("no auth value given but mandatory")
 	}
-	sharedSecret, osapr, err := newOSAPSession(rw, etOwner, khOwner, auth[:])
+	sess, err := NewOSAPSession(rw, EntityOwner, khOwner, auth)
 	if err != nil {
 		return fmt.Errorf("failed to start new auth session: %v", err)
 	}
-	defer osapr.Close(rw)
-	defer zeroBytes(sharedSecret[:])
-	authIn := []interface{}{ordNVWriteValueAuth, index, offset, len(data), data}
-	ca, err := newCommandAuth(osapr.AuthHandle, osapr.NonceEven, nil, sharedSecret[:], authIn)
-	if err != nil {
-		return fmt.Errorf("failed to construct auth fields: %v", err)
-	}
-	data, ra, ret, err := nvWriteValue(rw, index, offset, uint32(len(data)), data, ca)
-	if err != nil {
+	defer sess.Close()
+
+	params := []interface{}{index, offset, tpmutil.U32Bytes(data)}
+	if err := sess.RunCommand(ordNVWriteValueAuth, nil, params, nil); err != nil {
 		return fmt.Errorf("failed to write to NVRAM: %v", err)
 	}
-	raIn := []interface{}{ret, ordNVWriteValueAuth, tpmutil.U32Bytes(data)}
-	if err := ra.verify(ca.NonceOdd, sharedSecret[:], raIn); err != nil {
-		return fmt.Errorf("failed to verify authenticity of response: %v", err)
-	}
 	return nil
 }
 
@@ -1213,37 +1271,13 @@ func GetCapabilityRaw(rw io.ReadWriter, cap, subcap uint32) ([]byte, error) {
 // OwnerClear uses owner auth to clear the TPM. After this operation, the TPM
 // can change ownership.
 func OwnerClear(rw io.ReadWriter, ownerAuth Digest) error {
-	// Run OSAP for the Owner, reading a random OddOSAP for our initial command
-	// and getting back a secret and a handle.
-	sharedSecretOwn, osaprOwn, err := newOSAPSession(rw, etOwner, khOwner, ownerAuth[:])
-	if err != nil {
-		return err
-	}
-	defer osaprOwn.Close(rw)
-	defer zeroBytes(sharedSecretOwn[:])
-
-	// The digest input for OwnerClear is
-	//
-	// digest = SHA1(ordOwnerClear)
-	//
-	authIn := []interface{}{ordOwnerClear}
-	ca, err := newCommandAuth(osaprOwn.AuthHandle, osaprOwn.NonceEven, nil, sharedSecretOwn[:], authIn)
+	sess, err := NewOSAPSession(rw, EntityOwner, khOwner, ownerAuth[:])
 	if err != nil {
 		return err
 	}
+	defer sess.Close()
 
-	ra, ret, err := ownerClear(rw, ca)
-	if err != nil {
-		return err
-	}
-
-	// Check response authentication.
-	raIn := []interface{}{ret, ordOwnerClear}
-	if err := ra.verify(ca.NonceOdd, sharedSecretOwn[:], raIn); err != nil {
-		return err
-	}
-
-	return nil
+	return sess.RunCommand(ordOwnerClear, nil, nil, nil)
 }
 
 // TakeOwnership takes over a TPM and inserts a new owner auth value and
@@ -1296,75 +1330,36 @@ func TakeOwnership(rw io.ReadWriter, newOwnerAuth Digest, newSRKAuth Digest, pub
 		AlgorithmParams: srkParams,
 	}
 
-	// Get command auth using OIAP with the new owner auth.
-	oiapr, err := oiap(rw)
-	if err != nil {
-		return err
-	}
-	defer oiapr.Close(rw)
-
-	// The digest for TakeOwnership is
-	//
-	// SHA1(ordTakeOwnership || pidOwner || encOwnerAuth || encSRKAuth || srk)
-	authIn := []interface{}{ordTakeOwnership, pidOwner, tpmutil.U32Bytes(encOwnerAuth), tpmutil.U32Bytes(encSRKAuth), srk}
-	ca, err := newCommandAuth(oiapr.AuthHandle, oiapr.NonceEven, nil, newOwnerAuth[:], authIn)
+	// Authorize the command with the new owner auth.
+	sess, err := NewOIAPSession(rw, newOwnerAuth[:])
 	if err != nil {
 		return err
 	}
+	defer sess.Close()
 
-	k, ra, ret, err := takeOwnership(rw, encOwnerAuth, encSRKAuth, srk, ca)
-	if err != nil {
-		return err
-	}
-
-	raIn := []interface{}{ret, ordTakeOwnership, k}
-	return ra.verify(ca.NonceOdd, newOwnerAuth[:], raIn)
+	var k key
+	params := []interface{}{pidOwner, tpmutil.U32Bytes(encOwnerAuth), tpmutil.U32Bytes(encSRKAuth), srk}
+	return sess.RunCommand(ordTakeOwnership, nil, params, []interface{}{&k})
 }
 
 func createWrapKeyHelper(rw io.ReadWriter, srkAuth []byte, keyFlags KeyFlags, usageAuth Digest, migrationAuth Digest, pcrs []int) (*key, error) {
-	// Run OSAP for the SRK, reading a random OddOSAP for our initial
-	// command and getting back a secret and a handle.
-	sharedSecret, osapr, err := newOSAPSession(rw, etSRK, khSRK, srkAuth)
-	if err != nil {
-		return nil, err
-	}
-	defer osapr.Close(rw)
-	defer zeroBytes(sharedSecret[:])
-
-	xorData, err := tpmutil.Pack(sharedSecret, osapr.NonceEven)
+	sess, err := NewOSAPSession(rw, EntitySRK, khSRK, srkAuth)
 	if err != nil {
 		return nil, err
 	}
-	defer zeroBytes(xorData)
-
-	// We have to come up with NonceOdd early to encrypt the migration auth.
-	var nonceOdd Nonce
-	if _, err := rand.Read(nonceOdd[:]); err != nil {
-		return nil, err
-	}
+	defer sess.Close()
 
 	// ADIP (Authorization Data Insertion Protocol) is based on NonceEven for the first auth value
 	// encrypted by the protocol, and NonceOdd for the second auth value. This is so that the two
 	// keystreams are independent - otherwise, an eavesdropping attacker could XOR the two encrypted
 	// values together to cancel out the key and calculate (usageAuth ^ migrationAuth).
-	xorData2, err := tpmutil.Pack(sharedSecret, nonceOdd)
+	encUsageAuth, err := sess.EncryptAuth(usageAuth)
 	if err != nil {
 		return nil, err
 	}
-	defer zeroBytes(xorData2)
-
-	encAuthDataKey := sha1.Sum(xorData)
-	defer zeroBytes(encAuthDataKey[:])
-	encAuthDataKey2 := sha1.Sum(xorData2)
-	defer zeroBytes(encAuthDataKey2[:])
-
-	var encUsageAuth Digest
-	for i := range usageAuth {
-		encUsageAuth[i] = encAuthDataKey[i] ^ usageAuth[i]
-	}
-	var encMigrationAuth Digest
-	for i := range migrationAuth {
-		encMigrationAuth[i] = encAuthDataKey2[i] ^ migrationAuth[i]
+	encMigrationAuth, err := sess.encryptAuthOdd(migrationAuth)
+	if err != nil {
+		return nil, err
 	}
 
 	rParams := rsaKeyParams{
@@ -1402,23 +1397,12 @@ func createWrapKeyHelper(rw io.ReadWriter, srkAuth []byte, keyFlags KeyFlags, us
 		PCRInfo: pcrInfoBytes,
 	}
 
-	authIn := []interface{}{ordCreateWrapKey, encUsageAuth, encMigrationAuth, keyInfo}
-	ca, err := newCommandAuth(osapr.AuthHandle, osapr.NonceEven, &nonceOdd, sharedSecret[:], authIn)
-	if err != nil {
-		return nil, err
-	}
-
-	k, ra, ret, err := createWrapKey(rw, encUsageAuth, encMigrationAuth, keyInfo, ca)
-	if err != nil {
-		return nil, err
-	}
-
-	raIn := []interface{}{ret, ordCreateWrapKey, k}
-	if err = ra.verify(ca.NonceOdd, sharedSecret[:], raIn); err != nil {
+	var k key
+	params := []interface{}{encUsageAuth, encMigrationAuth, keyInfo}
+	if err := sess.RunCommand(ordCreateWrapKey, []interface{}{khSRK}, params, []interface{}{&k}); err != nil {
 		return nil, err
 	}
-
-	return k, nil
+	return &k, nil
 }
 
 // CreateWrapKey creates a new RSA key for signatures inside the TPM. It is
@@ -1460,14 +1444,11 @@ func CreateMigratableWrapKey(rw io.ReadWriter, srkAuth []byte, usageAuth Digest,
 // AuthorizeMigrationKey authorizes a given public key for use in migrating
 // migratable keys. The scheme is REWRAP.
 func AuthorizeMigrationKey(rw io.ReadWriter, ownerAuth Digest, migrationKey crypto.PublicKey) ([]byte, error) {
-	// Run OSAP for the OwnerAuth, reading a random OddOSAP for our initial
-	// command and getting back a secret and a handle.
-	sharedSecret, osapr, err := newOSAPSession(rw, etOwner, khOwner, ownerAuth[:])
+	sess, err := NewOSAPSession(rw, EntityOwner, khOwner, ownerAuth[:])
 	if err != nil {
 		return nil, err
 	}
-	defer osapr.Close(rw)
-	defer zeroBytes(sharedSecret[:])
+	defer sess.Close()
 
 	var pub *pubKey
 	if migrationKey != nil {
@@ -1489,71 +1470,35 @@ func AuthorizeMigrationKey(rw io.ReadWriter, ownerAuth Digest, migrationKey cryp
 		}
 	}
 
-	scheme := msRewrap
-
-	// The digest for auth for the authorizeMigrationKey command is computed as
-	// SHA1(ordAuthorizeMigrationkey || migrationScheme || migrationKey)
-	authIn := []interface{}{ordAuthorizeMigrationKey, scheme, pub}
-
-	// The commandAuth uses the shared secret as an HMAC key.
-	ca, err := newCommandAuth(osapr.AuthHandle, osapr.NonceEven, nil, sharedSecret[:], authIn)
-	if err != nil {
-		return nil, err
-	}
-
-	migrationAuth, _, _, err := authorizeMigrationKey(rw, scheme, *pub, ca)
-	if err != nil {
+	var migrationAuth migrationKeyAuth
+	params := []interface{}{msRewrap, *pub}
+	if err := sess.RunCommand(ordAuthorizeMigrationKey, nil, params, []interface{}{&migrationAuth}); err != nil {
 		return nil, err
 	}
-
-	// For now, ignore the response authentication.
-	return migrationAuth, nil
+	return tpmutil.Pack(migrationAuth)
 }
 
 // CreateMigrationBlob performs a Rewrap migration of the given key blob.
 func CreateMigrationBlob(rw io.ReadWriter, srkAuth Digest, migrationAuth Digest, keyBlob []byte, migrationKeyBlob []byte) ([]byte, error) {
-	// Run OSAP for the SRK, reading a random OddOSAP for our initial
-	// command and getting back a secret and a handle.
-	sharedSecret, osapr, err := newOSAPSession(rw, etSRK, khSRK, srkAuth[:])
+	sess, err := NewOSAPSession(rw, EntitySRK, khSRK, srkAuth[:])
 	if err != nil {
 		return nil, err
 	}
-	defer osapr.Close(rw)
-	defer zeroBytes(sharedSecret[:])
+	defer sess.Close()
 
-	// The createMigrationBlob command needs an OIAP session in addition to the
-	// OSAP session.
-	oiapr, err := oiap(rw)
+	// The createMigrationBlob command needs an OIAP session with the
+	// migration auth in addition to the OSAP session for the SRK.
+	migSess, err := NewOIAPSession(rw, migrationAuth[:])
 	if err != nil {
 		return nil, err
 	}
-	defer oiapr.Close(rw)
+	defer migSess.Close()
 
-	encData := tpmutil.U32Bytes(keyBlob)
-
-	// The digest for auth1 and auth2 for the createMigrationBlob command is
-	// SHA1(ordCreateMigrationBlob || migrationScheme || migrationKeyBlob || encData)
-	authIn := []interface{}{ordCreateMigrationBlob, msRewrap, migrationKeyBlob, encData}
-
-	// The first commandAuth uses the shared secret as an HMAC key.
-	ca1, err := newCommandAuth(osapr.AuthHandle, osapr.NonceEven, nil, sharedSecret[:], authIn)
-	if err != nil {
-		return nil, err
-	}
-
-	// The second commandAuth is based on OIAP instead of OSAP and uses the
-	// migration auth as the HMAC key.
-	ca2, err := newCommandAuth(oiapr.AuthHandle, oiapr.NonceEven, nil, migrationAuth[:], authIn)
-	if err != nil {
+	var random, outData tpmutil.U32Bytes
+	params := []interface{}{msRewrap, migrationKeyBlob, tpmutil.U32Bytes(keyBlob)}
+	if err := sess.RunCommand2(migSess, ordCreateMigrationBlob, []interface{}{khSRK}, params, []interface{}{&random, &outData}); err != nil {
 		return nil, err
 	}
-
-	_, outData, _, _, _, err := createMigrationBlob(rw, khSRK, msRewrap, migrationKeyBlob, encData, ca1, ca2)
-	if err != nil {
-		return nil, err
-	}
-
-	// For now, ignore the response authenticatino.
 	return outData, nil
 }
 
@@ -1579,32 +1524,18 @@ func Sign(rw io.ReadWriter, keyAuth []byte, keyHandle tpmutil.Handle, hash crypt
 	}
 	data := append(prefix, hashed...)
 
-	// Run OSAP for the SRK, reading a random OddOSAP for our initial
-	// command and getting back a secret and a handle.
-	sharedSecret, osapr, err := newOSAPSession(rw, etKeyHandle, keyHandle, keyAuth)
-	if err != nil {
-		return nil, err
-	}
-	defer osapr.Close(rw)
-	defer zeroBytes(sharedSecret[:])
-
-	authIn := []interface{}{ordSign, tpmutil.U32Bytes(data)}
-	ca, err := newCommandAuth(osapr.AuthHandle, osapr.NonceEven, nil, sharedSecret[:], authIn)
+	sess, err := NewOSAPSession(rw, EntityKeyHandle, keyHandle, keyAuth)
 	if err != nil {
 		return nil, err
 	}
+	defer sess.Close()
 
-	signature, ra, ret, err := sign(rw, keyHandle, data, ca)
-	if err != nil {
+	var signature tpmutil.U32Bytes
+	handles := []interface{}{keyHandle}
+	params := []interface{}{tpmutil.U32Bytes(data)}
+	if err := sess.RunCommand(ordSign, handles, params, []interface{}{&signature}); err != nil {
 		return nil, err
 	}
-
-	raIn := []interface{}{ret, ordSign, tpmutil.U32Bytes(signature)}
-	err = ra.verify(ca.NonceOdd, sharedSecret[:], raIn)
-	if err != nil {
-		return nil, err
-	}
-
 	return signature, nil
 }
 
@@ -1660,3 +1591,237 @@ func createEK(rw io.ReadWriter) error {
 
 	return err
 }
+
+// GetAuditDigest returns the current audit digest along with the list of
+// ordinals that are audited by the TPM.
+func GetAuditDigest(rw io.ReadWriter) (*AuditDigest, []uint32, error) {
+	var ords []uint32
+	var start uint32
+	for {
+		ad, more, page, err := getAuditDigest(rw, start)
+		if err != nil {
+			return nil, nil, err
+		}
+		ords = append(ords, page...)
+		if !more || len(page) == 0 {
+			return ad, ords, nil
+		}
+		start = page[len(page)-1] + 1
+	}
+}
+
+// GetAuditDigestSigned returns the current audit digest, signed by the given
+// key together with the anti-replay nonce. If closeAudit is true, the TPM
+// closes the current audit digest, so that the next audited command starts a
+// new one; this requires the key to be an identity key.
+func GetAuditDigestSigned(rw io.ReadWriter, keyHandle tpmutil.Handle, keyAuth []byte, closeAudit bool, antiReplay Nonce) (*SignedAuditDigest, error) {
+	sess, err := NewOIAPSession(rw, keyAuth)
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Close()
+
+	var sad SignedAuditDigest
+	var sig tpmutil.U32Bytes
+	handles := []interface{}{keyHandle}
+	params := []interface{}{closeAudit, antiReplay}
+	out := []interface{}{&sad.Counter, &sad.Digest, &sad.OrdinalDigest, &sig}
+	if err := sess.RunCommand(ordGetAuditDigestSigned, handles, params, out); err != nil {
+		return nil, err
+	}
+	sad.Signature = sig
+	return &sad, nil
+}
+
+// SetOrdinalAuditStatus enables or disables auditing of the given ordinal.
+// It requires owner authorization.
+func SetOrdinalAuditStatus(rw io.ReadWriter, ownerAuth Digest, ordinal uint32, audit bool) error {
+	sess, err := NewOIAPSession(rw, ownerAuth[:])
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	return sess.RunCommand(ordSetOrdinalAuditStatus, nil, []interface{}{ordinal, audit}, nil)
+}
+
+// delegateManage runs TPM_Delegate_Manage with owner authorization and
+// returns the operation-specific output data.
+func delegateManage(rw io.ReadWriter, ownerAuth Digest, familyID uint32, op uint32, opData []byte) ([]byte, error) {
+	sess, err := NewOIAPSession(rw, ownerAuth[:])
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Close()
+
+	var retData tpmutil.U32Bytes
+	params := []interface{}{familyID, op, tpmutil.U32Bytes(opData)}
+	if err := sess.RunCommand(ordDelegateManage, nil, params, []interface{}{&retData}); err != nil {
+		return nil, err
+	}
+	return retData, nil
+}
+
+// CreateDelegationFamily creates a new delegation family with the given label
+// and returns its ID. It requires owner authorization.
+func CreateDelegationFamily(rw io.ReadWriter, ownerAuth Digest, label byte) (uint32, error) {
+	ret, err := delegateManage(rw, ownerAuth, 0, familyCreate, []byte{label})
+	if err != nil {
+		return 0, err
+	}
+	if len(ret) != 4 {
+		return 0, fmt.Errorf("the TPM returned %d bytes for the family ID, want 4", len(ret))
+	}
+	return binary.BigEndian.Uint32(ret), nil
+}
+
+// EnableDelegationFamily enables or disables the use of the delegations in a
+// family. It requires owner authorization.
+func EnableDelegationFamily(rw io.ReadWriter, ownerAuth Digest, familyID uint32, enable bool) error {
+	_, err := delegateManage(rw, ownerAuth, familyID, familyEnable, boolBytes(enable))
+	return err
+}
+
+// LockDelegationFamily sets or clears the admin lock of a delegation family,
+// which prevents further changes to the family's delegations. It requires
+// owner authorization.
+func LockDelegationFamily(rw io.ReadWriter, ownerAuth Digest, familyID uint32, lock bool) error {
+	_, err := delegateManage(rw, ownerAuth, familyID, familyAdmin, boolBytes(lock))
+	return err
+}
+
+// InvalidateDelegationFamily invalidates a delegation family and all the
+// delegations in it. It requires owner authorization.
+func InvalidateDelegationFamily(rw io.ReadWriter, ownerAuth Digest, familyID uint32) error {
+	_, err := delegateManage(rw, ownerAuth, familyID, familyInvalidate, nil)
+	return err
+}
+
+// boolBytes encodes a BOOL as opData for TPM_Delegate_Manage.
+func boolBytes(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// CreateOwnerDelegation delegates the owner permissions in perms, within the
+// given family, to the holder of delegateAuth. If increment is true, the
+// family's verification count is incremented first, invalidating all existing
+// delegations in the family. It returns the delegation blob, which can be
+// loaded into the delegation table with LoadOwnerDelegation.
+func CreateOwnerDelegation(rw io.ReadWriter, ownerAuth Digest, familyID uint32, label byte, perms Delegations, delegateAuth Digest, increment bool) ([]byte, error) {
+	sess, err := NewOSAPSession(rw, EntityOwner, khOwner, ownerAuth[:])
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Close()
+
+	encAuth, err := sess.EncryptAuth(delegateAuth)
+	if err != nil {
+		return nil, err
+	}
+	perms.Tag = tagDelegations
+	perms.DelegateType = DelegationTypeOwner
+	pub := delegatePublic{
+		Tag:      tagDelegatePublic,
+		RowLabel: label,
+		// Delegations are not bound to any PCRs.
+		PCRInfo: pcrInfoShort{
+			PCRsAtRelease: pcrSelection{Size: 3},
+			LocAtRelease:  LocZero | LocOne | LocTwo | LocThree | LocFour,
+		},
+		Permissions: perms,
+		FamilyID:    familyID,
+	}
+
+	var blob tpmutil.U32Bytes
+	params := []interface{}{increment, pub, encAuth}
+	if err := sess.RunCommand(ordDelegateCreateOwnerDel, nil, params, []interface{}{&blob}); err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// LoadOwnerDelegation loads an owner delegation blob into the given row of
+// the delegation table. It requires owner authorization.
+func LoadOwnerDelegation(rw io.ReadWriter, ownerAuth Digest, index uint32, blob []byte) error {
+	sess, err := NewOIAPSession(rw, ownerAuth[:])
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	params := []interface{}{index, tpmutil.U32Bytes(blob)}
+	return sess.RunCommand(ordDelegateLoadOwnerDel, nil, params, nil)
+}
+
+// ReadDelegateTable reads the public contents of the delegation family table
+// and of the delegation table.
+func ReadDelegateTable(rw io.ReadWriter) ([]FamilyTableEntry, []DelegateTableRow, error) {
+	return delegateReadTable(rw)
+}
+
+// CreateMaintenanceArchive creates an archive of the TPM's protected storage
+// that can be loaded by the manufacturer to migrate it to a new TPM. If
+// generateRandom is true, the TPM generates the random value used to mask the
+// archive and returns it; otherwise it is derived from the owner auth. It
+// requires owner authorization.
+func CreateMaintenanceArchive(rw io.ReadWriter, ownerAuth Digest, generateRandom bool) (random []byte, archive []byte, err error) {
+	sess, err := NewOIAPSession(rw, ownerAuth[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	defer sess.Close()
+
+	var r, a tpmutil.U32Bytes
+	params := []interface{}{generateRandom}
+	if err := sess.RunCommand(ordCreateMaintenanceArchive, nil, params, []interface{}{&r, &a}); err != nil {
+		return nil, nil, err
+	}
+	return r, a, nil
+}
+
+// KillMaintenanceFeature permanently disables the creation of maintenance
+// archives until the next TPM_TakeOwnership. It requires owner authorization.
+func KillMaintenanceFeature(rw io.ReadWriter, ownerAuth Digest) error {
+	sess, err := NewOIAPSession(rw, ownerAuth[:])
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	return sess.RunCommand(ordKillMaintenanceFeature, nil, nil, nil)
+}
+
+// ReadManuMaintPub returns the checksum of the manufacturer's maintenance
+// public key, computed as SHA1(pubKey || antiReplay).
+func ReadManuMaintPub(rw io.ReadWriter, antiReplay Nonce) (Digest, error) {
+	return readManuMaintPub(rw, antiReplay)
+}
+
+// ReadCurrentTicks reads the current value of the TPM's tick counter.
+func ReadCurrentTicks(rw io.ReadWriter) (*CurrentTicks, error) {
+	return getTicks(rw)
+}
+
+// TickStampBlob has the TPM sign the given digest together with the current
+// value of its tick counter and the anti-replay nonce, proving that the
+// digest existed at that tick count. It returns the tick counter value and
+// the signature, which can be checked with VerifyTickStamp.
+func TickStampBlob(rw io.ReadWriter, keyHandle tpmutil.Handle, keyAuth []byte, antiReplay Nonce, digest Digest) (*CurrentTicks, []byte, error) {
+	sess, err := NewOIAPSession(rw, keyAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer sess.Close()
+
+	var ct CurrentTicks
+	var sig tpmutil.U32Bytes
+	handles := []interface{}{keyHandle}
+	params := []interface{}{antiReplay, digest}
+	if err := sess.RunCommand(ordTickStampBlob, handles, params, []interface{}{&ct, &sig}); err != nil {
+		return nil, nil, err
+	}
+	return &ct, sig, nil
+}
@@ -38,13 +38,7 @@ var (
 // If the environment variable is not present, then getAuth returns the
 // well-known auth value of 20 bytes of zeros.
 func getAuth(name string) Digest {
-	var auth Digest
-	authInput := os.Getenv(name)
-	if authInput != "" {
-		aa := sha1.Sum([]byte(authInput))
-		copy(auth[:], aa[:])
-	}
-	return auth
+	return PasswordAuth(os.Getenv(name))
 }
 
 func TestGetKeys(t *testing.T) {
@@ -569,6 +563,56 @@ func TestOwnerReadSRK(t *testing.T) {
 	}
 }
 
+func TestOwnerReadSRKPub(t *testing.T) {
+	rwc := openTPMOrSkip(t)
+	defer rwc.Close()
+
+	// This test code assumes that the owner auth is the well-known value.
+	ownerAuth := getAuth(ownerAuthEnvVar)
+	pk, err := OwnerReadSRKPub(rwc, ownerAuth)
+	if err != nil {
+		t.Fatal("Couldn't read the SRK public key using owner auth:", err)
+	}
+
+	srkb, err := OwnerReadSRK(rwc, ownerAuth)
+	if err != nil {
+		t.Fatal("Couldn't read the SRK using owner auth:", err)
+	}
+	want, err := UnmarshalPubRSAPublicKey(srkb)
+	if err != nil {
+		t.Fatal("Couldn't parse the SRK blob:", err)
+	}
+	if !pk.Equal(want) {
+		t.Fatal("OwnerReadSRKPub and OwnerReadSRK returned different keys")
+	}
+
+	// Reading the SRK with SRK auth only works if the owner allowed it.
+	flags, err := GetPermanentFlags(rwc)
+	if err != nil {
+		t.Fatal("Couldn't read the permanent flags:", err)
+	}
+	if !flags.ReadSRKPub {
+		return
+	}
+	srkAuth := getAuth(srkAuthEnvVar)
+	got, err := ReadSRKPub(rwc, srkAuth[:])
+	if err != nil {
+		t.Fatal("Couldn't read the SRK public key using SRK auth:", err)
+	}
+	if !got.Equal(want) {
+		t.Fatal("ReadSRKPub and OwnerReadSRK returned different keys")
+	}
+}
+
+func TestPasswordAuth(t *testing.T) {
+	if got := PasswordAuth(""); got != WellKnownSecret() {
+		t.Errorf("PasswordAuth(\"\") = % x, want the well-known secret", got)
+	}
+	if got, want := PasswordAuth("password"), Digest(sha1.Sum([]byte("password"))); got != want {
+		t.Errorf("PasswordAuth(\"password\") = % x, want % x", got, want)
+	}
+}
+
 func TestOwnerReadPubEK(t *testing.T) {
 	rwc := openTPMOrSkip(t)
 	defer rwc.Close()
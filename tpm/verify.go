@@ -15,10 +15,12 @@
 package tpm
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/rsa"
 	"crypto/sha1"
 	"errors"
+	"fmt"
 	"math/big"
 
 	"github.com/google/go-tpm/tpmutil"
@@ -143,8 +145,101 @@ func VerifyQuote(pk *rsa.PublicKey, data []byte, quote []byte, pcrNums []int, pc
 	return rsa.VerifyPKCS1v15(pk, crypto.SHA1, s[:], quote)
 }
 
-// TODO(tmroeder): add VerifyQuote2 instead of VerifyQuote. This means I'll
-// probably have to look at the signature scheme and use that to choose how to
-// verify the signature, whether PKCS1v1.5 or OAEP. And this will have to be set
-// on the key before it's passed to ordQuote2
+// NewQuoteInfo2 computes the data signed by TPM_Quote2 for the given data and
+// quote, checking that the quote is over the given PCRs with the given values.
+func NewQuoteInfo2(data []byte, q *SignedQuote2, pcrNums []int, pcrs []byte) ([]byte, error) {
+	var info pcrInfoShort
+	if _, err := tpmutil.Unpack(q.PCRInfo, &info); err != nil {
+		return nil, fmt.Errorf("invalid PCR info: %v", err)
+	}
+	pcrSel, err := newPCRSelection(pcrNums)
+	if err != nil {
+		return nil, err
+	}
+	if info.PCRsAtRelease != *pcrSel {
+		return nil, fmt.Errorf("quote is over PCRs %v, want %v", info.PCRsAtRelease, pcrSel)
+	}
+	comp, err := createPCRComposite(pcrSel.Mask, pcrs)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(info.DigestAtRelease[:], comp) {
+		return nil, errors.New("quoted PCR composite doesn't match the PCR values")
+	}
+
+	qi, err := tpmutil.Pack(quoteInfo2{
+		Tag:          tagQuoteInfo2,
+		Fixed:        fixedQuote2,
+		ExternalData: sha1.Sum(data),
+		InfoShort:    info,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(qi, q.VersionInfo...), nil
+}
+
+// VerifyQuote2 verifies a quote returned by Quote2Signed for the given data
+// against a given set of PCR values, for a key using the PKCS#1 v1.5 SHA1
+// signature scheme.
+func VerifyQuote2(pk *rsa.PublicKey, data []byte, q *SignedQuote2, pcrNums []int, pcrs []byte) error {
+	p, err := NewQuoteInfo2(data, q, pcrNums, pcrs)
+	if err != nil {
+		return err
+	}
+
+	s := sha1.Sum(p)
+	return rsa.VerifyPKCS1v15(pk, crypto.SHA1, s[:], q.Signature)
+}
+
+// newAuditSignInfo computes the signInfo structure signed by
+// TPM_GetAuditDigestSigned.
+func newAuditSignInfo(antiReplay Nonce, sad *SignedAuditDigest) ([]byte, error) {
+	data, err := tpmutil.Pack(sad.Digest, sad.Counter, sad.OrdinalDigest)
+	if err != nil {
+		return nil, err
+	}
+	return tpmutil.Pack(signInfo{
+		Tag:    tagSignInfo,
+		Fixed:  fixedAuditDigest,
+		Replay: antiReplay,
+		Data:   data,
+	})
+}
+
+// VerifyAuditDigestSigned verifies the signature returned by
+// GetAuditDigestSigned, for a key using one of the PKCS#1 v1.5 SHA1 signature
+// schemes.
+func VerifyAuditDigestSigned(pk *rsa.PublicKey, antiReplay Nonce, sad *SignedAuditDigest) error {
+	p, err := newAuditSignInfo(antiReplay, sad)
+	if err != nil {
+		return err
+	}
+
+	s := sha1.Sum(p)
+	return rsa.VerifyPKCS1v15(pk, crypto.SHA1, s[:], sad.Signature)
+}
+
+// VerifyTickStamp verifies the signature returned by TickStampBlob over the
+// given digest and tick counter value, for a key using one of the PKCS#1 v1.5
+// SHA1 signature schemes.
+func VerifyTickStamp(pk *rsa.PublicKey, antiReplay Nonce, digest Digest, ticks *CurrentTicks, sig []byte) error {
+	data, err := tpmutil.Pack(digest, ticks)
+	if err != nil {
+		return err
+	}
+	p, err := tpmutil.Pack(signInfo{
+		Tag:    tagSignInfo,
+		Fixed:  fixedTickStamp,
+		Replay: antiReplay,
+		Data:   data,
+	})
+	if err != nil {
+		return err
+	}
+
+	s := sha1.Sum(p)
+	return rsa.VerifyPKCS1v15(pk, crypto.SHA1, s[:], sig)
+}
+
 // TODO(tmroeder): handle key12
@@ -65,7 +65,7 @@ func auditCPHash[R any](cc TPMCC, h TPMIAlgHash, c Command[R, *R]) ([]byte, erro
 	if err != nil {
 		return nil, err
 	}
-	parms, err := cmdParameters(c, nil)
+	parms, err := cmdParameters(c, nil, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -76,6 +76,16 @@ func auditCPHash[R any](cc TPMCC, h TPMIAlgHash, c Command[R, *R]) ([]byte, erro
 // the given hash algorithm. The command is assumed to be successful and to not
 // have any encrypt sessions.
 func auditRPHash(cc TPMCC, h TPMIAlgHash, r any) ([]byte, error) {
+	parms, err := rspParameterBytes(r)
+	if err != nil {
+		return nil, err
+	}
+	return rpHash(h, TPMRCSuccess, cc, parms)
+}
+
+// rspParameterBytes marshals the parameters (everything but the handles) of
+// the response structure r points to, without any encryption.
+func rspParameterBytes(r any) ([]byte, error) {
 	var parms bytes.Buffer
 	parameters := taggedMembers(reflect.ValueOf(r).Elem(), "handle", true)
 	for i, parameter := range parameters {
@@ -83,5 +93,5 @@ func auditRPHash(cc TPMCC, h TPMIAlgHash, r any) ([]byte, error) {
 			return nil, fmt.Errorf("marshalling parameter %v: %w", i+1, err)
 		}
 	}
-	return rpHash(h, TPMRCSuccess, cc, parms.Bytes())
+	return parms.Bytes(), nil
 }
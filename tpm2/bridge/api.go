@@ -0,0 +1,285 @@
+package bridge
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// GetRandomRequest is the body of a /v1/getrandom request.
+type GetRandomRequest struct {
+	// Bytes is the number of random bytes to return.
+	Bytes int `json:"bytes"`
+}
+
+// GetRandomResponse is the body of a /v1/getrandom response.
+type GetRandomResponse struct {
+	Random []byte `json:"random"`
+}
+
+// PCRReadRequest is the body of a /v1/pcrread request.
+type PCRReadRequest struct {
+	// Selection is a PCR selection in the format accepted by
+	// tpm2.ParsePCRSelection, such as "sha256:0-7".
+	Selection string `json:"selection"`
+}
+
+// PCRReadResponse is the body of a /v1/pcrread response.
+type PCRReadResponse struct {
+	// PCRs maps each bank's hash algorithm to its PCR values.
+	PCRs map[tpm2.TPMIAlgHash]tpm2.PCRBankValues `json:"pcrs"`
+}
+
+// QuoteRequest is the body of a /v1/quote request.
+type QuoteRequest struct {
+	// Key is the name of the signing key.
+	Key string `json:"key"`
+	// Selection is the PCR selection to quote.
+	Selection string `json:"selection"`
+	// Nonce is the qualifying data to include in the quote.
+	Nonce []byte `json:"nonce"`
+}
+
+// QuoteResponse is the body of a /v1/quote response.
+type QuoteResponse struct {
+	// Quoted is the marshalled TPMS_ATTEST that was signed.
+	Quoted []byte `json:"quoted"`
+	// Signature is the marshalled TPMT_SIGNATURE over Quoted.
+	Signature []byte `json:"signature"`
+}
+
+// SealRequest is the body of a /v1/seal request.
+type SealRequest struct {
+	// Key is the name of the storage key to seal under.
+	Key string `json:"key"`
+	// Data is the data to seal.
+	Data []byte `json:"data"`
+	// Selection, if set, binds the sealed data to the current values of
+	// these PCRs.
+	Selection string `json:"selection,omitempty"`
+}
+
+// SealResponse is the body of a /v1/seal response. The sealed object is only
+// usable by this TPM.
+type SealResponse struct {
+	// Public is the marshalled TPM2B_PUBLIC of the sealed object.
+	Public []byte `json:"public"`
+	// Private is the marshalled TPM2B_PRIVATE of the sealed object.
+	Private []byte `json:"private"`
+}
+
+// UnsealRequest is the body of a /v1/unseal request.
+type UnsealRequest struct {
+	// Key is the name of the storage key the data was sealed under.
+	Key string `json:"key"`
+	// Public and Private are the sealed object returned by /v1/seal.
+	Public  []byte `json:"public"`
+	Private []byte `json:"private"`
+	// Selection is the PCR selection the data was sealed to, if any.
+	Selection string `json:"selection,omitempty"`
+}
+
+// UnsealResponse is the body of a /v1/unseal response.
+type UnsealResponse struct {
+	Data []byte `json:"data"`
+}
+
+func (s *Server) getRandom(req *GetRandomRequest) (*GetRandomResponse, error) {
+	if req.Bytes <= 0 || req.Bytes > maxRandomBytes {
+		return nil, badRequest("bytes must be between 1 and %d", maxRandomBytes)
+	}
+	out := make([]byte, 0, req.Bytes)
+	for len(out) < req.Bytes {
+		// The TPM may return fewer bytes than requested.
+		rsp, err := tpm2.GetRandom{BytesRequested: uint16(req.Bytes - len(out))}.Execute(s.tpm)
+		if err != nil {
+			return nil, err
+		}
+		if len(rsp.RandomBytes.Buffer) == 0 {
+			return nil, fmt.Errorf("TPM returned no random bytes")
+		}
+		out = append(out, rsp.RandomBytes.Buffer...)
+	}
+	return &GetRandomResponse{Random: out[:req.Bytes]}, nil
+}
+
+func (s *Server) pcrRead(req *PCRReadRequest) (*PCRReadResponse, error) {
+	sel, err := parseSelection(req.Selection)
+	if err != nil {
+		return nil, err
+	}
+	if sel == nil {
+		return nil, badRequest("a PCR selection is required")
+	}
+	vals, err := tpm2.ReadPCRs(s.tpm, *sel)
+	if err != nil {
+		return nil, err
+	}
+	return &PCRReadResponse{PCRs: vals}, nil
+}
+
+func (s *Server) quote(req *QuoteRequest) (*QuoteResponse, error) {
+	k, err := s.key(req.Key)
+	if err != nil {
+		return nil, err
+	}
+	sel, err := parseSelection(req.Selection)
+	if err != nil {
+		return nil, err
+	}
+	if sel == nil {
+		return nil, badRequest("a PCR selection is required")
+	}
+	rsp, err := tpm2.Quote{
+		SignHandle:     k,
+		QualifyingData: tpm2.TPM2BData{Buffer: req.Nonce},
+		InScheme:       tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+		PCRSelect:      *sel,
+	}.Execute(s.tpm)
+	if err != nil {
+		return nil, err
+	}
+	return &QuoteResponse{
+		Quoted:    rsp.Quoted.Bytes(),
+		Signature: tpm2.Marshal(rsp.Signature),
+	}, nil
+}
+
+// pcrPolicy returns the digest, using alg, of a policy requiring the PCRs in
+// sel to have their current values.
+func (s *Server) pcrPolicy(alg tpm2.TPMIAlgHash, sel *tpm2.TPMLPCRSelection) ([]byte, error) {
+	vals, err := tpm2.ReadPCRs(s.tpm, *sel)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := tpm2.PCRCompositeDigest(alg, *sel, vals)
+	if err != nil {
+		return nil, err
+	}
+	pol, err := tpm2.NewPolicyCalculator(alg)
+	if err != nil {
+		return nil, err
+	}
+	policyPCR := tpm2.PolicyPCR{
+		PcrDigest: tpm2.TPM2BDigest{Buffer: digest},
+		Pcrs:      *sel,
+	}
+	if err := policyPCR.Update(pol); err != nil {
+		return nil, err
+	}
+	return pol.Hash().Digest, nil
+}
+
+func (s *Server) seal(req *SealRequest) (*SealResponse, error) {
+	if len(req.Data) > maxSealSize {
+		return nil, badRequest("data must be at most %d bytes", maxSealSize)
+	}
+	k, err := s.key(req.Key)
+	if err != nil {
+		return nil, err
+	}
+	sel, err := parseSelection(req.Selection)
+	if err != nil {
+		return nil, err
+	}
+	nameAlg, err := tpm2.NameHashAlg(k.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := tpm2.TPMTPublic{
+		Type:    tpm2.TPMAlgKeyedHash,
+		NameAlg: nameAlg,
+		ObjectAttributes: tpm2.TPMAObject{
+			FixedTPM:    true,
+			FixedParent: true,
+			NoDA:        true,
+		},
+	}
+	if sel != nil {
+		policy, err := s.pcrPolicy(pub.NameAlg, sel)
+		if err != nil {
+			return nil, err
+		}
+		pub.AuthPolicy = tpm2.TPM2BDigest{Buffer: policy}
+	} else {
+		pub.ObjectAttributes.UserWithAuth = true
+	}
+
+	rsp, err := tpm2.Create{
+		ParentHandle: k,
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				Data: tpm2.NewTPMUSensitiveCreate(&tpm2.TPM2BSensitiveData{
+					Buffer: req.Data,
+				}),
+			},
+		},
+		InPublic: tpm2.New2B(pub),
+	}.Execute(s.tpm)
+	if err != nil {
+		return nil, err
+	}
+	return &SealResponse{
+		Public:  tpm2.Marshal(rsp.OutPublic),
+		Private: tpm2.Marshal(rsp.OutPrivate),
+	}, nil
+}
+
+func (s *Server) unseal(req *UnsealRequest) (*UnsealResponse, error) {
+	k, err := s.key(req.Key)
+	if err != nil {
+		return nil, err
+	}
+	sel, err := parseSelection(req.Selection)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := tpm2.Unmarshal[tpm2.TPM2BPublic](req.Public)
+	if err != nil {
+		return nil, badRequest("invalid public area: %v", err)
+	}
+	contents, err := pub.Contents()
+	if err != nil {
+		return nil, badRequest("invalid public area: %v", err)
+	}
+	priv, err := tpm2.Unmarshal[tpm2.TPM2BPrivate](req.Private)
+	if err != nil {
+		return nil, badRequest("invalid private area: %v", err)
+	}
+
+	loaded, err := tpm2.Load{
+		ParentHandle: k,
+		InPublic:     *pub,
+		InPrivate:    *priv,
+	}.Execute(s.tpm)
+	if err != nil {
+		return nil, err
+	}
+	defer tpm2.FlushContext{FlushHandle: loaded.ObjectHandle}.Execute(s.tpm)
+
+	auth := tpm2.PasswordAuth(nil)
+	if sel != nil {
+		sess, cleanup, err := tpm2.PolicySession(s.tpm, contents.NameAlg, 16)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		if _, err := (tpm2.PolicyPCR{PolicySession: sess.Handle(), Pcrs: *sel}).Execute(s.tpm); err != nil {
+			return nil, err
+		}
+		auth = sess
+	}
+
+	rsp, err := tpm2.Unseal{
+		ItemHandle: tpm2.AuthHandle{
+			Handle: loaded.ObjectHandle,
+			Name:   loaded.Name,
+			Auth:   auth,
+		},
+	}.Execute(s.tpm)
+	if err != nil {
+		return nil, err
+	}
+	return &UnsealResponse{Data: rsp.OutData.Buffer}, nil
+}
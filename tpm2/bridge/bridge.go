@@ -0,0 +1,184 @@
+// Package bridge exposes a constrained subset of the TPM over authenticated
+// HTTP, for processes that cannot open the TPM device themselves.
+//
+// Only the following operations are offered, all as POST requests with JSON
+// bodies:
+//
+//	/v1/getrandom  random bytes
+//	/v1/pcrread    PCR values
+//	/v1/quote      a quote signed by a named key
+//	/v1/seal       seal data under a named storage key, optionally to PCRs
+//	/v1/unseal     unseal data sealed by /v1/seal
+//
+// Keys are referred to by the names configured on the Server, so clients can
+// never use an arbitrary handle in the TPM.
+package bridge
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+const (
+	// maxRequestSize is the largest request body the server accepts.
+	maxRequestSize = 64 << 10
+	// maxRandomBytes is the most random bytes a single request may ask for.
+	maxRandomBytes = 4096
+	// maxSealSize is the most data a single request may seal: the size of
+	// a TPM2B_SENSITIVE_DATA on PC Client TPMs.
+	maxSealSize = 128
+)
+
+var (
+	// ErrUnauthenticated is returned by an Authenticator to reject a request.
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// errUnknownKey is returned when a request names a key that is not
+	// configured.
+	errUnknownKey = errors.New("unknown key")
+)
+
+// An Authenticator decides whether a request may use the TPM. It returns nil
+// to allow the request.
+type Authenticator func(r *http.Request) error
+
+// BearerToken returns an Authenticator that accepts requests carrying the
+// given token in an "Authorization: Bearer" header.
+func BearerToken(token string) Authenticator {
+	want := []byte("Bearer " + token)
+	return func(r *http.Request) error {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			return ErrUnauthenticated
+		}
+		return nil
+	}
+}
+
+// Key is a key that clients may use by name.
+type Key struct {
+	// Handle is the (usually persistent) handle of the key.
+	Handle tpm2.TPMHandle
+	// Auth is the authorization value of the key.
+	Auth []byte
+}
+
+// Server is an http.Handler that serves the bridge API.
+type Server struct {
+	tpm  transport.TPM
+	auth Authenticator
+	keys map[string]Key
+	mux  *http.ServeMux
+
+	// mu serializes access to the TPM.
+	mu sync.Mutex
+}
+
+// NewServer returns a Server that uses t for all requests that are allowed
+// by auth. keys are the keys available to clients for quoting and sealing.
+func NewServer(t transport.TPM, auth Authenticator, keys map[string]Key) (*Server, error) {
+	if auth == nil {
+		return nil, errors.New("an Authenticator is required")
+	}
+	s := &Server{
+		tpm:  t,
+		auth: auth,
+		keys: keys,
+		mux:  http.NewServeMux(),
+	}
+	s.mux.HandleFunc("POST /v1/getrandom", handle(s, (*Server).getRandom))
+	s.mux.HandleFunc("POST /v1/pcrread", handle(s, (*Server).pcrRead))
+	s.mux.HandleFunc("POST /v1/quote", handle(s, (*Server).quote))
+	s.mux.HandleFunc("POST /v1/seal", handle(s, (*Server).seal))
+	s.mux.HandleFunc("POST /v1/unseal", handle(s, (*Server).unseal))
+	return s, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.auth(r); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// requestError is an error caused by a bad request, as opposed to a failure
+// of the TPM.
+type requestError struct {
+	err error
+}
+
+func (e requestError) Error() string { return e.err.Error() }
+
+func badRequest(format string, args ...interface{}) error {
+	return requestError{fmt.Errorf(format, args...)}
+}
+
+// handle adapts a typed handler method to an http.HandlerFunc that decodes
+// the JSON request, runs the handler with the TPM locked and encodes the
+// JSON response.
+func handle[Req, Rsp any](s *Server, h func(*Server, *Req) (*Rsp, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("decoding request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		rsp, err := h(s, &req)
+		s.mu.Unlock()
+
+		var reqErr requestError
+		switch {
+		case errors.As(err, &reqErr):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rsp)
+	}
+}
+
+// key looks up a configured key by name, and returns a handle to it that
+// authorizes with the key's password.
+func (s *Server) key(name string) (tpm2.AuthHandle, error) {
+	k, ok := s.keys[name]
+	if !ok {
+		return tpm2.AuthHandle{}, requestError{fmt.Errorf("%w %q", errUnknownKey, name)}
+	}
+	pub, err := tpm2.ReadPublic{ObjectHandle: k.Handle}.Execute(s.tpm)
+	if err != nil {
+		return tpm2.AuthHandle{}, fmt.Errorf("reading key %q: %w", name, err)
+	}
+	return tpm2.AuthHandle{
+		Handle: k.Handle,
+		Name:   pub.Name,
+		Auth:   tpm2.PasswordAuth(k.Auth),
+	}, nil
+}
+
+// parseSelection parses an optional PCR selection.
+func parseSelection(sel string) (*tpm2.TPMLPCRSelection, error) {
+	if strings.TrimSpace(sel) == "" {
+		return nil, nil
+	}
+	pcrs, err := tpm2.ParsePCRSelection(sel)
+	if err != nil {
+		return nil, requestError{err}
+	}
+	return pcrs, nil
+}
@@ -0,0 +1,206 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+const testToken = "s3cr3t"
+
+func createPrimary(t *testing.T, thetpm transport.TPM, pub tpm2.TPMTPublic) tpm2.TPMHandle {
+	t.Helper()
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(pub),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("could not create primary key: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := (tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}).Execute(thetpm); err != nil {
+			t.Errorf("could not flush primary key: %v", err)
+		}
+	})
+	return rsp.ObjectHandle
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, transport.TPM) {
+	t.Helper()
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	t.Cleanup(func() { thetpm.Close() })
+
+	srk := createPrimary(t, thetpm, tpm2.ECCSRKTemplate)
+	ak := createPrimary(t, thetpm, tpm2.TPMTPublic{
+		Type:    tpm2.TPMAlgECC,
+		NameAlg: tpm2.TPMAlgSHA256,
+		ObjectAttributes: tpm2.TPMAObject{
+			FixedTPM:            true,
+			FixedParent:         true,
+			SensitiveDataOrigin: true,
+			UserWithAuth:        true,
+			SignEncrypt:         true,
+			Restricted:          true,
+		},
+		Parameters: tpm2.NewTPMUPublicParms(
+			tpm2.TPMAlgECC,
+			&tpm2.TPMSECCParms{
+				Scheme: tpm2.TPMTECCScheme{
+					Scheme: tpm2.TPMAlgECDSA,
+					Details: tpm2.NewTPMUAsymScheme(
+						tpm2.TPMAlgECDSA,
+						&tpm2.TPMSSigSchemeECDSA{HashAlg: tpm2.TPMAlgSHA256},
+					),
+				},
+				CurveID: tpm2.TPMECCNistP256,
+			},
+		),
+	})
+
+	s, err := NewServer(thetpm, BearerToken(testToken), map[string]Key{
+		"srk": {Handle: srk},
+		"ak":  {Handle: ak},
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return ts, thetpm
+}
+
+// call posts req to path and decodes the response into rsp, returning the
+// HTTP status code.
+func call(t *testing.T, ts *httptest.Server, token, path string, req, rsp interface{}) int {
+	t.Helper()
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	r, err := http.NewRequest(http.MethodPost, ts.URL+path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("http.NewRequest: %v", err)
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	resp, err := ts.Client().Do(r)
+	if err != nil {
+		t.Fatalf("POST %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(rsp); err != nil {
+			t.Fatalf("decoding %s response: %v", path, err)
+		}
+	} else {
+		msg, _ := io.ReadAll(resp.Body)
+		t.Logf("POST %s: %d %s", path, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return resp.StatusCode
+}
+
+func TestAuthentication(t *testing.T) {
+	ts, _ := newTestServer(t)
+	var rsp GetRandomResponse
+	if code := call(t, ts, "wrong", "/v1/getrandom", GetRandomRequest{Bytes: 8}, &rsp); code != http.StatusUnauthorized {
+		t.Errorf("getrandom with the wrong token returned %d, want %d", code, http.StatusUnauthorized)
+	}
+	if _, err := NewServer(nil, nil, nil); err == nil {
+		t.Error("NewServer accepted a nil Authenticator")
+	}
+}
+
+func TestGetRandom(t *testing.T) {
+	ts, _ := newTestServer(t)
+	var rsp GetRandomResponse
+	if code := call(t, ts, testToken, "/v1/getrandom", GetRandomRequest{Bytes: 100}, &rsp); code != http.StatusOK {
+		t.Fatalf("getrandom returned %d", code)
+	}
+	if len(rsp.Random) != 100 {
+		t.Errorf("getrandom returned %d bytes, want 100", len(rsp.Random))
+	}
+	if code := call(t, ts, testToken, "/v1/getrandom", GetRandomRequest{Bytes: maxRandomBytes + 1}, &rsp); code != http.StatusBadRequest {
+		t.Errorf("oversized getrandom returned %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestPCRReadAndQuote(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	var pcrs PCRReadResponse
+	if code := call(t, ts, testToken, "/v1/pcrread", PCRReadRequest{Selection: "sha256:0-3"}, &pcrs); code != http.StatusOK {
+		t.Fatalf("pcrread returned %d", code)
+	}
+	if got := len(pcrs.PCRs[tpm2.TPMAlgSHA256]); got != 4 {
+		t.Errorf("pcrread returned %d PCRs, want 4", got)
+	}
+
+	nonce := []byte("nonce")
+	var quote QuoteResponse
+	if code := call(t, ts, testToken, "/v1/quote", QuoteRequest{Key: "ak", Selection: "sha256:0-3", Nonce: nonce}, &quote); code != http.StatusOK {
+		t.Fatalf("quote returned %d", code)
+	}
+	attest, err := tpm2.Unmarshal[tpm2.TPMSAttest](quote.Quoted)
+	if err != nil {
+		t.Fatalf("unmarshalling quote: %v", err)
+	}
+	if !bytes.Equal(attest.ExtraData.Buffer, nonce) {
+		t.Errorf("quote nonce = %x, want %x", attest.ExtraData.Buffer, nonce)
+	}
+	if _, err := tpm2.Unmarshal[tpm2.TPMTSignature](quote.Signature); err != nil {
+		t.Errorf("unmarshalling signature: %v", err)
+	}
+
+	if code := call(t, ts, testToken, "/v1/quote", QuoteRequest{Key: "nope", Selection: "sha256:0"}, &quote); code != http.StatusBadRequest {
+		t.Errorf("quote with an unknown key returned %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestSealUnseal(t *testing.T) {
+	ts, thetpm := newTestServer(t)
+	secret := []byte("secrets")
+
+	for _, sel := range []string{"", "sha256:16"} {
+		var sealed SealResponse
+		if code := call(t, ts, testToken, "/v1/seal", SealRequest{Key: "srk", Data: secret, Selection: sel}, &sealed); code != http.StatusOK {
+			t.Fatalf("seal(%q) returned %d", sel, code)
+		}
+		req := UnsealRequest{Key: "srk", Public: sealed.Public, Private: sealed.Private, Selection: sel}
+		var unsealed UnsealResponse
+		if code := call(t, ts, testToken, "/v1/unseal", req, &unsealed); code != http.StatusOK {
+			t.Fatalf("unseal(%q) returned %d", sel, code)
+		}
+		if !bytes.Equal(unsealed.Data, secret) {
+			t.Errorf("unseal(%q) = %q, want %q", sel, unsealed.Data, secret)
+		}
+	}
+
+	// Data too large for the TPM is the client's fault.
+	var tooLarge SealResponse
+	if code := call(t, ts, testToken, "/v1/seal", SealRequest{Key: "srk", Data: make([]byte, maxSealSize+1)}, &tooLarge); code != http.StatusBadRequest {
+		t.Errorf("seal of %d bytes returned %d, want %d", maxSealSize+1, code, http.StatusBadRequest)
+	}
+
+	// Data sealed to a PCR can't be unsealed once the PCR changes.
+	var sealed SealResponse
+	if code := call(t, ts, testToken, "/v1/seal", SealRequest{Key: "srk", Data: secret, Selection: "sha256:16"}, &sealed); code != http.StatusOK {
+		t.Fatalf("seal returned %d", code)
+	}
+	if _, err := tpm2.ExtendPCR(thetpm, tpm2.TPMHandle(16), []byte("event")); err != nil {
+		t.Fatalf("ExtendPCR: %v", err)
+	}
+	req := UnsealRequest{Key: "srk", Public: sealed.Public, Private: sealed.Private, Selection: "sha256:16"}
+	var unsealed UnsealResponse
+	if code := call(t, ts, testToken, "/v1/unseal", req, &unsealed); code == http.StatusOK {
+		t.Error("unseal succeeded after the PCR changed")
+	}
+}
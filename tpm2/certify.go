@@ -0,0 +1,158 @@
+package tpm2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrCertifyMismatch is returned by the Verify*Certify* functions when a
+// correctly signed attestation is not about the expected object.
+var ErrCertifyMismatch = errors.New("attestation does not certify the object")
+
+// VerifyCertify checks that rsp, the response to a TPM2_Certify with
+// qualifyingData, is ak's signature over a certification of the object
+// pub, and returns the certification. The caller must check that ak is a
+// trusted attestation key.
+func VerifyCertify(ak *TPMTPublic, rsp *CertifyResponse, pub *TPMTPublic, qualifyingData []byte) (*TPMSCertifyInfo, error) {
+	attest, err := verifyCertification(ak, &rsp.CertifyInfo, &rsp.Signature, TPMSTAttestCertify, qualifyingData)
+	if err != nil {
+		return nil, err
+	}
+	info, err := attest.Attested.Certify()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkObjectName(pub, &info.Name); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// VerifyCertifyCreation checks that rsp, the response to a
+// TPM2_CertifyCreation with qualifyingData, is ak's signature over a
+// certification that the TPM created the object pub with creationData, as
+// returned by TPM2_Create or TPM2_CreatePrimary, and returns the
+// certification. The caller must check that ak is a trusted attestation key
+// and that creationData, such as its PCR digest and parent, is as expected.
+func VerifyCertifyCreation(ak *TPMTPublic, rsp *CertifyCreationResponse, pub *TPMTPublic, creationData *TPMSCreationData, qualifyingData []byte) (*TPMSCreationInfo, error) {
+	attest, err := verifyCertification(ak, &rsp.CertifyInfo, &rsp.Signature, TPMSTAttestCreation, qualifyingData)
+	if err != nil {
+		return nil, err
+	}
+	info, err := attest.Attested.Creation()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkObjectName(pub, &info.ObjectName); err != nil {
+		return nil, err
+	}
+	ha, err := pub.NameAlg.Hash()
+	if err != nil {
+		return nil, err
+	}
+	h := ha.New()
+	h.Write(Marshal(creationData))
+	if !bytes.Equal(h.Sum(nil), info.CreationHash.Buffer) {
+		return nil, fmt.Errorf("%w: creation data does not match", ErrCertifyMismatch)
+	}
+	return info, nil
+}
+
+// VerifyNVCertify checks that rsp, the response to a TPM2_NV_Certify with
+// qualifyingData and a nonzero size, is ak's signature over the contents of
+// the NV index nvPub, and returns the certification, whose NVContents and
+// Offset are the certified bytes and where they start. nvPub must be the
+// index's public area as it was when certified: its Name changes when the
+// index is first written. The caller must check that ak is a trusted
+// attestation key.
+func VerifyNVCertify(ak *TPMTPublic, rsp *NVCertifyResponse, nvPub *TPMSNVPublic, qualifyingData []byte) (*TPMSNVCertifyInfo, error) {
+	attest, err := verifyCertification(ak, &rsp.CertifyInfo, &rsp.Signature, TPMSTAttestNV, qualifyingData)
+	if err != nil {
+		return nil, err
+	}
+	info, err := attest.Attested.NV()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNVName(nvPub, &info.IndexName); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// VerifyNVDigestCertify is like VerifyNVCertify for a TPM2_NV_Certify with
+// a size and offset of zero, for which the TPM certifies a digest of the
+// whole index, with the signing scheme's hash algorithm, rather than its
+// contents.
+func VerifyNVDigestCertify(ak *TPMTPublic, rsp *NVCertifyResponse, nvPub *TPMSNVPublic, qualifyingData []byte) (*TPMSNVDigestCertifyInfo, error) {
+	attest, err := verifyCertification(ak, &rsp.CertifyInfo, &rsp.Signature, TPMSTAttestNVDigest, qualifyingData)
+	if err != nil {
+		return nil, err
+	}
+	info, err := attest.Attested.NVDigest()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNVName(nvPub, &info.IndexName); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// VerifyGetTime checks that rsp, the response to a TPM2_GetTime with
+// qualifyingData, is ak's signature over the TPM's time and clock, and
+// returns them. The reset and restart counts in the attestation's header
+// are obfuscated for keys outside the endorsement and platform hierarchies;
+// the ones returned here never are, which is why TPM2_GetTime needs the
+// privacy administrator's authorization. The caller must check that ak is a
+// trusted attestation key.
+func VerifyGetTime(ak *TPMTPublic, rsp *GetTimeResponse, qualifyingData []byte) (*TPMSTimeAttestInfo, error) {
+	attest, err := verifyCertification(ak, &rsp.TimeInfo, &rsp.Signature, TPMSTAttestTime, qualifyingData)
+	if err != nil {
+		return nil, err
+	}
+	return attest.Attested.Time()
+}
+
+// verifyCertification verifies ak's signature over attest and checks its
+// type and extra data.
+func verifyCertification(ak *TPMTPublic, attest *TPM2BAttest, sig *TPMTSignature, typ TPMST, qualifyingData []byte) (*TPMSAttest, error) {
+	contents, err := VerifyAttestation(ak, attest, sig)
+	if err != nil {
+		return nil, err
+	}
+	if contents.Type != typ {
+		return nil, fmt.Errorf("%w: attestation type %#x, want %#x", ErrCertifyMismatch, contents.Type, typ)
+	}
+	if !bytes.Equal(contents.ExtraData.Buffer, qualifyingData) {
+		return nil, fmt.Errorf("%w: qualifying data does not match", ErrCertifyMismatch)
+	}
+	return contents, nil
+}
+
+// checkObjectName checks that name is the Name of pub.
+func checkObjectName(pub *TPMTPublic, name *TPM2BName) error {
+	want, err := ObjectName(pub)
+	if err != nil {
+		return err
+	}
+	return checkName(name, want)
+}
+
+// checkNVName checks that name is the Name of the NV index nvPub.
+func checkNVName(nvPub *TPMSNVPublic, name *TPM2BName) error {
+	want, err := NVName(nvPub)
+	if err != nil {
+		return err
+	}
+	return checkName(name, want)
+}
+
+// checkName checks that a certified Name is the expected one.
+func checkName(name, want *TPM2BName) error {
+	if !bytes.Equal(name.Buffer, want.Buffer) {
+		return fmt.Errorf("%w: certified Name %x, want %x", ErrCertifyMismatch, name.Buffer, want.Buffer)
+	}
+	return nil
+}
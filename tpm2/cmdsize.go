@@ -0,0 +1,196 @@
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrCommandTooLarge is returned by CheckCommandSize for commands larger than
+// the TPM accepts.
+var ErrCommandTooLarge = errors.New("command is larger than the TPM accepts")
+
+// maxAuthSize bounds the size of a TPMS_AUTH_COMMAND from a session whose
+// type is unknown: a handle, attributes, and a nonce and HMAC of at most the
+// size of the largest digest.
+const maxAuthSize = 4 + 2 + 64 + 1 + 2 + 64
+
+// CommandLimits are the sizes a TPM accepts for commands and for the buffers
+// in them. A zero field means no limit.
+type CommandLimits struct {
+	// MaxCommandSize is TPM_PT_MAX_COMMAND_SIZE, the size of the largest
+	// command.
+	MaxCommandSize int
+	// InputBuffer is TPM_PT_INPUT_BUFFER, the size of the largest
+	// TPM2B_MAX_BUFFER, as in TPM2_SequenceUpdate.
+	InputBuffer int
+	// NVBufferMax is TPM_PT_NV_BUFFER_MAX, the size of the largest
+	// TPM2B_MAX_NV_BUFFER, as in TPM2_NV_Write.
+	NVBufferMax int
+}
+
+// GetCommandLimits reads the TPM's command and buffer size limits.
+func GetCommandLimits(t transport.TPM) (*CommandLimits, error) {
+	props, err := getProperties(t, TPMPTInputBuffer, TPMPTNVBufferMax)
+	if err != nil {
+		return nil, fmt.Errorf("reading command limits: %w", err)
+	}
+	var l CommandLimits
+	for _, p := range props {
+		switch p.Property {
+		case TPMPTInputBuffer:
+			l.InputBuffer = int(p.Value)
+		case TPMPTMaxCommandSize:
+			l.MaxCommandSize = int(p.Value)
+		case TPMPTNVBufferMax:
+			l.NVBufferMax = int(p.Value)
+		}
+	}
+	return &l, nil
+}
+
+// CommandSize returns the size of cmd once encoded, with its authorization
+// area for the sessions of its auth handles and sess. The size is exact for
+// password authorization and for HMAC and policy sessions of this package;
+// for other sessions, it allows for the largest nonce and HMAC. Parameter
+// encryption doesn't change the size of a command.
+func CommandSize[R any](cmd Command[R, *R], sess ...Session) (int, error) {
+	auths, err := cmdAuths(cmd)
+	if err != nil {
+		return 0, err
+	}
+	auths = append(auths, sess...)
+	handles, err := cmdHandles(cmd)
+	if err != nil {
+		return 0, err
+	}
+	parms, err := cmdParameters(cmd, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	size := 10 /* size of command header */ + len(handles) + len(parms)
+	if len(auths) != 0 {
+		size += 4 // size of the authorization area
+		for _, s := range auths {
+			size += authSize(s)
+		}
+	}
+	return size, nil
+}
+
+// authSize returns the size of the TPMS_AUTH_COMMAND s contributes to a
+// command.
+func authSize(s Session) int {
+	const fixed = 4 + 2 + 1 + 2 // handle, nonce size, attributes, HMAC size
+	switch s := s.(type) {
+	case *pwSession:
+		return fixed + len(s.auth)
+	case *hmacSession:
+		return fixed + s.nonceSize + digestSize(s.hash)
+	case *policySession:
+		// With PolicyPassword, the HMAC field holds the auth value.
+		if s.password {
+			return fixed + s.nonceSize + max(len(s.auth), digestSize(s.hash))
+		}
+		return fixed + s.nonceSize + digestSize(s.hash)
+	}
+	return maxAuthSize
+}
+
+// digestSize returns the size of a digest made with hash, or of the largest
+// digest if hash is unknown.
+func digestSize(hash TPMIAlgHash) int {
+	if h, err := hash.Hash(); err == nil {
+		return h.Size()
+	}
+	return 64
+}
+
+// CheckCommandSize returns an error wrapping ErrCommandTooLarge if cmd, with
+// sess, is larger than limits.MaxCommandSize. Checking before sending lets
+// callers split or refuse the command rather than have the TPM fail it with
+// TPM_RC_COMMAND_SIZE.
+func CheckCommandSize[R any](cmd Command[R, *R], limits *CommandLimits, sess ...Session) error {
+	size, err := CommandSize(cmd, sess...)
+	if err != nil {
+		return err
+	}
+	if limits.MaxCommandSize != 0 && size > limits.MaxCommandSize {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrCommandTooLarge, size, limits.MaxCommandSize)
+	}
+	return nil
+}
+
+// chunkSize returns how much data each of a split command's chunks may hold,
+// given the size of the command with no data and the buffer limit.
+func chunkSize(empty int, limits *CommandLimits, bufferLimit int) (int, error) {
+	n := bufferLimit
+	if limits.MaxCommandSize != 0 {
+		if room := limits.MaxCommandSize - empty; n == 0 || room < n {
+			n = room
+		}
+	}
+	if n <= 0 && (limits.MaxCommandSize != 0 || bufferLimit != 0) {
+		return 0, fmt.Errorf("%w: %d bytes without data, limit %d", ErrCommandTooLarge, empty, limits.MaxCommandSize)
+	}
+	return n, nil
+}
+
+// SplitSequenceUpdate splits cmd into TPM2_SequenceUpdate commands that each
+// fit in limits, with sess, and together add the same data to the sequence.
+func SplitSequenceUpdate(cmd SequenceUpdate, limits *CommandLimits, sess ...Session) ([]SequenceUpdate, error) {
+	data := cmd.Buffer.Buffer
+	cmd.Buffer.Buffer = nil
+	empty, err := CommandSize(cmd, sess...)
+	if err != nil {
+		return nil, err
+	}
+	n, err := chunkSize(empty, limits, limits.InputBuffer)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 || len(data) <= n {
+		cmd.Buffer.Buffer = data
+		return []SequenceUpdate{cmd}, nil
+	}
+	var cmds []SequenceUpdate
+	for len(data) > 0 {
+		chunk := cmd
+		chunk.Buffer.Buffer = data[:min(n, len(data))]
+		cmds = append(cmds, chunk)
+		data = data[len(chunk.Buffer.Buffer):]
+	}
+	return cmds, nil
+}
+
+// SplitNVWrite splits cmd into TPM2_NV_Write commands that each fit in
+// limits, with sess, and together write the same data at the same offset.
+func SplitNVWrite(cmd NVWrite, limits *CommandLimits, sess ...Session) ([]NVWrite, error) {
+	data := cmd.Data.Buffer
+	cmd.Data.Buffer = nil
+	empty, err := CommandSize(cmd, sess...)
+	if err != nil {
+		return nil, err
+	}
+	n, err := chunkSize(empty, limits, limits.NVBufferMax)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 || len(data) <= n {
+		cmd.Data.Buffer = data
+		return []NVWrite{cmd}, nil
+	}
+	if int(cmd.Offset)+len(data) > 0xffff {
+		return nil, fmt.Errorf("writing %d bytes at offset %d overflows the NV offset", len(data), cmd.Offset)
+	}
+	var cmds []NVWrite
+	for len(data) > 0 {
+		chunk := cmd
+		chunk.Data.Buffer = data[:min(n, len(data))]
+		cmds = append(cmds, chunk)
+		cmd.Offset += uint16(len(chunk.Data.Buffer))
+		data = data[len(chunk.Data.Buffer):]
+	}
+	return cmds, nil
+}
@@ -201,6 +201,12 @@ const (
 
 // TPMRC represents a TPM_RC.
 // See definition in Part 2: Structures, section 6.6.
+//
+// The error returned by a command's Execute method for a format-1 handle or
+// parameter error is not a bare TPMRC: it wraps the TPMRC along with the
+// name of the command field in error. Use errors.Is to compare it with a
+// TPMRC value, and errors.As to get the TPMRC or a TPMFmt1Error, rather than
+// a type assertion.
 type TPMRC uint32
 
 // TPMRC values come from Part 2: Structures, section 6.6.3.
@@ -311,6 +317,21 @@ const (
 	TPMRCNVUnavailable  TPMRC = rcWarn + 0x023
 )
 
+// TPMClockAdjust represents a TPM_CLOCK_ADJUST.
+// See definition in Part 2: Structures, section 6.7.
+type TPMClockAdjust int8
+
+// TPMClockAdjust values come from Part 2: Structures, section 6.7.
+const (
+	TPMClockCoarseSlower TPMClockAdjust = -3
+	TPMClockMediumSlower TPMClockAdjust = -2
+	TPMClockFineSlower   TPMClockAdjust = -1
+	TPMClockNoChange     TPMClockAdjust = 0
+	TPMClockFineFaster   TPMClockAdjust = 1
+	TPMClockMediumFaster TPMClockAdjust = 2
+	TPMClockCoarseFaster TPMClockAdjust = 3
+)
+
 // TPMEO represents a TPM_EO.
 // See definition in Part 2: Structures, section 6.8.
 type TPMEO uint16
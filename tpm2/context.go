@@ -0,0 +1,26 @@
+package tpm2
+
+import (
+	"context"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ExecuteContext executes cmd on t like cmd.Execute, with ctx. Once ctx is
+// done, no more commands are sent, including those that start or flush
+// just-in-time sessions in s. Whether a command that has been sent is
+// abandoned depends on t; see transport.WithContext. To be able to abandon
+// slow commands, such as CreatePrimary of an RSA key on a discrete TPM, send
+// every command through one ProgressReporter:
+//
+//	r := tpm2.NewProgressReporter(t, 0, nil)
+//	...
+//	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+//	defer cancel()
+//	rsp, err := tpm2.ExecuteContext(ctx, r, createPrimary)
+//
+// A command abandoned after the TPM ran it may leave objects or sessions
+// loaded; a resource manager flushes them when the connection is closed.
+func ExecuteContext[R any, PR *R](ctx context.Context, t transport.TPM, cmd Command[R, PR], s ...Session) (PR, error) {
+	return cmd.Execute(transport.WithContext(ctx, t), s...)
+}
@@ -0,0 +1,29 @@
+package tpm2
+
+import "fmt"
+
+// CreateCredential does in software what TPM2_MakeCredential does in a TPM:
+// it protects secret so that it can only be recovered with
+// TPM2_ActivateCredential, by the TPM holding the private part of ek, and
+// only for the loaded object with the given name. This lets a privacy CA or
+// enrollment server without a TPM of its own challenge a TPM to prove that
+// an attestation key lives alongside its EK. See Part 1, section 24.
+//
+// The secret can be no longer than a digest of ek's name algorithm.
+func CreateCredential(ek *TPMTPublic, name TPM2BName, secret []byte) (*MakeCredentialResponse, error) {
+	ha, err := ek.NameAlg.Hash()
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) > ha.Size() {
+		return nil, fmt.Errorf("credential of %d bytes is longer than a %v digest", len(secret), ek.NameAlg)
+	}
+	blob, seed, err := outerWrap(ek, "IDENTITY", &name, Marshal(TPM2BDigest{Buffer: secret}))
+	if err != nil {
+		return nil, err
+	}
+	return &MakeCredentialResponse{
+		CredentialBlob: TPM2BIDObject{Buffer: blob.Buffer},
+		Secret:         *seed,
+	}, nil
+}
@@ -0,0 +1,50 @@
+package tpm2
+
+import (
+	"crypto"
+	"crypto/hmac"
+)
+
+// CryptoProvider performs the host-side cryptography of HMAC and policy
+// sessions: encrypting the salt sent in TPM2_StartAuthSession, deriving the
+// session key and parameter encryption keys, and computing authorization
+// HMACs. Deployments with a strict cryptographic boundary can implement it
+// on top of an HSM or a validated module and pass it to a session with the
+// Crypto option.
+//
+// Secret values handed to a provider (auth values, salts and session keys)
+// are still held in process memory by the session.
+type CryptoProvider interface {
+	// EncryptSalt generates a random salt and protects it to the given
+	// RSA or ECC public key using the given label, as described in Part 1,
+	// B.10.2 (RSA) and 19.6.13 (ECC). It returns the encrypted salt to
+	// send to the TPM and the plaintext salt.
+	EncryptSalt(pub TPMTPublic, label string) (*TPM2BEncryptedSecret, []byte, error)
+	// KDFa derives bits of key material from key, as described in Part 1,
+	// 11.4.10.2.
+	KDFa(h crypto.Hash, key []byte, label string, contextU, contextV []byte, bits int) ([]byte, error)
+	// HMAC returns the HMAC of data keyed with key.
+	HMAC(h crypto.Hash, key, data []byte) ([]byte, error)
+}
+
+// SoftwareCrypto is the default CryptoProvider, implemented with the Go
+// standard library. It can be embedded by providers that only need to
+// replace some of the operations.
+type SoftwareCrypto struct{}
+
+// EncryptSalt implements CryptoProvider.
+func (SoftwareCrypto) EncryptSalt(pub TPMTPublic, label string) (*TPM2BEncryptedSecret, []byte, error) {
+	return encryptSecret(pub, label)
+}
+
+// KDFa implements CryptoProvider.
+func (SoftwareCrypto) KDFa(h crypto.Hash, key []byte, label string, contextU, contextV []byte, bits int) ([]byte, error) {
+	return KDFa(h, key, label, contextU, contextV, bits), nil
+}
+
+// HMAC implements CryptoProvider.
+func (SoftwareCrypto) HMAC(h crypto.Hash, key, data []byte) ([]byte, error) {
+	mac := hmac.New(h.New, key)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
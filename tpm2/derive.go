@@ -0,0 +1,56 @@
+package tpm2
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// CreateDerivationParent creates a derivation parent from
+// DerivationParentTemplate under parent, which may be a hierarchy or a
+// storage key, and loads it. The caller must flush it when done.
+//
+// A derivation parent roots a tree of keys that are derived, rather than
+// generated, by the TPM: DeriveKey returns the same key for the same
+// template, label and context every time, so per-purpose keys need not be
+// stored.
+func CreateDerivationParent(t transport.TPM, parent handle, userAuth []byte, s ...Session) (*NamedHandle, error) {
+	rsp, err := CreateLoaded{
+		ParentHandle: parent,
+		InSensitive: TPM2BSensitiveCreate{
+			Sensitive: &TPMSSensitiveCreate{
+				UserAuth: TPM2BAuth{Buffer: userAuth},
+			},
+		},
+		InPublic: New2BTemplate(&DerivationParentTemplate),
+	}.Execute(t, s...)
+	if err != nil {
+		return nil, fmt.Errorf("creating derivation parent: %w", err)
+	}
+	return &NamedHandle{Handle: rsp.ObjectHandle, Name: rsp.Name}, nil
+}
+
+// DeriveKey derives a key from template under the derivation parent, using
+// label and context to select it, and loads it. The unique field of template
+// is ignored, and sensitiveDataOrigin is cleared, as the TPM rejects it for
+// derived objects. The caller must flush the key when done.
+//
+// To derive a further level of the tree, pass DerivationParentTemplate as
+// the template: the result is itself a derivation parent.
+func DeriveKey(t transport.TPM, parent handle, template *TPMTPublic, label, context, userAuth []byte, s ...Session) (*CreateLoadedResponse, error) {
+	tmpl := NewTPMTTemplate(template, label, context)
+	tmpl.ObjectAttributes.SensitiveDataOrigin = false
+	rsp, err := CreateLoaded{
+		ParentHandle: parent,
+		InSensitive: TPM2BSensitiveCreate{
+			Sensitive: &TPMSSensitiveCreate{
+				UserAuth: TPM2BAuth{Buffer: userAuth},
+			},
+		},
+		InPublic: New2BTemplate(tmpl),
+	}.Execute(t, s...)
+	if err != nil {
+		return nil, fmt.Errorf("deriving key: %w", err)
+	}
+	return rsp, nil
+}
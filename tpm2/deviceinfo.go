@@ -0,0 +1,186 @@
+package tpm2
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// DeviceInfo describes a TPM's maker, firmware and specification level, as
+// reported by its fixed properties.
+type DeviceInfo struct {
+	// Manufacturer is the TCG vendor ID, such as "IFX" or "NTC".
+	Manufacturer string
+	// ManufacturerID is the raw TPM_PT_MANUFACTURER value.
+	ManufacturerID uint32
+	// VendorString is the vendor-defined description of the TPM.
+	VendorString string
+	// VendorTPMType is the vendor-defined TPM model.
+	VendorTPMType uint32
+	// FirmwareVersion1 and FirmwareVersion2 are the vendor-defined firmware
+	// version, most significant half first.
+	FirmwareVersion1 uint32
+	FirmwareVersion2 uint32
+	// Family is the specification family, "2.0".
+	Family string
+	// Level and Revision identify the specification version; Revision is
+	// the revision times 100, so 159 is revision 1.59.
+	Level    uint32
+	Revision uint32
+	// Year and DayOfYear give the date of the specification.
+	Year      uint32
+	DayOfYear uint32
+}
+
+// manufacturerNames maps TCG vendor IDs to vendor names.
+var manufacturerNames = map[string]string{
+	"AMD":  "AMD",
+	"ATML": "Atmel",
+	"BRCM": "Broadcom",
+	"CSCO": "Cisco",
+	"FLYS": "Flyslice Technologies",
+	"GOOG": "Google",
+	"HPE":  "HPE",
+	"IBM":  "IBM",
+	"IFX":  "Infineon",
+	"INTC": "Intel",
+	"LEN":  "Lenovo",
+	"MSFT": "Microsoft",
+	"NSM":  "National Semiconductor",
+	"NTC":  "Nuvoton Technology",
+	"NTZ":  "Nationz",
+	"QCOM": "Qualcomm",
+	"ROCC": "Fuzhou Rockchip",
+	"SMSC": "SMSC",
+	"SMSN": "Samsung",
+	"SNS":  "Sinosun",
+	"STM":  "STMicroelectronics",
+	"TXN":  "Texas Instruments",
+	"WEC":  "Winbond",
+}
+
+// ManufacturerName returns the name of the TPM's vendor, or its vendor ID
+// if the vendor is not known.
+func (d DeviceInfo) ManufacturerName() string {
+	if name, ok := manufacturerNames[d.Manufacturer]; ok {
+		return name
+	}
+	return d.Manufacturer
+}
+
+// FirmwareVersion returns the firmware version in the dotted form that
+// most vendors and tools use, splitting each half into two 16-bit parts.
+func (d DeviceInfo) FirmwareVersion() string {
+	return fmt.Sprintf("%d.%d.%d.%d",
+		d.FirmwareVersion1>>16, d.FirmwareVersion1&0xffff,
+		d.FirmwareVersion2>>16, d.FirmwareVersion2&0xffff)
+}
+
+// String returns a one-line summary of the TPM suitable for inventories.
+func (d DeviceInfo) String() string {
+	var b strings.Builder
+	b.WriteString(d.ManufacturerName())
+	if d.ManufacturerName() != d.Manufacturer {
+		fmt.Fprintf(&b, " (%s)", d.Manufacturer)
+	}
+	if d.VendorString != "" {
+		fmt.Fprintf(&b, " %s", d.VendorString)
+	}
+	fmt.Fprintf(&b, ", firmware %s, TPM %s level %d revision %d.%02d (%d)",
+		d.FirmwareVersion(), d.Family, d.Level, d.Revision/100, d.Revision%100, d.Year)
+	return b.String()
+}
+
+// propertyChars returns the four characters held in a string property.
+func propertyChars(v uint32) string {
+	return string([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
+
+// propertyString decodes a property that holds up to four ASCII characters.
+// Vendors pad these with NULs or spaces.
+func propertyString(v uint32) string {
+	return strings.TrimRight(propertyChars(v), "\x00 ")
+}
+
+// getProperties reads the TPM properties from first to last, inclusive. The
+// TPM omits properties it doesn't implement.
+func getProperties(t transport.TPM, first, last TPMPT) ([]TPMSTaggedProperty, error) {
+	var props []TPMSTaggedProperty
+	for prop := first; prop <= last; {
+		rsp, err := GetCapability{
+			Capability:    TPMCapTPMProperties,
+			Property:      uint32(prop),
+			PropertyCount: uint32(last-prop) + 1,
+		}.Execute(t)
+		if err != nil {
+			return nil, err
+		}
+		got, err := rsp.CapabilityData.Data.TPMProperties()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range got.TPMProperty {
+			if p.Property <= last {
+				props = append(props, p)
+			}
+		}
+		if len(got.TPMProperty) == 0 || !rsp.MoreData {
+			break
+		}
+		prop = got.TPMProperty[len(got.TPMProperty)-1].Property + 1
+	}
+	return props, nil
+}
+
+// GetDeviceInfo reads the TPM's fixed identification properties.
+func GetDeviceInfo(t transport.TPM) (*DeviceInfo, error) {
+	props, err := getProperties(t, TPMPTFamilyIndicator, TPMPTFirmwareVersion2)
+	if err != nil {
+		return nil, err
+	}
+
+	var info DeviceInfo
+	var vendor [4]uint32
+	var seen int
+	for _, p := range props {
+		switch p.Property {
+		case TPMPTFamilyIndicator:
+			info.Family = propertyString(p.Value)
+		case TPMPTLevel:
+			info.Level = p.Value
+		case TPMPTRevision:
+			info.Revision = p.Value
+		case TPMPTDayofYear:
+			info.DayOfYear = p.Value
+		case TPMPTYear:
+			info.Year = p.Value
+		case TPMPTManufacturer:
+			info.ManufacturerID = p.Value
+			info.Manufacturer = propertyString(p.Value)
+		case TPMPTVendorString1, TPMPTVendorString2, TPMPTVendorString3, TPMPTVendorString4:
+			vendor[p.Property-TPMPTVendorString1] = p.Value
+		case TPMPTVendorTPMType:
+			info.VendorTPMType = p.Value
+		case TPMPTFirmwareVersion1:
+			info.FirmwareVersion1 = p.Value
+		case TPMPTFirmwareVersion2:
+			info.FirmwareVersion2 = p.Value
+		default:
+			continue
+		}
+		seen++
+	}
+	if seen == 0 {
+		return nil, fmt.Errorf("TPM did not report its fixed properties")
+	}
+
+	// Each vendor string property holds four characters, but vendors are
+	// inconsistent about padding, so trim each one before joining them.
+	var vs strings.Builder
+	for _, v := range vendor {
+		vs.WriteString(strings.TrimRight(propertyChars(v), "\x00"))
+	}
+	info.VendorString = strings.TrimSpace(vs.String())
+	return &info, nil
+}
@@ -0,0 +1,146 @@
+package tpm2
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"fmt"
+)
+
+// WrapDuplicate does in software what TPM2_Duplicate does in a TPM: it
+// protects sens, the sensitive area of the object pub, so that it can be
+// imported with TPM2_Import under newParent.
+//
+// The duplicate always has an outer wrapper, keyed to newParent with a
+// fresh seed, as described in Part 1, section 23.3.2.4. If inner is AES in
+// CFB mode, it also has an inner wrapper (section 23.3.2.3) under a random
+// key, which is returned as EncryptionKeyOut and must be passed to Import,
+// with inner, as EncryptionKey. inner may also be TPM_ALG_NULL, for no
+// inner wrapper.
+func WrapDuplicate(newParent *TPMTPublic, pub *TPMTPublic, sens *TPMTSensitive, inner TPMTSymDef) (*DuplicateResponse, error) {
+	name, err := ObjectName(pub)
+	if err != nil {
+		return nil, err
+	}
+	var rsp DuplicateResponse
+	data := Marshal(TPM2BPrivate{Buffer: Marshal(sens)})
+	if inner.Algorithm != TPMAlgNull {
+		key, err := innerKey(inner)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = innerWrap(pub.NameAlg, name, key, data); err != nil {
+			return nil, err
+		}
+		rsp.EncryptionKeyOut = TPM2BData{Buffer: key}
+	}
+	duplicate, seed, err := outerWrap(newParent, "DUPLICATE", name, data)
+	if err != nil {
+		return nil, err
+	}
+	rsp.Duplicate, rsp.OutSymSeed = *duplicate, *seed
+	return &rsp, nil
+}
+
+// innerKey returns a random key for an inner wrapper with the symmetric
+// algorithm sym, which must be AES in CFB mode.
+func innerKey(sym TPMTSymDef) ([]byte, error) {
+	if sym.Algorithm != TPMAlgAES {
+		return nil, fmt.Errorf("unsupported inner wrapper algorithm %v", sym.Algorithm)
+	}
+	if mode, err := sym.Mode.AES(); err != nil {
+		return nil, err
+	} else if *mode != TPMAlgCFB {
+		return nil, fmt.Errorf("unsupported inner wrapper mode %v", *mode)
+	}
+	bits, err := sym.KeyBits.AES()
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, *bits/8)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// innerWrap protects sensitive, a marshalled TPM2B_SENSITIVE, with an inner
+// wrapper under key, as described in Part 1, section 23.3.2.3: the
+// sensitive area is prefixed with a digest of itself and the object's name
+// and encrypted with AES-CFB and a zero IV.
+func innerWrap(nameAlg TPMIAlgHash, name *TPM2BName, key, sensitive []byte) ([]byte, error) {
+	ha, err := nameAlg.Hash()
+	if err != nil {
+		return nil, err
+	}
+	h := ha.New()
+	h.Write(sensitive)
+	h.Write(name.Buffer)
+	data := Marshal(TPM2BDigest{Buffer: h.Sum(nil)})
+	data = append(data, sensitive...)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	cipher.NewCFBEncrypter(block, make([]byte, aes.BlockSize)).XORKeyStream(data, data)
+	return data, nil
+}
+
+// outerWrap protects data, the sensitive area of the object with the given
+// name, possibly inner wrapped already, with an outer wrapper for parent, as
+// described in Part 1, section 23.3.2.4. The seed is encrypted to parent with
+// label: "DUPLICATE" for a duplicate, "IDENTITY" for a credential. It returns
+// the wrapped data and the encrypted seed.
+func outerWrap(parent *TPMTPublic, label string, name *TPM2BName, data []byte) (*TPM2BPrivate, *TPM2BEncryptedSecret, error) {
+	var sym TPMTSymDefObject
+	switch parent.Type {
+	case TPMAlgRSA:
+		parms, err := parent.Parameters.RSADetail()
+		if err != nil {
+			return nil, nil, err
+		}
+		sym = parms.Symmetric
+	case TPMAlgECC:
+		parms, err := parent.Parameters.ECCDetail()
+		if err != nil {
+			return nil, nil, err
+		}
+		sym = parms.Symmetric
+	default:
+		return nil, nil, fmt.Errorf("unsupported parent type %v", parent.Type)
+	}
+	if sym.Algorithm != TPMAlgAES {
+		return nil, nil, fmt.Errorf("unsupported parent symmetric algorithm %v", sym.Algorithm)
+	}
+	bits, err := sym.KeyBits.AES()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encSeed, seed, err := encryptSecret(*parent, label)
+	if err != nil {
+		return nil, nil, err
+	}
+	ha, err := parent.NameAlg.Hash()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	symKey := KDFa(ha, seed, "STORAGE", name.Buffer, nil, int(*bits))
+	block, err := aes.NewCipher(symKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	encSensitive := append([]byte(nil), data...)
+	cipher.NewCFBEncrypter(block, make([]byte, aes.BlockSize)).XORKeyStream(encSensitive, encSensitive)
+
+	hmacKey := KDFa(ha, seed, "INTEGRITY", nil, nil, ha.Size()*8)
+	mac := hmac.New(ha.New, hmacKey)
+	mac.Write(encSensitive)
+	mac.Write(name.Buffer)
+	duplicate := Marshal(TPM2BDigest{Buffer: mac.Sum(nil)})
+	duplicate = append(duplicate, encSensitive...)
+	return &TPM2BPrivate{Buffer: duplicate}, encSeed, nil
+}
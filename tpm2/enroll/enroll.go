@@ -0,0 +1,218 @@
+// Package enroll implements clients for obtaining certificates for TPM keys:
+// a Privacy CA, which certifies an AK after proving with
+// TPM2_MakeCredential that it is on the same TPM as an EK, and EST (RFC
+// 7030) simple enrollment with a CSR signed by a TPM key.
+package enroll
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrKeyMismatch is returned when a CA issues a certificate for a different
+// key than the one being enrolled.
+var ErrKeyMismatch = errors.New("certificate is not for the enrolled key")
+
+// maxResponseSize bounds the size of a CA's response.
+const maxResponseSize = 1 << 20
+
+// ChallengeRequest is the body of a Privacy CA's /challenge request.
+type ChallengeRequest struct {
+	// EKPublic is the marshalled TPM2B_PUBLIC of the EK.
+	EKPublic []byte `json:"ekPublic"`
+	// EKCertificate is the DER-encoded EK certificate, if known.
+	EKCertificate []byte `json:"ekCertificate,omitempty"`
+	// AKPublic is the marshalled TPM2B_PUBLIC of the AK.
+	AKPublic []byte `json:"akPublic"`
+}
+
+// Challenge is the body of a Privacy CA's /challenge response: a secret
+// protected with TPM2_MakeCredential to the EK and the AK's name. A Privacy
+// CA written in Go can make it with tpm2.CreateCredential.
+type Challenge struct {
+	// ID identifies the enrollment in the /certificate request.
+	ID string `json:"id"`
+	// CredentialBlob is the marshalled TPM2B_ID_OBJECT.
+	CredentialBlob []byte `json:"credentialBlob"`
+	// Secret is the marshalled TPM2B_ENCRYPTED_SECRET.
+	Secret []byte `json:"secret"`
+}
+
+// CertificateRequest is the body of a Privacy CA's /certificate request.
+type CertificateRequest struct {
+	ID string `json:"id"`
+	// Secret is the secret recovered with TPM2_ActivateCredential.
+	Secret []byte `json:"secret"`
+}
+
+// CertificateResponse is the body of a Privacy CA's /certificate response.
+type CertificateResponse struct {
+	// Certificate is the DER-encoded AK certificate.
+	Certificate []byte `json:"certificate"`
+	// Chain holds any DER-encoded intermediate certificates.
+	Chain [][]byte `json:"chain,omitempty"`
+}
+
+// PrivacyCA is a client for a Privacy CA that speaks JSON over HTTP: a POST
+// of a ChallengeRequest to URL/challenge returns a Challenge, and a POST of
+// a CertificateRequest to URL/certificate returns a CertificateResponse.
+type PrivacyCA struct {
+	// URL is the CA's base URL.
+	URL string
+	// HTTPClient is used to talk to the CA. If nil, http.DefaultClient
+	// is used.
+	HTTPClient *http.Client
+}
+
+// EnrollAK obtains a certificate for the AK. ak and ek must carry the
+// authorizations for TPM2_ActivateCredential: usually PasswordAuth for the
+// AK and a policy session satisfying the EK's policy for the EK. ekCert is
+// sent to the CA if it is not nil. EnrollAK returns the AK certificate
+// followed by any intermediates.
+func (c *PrivacyCA) EnrollAK(ctx context.Context, t transport.TPM, ek, ak tpm2.AuthHandle, ekCert []byte) ([]*x509.Certificate, error) {
+	ekRsp, err := tpm2.ReadPublic{ObjectHandle: ek.Handle}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("reading EK: %w", err)
+	}
+	akRsp, err := tpm2.ReadPublic{ObjectHandle: ak.Handle}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("reading AK: %w", err)
+	}
+	if len(ek.Name.Buffer) == 0 {
+		ek.Name = ekRsp.Name
+	}
+	if len(ak.Name.Buffer) == 0 {
+		ak.Name = akRsp.Name
+	}
+	akPub, err := akRsp.OutPublic.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	var challenge Challenge
+	if err := c.post(ctx, "/challenge", ChallengeRequest{
+		EKPublic:      tpm2.Marshal(ekRsp.OutPublic),
+		EKCertificate: ekCert,
+		AKPublic:      tpm2.Marshal(akRsp.OutPublic),
+	}, &challenge); err != nil {
+		return nil, err
+	}
+	blob, err := tpm2.Unmarshal[tpm2.TPM2BIDObject](challenge.CredentialBlob)
+	if err != nil {
+		return nil, fmt.Errorf("parsing credential blob: %w", err)
+	}
+	secret, err := tpm2.Unmarshal[tpm2.TPM2BEncryptedSecret](challenge.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("parsing encrypted secret: %w", err)
+	}
+	activated, err := tpm2.ActivateCredential{
+		ActivateHandle: ak,
+		KeyHandle:      ek,
+		CredentialBlob: *blob,
+		Secret:         *secret,
+	}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("activating credential: %w", err)
+	}
+
+	var rsp CertificateResponse
+	if err := c.post(ctx, "/certificate", CertificateRequest{
+		ID:     challenge.ID,
+		Secret: activated.CertInfo.Buffer,
+	}, &rsp); err != nil {
+		return nil, err
+	}
+	certs, err := x509.ParseCertificates(bytes.Join(append([][]byte{rsp.Certificate}, rsp.Chain...), nil))
+	if err != nil {
+		return nil, fmt.Errorf("parsing AK certificate: %w", err)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("CA returned no certificate")
+	}
+	if err := checkPublicKey(certs[0], akPub); err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// post sends req as JSON to the CA's endpoint and decodes the JSON
+// response into rsp.
+func (c *PrivacyCA) post(ctx context.Context, endpoint string, req, rsp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.URL, "/")+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	data, err := do(c.HTTPClient, httpReq)
+	if err != nil {
+		return fmt.Errorf("%s: %w", endpoint, err)
+	}
+	if err := json.Unmarshal(data, rsp); err != nil {
+		return fmt.Errorf("%s: decoding response: %w", endpoint, err)
+	}
+	return nil
+}
+
+// do sends req and returns the body of a successful response.
+func do(client *http.Client, req *http.Request) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(rsp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", rsp.Status, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
+
+// checkPublicKey returns ErrKeyMismatch if cert is not for the TPM key pub.
+func checkPublicKey(cert *x509.Certificate, pub *tpm2.TPMTPublic) error {
+	switch pub.Type {
+	case tpm2.TPMAlgRSA:
+		unique, err := pub.Unique.RSA()
+		if err != nil {
+			return err
+		}
+		if k, ok := cert.PublicKey.(*rsa.PublicKey); ok && k.N.Cmp(new(big.Int).SetBytes(unique.Buffer)) == 0 {
+			return nil
+		}
+	case tpm2.TPMAlgECC:
+		unique, err := pub.Unique.ECC()
+		if err != nil {
+			return err
+		}
+		if k, ok := cert.PublicKey.(*ecdsa.PublicKey); ok &&
+			k.X.Cmp(new(big.Int).SetBytes(unique.X.Buffer)) == 0 &&
+			k.Y.Cmp(new(big.Int).SetBytes(unique.Y.Buffer)) == 0 {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported key type %v", pub.Type)
+	}
+	return ErrKeyMismatch
+}
@@ -0,0 +1,346 @@
+package enroll
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// testCA issues certificates for the test servers.
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(pub crypto.PublicKey, subject pkix.Name) ([]byte, error) {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	return x509.CreateCertificate(rand.Reader, tmpl, ca.cert, pub, ca.key)
+}
+
+func ekPolicy(t transport.TPM, handle tpm2.TPMISHPolicy, nonceTPM tpm2.TPM2BNonce) error {
+	_, err := tpm2.PolicySecret{
+		AuthHandle:    tpm2.TPMRHEndorsement,
+		PolicySession: handle,
+		NonceTPM:      nonceTPM,
+	}.Execute(t)
+	return err
+}
+
+// signingTemplate returns an ECC P-256 signing key template.
+func signingTemplate(restricted bool) tpm2.TPMTPublic {
+	tmpl := tpm2.ECCSRKTemplate
+	tmpl.ObjectAttributes.Decrypt = false
+	tmpl.ObjectAttributes.SignEncrypt = true
+	tmpl.ObjectAttributes.Restricted = restricted
+	tmpl.Parameters = tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+		Scheme: tpm2.TPMTECCScheme{
+			Scheme: tpm2.TPMAlgECDSA,
+			Details: tpm2.NewTPMUAsymScheme(tpm2.TPMAlgECDSA,
+				&tpm2.TPMSSigSchemeECDSA{HashAlg: tpm2.TPMAlgSHA256}),
+		},
+		CurveID: tpm2.TPMECCNistP256,
+	})
+	return tmpl
+}
+
+func createPrimary(t *testing.T, thetpm transport.TPM, hierarchy tpm2.TPMHandle, tmpl tpm2.TPMTPublic) *tpm2.CreatePrimaryResponse {
+	t.Helper()
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: hierarchy,
+		InPublic:      tpm2.New2B(tmpl),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	t.Cleanup(func() { tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm) })
+	return rsp
+}
+
+// privacyCAHandler implements the Privacy CA protocol, making credentials
+// in software as a real Privacy CA would.
+func privacyCAHandler(t *testing.T, ca *testCA) http.Handler {
+	var pending struct {
+		secret []byte
+		akPub  *tpm2.TPMTPublic
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/challenge", func(w http.ResponseWriter, r *http.Request) {
+		var req ChallengeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ekPub, err := tpm2.Unmarshal[tpm2.TPM2BPublic](req.EKPublic)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		akPub2B, err := tpm2.Unmarshal[tpm2.TPM2BPublic](req.AKPublic)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		akPub, err := akPub2B.Contents()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		akName, err := tpm2.ObjectName(akPub)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ek, err := ekPub.Contents()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pending.secret = []byte("enrollment secret")
+		pending.akPub = akPub
+		mc, err := tpm2.CreateCredential(ek, *akName, pending.secret)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(Challenge{
+			ID:             "1",
+			CredentialBlob: tpm2.Marshal(mc.CredentialBlob),
+			Secret:         tpm2.Marshal(mc.Secret),
+		})
+	})
+	mux.HandleFunc("/certificate", func(w http.ResponseWriter, r *http.Request) {
+		var req CertificateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.ID != "1" || !bytes.Equal(req.Secret, pending.secret) {
+			http.Error(w, "wrong secret", http.StatusForbidden)
+			return
+		}
+		unique, _ := pending.akPub.Unique.ECC()
+		der, err := ca.issue(&ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(unique.X.Buffer),
+			Y:     new(big.Int).SetBytes(unique.Y.Buffer),
+		}, pkix.Name{CommonName: "Test AK"})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(CertificateResponse{
+			Certificate: der,
+			Chain:       [][]byte{ca.cert.Raw},
+		})
+	})
+	return mux
+}
+
+func TestPrivacyCAEnrollAK(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	ca := newTestCA(t)
+	srv := httptest.NewServer(privacyCAHandler(t, ca))
+	defer srv.Close()
+
+	ek := createPrimary(t, thetpm, tpm2.TPMRHEndorsement, tpm2.ECCEKTemplate)
+	ak := createPrimary(t, thetpm, tpm2.TPMRHEndorsement, signingTemplate(true))
+
+	client := &PrivacyCA{URL: srv.URL, HTTPClient: srv.Client()}
+	certs, err := client.EnrollAK(context.Background(), thetpm,
+		tpm2.AuthHandle{Handle: ek.ObjectHandle, Auth: tpm2.Policy(tpm2.TPMAlgSHA256, 16, ekPolicy)},
+		tpm2.AuthHandle{Handle: ak.ObjectHandle, Auth: tpm2.PasswordAuth(nil)},
+		nil)
+	if err != nil {
+		t.Fatalf("EnrollAK: %v", err)
+	}
+	if len(certs) != 2 {
+		t.Fatalf("EnrollAK returned %d certificates, want 2", len(certs))
+	}
+	if err := certs[0].CheckSignatureFrom(ca.cert); err != nil {
+		t.Errorf("AK certificate not issued by the CA: %v", err)
+	}
+
+	// A CA that certifies the wrong key is caught.
+	other := createPrimary(t, thetpm, tpm2.TPMRHOwner, signingTemplate(true))
+	otherPub, _ := other.OutPublic.Contents()
+	unique, _ := otherPub.Unique.ECC()
+	der, err := ca.issue(&ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(unique.X.Buffer),
+		Y:     new(big.Int).SetBytes(unique.Y.Buffer),
+	}, pkix.Name{CommonName: "Wrong"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	akPub, _ := ak.OutPublic.Contents()
+	if err := checkPublicKey(cert, akPub); err != ErrKeyMismatch {
+		t.Errorf("checkPublicKey() = %v, want %v", err, ErrKeyMismatch)
+	}
+}
+
+// certsOnly returns a degenerate PKCS #7 signed-data with the given
+// certificates.
+func certsOnly(t *testing.T, certs ...[]byte) []byte {
+	t.Helper()
+	sd, err := asn1.Marshal(struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      struct{ ContentType asn1.ObjectIdentifier }
+		Certificates     asn1.RawValue `asn1:"tag:0"`
+		SignerInfos      asn1.RawValue
+	}{
+		Version:          1,
+		DigestAlgorithms: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true},
+		ContentInfo:      struct{ ContentType asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: bytes.Join(certs, nil)},
+		SignerInfos:      asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ci, err := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{oidSignedData, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd}})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return ci
+}
+
+func TestESTEnrollKey(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	ca := newTestCA(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/est/cacerts", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pkcs7-mime")
+		io.WriteString(w, base64.StdEncoding.EncodeToString(certsOnly(t, ca.cert.Raw)))
+	})
+	mux.HandleFunc("/.well-known/est/simpleenroll", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "device" || pass != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		der, err := base64.StdEncoding.DecodeString(string(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := csr.CheckSignature(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cert, err := ca.issue(csr.PublicKey, csr.Subject)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pkcs7-mime")
+		io.WriteString(w, base64.StdEncoding.EncodeToString(certsOnly(t, cert)))
+	})
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+
+	client := &EST{
+		URL:        srv.URL + "/.well-known/est",
+		HTTPClient: srv.Client(),
+		Username:   "device",
+		Password:   "secret",
+	}
+	roots, err := client.CACerts(context.Background())
+	if err != nil {
+		t.Fatalf("CACerts: %v", err)
+	}
+	if len(roots) != 1 || !roots[0].Equal(ca.cert) {
+		t.Errorf("CACerts() returned %d certificates, want the test CA", len(roots))
+	}
+
+	idevid := createPrimary(t, thetpm, tpm2.TPMRHOwner, signingTemplate(false))
+	cert, err := client.EnrollKey(context.Background(), thetpm,
+		tpm2.AuthHandle{Handle: idevid.ObjectHandle, Auth: tpm2.PasswordAuth(nil)},
+		&x509.CertificateRequest{Subject: pkix.Name{CommonName: "device-1234"}})
+	if err != nil {
+		t.Fatalf("EnrollKey: %v", err)
+	}
+	if cert.Subject.CommonName != "device-1234" {
+		t.Errorf("certificate subject = %v, want CN=device-1234", cert.Subject)
+	}
+	if err := cert.CheckSignatureFrom(ca.cert); err != nil {
+		t.Errorf("certificate not issued by the CA: %v", err)
+	}
+
+	// Restricted keys can't sign CSRs.
+	ak := createPrimary(t, thetpm, tpm2.TPMRHOwner, signingTemplate(true))
+	if _, err := client.EnrollKey(context.Background(), thetpm,
+		tpm2.AuthHandle{Handle: ak.ObjectHandle, Auth: tpm2.PasswordAuth(nil)},
+		&x509.CertificateRequest{}); err == nil {
+		t.Error("EnrollKey accepted a restricted key")
+	}
+}
@@ -0,0 +1,156 @@
+package enroll
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// oidSignedData is the PKCS #7 signed-data content type, used by EST for
+// certs-only responses.
+var oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+// EST is a client for Enrollment over Secure Transport (RFC 7030) simple
+// enrollment.
+type EST struct {
+	// URL is the server's EST base URL, e.g.
+	// "https://est.example.com/.well-known/est", optionally followed by
+	// a CA label.
+	URL string
+	// HTTPClient is used to talk to the server, and should be set up with
+	// the server's trust anchors. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// Username and Password, if set, are sent with HTTP basic
+	// authentication.
+	Username, Password string
+}
+
+// CACerts fetches the server's current CA certificates from /cacerts.
+func (c *EST) CACerts(ctx context.Context) ([]*x509.Certificate, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint("/cacerts"), nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.certsOnly(req)
+}
+
+// SimpleEnroll sends the DER-encoded PKCS #10 csr to /simpleenroll and
+// returns the issued certificate.
+func (c *EST) SimpleEnroll(ctx context.Context, csr []byte) (*x509.Certificate, error) {
+	body := base64.StdEncoding.EncodeToString(csr)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint("/simpleenroll"), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/pkcs10")
+	req.Header.Set("Content-Transfer-Encoding", "base64")
+	certs, err := c.certsOnly(req)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
+}
+
+// EnrollKey creates a CSR for the given unrestricted TPM signing key, such
+// as an IDevID key, signs it with the key and enrolls it with
+// SimpleEnroll. key.Auth authorizes the signature. template supplies the
+// CSR's subject and extensions, as for x509.CreateCertificateRequest.
+func (c *EST) EnrollKey(ctx context.Context, t transport.TPM, key tpm2.AuthHandle, template *x509.CertificateRequest) (*x509.Certificate, error) {
+	signer, err := tpm2.NewSigner(t, key)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, signer)
+	if err != nil {
+		return nil, fmt.Errorf("creating CSR: %w", err)
+	}
+	cert, err := c.SimpleEnroll(ctx, csr)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(cert.RawSubjectPublicKeyInfo, pub) {
+		return nil, ErrKeyMismatch
+	}
+	return cert, nil
+}
+
+// endpoint returns the URL of the given EST operation.
+func (c *EST) endpoint(op string) string {
+	return strings.TrimSuffix(c.URL, "/") + op
+}
+
+// certsOnly sends req and parses the base64-encoded PKCS #7 certs-only
+// response.
+func (c *EST) certsOnly(req *http.Request) ([]*x509.Certificate, error) {
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	data, err := do(c.HTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", req.URL.Path, err)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: decoding response: %w", req.URL.Path, err)
+	}
+	certs, err := parseCertsOnly(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", req.URL.Path, err)
+	}
+	return certs, nil
+}
+
+// parseCertsOnly returns the certificates of a degenerate PKCS #7
+// signed-data structure, as in RFC 7030, section 4.1.3.
+func parseCertsOnly(der []byte) ([]*x509.Certificate, error) {
+	var ci struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,tag:0"`
+	}
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("parsing PKCS #7: %w", err)
+	} else if len(rest) != 0 {
+		return nil, errors.New("trailing data after PKCS #7")
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("PKCS #7 content type is %v, want signed-data", ci.ContentType)
+	}
+	var sd struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      asn1.RawValue
+		Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+		CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+		SignerInfos      asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("parsing PKCS #7 signed-data: %w", err)
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("response has no certificates")
+	}
+	return certs, nil
+}
@@ -423,6 +423,7 @@ func (s subject) String() string {
 }
 
 // TPMFmt1Error represents a TPM 2.0 format-1 error, with additional information.
+// Get one from an error returned by a command with errors.As.
 type TPMFmt1Error struct {
 	// The canonical TPM error code, with handle/parameter/session info
 	// stripped out.
@@ -431,15 +432,29 @@ type TPMFmt1Error struct {
 	subject subject
 	// Which handle, parameter, or session was in error
 	index int
+	// The name of the command structure field that was in error, if known.
+	field string
 }
 
 // Error returns the string representation of the error.
 func (e TPMFmt1Error) Error() string {
+	where := fmt.Sprintf("%v %d", e.subject, e.index)
+	if e.field != "" {
+		where = fmt.Sprintf("%s, %s", where, e.field)
+	}
 	desc, ok := fmt1Descs[e.canonical]
 	if !ok {
-		return fmt.Sprintf("unknown format-1 error: %s %d (%x)", e.subject, e.index, uint32(e.canonical))
+		return fmt.Sprintf("unknown format-1 error: %s (%x)", where, uint32(e.canonical))
 	}
-	return fmt.Sprintf("%s (%v %d): %s", desc.name, e.subject, e.index, desc.description)
+	return fmt.Sprintf("%s (%s): %s", desc.name, where, desc.description)
+}
+
+// Field returns the name of the command structure field that the handle or
+// parameter in error was marshalled from, e.g. "InPublic" for a bad template
+// passed to CreatePrimary. It returns the empty string if the error was not
+// returned by a command's Execute method or is session-related.
+func (e TPMFmt1Error) Field() string {
+	return e.field
 }
 
 // Handle returns whether the error is handle-related and if so, which handle is
@@ -469,6 +484,36 @@ func (e TPMFmt1Error) Session() (bool, int) {
 	return true, e.index
 }
 
+// fieldError is a format-1 TPMRC returned while executing a command, along
+// with the name of the command field that the TPM reported as being in error.
+type fieldError struct {
+	rc    TPMRC
+	field string
+}
+
+// Error returns the string representation of the error.
+func (e fieldError) Error() string {
+	_, fmt1 := e.rc.isFmt1Error()
+	fmt1.field = e.field
+	return fmt1.Error()
+}
+
+// Unwrap returns the TPMRC the TPM responded with.
+func (e fieldError) Unwrap() error {
+	return e.rc
+}
+
+// As supports the TPMFmt1Error type, setting its field name.
+func (e fieldError) As(target interface{}) bool {
+	pFmt1, ok := target.(*TPMFmt1Error)
+	if !ok {
+		return false
+	}
+	_, *pFmt1 = e.rc.isFmt1Error()
+	pFmt1.field = e.field
+	return true
+}
+
 // isFmt0Error returns true if the result is a format-0 error.
 func (r TPMRC) isFmt0Error() bool {
 	return (r&rcVer1) == rcVer1 && (r&rcWarn) != rcWarn
@@ -0,0 +1,293 @@
+package tpm2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// EventType is a TCG_EVENTTYPE, the type of an event log entry.
+// See the TCG PC Client Platform Firmware Profile, section 10.4.1.
+type EventType uint32
+
+// Event types useful to applications measuring their own data.
+const (
+	EVNoAction  EventType = 0x00000003
+	EVSeparator EventType = 0x00000004
+	EVAction    EventType = 0x00000005
+	EVEventTag  EventType = 0x00000006
+	EVIPL       EventType = 0x0000000D
+)
+
+// specIDSignature identifies a crypto-agile event log, whose first event is
+// a TCG_EfiSpecIDEvent.
+var specIDSignature = []byte("Spec ID Event03\x00")
+
+// ErrNotCryptoAgileLog is returned by ReadEventLog when the log does not
+// start with a Spec ID Event03 header.
+var ErrNotCryptoAgileLog = errors.New("not a crypto-agile TCG event log")
+
+// maxEventSize bounds the size of a single event read by ReadEventLog.
+const maxEventSize = 1 << 24
+
+// EventLogWriter writes a TCG crypto-agile event log: a TCG_EfiSpecIDEvent
+// header listing the PCR banks, followed by a TCG_PCR_EVENT2 for each
+// measurement. Verifiers can replay such a log against a quote.
+type EventLogWriter struct {
+	// mu serializes appends, and ExtendWithEvent's extend and append.
+	mu    sync.Mutex
+	w     io.Writer
+	banks []TPMIAlgHash
+}
+
+// NewEventLogWriter starts a new event log on w for the given PCR banks,
+// normally those returned by ActivePCRBanks, and writes its header.
+func NewEventLogWriter(w io.Writer, banks []TPMIAlgHash) (*EventLogWriter, error) {
+	if len(banks) == 0 {
+		return nil, errors.New("event log needs at least one PCR bank")
+	}
+	// TCG_EfiSpecIDEvent, PC Client Platform Firmware Profile 10.4.5.1.
+	var spec bytes.Buffer
+	spec.Write(specIDSignature)
+	binary.Write(&spec, binary.LittleEndian, uint32(0)) // platformClass
+	spec.Write([]byte{
+		0, // specVersionMinor
+		2, // specVersionMajor
+		0, // specErrata
+		2, // uintnSize: UINT64
+	})
+	binary.Write(&spec, binary.LittleEndian, uint32(len(banks)))
+	for _, bank := range banks {
+		h, err := bank.Hash()
+		if err != nil {
+			return nil, err
+		}
+		binary.Write(&spec, binary.LittleEndian, uint16(bank))
+		binary.Write(&spec, binary.LittleEndian, uint16(h.Size()))
+	}
+	spec.WriteByte(0) // vendorInfoSize
+
+	// The header is a TCG_PCClientPCREvent with a SHA-1 sized digest.
+	var hdr bytes.Buffer
+	binary.Write(&hdr, binary.LittleEndian, uint32(0))
+	binary.Write(&hdr, binary.LittleEndian, uint32(EVNoAction))
+	hdr.Write(make([]byte, 20))
+	binary.Write(&hdr, binary.LittleEndian, uint32(spec.Len()))
+	hdr.Write(spec.Bytes())
+	l := &EventLogWriter{
+		w:     w,
+		banks: append([]TPMIAlgHash(nil), banks...),
+	}
+	if err := l.write(hdr.Bytes()); err != nil {
+		return nil, fmt.Errorf("writing event log header: %w", err)
+	}
+	return l, nil
+}
+
+// ResumeEventLogWriter continues an existing event log, read with
+// ReadEventLog, by appending events to w.
+func ResumeEventLogWriter(w io.Writer, log *EventLog) (*EventLogWriter, error) {
+	if len(log.Banks) == 0 {
+		return nil, errors.New("event log has no PCR banks")
+	}
+	return &EventLogWriter{
+		w:     w,
+		banks: append([]TPMIAlgHash(nil), log.Banks...),
+	}, nil
+}
+
+// Banks returns the PCR banks recorded in the log's header.
+func (l *EventLogWriter) Banks() []TPMIAlgHash {
+	return append([]TPMIAlgHash(nil), l.banks...)
+}
+
+// marshalEvent returns the TCG_PCR_EVENT2 for e, with the digests for the
+// log's banks in header order. Digests for other banks are dropped.
+func (l *EventLogWriter) marshalEvent(e EventLogEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, e.PCR)
+	binary.Write(&buf, binary.LittleEndian, uint32(e.Type))
+	binary.Write(&buf, binary.LittleEndian, uint32(len(l.banks)))
+	for _, bank := range l.banks {
+		h, err := bank.Hash()
+		if err != nil {
+			return nil, err
+		}
+		var digest []byte
+		for _, d := range e.Digests.Digests {
+			if d.HashAlg == bank {
+				digest = d.Digest
+				break
+			}
+		}
+		if digest == nil {
+			return nil, fmt.Errorf("event has no digest for PCR bank %v", bank)
+		}
+		if len(digest) != h.Size() {
+			return nil, fmt.Errorf("%v digest is %d bytes, want %d", bank, len(digest), h.Size())
+		}
+		binary.Write(&buf, binary.LittleEndian, uint16(bank))
+		buf.Write(digest)
+	}
+	binary.Write(&buf, binary.LittleEndian, uint32(len(e.Data)))
+	buf.Write(e.Data)
+	return buf.Bytes(), nil
+}
+
+// Append writes e to the log as a TCG_PCR_EVENT2. e must have a digest for
+// every bank of the log; digests for other banks are ignored. The event is
+// written with a single call to the underlying writer.
+func (l *EventLogWriter) Append(e EventLogEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	event, err := l.marshalEvent(e)
+	if err != nil {
+		return err
+	}
+	if err := l.write(event); err != nil {
+		return fmt.Errorf("writing event: %w", err)
+	}
+	return nil
+}
+
+// write writes marshalled events to the log, syncing it to stable storage
+// if the underlying writer supports it.
+func (l *EventLogWriter) write(event []byte) error {
+	if _, err := l.w.Write(event); err != nil {
+		return err
+	}
+	if s, ok := l.w.(interface{ Sync() error }); ok {
+		if err := s.Sync(); err != nil {
+			return fmt.Errorf("syncing: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadEventLog parses a TCG crypto-agile event log, such as one written by
+// EventLogWriter. The header event is not included in the returned log's
+// entries.
+func ReadEventLog(data []byte) (*EventLog, error) {
+	r := bytes.NewReader(data)
+	var hdr struct {
+		PCR    uint32
+		Type   uint32
+		Digest [20]byte
+		Size   uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("reading event log header: %w", err)
+	}
+	if EventType(hdr.Type) != EVNoAction || hdr.Size > uint32(r.Len()) {
+		return nil, ErrNotCryptoAgileLog
+	}
+	spec := make([]byte, hdr.Size)
+	io.ReadFull(r, spec)
+	if !bytes.HasPrefix(spec, specIDSignature) {
+		return nil, ErrNotCryptoAgileLog
+	}
+	specReader := bytes.NewReader(spec[len(specIDSignature):])
+	var specHdr struct {
+		PlatformClass uint32
+		Version       [3]byte
+		UintnSize     uint8
+		NumAlgs       uint32
+	}
+	if err := binary.Read(specReader, binary.LittleEndian, &specHdr); err != nil {
+		return nil, fmt.Errorf("reading Spec ID event: %w", err)
+	}
+	if specHdr.NumAlgs > uint32(specReader.Len())/4 {
+		return nil, fmt.Errorf("Spec ID event lists %d algorithms in %d bytes", specHdr.NumAlgs, specReader.Len())
+	}
+	log := &EventLog{}
+	sizes := make(map[TPMIAlgHash]uint16)
+	for i := uint32(0); i < specHdr.NumAlgs; i++ {
+		var alg struct {
+			ID   uint16
+			Size uint16
+		}
+		binary.Read(specReader, binary.LittleEndian, &alg)
+		sizes[TPMIAlgHash(alg.ID)] = alg.Size
+		log.Banks = append(log.Banks, TPMIAlgHash(alg.ID))
+	}
+
+	for r.Len() > 0 {
+		entry, err := readEvent(r, sizes)
+		if err != nil {
+			return nil, fmt.Errorf("reading event %d: %w", len(log.Entries), err)
+		}
+		log.Entries = append(log.Entries, *entry)
+	}
+	return log, nil
+}
+
+// readEvent reads a TCG_PCR_EVENT2 from r, given the digest sizes of the
+// log's algorithms.
+func readEvent(r *bytes.Reader, sizes map[TPMIAlgHash]uint16) (*EventLogEntry, error) {
+	var eventHdr struct {
+		PCR   uint32
+		Type  uint32
+		Count uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &eventHdr); err != nil {
+		return nil, err
+	}
+	entry := EventLogEntry{
+		PCR:  eventHdr.PCR,
+		Type: EventType(eventHdr.Type),
+	}
+	for i := uint32(0); i < eventHdr.Count; i++ {
+		var alg uint16
+		if err := binary.Read(r, binary.LittleEndian, &alg); err != nil {
+			return nil, err
+		}
+		size, ok := sizes[TPMIAlgHash(alg)]
+		if !ok {
+			return nil, fmt.Errorf("digest for unlisted algorithm %v", TPMIAlgHash(alg))
+		}
+		digest := make([]byte, size)
+		if _, err := io.ReadFull(r, digest); err != nil {
+			return nil, err
+		}
+		entry.Digests.Digests = append(entry.Digests.Digests, TPMTHA{
+			HashAlg: TPMIAlgHash(alg),
+			Digest:  digest,
+		})
+	}
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+	if size > maxEventSize || size > uint32(r.Len()) {
+		return nil, fmt.Errorf("invalid event size %d", size)
+	}
+	entry.Data = make([]byte, size)
+	io.ReadFull(r, entry.Data)
+	return &entry, nil
+}
+
+// Replay computes the PCR values that the log's entries would produce,
+// starting from all-zero PCRs, as ReplayEventLog does. It replays the banks
+// listed in the log's header or, for logs without one, every bank that the
+// entries have digests for.
+func (l *EventLog) Replay() (PCRValues, error) {
+	banks := l.Banks
+	if banks == nil {
+		seen := make(map[TPMIAlgHash]bool)
+		for _, e := range l.Entries {
+			if e.Type == EVNoAction {
+				continue
+			}
+			for _, d := range e.Digests.Digests {
+				if !seen[d.HashAlg] {
+					seen[d.HashAlg] = true
+					banks = append(banks, d.HashAlg)
+				}
+			}
+		}
+	}
+	return ReplayEventLog(l, banks)
+}
@@ -0,0 +1,106 @@
+package tpm2
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// KeyExportability describes whether, and how, the private part of a key
+// can leave the TPM.
+type KeyExportability struct {
+	// Exportable reports whether the key's private part can exist outside
+	// this TPM, either because it came from outside or because the key or
+	// one of its ancestors can be duplicated. It is false only for fixedTPM
+	// keys.
+	Exportable bool
+	// ExternalOrigin reports that the TPM did not generate the key
+	// (sensitiveDataOrigin is clear), so it may already exist elsewhere.
+	ExternalOrigin bool
+	// Via is the position in the chain, 0 for the key itself, 1 for its
+	// parent and so on, of the nearest object that TPM2_Duplicate accepts.
+	// Duplicating an ancestor also exports every key below it. Via is -1 if
+	// no object in the given chain can be duplicated.
+	Via int
+	// Policy is the authPolicy of the object at Via, which a policy session
+	// must satisfy to duplicate it. Duplication requires the admin role, so
+	// an object with an empty policy cannot in practice be duplicated.
+	Policy []byte
+	// AnyParent reports that the object at Via can be duplicated without an
+	// inner wrapper to any new parent, including TPM_RH_NULL, which exports
+	// it in the clear. Otherwise (encryptedDuplication is set) it can only
+	// be duplicated, encrypted, to another parent object.
+	AnyParent bool
+	// Reasons explains the result.
+	Reasons []string
+}
+
+// CheckKeyExportability reports whether the private part of key can leave
+// the TPM. ancestors are the public areas of the key's parent, its parent,
+// and so on, as far up the hierarchy as they are known. Duplicable ancestors
+// matter because duplicating one exports the keys below it, even those that
+// have fixedParent set.
+func CheckKeyExportability(key *TPMTPublic, ancestors ...*TPMTPublic) *KeyExportability {
+	e := &KeyExportability{
+		Exportable:     !key.ObjectAttributes.FixedTPM,
+		ExternalOrigin: !key.ObjectAttributes.SensitiveDataOrigin,
+		Via:            -1,
+	}
+	if e.ExternalOrigin {
+		e.Reasons = append(e.Reasons, "the key was not generated by the TPM")
+	}
+
+	chain := append([]*TPMTPublic{key}, ancestors...)
+	for i, obj := range chain {
+		if obj.ObjectAttributes.FixedParent {
+			continue
+		}
+		e.Via = i
+		e.Policy = obj.AuthPolicy.Buffer
+		e.AnyParent = !obj.ObjectAttributes.EncryptedDuplication
+		what := "the key"
+		if i > 0 {
+			what = fmt.Sprintf("ancestor %d", i)
+		}
+		switch {
+		case len(e.Policy) == 0:
+			e.Reasons = append(e.Reasons, fmt.Sprintf("%v has fixedParent clear, but no policy to authorize TPM2_Duplicate", what))
+		case e.AnyParent:
+			e.Reasons = append(e.Reasons, fmt.Sprintf("%v can be duplicated under its policy to any parent, including in the clear", what))
+		default:
+			e.Reasons = append(e.Reasons, fmt.Sprintf("%v can be duplicated under its policy, encrypted to another parent", what))
+		}
+		break
+	}
+
+	if key.ObjectAttributes.FixedTPM {
+		if e.Via >= 0 {
+			// The TPM does not allow this, so the chain given is wrong.
+			e.Reasons = append(e.Reasons, "the key is fixedTPM, which contradicts the duplicable ancestor given")
+		} else {
+			e.Reasons = append(e.Reasons, "the key is fixedTPM")
+		}
+	} else if e.Via < 0 {
+		e.Reasons = append(e.Reasons, "the key is not fixedTPM, so an ancestor not given can be duplicated")
+	}
+	return e
+}
+
+// ReadKeyExportability reads the public areas of a loaded key and of the
+// given loaded ancestors, nearest first, and checks them with
+// CheckKeyExportability.
+func ReadKeyExportability(t transport.TPM, key TPMHandle, ancestors ...TPMHandle) (*KeyExportability, error) {
+	var chain []*TPMTPublic
+	for _, h := range append([]TPMHandle{key}, ancestors...) {
+		rsp, err := ReadPublic{ObjectHandle: h}.Execute(t)
+		if err != nil {
+			return nil, fmt.Errorf("reading 0x%08x: %w", uint32(h), err)
+		}
+		pub, err := rsp.OutPublic.Contents()
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, pub)
+	}
+	return CheckKeyExportability(chain[0], chain[1:]...), nil
+}
@@ -0,0 +1,53 @@
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoSessionKey indicates that a session has no session key to export
+// keying material from, because it is neither salted nor bound, or has not
+// been started.
+var ErrNoSessionKey = errors.New("session has no session key")
+
+// exporterLabelPrefix keeps exported keying material apart from the keys the
+// TPM derives from the same session key, such as those labelled "CFB".
+const exporterLabelPrefix = "EXPORTER-"
+
+// ExportKeyingMaterial derives length bytes of keying material from the
+// session key of s, in the manner of a TLS exporter (RFC 5705), so that a
+// higher-level protocol can bind itself to the TPM session. The material is
+// KDFa(sessionKey, "EXPORTER-" + label, context, nil) using the session's hash,
+// and stays the same for the life of the session.
+//
+// Only salted or bound HMAC and policy sessions have a session key, and only
+// a party that knows the salt or the bind authorization can derive the same
+// material. s must already have been started, for example by HMACSession or
+// PolicySession.
+func ExportKeyingMaterial(s Session, label string, context []byte, length int) ([]byte, error) {
+	if label == "" {
+		return nil, fmt.Errorf("exporter label must not be empty")
+	}
+	if length <= 0 {
+		return nil, fmt.Errorf("invalid exporter length %d", length)
+	}
+	var hash TPMIAlgHash
+	var key []byte
+	var p CryptoProvider
+	switch s := s.(type) {
+	case *hmacSession:
+		hash, key, p = s.hash, s.sessionKey, s.sessionCrypto()
+	case *policySession:
+		hash, key, p = s.hash, s.sessionKey, s.sessionCrypto()
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrNoSessionKey, s)
+	}
+	if len(key) == 0 {
+		return nil, ErrNoSessionKey
+	}
+	ha, err := hash.Hash()
+	if err != nil {
+		return nil, err
+	}
+	return p.KDFa(ha, key, exporterLabelPrefix+label, context, nil, length*8)
+}
@@ -0,0 +1,212 @@
+package tpm2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrLogDiverged is returned by RecoverExtend when the PCR matches neither
+// the event log nor the event log plus the interrupted measurement.
+var ErrLogDiverged = errors.New("event log does not match PCR value")
+
+// extendEventOptions configures ExtendWithEvent.
+type extendEventOptions struct {
+	walPath string
+}
+
+// ExtendEventOption is an option for ExtendWithEvent.
+type ExtendEventOption func(*extendEventOptions)
+
+// WriteAheadLog makes ExtendWithEvent record the event in the file at path,
+// synced to stable storage, before extending the PCR, and remove the file
+// once the event is in the event log. If the process crashes in between,
+// the file is left behind for RecoverExtend.
+func WriteAheadLog(path string) ExtendEventOption {
+	return func(o *extendEventOptions) {
+		o.walPath = path
+	}
+}
+
+// ExtendWithEvent measures data into a PCR and appends the matching event to
+// log. The PCR is extended in every bank of the log with a single
+// TPM2_PCR_Extend, so either all banks change or none do, and concurrent
+// calls sharing a log are serialized so that the log's order matches the
+// order of the extends.
+//
+// A PCR can't be un-extended, so the extend is done first: if appending to
+// the log then fails, the error says so and the log no longer replays to the
+// PCR. If the log's writer has a Sync method, as *os.File does, the event is
+// synced before ExtendWithEvent returns. To survive the process crashing
+// between the extend and the append, use WriteAheadLog and call
+// RecoverExtend at startup, before extending the PCR again.
+func ExtendWithEvent(t transport.TPM, pcr handle, typ EventType, data []byte, log *EventLogWriter, opts ...ExtendEventOption) (*TPMLDigestValues, error) {
+	if typ == EVNoAction {
+		return nil, errors.New("EV_NO_ACTION events are not extended into PCRs")
+	}
+	var o extendEventOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	var digests TPMLDigestValues
+	for _, bank := range log.banks {
+		h, err := bank.Hash()
+		if err != nil {
+			return nil, err
+		}
+		hasher := h.New()
+		hasher.Write(data)
+		digests.Digests = append(digests.Digests, TPMTHA{
+			HashAlg: bank,
+			Digest:  hasher.Sum(nil),
+		})
+	}
+	event, err := log.marshalEvent(EventLogEntry{
+		PCR:     pcr.HandleValue(),
+		Type:    typ,
+		Digests: digests,
+		Data:    data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if o.walPath != "" {
+		if err := writeSynced(o.walPath, event); err != nil {
+			return nil, fmt.Errorf("writing write-ahead log: %w", err)
+		}
+	}
+	if _, err := (PCRExtend{
+		PCRHandle: pcr,
+		Digests:   digests,
+	}).Execute(t); err != nil {
+		// If the TPM responded, the PCR wasn't extended. Otherwise
+		// it may have been, and RecoverExtend has to find out.
+		var rc TPMRC
+		if o.walPath != "" && errors.As(err, &rc) {
+			os.Remove(o.walPath)
+		}
+		return nil, err
+	}
+	if err := log.write(event); err != nil {
+		return &digests, fmt.Errorf("PCR %d was extended but not logged: %w", pcr.HandleValue(), err)
+	}
+	if o.walPath != "" {
+		if err := os.Remove(o.walPath); err != nil {
+			return &digests, fmt.Errorf("removing write-ahead log: %w", err)
+		}
+	}
+	return &digests, nil
+}
+
+// writeSynced writes data to a new file at path and syncs it.
+func writeSynced(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RecoverExtend completes or discards a measurement interrupted by a crash,
+// using the write-ahead log file left at walPath by ExtendWithEvent. current
+// is the event log as read back with ReadEventLog, and log appends to it,
+// e.g. one made with ResumeEventLogWriter.
+//
+// The PCR's value is compared with a replay of current: if it includes the
+// interrupted measurement, the event is appended to log and RecoverExtend
+// returns true; if it doesn't, the event is dropped and RecoverExtend
+// returns false. In both cases the write-ahead log is removed. This relies on
+// every extend of the PCR since it was last reset being in current, as for a
+// PCR dedicated to the application. If there is no write-ahead log,
+// RecoverExtend does nothing and returns false.
+func RecoverExtend(t transport.TPM, current *EventLog, log *EventLogWriter, walPath string) (bool, error) {
+	event, err := os.ReadFile(walPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	sizes := make(map[TPMIAlgHash]uint16)
+	for _, bank := range log.banks {
+		h, err := bank.Hash()
+		if err != nil {
+			return false, err
+		}
+		sizes[bank] = uint16(h.Size())
+	}
+	pending, err := readEvent(bytes.NewReader(event), sizes)
+	if err != nil {
+		return false, fmt.Errorf("reading write-ahead log: %w", err)
+	}
+
+	before, err := current.Replay()
+	if err != nil {
+		return false, err
+	}
+	after, err := (&EventLog{
+		Entries: append(append([]EventLogEntry(nil), current.Entries...), *pending),
+	}).Replay()
+	if err != nil {
+		return false, err
+	}
+	var sel TPMLPCRSelection
+	for _, bank := range log.banks {
+		sel.PCRSelections = append(sel.PCRSelections, TPMSPCRSelection{
+			Hash:      bank,
+			PCRSelect: PCClientCompatible.PCRs(uint(pending.PCR)),
+		})
+	}
+	actual, err := ReadPCRs(t, sel)
+	if err != nil {
+		return false, err
+	}
+
+	pcr := uint(pending.PCR)
+	matches := func(vals PCRValues) bool {
+		for _, bank := range log.banks {
+			want := vals[bank][pcr]
+			if want == nil {
+				want = make([]byte, sizes[bank])
+			}
+			if !bytes.Equal(actual[bank][pcr], want) {
+				return false
+			}
+		}
+		return true
+	}
+	var extended bool
+	switch {
+	case matches(after):
+		if err := log.write(event); err != nil {
+			return false, fmt.Errorf("writing event: %w", err)
+		}
+		extended = true
+	case matches(before):
+	default:
+		return false, fmt.Errorf("PCR %d: %w", pcr, ErrLogDiverged)
+	}
+	if err := os.Remove(walPath); err != nil {
+		return extended, fmt.Errorf("removing write-ahead log: %w", err)
+	}
+	return extended, nil
+}
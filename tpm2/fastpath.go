@@ -0,0 +1,298 @@
+package tpm2
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// This file contains hand-written marshalling for the commands that
+// signing and random-number services issue at high rates. The reflection
+// based path in execute allocates several hundred times per TPM2_Sign;
+// the paths here build the command in a pooled buffer and parse the
+// common response shapes directly, so that in steady state the only heap
+// allocations are the returned response and whatever the transport does.
+//
+// The fast paths are only taken when no sessions beyond a password
+// authorization are in use, and never through a Journal, which needs the
+// details that only execute gathers. Anything they do not recognize, including
+// every error response, is handed to the generic code so that callers see
+// exactly the same results and errors either way.
+
+// cmdBufPool holds command buffers for the fast paths.
+var cmdBufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 256)
+		return &b
+	},
+}
+
+// sendFast sends the command built by build in a pooled buffer.
+// The command buffer is returned to the pool once the transport is done
+// with it; transports do not retain commands after Send returns.
+func sendFast(t transport.TPM, build func([]byte) []byte) ([]byte, error) {
+	bp := cmdBufPool.Get().(*[]byte)
+	cmd := build((*bp)[:0])
+	rsp, err := t.Send(cmd)
+	*bp = cmd[:0]
+	cmdBufPool.Put(bp)
+	return rsp, err
+}
+
+func appendU16(b []byte, v uint16) []byte {
+	return binary.BigEndian.AppendUint16(b, v)
+}
+
+func appendU32(b []byte, v uint32) []byte {
+	return binary.BigEndian.AppendUint32(b, v)
+}
+
+func append2B(b []byte, buf []byte) []byte {
+	b = appendU16(b, uint16(len(buf)))
+	return append(b, buf...)
+}
+
+// fixLength fills in the size field of a command started with appendHeader.
+func fixLength(b []byte) []byte {
+	binary.BigEndian.PutUint32(b[2:], uint32(len(b)))
+	return b
+}
+
+func appendHeader(b []byte, tag TPMST, cc TPMCC) []byte {
+	b = appendU16(b, uint16(tag))
+	b = appendU32(b, 0)
+	return appendU32(b, uint32(cc))
+}
+
+// appendPWAuth appends an authorization area holding a single password
+// session, as built by pwSession.Authorize.
+func appendPWAuth(b []byte, auth []byte) []byte {
+	b = appendU32(b, uint32(4+2+1+2+len(auth)))
+	b = appendU32(b, uint32(TPMRSPW))
+	b = appendU16(b, 0) // nonce
+	b = append(b, 0)    // attributes
+	return append2B(b, auth)
+}
+
+// fastReader consumes a response, remembering whether it ran short.
+type fastReader struct {
+	b   []byte
+	bad bool
+}
+
+func (r *fastReader) u8() uint8 {
+	if len(r.b) < 1 {
+		r.bad = true
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *fastReader) u16() uint16 {
+	if len(r.b) < 2 {
+		r.bad = true
+		return 0
+	}
+	v := binary.BigEndian.Uint16(r.b)
+	r.b = r.b[2:]
+	return v
+}
+
+func (r *fastReader) u32() uint32 {
+	if len(r.b) < 4 {
+		r.bad = true
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+// sized returns the contents of a TPM2B without copying them.
+func (r *fastReader) sized() []byte {
+	n := int(r.u16())
+	if r.bad || len(r.b) < n {
+		r.bad = true
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// header consumes a response header and reports whether it describes a
+// successful response of exactly the received length.
+func (r *fastReader) header() bool {
+	r.u16()
+	size := r.u32()
+	rc := r.u32()
+	return !r.bad && rc == uint32(TPMRCSuccess) && int(size) == len(r.b)+10
+}
+
+// pwSessionOK consumes a response authorization area for a single password
+// session and reports whether it is the one pwSession.Validate accepts.
+func (r *fastReader) pwSessionOK() bool {
+	nonce := r.sized()
+	attrs := r.u8()
+	hmac := r.sized()
+	return !r.bad && len(nonce) == 0 && attrs == 1 && len(hmac) == 0 && len(r.b) == 0
+}
+
+// executeFast runs TPM2_GetRandom without reflection. If it returns a
+// non-nil byte slice, that response was not understood and must be parsed
+// by the generic code.
+func (cmd GetRandom) executeFast(t transport.TPM) (*GetRandomResponse, []byte, error) {
+	response, err := sendFast(t, func(b []byte) []byte {
+		b = appendHeader(b, TPMSTNoSessions, TPMCCGetRandom)
+		b = appendU16(b, cmd.BytesRequested)
+		return fixLength(b)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	r := fastReader{b: response}
+	if !r.header() {
+		return nil, response, nil
+	}
+	random := r.sized()
+	if r.bad || len(r.b) != 0 {
+		return nil, response, nil
+	}
+	return &GetRandomResponse{
+		RandomBytes: TPM2BDigest{Buffer: append([]byte(nil), random...)},
+	}, nil, nil
+}
+
+// fastAuth returns the password to use for h on the fast path, and whether
+// the fast path can be used at all. It matches the checks done by cmdAuths
+// and cmdNames, so that handles they reject take the generic path and fail
+// there with the usual errors.
+func fastAuth(h handle) ([]byte, bool) {
+	ah, ok := h.(AuthHandle)
+	if !ok {
+		return nil, false
+	}
+	pw, ok := ah.Auth.(*pwSession)
+	if !ok || ah.KnownName() == nil {
+		return nil, false
+	}
+	return pw.auth, true
+}
+
+// appendSigScheme appends s if it has one of the common encodings, and
+// reports false otherwise.
+func appendSigScheme(b []byte, s TPMTSigScheme) ([]byte, bool) {
+	switch s.Scheme {
+	case 0, TPMAlgNull:
+		return appendU16(b, uint16(TPMAlgNull)), true
+	case TPMAlgRSASSA, TPMAlgRSAPSS, TPMAlgECDSA:
+		hash, ok := s.Details.contents.(*TPMSSchemeHash)
+		if !ok || s.Details.selector != s.Scheme {
+			return b, false
+		}
+		b = appendU16(b, uint16(s.Scheme))
+		return appendU16(b, uint16(hash.HashAlg)), true
+	}
+	return b, false
+}
+
+// signResponseRSA and signResponseECC let a signature and its response be
+// allocated together.
+type signResponseRSA struct {
+	rsp SignResponse
+	sig TPMSSignatureRSA
+}
+
+type signResponseECC struct {
+	rsp SignResponse
+	sig TPMSSignatureECC
+}
+
+// executeFast runs TPM2_Sign without reflection. It reports false if the
+// command could not be built by hand; if it returns a non-nil byte slice,
+// that response was not understood and must be parsed by the generic code.
+func (cmd Sign) executeFast(t transport.TPM) (*SignResponse, []byte, bool, error) {
+	auth, ok := fastAuth(cmd.KeyHandle)
+	if !ok {
+		return nil, nil, false, nil
+	}
+	if _, ok := appendSigScheme(nil, cmd.InScheme); !ok {
+		return nil, nil, false, nil
+	}
+	response, err := sendFast(t, func(b []byte) []byte {
+		b = appendHeader(b, TPMSTSessions, TPMCCSign)
+		b = appendU32(b, cmd.KeyHandle.HandleValue())
+		b = appendPWAuth(b, auth)
+		b = append2B(b, cmd.Digest.Buffer)
+		b, _ = appendSigScheme(b, cmd.InScheme)
+		b = appendU16(b, uint16(cmd.Validation.Tag))
+		hierarchy := cmd.Validation.Hierarchy
+		if hierarchy == 0 {
+			hierarchy = TPMRHNull
+		}
+		b = appendU32(b, uint32(hierarchy))
+		b = append2B(b, cmd.Validation.Digest.Buffer)
+		return fixLength(b)
+	})
+	if err != nil {
+		return nil, nil, true, err
+	}
+
+	r := fastReader{b: response}
+	if !r.header() {
+		return nil, response, true, nil
+	}
+	parmSize := int(r.u32())
+	if r.bad || parmSize > len(r.b) {
+		return nil, response, true, nil
+	}
+	parms := fastReader{b: r.b[:parmSize]}
+	r.b = r.b[parmSize:]
+	if !r.pwSessionOK() {
+		return nil, response, true, nil
+	}
+
+	var rsp *SignResponse
+	switch alg := TPMAlgID(parms.u16()); alg {
+	case TPMAlgRSASSA, TPMAlgRSAPSS:
+		hash := TPMIAlgHash(parms.u16())
+		sig := parms.sized()
+		if parms.bad || len(parms.b) != 0 {
+			return nil, response, true, nil
+		}
+		out := &signResponseRSA{}
+		out.sig.Hash = hash
+		out.sig.Sig.Buffer = append([]byte(nil), sig...)
+		out.rsp.Signature = TPMTSignature{
+			SigAlg:    alg,
+			Signature: TPMUSignature{selector: alg, contents: &out.sig},
+		}
+		rsp = &out.rsp
+	case TPMAlgECDSA, TPMAlgECDAA:
+		hash := TPMIAlgHash(parms.u16())
+		sigR := parms.sized()
+		sigS := parms.sized()
+		if parms.bad || len(parms.b) != 0 {
+			return nil, response, true, nil
+		}
+		// Copy both halves of the signature with a single allocation.
+		buf := make([]byte, len(sigR)+len(sigS))
+		copy(buf, sigR)
+		copy(buf[len(sigR):], sigS)
+		out := &signResponseECC{}
+		out.sig.Hash = hash
+		out.sig.SignatureR.Buffer = buf[:len(sigR):len(sigR)]
+		out.sig.SignatureS.Buffer = buf[len(sigR):]
+		out.rsp.Signature = TPMTSignature{
+			SigAlg:    alg,
+			Signature: TPMUSignature{selector: alg, contents: &out.sig},
+		}
+		rsp = &out.rsp
+	default:
+		return nil, response, true, nil
+	}
+	return rsp, nil, true, nil
+}
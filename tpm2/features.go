@@ -0,0 +1,192 @@
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// firstACT is TPM_RH_ACT_0, the first authenticated countdown timer.
+const firstACT TPMHandle = 0x40000110
+
+// Features records which optional commands, algorithms, curves and
+// authenticated countdown timers (ACTs) a TPM implements. It is read once
+// with GetFeatures and then consulted by helpers, such as CreateKey and
+// NegotiateProfile, that fall back to older commands or algorithms on TPMs
+// that lack newer ones. The zero Features reports nothing as implemented,
+// which makes such helpers use their most compatible path.
+type Features struct {
+	commands map[TPMCC]bool
+	algs     map[TPMAlgID]bool
+	curves   map[TPMECCCurve]bool
+	acts     []TPMHandle
+}
+
+// GetFeatures reads the TPM's implemented commands, algorithms, ECC curves
+// and ACTs.
+func GetFeatures(t transport.TPM) (*Features, error) {
+	f := Features{
+		commands: make(map[TPMCC]bool),
+		algs:     make(map[TPMAlgID]bool),
+		curves:   make(map[TPMECCCurve]bool),
+	}
+	if err := getCapabilities(t, TPMCapCommands, 0, func(data *TPMUCapabilities) (uint32, int, error) {
+		cmds, err := data.Command()
+		if err != nil {
+			return 0, 0, err
+		}
+		var last uint32
+		for _, cc := range cmds.CommandAttributes {
+			f.commands[TPMCC(cc.CommandIndex)] = true
+			last = uint32(cc.CommandIndex)
+		}
+		return last, len(cmds.CommandAttributes), nil
+	}); err != nil {
+		return nil, fmt.Errorf("reading commands: %w", err)
+	}
+	if err := readAlgorithms(t, f.algs); err != nil {
+		return nil, err
+	}
+	if err := getCapabilities(t, TPMCapECCCurves, 0, func(data *TPMUCapabilities) (uint32, int, error) {
+		curves, err := data.ECCCurves()
+		if err != nil {
+			return 0, 0, err
+		}
+		var last uint32
+		for _, curve := range curves.ECCCurves {
+			f.curves[curve] = true
+			last = uint32(curve)
+		}
+		return last, len(curves.ECCCurves), nil
+	}); err != nil {
+		return nil, fmt.Errorf("reading ECC curves: %w", err)
+	}
+	// TPMs older than revision 1.59 don't know TPM_CAP_ACT.
+	if err := getCapabilities(t, TPMCapACT, uint32(firstACT), func(data *TPMUCapabilities) (uint32, int, error) {
+		acts, err := data.ACTData()
+		if err != nil {
+			return 0, 0, err
+		}
+		var last uint32
+		for _, act := range acts.ACTData {
+			f.acts = append(f.acts, act.Handle)
+			last = uint32(act.Handle)
+		}
+		return last, len(acts.ACTData), nil
+	}); err != nil && !errors.Is(err, TPMRCValue) {
+		return nil, fmt.Errorf("reading ACTs: %w", err)
+	}
+	return &f, nil
+}
+
+// readAlgorithms records the TPM's implemented algorithms in algs.
+func readAlgorithms(t transport.TPM, algs map[TPMAlgID]bool) error {
+	if err := getCapabilities(t, TPMCapAlgs, 0, func(data *TPMUCapabilities) (uint32, int, error) {
+		props, err := data.Algorithms()
+		if err != nil {
+			return 0, 0, err
+		}
+		var last uint32
+		for _, alg := range props.AlgProperties {
+			algs[alg.Alg] = true
+			last = uint32(alg.Alg)
+		}
+		return last, len(props.AlgProperties), nil
+	}); err != nil {
+		return fmt.Errorf("reading algorithms: %w", err)
+	}
+	return nil
+}
+
+// getCapabilities pages through a capability starting at property. read
+// consumes one response and returns the last property in it and how many
+// values it held.
+func getCapabilities(t transport.TPM, capability TPMCap, property uint32, read func(*TPMUCapabilities) (uint32, int, error)) error {
+	for {
+		rsp, err := GetCapability{
+			Capability:    capability,
+			Property:      property,
+			PropertyCount: 64,
+		}.Execute(t)
+		if err != nil {
+			return err
+		}
+		last, n, err := read(&rsp.CapabilityData.Data)
+		if err != nil {
+			return err
+		}
+		if !rsp.MoreData || n == 0 {
+			return nil
+		}
+		property = last + 1
+	}
+}
+
+// HasCommand reports whether the TPM implements the command.
+func (f *Features) HasCommand(cc TPMCC) bool {
+	return f.commands[cc]
+}
+
+// HasAlgorithm reports whether the TPM implements the algorithm.
+func (f *Features) HasAlgorithm(alg TPMAlgID) bool {
+	return f.algs[alg]
+}
+
+// HasCurve reports whether the TPM implements the ECC curve.
+func (f *Features) HasCurve(curve TPMECCCurve) bool {
+	return f.curves[curve]
+}
+
+// ACTs returns the handles of the TPM's authenticated countdown timers.
+func (f *Features) ACTs() []TPMHandle {
+	return f.acts
+}
+
+// CreateKey creates an object from template under parent and loads it,
+// using TPM2_CreateLoaded if the TPM implements it and TPM2_Create followed
+// by TPM2_Load otherwise. parent's authorization and the sessions in s are
+// used for every command sent. The caller must flush the object when done.
+func CreateKey(t transport.TPM, f *Features, parent AuthHandle, template *TPMTPublic, userAuth []byte, s ...Session) (*NamedHandle, *TPM2BPublic, error) {
+	key, blob, err := CreateKeyBlob(t, f, parent, template, userAuth, s...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, &blob.Public, nil
+}
+
+// CreateKeyBlob is like CreateKey, but also returns the object's public and
+// private areas, so that it can be saved and loaded again later.
+func CreateKeyBlob(t transport.TPM, f *Features, parent AuthHandle, template *TPMTPublic, userAuth []byte, s ...Session) (*NamedHandle, *KeyBlob, error) {
+	sensitive := TPM2BSensitiveCreate{
+		Sensitive: &TPMSSensitiveCreate{
+			UserAuth: TPM2BAuth{Buffer: userAuth},
+		},
+	}
+	if f.HasCommand(TPMCCCreateLoaded) {
+		rsp, err := CreateLoaded{
+			ParentHandle: parent,
+			InSensitive:  sensitive,
+			InPublic:     New2BTemplate(template),
+		}.Execute(t, s...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating key: %w", err)
+		}
+		return &NamedHandle{Handle: rsp.ObjectHandle, Name: rsp.Name}, &KeyBlob{Public: rsp.OutPublic, Private: rsp.OutPrivate}, nil
+	}
+
+	created, err := Create{
+		ParentHandle: parent,
+		InSensitive:  sensitive,
+		InPublic:     New2B(*template),
+	}.Execute(t, s...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating key: %w", err)
+	}
+	blob := &KeyBlob{Public: created.OutPublic, Private: created.OutPrivate}
+	key, err := blob.Load(t, parent, s...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, blob, nil
+}
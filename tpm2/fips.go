@@ -0,0 +1,283 @@
+package tpm2
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrNotFIPSApproved is returned when an algorithm, key size or scheme that
+// is not FIPS 140 approved is used where approved algorithms are required.
+var ErrNotFIPSApproved = errors.New("not FIPS approved")
+
+// FIPSEnforced reports whether the package was built with the tpm2fips
+// build tag. In that build, every HMAC and policy session behaves as if it
+// was created with the FIPS option, and the templates of CreatePrimary,
+// Create, CreateLoaded and LoadExternal are checked with CheckFIPSTemplate
+// before the command is sent.
+func FIPSEnforced() bool { return fipsEnforced }
+
+// FIPSApprovedHash reports whether alg is an approved hash algorithm: SHA-2
+// or SHA-3 with a digest of at least 256 bits.
+func FIPSApprovedHash(alg TPMIAlgHash) bool {
+	switch alg {
+	case TPMAlgSHA256, TPMAlgSHA384, TPMAlgSHA512,
+		TPMAlgSHA3256, TPMAlgSHA3384, TPMAlgSHA3512:
+		return true
+	}
+	return false
+}
+
+// fipsMinRSABits is the smallest approved RSA modulus.
+const fipsMinRSABits = 2048
+
+// checkFIPSHash returns an error if alg, used for the given purpose, is not
+// an approved hash algorithm.
+func checkFIPSHash(purpose string, alg TPMIAlgHash) error {
+	if !FIPSApprovedHash(alg) {
+		return fmt.Errorf("%s %v: %w", purpose, alg, ErrNotFIPSApproved)
+	}
+	return nil
+}
+
+// checkFIPSSymmetric returns an error if alg is neither TPM_ALG_NULL nor AES.
+// Like the marshalling code, it treats a zero algorithm as TPM_ALG_NULL.
+func checkFIPSSymmetric(purpose string, alg TPMIAlgSym) error {
+	if alg != 0 && alg != TPMAlgNull && alg != TPMAlgAES {
+		return fmt.Errorf("%s %v: %w", purpose, alg, ErrNotFIPSApproved)
+	}
+	return nil
+}
+
+// asymSchemeHash returns the hash algorithm of an RSA or ECC scheme, if it
+// has one.
+func asymSchemeHash(u *TPMUAsymScheme) (TPMIAlgHash, bool) {
+	switch c := u.contents.(type) {
+	case *TPMSSigSchemeRSASSA:
+		return c.HashAlg, true
+	case *TPMSSigSchemeRSAPSS:
+		return c.HashAlg, true
+	case *TPMSEncSchemeOAEP:
+		return c.HashAlg, true
+	case *TPMSSigSchemeECDSA:
+		return c.HashAlg, true
+	case *TPMSKeySchemeECDH:
+		return c.HashAlg, true
+	case *TPMSSchemeECDAA:
+		return c.HashAlg, true
+	}
+	return 0, false
+}
+
+// CheckFIPSTemplate returns an error wrapping ErrNotFIPSApproved if pub uses
+// an algorithm, key size or scheme that is not FIPS 140 approved: name and
+// scheme hashes must satisfy FIPSApprovedHash, symmetric keys and the
+// symmetric parameters of storage keys must be AES, RSA keys must be at
+// least 2048 bits with an RSASSA, RSAPSS or OAEP scheme, ECC keys must be on
+// a NIST P-256, P-384 or P-521 curve with an ECDSA or ECDH scheme, and
+// keyed-hash objects must not use XOR obfuscation.
+func CheckFIPSTemplate(pub *TPMTPublic) error {
+	if err := checkFIPSHash("name algorithm", pub.NameAlg); err != nil {
+		return err
+	}
+	switch pub.Type {
+	case TPMAlgRSA:
+		parms, err := pub.Parameters.RSADetail()
+		if err != nil {
+			return err
+		}
+		if err := checkFIPSSymmetric("symmetric algorithm", parms.Symmetric.Algorithm); err != nil {
+			return err
+		}
+		if parms.KeyBits < fipsMinRSABits {
+			return fmt.Errorf("%d-bit RSA key: %w", parms.KeyBits, ErrNotFIPSApproved)
+		}
+		switch parms.Scheme.Scheme {
+		case 0, TPMAlgNull, TPMAlgRSASSA, TPMAlgRSAPSS, TPMAlgOAEP:
+		default:
+			return fmt.Errorf("RSA scheme %v: %w", parms.Scheme.Scheme, ErrNotFIPSApproved)
+		}
+		if h, ok := asymSchemeHash(&parms.Scheme.Details); ok {
+			return checkFIPSHash("RSA scheme hash", h)
+		}
+	case TPMAlgECC:
+		parms, err := pub.Parameters.ECCDetail()
+		if err != nil {
+			return err
+		}
+		if err := checkFIPSSymmetric("symmetric algorithm", parms.Symmetric.Algorithm); err != nil {
+			return err
+		}
+		switch parms.CurveID {
+		case TPMECCNistP256, TPMECCNistP384, TPMECCNistP521:
+		default:
+			return fmt.Errorf("ECC curve %v: %w", parms.CurveID, ErrNotFIPSApproved)
+		}
+		switch parms.Scheme.Scheme {
+		case 0, TPMAlgNull, TPMAlgECDSA, TPMAlgECDH:
+		default:
+			return fmt.Errorf("ECC scheme %v: %w", parms.Scheme.Scheme, ErrNotFIPSApproved)
+		}
+		if h, ok := asymSchemeHash(&parms.Scheme.Details); ok {
+			return checkFIPSHash("ECC scheme hash", h)
+		}
+	case TPMAlgKeyedHash:
+		// Sealed data templates often leave Parameters zero, which is
+		// marshalled as a TPM_ALG_NULL scheme.
+		if pub.Parameters == (TPMUPublicParms{}) {
+			break
+		}
+		parms, err := pub.Parameters.KeyedHashDetail()
+		if err != nil {
+			return err
+		}
+		switch parms.Scheme.Scheme {
+		case 0, TPMAlgNull:
+		case TPMAlgHMAC:
+			hmac, err := parms.Scheme.Details.HMAC()
+			if err != nil {
+				return err
+			}
+			return checkFIPSHash("HMAC scheme hash", hmac.HashAlg)
+		default:
+			return fmt.Errorf("keyed-hash scheme %v: %w", parms.Scheme.Scheme, ErrNotFIPSApproved)
+		}
+	case TPMAlgSymCipher:
+		parms, err := pub.Parameters.SymDetail()
+		if err != nil {
+			return err
+		}
+		if parms.Sym.Algorithm != TPMAlgAES {
+			return fmt.Errorf("symmetric algorithm %v: %w", parms.Sym.Algorithm, ErrNotFIPSApproved)
+		}
+	default:
+		return fmt.Errorf("object type %v: %w", pub.Type, ErrNotFIPSApproved)
+	}
+	return nil
+}
+
+// FIPS restricts the session to approved algorithms: its hash must satisfy
+// FIPSApprovedHash, its parameter encryption must be AES, the key its salt
+// is encrypted to must pass CheckFIPSTemplate, and its CryptoProvider only
+// accepts approved hashes. Init returns an error otherwise.
+func FIPS() AuthOption {
+	return func(o *sessionOptions) {
+		o.fips = true
+	}
+}
+
+// checkFIPS returns an error if a session with the given hash and options
+// would use an unapproved algorithm.
+func (o *sessionOptions) checkFIPS(hash TPMIAlgHash) error {
+	if err := checkFIPSHash("session hash", hash); err != nil {
+		return err
+	}
+	if err := checkFIPSSymmetric("session parameter encryption", o.symmetric.Algorithm); err != nil {
+		return err
+	}
+	if o.saltHandle != TPMRHNull {
+		if err := CheckFIPSTemplate(&o.saltPub); err != nil {
+			return fmt.Errorf("salt key: %w", err)
+		}
+	}
+	return nil
+}
+
+// sessionCrypto returns the session's CryptoProvider, restricted to
+// approved hashes for a FIPS session.
+func (o *sessionOptions) sessionCrypto() CryptoProvider {
+	if o.fips || fipsEnforced {
+		return fipsCrypto{o.crypto}
+	}
+	return o.crypto
+}
+
+// fipsCrypto is a CryptoProvider that refuses unapproved hash algorithms.
+type fipsCrypto struct {
+	CryptoProvider
+}
+
+// checkFIPSCryptoHash returns an error if h is not an approved hash.
+func checkFIPSCryptoHash(h crypto.Hash) error {
+	switch h {
+	case crypto.SHA256, crypto.SHA384, crypto.SHA512,
+		crypto.SHA3_256, crypto.SHA3_384, crypto.SHA3_512:
+		return nil
+	}
+	return fmt.Errorf("hash %v: %w", h, ErrNotFIPSApproved)
+}
+
+// KDFa implements CryptoProvider.
+func (p fipsCrypto) KDFa(h crypto.Hash, key []byte, label string, contextU, contextV []byte, bits int) ([]byte, error) {
+	if err := checkFIPSCryptoHash(h); err != nil {
+		return nil, err
+	}
+	return p.CryptoProvider.KDFa(h, key, label, contextU, contextV, bits)
+}
+
+// HMAC implements CryptoProvider.
+func (p fipsCrypto) HMAC(h crypto.Hash, key, data []byte) ([]byte, error) {
+	if err := checkFIPSCryptoHash(h); err != nil {
+		return nil, err
+	}
+	return p.CryptoProvider.HMAC(h, key, data)
+}
+
+// checkFIPSCommand returns an error if cmd creates or loads an object from
+// a template that fails CheckFIPSTemplate.
+func checkFIPSCommand(cmd any) error {
+	var inPublic *TPM2BPublic
+	switch c := cmd.(type) {
+	case CreatePrimary:
+		inPublic = &c.InPublic
+	case Create:
+		inPublic = &c.InPublic
+	case LoadExternal:
+		inPublic = &c.InPublic
+	case CreateLoaded:
+		if pub, err := c.InPublic.Public(); err == nil {
+			return CheckFIPSTemplate(pub)
+		}
+		// A template for a derived object only differs in its unique
+		// field, which doesn't affect the algorithms used.
+		tmpl, err := c.InPublic.Template()
+		if err != nil {
+			return err
+		}
+		return CheckFIPSTemplate(&TPMTPublic{
+			Type:       tmpl.Type,
+			NameAlg:    tmpl.NameAlg,
+			Parameters: tmpl.Parameters,
+		})
+	default:
+		return nil
+	}
+	pub, err := inPublic.Contents()
+	if err != nil {
+		return err
+	}
+	return CheckFIPSTemplate(pub)
+}
+
+// TPMFIPSMode reports whether the TPM is operating in FIPS 140 mode, as
+// indicated by the FIPS_140_2 bit of its TPM_PT_MODES property.
+func TPMFIPSMode(t transport.TPM) (bool, error) {
+	rsp, err := GetCapability{
+		Capability:    TPMCapTPMProperties,
+		Property:      uint32(TPMPTModes),
+		PropertyCount: 1,
+	}.Execute(t)
+	if err != nil {
+		return false, err
+	}
+	props, err := rsp.CapabilityData.Data.TPMProperties()
+	if err != nil {
+		return false, err
+	}
+	if len(props.TPMProperty) == 0 || props.TPMProperty[0].Property != TPMPTModes {
+		return false, fmt.Errorf("TPM did not report TPM_PT_MODES")
+	}
+	return props.TPMProperty[0].Value&1 != 0, nil
+}
@@ -0,0 +1,6 @@
+//go:build !tpm2fips
+
+package tpm2
+
+// fipsEnforced is set by building with the tpm2fips tag.
+const fipsEnforced = false
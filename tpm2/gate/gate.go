@@ -0,0 +1,419 @@
+// Package gate restricts APIs to callers that prove, with a fresh TPM quote,
+// that they run on a known machine in an expected state.
+//
+// A caller first fetches a nonce from the Verifier's NonceHandler, then
+// quotes its PCRs with the nonce as qualifying data and sends the quote
+// with its request in the Tpm-Attestation header. The Verifier's Middleware
+// checks that the quote is signed by a registered AK, over a nonce it issued
+// and that has not been used, and that it meets the AK's policies, before
+// passing the request on:
+//
+//	v := gate.NewVerifier()
+//	v.Register(akPub, gate.PCRPolicy(sel, golden))
+//	mux.Handle("/nonce", v.NonceHandler())
+//	mux.Handle("/secret", v.Middleware(secretHandler))
+//
+// The evidence is a bearer token: it is not bound to the request or to the
+// connection it is sent over, so whoever sees the header first, such as a
+// proxy that terminates TLS, can use it in place of the caller. Send it only
+// over connections the caller trusts end to end. Where that isn't enough,
+// bind quotes to the TLS connection with the tpmtls package's QuoteChannel
+// and VerifyChannelQuote instead.
+//
+// The check does not depend on HTTP. A gRPC server carries the same header
+// value in the "tpm-attestation" metadata key, and its interceptors call
+// Authorize, so that this module does not depend on gRPC:
+//
+//	func(ctx context.Context, req any, info *grpc.UnaryServerInfo, h grpc.UnaryHandler) (any, error) {
+//		md, _ := metadata.FromIncomingContext(ctx)
+//		ctx, err := v.Authorize(ctx, strings.Join(md.Get(gate.MetadataKey), ""))
+//		if err != nil {
+//			return nil, status.Error(codes.PermissionDenied, err.Error())
+//		}
+//		return h(ctx, req)
+//	}
+package gate
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+const (
+	// Header is the HTTP header that carries an Evidence.
+	Header = "Tpm-Attestation"
+	// MetadataKey is the gRPC metadata key that carries an Evidence.
+	MetadataKey = "tpm-attestation"
+	// DefaultNonceLifetime is how long a nonce can be used for if the
+	// Verifier's NonceLifetime is zero.
+	DefaultNonceLifetime = time.Minute
+	// DefaultMaxNonces is how many nonces a Verifier keeps if its
+	// MaxNonces is zero.
+	DefaultMaxNonces = 10000
+	// nonceSize is the size of the nonces the Verifier issues.
+	nonceSize = 32
+)
+
+var (
+	// ErrNoAttestation indicates that a request carries no attestation.
+	ErrNoAttestation = errors.New("no TPM attestation")
+	// ErrUnknownAK indicates that a quote is signed by an AK that is not
+	// registered.
+	ErrUnknownAK = errors.New("attestation key is not registered")
+	// ErrStaleNonce indicates that a quote is not over a nonce the
+	// Verifier issued, or that the nonce has expired or been used.
+	ErrStaleNonce = errors.New("quote is not over a fresh nonce")
+	// ErrPolicy indicates that a quote does not meet a policy.
+	ErrPolicy = errors.New("quote does not meet policy")
+)
+
+// Evidence is a quote as sent by the caller.
+type Evidence struct {
+	// AKName is the Name of the AK that signed the quote.
+	AKName []byte `json:"akName"`
+	// Quoted is the marshalled TPM2B_ATTEST.
+	Quoted []byte `json:"quoted"`
+	// Signature is the marshalled TPMT_SIGNATURE over Quoted.
+	Signature []byte `json:"signature"`
+}
+
+// Attest quotes the PCRs in sel with ak over nonce, as fetched from the
+// Verifier's NonceHandler.
+func Attest(t transport.TPM, ak tpm2.AuthHandle, nonce []byte, sel tpm2.TPMLPCRSelection) (*Evidence, error) {
+	rsp, err := tpm2.Quote{
+		SignHandle:     ak,
+		QualifyingData: tpm2.TPM2BData{Buffer: nonce},
+		InScheme:       tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+		PCRSelect:      sel,
+	}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("quoting: %w", err)
+	}
+	return &Evidence{
+		AKName:    ak.KnownName().Buffer,
+		Quoted:    tpm2.Marshal(rsp.Quoted),
+		Signature: tpm2.Marshal(rsp.Signature),
+	}, nil
+}
+
+// Encode returns e as the value of the Tpm-Attestation header: its JSON
+// encoding in unpadded base64url.
+func (e *Evidence) Encode() (string, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// ParseEvidence parses the value of a Tpm-Attestation header.
+func ParseEvidence(s string) (*Evidence, error) {
+	if s == "" {
+		return nil, ErrNoAttestation
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation: %w", err)
+	}
+	var e Evidence
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("invalid attestation: %w", err)
+	}
+	return &e, nil
+}
+
+// Attestation is a verified quote.
+type Attestation struct {
+	// AK is the public area of the AK that signed the quote.
+	AK *tpm2.TPMTPublic
+	// AKName is its Name.
+	AKName tpm2.TPM2BName
+	// Quote is the quote's contents.
+	Quote *tpm2.TPMSAttest
+	// Info is the quote's PCR selection and digest.
+	Info *tpm2.TPMSQuoteInfo
+	// DigestAlg is the hash algorithm of the signature, with which the TPM
+	// computed the PCR digest.
+	DigestAlg tpm2.TPMIAlgHash
+}
+
+// Policy checks that a quote, whose signature and nonce have been verified,
+// is acceptable. It returns an error if not.
+type Policy func(a *Attestation) error
+
+// PCRPolicy returns a Policy that requires the quote to be over exactly the
+// PCRs in sel, and them to have the values in vals.
+func PCRPolicy(sel tpm2.TPMLPCRSelection, vals tpm2.PCRValues) Policy {
+	return func(a *Attestation) error {
+		if !bytes.Equal(tpm2.Marshal(a.Info.PCRSelect), tpm2.Marshal(sel)) {
+			return fmt.Errorf("%w: quote is not over the required PCRs", ErrPolicy)
+		}
+		want, err := tpm2.PCRCompositeDigest(a.DigestAlg, sel, vals)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(a.Info.PCRDigest.Buffer, want) {
+			return fmt.Errorf("%w: PCR digest %x, want %x", ErrPolicy, a.Info.PCRDigest.Buffer, want)
+		}
+		return nil
+	}
+}
+
+// registeredAK is an AK and the policies its quotes must meet.
+type registeredAK struct {
+	pub      *tpm2.TPMTPublic
+	policies []Policy
+}
+
+// issuedNonce is a nonce and when it expires.
+type issuedNonce struct {
+	nonce  string
+	expiry time.Time
+}
+
+// Verifier issues nonces and verifies quotes over them. It is safe for
+// concurrent use.
+type Verifier struct {
+	// NonceLifetime is how long a nonce can be used for. It defaults to
+	// DefaultNonceLifetime.
+	NonceLifetime time.Duration
+	// MaxNonces bounds the nonces the Verifier keeps, as anyone can ask
+	// the NonceHandler for them. Once MaxNonces have been issued within
+	// the nonce lifetime, issuing another forgets the oldest, which can no
+	// longer be used. It defaults to DefaultMaxNonces.
+	MaxNonces int
+
+	mu     sync.Mutex
+	aks    map[string]registeredAK
+	nonces map[string]time.Time
+	// issued holds the nonces in the order they were issued, including
+	// ones that have since been used, until they expire or are forgotten.
+	issued []issuedNonce
+	now    func() time.Time
+}
+
+// NewVerifier returns a Verifier with no registered AKs.
+func NewVerifier() *Verifier {
+	return &Verifier{
+		aks:    make(map[string]registeredAK),
+		nonces: make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Register trusts quotes signed by ak that meet all of policies, replacing
+// any policies ak was registered with. ak must already be known to be an AK
+// on a genuine TPM, for example through an AK certificate.
+func (v *Verifier) Register(ak *tpm2.TPMTPublic, policies ...Policy) error {
+	name, err := tpm2.ObjectName(ak)
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.aks[hex.EncodeToString(name.Buffer)] = registeredAK{pub: ak, policies: policies}
+	return nil
+}
+
+// Unregister stops trusting quotes signed by ak.
+func (v *Verifier) Unregister(ak *tpm2.TPMTPublic) error {
+	name, err := tpm2.ObjectName(ak)
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.aks, hex.EncodeToString(name.Buffer))
+	return nil
+}
+
+// Nonce returns a new nonce, which a single quote can be verified over
+// within the nonce lifetime.
+func (v *Verifier) Nonce() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	lifetime := v.NonceLifetime
+	if lifetime == 0 {
+		lifetime = DefaultNonceLifetime
+	}
+	maxNonces := v.MaxNonces
+	if maxNonces <= 0 {
+		maxNonces = DefaultMaxNonces
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := v.now()
+	// Forget expired nonces, so that ones never used don't accumulate, and
+	// the oldest ones beyond the limit. Each nonce is forgotten once, so
+	// this takes constant time on average.
+	for len(v.issued) > 0 && (len(v.issued) >= maxNonces || !now.Before(v.issued[0].expiry)) {
+		delete(v.nonces, v.issued[0].nonce)
+		v.issued = v.issued[1:]
+	}
+	v.nonces[string(nonce)] = now.Add(lifetime)
+	v.issued = append(v.issued, issuedNonce{nonce: string(nonce), expiry: now.Add(lifetime)})
+	return nonce, nil
+}
+
+// consumeNonce checks that nonce was issued and has not expired, and
+// forgets it so that it can't be used again.
+func (v *Verifier) consumeNonce(nonce []byte) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	expiry, ok := v.nonces[string(nonce)]
+	delete(v.nonces, string(nonce))
+	return ok && v.now().Before(expiry)
+}
+
+// Verify checks that e is a quote signed by a registered AK over a fresh
+// nonce, and that it meets the AK's policies. The nonce is used up whether
+// or not the quote is accepted.
+func (v *Verifier) Verify(e *Evidence) (*Attestation, error) {
+	v.mu.Lock()
+	ak, ok := v.aks[hex.EncodeToString(e.AKName)]
+	v.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %x", ErrUnknownAK, e.AKName)
+	}
+	quoted, err := tpm2.Unmarshal[tpm2.TPM2BAttest](e.Quoted)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quote: %w", err)
+	}
+	sig, err := tpm2.Unmarshal[tpm2.TPMTSignature](e.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	attest, err := tpm2.VerifyAttestation(ak.pub, quoted, sig)
+	if err != nil {
+		return nil, fmt.Errorf("verifying quote: %w", err)
+	}
+	if attest.Type != tpm2.TPMSTAttestQuote {
+		return nil, fmt.Errorf("attestation is not a quote: %v", attest.Type)
+	}
+	if !v.consumeNonce(attest.ExtraData.Buffer) {
+		return nil, ErrStaleNonce
+	}
+	info, err := attest.Attested.Quote()
+	if err != nil {
+		return nil, err
+	}
+	alg, err := signatureHash(sig)
+	if err != nil {
+		return nil, err
+	}
+	a := &Attestation{
+		AK:        ak.pub,
+		AKName:    tpm2.TPM2BName{Buffer: e.AKName},
+		Quote:     attest,
+		Info:      info,
+		DigestAlg: alg,
+	}
+	for _, p := range ak.policies {
+		if err := p(a); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// signatureHash returns the hash algorithm of a signature.
+func signatureHash(sig *tpm2.TPMTSignature) (tpm2.TPMIAlgHash, error) {
+	switch sig.SigAlg {
+	case tpm2.TPMAlgRSASSA:
+		s, err := sig.Signature.RSASSA()
+		if err != nil {
+			return 0, err
+		}
+		return s.Hash, nil
+	case tpm2.TPMAlgRSAPSS:
+		s, err := sig.Signature.RSAPSS()
+		if err != nil {
+			return 0, err
+		}
+		return s.Hash, nil
+	case tpm2.TPMAlgECDSA:
+		s, err := sig.Signature.ECDSA()
+		if err != nil {
+			return 0, err
+		}
+		return s.Hash, nil
+	}
+	return 0, fmt.Errorf("unsupported signature algorithm %v", sig.SigAlg)
+}
+
+// contextKey is the key of the Attestation in a request's context.
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that carries a.
+func NewContext(ctx context.Context, a *Attestation) context.Context {
+	return context.WithValue(ctx, contextKey{}, a)
+}
+
+// FromContext returns the Attestation that authorized a request, if any.
+func FromContext(ctx context.Context) (*Attestation, bool) {
+	a, ok := ctx.Value(contextKey{}).(*Attestation)
+	return a, ok
+}
+
+// Authorize verifies the value of a Tpm-Attestation header or metadata
+// key, and returns a copy of ctx that carries the Attestation.
+func (v *Verifier) Authorize(ctx context.Context, header string) (context.Context, error) {
+	e, err := ParseEvidence(header)
+	if err != nil {
+		return nil, err
+	}
+	a, err := v.Verify(e)
+	if err != nil {
+		return nil, err
+	}
+	return NewContext(ctx, a), nil
+}
+
+// Middleware returns a handler that passes requests with a valid
+// Tpm-Attestation header on to next, with the Attestation in their
+// context, and rejects the others with 401 Unauthorized.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := v.Authorize(r.Context(), r.Header.Get(Header))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// NonceHandler returns a handler that responds to POST requests with a new
+// nonce, in base64. Nonces must not be cached, so other methods are
+// rejected.
+func (v *Verifier) NonceHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		nonce, err := v.Nonce()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, base64.StdEncoding.EncodeToString(nonce))
+	})
+}
@@ -0,0 +1,213 @@
+package gate
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestMiddleware(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	newAK := func(profile tpm2.Profile) (tpm2.AuthHandle, *tpm2.TPMTPublic) {
+		rsp, err := tpm2.CreatePrimary{
+			PrimaryHandle: tpm2.TPMRHOwner,
+			InPublic:      tpm2.New2B(profile.AKTemplate()),
+		}.Execute(thetpm)
+		if err != nil {
+			t.Fatalf("could not create AK: %v", err)
+		}
+		t.Cleanup(func() { tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm) })
+		pub, err := rsp.OutPublic.Contents()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		return tpm2.AuthHandle{Handle: rsp.ObjectHandle, Name: rsp.Name, Auth: tpm2.PasswordAuth(nil)}, pub
+	}
+	ak, akPub := newAK(tpm2.Profile{Type: tpm2.TPMAlgECC, Curve: tpm2.TPMECCNistP256, Hash: tpm2.TPMAlgSHA256})
+	other, _ := newAK(tpm2.Profile{Type: tpm2.TPMAlgRSA, KeyBits: 2048, Hash: tpm2.TPMAlgSHA256})
+
+	sel := tpm2.TPMLPCRSelection{PCRSelections: []tpm2.TPMSPCRSelection{{
+		Hash:      tpm2.TPMAlgSHA256,
+		PCRSelect: tpm2.PCClientCompatible.PCRs(0, 7),
+	}}}
+	golden, err := tpm2.ReadPCRs(thetpm, sel)
+	if err != nil {
+		t.Fatalf("ReadPCRs: %v", err)
+	}
+
+	v := NewVerifier()
+	if err := v.Register(akPub, PCRPolicy(sel, golden)); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/nonce", v.NonceHandler())
+	mux.Handle("/secret", v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := FromContext(r.Context()); !ok {
+			t.Errorf("request has no attestation in its context")
+		}
+		io.WriteString(w, "secret")
+	})))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	nonce := func() []byte {
+		rsp, err := http.Post(srv.URL+"/nonce", "", nil)
+		if err != nil {
+			t.Fatalf("fetching nonce: %v", err)
+		}
+		defer rsp.Body.Close()
+		body, err := io.ReadAll(rsp.Body)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		n, err := base64.StdEncoding.DecodeString(string(body))
+		if err != nil {
+			t.Fatalf("nonce %q: %v", body, err)
+		}
+		return n
+	}
+	attest := func(ak tpm2.AuthHandle, nonce []byte, sel tpm2.TPMLPCRSelection) string {
+		e, err := Attest(thetpm, ak, nonce, sel)
+		if err != nil {
+			t.Fatalf("Attest: %v", err)
+		}
+		h, err := e.Encode()
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		return h
+	}
+	get := func(header string) int {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/secret", nil)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if header != "" {
+			req.Header.Set(Header, header)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		rsp.Body.Close()
+		return rsp.StatusCode
+	}
+
+	good := attest(ak, nonce(), sel)
+	if code := get(good); code != http.StatusOK {
+		t.Errorf("attested request: status %d, want %d", code, http.StatusOK)
+	}
+	if code := get(good); code != http.StatusUnauthorized {
+		t.Errorf("replayed attestation: status %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := get(""); code != http.StatusUnauthorized {
+		t.Errorf("unattested request: status %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := get(attest(ak, []byte("made-up nonce"), sel)); code != http.StatusUnauthorized {
+		t.Errorf("attestation over unissued nonce: status %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := get(attest(other, nonce(), sel)); code != http.StatusUnauthorized {
+		t.Errorf("attestation by unregistered AK: status %d, want %d", code, http.StatusUnauthorized)
+	}
+	rsp, err := http.Get(srv.URL + "/nonce")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /nonce: status %d, want %d", rsp.StatusCode, http.StatusMethodNotAllowed)
+	}
+
+	// Errors are distinguishable for callers of Verify.
+	parse := func(h string) *Evidence {
+		e, err := ParseEvidence(h)
+		if err != nil {
+			t.Fatalf("ParseEvidence: %v", err)
+		}
+		return e
+	}
+	if _, err := v.Verify(parse(good)); !errors.Is(err, ErrStaleNonce) {
+		t.Errorf("Verify(replayed) = %v, want %v", err, ErrStaleNonce)
+	}
+	if _, err := v.Verify(parse(attest(other, nonce(), sel))); !errors.Is(err, ErrUnknownAK) {
+		t.Errorf("Verify(unregistered AK) = %v, want %v", err, ErrUnknownAK)
+	}
+	otherSel := tpm2.TPMLPCRSelection{PCRSelections: []tpm2.TPMSPCRSelection{{
+		Hash:      tpm2.TPMAlgSHA256,
+		PCRSelect: tpm2.PCClientCompatible.PCRs(0),
+	}}}
+	if _, err := v.Verify(parse(attest(ak, nonce(), otherSel))); !errors.Is(err, ErrPolicy) {
+		t.Errorf("Verify(other PCRs) = %v, want %v", err, ErrPolicy)
+	}
+	extend := tpm2.PCRExtend{
+		PCRHandle: tpm2.AuthHandle{Handle: tpm2.TPMHandle(7), Auth: tpm2.PasswordAuth(nil)},
+		Digests: tpm2.TPMLDigestValues{Digests: []tpm2.TPMTHA{{
+			HashAlg: tpm2.TPMAlgSHA256,
+			Digest:  make([]byte, 32),
+		}}},
+	}
+	if _, err := extend.Execute(thetpm); err != nil {
+		t.Fatalf("PCRExtend: %v", err)
+	}
+	if _, err := v.Verify(parse(attest(ak, nonce(), sel))); !errors.Is(err, ErrPolicy) {
+		t.Errorf("Verify(changed PCR) = %v, want %v", err, ErrPolicy)
+	}
+	if _, err := ParseEvidence(""); !errors.Is(err, ErrNoAttestation) {
+		t.Errorf("ParseEvidence(\"\") = %v, want %v", err, ErrNoAttestation)
+	}
+
+	// Nonces expire.
+	now := time.Now()
+	v.now = func() time.Time { return now }
+	n := nonce()
+	now = now.Add(DefaultNonceLifetime)
+	if _, err := v.Verify(parse(attest(ak, n, sel))); !errors.Is(err, ErrStaleNonce) {
+		t.Errorf("Verify(expired nonce) = %v, want %v", err, ErrStaleNonce)
+	}
+}
+
+func TestNonceLimit(t *testing.T) {
+	v := NewVerifier()
+	v.MaxNonces = 3
+	now := time.Now()
+	v.now = func() time.Time { return now }
+
+	var nonces [][]byte
+	for range 4 {
+		n, err := v.Nonce()
+		if err != nil {
+			t.Fatalf("Nonce: %v", err)
+		}
+		nonces = append(nonces, n)
+	}
+	if len(v.nonces) != 3 || len(v.issued) != 3 {
+		t.Errorf("Verifier keeps %d nonces in a queue of %d, want 3", len(v.nonces), len(v.issued))
+	}
+	if v.consumeNonce(nonces[0]) {
+		t.Errorf("the oldest nonce is still usable beyond MaxNonces")
+	}
+	if !v.consumeNonce(nonces[3]) {
+		t.Errorf("the newest nonce is not usable")
+	}
+
+	// Expired nonces are forgotten when the next one is issued.
+	now = now.Add(DefaultNonceLifetime)
+	if _, err := v.Nonce(); err != nil {
+		t.Fatalf("Nonce: %v", err)
+	}
+	if len(v.nonces) != 1 || len(v.issued) != 1 {
+		t.Errorf("Verifier keeps %d nonces in a queue of %d after they expired, want 1", len(v.nonces), len(v.issued))
+	}
+}
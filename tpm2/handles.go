@@ -0,0 +1,94 @@
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/handles"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// GetHandles returns all handles of the given type (for example,
+// TPMHTTransient or TPMHTPersistent) that are currently in the TPM, in
+// ascending order. Asking for TPMHTHMACSession returns all loaded sessions,
+// and TPMHTPolicySession all saved sessions, of either kind.
+func GetHandles(t transport.TPM, ht TPMHT) ([]TPMHandle, error) {
+	var handles []TPMHandle
+	prop := uint32(ht) << 24
+	for {
+		rsp, err := GetCapability{
+			Capability:    TPMCapHandles,
+			Property:      prop,
+			PropertyCount: 64,
+		}.Execute(t)
+		if err != nil {
+			return nil, err
+		}
+		hs, err := rsp.CapabilityData.Data.Handles()
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range hs.Handle {
+			if !isHandleType(h, ht) {
+				return handles, nil
+			}
+			handles = append(handles, h)
+		}
+		if !rsp.MoreData || len(hs.Handle) == 0 {
+			return handles, nil
+		}
+		prop = uint32(hs.Handle[len(hs.Handle)-1]) + 1
+	}
+}
+
+// isHandleType reports whether h should be returned when listing handles of
+// type ht. The TPM lists HMAC and policy sessions together.
+func isHandleType(h TPMHandle, ht TPMHT) bool {
+	if ht == TPMHTHMACSession || ht == TPMHTPolicySession {
+		return handles.IsSession(h)
+	}
+	return TPMHT(handles.Type(h)) == ht
+}
+
+// FlushAllTransient flushes every transient object currently loaded in the
+// TPM, for example to clean up after a process that crashed without flushing
+// its objects. It returns the handles that were flushed. Failing to flush one
+// object does not stop the others from being flushed.
+//
+// On a TPM shared through a resource manager, this only affects the objects
+// visible to this connection.
+func FlushAllTransient(t transport.TPM) ([]TPMHandle, error) {
+	handles, err := GetHandles(t, TPMHTTransient)
+	if err != nil {
+		return nil, err
+	}
+	return flushAll(t, handles)
+}
+
+// FlushAllSessions flushes every HMAC and policy session known to the TPM,
+// whether loaded or saved, and returns the handles that were flushed. Like
+// FlushAllTransient, it carries on past individual failures.
+func FlushAllSessions(t transport.TPM) ([]TPMHandle, error) {
+	loaded, err := GetHandles(t, TPMHTHMACSession)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := GetHandles(t, TPMHTPolicySession)
+	if err != nil {
+		return nil, err
+	}
+	return flushAll(t, append(loaded, saved...))
+}
+
+func flushAll(t transport.TPM, handles []TPMHandle) ([]TPMHandle, error) {
+	var flushed []TPMHandle
+	var errs []error
+	for _, h := range handles {
+		if _, err := (FlushContext{FlushHandle: h}).Execute(t); err != nil {
+			errs = append(errs, fmt.Errorf("flushing 0x%08x: %w", uint32(h), err))
+			continue
+		}
+		flushed = append(flushed, h)
+	}
+	return flushed, errors.Join(errs...)
+}
@@ -0,0 +1,168 @@
+// Package handles defines the handles and handle ranges that the TPM 2.0
+// architecture assigns, with predicates to classify handles by range.
+//
+// The constants are untyped and the predicates accept any handle type based
+// on uint32, so they work with both tpm2.TPMHandle and the legacy API's
+// tpmutil.Handle:
+//
+//	if handles.IsPersistent(h) { ... }
+//	tpm2.ReadPublic{ObjectHandle: handles.PersistentFirst}
+//
+// See Part 2: Structures, sections 7.2 to 7.4.
+package handles
+
+// Handle types: the most significant octet of a handle (TPM_HT).
+const (
+	TypePCR           = 0x00
+	TypeNVIndex       = 0x01
+	TypeHMACSession   = 0x02
+	TypePolicySession = 0x03
+	TypePermanent     = 0x40
+	TypeTransient     = 0x80
+	TypePersistent    = 0x81
+	TypeAC            = 0x90
+)
+
+// Handle ranges (TPM_HC). Each range runs from First to Last, inclusive.
+const (
+	PCRFirst = 0x00000000
+	// PCRLast is the last PCR a TPM may implement. Most implement 24.
+	PCRLast = 0x0000001F
+
+	NVIndexFirst = 0x01000000
+	NVIndexLast  = 0x01FFFFFF
+
+	HMACSessionFirst   = 0x02000000
+	HMACSessionLast    = 0x02FFFFFF
+	PolicySessionFirst = 0x03000000
+	PolicySessionLast  = 0x03FFFFFF
+
+	PermanentFirst = 0x40000000
+	PermanentLast  = 0x40FFFFFF
+
+	TransientFirst = 0x80000000
+	TransientLast  = 0x80FFFFFF
+
+	PersistentFirst = 0x81000000
+	PersistentLast  = 0x81FFFFFF
+	// Persistent handles from PlatformPersistentFirst are for the platform
+	// hierarchy; those below it for the owner's.
+	PlatformPersistentFirst = 0x81800000
+
+	ACFirst = 0x90000000
+	ACLast  = 0x90FFFFFF
+)
+
+// Permanent handles (TPM_RH and TPM_RS).
+const (
+	Owner = 0x40000001
+	// Revoke, Transport, Operator, Admin, EK and Unassigned are reserved.
+	Revoke          = 0x40000002
+	Transport       = 0x40000003
+	Operator        = 0x40000004
+	Admin           = 0x40000005
+	EK              = 0x40000006
+	Null            = 0x40000007
+	Unassigned      = 0x40000008
+	PasswordSession = 0x40000009
+	Lockout         = 0x4000000A
+	Endorsement     = 0x4000000B
+	Platform        = 0x4000000C
+	PlatformNV      = 0x4000000D
+
+	// Auth00 to AuthFF are vendor-specific authorization handles.
+	Auth00 = 0x40000010
+	AuthFF = 0x4000010F
+
+	// ACT0 to ACTF are the authenticated countdown timers.
+	ACT0 = 0x40000110
+	ACTF = 0x4000011F
+
+	FWOwner       = 0x40000140
+	FWEndorsement = 0x40000141
+	FWPlatform    = 0x40000142
+	FWNull        = 0x40000143
+)
+
+// Type returns the type of h, its most significant octet.
+func Type[H ~uint32](h H) uint8 {
+	return uint8(h >> 24)
+}
+
+// IsPCR reports whether h is a PCR.
+func IsPCR[H ~uint32](h H) bool {
+	return h <= PCRLast
+}
+
+// IsNV reports whether h is an NV index.
+func IsNV[H ~uint32](h H) bool {
+	return Type(h) == TypeNVIndex
+}
+
+// IsHMACSession reports whether h is a loaded HMAC session.
+func IsHMACSession[H ~uint32](h H) bool {
+	return Type(h) == TypeHMACSession
+}
+
+// IsPolicySession reports whether h is a loaded policy session.
+func IsPolicySession[H ~uint32](h H) bool {
+	return Type(h) == TypePolicySession
+}
+
+// IsSession reports whether h is a loaded HMAC or policy session. The
+// password pseudo-session, PasswordSession, is a permanent handle instead.
+func IsSession[H ~uint32](h H) bool {
+	return IsHMACSession(h) || IsPolicySession(h)
+}
+
+// IsPermanent reports whether h is a permanent handle, such as a hierarchy.
+func IsPermanent[H ~uint32](h H) bool {
+	return Type(h) == TypePermanent
+}
+
+// IsHierarchy reports whether h is one of the hierarchies that own
+// objects: owner, endorsement, platform or null.
+func IsHierarchy[H ~uint32](h H) bool {
+	switch h {
+	case Owner, Endorsement, Platform, Null:
+		return true
+	}
+	return false
+}
+
+// IsACT reports whether h is an authenticated countdown timer.
+func IsACT[H ~uint32](h H) bool {
+	return h >= ACT0 && h <= ACTF
+}
+
+// IsTransient reports whether h is a transient object.
+func IsTransient[H ~uint32](h H) bool {
+	return Type(h) == TypeTransient
+}
+
+// IsPersistent reports whether h is a persistent object.
+func IsPersistent[H ~uint32](h H) bool {
+	return Type(h) == TypePersistent
+}
+
+// IsPlatformPersistent reports whether h is a persistent object in the
+// range reserved for the platform hierarchy.
+func IsPlatformPersistent[H ~uint32](h H) bool {
+	return h >= PlatformPersistentFirst && h <= PersistentLast
+}
+
+// IsAC reports whether h is an attached component.
+func IsAC[H ~uint32](h H) bool {
+	return Type(h) == TypeAC
+}
+
+// HasKnownName reports whether the Name of h is the handle itself, as for
+// PCRs, sessions and permanent handles, rather than a digest of the entity's
+// public area, as for objects and NV indices.
+func HasKnownName[H ~uint32](h H) bool {
+	switch Type(h) {
+	case TypePCR, TypeHMACSession, TypePolicySession, TypePermanent:
+		return true
+	}
+	return false
+}
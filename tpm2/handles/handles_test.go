@@ -0,0 +1,64 @@
+package handles
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// handle stands in for tpm2.TPMHandle, which can't be imported here.
+type handle uint32
+
+func TestPredicates(t *testing.T) {
+	for _, tc := range []struct {
+		h    handle
+		want []string
+	}{
+		{0x00000007, []string{"PCR", "KnownName"}},
+		{0x01c00002, []string{"NV"}},
+		{0x02000001, []string{"HMACSession", "Session", "KnownName"}},
+		{0x03000001, []string{"PolicySession", "Session", "KnownName"}},
+		{Owner, []string{"Permanent", "Hierarchy", "KnownName"}},
+		{PasswordSession, []string{"Permanent", "KnownName"}},
+		{ACT0 + 2, []string{"Permanent", "ACT", "KnownName"}},
+		{0x80000001, []string{"Transient"}},
+		{0x81000001, []string{"Persistent"}},
+		{0x81800001, []string{"Persistent", "PlatformPersistent"}},
+		{0x90000001, []string{"AC"}},
+	} {
+		got := map[string]bool{
+			"PCR":                IsPCR(tc.h),
+			"NV":                 IsNV(tc.h),
+			"HMACSession":        IsHMACSession(tc.h),
+			"PolicySession":      IsPolicySession(tc.h),
+			"Session":            IsSession(tc.h),
+			"Permanent":          IsPermanent(tc.h),
+			"Hierarchy":          IsHierarchy(tc.h),
+			"ACT":                IsACT(tc.h),
+			"Transient":          IsTransient(tc.h),
+			"Persistent":         IsPersistent(tc.h),
+			"PlatformPersistent": IsPlatformPersistent(tc.h),
+			"AC":                 IsAC(tc.h),
+			"KnownName":          HasKnownName(tc.h),
+		}
+		want := make(map[string]bool)
+		for _, p := range tc.want {
+			want[p] = true
+		}
+		for p, v := range got {
+			if v != want[p] {
+				t.Errorf("Is%s(%#x) = %v, want %v", p, uint32(tc.h), v, want[p])
+			}
+		}
+	}
+}
+
+func TestLegacyHandle(t *testing.T) {
+	var h tpmutil.Handle = PersistentFirst + 1
+	if !IsPersistent(h) || Type(h) != TypePersistent {
+		t.Errorf("IsPersistent(%#x) = false", h)
+	}
+	if IsHierarchy(tpmutil.Handle(PlatformNV)) {
+		t.Errorf("IsHierarchy(PlatformNV) = true")
+	}
+}
@@ -0,0 +1,59 @@
+package tpm2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrNoHashAlg is returned by NegotiateHashAlg and Features.HashAlg when the
+// TPM implements none of the acceptable hash algorithms.
+var ErrNoHashAlg = errors.New("TPM implements none of the acceptable hash algorithms")
+
+// defaultHashAlgs are the hash algorithms helpers use, in order of
+// preference, when the caller doesn't choose one. SM3 isn't among them: the
+// standard library can't compute it, so neither can this package.
+var defaultHashAlgs = []TPMIAlgHash{TPMAlgSHA256, TPMAlgSHA384, TPMAlgSHA512, TPMAlgSHA1}
+
+// HashAlg returns the first of prefs that the TPM implements and this
+// package can compute, for use as a name algorithm, session hash or policy
+// hash. With no prefs, it prefers SHA-256, then SHA-384, SHA-512 and SHA-1.
+func (f *Features) HashAlg(prefs ...TPMIAlgHash) (TPMIAlgHash, error) {
+	if len(prefs) == 0 {
+		prefs = defaultHashAlgs
+	}
+	for _, alg := range prefs {
+		if _, err := alg.Hash(); err == nil && f.HasAlgorithm(alg) {
+			return alg, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %v", ErrNoHashAlg, prefs)
+}
+
+// NegotiateHashAlg reads the TPM's algorithms and returns the first of
+// prefs that it implements, as Features.HashAlg does. Callers that would
+// otherwise hard-code SHA-256 can use it to pick a hash algorithm that works
+// on TPMs, such as those of SHA-384-only profiles, that don't implement
+// SHA-256.
+func NegotiateHashAlg(t transport.TPM, prefs ...TPMIAlgHash) (TPMIAlgHash, error) {
+	f := Features{algs: make(map[TPMAlgID]bool)}
+	if err := readAlgorithms(t, f.algs); err != nil {
+		return 0, err
+	}
+	return f.HashAlg(prefs...)
+}
+
+// NameHashAlg returns the name algorithm of an object or NV index from its
+// Name, which starts with it.
+func NameHashAlg(name TPM2BName) (TPMIAlgHash, error) {
+	if len(name.Buffer) <= 4 {
+		return 0, fmt.Errorf("name %x is a handle, not a digest", name.Buffer)
+	}
+	alg := TPMIAlgHash(binary.BigEndian.Uint16(name.Buffer))
+	if _, err := alg.Hash(); err != nil {
+		return 0, err
+	}
+	return alg, nil
+}
@@ -0,0 +1,268 @@
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrNoTicket is returned by HashData when a validation ticket was asked for
+// but the TPM did not produce one, because the data starts with
+// TPM_GENERATED_VALUE. Restricted keys refuse to sign such data, as it could
+// pass for an attestation.
+var ErrNoTicket = errors.New("TPM produced no validation ticket")
+
+// maxDigestBuffer is MAX_DIGEST_BUFFER of the PC Client platform, the most
+// data that TPM2_Hash and TPM2_SequenceUpdate take at once.
+const maxDigestBuffer = 1024
+
+// hashOptions configures HashData.
+type hashOptions struct {
+	hierarchy TPMIRHHierarchy
+}
+
+// HashOption is an option for HashData.
+type HashOption func(*hashOptions)
+
+// HashHierarchy makes HashData produce the validation ticket in the given
+// hierarchy. The default is the owner hierarchy. A ticket is computed with
+// its hierarchy's proof, so it stops being valid if the hierarchy is
+// disabled or its proof changes, as the owner's does with TPM2_Clear.
+func HashHierarchy(h TPMIRHHierarchy) HashOption {
+	return func(o *hashOptions) {
+		o.hierarchy = h
+	}
+}
+
+// HashWithoutTicket makes HashData hash in the NULL hierarchy and return a
+// NULL ticket, which is enough for a digest that an unrestricted key will
+// sign or that is not to be signed at all. It is the same as
+// HashHierarchy(TPMRHNull).
+func HashWithoutTicket() HashOption {
+	return HashHierarchy(TPMRHNull)
+}
+
+// NullTicket returns the NULL validation ticket, which an unrestricted key
+// accepts in place of a ticket from HashData.
+func NullTicket() TPMTTKHashCheck {
+	return TPMTTKHashCheck{
+		Tag:       TPMSTHashCheck,
+		Hierarchy: TPMRHNull,
+	}
+}
+
+// HashData hashes data with the TPM, so that a restricted key can sign the
+// digest with TPM2_Sign, and returns the digest and the validation ticket.
+// Data that fits in a single command is hashed with TPM2_Hash, and longer
+// data with a hash sequence.
+//
+// Unless HashWithoutTicket is used, ErrNoTicket is returned for data that the
+// TPM refuses to produce a ticket for, rather than a NULL ticket that would
+// only fail when the digest is signed.
+func HashData(t transport.TPM, alg TPMIAlgHash, data []byte, opts ...HashOption) ([]byte, *TPMTTKHashCheck, error) {
+	o := hashOptions{hierarchy: TPMRHOwner}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var digest TPM2BDigest
+	var ticket TPMTTKHashCheck
+	if len(data) <= maxDigestBuffer {
+		rsp, err := Hash{
+			Data:      TPM2BMaxBuffer{Buffer: data},
+			HashAlg:   alg,
+			Hierarchy: o.hierarchy,
+		}.Execute(t)
+		if err != nil {
+			return nil, nil, err
+		}
+		digest, ticket = rsp.OutHash, rsp.Validation
+	} else {
+		rsp, err := hashSequence(t, alg, data, o.hierarchy)
+		if err != nil {
+			return nil, nil, err
+		}
+		digest, ticket = rsp.Result, rsp.Validation
+	}
+	if err := checkTicket(&o, &ticket); err != nil {
+		return nil, nil, err
+	}
+	return digest.Buffer, &ticket, nil
+}
+
+// checkTicket returns ErrNoTicket if a ticket was asked for and the TPM
+// returned a NULL one.
+func checkTicket(o *hashOptions, ticket *TPMTTKHashCheck) error {
+	if o.hierarchy != TPMRHNull && ticket.Hierarchy == TPMRHNull {
+		return fmt.Errorf("%w: data starts with TPM_GENERATED_VALUE", ErrNoTicket)
+	}
+	return nil
+}
+
+// hashSequence hashes data with a hash sequence, producing the ticket in
+// hierarchy.
+func hashSequence(t transport.TPM, alg TPMIAlgHash, data []byte, hierarchy TPMIRHHierarchy) (*SequenceCompleteResponse, error) {
+	w, err := NewHashWriter(t, alg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w.complete(hierarchy)
+}
+
+// SequenceWriter streams data written to it into a TPM hash or event
+// sequence, in pieces the TPM accepts, so that data of any size can be
+// hashed or measured by the TPM without holding it all in memory. It must be
+// finished with Sum or Extend, or discarded with Close.
+type SequenceWriter struct {
+	tpm   transport.TPM
+	seq   AuthHandle
+	event bool
+	// buf holds data not yet sent, up to maxDigestBuffer bytes: the last
+	// piece is sent with the command that completes the sequence.
+	buf  []byte
+	err  error
+	done bool
+}
+
+// NewHashWriter starts a hash sequence with alg, whose digest Sum returns.
+func NewHashWriter(t transport.TPM, alg TPMIAlgHash) (*SequenceWriter, error) {
+	return newSequenceWriter(t, alg)
+}
+
+// NewEventWriter starts an event sequence, which hashes the data with every
+// implemented PCR bank and which Extend measures into a PCR.
+func NewEventWriter(t transport.TPM) (*SequenceWriter, error) {
+	return newSequenceWriter(t, TPMAlgNull)
+}
+
+func newSequenceWriter(t transport.TPM, alg TPMIAlgHash) (*SequenceWriter, error) {
+	rsp, err := HashSequenceStart{HashAlg: alg}.Execute(t)
+	if err != nil {
+		return nil, err
+	}
+	return &SequenceWriter{
+		tpm:   t,
+		seq:   AuthHandle{Handle: rsp.SequenceHandle, Auth: PasswordAuth(nil)},
+		event: alg == TPMAlgNull,
+		buf:   make([]byte, 0, maxDigestBuffer),
+	}, nil
+}
+
+// Write implements io.Writer. An error from the TPM is returned by this and
+// every later call.
+func (w *SequenceWriter) Write(p []byte) (int, error) {
+	if w.done {
+		return 0, errors.New("sequence is complete")
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := len(p)
+	for len(w.buf)+len(p) > maxDigestBuffer {
+		chunk := p
+		if len(w.buf) != 0 {
+			m := maxDigestBuffer - len(w.buf)
+			w.buf = append(w.buf, p[:m]...)
+			chunk, p = w.buf, p[m:]
+		} else {
+			chunk, p = p[:maxDigestBuffer], p[maxDigestBuffer:]
+		}
+		if _, err := (SequenceUpdate{
+			SequenceHandle: w.seq,
+			Buffer:         TPM2BMaxBuffer{Buffer: chunk},
+		}).Execute(w.tpm); err != nil {
+			w.err = err
+			return 0, err
+		}
+		w.buf = w.buf[:0]
+	}
+	w.buf = append(w.buf, p...)
+	return n, nil
+}
+
+// Sum completes a hash sequence and returns the digest and validation
+// ticket, as HashData does.
+func (w *SequenceWriter) Sum(opts ...HashOption) ([]byte, *TPMTTKHashCheck, error) {
+	if w.event {
+		return nil, nil, errors.New("Sum called on an event sequence")
+	}
+	o := hashOptions{hierarchy: TPMRHOwner}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	rsp, err := w.complete(o.hierarchy)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkTicket(&o, &rsp.Validation); err != nil {
+		return nil, nil, err
+	}
+	return rsp.Result.Buffer, &rsp.Validation, nil
+}
+
+// complete sends the rest of the data with TPM2_SequenceComplete.
+func (w *SequenceWriter) complete(hierarchy TPMIRHHierarchy) (*SequenceCompleteResponse, error) {
+	if err := w.finish(); err != nil {
+		return nil, err
+	}
+	rsp, err := SequenceComplete{
+		SequenceHandle: w.seq,
+		Buffer:         TPM2BMaxBuffer{Buffer: w.buf},
+		Hierarchy:      hierarchy,
+	}.Execute(w.tpm)
+	if err != nil {
+		// The sequence is only flushed when it completes.
+		FlushContext{FlushHandle: w.seq.Handle}.Execute(w.tpm)
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// Extend completes an event sequence, extending pcr with the digests of the
+// data, and returns them. pcr may be TPMRHNull to only compute the digests.
+func (w *SequenceWriter) Extend(pcr handle) (*TPMLDigestValues, error) {
+	if !w.event {
+		return nil, errors.New("Extend called on a hash sequence")
+	}
+	if err := w.finish(); err != nil {
+		return nil, err
+	}
+	rsp, err := EventSequenceComplete{
+		PCRHandle:      pcr,
+		SequenceHandle: w.seq,
+		Buffer:         TPM2BMaxBuffer{Buffer: w.buf},
+	}.Execute(w.tpm)
+	if err != nil {
+		FlushContext{FlushHandle: w.seq.Handle}.Execute(w.tpm)
+		return nil, err
+	}
+	return &rsp.Results, nil
+}
+
+// finish marks the sequence as complete, flushing it if a write failed.
+func (w *SequenceWriter) finish() error {
+	if w.done {
+		return errors.New("sequence is complete")
+	}
+	w.done = true
+	if w.err != nil {
+		FlushContext{FlushHandle: w.seq.Handle}.Execute(w.tpm)
+		return w.err
+	}
+	return nil
+}
+
+// Close flushes the sequence if it was not completed.
+func (w *SequenceWriter) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	_, err := FlushContext{FlushHandle: w.seq.Handle}.Execute(w.tpm)
+	return err
+}
@@ -0,0 +1,185 @@
+package tpm2
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ImportedKey is a software key that has been imported under a TPM parent.
+type ImportedKey struct {
+	// Public is the public area of the key.
+	Public TPM2BPublic
+	// Private is the key's private area, wrapped by the parent. Together
+	// with Public, it can be loaded again with TPM2_Load.
+	Private TPM2BPrivate
+	// Handle is the key, loaded under the parent. The caller must flush
+	// it when done.
+	Handle NamedHandle
+}
+
+// ImportPEM imports a PEM-encoded RSA or ECDSA private key, in PKCS #8,
+// PKCS #1 or SEC 1 form, under parent. See ImportKey.
+func ImportPEM(t transport.TPM, parent AuthHandle, pemData []byte, userAuth []byte) (*ImportedKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	var key crypto.PrivateKey
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ImportKey(t, parent, key, userAuth)
+}
+
+// ImportKey imports an *rsa.PrivateKey or *ecdsa.PrivateKey under parent as
+// a signing key with the given authorization value, and loads it.
+//
+// The key travels to the TPM as a duplicate with an outer wrapper keyed to
+// the parent, so only that parent can import it. The key is not fixedTPM:
+// it existed outside the TPM, and may still. It takes the parent's name
+// algorithm.
+func ImportKey(t transport.TPM, parent AuthHandle, key crypto.PrivateKey, userAuth []byte) (*ImportedKey, error) {
+	parentPub, err := ReadPublic{ObjectHandle: parent.Handle}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("reading parent: %w", err)
+	}
+	if len(parent.Name.Buffer) == 0 {
+		parent.Name = parentPub.Name
+	}
+	pp, err := parentPub.OutPublic.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	pub, sens, err := importTemplate(key, pp.NameAlg)
+	if err != nil {
+		return nil, err
+	}
+	sens.AuthValue = TPM2BAuth{Buffer: userAuth}
+	ha, err := pub.NameAlg.Hash()
+	if err != nil {
+		return nil, err
+	}
+	sens.SeedValue = TPM2BDigest{Buffer: make([]byte, ha.Size())}
+	if _, err := rand.Read(sens.SeedValue.Buffer); err != nil {
+		return nil, err
+	}
+
+	dup, err := WrapDuplicate(pp, pub, sens, TPMTSymDef{Algorithm: TPMAlgNull})
+	if err != nil {
+		return nil, err
+	}
+
+	publicArea := New2B(*pub)
+	imported, err := Import{
+		ParentHandle: parent,
+		ObjectPublic: publicArea,
+		Duplicate:    dup.Duplicate,
+		InSymSeed:    dup.OutSymSeed,
+		Symmetric:    TPMTSymDef{Algorithm: TPMAlgNull},
+	}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("importing key: %w", err)
+	}
+	loaded, err := Load{
+		ParentHandle: parent,
+		InPrivate:    imported.OutPrivate,
+		InPublic:     publicArea,
+	}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("loading imported key: %w", err)
+	}
+	return &ImportedKey{
+		Public:  publicArea,
+		Private: imported.OutPrivate,
+		Handle:  NamedHandle{Handle: loaded.ObjectHandle, Name: loaded.Name},
+	}, nil
+}
+
+// importTemplate returns the public and sensitive areas for key, with name
+// algorithm nameAlg.
+func importTemplate(key crypto.PrivateKey, nameAlg TPMIAlgHash) (*TPMTPublic, *TPMTSensitive, error) {
+	attrs := TPMAObject{
+		UserWithAuth: true,
+		SignEncrypt:  true,
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, nil, fmt.Errorf("RSA keys with %d primes are not supported", len(k.Primes))
+		}
+		exponent := uint32(k.E)
+		if k.E == 65537 {
+			// The TPM's encoding of the default exponent.
+			exponent = 0
+		}
+		return &TPMTPublic{
+			Type:             TPMAlgRSA,
+			NameAlg:          nameAlg,
+			ObjectAttributes: attrs,
+			Parameters: NewTPMUPublicParms(TPMAlgRSA, &TPMSRSAParms{
+				Symmetric: TPMTSymDefObject{Algorithm: TPMAlgNull},
+				Scheme:    TPMTRSAScheme{Scheme: TPMAlgNull},
+				KeyBits:   TPMKeyBits(k.N.BitLen()),
+				Exponent:  exponent,
+			}),
+			Unique: NewTPMUPublicID(TPMAlgRSA, &TPM2BPublicKeyRSA{Buffer: k.N.Bytes()}),
+		}, &TPMTSensitive{
+			SensitiveType: TPMAlgRSA,
+			Sensitive:     NewTPMUSensitiveComposite(TPMAlgRSA, &TPM2BPrivateKeyRSA{Buffer: k.Primes[0].Bytes()}),
+		}, nil
+	case *ecdsa.PrivateKey:
+		var curve TPMECCCurve
+		switch k.Curve.Params().Name {
+		case "P-256":
+			curve = TPMECCNistP256
+		case "P-384":
+			curve = TPMECCNistP384
+		case "P-521":
+			curve = TPMECCNistP521
+		default:
+			return nil, nil, fmt.Errorf("unsupported curve %v", k.Curve.Params().Name)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		fill := func(v *big.Int) []byte { return v.FillBytes(make([]byte, size)) }
+		return &TPMTPublic{
+			Type:             TPMAlgECC,
+			NameAlg:          nameAlg,
+			ObjectAttributes: attrs,
+			Parameters: NewTPMUPublicParms(TPMAlgECC, &TPMSECCParms{
+				Symmetric: TPMTSymDefObject{Algorithm: TPMAlgNull},
+				Scheme:    TPMTECCScheme{Scheme: TPMAlgNull},
+				CurveID:   curve,
+				KDF:       TPMTKDFScheme{Scheme: TPMAlgNull},
+			}),
+			Unique: NewTPMUPublicID(TPMAlgECC, &TPMSECCPoint{
+				X: TPM2BECCParameter{Buffer: fill(k.X)},
+				Y: TPM2BECCParameter{Buffer: fill(k.Y)},
+			}),
+		}, &TPMTSensitive{
+			SensitiveType: TPMAlgECC,
+			Sensitive:     NewTPMUSensitiveComposite(TPMAlgECC, &TPM2BECCParameter{Buffer: fill(k.D)}),
+		}, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported key type %T", key)
+}
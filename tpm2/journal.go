@@ -0,0 +1,255 @@
+package tpm2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Journal is a transport that records how each command sent through it was
+// authorized: which entities it referenced, which sessions authorized it,
+// which policy assertions those sessions had satisfied, and what the TPM
+// answered. The journal can be exported as JSON for auditing.
+//
+// Commands executed with this package's Execute methods are recorded in
+// full. Commands sent as raw bytes are recorded with their command code and
+// result only.
+type Journal struct {
+	tpm transport.TPM
+
+	mu      sync.Mutex
+	entries []JournalEntry
+	// pending holds the entries describing commands that execute is
+	// sending through wrappers to the journal, until they arrive.
+	pending []*pendingEntry
+	// policies holds the assertions satisfied so far by each policy
+	// session, until the session is used to authorize a command.
+	policies map[TPMHandle][]string
+}
+
+// JournalEntry records a single command.
+type JournalEntry struct {
+	Time time.Time `json:"time"`
+	// Command is the name of the command structure, e.g. "Sign", when
+	// known.
+	Command     string `json:"command,omitempty"`
+	CommandCode TPMCC  `json:"commandCode"`
+	// Handles are the values in the command's handle area.
+	Handles []TPMHandle `json:"handles,omitempty"`
+	// Names are the hex-encoded Names of the entities referenced by the
+	// handles. They are only known for commands with authorizations.
+	Names    []string         `json:"names,omitempty"`
+	Sessions []JournalSession `json:"sessions,omitempty"`
+	// ResponseCode is the TPM's response code. It is zero both on success
+	// and when the command never reached the TPM; Error tells them apart.
+	ResponseCode TPMRC  `json:"responseCode"`
+	Error        string `json:"error,omitempty"`
+}
+
+// JournalSession records one session used with a command.
+type JournalSession struct {
+	Handle TPMHandle `json:"handle"`
+	// Kind is "password", "hmac" or "policy".
+	Kind string `json:"kind"`
+	// Policy lists, in order, the policy commands run on a policy session
+	// since it was started, restarted or last used for authorization.
+	Policy []string `json:"policy,omitempty"`
+}
+
+// policyAssertions are the policy commands that add to a policy session's
+// digest.
+var policyAssertions = map[TPMCC]bool{
+	TPMCCPolicyNV:                true,
+	TPMCCPolicySecret:            true,
+	TPMCCPolicySigned:            true,
+	TPMCCPolicyAuthorize:         true,
+	TPMCCPolicyAuthValue:         true,
+	TPMCCPolicyCommandCode:       true,
+	TPMCCPolicyCounterTimer:      true,
+	TPMCCPolicyCpHash:            true,
+	TPMCCPolicyLocality:          true,
+	TPMCCPolicyNameHash:          true,
+	TPMCCPolicyOR:                true,
+	TPMCCPolicyTicket:            true,
+	TPMCCPolicyPCR:               true,
+	TPMCCPolicyPhysicalPresence:  true,
+	TPMCCPolicyDuplicationSelect: true,
+	TPMCCPolicyPassword:          true,
+	TPMCCPolicyNvWritten:         true,
+	TPMCCPolicyTemplate:          true,
+	TPMCCPolicyAuthorizeNV:       true,
+	TPMCCPolicyACSendSelect:      true,
+}
+
+// NewJournal returns a Journal that sends commands to t.
+func NewJournal(t transport.TPM) *Journal {
+	return &Journal{
+		tpm:      t,
+		policies: make(map[TPMHandle][]string),
+	}
+}
+
+// pendingEntry is an entry for a command that has yet to reach the journal.
+type pendingEntry struct {
+	cmd   []byte
+	entry JournalEntry
+}
+
+// Send implements transport.TPM.
+func (j *Journal) Send(cmd []byte) ([]byte, error) {
+	entry, ok := j.take(cmd)
+	if !ok {
+		entry = JournalEntry{Time: time.Now()}
+		if len(cmd) >= 10 {
+			entry.CommandCode = TPMCC(binary.BigEndian.Uint32(cmd[6:10]))
+		}
+	}
+	return j.send(cmd, entry)
+}
+
+// Unwrap implements transport.Wrapper.
+func (j *Journal) Unwrap() transport.TPM {
+	return j.tpm
+}
+
+// expect makes entry describe cmd, if it reaches the journal before the
+// returned function is called. Wrappers between execute and the journal may
+// change the command or not send it at all, in which case it is recorded
+// with its command code only, or not at all.
+func (j *Journal) expect(cmd []byte, entry JournalEntry) func() {
+	p := &pendingEntry{cmd: cmd, entry: entry}
+	j.mu.Lock()
+	j.pending = append(j.pending, p)
+	j.mu.Unlock()
+	return func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if i := slices.Index(j.pending, p); i >= 0 {
+			j.pending = slices.Delete(j.pending, i, i+1)
+		}
+	}
+}
+
+// take removes and returns the pending entry for cmd, if there is one.
+func (j *Journal) take(cmd []byte) (JournalEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i, p := range j.pending {
+		if bytes.Equal(p.cmd, cmd) {
+			j.pending = slices.Delete(j.pending, i, i+1)
+			return p.entry, true
+		}
+	}
+	return JournalEntry{}, false
+}
+
+// Close closes the underlying transport, if it can be closed.
+func (j *Journal) Close() error {
+	if c, ok := j.tpm.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Entries returns a copy of the entries recorded so far.
+func (j *Journal) Entries() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]JournalEntry(nil), j.entries...)
+}
+
+// MarshalJSON implements json.Marshaler, encoding the entries recorded so
+// far as a JSON array.
+func (j *Journal) MarshalJSON() ([]byte, error) {
+	entries := j.Entries()
+	if entries == nil {
+		entries = []JournalEntry{}
+	}
+	return json.Marshal(entries)
+}
+
+// journalEntry describes a command built by execute.
+func journalEntry(cmd any, cc TPMCC, handles []byte, names []TPM2BName, sess []Session) JournalEntry {
+	entry := JournalEntry{
+		Time:        time.Now(),
+		Command:     reflect.TypeOf(cmd).Name(),
+		CommandCode: cc,
+	}
+	for i := 0; i+4 <= len(handles); i += 4 {
+		entry.Handles = append(entry.Handles, TPMHandle(binary.BigEndian.Uint32(handles[i:])))
+	}
+	for _, name := range names {
+		entry.Names = append(entry.Names, hex.EncodeToString(name.Buffer))
+	}
+	for _, s := range sess {
+		js := JournalSession{Handle: s.Handle()}
+		switch TPMHT(s.Handle() >> 24) {
+		case TPMHTHMACSession:
+			js.Kind = "hmac"
+		case TPMHTPolicySession:
+			js.Kind = "policy"
+		default:
+			js.Kind = "password"
+		}
+		entry.Sessions = append(entry.Sessions, js)
+	}
+	return entry
+}
+
+// send sends cmd and records entry, completed with the result.
+func (j *Journal) send(cmd []byte, entry JournalEntry) ([]byte, error) {
+	j.mu.Lock()
+	for i, s := range entry.Sessions {
+		if s.Kind == "policy" {
+			entry.Sessions[i].Policy = append([]string(nil), j.policies[s.Handle]...)
+		}
+	}
+	j.mu.Unlock()
+
+	rsp, err := j.tpm.Send(cmd)
+	if err != nil {
+		entry.Error = err.Error()
+	} else if len(rsp) >= 10 {
+		entry.ResponseCode = TPMRC(binary.BigEndian.Uint32(rsp[6:10]))
+		if entry.ResponseCode != TPMRCSuccess {
+			entry.Error = entry.ResponseCode.Error()
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = append(j.entries, entry)
+	if err != nil || entry.ResponseCode != TPMRCSuccess {
+		return rsp, err
+	}
+	switch {
+	case entry.CommandCode == TPMCCStartAuthSession && len(rsp) >= 14:
+		delete(j.policies, TPMHandle(binary.BigEndian.Uint32(rsp[10:14])))
+	case entry.CommandCode == TPMCCPolicyRestart || policyAssertions[entry.CommandCode]:
+		for _, h := range entry.Handles {
+			if TPMHT(h>>24) != TPMHTPolicySession {
+				continue
+			}
+			if entry.CommandCode == TPMCCPolicyRestart {
+				delete(j.policies, h)
+			} else {
+				j.policies[h] = append(j.policies[h], entry.Command)
+			}
+		}
+	}
+	// A policy session starts over once it has authorized a command.
+	for _, s := range entry.Sessions {
+		if s.Kind == "policy" {
+			delete(j.policies, s.Handle)
+		}
+	}
+	return rsp, nil
+}
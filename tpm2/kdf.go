@@ -3,7 +3,7 @@ package tpm2
 import (
 	"crypto"
 
-	legacy "github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/tpm2/kdf"
 )
 
 // KDFa implements TPM 2.0's default key derivation function, as defined in
@@ -13,7 +13,7 @@ import (
 // The label parameter is a non-null-terminated string.
 // The contextU & contextV parameters are optional.
 func KDFa(h crypto.Hash, key []byte, label string, contextU, contextV []byte, bits int) []byte {
-	return legacy.KDFaHash(h, key, label, contextU, contextV, bits)
+	return kdf.KDFa(h, key, label, contextU, contextV, bits)
 }
 
 // KDFe implements TPM 2.0's ECDH key derivation function, as defined in
@@ -25,5 +25,5 @@ func KDFa(h crypto.Hash, key []byte, label string, contextU, contextV []byte, bi
 // The partyUInfo and partyVInfo are the x coordinates of the initiator's and
 // the responder's ECC points, respectively.
 func KDFe(h crypto.Hash, z []byte, use string, partyUInfo, partyVInfo []byte, bits int) []byte {
-	return legacy.KDFeHash(h, z, use, partyUInfo, partyVInfo, bits)
+	return kdf.KDFe(h, z, use, partyUInfo, partyVInfo, bits)
 }
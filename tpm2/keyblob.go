@@ -0,0 +1,89 @@
+package tpm2
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// KeyBlob is an object's public and private areas, as returned by
+// TPM2_Create and accepted by TPM2_Load. Its files are the pair tpm2-tools
+// writes with tpm2_create -u key.pub -r key.priv and reads with tpm2_load:
+// a marshalled TPM2B_PUBLIC and a marshalled TPM2B_PRIVATE. Keys created
+// with the tools can be used from Go, and the other way around.
+type KeyBlob struct {
+	Public  TPM2BPublic
+	Private TPM2BPrivate
+}
+
+// ParseKeyBlob parses the contents of a .pub and a .priv file.
+func ParseKeyBlob(pub, priv []byte) (*KeyBlob, error) {
+	public, err := Unmarshal[TPM2BPublic](pub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public area: %w", err)
+	}
+	if n := len(Marshal(public)); n != len(pub) {
+		return nil, fmt.Errorf("invalid public area: %d trailing bytes", len(pub)-n)
+	}
+	if _, err := public.Contents(); err != nil {
+		return nil, fmt.Errorf("invalid public area: %w", err)
+	}
+	private, err := Unmarshal[TPM2BPrivate](priv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private area: %w", err)
+	}
+	if n := len(Marshal(private)); n != len(priv) {
+		return nil, fmt.Errorf("invalid private area: %d trailing bytes", len(priv)-n)
+	}
+	return &KeyBlob{Public: *public, Private: *private}, nil
+}
+
+// ReadKeyBlob reads a key from a .pub and a .priv file.
+func ReadKeyBlob(pubFile, privFile string) (*KeyBlob, error) {
+	pub, err := os.ReadFile(pubFile)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := os.ReadFile(privFile)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyBlob(pub, priv)
+}
+
+// Marshal returns the contents of the key's .pub and .priv files.
+func (b *KeyBlob) Marshal() (pub, priv []byte) {
+	return Marshal(b.Public), Marshal(b.Private)
+}
+
+// WriteFiles writes the key to a .pub and a .priv file. The private area is
+// encrypted by the parent, but the .priv file is only readable by its owner
+// all the same, as tpm2-tools makes it.
+func (b *KeyBlob) WriteFiles(pubFile, privFile string) error {
+	pub, priv := b.Marshal()
+	if err := os.WriteFile(pubFile, pub, 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(privFile, priv, 0o600)
+}
+
+// Load loads the key under parent, which must be the key it was created
+// under. The caller must flush it when done.
+func (b *KeyBlob) Load(t transport.TPM, parent AuthHandle, s ...Session) (*NamedHandle, error) {
+	rsp, err := Load{
+		ParentHandle: parent,
+		InPublic:     b.Public,
+		InPrivate:    b.Private,
+	}.Execute(t, s...)
+	if err != nil {
+		return nil, fmt.Errorf("loading key: %w", err)
+	}
+	return &NamedHandle{Handle: rsp.ObjectHandle, Name: rsp.Name}, nil
+}
+
+// Blob returns the imported key's public and private areas, so that it can
+// be saved and loaded again without importing it.
+func (k *ImportedKey) Blob() *KeyBlob {
+	return &KeyBlob{Public: k.Public, Private: k.Private}
+}
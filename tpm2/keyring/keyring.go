@@ -0,0 +1,196 @@
+// Package keyring stores named secrets on disk, each sealed to a TPM, for
+// tools that want an OS-keychain-like store that only works on one machine.
+// Each secret is a sealed envelope (see package sealed) in its own file, and
+// may additionally be bound to PCR values or a PIN.
+package keyring
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/sealed"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrNotFound is returned for names that are not in the keyring.
+var ErrNotFound = errors.New("secret not found")
+
+// fileExt is the extension of the files holding secrets.
+const fileExt = ".sealed"
+
+// Keyring is a directory of secrets sealed to a TPM. It is not safe for
+// concurrent use by multiple goroutines.
+type Keyring struct {
+	tpm transport.TPM
+	dir string
+	// Parent is the storage key secrets are sealed under. It defaults
+	// to an ECC SRK in the owner hierarchy.
+	Parent sealed.Parent
+	// HierarchyAuth is the authorization of Parent's hierarchy.
+	HierarchyAuth []byte
+}
+
+// Open returns the keyring in dir, creating the directory if needed.
+func Open(t transport.TPM, dir string) (*Keyring, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Keyring{
+		tpm:    t,
+		dir:    dir,
+		Parent: sealed.PrimaryParent(tpm2.TPMRHOwner, tpm2.ECCSRKTemplate),
+	}, nil
+}
+
+// putOptions configures Put.
+type putOptions struct {
+	sel *tpm2.TPMLPCRSelection
+	pin []byte
+}
+
+// PutOption is an option for Put.
+type PutOption func(*putOptions)
+
+// WithPCRs binds the secret to the current values of the PCRs in sel.
+func WithPCRs(sel *tpm2.TPMLPCRSelection) PutOption {
+	return func(o *putOptions) {
+		o.sel = sel
+	}
+}
+
+// WithPIN requires pin to be given to Get the secret.
+func WithPIN(pin []byte) PutOption {
+	return func(o *putOptions) {
+		o.pin = pin
+	}
+}
+
+// path returns the file holding the named secret. Names are encoded so that
+// any name, including one with path separators, maps to a single file.
+func (k *Keyring) path(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty secret name")
+	}
+	return filepath.Join(k.dir, base64.RawURLEncoding.EncodeToString([]byte(name))+fileExt), nil
+}
+
+// Put seals secret and stores it under name, replacing any secret already
+// stored there.
+func (k *Keyring) Put(name string, secret []byte, opts ...PutOption) error {
+	path, err := k.path(name)
+	if err != nil {
+		return err
+	}
+	var o putOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	env, err := sealed.SealWithPIN(k.tpm, k.Parent, k.HierarchyAuth, secret, o.sel, o.pin)
+	if err != nil {
+		return fmt.Errorf("sealing %q: %w", name, err)
+	}
+	data, err := env.Marshal()
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file and rename it, so a crash leaves either
+	// the old secret or the new one.
+	tmp, err := os.CreateTemp(k.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// envelope reads the envelope stored under name.
+func (k *Keyring) envelope(name string) (*sealed.Envelope, error) {
+	path, err := k.path(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%q: %w", name, ErrNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	return sealed.Parse(data)
+}
+
+// Get unseals the secret stored under name. pin must be given if the secret
+// was stored WithPIN, and is otherwise ignored.
+func (k *Keyring) Get(name string, pin []byte) ([]byte, error) {
+	env, err := k.envelope(name)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := env.UnsealWithPIN(k.tpm, k.HierarchyAuth, pin)
+	if err != nil {
+		return nil, fmt.Errorf("unsealing %q: %w", name, err)
+	}
+	return secret, nil
+}
+
+// Policy describes what is needed to Get the secret stored under name,
+// without unsealing it.
+func (k *Keyring) Policy(name string) (*sealed.Policy, error) {
+	env, err := k.envelope(name)
+	if err != nil {
+		return nil, err
+	}
+	return &env.Policy, nil
+}
+
+// Delete removes the secret stored under name.
+func (k *Keyring) Delete(name string) error {
+	path, err := k.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%q: %w", name, ErrNotFound)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// List returns the names of the stored secrets, sorted.
+func (k *Keyring) List() ([]string, error) {
+	entries, err := os.ReadDir(k.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		encoded, ok := strings.CutSuffix(e.Name(), fileExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		name, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	return names, nil
+}
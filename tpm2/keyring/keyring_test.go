@@ -0,0 +1,100 @@
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestKeyring(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	k, err := Open(thetpm, t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	sel, err := tpm2.ParsePCRSelection("sha256:16")
+	if err != nil {
+		t.Fatalf("ParsePCRSelection: %v", err)
+	}
+
+	if err := k.Put("github.com/token", []byte("ghp_123")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := k.Put("disk", []byte("disk key"), WithPCRs(sel), WithPIN([]byte("1234"))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	names, err := k.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if want := []string{"disk", "github.com/token"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("List() = %q, want %q", names, want)
+	}
+
+	got, err := k.Get("github.com/token", nil)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !bytes.Equal(got, []byte("ghp_123")) {
+		t.Errorf("Get() = %q, want %q", got, "ghp_123")
+	}
+	if _, err := k.Get("disk", nil); err == nil {
+		t.Error("Get without the PIN succeeded")
+	}
+	got, err = k.Get("disk", []byte("1234"))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !bytes.Equal(got, []byte("disk key")) {
+		t.Errorf("Get() = %q, want %q", got, "disk key")
+	}
+	policy, err := k.Policy("disk")
+	if err != nil {
+		t.Fatalf("Policy: %v", err)
+	}
+	if !policy.PIN || len(policy.PCRSelection) == 0 {
+		t.Errorf("Policy() = %+v, want a PCR and PIN policy", policy)
+	}
+
+	// Replacing a secret.
+	if err := k.Put("github.com/token", []byte("ghp_456")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got, err := k.Get("github.com/token", nil); err != nil || !bytes.Equal(got, []byte("ghp_456")) {
+		t.Errorf("Get() = %q, %v, want %q", got, err, "ghp_456")
+	}
+
+	// The PCR-bound secret is lost once the PCR changes.
+	if _, err := (tpm2.PCRExtend{
+		PCRHandle: tpm2.AuthHandle{Handle: tpm2.TPMHandle(16), Auth: tpm2.PasswordAuth(nil)},
+		Digests: tpm2.TPMLDigestValues{Digests: []tpm2.TPMTHA{{
+			HashAlg: tpm2.TPMAlgSHA256,
+			Digest:  make([]byte, 32),
+		}}},
+	}).Execute(thetpm); err != nil {
+		t.Fatalf("PCRExtend: %v", err)
+	}
+	if _, err := k.Get("disk", []byte("1234")); err == nil {
+		t.Error("Get succeeded after the PCR changed")
+	}
+
+	if err := k.Delete("disk"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := k.Get("disk", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(deleted) = %v, want %v", err, ErrNotFound)
+	}
+	if err := k.Delete("disk"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete(deleted) = %v, want %v", err, ErrNotFound)
+	}
+}
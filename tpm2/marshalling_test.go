@@ -2,6 +2,7 @@ package tpm2
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 )
 
@@ -154,3 +155,32 @@ func TestMarshalT(t *testing.T) {
 		t.Errorf("want %x\ngot %x", pubBytes, pub2Bytes)
 	}
 }
+
+func TestUnmarshalListLimits(t *testing.T) {
+	digests := func(n int) TPMLDigest {
+		var l TPMLDigest
+		for i := 0; i < n; i++ {
+			l.Digests = append(l.Digests, TPM2BDigest{Buffer: []byte{byte(i)}})
+		}
+		return l
+	}
+
+	if _, err := Unmarshal[TPMLDigest](Marshal(digests(8))); err != nil {
+		t.Errorf("Unmarshal(8 digests): %v", err)
+	}
+
+	_, err := Unmarshal[TPMLDigest](Marshal(digests(9)))
+	var countErr *ListCountError
+	if !errors.As(err, &countErr) {
+		t.Fatalf("Unmarshal(9 digests) = %v, want a ListCountError", err)
+	}
+	if countErr.List != "TPMLDigest" || countErr.Count != 9 || countErr.Max != 8 {
+		t.Errorf("Unmarshal(9 digests) = %+v, want TPMLDigest count 9 max 8", countErr)
+	}
+
+	// A count with no elements behind it is rejected before anything is
+	// allocated for them.
+	if _, err := Unmarshal[TPMLTaggedTPMProperty]([]byte{0, 0, 0x0f, 0xff, 1, 2, 3}); err == nil {
+		t.Error("Unmarshal(truncated TPMLTaggedTPMProperty) succeeded, want an error")
+	}
+}
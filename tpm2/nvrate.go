@@ -0,0 +1,120 @@
+package tpm2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Limits on the backoff an NVRateLimiter uses. minNVRateBackoff is used when
+// the TPM reports no TPM_PT_NV_WRITE_RECOVERY, and the backoff doubles on
+// each consecutive TPM_RC_NV_RATE up to maxNVRateBackoff.
+const (
+	minNVRateBackoff     = 10 * time.Millisecond
+	maxNVRateBackoff     = 10 * time.Second
+	defaultNVRateRetries = 8
+)
+
+// NVWriteRecovery returns how long the TPM asks callers to wait before
+// retrying an NV write that failed with TPM_RC_NV_RATE, as reported by its
+// TPM_PT_NV_WRITE_RECOVERY property.
+func NVWriteRecovery(t transport.TPM) (time.Duration, error) {
+	rsp, err := GetCapability{
+		Capability:    TPMCapTPMProperties,
+		Property:      uint32(TPMPTNVWriteRecovery),
+		PropertyCount: 1,
+	}.Execute(t)
+	if err != nil {
+		return 0, err
+	}
+	props, err := rsp.CapabilityData.Data.TPMProperties()
+	if err != nil {
+		return 0, err
+	}
+	if len(props.TPMProperty) == 0 || props.TPMProperty[0].Property != TPMPTNVWriteRecovery {
+		return 0, fmt.Errorf("TPM did not report TPM_PT_NV_WRITE_RECOVERY")
+	}
+	return time.Duration(props.TPMProperty[0].Value) * time.Millisecond, nil
+}
+
+// NVRateLimiter is a transport that handles the TPM's limit on the rate of
+// NV writes. When a command fails with TPM_RC_NV_RATE, it waits for the
+// TPM's TPM_PT_NV_WRITE_RECOVERY time, doubling the wait each time the
+// command fails again, and resends it.
+//
+// An NVRateLimiter is safe for concurrent use, and should be shared by all
+// goroutines using the TPM: commands that change lasting state (see
+// MutatesState) are sent one at a time, so that while one of them is
+// backing off the others wait rather than add to the TPM's NV wear.
+type NVRateLimiter struct {
+	tpm transport.TPM
+	// MaxRetries is how many times a command is resent before its
+	// TPM_RC_NV_RATE is returned to the caller. Zero selects a default.
+	MaxRetries int
+
+	// mu is held while sending state-changing commands.
+	mu           sync.Mutex
+	recoveryOnce sync.Once
+	recovery     time.Duration
+}
+
+// NewNVRateLimiter returns an NVRateLimiter that sends commands to t.
+func NewNVRateLimiter(t transport.TPM) *NVRateLimiter {
+	return &NVRateLimiter{tpm: t}
+}
+
+// Send implements transport.TPM.
+func (l *NVRateLimiter) Send(cmd []byte) ([]byte, error) {
+	if len(cmd) >= 10 && MutatesState(TPMCC(binary.BigEndian.Uint32(cmd[6:10]))) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+	}
+	retries := l.MaxRetries
+	if retries <= 0 {
+		retries = defaultNVRateRetries
+	}
+	var backoff time.Duration
+	for i := 0; ; i++ {
+		rsp, err := l.tpm.Send(cmd)
+		if err != nil || len(rsp) < 10 || TPMRC(binary.BigEndian.Uint32(rsp[6:10])) != TPMRCNVRate || i == retries {
+			return rsp, err
+		}
+		if backoff == 0 {
+			backoff = l.recoveryTime()
+		} else if backoff *= 2; backoff > maxNVRateBackoff {
+			backoff = maxNVRateBackoff
+		}
+		time.Sleep(backoff)
+	}
+}
+
+// Unwrap implements transport.Wrapper.
+func (l *NVRateLimiter) Unwrap() transport.TPM {
+	return l.tpm
+}
+
+// recoveryTime returns the initial backoff, reading it from the TPM the
+// first time it is needed.
+func (l *NVRateLimiter) recoveryTime() time.Duration {
+	l.recoveryOnce.Do(func() {
+		// TPM2_GetCapability does not write NV, so it can be sent in
+		// the middle of a backoff.
+		l.recovery, _ = NVWriteRecovery(l.tpm)
+	})
+	if l.recovery < minNVRateBackoff {
+		return minNVRateBackoff
+	}
+	return l.recovery
+}
+
+// Close closes the underlying transport, if it can be closed.
+func (l *NVRateLimiter) Close() error {
+	if c, ok := l.tpm.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
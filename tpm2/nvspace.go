@@ -0,0 +1,152 @@
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrNVSpace is returned by NVUsage.CheckDefine when an NV index would not
+// fit in the TPM.
+var ErrNVSpace = errors.New("not enough NV space")
+
+// NVIndexInfo describes a defined NV index.
+type NVIndexInfo struct {
+	Public TPMSNVPublic
+	Name   TPM2BName
+}
+
+// ListNVIndices returns the public areas of all defined NV indices, in
+// ascending handle order.
+func ListNVIndices(t transport.TPM) ([]NVIndexInfo, error) {
+	handles, err := GetHandles(t, TPMHTNVIndex)
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]NVIndexInfo, 0, len(handles))
+	for _, h := range handles {
+		rsp, err := NVReadPublic{NVIndex: h}.Execute(t)
+		if err != nil {
+			return nil, fmt.Errorf("reading NV index 0x%08x: %w", uint32(h), err)
+		}
+		pub, err := rsp.NVPublic.Contents()
+		if err != nil {
+			return nil, err
+		}
+		indices = append(indices, NVIndexInfo{Public: *pub, Name: rsp.NVName})
+	}
+	return indices, nil
+}
+
+// NVUsage describes how the TPM's NV memory is used.
+//
+// TPMs don't report their free NV memory in bytes. PersistentAvail, the
+// TPM's estimate of how many more persistent objects fit, is the closest
+// measure, since objects and NV indices share the same memory.
+type NVUsage struct {
+	// Indices lists the defined NV indices.
+	Indices []NVIndexInfo
+	// UsedBytes is the total data size of the defined NV indices.
+	UsedBytes int
+	// IndexMax is the largest data size of an NV index, and BufferMax
+	// the most data one NV read or write can transfer.
+	IndexMax  uint32
+	BufferMax uint32
+	// Counters is the number of counter indices, and CountersMax the
+	// most that may be defined, or zero if there is no limit.
+	Counters    uint32
+	CountersMax uint32
+	// CountersAvail is the number of additional orderly counter indices
+	// that may be defined.
+	CountersAvail uint32
+	// PersistentAvail is the number of additional persistent objects that
+	// fit in NV memory.
+	PersistentAvail uint32
+}
+
+// GetNVUsage reads the TPM's NV properties and defined NV indices.
+func GetNVUsage(t transport.TPM) (*NVUsage, error) {
+	fixed, err := getProperties(t, TPMPTNVCountersMax, TPMPTNVBufferMax)
+	if err != nil {
+		return nil, err
+	}
+	variable, err := getProperties(t, TPMPTHRPersistentAvail, TPMPTNVCountersAvail)
+	if err != nil {
+		return nil, err
+	}
+	var u NVUsage
+	for _, p := range append(fixed, variable...) {
+		switch p.Property {
+		case TPMPTNVCountersMax:
+			u.CountersMax = p.Value
+		case TPMPTNVIndexMax:
+			u.IndexMax = p.Value
+		case TPMPTNVBufferMax:
+			u.BufferMax = p.Value
+		case TPMPTHRPersistentAvail:
+			u.PersistentAvail = p.Value
+		case TPMPTNVCounters:
+			u.Counters = p.Value
+		case TPMPTNVCountersAvail:
+			u.CountersAvail = p.Value
+		}
+	}
+	if u.Indices, err = ListNVIndices(t); err != nil {
+		return nil, err
+	}
+	for _, idx := range u.Indices {
+		u.UsedBytes += int(idx.Public.DataSize)
+	}
+	return &u, nil
+}
+
+// CheckDefine checks whether the NV indices in pubs can be defined, in
+// order, with TPM2_NV_DefineSpace, so that provisioning can fail before it
+// changes anything rather than part-way through. It returns an error
+// wrapping ErrNVSpace if an index is larger than the TPM allows or the TPM
+// is out of NV memory or counters, and an error if an index is already
+// defined. All problems are reported, joined.
+//
+// NV memory is checked against PersistentAvail, which TPMs only estimate,
+// so a define that passes may still fail with TPM_RC_NV_SPACE.
+func (u *NVUsage) CheckDefine(pubs ...TPMSNVPublic) error {
+	defined := make(map[TPMIRHNVIndex]bool)
+	for _, idx := range u.Indices {
+		defined[idx.Public.NVIndex] = true
+	}
+	counters := u.Counters
+	countersAvail := u.CountersAvail
+
+	var errs []error
+	for _, pub := range pubs {
+		if defined[pub.NVIndex] {
+			errs = append(errs, fmt.Errorf("NV index 0x%08x is already defined", uint32(pub.NVIndex)))
+			continue
+		}
+		defined[pub.NVIndex] = true
+		if u.IndexMax != 0 && uint32(pub.DataSize) > u.IndexMax {
+			errs = append(errs, fmt.Errorf("NV index 0x%08x: data size %d exceeds the maximum of %d: %w",
+				uint32(pub.NVIndex), pub.DataSize, u.IndexMax, ErrNVSpace))
+		}
+		if pub.Attributes.NT == TPMNTCounter {
+			if u.CountersMax != 0 && counters >= u.CountersMax {
+				errs = append(errs, fmt.Errorf("NV index 0x%08x: all %d counters are defined: %w",
+					uint32(pub.NVIndex), u.CountersMax, ErrNVSpace))
+			}
+			counters++
+			if pub.Attributes.Orderly {
+				if countersAvail == 0 {
+					errs = append(errs, fmt.Errorf("NV index 0x%08x: no orderly counters available: %w",
+						uint32(pub.NVIndex), ErrNVSpace))
+				} else {
+					countersAvail--
+				}
+			}
+		}
+	}
+	if len(pubs) != 0 && u.PersistentAvail == 0 {
+		errs = append(errs, fmt.Errorf("NV memory is full: %w", ErrNVSpace))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,147 @@
+//go:build windows
+
+package pcp
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// ErrNoEKCertificate indicates that Windows has no EK certificate for the
+// TPM, neither one it downloaded or was given nor one in the TPM's NV.
+var ErrNoEKCertificate = errors.New("no EK certificate")
+
+// providerName is MS_PLATFORM_CRYPTO_PROVIDER.
+const providerName = "Microsoft Platform Crypto Provider"
+
+// ntePropertyNotFound is NTE_NOT_FOUND, returned for a property the
+// provider does not have.
+const ntePropertyNotFound = 0x80090011
+
+// ncrypt.dll provides the CNG key storage API:
+// https://learn.microsoft.com/en-us/windows/win32/api/ncrypt/
+var (
+	ncryptDLL                 = syscall.NewLazyDLL("ncrypt.dll")
+	ncryptOpenStorageProvider = ncryptDLL.NewProc("NCryptOpenStorageProvider")
+	ncryptGetProperty         = ncryptDLL.NewProc("NCryptGetProperty")
+	ncryptFreeObject          = ncryptDLL.NewProc("NCryptFreeObject")
+)
+
+// EKCertificates returns the DER EK certificates Windows knows for the TPM:
+// first those in its certificate store, which TBS fills from the TPM
+// manufacturer's service or from provisioning, then those in the TPM's NV.
+// It does not need the TPM to be opened, nor administrator rights.
+func EKCertificates() ([][]byte, error) {
+	prov, err := openProvider()
+	if err != nil {
+		return nil, err
+	}
+	defer ncryptFreeObject.Call(prov)
+
+	var certs [][]byte
+	// NCRYPT_PCP_EKCERT_PROPERTY, then NCRYPT_PCP_RSA_EKNVCERT_PROPERTY and
+	// NCRYPT_PCP_ECC_EKNVCERT_PROPERTY.
+	for _, prop := range []string{"PCP_EKCERT", "PCP_RSA_EKNVCERT", "PCP_ECC_EKNVCERT"} {
+		cert, err := getProperty(prov, prop)
+		if err != nil {
+			return nil, fmt.Errorf("reading %v: %w", prop, err)
+		}
+		if len(cert) != 0 {
+			certs = append(certs, cert)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, ErrNoEKCertificate
+	}
+	return certs, nil
+}
+
+// EKCertificate returns the first EK certificate that EKCertificates finds.
+func EKCertificate() (*x509.Certificate, error) {
+	certs, err := EKCertificates()
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(certs[0])
+}
+
+// openProvider opens the Platform Crypto Provider:
+// https://learn.microsoft.com/en-us/windows/win32/api/ncrypt/nf-ncrypt-ncryptopenstorageprovider
+func openProvider() (uintptr, error) {
+	name, err := syscall.UTF16PtrFromString(providerName)
+	if err != nil {
+		return 0, err
+	}
+	if err := ncryptOpenStorageProvider.Find(); err != nil {
+		return 0, err
+	}
+	var prov uintptr
+	// SECURITY_STATUS NCryptOpenStorageProvider(
+	//   [out]          NCRYPT_PROV_HANDLE *phProvider,
+	//   [in, optional] LPCWSTR            pszProviderName,
+	//   [in]           DWORD              dwFlags
+	// );
+	r, _, _ := ncryptOpenStorageProvider.Call(
+		uintptr(unsafe.Pointer(&prov)),
+		uintptr(unsafe.Pointer(name)),
+		0,
+	)
+	if r != 0 {
+		return 0, fmt.Errorf("opening %v: NCrypt error %#x", providerName, uint32(r))
+	}
+	return prov, nil
+}
+
+// getProperty reads a property of the provider, returning nil if it has
+// none:
+// https://learn.microsoft.com/en-us/windows/win32/api/ncrypt/nf-ncrypt-ncryptgetproperty
+func getProperty(prov uintptr, prop string) ([]byte, error) {
+	name, err := syscall.UTF16PtrFromString(prop)
+	if err != nil {
+		return nil, err
+	}
+	// SECURITY_STATUS NCryptGetProperty(
+	//   [in]  NCRYPT_HANDLE hObject,
+	//   [in]  LPCWSTR       pszProperty,
+	//   [out] PBYTE         pbOutput,
+	//   [in]  DWORD         cbOutput,
+	//   [out] DWORD         *pcbResult,
+	//   [in]  DWORD         dwFlags
+	// );
+	call := func(buf []byte) (uint32, error) {
+		var size uint32
+		var p uintptr
+		if len(buf) != 0 {
+			p = uintptr(unsafe.Pointer(&buf[0]))
+		}
+		r, _, _ := ncryptGetProperty.Call(
+			prov,
+			uintptr(unsafe.Pointer(name)),
+			p,
+			uintptr(len(buf)),
+			uintptr(unsafe.Pointer(&size)),
+			0,
+		)
+		if r != 0 {
+			if uint32(r) == ntePropertyNotFound {
+				return 0, nil
+			}
+			return 0, fmt.Errorf("NCrypt error %#x", uint32(r))
+		}
+		return size, nil
+	}
+	// The first call gets the size of the property.
+	size, err := call(nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = call(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
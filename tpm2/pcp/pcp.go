@@ -0,0 +1,116 @@
+// Package pcp interoperates with the Microsoft Platform Crypto Provider, the
+// CNG key storage provider through which Windows creates and uses TPM keys.
+//
+// Keys that the provider creates, for example with PCPTool or with
+// NCryptCreatePersistedKey, are stored as opaque key blobs that wrap the
+// TPM's public and private areas. ParseKeyBlob unwraps them, so that an
+// attestation agent moving to Go can keep using the keys it already has.
+package pcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// SRKHandle is the persistent handle of the storage root key under which the
+// provider creates its keys. Windows creates it with an empty authorization
+// value.
+const SRKHandle = tpm2.DefaultSRKHandle
+
+// keyBlobMagic is BCRYPT_PCP_KEY_MAGIC, 'MPCP' as a little-endian DWORD.
+const keyBlobMagic = 0x4D504350
+
+// pcpTypeTPM20 is PCPTYPE_TPM20, the pcpType of keys on a TPM 2.0.
+const pcpTypeTPM20 = 2
+
+// headerFields is the number of DWORDs in PCP_KEY_BLOB_WIN8: the magic, the
+// header size, the type, the flags and the sizes of the nine sections that
+// follow the header.
+const headerFields = 13
+
+var (
+	// ErrNotKeyBlob indicates that data is not a provider key blob.
+	ErrNotKeyBlob = errors.New("not a Platform Crypto Provider key blob")
+	// ErrNotTPM20 indicates that a key blob is for a TPM 1.2.
+	ErrNotTPM20 = errors.New("key blob is not for a TPM 2.0")
+)
+
+// KeyBlob is a key blob written by the provider, as exported with
+// NCryptExportKey(BCRYPT_OPAQUE_KEY_BLOB) or saved by PCPTool.
+type KeyBlob struct {
+	// Key is the key's public and private areas, to be loaded under the
+	// provider's SRK.
+	Key tpm2.KeyBlob
+	// Flags is the header's PCP_KEY_FLAGS_WIN8, such as whether the key
+	// has a PIN.
+	Flags uint32
+	// PolicyDigestList is the marshalled TPML_DIGEST of the branches of
+	// the key's authorization policy, empty for keys with no policy.
+	PolicyDigestList []byte
+	// PCRBinding and PCRDigest are the PCR selection and digest the key is
+	// bound to, empty for keys that are not bound to PCRs.
+	PCRBinding []byte
+	PCRDigest  []byte
+}
+
+// ParseKeyBlob parses a provider key blob. It accepts both the Windows 8
+// header and the longer header of later versions, whose extra fields it
+// skips.
+func ParseKeyBlob(data []byte) (*KeyBlob, error) {
+	if len(data) < 4*headerFields {
+		return nil, fmt.Errorf("%w: %d bytes", ErrNotKeyBlob, len(data))
+	}
+	var hdr [headerFields]uint32
+	for i := range hdr {
+		hdr[i] = binary.LittleEndian.Uint32(data[4*i:])
+	}
+	magic, headerSize, pcpType, flags := hdr[0], hdr[1], hdr[2], hdr[3]
+	if magic != keyBlobMagic {
+		return nil, fmt.Errorf("%w: magic %#x", ErrNotKeyBlob, magic)
+	}
+	if pcpType != pcpTypeTPM20 {
+		return nil, fmt.Errorf("%w: type %d", ErrNotTPM20, pcpType)
+	}
+	if headerSize < 4*headerFields || uint64(headerSize) > uint64(len(data)) {
+		return nil, fmt.Errorf("%w: header size %d", ErrNotKeyBlob, headerSize)
+	}
+	rest := data[headerSize:]
+	// The sections follow the header in the order of their sizes.
+	var sections [headerFields - 4][]byte
+	for i, size := range hdr[4:] {
+		if uint64(size) > uint64(len(rest)) {
+			return nil, fmt.Errorf("%w: section %d overruns the blob", ErrNotKeyBlob, i)
+		}
+		sections[i], rest = rest[:size], rest[size:]
+	}
+	pub, priv := sections[0], sections[1]
+	key, err := tpm2.ParseKeyBlob(pub, priv)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyBlob{
+		Key:              *key,
+		Flags:            flags,
+		PolicyDigestList: sections[4],
+		PCRBinding:       sections[5],
+		PCRDigest:        sections[6],
+	}, nil
+}
+
+// Load loads the key under the provider's SRK. The caller must flush it
+// when done, and satisfy the key's policy, if any, to use it.
+func (b *KeyBlob) Load(t transport.TPM, s ...tpm2.Session) (*tpm2.NamedHandle, error) {
+	srk, err := tpm2.ReadPublic{ObjectHandle: SRKHandle}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("reading the provider's SRK: %w", err)
+	}
+	return b.Key.Load(t, tpm2.AuthHandle{
+		Handle: SRKHandle,
+		Name:   srk.Name,
+		Auth:   tpm2.PasswordAuth(nil),
+	}, s...)
+}
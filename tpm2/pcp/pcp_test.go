@@ -0,0 +1,69 @@
+package pcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/testutil"
+)
+
+// makeBlob builds a key blob the way the provider lays it out, with a
+// header of headerSize bytes.
+func makeBlob(headerSize int, pcpType uint32, sections [9][]byte) []byte {
+	hdr := make([]byte, headerSize)
+	binary.LittleEndian.PutUint32(hdr[0:], keyBlobMagic)
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(headerSize))
+	binary.LittleEndian.PutUint32(hdr[8:], pcpType)
+	binary.LittleEndian.PutUint32(hdr[12:], 0)
+	for i, s := range sections {
+		binary.LittleEndian.PutUint32(hdr[16+4*i:], uint32(len(s)))
+	}
+	blob := hdr
+	for _, s := range sections {
+		blob = append(blob, s...)
+	}
+	return blob
+}
+
+func TestKeyBlob(t *testing.T) {
+	thetpm := testutil.New(t, testutil.WithSRK())
+	created, err := tpm2.Create{
+		ParentHandle: thetpm.SRK,
+		InPublic:     tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	pub, priv := tpm2.Marshal(created.OutPublic), tpm2.Marshal(created.OutPrivate)
+	policies := tpm2.Marshal(tpm2.TPMLDigest{})
+
+	// Windows 10 and later add a PCR algorithm to the Windows 8 header.
+	for _, headerSize := range []int{4 * headerFields, 4*headerFields + 2} {
+		blob, err := ParseKeyBlob(makeBlob(headerSize, pcpTypeTPM20, [9][]byte{0: pub, 1: priv, 4: policies}))
+		if err != nil {
+			t.Fatalf("ParseKeyBlob(%d-byte header): %v", headerSize, err)
+		}
+		if !bytes.Equal(blob.PolicyDigestList, policies) {
+			t.Errorf("PolicyDigestList = %x, want %x", blob.PolicyDigestList, policies)
+		}
+		key, err := blob.Load(thetpm)
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		tpm2.FlushContext{FlushHandle: key.Handle}.Execute(thetpm)
+	}
+
+	if _, err := ParseKeyBlob(makeBlob(4*headerFields, 1, [9][]byte{0: pub, 1: priv})); !errors.Is(err, ErrNotTPM20) {
+		t.Errorf("ParseKeyBlob(TPM 1.2 blob) = %v, want %v", err, ErrNotTPM20)
+	}
+	blob := makeBlob(4*headerFields, pcpTypeTPM20, [9][]byte{0: pub, 1: priv})
+	if _, err := ParseKeyBlob(blob[:len(blob)-1]); !errors.Is(err, ErrNotKeyBlob) {
+		t.Errorf("ParseKeyBlob(truncated blob) = %v, want %v", err, ErrNotKeyBlob)
+	}
+	if _, err := ParseKeyBlob(pub); !errors.Is(err, ErrNotKeyBlob) {
+		t.Errorf("ParseKeyBlob(TPM2B_PUBLIC) = %v, want %v", err, ErrNotKeyBlob)
+	}
+}
@@ -0,0 +1,163 @@
+package tpm2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// pcrResetters are the commands that reset or reallocate every PCR.
+var pcrResetters = map[TPMCC]bool{
+	TPMCCStartup:     true,
+	TPMCCPCRAllocate: true,
+}
+
+// PCRCache is a transport that remembers the PCR values read through its
+// ReadPCRs method, so that policy builders and other callers that consult
+// the same PCRs repeatedly don't have to read them from the TPM each time.
+//
+// Commands sent through the cache that change PCRs (TPM2_PCR_Extend,
+// TPM2_PCR_Event, TPM2_PCR_Reset and TPM2_EventSequenceComplete) drop the
+// cached values of the PCR they change, whether or not they succeed, and
+// TPM2_Startup and TPM2_PCR_Allocate drop every cached value. Changes made
+// by other users of the TPM are not seen until Refresh is called.
+//
+// A PCRCache is safe for concurrent use.
+type PCRCache struct {
+	tpm transport.TPM
+
+	mu   sync.Mutex
+	vals PCRValues
+}
+
+// NewPCRCache returns an empty PCRCache that sends commands to t.
+func NewPCRCache(t transport.TPM) *PCRCache {
+	return &PCRCache{tpm: t, vals: make(PCRValues)}
+}
+
+// Send implements transport.TPM.
+func (c *PCRCache) Send(cmd []byte) ([]byte, error) {
+	rsp, err := c.tpm.Send(cmd)
+	if len(cmd) < 14 {
+		return rsp, err
+	}
+	switch cc := TPMCC(binary.BigEndian.Uint32(cmd[6:10])); {
+	case cc == TPMCCPCRExtend, cc == TPMCCPCREvent, cc == TPMCCPCRReset, cc == TPMCCEventSequenceComplete:
+		// The PCR is the first handle of each of these commands.
+		c.invalidate(uint(binary.BigEndian.Uint32(cmd[10:14])))
+	case pcrResetters[cc]:
+		c.mu.Lock()
+		c.vals = make(PCRValues)
+		c.mu.Unlock()
+	}
+	return rsp, err
+}
+
+// invalidate drops the cached values of pcr in every bank.
+func (c *PCRCache) invalidate(pcr uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, bank := range c.vals {
+		delete(bank, pcr)
+	}
+}
+
+// ReadPCRs returns the values of the PCRs in sel. Values that are not
+// cached are read from the TPM, all at once, and cached.
+func (c *PCRCache) ReadPCRs(sel TPMLPCRSelection) (PCRValues, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var missing TPMLPCRSelection
+	for _, s := range sel.PCRSelections {
+		mask := make([]byte, len(s.PCRSelect))
+		for _, pcr := range SelectedPCRs(s.PCRSelect) {
+			if _, ok := c.vals[s.Hash][pcr]; !ok {
+				mask[pcr/8] |= 1 << (pcr % 8)
+			}
+		}
+		if anyPCRSelected([]TPMSPCRSelection{{PCRSelect: mask}}) {
+			missing.PCRSelections = append(missing.PCRSelections, TPMSPCRSelection{
+				Hash:      s.Hash,
+				PCRSelect: mask,
+			})
+		}
+	}
+	if len(missing.PCRSelections) != 0 {
+		vals, err := ReadPCRs(c.tpm, missing)
+		if err != nil {
+			return nil, err
+		}
+		c.store(vals)
+	}
+
+	vals := make(PCRValues)
+	for _, s := range sel.PCRSelections {
+		for _, pcr := range SelectedPCRs(s.PCRSelect) {
+			v, ok := c.vals[s.Hash][pcr]
+			if !ok {
+				// The bank is not allocated.
+				continue
+			}
+			if vals[s.Hash] == nil {
+				vals[s.Hash] = make(PCRBankValues)
+			}
+			vals[s.Hash][pcr] = bytes.Clone(v)
+		}
+	}
+	return vals, nil
+}
+
+// store adds vals to the cache.
+func (c *PCRCache) store(vals PCRValues) {
+	for hash, bank := range vals {
+		if c.vals[hash] == nil {
+			c.vals[hash] = make(PCRBankValues)
+		}
+		for pcr, v := range bank {
+			c.vals[hash][pcr] = v
+		}
+	}
+}
+
+// Refresh reads every cached PCR again, all at once, to pick up changes
+// made by other users of the TPM. If reading fails, the cache is emptied.
+func (c *PCRCache) Refresh() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var sel TPMLPCRSelection
+	for hash, bank := range c.vals {
+		var pcrs []uint
+		for pcr := range bank {
+			pcrs = append(pcrs, pcr)
+		}
+		if len(pcrs) != 0 {
+			sel.PCRSelections = append(sel.PCRSelections, TPMSPCRSelection{
+				Hash:      hash,
+				PCRSelect: PCClientCompatible.PCRs(pcrs...),
+			})
+		}
+	}
+	c.vals = make(PCRValues)
+	if len(sel.PCRSelections) == 0 {
+		return nil
+	}
+	vals, err := ReadPCRs(c.tpm, sel)
+	if err != nil {
+		return err
+	}
+	c.store(vals)
+	return nil
+}
+
+// Close closes the underlying transport, if it can be closed.
+func (c *PCRCache) Close() error {
+	if closer, ok := c.tpm.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -1,5 +1,16 @@
 package tpm2
 
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
 // pcrSelectionFormatter is a Platform TPM Profile-specific interface for
 // formatting TPM PCR selections.
 // This interface isn't (yet) part of the go-tpm public interface. After we
@@ -53,3 +64,397 @@ func (pcClient) PCRs(pcrs ...uint) []byte {
 	}
 	return selection
 }
+
+// pcrBankNames maps the bank names accepted by ParsePCRSelection to their
+// algorithm IDs. The names follow the convention used by tpm2-tools.
+var pcrBankNames = map[string]TPMIAlgHash{
+	"sha1":    TPMAlgSHA1,
+	"sha256":  TPMAlgSHA256,
+	"sha384":  TPMAlgSHA384,
+	"sha512":  TPMAlgSHA512,
+	"sm3_256": TPMAlgSM3256,
+}
+
+// PCRBankName returns the name of a PCR bank as accepted by
+// ParsePCRSelection, or the algorithm ID in hex if the bank has no name.
+func PCRBankName(alg TPMIAlgHash) string {
+	for name, a := range pcrBankNames {
+		if a == alg {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%04x", uint16(alg))
+}
+
+// ParsePCRSelection parses a PCR selection string of the form
+// "sha256:0,2,4,7", with multiple banks separated by '+'
+// (e.g., "sha1:0,1+sha256:0-7"). Ranges of PCRs may be given as "a-b".
+// The selection bitmasks are formatted with PCClientCompatible.
+func ParsePCRSelection(s string) (*TPMLPCRSelection, error) {
+	var sel TPMLPCRSelection
+	seen := make(map[TPMIAlgHash]bool)
+	for _, bank := range strings.Split(s, "+") {
+		name, list, ok := strings.Cut(strings.TrimSpace(bank), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid PCR bank %q: missing ':'", bank)
+		}
+		alg, ok := pcrBankNames[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown PCR bank algorithm %q", name)
+		}
+		if seen[alg] {
+			return nil, fmt.Errorf("PCR bank %q selected more than once", name)
+		}
+		seen[alg] = true
+		pcrs, err := parsePCRList(list)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PCR list for bank %q: %w", name, err)
+		}
+		sel.PCRSelections = append(sel.PCRSelections, TPMSPCRSelection{
+			Hash:      alg,
+			PCRSelect: PCClientCompatible.PCRs(pcrs...),
+		})
+	}
+	return &sel, nil
+}
+
+// parsePCRList parses a comma-separated list of PCR indices and ranges.
+func parsePCRList(list string) ([]uint, error) {
+	var pcrs []uint
+	if strings.TrimSpace(list) == "" {
+		return pcrs, nil
+	}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		lo, hi, isRange := strings.Cut(item, "-")
+		first, err := strconv.ParseUint(lo, 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.ParseUint(hi, 10, 8); err != nil {
+				return nil, err
+			}
+			if last < first {
+				return nil, fmt.Errorf("invalid PCR range %q", item)
+			}
+		}
+		for i := first; i <= last; i++ {
+			pcrs = append(pcrs, uint(i))
+		}
+	}
+	return pcrs, nil
+}
+
+// SelectedPCRs returns the indices of the PCRs selected in the given
+// selection bitmask, in ascending order.
+func SelectedPCRs(pcrSelect []byte) []uint {
+	var pcrs []uint
+	for i, b := range pcrSelect {
+		for bit := 0; bit < 8; bit++ {
+			if b&(1<<bit) != 0 {
+				pcrs = append(pcrs, uint(i*8+bit))
+			}
+		}
+	}
+	return pcrs
+}
+
+// PCRBankValues contains the values of the PCRs of a single bank, keyed by
+// PCR index.
+type PCRBankValues map[uint][]byte
+
+// PCRValues contains PCR values keyed by bank algorithm.
+type PCRValues map[TPMIAlgHash]PCRBankValues
+
+// ErrPCRsChanged is returned by ReadPCRs when the PCR update counter changed
+// while the selection was being read, so the returned values would not be
+// consistent with each other.
+var ErrPCRsChanged = errors.New("PCR values changed while being read")
+
+// ReadPCRs reads every PCR in the given selection. TPM2_PCR_Read returns at
+// most 8 digests per call, so ReadPCRs issues as many commands as it takes
+// to read the whole selection. If the PCR update counter changes between
+// calls, ReadPCRs returns ErrPCRsChanged.
+func ReadPCRs(t transport.TPM, sel TPMLPCRSelection) (PCRValues, error) {
+	// Take a copy of the selection, so that we can clear bits as they are
+	// read without modifying the caller's selection.
+	remaining := make([]TPMSPCRSelection, len(sel.PCRSelections))
+	for i, s := range sel.PCRSelections {
+		remaining[i] = TPMSPCRSelection{
+			Hash:      s.Hash,
+			PCRSelect: bytes.Clone(s.PCRSelect),
+		}
+	}
+
+	vals := make(PCRValues)
+	first := true
+	var updateCounter uint32
+	for anyPCRSelected(remaining) {
+		rsp, err := PCRRead{
+			PCRSelectionIn: TPMLPCRSelection{PCRSelections: remaining},
+		}.Execute(t)
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			updateCounter = rsp.PCRUpdateCounter
+			first = false
+		} else if rsp.PCRUpdateCounter != updateCounter {
+			return nil, ErrPCRsChanged
+		}
+
+		digests := rsp.PCRValues.Digests
+		read := 0
+		for _, out := range rsp.PCRSelectionOut.PCRSelections {
+			for _, pcr := range SelectedPCRs(out.PCRSelect) {
+				if read >= len(digests) {
+					return nil, fmt.Errorf("TPM returned %d digests for a larger selection", len(digests))
+				}
+				if vals[out.Hash] == nil {
+					vals[out.Hash] = make(PCRBankValues)
+				}
+				vals[out.Hash][pcr] = digests[read].Buffer
+				read++
+				clearPCR(remaining, out.Hash, pcr)
+			}
+		}
+		if read == 0 {
+			// The TPM won't give us anything else, e.g. because the
+			// remaining banks are not allocated.
+			break
+		}
+	}
+	return vals, nil
+}
+
+// anyPCRSelected returns whether any PCR is selected in the given selections.
+func anyPCRSelected(sels []TPMSPCRSelection) bool {
+	for _, s := range sels {
+		for _, b := range s.PCRSelect {
+			if b != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// clearPCR deselects the given PCR in the given bank.
+func clearPCR(sels []TPMSPCRSelection, hash TPMIAlgHash, pcr uint) {
+	for _, s := range sels {
+		if s.Hash == hash && int(pcr/8) < len(s.PCRSelect) {
+			s.PCRSelect[pcr/8] &^= 1 << (pcr % 8)
+		}
+	}
+}
+
+// PCRComposite returns the concatenation of the values of the PCRs in the
+// selection, in the order defined by the TPM: banks in the order they appear
+// in the selection, and PCRs in ascending order within each bank.
+func PCRComposite(sel TPMLPCRSelection, vals PCRValues) ([]byte, error) {
+	var composite []byte
+	for _, s := range sel.PCRSelections {
+		bank := vals[s.Hash]
+		for _, pcr := range SelectedPCRs(s.PCRSelect) {
+			val, ok := bank[pcr]
+			if !ok {
+				return nil, fmt.Errorf("missing value for PCR %d in bank %v", pcr, s.Hash)
+			}
+			composite = append(composite, val...)
+		}
+	}
+	return composite, nil
+}
+
+// PCRCompositeDigest computes the digest of the selected PCR values using the
+// given hash algorithm, as used in the pcrDigest of a TPMS_QUOTE_INFO and in
+// TPM2_PolicyPCR.
+func PCRCompositeDigest(alg TPMIAlgHash, sel TPMLPCRSelection, vals PCRValues) ([]byte, error) {
+	composite, err := PCRComposite(sel, vals)
+	if err != nil {
+		return nil, err
+	}
+	h, err := alg.Hash()
+	if err != nil {
+		return nil, err
+	}
+	hasher := h.New()
+	hasher.Write(composite)
+	return hasher.Sum(nil), nil
+}
+
+// Sorted returns the PCR indices in the bank, in ascending order.
+func (b PCRBankValues) Sorted() []uint {
+	pcrs := make([]uint, 0, len(b))
+	for pcr := range b {
+		pcrs = append(pcrs, pcr)
+	}
+	sort.Slice(pcrs, func(i, j int) bool { return pcrs[i] < pcrs[j] })
+	return pcrs
+}
+
+// ActivePCRBanks returns the hash algorithms of the PCR banks that have at
+// least one PCR allocated, in the order reported by the TPM.
+func ActivePCRBanks(t transport.TPM) ([]TPMIAlgHash, error) {
+	rsp, err := GetCapability{
+		Capability:    TPMCapPCRs,
+		PropertyCount: 1,
+	}.Execute(t)
+	if err != nil {
+		return nil, err
+	}
+	pcrs, err := rsp.CapabilityData.Data.AssignedPCR()
+	if err != nil {
+		return nil, err
+	}
+	var banks []TPMIAlgHash
+	for _, sel := range pcrs.PCRSelections {
+		if anyPCRSelected([]TPMSPCRSelection{sel}) {
+			banks = append(banks, sel.Hash)
+		}
+	}
+	return banks, nil
+}
+
+// EventLogEntry records a single measurement made with ExtendPCR.
+type EventLogEntry struct {
+	// the PCR that was extended
+	PCR uint32
+	// the type of the event
+	Type EventType
+	// the digests extended into each bank
+	Digests TPMLDigestValues
+	// the measured data
+	Data []byte
+}
+
+// EventLog is a simple in-memory log of measurements.
+type EventLog struct {
+	// the PCR banks listed in the log's header, if read with ReadEventLog
+	Banks   []TPMIAlgHash
+	Entries []EventLogEntry
+}
+
+// extendOptions configures ExtendPCR.
+type extendOptions struct {
+	banks     []TPMIAlgHash
+	pcrEvent  bool
+	log       *EventLog
+	eventType EventType
+	tcgLog    *EventLogWriter
+}
+
+// ExtendOption is an option for ExtendPCR.
+type ExtendOption func(*extendOptions)
+
+// ExtendBanks specifies which PCR banks to extend. By default, all active
+// banks are extended.
+func ExtendBanks(banks ...TPMIAlgHash) ExtendOption {
+	return func(o *extendOptions) {
+		o.banks = banks
+	}
+}
+
+// ExtendWithPCREvent makes ExtendPCR use TPM2_PCR_Event, letting the TPM
+// hash the data with every implemented bank. The data must fit in a
+// TPM2B_EVENT (1024 bytes).
+func ExtendWithPCREvent() ExtendOption {
+	return func(o *extendOptions) {
+		o.pcrEvent = true
+	}
+}
+
+// ExtendLog appends a record of the measurement to the given event log once
+// the PCR has been extended.
+func ExtendLog(log *EventLog) ExtendOption {
+	return func(o *extendOptions) {
+		o.log = log
+	}
+}
+
+// ExtendEventType sets the type of the event recorded in the logs given by
+// ExtendLog and ExtendTCGLog. The default is EV_IPL.
+func ExtendEventType(typ EventType) ExtendOption {
+	return func(o *extendOptions) {
+		o.eventType = typ
+	}
+}
+
+// ExtendTCGLog appends a TCG_PCR_EVENT2 for the measurement to the given
+// event log once the PCR has been extended. The PCR must be extended in
+// every bank of the log, which is the case when ExtendBanks is not used and
+// the log was created for the TPM's active banks.
+func ExtendTCGLog(log *EventLogWriter) ExtendOption {
+	return func(o *extendOptions) {
+		o.tcgLog = log
+	}
+}
+
+// ExtendPCR measures the given data into a PCR, hashing it with the algorithm
+// of each bank so that all banks are extended consistently. It returns the
+// digests that were extended.
+func ExtendPCR(t transport.TPM, pcr handle, data []byte, opts ...ExtendOption) (*TPMLDigestValues, error) {
+	o := extendOptions{eventType: EVIPL}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var digests TPMLDigestValues
+	if o.pcrEvent {
+		if len(o.banks) != 0 {
+			return nil, errors.New("ExtendBanks cannot be used with ExtendWithPCREvent")
+		}
+		rsp, err := PCREvent{
+			PCRHandle: pcr,
+			EventData: TPM2BEvent{Buffer: data},
+		}.Execute(t)
+		if err != nil {
+			return nil, err
+		}
+		digests = rsp.Digests
+	} else {
+		banks := o.banks
+		if len(banks) == 0 {
+			var err error
+			if banks, err = ActivePCRBanks(t); err != nil {
+				return nil, fmt.Errorf("reading active PCR banks: %w", err)
+			}
+		}
+		for _, bank := range banks {
+			h, err := bank.Hash()
+			if err != nil {
+				return nil, err
+			}
+			hasher := h.New()
+			hasher.Write(data)
+			digests.Digests = append(digests.Digests, TPMTHA{
+				HashAlg: bank,
+				Digest:  hasher.Sum(nil),
+			})
+		}
+		if _, err := (PCRExtend{
+			PCRHandle: pcr,
+			Digests:   digests,
+		}).Execute(t); err != nil {
+			return nil, err
+		}
+	}
+
+	entry := EventLogEntry{
+		PCR:     pcr.HandleValue(),
+		Type:    o.eventType,
+		Digests: digests,
+		Data:    bytes.Clone(data),
+	}
+	if o.log != nil {
+		o.log.Entries = append(o.log.Entries, entry)
+	}
+	if o.tcgLog != nil {
+		if err := o.tcgLog.Append(entry); err != nil {
+			return &digests, fmt.Errorf("PCR %d was extended but not logged: %w", entry.PCR, err)
+		}
+	}
+	return &digests, nil
+}
@@ -0,0 +1,412 @@
+// Package policy describes TPM 2.0 authorization policies in JSON and
+// computes their digests without a TPM, step by step, so that a policy can
+// be reviewed from its description instead of from the code that builds it.
+//
+// A description names the session's hash algorithm and lists the policy
+// commands in the order they are run:
+//
+//	{
+//	  "hash": "sha256",
+//	  "steps": [
+//	    {"command": "PolicyPCR", "pcrs": "sha256:0,7", "pcrDigest": "..."},
+//	    {"command": "PolicyCommandCode", "commandCode": "Unseal"},
+//	    {"command": "PolicyOR", "branches": [
+//	      [{"command": "PolicyAuthValue"}],
+//	      [{"command": "PolicySecret", "authObject": "owner"}]
+//	    ]}
+//	  ]
+//	}
+//
+// Byte strings (digests, Names and policy references) are hex encoded. The
+// file testdata/vectors.json holds descriptions with their digests, checked
+// against a TPM simulator, for use as test vectors by other
+// implementations.
+package policy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// ErrInvalid is returned for descriptions that don't describe a policy.
+var ErrInvalid = errors.New("policy: invalid description")
+
+// Hex is a byte string encoded in JSON as a hex string.
+type Hex []byte
+
+func (h Hex) String() string { return hex.EncodeToString(h) }
+
+// MarshalJSON implements json.Marshaler.
+func (h Hex) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(h))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (h *Hex) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	*h = b
+	return nil
+}
+
+// Description is a policy.
+type Description struct {
+	// Hash is the policy session's hash algorithm, e.g. "sha256".
+	Hash  string `json:"hash"`
+	Steps []Step `json:"steps"`
+}
+
+// Step is one policy command. Command selects which of the other fields
+// apply.
+type Step struct {
+	// Command is the policy command, without the "TPM2_" prefix:
+	// PolicyPCR, PolicyAuthValue, PolicyPassword, PolicyCommandCode,
+	// PolicyCpHash, PolicySecret, PolicySigned, PolicyAuthorize,
+	// PolicyNV, PolicyNvWritten, PolicyAuthorizeNV,
+	// PolicyDuplicationSelect or PolicyOR.
+	Command string `json:"command"`
+
+	// PCRs is the PolicyPCR selection, in the syntax of
+	// tpm2.ParsePCRSelection. The expected values are given either as
+	// PCRDigest, the digest of the selected PCRs, or as PCRValues, the
+	// selected PCRs' values in ascending order, bank by bank.
+	PCRs      string `json:"pcrs,omitempty"`
+	PCRDigest Hex    `json:"pcrDigest,omitempty"`
+	PCRValues []Hex  `json:"pcrValues,omitempty"`
+
+	// CommandCode is the PolicyCommandCode command, by name (e.g.
+	// "Unseal") or number.
+	CommandCode string `json:"commandCode,omitempty"`
+	// CPHash is the PolicyCpHash parameter hash.
+	CPHash Hex `json:"cpHash,omitempty"`
+
+	// AuthObject is the Name of the entity that PolicySecret or
+	// PolicySigned refers to. For PolicySecret it may also be one of
+	// "owner", "endorsement", "platform" and "lockout".
+	AuthObject string `json:"authObject,omitempty"`
+	// KeySign is the Name of the PolicyAuthorize signing key.
+	KeySign Hex `json:"keySign,omitempty"`
+	// PolicyRef qualifies PolicySecret, PolicySigned and
+	// PolicyAuthorize.
+	PolicyRef Hex `json:"policyRef,omitempty"`
+
+	// NVIndex is the Name of the NV index that PolicyNV or
+	// PolicyAuthorizeNV refers to.
+	NVIndex Hex `json:"nvIndex,omitempty"`
+	// OperandB, Offset and Operation are the PolicyNV comparison.
+	// Operation is a name such as "eq" or "unsignedLE", or a number.
+	OperandB  Hex    `json:"operandB,omitempty"`
+	Offset    uint16 `json:"offset,omitempty"`
+	Operation string `json:"operation,omitempty"`
+	// WrittenSet is the PolicyNvWritten flag.
+	WrittenSet bool `json:"writtenSet,omitempty"`
+
+	// ObjectName and NewParentName are the PolicyDuplicationSelect
+	// Names; ObjectName only counts if IncludeObject is set.
+	ObjectName    Hex  `json:"objectName,omitempty"`
+	NewParentName Hex  `json:"newParentName,omitempty"`
+	IncludeObject bool `json:"includeObject,omitempty"`
+
+	// Branches are the alternatives of a PolicyOR, each a list of steps
+	// starting from an empty policy.
+	Branches [][]Step `json:"branches,omitempty"`
+}
+
+// Trace is the policy digest after one step.
+type Trace struct {
+	// Path locates the step: "2" is the second step, and "2.1.3" the
+	// third step of the first branch of the PolicyOR that is step 2.
+	Path string `json:"path"`
+	// Step describes the step, e.g. "PolicyPCR sha256:0,7".
+	Step   string `json:"step"`
+	Digest Hex    `json:"digest"`
+}
+
+// Result is an evaluated policy.
+type Result struct {
+	Hash   string `json:"hash"`
+	Digest Hex    `json:"digest"`
+	// Trace holds the intermediate digests. A PolicyOR's branches come
+	// before the PolicyOR itself.
+	Trace []Trace `json:"trace"`
+}
+
+// Parse parses a JSON policy description.
+func Parse(data []byte) (*Description, error) {
+	var d Description
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&d); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return &d, nil
+}
+
+// hashAlgs maps the names accepted in Description.Hash to algorithms.
+var hashAlgs = map[string]tpm2.TPMIAlgHash{
+	"sha1":   tpm2.TPMAlgSHA1,
+	"sha256": tpm2.TPMAlgSHA256,
+	"sha384": tpm2.TPMAlgSHA384,
+	"sha512": tpm2.TPMAlgSHA512,
+}
+
+// Eval computes the policy's digest.
+func (d *Description) Eval() (*Result, error) {
+	alg, ok := hashAlgs[strings.ToLower(d.Hash)]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown hash algorithm %q", ErrInvalid, d.Hash)
+	}
+	e := evaluator{alg: alg}
+	digest, err := e.eval("", d.Steps)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Hash: strings.ToLower(d.Hash), Digest: digest, Trace: e.trace}, nil
+}
+
+type evaluator struct {
+	alg   tpm2.TPMIAlgHash
+	trace []Trace
+}
+
+// eval computes the digest of steps starting from an empty policy. prefix
+// is the path of the enclosing branch.
+func (e *evaluator) eval(prefix string, steps []Step) ([]byte, error) {
+	calc, err := tpm2.NewPolicyCalculator(e.alg)
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range steps {
+		path := prefix + strconv.Itoa(i+1)
+		desc, err := e.step(calc, path, &s)
+		if errors.Is(err, ErrInvalid) {
+			// An error in a PolicyOR branch, already located.
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: step %s (%s): %v", ErrInvalid, path, s.Command, err)
+		}
+		e.trace = append(e.trace, Trace{Path: path, Step: desc, Digest: calc.Hash().Digest})
+	}
+	return calc.Hash().Digest, nil
+}
+
+// step applies s to calc and returns a description of it.
+func (e *evaluator) step(calc *tpm2.PolicyCalculator, path string, s *Step) (string, error) {
+	switch s.Command {
+	case "PolicyPCR":
+		sel, err := tpm2.ParsePCRSelection(s.PCRs)
+		if err != nil {
+			return "", err
+		}
+		digest, err := pcrDigest(e.alg, s)
+		if err != nil {
+			return "", err
+		}
+		return "PolicyPCR " + s.PCRs, tpm2.PolicyPCR{Pcrs: *sel, PcrDigest: tpm2.TPM2BDigest{Buffer: digest}}.Update(calc)
+	case "PolicyAuthValue", "PolicyPassword":
+		// Both set the same policy; they differ only in how the
+		// session proves knowledge of the authValue.
+		return s.Command, tpm2.PolicyAuthValue{}.Update(calc)
+	case "PolicyCommandCode":
+		cc, err := parseCommandCode(s.CommandCode)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("PolicyCommandCode %s (0x%08x)", s.CommandCode, uint32(cc)), tpm2.PolicyCommandCode{Code: cc}.Update(calc)
+	case "PolicyCpHash":
+		return "PolicyCpHash " + hex.EncodeToString(s.CPHash), tpm2.PolicyCPHash{CPHashA: tpm2.TPM2BDigest{Buffer: s.CPHash}}.Update(calc)
+	case "PolicySecret":
+		name, err := parseAuthObject(s.AuthObject)
+		if err != nil {
+			return "", err
+		}
+		tpm2.PolicySecret{
+			AuthHandle: tpm2.NamedHandle{Name: tpm2.TPM2BName{Buffer: name}},
+			PolicyRef:  tpm2.TPM2BNonce{Buffer: s.PolicyRef},
+		}.Update(calc)
+		return "PolicySecret " + s.AuthObject + ref(s.PolicyRef), nil
+	case "PolicySigned":
+		name, err := hex.DecodeString(s.AuthObject)
+		if err != nil || len(name) == 0 {
+			return "", errors.New("authObject must be the signing key's Name")
+		}
+		return "PolicySigned " + s.AuthObject + ref(s.PolicyRef), tpm2.PolicySigned{
+			AuthObject: tpm2.NamedHandle{Name: tpm2.TPM2BName{Buffer: name}},
+			PolicyRef:  tpm2.TPM2BNonce{Buffer: s.PolicyRef},
+		}.Update(calc)
+	case "PolicyAuthorize":
+		if len(s.KeySign) == 0 {
+			return "", errors.New("keySign is missing")
+		}
+		return "PolicyAuthorize " + hex.EncodeToString(s.KeySign) + ref(s.PolicyRef), tpm2.PolicyAuthorize{
+			KeySign:   tpm2.TPM2BName{Buffer: s.KeySign},
+			PolicyRef: tpm2.TPM2BDigest{Buffer: s.PolicyRef},
+		}.Update(calc)
+	case "PolicyNV":
+		if len(s.NVIndex) == 0 {
+			return "", errors.New("nvIndex is missing")
+		}
+		op, err := parseOperation(s.Operation)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("PolicyNV %x %s %x at offset %d", []byte(s.NVIndex), s.Operation, []byte(s.OperandB), s.Offset), tpm2.PolicyNV{
+			NVIndex:   tpm2.NamedHandle{Name: tpm2.TPM2BName{Buffer: s.NVIndex}},
+			OperandB:  tpm2.TPM2BOperand{Buffer: s.OperandB},
+			Offset:    s.Offset,
+			Operation: op,
+		}.Update(calc)
+	case "PolicyNvWritten":
+		return fmt.Sprintf("PolicyNvWritten %v", s.WrittenSet), tpm2.PolicyNVWritten{WrittenSet: tpm2.TPMIYesNo(s.WrittenSet)}.Update(calc)
+	case "PolicyAuthorizeNV":
+		if len(s.NVIndex) == 0 {
+			return "", errors.New("nvIndex is missing")
+		}
+		return "PolicyAuthorizeNV " + hex.EncodeToString(s.NVIndex), tpm2.PolicyAuthorizeNV{
+			NVIndex: tpm2.NamedHandle{Name: tpm2.TPM2BName{Buffer: s.NVIndex}},
+		}.Update(calc)
+	case "PolicyDuplicationSelect":
+		return "PolicyDuplicationSelect " + hex.EncodeToString(s.NewParentName), tpm2.PolicyDuplicationSelect{
+			ObjectName:    tpm2.TPM2BName{Buffer: s.ObjectName},
+			NewParentName: tpm2.TPM2BName{Buffer: s.NewParentName},
+			IncludeObject: tpm2.TPMIYesNo(s.IncludeObject),
+		}.Update(calc)
+	case "PolicyOR":
+		if len(s.Branches) < 2 || len(s.Branches) > 8 {
+			return "", fmt.Errorf("PolicyOR takes 2 to 8 branches, not %d", len(s.Branches))
+		}
+		var or tpm2.PolicyOr
+		for i, b := range s.Branches {
+			digest, err := e.eval(fmt.Sprintf("%s.%d.", path, i+1), b)
+			if err != nil {
+				return "", err
+			}
+			or.PHashList.Digests = append(or.PHashList.Digests, tpm2.TPM2BDigest{Buffer: digest})
+		}
+		return fmt.Sprintf("PolicyOR of %d branches", len(s.Branches)), or.Update(calc)
+	}
+	return "", errors.New("unknown or unsupported policy command")
+}
+
+// pcrDigest returns the PCR digest of a PolicyPCR step.
+func pcrDigest(alg tpm2.TPMIAlgHash, s *Step) ([]byte, error) {
+	switch {
+	case s.PCRDigest != nil && s.PCRValues != nil:
+		return nil, errors.New("both pcrDigest and pcrValues are set")
+	case s.PCRDigest != nil:
+		return s.PCRDigest, nil
+	case s.PCRValues == nil:
+		return nil, errors.New("the expected PCR values are needed to compute the digest")
+	}
+	h, err := alg.Hash()
+	if err != nil {
+		return nil, err
+	}
+	hh := h.New()
+	for _, v := range s.PCRValues {
+		hh.Write(v)
+	}
+	return hh.Sum(nil), nil
+}
+
+// ref formats a policyRef for a step description.
+func ref(policyRef []byte) string {
+	if len(policyRef) == 0 {
+		return ""
+	}
+	return " ref " + hex.EncodeToString(policyRef)
+}
+
+// hierarchies are the entities PolicySecret accepts by name.
+var hierarchies = map[string]tpm2.TPMHandle{
+	"owner":       tpm2.TPMRHOwner,
+	"endorsement": tpm2.TPMRHEndorsement,
+	"platform":    tpm2.TPMRHPlatform,
+	"lockout":     tpm2.TPMRHLockout,
+}
+
+func parseAuthObject(s string) ([]byte, error) {
+	if h, ok := hierarchies[strings.ToLower(s)]; ok {
+		return tpm2.HandleName(h).Buffer, nil
+	}
+	name, err := hex.DecodeString(s)
+	if err != nil || len(name) == 0 {
+		return nil, errors.New("authObject must be a hierarchy or a Name")
+	}
+	return name, nil
+}
+
+// commandCodes are the commands PolicyCommandCode accepts by name: those
+// that policies commonly restrict a session to.
+var commandCodes = map[string]tpm2.TPMCC{
+	"ActivateCredential": tpm2.TPMCCActivateCredential,
+	"Certify":            tpm2.TPMCCCertify,
+	"CertifyCreation":    tpm2.TPMCCCertifyCreation,
+	"Create":             tpm2.TPMCCCreate,
+	"Duplicate":          tpm2.TPMCCDuplicate,
+	"ECDH_ZGen":          tpm2.TPMCCECDHZGen,
+	"EvictControl":       tpm2.TPMCCEvictControl,
+	"Load":               tpm2.TPMCCLoad,
+	"NV_ChangeAuth":      tpm2.TPMCCNVChangeAuth,
+	"NV_Extend":          tpm2.TPMCCNVExtend,
+	"NV_Increment":       tpm2.TPMCCNVIncrement,
+	"NV_Read":            tpm2.TPMCCNVRead,
+	"NV_Write":           tpm2.TPMCCNVWrite,
+	"ObjectChangeAuth":   tpm2.TPMCCObjectChangeAuth,
+	"Quote":              tpm2.TPMCCQuote,
+	"RSA_Decrypt":        tpm2.TPMCCRSADecrypt,
+	"Sign":               tpm2.TPMCCSign,
+	"Unseal":             tpm2.TPMCCUnseal,
+}
+
+func parseCommandCode(s string) (tpm2.TPMCC, error) {
+	if cc, ok := commandCodes[strings.TrimPrefix(s, "TPM2_")]; ok {
+		return cc, nil
+	}
+	n, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unknown command %q; use its command code", s)
+	}
+	return tpm2.TPMCC(n), nil
+}
+
+// operations are the names of the TPM_EO comparisons for PolicyNV.
+var operations = map[string]tpm2.TPMEO{
+	"eq":         tpm2.TPMEOEq,
+	"neq":        tpm2.TPMEONeq,
+	"signedGT":   tpm2.TPMEOSignedGT,
+	"unsignedGT": tpm2.TPMEOUnsignedGT,
+	"signedLT":   tpm2.TPMEOSignedLT,
+	"unsignedLT": tpm2.TPMEOUnsignedLT,
+	"signedGE":   tpm2.TPMEOSignedGE,
+	"unsignedGE": tpm2.TPMEOUnsignedGE,
+	"signedLE":   tpm2.TPMEOSignedLE,
+	"unsignedLE": tpm2.TPMEOUnsignedLE,
+	"bitSet":     tpm2.TPMEOBitSet,
+	"bitClear":   tpm2.TPMEOBitClear,
+}
+
+func parseOperation(s string) (tpm2.TPMEO, error) {
+	if op, ok := operations[s]; ok {
+		return op, nil
+	}
+	n, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("unknown operation %q", s)
+	}
+	return tpm2.TPMEO(n), nil
+}
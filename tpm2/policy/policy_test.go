@@ -0,0 +1,219 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+var update = flag.Bool("update", false, "regenerate the digests in testdata/vectors.json")
+
+// vector is an entry of testdata/vectors.json.
+type vector struct {
+	Name   string      `json:"name"`
+	Policy Description `json:"policy"`
+	Digest Hex         `json:"digest"`
+}
+
+// errUnsupported is returned by runOnTPM for steps that need entities the
+// test doesn't create.
+var errUnsupported = errors.New("step needs a real entity")
+
+// runOnTPM runs steps in a trial session and returns the TPM's digest.
+func runOnTPM(t transport.TPM, alg tpm2.TPMIAlgHash, steps []Step) ([]byte, error) {
+	sess, cleanup, err := tpm2.PolicySession(t, alg, 16, tpm2.Trial())
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	for _, s := range steps {
+		var err error
+		switch s.Command {
+		case "PolicyPCR":
+			sel, perr := tpm2.ParsePCRSelection(s.PCRs)
+			if perr != nil {
+				return nil, perr
+			}
+			digest, perr := pcrDigest(alg, &s)
+			if perr != nil {
+				return nil, perr
+			}
+			_, err = tpm2.PolicyPCR{PolicySession: sess.Handle(), Pcrs: *sel, PcrDigest: tpm2.TPM2BDigest{Buffer: digest}}.Execute(t)
+		case "PolicyAuthValue":
+			_, err = tpm2.PolicyAuthValue{PolicySession: sess.Handle()}.Execute(t)
+		case "PolicyCommandCode":
+			cc, perr := parseCommandCode(s.CommandCode)
+			if perr != nil {
+				return nil, perr
+			}
+			_, err = tpm2.PolicyCommandCode{PolicySession: sess.Handle(), Code: cc}.Execute(t)
+		case "PolicyCpHash":
+			_, err = tpm2.PolicyCPHash{PolicySession: sess.Handle(), CPHashA: tpm2.TPM2BDigest{Buffer: s.CPHash}}.Execute(t)
+		case "PolicySecret":
+			h, ok := hierarchies[strings.ToLower(s.AuthObject)]
+			if !ok {
+				return nil, errUnsupported
+			}
+			_, err = tpm2.PolicySecret{
+				AuthHandle:    tpm2.AuthHandle{Handle: h, Auth: tpm2.PasswordAuth(nil)},
+				PolicySession: sess.Handle(),
+				PolicyRef:     tpm2.TPM2BNonce{Buffer: s.PolicyRef},
+			}.Execute(t)
+		case "PolicyAuthorize":
+			// A trial session doesn't check the ticket.
+			_, err = tpm2.PolicyAuthorize{
+				PolicySession: sess.Handle(),
+				PolicyRef:     tpm2.TPM2BDigest{Buffer: s.PolicyRef},
+				KeySign:       tpm2.TPM2BName{Buffer: s.KeySign},
+				CheckTicket:   tpm2.TPMTTKVerified{Tag: tpm2.TPMSTVerified, Hierarchy: tpm2.TPMRHNull},
+			}.Execute(t)
+		case "PolicyNvWritten":
+			_, err = tpm2.PolicyNVWritten{PolicySession: sess.Handle(), WrittenSet: tpm2.TPMIYesNo(s.WrittenSet)}.Execute(t)
+		case "PolicyDuplicationSelect":
+			_, err = tpm2.PolicyDuplicationSelect{
+				PolicySession: sess.Handle(),
+				ObjectName:    tpm2.TPM2BName{Buffer: s.ObjectName},
+				NewParentName: tpm2.TPM2BName{Buffer: s.NewParentName},
+				IncludeObject: tpm2.TPMIYesNo(s.IncludeObject),
+			}.Execute(t)
+		case "PolicyOR":
+			var or tpm2.PolicyOr
+			for _, b := range s.Branches {
+				digest, err := runOnTPM(t, alg, b)
+				if err != nil {
+					return nil, err
+				}
+				or.PHashList.Digests = append(or.PHashList.Digests, tpm2.TPM2BDigest{Buffer: digest})
+			}
+			or.PolicySession = sess.Handle()
+			_, err = or.Execute(t)
+		default:
+			return nil, errUnsupported
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	rsp, err := tpm2.PolicyGetDigest{PolicySession: sess.Handle()}.Execute(t)
+	if err != nil {
+		return nil, err
+	}
+	return rsp.PolicyDigest.Buffer, nil
+}
+
+func TestVectors(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	data, err := os.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []vector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("testdata/vectors.json: %v", err)
+	}
+	onTPM := 0
+	for i, v := range vectors {
+		got, err := v.Policy.Eval()
+		if err != nil {
+			t.Errorf("%s: Eval() = %v", v.Name, err)
+			continue
+		}
+		want, err := runOnTPM(thetpm, hashAlgs[v.Policy.Hash], v.Policy.Steps)
+		switch {
+		case errors.Is(err, errUnsupported):
+			want = got.Digest
+		case err != nil:
+			t.Errorf("%s: running the policy on the simulator: %v", v.Name, err)
+			continue
+		default:
+			onTPM++
+			if !bytes.Equal(got.Digest, want) {
+				t.Errorf("%s: Eval() digest = %x, TPM computes %x", v.Name, got.Digest, want)
+			}
+		}
+		if *update {
+			vectors[i].Digest = want
+		} else if !bytes.Equal(got.Digest, v.Digest) {
+			t.Errorf("%s: Eval() digest = %x, want %x", v.Name, got.Digest, []byte(v.Digest))
+		}
+		if last := got.Trace[len(got.Trace)-1]; !bytes.Equal(last.Digest, got.Digest) {
+			t.Errorf("%s: last trace digest = %x, want the policy digest", v.Name, []byte(last.Digest))
+		}
+	}
+	if onTPM < len(vectors)/2 {
+		t.Errorf("only %d of %d vectors were checked against the simulator", onTPM, len(vectors))
+	}
+	if *update {
+		out, err := json.MarshalIndent(vectors, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile("testdata/vectors.json", append(out, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	d, err := Parse([]byte(`{
+		"hash": "sha256",
+		"steps": [
+			{"command": "PolicyCommandCode", "commandCode": "Unseal"},
+			{"command": "PolicyOR", "branches": [
+				[{"command": "PolicyAuthValue"}],
+				[{"command": "PolicySecret", "authObject": "owner"}, {"command": "PolicyNvWritten"}]
+			]}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	r, err := d.Eval()
+	if err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	var paths []string
+	for _, tr := range r.Trace {
+		paths = append(paths, tr.Path)
+	}
+	if got, want := strings.Join(paths, " "), "1 2.1.1 2.2.1 2.2.2 2"; got != want {
+		t.Errorf("trace paths = %q, want %q", got, want)
+	}
+	// The first branch is PolicyAuthValue alone.
+	if got, want := r.Trace[1].Digest.String(), "8fcd2169ab92694e0c633f1ab772842b8241bbc20288981fc7ac1eddc1fddb0e"; got != want {
+		t.Errorf("PolicyAuthValue digest = %s, want %s", got, want)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	for _, desc := range []string{
+		`{"hash": "md5", "steps": []}`,
+		`{"hash": "sha256", "steps": [{"command": "PolicyLocality"}]}`,
+		`{"hash": "sha256", "steps": [{"command": "PolicyPCR", "pcrs": "sha256:0"}]}`,
+		`{"hash": "sha256", "steps": [{"command": "PolicyCommandCode", "commandCode": "Frobnicate"}]}`,
+		`{"hash": "sha256", "steps": [{"command": "PolicyOR", "branches": [[]]}]}`,
+		`{"hash": "sha256", "steps": [{"command": "PolicyOR", "branches": [[], [{"command": "PolicySecret"}]]}]}`,
+		`{"hash": "sha256", "steps": [{"command": "PolicyAuthValue", "unknown": 1}]}`,
+	} {
+		d, err := Parse([]byte(desc))
+		if err == nil {
+			_, err = d.Eval()
+		}
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: got %v, want %v", desc, err, ErrInvalid)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoProfile is returned by NegotiateProfile for TPMs that implement
+// neither of the key types, or neither of the hashes, it chooses from.
+var ErrNoProfile = errors.New("tpm2: the TPM implements none of the supported key profiles")
+
+// Profile is the set of algorithms chosen by NegotiateProfile for the keys
+// made from SRKTemplate, EKTemplate and AKTemplate.
+type Profile struct {
+	// Type is TPMAlgECC or TPMAlgRSA.
+	Type TPMIAlgPublic
+	// Curve is the curve of ECC keys.
+	Curve TPMECCCurve
+	// KeyBits is the modulus size of RSA keys.
+	KeyBits TPMKeyBits
+	// Hash is the name algorithm of SRKs and AKs, and the hash AKs sign
+	// with.
+	Hash TPMIAlgHash
+	// Fallbacks describes each preferred algorithm the TPM lacks and what
+	// replaced it. It is empty if the TPM implements the preferred profile.
+	Fallbacks []string
+}
+
+// NegotiateProfile chooses the algorithms for a TPM's keys from its
+// features. It prefers ECC NIST P-256 keys (with ECDSA for signing) and
+// falls back to RSA-2048 keys (with RSASSA); it prefers SHA-384 and falls
+// back to SHA-256.
+func NegotiateProfile(f *Features) (*Profile, error) {
+	var p Profile
+	switch {
+	case f.HasAlgorithm(TPMAlgECC) && f.HasCurve(TPMECCNistP256) && f.HasAlgorithm(TPMAlgECDSA):
+		p.Type, p.Curve = TPMAlgECC, TPMECCNistP256
+	case f.HasAlgorithm(TPMAlgRSA) && f.HasAlgorithm(TPMAlgRSASSA):
+		p.Type, p.KeyBits = TPMAlgRSA, 2048
+		p.Fallbacks = append(p.Fallbacks, "ECC NIST P-256 is not implemented, using RSA-2048")
+	default:
+		return nil, fmt.Errorf("%w: no ECC NIST P-256 or RSA keys", ErrNoProfile)
+	}
+	hash, err := f.HashAlg(TPMAlgSHA384, TPMAlgSHA256)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoProfile, err)
+	}
+	if hash != TPMAlgSHA384 {
+		p.Fallbacks = append(p.Fallbacks, "SHA-384 is not implemented, using SHA-256")
+	}
+	p.Hash = hash
+	return &p, nil
+}
+
+// String returns a description of the profile, such as "ECC NIST P-256,
+// SHA-384".
+func (p *Profile) String() string {
+	var b strings.Builder
+	switch p.Type {
+	case TPMAlgECC:
+		if p.Curve == TPMECCNistP256 {
+			b.WriteString("ECC NIST P-256")
+		} else {
+			fmt.Fprintf(&b, "ECC curve %#x", uint16(p.Curve))
+		}
+	case TPMAlgRSA:
+		fmt.Fprintf(&b, "RSA-%d", p.KeyBits)
+	default:
+		fmt.Fprintf(&b, "key type %#x", uint16(p.Type))
+	}
+	switch p.Hash {
+	case TPMAlgSHA256:
+		b.WriteString(", SHA-256")
+	case TPMAlgSHA384:
+		b.WriteString(", SHA-384")
+	default:
+		fmt.Fprintf(&b, ", hash %#x", uint16(p.Hash))
+	}
+	return b.String()
+}
+
+// SRKTemplate returns an SRK template for the profile: ECCSRKTemplate or
+// RSASRKTemplate, with the profile's name algorithm. Only with SHA-256 is it
+// the TCG reference SRK that other software recreates; with SHA-384 the
+// template, and so the key, differs from it.
+func (p *Profile) SRKTemplate() TPMTPublic {
+	t := RSASRKTemplate
+	if p.Type == TPMAlgECC {
+		t = ECCSRKTemplate
+	}
+	t.NameAlg = p.Hash
+	return t
+}
+
+// EKTemplate returns the TCG reference EK template for the profile's key
+// type, ECCEKTemplate or RSAEKTemplate. The EK templates are fixed by the
+// TCG EK Credential Profile, which matches them to the EK certificates, so
+// they keep SHA-256 whatever the profile's hash.
+func (p *Profile) EKTemplate() TPMTPublic {
+	if p.Type == TPMAlgECC {
+		return ECCEKTemplate
+	}
+	return RSAEKTemplate
+}
+
+// AKTemplate returns a template for an attestation key: a restricted
+// signing key of the profile's key type that signs with the profile's hash.
+func (p *Profile) AKTemplate() TPMTPublic {
+	t := TPMTPublic{
+		Type:    p.Type,
+		NameAlg: p.Hash,
+		ObjectAttributes: TPMAObject{
+			FixedTPM:            true,
+			FixedParent:         true,
+			SensitiveDataOrigin: true,
+			UserWithAuth:        true,
+			NoDA:                true,
+			Restricted:          true,
+			SignEncrypt:         true,
+		},
+	}
+	if p.Type == TPMAlgECC {
+		t.Parameters = NewTPMUPublicParms(
+			TPMAlgECC,
+			&TPMSECCParms{
+				Scheme: TPMTECCScheme{
+					Scheme: TPMAlgECDSA,
+					Details: NewTPMUAsymScheme(
+						TPMAlgECDSA,
+						&TPMSSigSchemeECDSA{HashAlg: p.Hash},
+					),
+				},
+				CurveID: p.Curve,
+			},
+		)
+		return t
+	}
+	t.Parameters = NewTPMUPublicParms(
+		TPMAlgRSA,
+		&TPMSRSAParms{
+			Scheme: TPMTRSAScheme{
+				Scheme: TPMAlgRSASSA,
+				Details: NewTPMUAsymScheme(
+					TPMAlgRSASSA,
+					&TPMSSigSchemeRSASSA{HashAlg: p.Hash},
+				),
+			},
+			KeyBits: p.KeyBits,
+		},
+	)
+	return t
+}
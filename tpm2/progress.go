@@ -0,0 +1,212 @@
+package tpm2
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Limits on how a ProgressReporter polls a TPM that asks for a command to be
+// sent again. The wait doubles after each such response.
+const (
+	defaultProgressInterval = time.Second
+	minPollBackoff          = 10 * time.Millisecond
+	maxPollBackoff          = time.Second
+	defaultPollRetries      = 32
+)
+
+// pollingRCs are the warnings with which the TPM asks for a command to be
+// sent again later, without having run it.
+var pollingRCs = map[TPMRC]bool{
+	TPMRCRetry:   true,
+	TPMRCYielded: true,
+	TPMRCTesting: true,
+}
+
+// Progress describes a command that is still running.
+type Progress struct {
+	// Command is the command's code.
+	Command TPMCC
+	// Elapsed is the time since the command was first sent.
+	Elapsed time.Duration
+	// Retries is how many times the TPM has asked for the command to be
+	// sent again.
+	Retries int
+	// Done is set in the last report about the command, once it has
+	// finished, failed or been abandoned.
+	Done bool
+}
+
+// ProgressReporter is a transport for commands that may take a long time,
+// such as creating an RSA primary key on a discrete TPM, which can take
+// tens of seconds. While a command runs, it calls its callback at regular
+// intervals, so that a CLI can show a spinner and a server can tell a slow
+// TPM from a hung one. When the TPM answers TPM_RC_RETRY, TPM_RC_YIELDED or
+// TPM_RC_TESTING, it waits and sends the command again.
+//
+// Commands sent through a transport returned by WithContext are abandoned
+// when the context is done. The TPM can't be interrupted, so an abandoned
+// command keeps running, and the next command waits for it to finish.
+//
+// A ProgressReporter is safe for concurrent use; commands are sent one at a
+// time.
+type ProgressReporter struct {
+	tpm      transport.TPM
+	interval time.Duration
+	report   func(Progress)
+	// MaxRetries is how many times a command is resent before the TPM's
+	// warning is returned to the caller. Zero selects a default.
+	MaxRetries int
+
+	// mu is held while a command is with the TPM.
+	mu sync.Mutex
+}
+
+// NewProgressReporter returns a ProgressReporter that sends commands to t
+// and calls report every interval while a command runs, and once more when
+// it is done. An interval of zero selects one second. report is called from
+// the goroutine that sent the command, and should return quickly.
+func NewProgressReporter(t transport.TPM, interval time.Duration, report func(Progress)) *ProgressReporter {
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	return &ProgressReporter{tpm: t, interval: interval, report: report}
+}
+
+// Send implements transport.TPM.
+func (r *ProgressReporter) Send(cmd []byte) ([]byte, error) {
+	return r.SendContext(context.Background(), cmd)
+}
+
+// WithContext returns a transport that sends commands through r, giving up
+// on them when ctx is done.
+func (r *ProgressReporter) WithContext(ctx context.Context) transport.TPM {
+	return &progressContext{r: r, ctx: ctx}
+}
+
+type progressContext struct {
+	r   *ProgressReporter
+	ctx context.Context
+}
+
+func (c *progressContext) Send(cmd []byte) ([]byte, error) {
+	return c.r.SendContext(c.ctx, cmd)
+}
+
+// Unwrap implements transport.Wrapper.
+func (c *progressContext) Unwrap() transport.TPM {
+	return c.r
+}
+
+// Unwrap implements transport.Wrapper.
+func (r *ProgressReporter) Unwrap() transport.TPM {
+	return r.tpm
+}
+
+// sendResult is the outcome of sending a command to the TPM.
+type sendResult struct {
+	rsp []byte
+	err error
+}
+
+// SendContext sends cmd and returns the response, reporting progress while
+// it waits, and giving up when ctx is done.
+func (r *ProgressReporter) SendContext(ctx context.Context, cmd []byte) ([]byte, error) {
+	var cc TPMCC
+	if len(cmd) >= 10 {
+		cc = TPMCC(binary.BigEndian.Uint32(cmd[6:10]))
+	}
+	maxRetries := r.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultPollRetries
+	}
+	// An abandoned command is still sent after SendContext returns, by
+	// when the caller may have reused cmd's buffer for another command.
+	if ctx.Done() != nil {
+		cmd = bytes.Clone(cmd)
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	var retries int
+	reported := false
+	report := func(done bool) {
+		reported = true
+		if r.report != nil {
+			r.report(Progress{Command: cc, Elapsed: time.Since(start), Retries: retries, Done: done})
+		}
+	}
+	defer func() {
+		if reported {
+			report(true)
+		}
+	}()
+	// wait waits for ch to deliver, reporting progress meanwhile.
+	wait := func(ch <-chan sendResult) (sendResult, error) {
+		for {
+			select {
+			case res := <-ch:
+				return res, nil
+			case <-ticker.C:
+				report(false)
+			case <-ctx.Done():
+				return sendResult{}, fmt.Errorf("abandoning command 0x%08x after %v: %w", uint32(cc), time.Since(start).Round(time.Millisecond), ctx.Err())
+			}
+		}
+	}
+
+	var backoff time.Duration
+	for {
+		res, err := wait(r.start(ctx, cmd))
+		if err != nil {
+			return nil, err
+		}
+		if res.err != nil || len(res.rsp) < 10 || retries == maxRetries ||
+			!pollingRCs[TPMRC(binary.BigEndian.Uint32(res.rsp[6:10]))] {
+			return res.rsp, res.err
+		}
+		retries++
+		if backoff == 0 {
+			backoff = minPollBackoff
+		} else if backoff *= 2; backoff > maxPollBackoff {
+			backoff = maxPollBackoff
+		}
+		timer := make(chan sendResult, 1)
+		time.AfterFunc(backoff, func() { timer <- sendResult{} })
+		if _, err := wait(timer); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// start sends cmd once the TPM is free, unless ctx is done by then, and
+// returns a channel that delivers the result.
+func (r *ProgressReporter) start(ctx context.Context, cmd []byte) <-chan sendResult {
+	ch := make(chan sendResult, 1)
+	go func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if err := ctx.Err(); err != nil {
+			ch <- sendResult{err: err}
+			return
+		}
+		rsp, err := r.tpm.Send(cmd)
+		ch <- sendResult{rsp: rsp, err: err}
+	}()
+	return ch
+}
+
+// Close closes the underlying transport, if it can be closed.
+func (r *ProgressReporter) Close() error {
+	if c, ok := r.tpm.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
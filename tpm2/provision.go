@@ -0,0 +1,174 @@
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// DefaultSRKHandle is the persistent handle that the TCG provisioning
+// guidance reserves for the storage root key.
+const DefaultSRKHandle TPMHandle = 0x81000001
+
+// DAParameters are the dictionary attack protection settings applied with
+// TPM2_DictionaryAttackParameters.
+type DAParameters struct {
+	// MaxTries is the number of authorization failures before lockout.
+	MaxTries uint32
+	// RecoveryTime is the number of seconds after which one failure is
+	// forgotten. Zero disables dictionary attack protection.
+	RecoveryTime uint32
+	// LockoutRecovery is the number of seconds after a failed lockoutAuth
+	// before lockoutAuth may be used again.
+	LockoutRecovery uint32
+}
+
+// ProvisionConfig describes the first-boot setup done by Provision.
+// Zero fields are left alone.
+type ProvisionConfig struct {
+	// OwnerAuth, EndorsementAuth and LockoutAuth are the new authorization
+	// values for the owner, endorsement and lockout hierarchies.
+	OwnerAuth       []byte
+	EndorsementAuth []byte
+	LockoutAuth     []byte
+	// DA holds the dictionary attack parameters to configure.
+	DA *DAParameters
+	// SRKTemplate is the template of the storage root key to create, for
+	// example RSASRKTemplate or ECCSRKTemplate.
+	SRKTemplate *TPMTPublic
+	// SRKHandle is where the SRK is persisted. It defaults to
+	// DefaultSRKHandle.
+	SRKHandle TPMHandle
+}
+
+// ProvisionReport records what Provision changed.
+type ProvisionReport struct {
+	// OwnerAuthSet, EndorsementAuthSet and LockoutAuthSet report which
+	// hierarchy authorization values were changed.
+	OwnerAuthSet       bool
+	EndorsementAuthSet bool
+	LockoutAuthSet     bool
+	// DASet reports whether the dictionary attack parameters were changed.
+	DASet bool
+	// SRK is the persistent SRK, if an SRK template was given.
+	SRK *NamedHandle
+	// SRKCreated is false if a key was already persisted at the SRK handle,
+	// in which case it was left in place.
+	SRKCreated bool
+}
+
+// Changes returns a human-readable list of the changes in r.
+func (r *ProvisionReport) Changes() []string {
+	var changes []string
+	if r.DASet {
+		changes = append(changes, "configured dictionary attack parameters")
+	}
+	if r.SRKCreated {
+		changes = append(changes, fmt.Sprintf("persisted SRK at 0x%08x", uint32(r.SRK.Handle)))
+	}
+	if r.EndorsementAuthSet {
+		changes = append(changes, "set endorsement hierarchy authorization")
+	}
+	if r.OwnerAuthSet {
+		changes = append(changes, "set owner hierarchy authorization")
+	}
+	if r.LockoutAuthSet {
+		changes = append(changes, "set lockout authorization")
+	}
+	return changes
+}
+
+// Provision performs the standard first-boot setup of a TPM whose hierarchy
+// authorization values are still empty, as they are after TPM2_Clear. It
+// configures dictionary attack protection, creates and persists the SRK, and
+// finally sets the hierarchy authorization values, so that every step before
+// that can use the empty ones.
+//
+// An SRK that is already persisted at the SRK handle is kept, which lets
+// Provision be retried after a failure in a later step. On error, the
+// returned report describes the changes made before the failure.
+func Provision(t transport.TPM, cfg ProvisionConfig) (*ProvisionReport, error) {
+	var report ProvisionReport
+
+	if cfg.DA != nil {
+		if _, err := (DictionaryAttackParameters{
+			LockHandle:      TPMRHLockout,
+			NewMaxTries:     cfg.DA.MaxTries,
+			NewRecoveryTime: cfg.DA.RecoveryTime,
+			LockoutRecovery: cfg.DA.LockoutRecovery,
+		}).Execute(t); err != nil {
+			return &report, fmt.Errorf("configuring dictionary attack parameters: %w", err)
+		}
+		report.DASet = true
+	}
+
+	if cfg.SRKTemplate != nil {
+		handle := cfg.SRKHandle
+		if handle == 0 {
+			handle = DefaultSRKHandle
+		}
+		srk, created, err := provisionSRK(t, *cfg.SRKTemplate, handle)
+		if err != nil {
+			return &report, fmt.Errorf("provisioning SRK: %w", err)
+		}
+		report.SRK = srk
+		report.SRKCreated = created
+	}
+
+	for _, h := range []struct {
+		hierarchy TPMHandle
+		auth      []byte
+		set       *bool
+		name      string
+	}{
+		{TPMRHEndorsement, cfg.EndorsementAuth, &report.EndorsementAuthSet, "endorsement"},
+		{TPMRHOwner, cfg.OwnerAuth, &report.OwnerAuthSet, "owner"},
+		{TPMRHLockout, cfg.LockoutAuth, &report.LockoutAuthSet, "lockout"},
+	} {
+		if len(h.auth) == 0 {
+			continue
+		}
+		if _, err := (HierarchyChangeAuth{
+			AuthHandle: h.hierarchy,
+			NewAuth:    TPM2BAuth{Buffer: h.auth},
+		}).Execute(t); err != nil {
+			return &report, fmt.Errorf("setting %v authorization: %w", h.name, err)
+		}
+		*h.set = true
+	}
+	return &report, nil
+}
+
+// provisionSRK returns the key persisted at handle, creating it from
+// template if there is none. It reports whether the key was created.
+func provisionSRK(t transport.TPM, template TPMTPublic, handle TPMHandle) (*NamedHandle, bool, error) {
+	existing, err := ReadPublic{ObjectHandle: handle}.Execute(t)
+	if err == nil {
+		return &NamedHandle{Handle: handle, Name: existing.Name}, false, nil
+	}
+	if !errors.Is(err, TPMRCHandle) {
+		return nil, false, err
+	}
+
+	rsp, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(template),
+	}.Execute(t)
+	if err != nil {
+		return nil, false, err
+	}
+	defer FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(t)
+
+	if _, err := (EvictControl{
+		Auth: TPMRHOwner,
+		ObjectHandle: NamedHandle{
+			Handle: rsp.ObjectHandle,
+			Name:   rsp.Name,
+		},
+		PersistentHandle: handle,
+	}).Execute(t); err != nil {
+		return nil, false, err
+	}
+	return &NamedHandle{Handle: handle, Name: rsp.Name}, true, nil
+}
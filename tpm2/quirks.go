@@ -0,0 +1,121 @@
+package tpm2
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Quirk is a workaround for a known behavior of some TPMs.
+type Quirk struct {
+	// Name identifies the quirk.
+	Name string
+	// Description explains what the quirk works around.
+	Description string
+	// Match reports whether the quirk applies to a TPM.
+	Match func(DeviceInfo) bool
+	// Apply adjusts a connection to the TPM. It may configure t, wrap it,
+	// or both, and returns the TPM to use from then on. A quirk that wraps
+	// t should do so with transport.Chain, so that the result can still be
+	// closed, sized, timed out and moved to another locality as t can.
+	Apply func(t transport.TPM) transport.TPM
+}
+
+var (
+	quirksMu sync.Mutex
+	quirks   = []Quirk{
+		{
+			Name:        "infineon-slow-keygen",
+			Description: "RSA key generation can take several minutes",
+			Match:       manufacturerIs("IFX"),
+			Apply:       withCommandTimeout(10 * time.Minute),
+		},
+		{
+			Name:        "nuvoton-capability-paging",
+			Description: "large TPM2_GetCapability requests can return incomplete data",
+			Match:       manufacturerIs("NTC"),
+			Apply:       withCapabilityLimit(16),
+		},
+	}
+)
+
+// RegisterQuirk adds q to the quirks that QuirksFor and ApplyQuirks
+// consider. Quirks are applied in the order they were registered, after the
+// built-in ones.
+func RegisterQuirk(q Quirk) {
+	quirksMu.Lock()
+	defer quirksMu.Unlock()
+	quirks = append(quirks, q)
+}
+
+// QuirksFor returns the registered quirks that apply to the TPM described by
+// info.
+func QuirksFor(info DeviceInfo) []Quirk {
+	quirksMu.Lock()
+	defer quirksMu.Unlock()
+	var matched []Quirk
+	for _, q := range quirks {
+		if q.Match(info) {
+			matched = append(matched, q)
+		}
+	}
+	return matched
+}
+
+// ApplyQuirks identifies the TPM with GetDeviceInfo and applies the quirks
+// that match it. It returns the TPM to use from then on, which sends its
+// commands through t and implements the same optional transport interfaces,
+// such as io.Closer, along with the quirks that were applied. If no quirk
+// applies, that is t itself.
+func ApplyQuirks(t transport.TPM) (transport.TPM, []Quirk, error) {
+	info, err := GetDeviceInfo(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	applied := QuirksFor(*info)
+	for _, q := range applied {
+		t = q.Apply(t)
+	}
+	return t, applied, nil
+}
+
+func manufacturerIs(id string) func(DeviceInfo) bool {
+	return func(info DeviceInfo) bool {
+		return info.Manufacturer == id
+	}
+}
+
+// withCommandTimeout sets the command timeout of transports that enforce
+// one themselves. Others rely on the kernel driver and are left alone.
+func withCommandTimeout(timeout time.Duration) func(transport.TPM) transport.TPM {
+	return func(t transport.TPM) transport.TPM {
+		if ts, ok := t.(transport.CommandTimeoutSetter); ok {
+			ts.SetCommandTimeout(timeout)
+		}
+		return t
+	}
+}
+
+// withCapabilityLimit caps the number of values asked for by each
+// TPM2_GetCapability. The TPM then sets moreData, as it may for any request,
+// so callers that page through the results still see all of them.
+func withCapabilityLimit(limit uint32) func(transport.TPM) transport.TPM {
+	return func(t transport.TPM) transport.TPM {
+		return transport.Chain(t, func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+			// Only commands without sessions are rewritten, since changing
+			// the parameters of any other would invalidate its
+			// authorizations.
+			const countOffset = 10 + 4 + 4
+			if len(cmd) == countOffset+4 &&
+				TPMST(binary.BigEndian.Uint16(cmd)) == TPMSTNoSessions &&
+				TPMCC(binary.BigEndian.Uint32(cmd[6:])) == TPMCCGetCapability &&
+				binary.BigEndian.Uint32(cmd[countOffset:]) > limit {
+				cmd = append([]byte(nil), cmd...)
+				binary.BigEndian.PutUint32(cmd[countOffset:], limit)
+			}
+			return next(cmd)
+		})
+	}
+}
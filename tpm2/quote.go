@@ -0,0 +1,184 @@
+package tpm2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrQuoteMismatch is returned by VerifyQuoteAllBanks when a quote does not
+// agree with the event log.
+var ErrQuoteMismatch = errors.New("quote does not match the event log")
+
+// ErrNotTPMGenerated is returned by VerifyAttestation for a correctly signed
+// structure that does not start with TPM_GENERATED_VALUE, and so was not
+// produced by one of the TPM's attestation commands.
+var ErrNotTPMGenerated = errors.New("attestation was not generated by the TPM")
+
+// QuoteAllBanks quotes the given PCRs in every active PCR bank with a single
+// TPM2_Quote, using the signing scheme of signHandle. Quoting every bank
+// means that a verifier can check that none of them was left out of the
+// measurements, as VerifyQuoteAllBanks does.
+func QuoteAllBanks(t transport.TPM, signHandle handle, qualifyingData []byte, pcrs []uint, s ...Session) (*QuoteResponse, error) {
+	banks, err := ActivePCRBanks(t)
+	if err != nil {
+		return nil, fmt.Errorf("reading active PCR banks: %w", err)
+	}
+	var sel TPMLPCRSelection
+	for _, bank := range banks {
+		sel.PCRSelections = append(sel.PCRSelections, TPMSPCRSelection{
+			Hash:      bank,
+			PCRSelect: PCClientCompatible.PCRs(pcrs...),
+		})
+	}
+	return Quote{
+		SignHandle:     signHandle,
+		QualifyingData: TPM2BData{Buffer: qualifyingData},
+		InScheme:       TPMTSigScheme{Scheme: TPMAlgNull},
+		PCRSelect:      sel,
+	}.Execute(t, s...)
+}
+
+// VerifyAttestation checks that sig is ak's signature over attest, as
+// returned by TPM2_Quote, TPM2_Certify and the other attestation commands,
+// and returns the attestation's contents. The caller must check that ak is a
+// trusted attestation key and that the contents are as expected.
+//
+// A restricted key also signs digests from TPM2_Hash of data that does not
+// start with TPM_GENERATED_VALUE, so VerifyAttestation returns
+// ErrNotTPMGenerated unless the contents start with it.
+func VerifyAttestation(ak *TPMTPublic, attest *TPM2BAttest, sig *TPMTSignature) (*TPMSAttest, error) {
+	pub, err := cryptoPublicKey(ak)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyTPMSignature(pub, sig, attest.Bytes()); err != nil {
+		return nil, err
+	}
+	contents, err := attest.Contents()
+	if err != nil {
+		return nil, err
+	}
+	if err := contents.Magic.Check(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotTPMGenerated, err)
+	}
+	return contents, nil
+}
+
+// ReplayEventLog computes the values that the PCRs in each of the given
+// banks should have after the measurements in log, assuming that they
+// started at zero. EV_NO_ACTION events are not extended. Every other entry
+// must have a digest for each bank.
+//
+// The digests are replayed as they are: whether they are those of the
+// entries' data depends on the event type, so checking them against the
+// data is left to the caller.
+func ReplayEventLog(log *EventLog, banks []TPMIAlgHash) (PCRValues, error) {
+	vals := make(PCRValues)
+	for i, e := range log.Entries {
+		if e.Type == EVNoAction {
+			continue
+		}
+		for _, bank := range banks {
+			h, err := bank.Hash()
+			if err != nil {
+				return nil, err
+			}
+			digest, ok := entryDigest(e, bank)
+			if !ok {
+				return nil, fmt.Errorf("%w: entry %d for PCR %d has no %v digest",
+					ErrQuoteMismatch, i, e.PCR, PCRBankName(bank))
+			}
+			if vals[bank] == nil {
+				vals[bank] = make(PCRBankValues)
+			}
+			pcr := uint(e.PCR)
+			val, ok := vals[bank][pcr]
+			if !ok {
+				val = make([]byte, h.Size())
+			}
+			hasher := h.New()
+			hasher.Write(val)
+			hasher.Write(digest)
+			vals[bank][pcr] = hasher.Sum(nil)
+		}
+	}
+	return vals, nil
+}
+
+// entryDigest returns the digest that e extended into bank.
+func entryDigest(e EventLogEntry, bank TPMIAlgHash) ([]byte, bool) {
+	for _, d := range e.Digests.Digests {
+		if d.HashAlg == bank {
+			return d.Digest, true
+		}
+	}
+	return nil, false
+}
+
+// VerifyQuoteAllBanks checks that quoted, as returned by QuoteAllBanks,
+// covers pcrs in every one of banks, and that its PCR digest matches a replay
+// of log in all of them. digestAlg is the hash algorithm of the quote's
+// signature. The signature itself, and the qualifying data, must be checked
+// separately.
+//
+// A quote over a single bank can only show that that bank matches the log,
+// leaving the others free to hold anything; this makes sure that they agree.
+func VerifyQuoteAllBanks(quoted *TPMSAttest, digestAlg TPMIAlgHash, log *EventLog, banks []TPMIAlgHash, pcrs []uint) error {
+	if quoted.Type != TPMSTAttestQuote {
+		return fmt.Errorf("attestation is not a quote: %v", quoted.Type)
+	}
+	info, err := quoted.Attested.Quote()
+	if err != nil {
+		return err
+	}
+
+	want := PCClientCompatible.PCRs(pcrs...)
+	for _, bank := range banks {
+		var covered bool
+		for _, s := range info.PCRSelect.PCRSelections {
+			if s.Hash == bank && bytes.Equal(s.PCRSelect, want) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return fmt.Errorf("%w: PCRs %v are not quoted in the %v bank",
+				ErrQuoteMismatch, pcrs, PCRBankName(bank))
+		}
+	}
+
+	var quotedBanks []TPMIAlgHash
+	for _, s := range info.PCRSelect.PCRSelections {
+		quotedBanks = append(quotedBanks, s.Hash)
+	}
+	vals, err := ReplayEventLog(log, quotedBanks)
+	if err != nil {
+		return err
+	}
+	// PCRs that the log never extends still hold their initial value.
+	for _, s := range info.PCRSelect.PCRSelections {
+		h, err := s.Hash.Hash()
+		if err != nil {
+			return err
+		}
+		if vals[s.Hash] == nil {
+			vals[s.Hash] = make(PCRBankValues)
+		}
+		for _, pcr := range SelectedPCRs(s.PCRSelect) {
+			if _, ok := vals[s.Hash][pcr]; !ok {
+				vals[s.Hash][pcr] = make([]byte, h.Size())
+			}
+		}
+	}
+	digest, err := PCRCompositeDigest(digestAlg, info.PCRSelect, vals)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(digest, info.PCRDigest.Buffer) {
+		return fmt.Errorf("%w: PCR digest %x, replayed %x", ErrQuoteMismatch, info.PCRDigest.Buffer, digest)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package tpm2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// randReader reads random bytes from the TPM with TPM2_GetRandom.
+type randReader struct {
+	tpm transport.TPM
+}
+
+// RandReader returns an io.Reader of random bytes generated by the TPM.
+// Each Read fills the whole buffer, issuing as many TPM2_GetRandom commands
+// as needed, since the TPM returns at most one digest's worth of bytes per
+// command.
+func RandReader(t transport.TPM) io.Reader {
+	return &randReader{tpm: t}
+}
+
+// Read implements io.Reader.
+func (r *randReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		want := len(p) - n
+		if want > 0xffff {
+			want = 0xffff
+		}
+		rsp, err := GetRandom{BytesRequested: uint16(want)}.Execute(r.tpm)
+		if err != nil {
+			return n, err
+		}
+		if len(rsp.RandomBytes.Buffer) == 0 {
+			return n, fmt.Errorf("TPM2_GetRandom returned no bytes")
+		}
+		n += copy(p[n:], rsp.RandomBytes.Buffer)
+	}
+	return n, nil
+}
+
+// randSource is a math/rand source that draws from the TPM in batches.
+type randSource struct {
+	mu  sync.Mutex
+	r   io.Reader
+	buf [64]byte
+	off int
+}
+
+// RandSource returns a math/rand source of numbers generated by the TPM,
+// for example to pass to rand.New. It is safe for concurrent use. As the
+// source cannot return errors, it panics if the TPM cannot be read.
+//
+// For cryptographic use, read from RandReader instead.
+func RandSource(t transport.TPM) rand.Source64 {
+	s := &randSource{r: RandReader(t)}
+	s.off = len(s.buf)
+	return s
+}
+
+// Uint64 implements rand.Source64.
+func (s *randSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.off == len(s.buf) {
+		if _, err := io.ReadFull(s.r, s.buf[:]); err != nil {
+			panic(fmt.Sprintf("reading random bytes from the TPM: %v", err))
+		}
+		s.off = 0
+	}
+	v := binary.BigEndian.Uint64(s.buf[s.off:])
+	s.off += 8
+	return v
+}
+
+// Int63 implements rand.Source.
+func (s *randSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// Seed implements rand.Source. The TPM cannot be seeded, so Seed does
+// nothing.
+func (s *randSource) Seed(int64) {}
+
+// UUID is an RFC 4122 universally unique identifier.
+type UUID [16]byte
+
+// NewUUID returns a random (version 4) UUID generated from TPM entropy.
+func NewUUID(t transport.TPM) (UUID, error) {
+	var u UUID
+	if _, err := io.ReadFull(RandReader(t), u[:]); err != nil {
+		return UUID{}, err
+	}
+	u[6] = u[6]&0x0f | 0x40 // version 4
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+	return u, nil
+}
+
+// String returns u in the canonical 8-4-4-4-12 hexadecimal form.
+func (u UUID) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
@@ -0,0 +1,105 @@
+package tpm2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrReadOnly is returned by a ReadOnly transport for commands that would
+// change the state of the TPM.
+var ErrReadOnly = errors.New("command not allowed on a read-only TPM connection")
+
+// mutatingCommands are the commands that change state that outlives the
+// connection: NV contents, persistent objects, hierarchies and their
+// authorizations, PCRs, dictionary attack state and the clock. Commands that
+// only load, create or flush transient objects and sessions are not listed.
+var mutatingCommands = map[TPMCC]bool{
+	TPMCCNVUndefineSpaceSpecial:     true,
+	TPMCCEvictControl:               true,
+	TPMCCHierarchyControl:           true,
+	TPMCCNVUndefineSpace:            true,
+	TPMCCChangeEPS:                  true,
+	TPMCCChangePPS:                  true,
+	TPMCCClear:                      true,
+	TPMCCClearControl:               true,
+	TPMCCClockSet:                   true,
+	TPMCCHierarchyChanegAuth:        true,
+	TPMCCNVDefineSpace:              true,
+	TPMCCPCRAllocate:                true,
+	TPMCCPCRSetAuthPolicy:           true,
+	TPMCCPPCommands:                 true,
+	TPMCCSetPrimaryPolicy:           true,
+	TPMCCFieldUpgradeStart:          true,
+	TPMCCClockRateAdjust:            true,
+	TPMCCNVGlobalWriteLock:          true,
+	TPMCCNVIncrement:                true,
+	TPMCCNVSetBits:                  true,
+	TPMCCNVExtend:                   true,
+	TPMCCNVWrite:                    true,
+	TPMCCNVWriteLock:                true,
+	TPMCCDictionaryAttackLockReset:  true,
+	TPMCCDictionaryAttackParameters: true,
+	TPMCCNVChangeAuth:               true,
+	TPMCCPCREvent:                   true,
+	TPMCCPCRReset:                   true,
+	TPMCCSetAlgorithmSet:            true,
+	TPMCCSetCommandCodeAuditStatus:  true,
+	TPMCCFieldUpgradeData:           true,
+	TPMCCStartup:                    true,
+	TPMCCShutdown:                   true,
+	TPMCCNVReadLock:                 true,
+	TPMCCPCRExtend:                  true,
+	TPMCCPCRSetAuthValue:            true,
+	TPMCCEventSequenceComplete:      true,
+	TPMCCACSend:                     true,
+	TPMCCACTSetTimeout:              true,
+}
+
+// MutatesState reports whether cc is a command that a ReadOnly transport
+// rejects.
+func MutatesState(cc TPMCC) bool {
+	return mutatingCommands[cc]
+}
+
+// readOnly is a transport that refuses state-changing commands.
+type readOnly struct {
+	tpm transport.TPM
+}
+
+// ReadOnly returns a transport that sends commands to t, except for those
+// that would change the TPM's lasting state (see MutatesState), which fail
+// with ErrReadOnly without reaching the TPM. It is meant for monitoring and
+// attestation agents, which should never change the TPM even if they are
+// buggy; they can still create, load and flush transient objects and
+// sessions, for example to quote.
+func ReadOnly(t transport.TPM) transport.TPM {
+	return &readOnly{tpm: t}
+}
+
+// Send implements transport.TPM.
+func (r *readOnly) Send(cmd []byte) ([]byte, error) {
+	if len(cmd) < 10 {
+		return nil, fmt.Errorf("%w: malformed command", ErrReadOnly)
+	}
+	if cc := TPMCC(binary.BigEndian.Uint32(cmd[6:10])); MutatesState(cc) {
+		return nil, fmt.Errorf("%w: command code 0x%08x", ErrReadOnly, uint32(cc))
+	}
+	return r.tpm.Send(cmd)
+}
+
+// Unwrap implements transport.Wrapper.
+func (r *readOnly) Unwrap() transport.TPM {
+	return r.tpm
+}
+
+// Close closes the underlying transport, if it can be closed.
+func (r *readOnly) Close() error {
+	if c, ok := r.tpm.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
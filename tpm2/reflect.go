@@ -4,6 +4,7 @@ package tpm2
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
 	"reflect"
@@ -23,60 +24,129 @@ const (
 
 // execute sends the provided command and returns the TPM's response.
 func execute[R any](t transport.TPM, cmd Command[R, *R], rsp *R, extraSess ...Session) error {
+	p, err := prepare(t, cmd, extraSess...)
+	if err != nil {
+		return err
+	}
+
+	// Send the command via the transport.
+	if j, ok := transport.Find[*Journal](t); ok {
+		defer j.expect(p.command, journalEntry(cmd, p.cc, p.handles, p.names, p.sess))()
+	}
+	response, err := t.Send(p.command)
+	if err != nil {
+		return err
+	}
+
+	return cmdFieldError(cmd, parseResponse(t, response, p.cc, p.names, p.authIdx, p.sess, rsp))
+}
+
+// prepared is a marshalled command, with what parsing its response needs.
+type prepared struct {
+	cc      TPMCC
+	command []byte
+	handles []byte
+	names   []TPM2BName
+	authIdx []int
+	sess    []Session
+}
+
+// prepare initializes the command's sessions and marshals it.
+func prepare[R any](t transport.TPM, cmd Command[R, *R], extraSess ...Session) (*prepared, error) {
 	cc := cmd.Command()
+	if fipsEnforced {
+		if err := checkFIPSCommand(cmd); err != nil {
+			return nil, err
+		}
+	}
 	sess, err := cmdAuths(cmd)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if _, ok := transport.Find[*strictTPM](t); ok {
+		if err := checkHierarchyAuth(cmd, sess); err != nil {
+			return nil, err
+		}
 	}
+	numAuth := len(sess)
 	sess = append(sess, extraSess...)
 	if len(sess) > 3 {
-		return fmt.Errorf("too many sessions: %v", len(sess))
+		return nil, fmt.Errorf("too many sessions: %v", len(sess))
 	}
 	hasSessions := len(sess) > 0
 	// Initialize the sessions, if needed
 	for i, s := range sess {
 		if err := s.Init(t); err != nil {
-			return fmt.Errorf("initializing session %d: %w", i, err)
+			return nil, fmt.Errorf("initializing session %d: %w", i, err)
 		}
 		if err := s.NewNonceCaller(); err != nil {
-			return err
+			return nil, err
 		}
 	}
 	handles, err := cmdHandles(cmd)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	parms, err := cmdParameters(cmd, sess)
+	parms, err := cmdParameters(cmd, sess, numAuth)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	var names []TPM2BName
+	var authIdx []int
 	var sessions []byte
 	if hasSessions {
 		var err error
 		names, err = cmdNames(cmd)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		sessions, err = cmdSessions(sess, cc, names, parms)
+		authIdx = cmdAuthIndexes(cmd)
+		sessions, err = cmdSessions(sess, cc, names, authIdx, parms)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 	hdr := cmdHeader(hasSessions, 10 /* size of command header */ +len(handles)+len(sessions)+len(parms), cc)
 	command := append(hdr, handles...)
 	command = append(command, sessions...)
 	command = append(command, parms...)
+	return &prepared{cc: cc, command: command, handles: handles, names: names, authIdx: authIdx, sess: sess}, nil
+}
 
-	// Send the command via the transport.
-	response, err := t.Send(command)
-	if err != nil {
+// cmdFieldError annotates a format-1 error for cmd with the name of the
+// handle or parameter field it refers to. Other errors are returned as-is.
+func cmdFieldError[R any](cmd Command[R, *R], err error) error {
+	var rc TPMRC
+	if !errors.As(err, &rc) {
 		return err
 	}
+	isFmt1, fmt1 := rc.isFmt1Error()
+	if !isFmt1 || fmt1.subject == sessionRelated {
+		return err
+	}
+	// Handles and parameters are numbered from 1, in the order they
+	// appear in the command structure.
+	wantHandle := fmt1.subject == handleRelated
+	n := 0
+	t := reflect.TypeOf(cmd)
+	for i := 0; i < t.NumField(); i++ {
+		if hasTag(t.Field(i), "handle") != wantHandle {
+			continue
+		}
+		if n++; n == fmt1.index {
+			return fieldError{rc: rc, field: t.Field(i).Name}
+		}
+	}
+	return err
+}
 
-	// Parse the command tpm2ly into the response structure.
+// parseResponse parses the TPM's response to cc into rsp, validating the
+// response sessions area against sess. names and authIdx are as for
+// cmdSessions.
+func parseResponse[R any](t transport.TPM, response []byte, cc TPMCC, names []TPM2BName, authIdx []int, sess []Session, rsp *R) error {
+	hasSessions := len(sess) > 0
 	rspBuf := bytes.NewBuffer(response)
-	err = rspHeader(rspBuf)
+	err := rspHeader(rspBuf)
 	if err != nil {
 		var bonusErrs []string
 		// Emergency cleanup, then return.
@@ -102,12 +172,12 @@ func execute[R any](t transport.TPM, cmd Command[R, *R], rsp *R, extraSess ...Se
 		// We don't need the TPM RC here because we would have errored
 		// out from rspHeader
 		// TODO: Authenticate the error code with sessions, if desired.
-		err = rspSessions(rspBuf, TPMRCSuccess, cc, names, rspParms, sess)
+		err = rspSessions(rspBuf, TPMRCSuccess, cc, names, authIdx, rspParms, sess)
 		if err != nil {
 			return err
 		}
 	}
-	err = rspParameters(rspParms, sess, rsp)
+	err = rspParameters(rspParms, sess, len(authIdx), rsp)
 	if err != nil {
 		return err
 	}
@@ -416,6 +486,11 @@ func unmarshal(buf *bytes.Buffer, v reflect.Value) error {
 		if length > uint32(math.MaxInt32) || length > maxListLength {
 			return fmt.Errorf("could not deserialize slice of length %v", length)
 		}
+		// Every element of a list takes at least one byte, so a count
+		// larger than the data left is malformed. Check before allocating.
+		if v.Type().Elem().Kind() != reflect.Uint8 && length > uint32(buf.Len()) {
+			return fmt.Errorf("list of %v elements does not fit in the remaining %v bytes", length, buf.Len())
+		}
 		// Go's reflect library doesn't allow increasing the
 		// capacity of an existing slice.
 		// Since we can't be sure that the capacity of the
@@ -605,6 +680,11 @@ func unmarshalStruct(buf *bytes.Buffer, v reflect.Value) error {
 				}
 			}
 		} else {
+			if list {
+				if err := checkListCount(bufToReadFrom, v.Type(), v.Type().Field(i)); err != nil {
+					return err
+				}
+			}
 			if err := unmarshal(bufToReadFrom, v.Field(i)); err != nil {
 				return fmt.Errorf("unmarshalling field %v of struct of type '%v', %w", i, v.Type(), err)
 			}
@@ -619,6 +699,39 @@ func unmarshalStruct(buf *bytes.Buffer, v reflect.Value) error {
 	return nil
 }
 
+// ListCountError is returned when a list being unmarshalled, such as a
+// TPML_DIGEST, holds more elements than the specification allows.
+type ListCountError struct {
+	// List is the name of the list's type, such as "TPMLDigest".
+	List string
+	// Count is the number of elements the list claimed to hold.
+	Count uint32
+	// Max is the maximum number of elements allowed.
+	Max uint32
+}
+
+// Error implements the error interface.
+func (e *ListCountError) Error() string {
+	return fmt.Sprintf("%v holds %v elements, more than the maximum of %v", e.List, e.Count, e.Max)
+}
+
+// checkListCount peeks at the count of a list field with a "max" tag, and
+// returns a *ListCountError if it exceeds the maximum.
+func checkListCount(buf *bytes.Buffer, t reflect.Type, field reflect.StructField) error {
+	val, ok := tag(field, "max")
+	if !ok || buf.Len() < 4 {
+		return nil
+	}
+	max, err := strconv.ParseUint(val, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid max tag '%v' on field '%v' of struct '%v'", val, field.Name, t.Name())
+	}
+	if count := binary.BigEndian.Uint32(buf.Bytes()); count > uint32(max) {
+		return &ListCountError{List: t.Name(), Count: count, Max: uint32(max)}
+	}
+	return nil
+}
+
 // Unmarshals a bitwise-defined struct.
 func unmarshalBitwise(buf *bytes.Buffer, v reflect.Value) error {
 	bs, ok := v.Addr().Interface().(BitSetter)
@@ -834,6 +947,44 @@ func cmdNames[R any](cmd Command[R, *R]) ([]TPM2BName, error) {
 	return result, nil
 }
 
+// cmdAuthIndexes returns, for each handle of cmd that needs authorization,
+// the index of its Name in the names returned by cmdNames, or len(names) if
+// it has none (it is a sequence object).
+func cmdAuthIndexes[R any](cmd Command[R, *R]) []int {
+	t := reflect.TypeOf(cmd)
+	handles := taggedMembers(reflect.ValueOf(cmd), "handle", false)
+	named := 0
+	for i := range handles {
+		if !hasTag(t.Field(i), "anon") {
+			named++
+		}
+	}
+	var result []int
+	n := 0
+	for i := range handles {
+		idx := named
+		if !hasTag(t.Field(i), "anon") {
+			idx = n
+			n++
+		}
+		if hasTag(t.Field(i), "auth") {
+			result = append(result, idx)
+		}
+	}
+	return result
+}
+
+// sessionAuthIndex returns the authIndex for the i'th session of a command
+// whose authorized handles have the Names indexed by authIdx: the session
+// authorizes the i'th of them, or none at all if it follows the
+// authorization sessions, as an audit or parameter encryption session.
+func sessionAuthIndex(authIdx []int, i int) int {
+	if i < len(authIdx) {
+		return authIdx[i]
+	}
+	return -1
+}
+
 // TODO: Extract the logic of "marshal the Nth field of some struct after the handles"
 // For now, we duplicate some logic from marshalStruct here.
 func marshalParameter[R any](buf *bytes.Buffer, cmd Command[R, *R], i int) error {
@@ -856,7 +1007,7 @@ func marshalParameter[R any](buf *bytes.Buffer, cmd Command[R, *R], i int) error
 
 // cmdParameters returns the parameters area of the command.
 // The first parameter may be encrypted by one of the sessions.
-func cmdParameters[R any](cmd Command[R, *R], sess []Session) ([]byte, error) {
+func cmdParameters[R any](cmd Command[R, *R], sess []Session, numAuth int) ([]byte, error) {
 	parms := taggedMembers(reflect.ValueOf(cmd), "handle", true)
 	if len(parms) == 0 {
 		return nil, nil
@@ -879,7 +1030,7 @@ func cmdParameters[R any](cmd Command[R, *R], sess []Session) ([]byte, error) {
 			if len(firstParmBytes) < 2 {
 				return nil, fmt.Errorf("this command's first parameter is not a tpm2b")
 			}
-			err := s.Encrypt(firstParmBytes[2:])
+			err := sessionEncrypt(s, firstParmBytes[2:], i < numAuth)
 			if err != nil {
 				return nil, fmt.Errorf("encrypting with session %d: %w", i, err)
 			}
@@ -898,35 +1049,71 @@ func cmdParameters[R any](cmd Command[R, *R], sess []Session) ([]byte, error) {
 	return result.Bytes(), nil
 }
 
-// cmdSessions returns the authorization area of the command.
-func cmdSessions(sess []Session, cc TPMCC, names []TPM2BName, parms []byte) ([]byte, error) {
+// sessionEncrypt encrypts a command parameter with s, which authorizes one
+// of the command's handles if authorizing.
+func sessionEncrypt(s Session, parameter []byte, authorizing bool) error {
+	if pc, ok := s.(paramCrypter); ok {
+		return pc.encryptParam(parameter, authorizing)
+	}
+	return s.Encrypt(parameter)
+}
+
+// sessionDecrypt decrypts a response parameter with s, which authorizes one
+// of the command's handles if authorizing.
+func sessionDecrypt(s Session, parameter []byte, authorizing bool) error {
+	if pc, ok := s.(paramCrypter); ok {
+		return pc.decryptParam(parameter, authorizing)
+	}
+	return s.Decrypt(parameter)
+}
+
+// cmdSessions returns the authorization area of the command. The first
+// len(authIdx) sessions authorize the command's handles whose Names are
+// indexed by authIdx, in order; any others are used only for audit or
+// parameter encryption, as Part 1, section 19.6 allows for up to three
+// sessions in all.
+func cmdSessions(sess []Session, cc TPMCC, names []TPM2BName, authIdx []int, parms []byte) ([]byte, error) {
 	// There is no authorization area if there are no sessions.
 	if len(sess) == 0 {
 		return nil, nil
 	}
+	var numEnc, numDec, numAudit int
+	for i, s := range sess {
+		if i >= len(authIdx) && s.Handle() == TPMRSPW {
+			return nil, fmt.Errorf("session %d: a password session can only authorize a handle", i)
+		}
+		if s.IsEncryption() {
+			numEnc++
+		}
+		if s.IsDecryption() {
+			numDec++
+		}
+		if h, ok := s.(*hmacSession); ok && h.attrs.Audit {
+			numAudit++
+		}
+	}
+	// Part 1, 19.6.2: at most one session of each kind.
+	switch {
+	case numEnc > 1:
+		return nil, fmt.Errorf("too many encrypt sessions")
+	case numDec > 1:
+		return nil, fmt.Errorf("too many decrypt sessions")
+	case numAudit > 1:
+		return nil, fmt.Errorf("too many audit sessions")
+	}
+
 	// Find the non-first-session encryption and decryption session
 	// nonceTPMs, if any.
 	var encNonceTPM, decNonceTPM []byte
-	if len(sess) > 0 {
-		for i := 1; i < len(sess); i++ {
-			s := sess[i]
-			if s.IsEncryption() {
-				if encNonceTPM != nil {
-					// Only one encrypt session is permitted.
-					return nil, fmt.Errorf("too many encrypt sessions")
-				}
-				encNonceTPM = s.NonceTPM().Buffer
-				// A session used for both encryption and
-				// decryption only needs its nonce counted once.
-				continue
-			}
-			if s.IsDecryption() {
-				if decNonceTPM != nil {
-					// Only one decrypt session is permitted.
-					return nil, fmt.Errorf("too many decrypt sessions")
-				}
-				decNonceTPM = s.NonceTPM().Buffer
-			}
+	for i := 1; i < len(sess); i++ {
+		s := sess[i]
+		if s.IsDecryption() {
+			decNonceTPM = s.NonceTPM().Buffer
+		}
+		// A session used for both encryption and decryption only needs
+		// its nonce counted once.
+		if s.IsEncryption() && !s.IsDecryption() {
+			encNonceTPM = s.NonceTPM().Buffer
 		}
 	}
 
@@ -943,7 +1130,7 @@ func cmdSessions(sess []Session, cc TPMCC, names []TPM2BName, parms []byte) ([]b
 			addNonces = append(addNonces, decNonceTPM...)
 			addNonces = append(addNonces, encNonceTPM...)
 		}
-		auth, err := s.Authorize(cc, parms, addNonces, names, i)
+		auth, err := s.Authorize(cc, parms, addNonces, names, sessionAuthIndex(authIdx, i))
 		if err != nil {
 			return nil, fmt.Errorf("session %d: %w", i, err)
 		}
@@ -1037,13 +1224,13 @@ func rspParametersArea(hasSessions bool, rsp *bytes.Buffer) ([]byte, error) {
 // the sessions with it. If there is a response validation error, returns
 // an error here.
 // rsp is updated to point to the rest of the response after the sessions.
-func rspSessions(rsp *bytes.Buffer, rc TPMRC, cc TPMCC, names []TPM2BName, parms []byte, sess []Session) error {
+func rspSessions(rsp *bytes.Buffer, rc TPMRC, cc TPMCC, names []TPM2BName, authIdx []int, parms []byte, sess []Session) error {
 	for i, s := range sess {
 		var auth TPMSAuthResponse
 		if err := unmarshal(rsp, reflect.ValueOf(&auth).Elem()); err != nil {
 			return fmt.Errorf("reading auth session %d: %w", i, err)
 		}
-		if err := s.Validate(rc, cc, parms, names, i, &auth); err != nil {
+		if err := s.Validate(rc, cc, parms, names, sessionAuthIndex(authIdx, i), &auth); err != nil {
 			return fmt.Errorf("validating auth session %d: %w", i, err)
 		}
 	}
@@ -1056,7 +1243,7 @@ func rspSessions(rsp *bytes.Buffer, rc TPMRC, cc TPMCC, names []TPM2BName, parms
 // rspParameters decrypts (if needed) the parameters area of the response
 // into the response structure. If there is a mismatch between the expected
 // and actual response structure, returns an error here.
-func rspParameters(parms []byte, sess []Session, rspStruct any) error {
+func rspParameters(parms []byte, sess []Session, numAuth int, rspStruct any) error {
 	numHandles := len(taggedMembers(reflect.ValueOf(rspStruct).Elem(), "handle", false))
 
 	// Use the heuristic of "does interpreting the first 2 bytes of response
@@ -1074,7 +1261,7 @@ func rspParameters(parms []byte, sess []Session, rspStruct any) error {
 			if !s.IsEncryption() {
 				continue
 			}
-			if err := s.Decrypt(parms[2 : 2+length]); err != nil {
+			if err := sessionDecrypt(s, parms[2:2+length], i < numAuth); err != nil {
 				return fmt.Errorf("decrypting first parameter with session %d: %w", i, err)
 			}
 		}
@@ -0,0 +1,275 @@
+package tpm2
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrNotResident is returned by VerifyResidency when a proof does not show
+// that the key is held by a TPM.
+var ErrNotResident = errors.New("key residency not proven")
+
+// ResidencyProof shows that a key is held by a TPM: an attestation key (AK),
+// certified as belonging to a TPM, signs a TPM2_Certify of the key. It is
+// made by ProveResidency and checked by VerifyResidency.
+type ResidencyProof struct {
+	// KeyPublic is the marshalled TPM2B_PUBLIC of the key.
+	KeyPublic []byte `json:"keyPublic"`
+	// AKPublic is the marshalled TPM2B_PUBLIC of the AK.
+	AKPublic []byte `json:"akPublic"`
+	// CertifyInfo is the marshalled TPM2B_ATTEST signed by the AK.
+	CertifyInfo []byte `json:"certifyInfo"`
+	// Signature is the marshalled TPMT_SIGNATURE over CertifyInfo.
+	Signature []byte `json:"signature"`
+	// AKCertificates is the DER-encoded certificate chain of the AK, leaf
+	// first.
+	AKCertificates [][]byte `json:"akCertificates"`
+}
+
+// ProveResidency certifies key with ak, a restricted signing key, and
+// returns the result as a proof for VerifyResidency. nonce is the verifier's
+// challenge, which keeps the proof from being replayed. akCerts is the AK's
+// certificate chain, leaf first, which the verifier needs to trust the AK.
+func ProveResidency(t transport.TPM, key, ak handle, nonce []byte, akCerts [][]byte, s ...Session) (*ResidencyProof, error) {
+	keyPub, err := ReadPublic{ObjectHandle: TPMHandle(key.HandleValue())}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("reading key: %w", err)
+	}
+	akPub, err := ReadPublic{ObjectHandle: TPMHandle(ak.HandleValue())}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("reading AK: %w", err)
+	}
+	rsp, err := Certify{
+		ObjectHandle:   key,
+		SignHandle:     ak,
+		QualifyingData: TPM2BData{Buffer: nonce},
+		InScheme:       TPMTSigScheme{Scheme: TPMAlgNull},
+	}.Execute(t, s...)
+	if err != nil {
+		return nil, fmt.Errorf("certifying key: %w", err)
+	}
+	return &ResidencyProof{
+		KeyPublic:      Marshal(keyPub.OutPublic),
+		AKPublic:       Marshal(akPub.OutPublic),
+		CertifyInfo:    Marshal(rsp.CertifyInfo),
+		Signature:      Marshal(rsp.Signature),
+		AKCertificates: akCerts,
+	}, nil
+}
+
+// VerifyResidency checks a proof made by ProveResidency against the nonce
+// the verifier sent, and returns the public key that it proves is resident.
+// The AK certificate chain must verify against roots, and its leaf must
+// certify the AK; the AK must be a restricted signing key that cannot leave
+// its TPM, so that only the TPM could have produced the signature. The key
+// must have been generated by the TPM and be fixedTPM.
+//
+// The caller should check that the returned key is the one it expects, for
+// example the public key of a TLS certificate.
+func VerifyResidency(proof *ResidencyProof, nonce []byte, roots *x509.CertPool) (crypto.PublicKey, error) {
+	keyPub, err := residencyPublic(proof.KeyPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key public area: %w", err)
+	}
+	akPub, err := residencyPublic(proof.AKPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AK public area: %w", err)
+	}
+
+	ak, err := cryptoPublicKey(akPub)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyAKCertificates(proof.AKCertificates, ak, roots); err != nil {
+		return nil, err
+	}
+	if a := akPub.ObjectAttributes; !a.Restricted || !a.SignEncrypt || !a.FixedTPM {
+		return nil, fmt.Errorf("%w: the AK is not a restricted fixedTPM signing key", ErrNotResident)
+	}
+
+	sig, err := Unmarshal[TPMTSignature](proof.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	info, err := Unmarshal[TPM2BAttest](proof.CertifyInfo)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certify info: %w", err)
+	}
+	attest, err := VerifyAttestation(akPub, info, sig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotResident, err)
+	}
+	if attest.Type != TPMSTAttestCertify {
+		return nil, fmt.Errorf("%w: attestation is not a certification: %v", ErrNotResident, attest.Type)
+	}
+	if !bytes.Equal(attest.ExtraData.Buffer, nonce) {
+		return nil, fmt.Errorf("%w: attestation is for a different nonce", ErrNotResident)
+	}
+	certified, err := attest.Attested.Certify()
+	if err != nil {
+		return nil, err
+	}
+	name, err := ObjectName(keyPub)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(certified.Name.Buffer, name.Buffer) {
+		return nil, fmt.Errorf("%w: attestation certifies %x, but the key's Name is %x",
+			ErrNotResident, certified.Name.Buffer, name.Buffer)
+	}
+	if a := keyPub.ObjectAttributes; !a.FixedTPM || !a.SensitiveDataOrigin {
+		return nil, fmt.Errorf("%w: the key is not a fixedTPM key generated by the TPM", ErrNotResident)
+	}
+	return cryptoPublicKey(keyPub)
+}
+
+// residencyPublic unmarshals a TPM2B_PUBLIC.
+func residencyPublic(data []byte) (*TPMTPublic, error) {
+	pub, err := Unmarshal[TPM2BPublic](data)
+	if err != nil {
+		return nil, err
+	}
+	return pub.Contents()
+}
+
+// verifyAKCertificates checks that certs, leaf first, chain to roots and that
+// the leaf certifies ak.
+func verifyAKCertificates(certs [][]byte, ak crypto.PublicKey, roots *x509.CertPool) error {
+	if len(certs) == 0 {
+		return fmt.Errorf("%w: no AK certificate", ErrNotResident)
+	}
+	var chain []*x509.Certificate
+	for i, der := range certs {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("parsing AK certificate %d: %w", i, err)
+		}
+		chain = append(chain, cert)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("%w: verifying AK certificate: %v", ErrNotResident, err)
+	}
+	leaf, ok := chain[0].PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !leaf.Equal(ak) {
+		return fmt.Errorf("%w: the AK certificate is for a different key", ErrNotResident)
+	}
+	return nil
+}
+
+// cryptoPublicKey converts an RSA or ECC public area into an *rsa.PublicKey
+// or *ecdsa.PublicKey.
+func cryptoPublicKey(pub *TPMTPublic) (crypto.PublicKey, error) {
+	switch pub.Type {
+	case TPMAlgRSA:
+		parms, err := pub.Parameters.RSADetail()
+		if err != nil {
+			return nil, err
+		}
+		unique, err := pub.Unique.RSA()
+		if err != nil {
+			return nil, err
+		}
+		return RSAPub(parms, unique)
+	case TPMAlgECC:
+		parms, err := pub.Parameters.ECCDetail()
+		if err != nil {
+			return nil, err
+		}
+		unique, err := pub.Unique.ECC()
+		if err != nil {
+			return nil, err
+		}
+		var curve elliptic.Curve
+		switch parms.CurveID {
+		case TPMECCNistP256:
+			curve = elliptic.P256()
+		case TPMECCNistP384:
+			curve = elliptic.P384()
+		case TPMECCNistP521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %v", parms.CurveID)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(unique.X.Buffer),
+			Y:     new(big.Int).SetBytes(unique.Y.Buffer),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %v", pub.Type)
+}
+
+// verifyTPMSignature checks an RSASSA, RSAPSS or ECDSA signature by pub over
+// data.
+func verifyTPMSignature(pub crypto.PublicKey, sig *TPMTSignature, data []byte) error {
+	digest := func(alg TPMIAlgHash) (crypto.Hash, []byte, error) {
+		ha, err := alg.Hash()
+		if err != nil {
+			return 0, nil, err
+		}
+		h := ha.New()
+		h.Write(data)
+		return ha, h.Sum(nil), nil
+	}
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		var rsaSig *TPMSSignatureRSA
+		var err error
+		switch sig.SigAlg {
+		case TPMAlgRSASSA:
+			rsaSig, err = sig.Signature.RSASSA()
+		case TPMAlgRSAPSS:
+			rsaSig, err = sig.Signature.RSAPSS()
+		default:
+			return fmt.Errorf("%v signature does not match an RSA key", sig.SigAlg)
+		}
+		if err != nil {
+			return err
+		}
+		ha, d, err := digest(rsaSig.Hash)
+		if err != nil {
+			return err
+		}
+		if sig.SigAlg == TPMAlgRSAPSS {
+			return rsa.VerifyPSS(k, ha, d, rsaSig.Sig.Buffer, nil)
+		}
+		return rsa.VerifyPKCS1v15(k, ha, d, rsaSig.Sig.Buffer)
+	case *ecdsa.PublicKey:
+		if sig.SigAlg != TPMAlgECDSA {
+			return fmt.Errorf("%v signature does not match an ECC key", sig.SigAlg)
+		}
+		eccSig, err := sig.Signature.ECDSA()
+		if err != nil {
+			return err
+		}
+		_, d, err := digest(eccSig.Hash)
+		if err != nil {
+			return err
+		}
+		r := new(big.Int).SetBytes(eccSig.SignatureR.Buffer)
+		s := new(big.Int).SetBytes(eccSig.SignatureS.Buffer)
+		if !ecdsa.Verify(k, d, r, s) {
+			return errors.New("invalid ECDSA signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key type %T", pub)
+}
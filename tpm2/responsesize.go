@@ -0,0 +1,57 @@
+package tpm2
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Bounds on the TPM_PT_MAX_RESPONSE_SIZE values that ConfigureMaxResponseSize
+// accepts. The specification requires TPMs to support at least 1 KiB, and
+// anything beyond 64 KiB is more likely a broken report than a real buffer.
+const (
+	minMaxResponseSize = 1024
+	maxMaxResponseSize = 64 * 1024
+)
+
+// MaxResponseSize returns the largest response the TPM can produce, as
+// reported by its TPM_PT_MAX_RESPONSE_SIZE property.
+func MaxResponseSize(t transport.TPM) (int, error) {
+	rsp, err := GetCapability{
+		Capability:    TPMCapTPMProperties,
+		Property:      uint32(TPMPTMaxResponseSize),
+		PropertyCount: 1,
+	}.Execute(t)
+	if err != nil {
+		return 0, err
+	}
+	props, err := rsp.CapabilityData.Data.TPMProperties()
+	if err != nil {
+		return 0, err
+	}
+	if len(props.TPMProperty) == 0 || props.TPMProperty[0].Property != TPMPTMaxResponseSize {
+		return 0, fmt.Errorf("TPM did not report TPM_PT_MAX_RESPONSE_SIZE")
+	}
+	return int(props.TPMProperty[0].Value), nil
+}
+
+// ConfigureMaxResponseSize sizes t's response buffer to the TPM's
+// TPM_PT_MAX_RESPONSE_SIZE, if t implements transport.ResponseSizer.
+// If the TPM cannot report a plausible size, an error is returned and the
+// transport keeps its current buffer, which is tpmutil.DefaultMaxResponseSize
+// unless it was configured otherwise.
+func ConfigureMaxResponseSize(t transport.TPM) error {
+	rs, ok := t.(transport.ResponseSizer)
+	if !ok {
+		return nil
+	}
+	size, err := MaxResponseSize(t)
+	if err != nil {
+		return err
+	}
+	if size < minMaxResponseSize || size > maxMaxResponseSize {
+		return fmt.Errorf("implausible TPM_PT_MAX_RESPONSE_SIZE %d", size)
+	}
+	rs.SetMaxResponseSize(size)
+	return nil
+}
@@ -0,0 +1,111 @@
+// Package roca detects RSA keys generated by the Infineon library affected by
+// ROCA (CVE-2017-15361), and TPM firmware that generates them.
+//
+// Such keys can be factored from their public modulus, so they must never be
+// trusted, whatever the state of the TPM that holds them. Keys generated by an
+// affected TPM before its firmware was updated remain weak afterwards.
+//
+// See https://crocs.fi.muni.cz/public/papers/rsa_ccs17.
+package roca
+
+import (
+	"crypto/rsa"
+	"errors"
+	"math/big"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// ErrWeakKey indicates that a key has the ROCA fingerprint.
+var ErrWeakKey = errors.New("RSA key is vulnerable to ROCA (CVE-2017-15361)")
+
+// The affected library builds its primes as k*M + (65537^a mod M), where M
+// is the product of the first few primes. The modulus of every key it
+// generates is therefore a power of 65537 modulo each of those primes, which
+// holds for a random modulus with negligible probability.
+var primes = []int64{
+	3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53, 59, 61, 67, 71,
+	73, 79, 83, 89, 97, 101, 103, 107, 109, 113, 127, 131, 137, 139, 149, 151,
+	157, 163, 167,
+}
+
+// powers holds, for each prime p, which residues mod p are powers of 65537.
+var powers = func() [][]bool {
+	ps := make([][]bool, len(primes))
+	for i, p := range primes {
+		ps[i] = make([]bool, p)
+		g := 65537 % p
+		for x := int64(1); !ps[i][x]; x = x * g % p {
+			ps[i][x] = true
+		}
+	}
+	return ps
+}()
+
+// IsWeak reports whether n, an RSA modulus, has the ROCA fingerprint.
+func IsWeak(n *big.Int) bool {
+	var m, p big.Int
+	for i, prime := range primes {
+		m.Mod(n, p.SetInt64(prime))
+		if !powers[i][m.Int64()] {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckKey returns ErrWeakKey if key has the ROCA fingerprint.
+func CheckKey(key *rsa.PublicKey) error {
+	if IsWeak(key.N) {
+		return ErrWeakKey
+	}
+	return nil
+}
+
+// CheckPublic returns ErrWeakKey if pub is an RSA key with the ROCA
+// fingerprint, such as an EK or SRK read from an affected TPM. Keys of other
+// types are never weak.
+func CheckPublic(pub *tpm2.TPMTPublic) error {
+	if pub.Type != tpm2.TPMAlgRSA {
+		return nil
+	}
+	parms, err := pub.Parameters.RSADetail()
+	if err != nil {
+		return err
+	}
+	unique, err := pub.Unique.RSA()
+	if err != nil {
+		return err
+	}
+	key, err := tpm2.RSAPub(parms, unique)
+	if err != nil {
+		return err
+	}
+	return CheckKey(key)
+}
+
+// fixedFirmware lists, for each affected Infineon firmware major version,
+// the first minor version with the fix.
+var fixedFirmware = map[uint32]uint32{
+	4:   34,
+	5:   62,
+	6:   43,
+	7:   62,
+	133: 33,
+	149: 33,
+}
+
+// AffectedFirmware reports whether info describes an Infineon TPM whose
+// firmware generates ROCA-vulnerable RSA keys.
+func AffectedFirmware(info tpm2.DeviceInfo) bool {
+	if info.Manufacturer != "IFX" {
+		return false
+	}
+	major, minor := info.FirmwareVersion1>>16, info.FirmwareVersion1&0xffff
+	// TPM 1.2 firmware 4.4x was fixed separately, in 4.43.
+	if major == 4 && minor >= 40 {
+		return minor < 43
+	}
+	fixed, ok := fixedFirmware[major]
+	return ok && minor < fixed
+}
@@ -0,0 +1,114 @@
+package roca
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// fingerprinted returns a 2048-bit number with the structure of a modulus
+// generated by the affected library.
+func fingerprinted(t *testing.T) *big.Int {
+	t.Helper()
+	m := big.NewInt(1)
+	for _, p := range primes {
+		m.Mul(m, big.NewInt(p))
+	}
+	a, err := rand.Int(rand.Reader, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 2048-uint(m.BitLen())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := new(big.Int).Exp(big.NewInt(65537), a, m)
+	return n.Add(n, k.Mul(k, m))
+}
+
+func TestIsWeak(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		if n := fingerprinted(t); !IsWeak(n) {
+			t.Errorf("IsWeak(%x) = false, want true", n)
+		}
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckKey(&key.PublicKey); err != nil {
+		t.Errorf("CheckKey(random key) = %v, want nil", err)
+	}
+	if err := CheckKey(&rsa.PublicKey{N: fingerprinted(t), E: 65537}); !errors.Is(err, ErrWeakKey) {
+		t.Errorf("CheckKey(weak key) = %v, want %v", err, ErrWeakKey)
+	}
+}
+
+func TestCheckPublic(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	for _, template := range []tpm2.TPMTPublic{tpm2.RSASRKTemplate, tpm2.ECCSRKTemplate} {
+		rsp, err := tpm2.CreatePrimary{
+			PrimaryHandle: tpm2.TPMRHOwner,
+			InPublic:      tpm2.New2B(template),
+		}.Execute(thetpm)
+		if err != nil {
+			t.Fatalf("CreatePrimary: %v", err)
+		}
+		tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm)
+		pub, err := rsp.OutPublic.Contents()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckPublic(pub); err != nil {
+			t.Errorf("CheckPublic(%v key) = %v, want nil", template.Type, err)
+		}
+	}
+
+	weak := tpm2.RSASRKTemplate
+	weak.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgRSA, &tpm2.TPM2BPublicKeyRSA{Buffer: fingerprinted(t).Bytes()})
+	if err := CheckPublic(&weak); !errors.Is(err, ErrWeakKey) {
+		t.Errorf("CheckPublic(weak key) = %v, want %v", err, ErrWeakKey)
+	}
+}
+
+func TestAffectedFirmware(t *testing.T) {
+	for _, tc := range []struct {
+		manufacturer string
+		major, minor uint32
+		want         bool
+	}{
+		{"IFX", 4, 32, true},
+		{"IFX", 4, 34, false},
+		{"IFX", 4, 42, true},
+		{"IFX", 4, 43, false},
+		{"IFX", 5, 61, true},
+		{"IFX", 6, 41, true},
+		{"IFX", 7, 40, true},
+		{"IFX", 7, 61, true},
+		{"IFX", 7, 62, false},
+		{"IFX", 7, 85, false},
+		{"IFX", 133, 32, true},
+		{"IFX", 149, 33, false},
+		{"IFX", 15, 23, false},
+		{"NTC", 7, 40, false},
+	} {
+		info := tpm2.DeviceInfo{
+			Manufacturer:     tc.manufacturer,
+			FirmwareVersion1: tc.major<<16 | tc.minor,
+		}
+		if got := AffectedFirmware(info); got != tc.want {
+			t.Errorf("AffectedFirmware(%v %v.%v) = %v, want %v", tc.manufacturer, tc.major, tc.minor, got, tc.want)
+		}
+	}
+}
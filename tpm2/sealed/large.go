@@ -0,0 +1,290 @@
+package sealed
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrNotEncrypted is returned by DecryptLarge and DecryptStream for data that
+// was not written by EncryptLarge or EncryptStream.
+var ErrNotEncrypted = errors.New("not data encrypted by EncryptLarge")
+
+// largeMagic starts the output of EncryptLarge and EncryptStream.
+var largeMagic = []byte("TPMAEAD1")
+
+const (
+	// chunkSize is the size of the plaintext of every chunk but the last.
+	chunkSize = 64 << 10
+	// maxHeader bounds the size of the envelope DecryptStream reads, so
+	// that a corrupt length can't make it allocate without limit.
+	maxHeader = 1 << 20
+	// lastChunk is set in the last byte of the nonce of the last chunk.
+	lastChunk = 1
+)
+
+// EncryptLarge encrypts data of any size with a random AES-256-GCM key and
+// seals only the key to the TPM, under parent and, if sel is not nil, the
+// current values of the PCRs in sel, as with Seal. The bulk of the work is
+// done in software, so this is the way to protect files and other data too
+// large for the TPM to seal. It holds all of data in memory; EncryptStream
+// does the same for data that is written a piece at a time.
+func EncryptLarge(t transport.TPM, parent Parent, hierarchyAuth, data []byte, sel *tpm2.TPMLPCRSelection) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := EncryptStream(&buf, t, parent, hierarchyAuth, sel)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecryptLarge unseals the key of data written by EncryptLarge or
+// EncryptStream and decrypts it. hierarchyAuth is the authorization of the
+// key's parent's hierarchy, as for Unseal.
+func DecryptLarge(t transport.TPM, hierarchyAuth, data []byte) ([]byte, error) {
+	r, err := DecryptStream(bytes.NewReader(data), t, hierarchyAuth)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// EncryptStream is like EncryptLarge, but returns a writer that encrypts
+// what is written to it into w, so that data of any size can be encrypted
+// without holding it in memory. The caller must call Close to write the end
+// of the data; without it, DecryptStream reports the data as truncated.
+// Close does not close w.
+//
+// The output is the envelope of the sealed key, followed by the data in
+// chunks of 64 KiB, each encrypted and authenticated together with the
+// envelope. Each chunk's nonce counts the chunks and marks the last one, so
+// that chunks can't be reordered, dropped or appended without detection (the
+// STREAM construction of Hoang, Reyhanitabar, Rogaway and Vizár).
+func EncryptStream(w io.Writer, t transport.TPM, parent Parent, hierarchyAuth []byte, sel *tpm2.TPMLPCRSelection) (io.WriteCloser, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	env, err := Seal(t, parent, hierarchyAuth, key, sel)
+	if err != nil {
+		return nil, err
+	}
+	header, err := env.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), largeMagic...)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(header)))
+	out = append(out, header...)
+	if _, err := w.Write(out); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		w:      w,
+		stream: stream{aead: aead, header: header},
+		buf:    make([]byte, 0, chunkSize+1),
+	}, nil
+}
+
+// DecryptStream unseals the key of data written by EncryptLarge or
+// EncryptStream, read from r, and returns a reader of the decrypted data.
+// hierarchyAuth is the authorization of the key's parent's hierarchy, as for
+// Unseal.
+//
+// Each chunk is authenticated before the reader returns any of it, but the
+// data may still turn out to be truncated or otherwise corrupt further on,
+// so callers must not act on what they read until the reader returns
+// io.EOF.
+func DecryptStream(r io.Reader, t transport.TPM, hierarchyAuth []byte) (io.Reader, error) {
+	prefix := make([]byte, len(largeMagic)+4)
+	if _, err := io.ReadFull(r, prefix); err != nil || !bytes.HasPrefix(prefix, largeMagic) {
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		return nil, ErrNotEncrypted
+	}
+	n := binary.BigEndian.Uint32(prefix[len(largeMagic):])
+	if n > maxHeader {
+		return nil, fmt.Errorf("%w: envelope of %d bytes", ErrNotEncrypted, n)
+	}
+	header := make([]byte, n)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: truncated envelope", ErrNotEncrypted)
+		}
+		return nil, err
+	}
+	env, err := Parse(header)
+	if err != nil {
+		return nil, err
+	}
+	key, err := env.Unseal(t, hierarchyAuth)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		r:      bufio.NewReader(r),
+		stream: stream{aead: aead, header: header},
+		buf:    make([]byte, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+// stream numbers the chunks of an encrypted stream.
+type stream struct {
+	aead   cipher.AEAD
+	header []byte
+	// counter is the number of chunks sealed or opened so far.
+	counter uint64
+}
+
+// nonce returns the nonce of the next chunk: the chunk counter, followed by
+// a byte that is lastChunk for the last chunk.
+func (s *stream) nonce(last bool) []byte {
+	nonce := make([]byte, s.aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], s.counter)
+	if last {
+		nonce[len(nonce)-1] = lastChunk
+	}
+	s.counter++
+	return nonce
+}
+
+// encryptWriter is the writer returned by EncryptStream.
+type encryptWriter struct {
+	w io.Writer
+	stream
+	// buf holds the plaintext not written yet. A full chunk is only written
+	// once more data follows it, as the last chunk is sealed differently.
+	buf []byte
+	err error
+}
+
+// Write implements io.Writer.
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		m := min(len(p), cap(e.buf)-len(e.buf))
+		e.buf = append(e.buf, p[:m]...)
+		p = p[m:]
+		if len(e.buf) == cap(e.buf) {
+			if err := e.flush(e.buf[:chunkSize], false); err != nil {
+				return n - len(p), err
+			}
+			e.buf = append(e.buf[:0], e.buf[chunkSize:]...)
+		}
+	}
+	return n, nil
+}
+
+// Close writes the last chunk. It does not close the underlying writer.
+func (e *encryptWriter) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if err := e.flush(e.buf, true); err != nil {
+		return err
+	}
+	e.err = errors.New("write to closed EncryptStream writer")
+	return nil
+}
+
+// flush encrypts and writes a chunk.
+func (e *encryptWriter) flush(chunk []byte, last bool) error {
+	out := e.aead.Seal(nil, e.nonce(last), chunk, e.header)
+	if _, err := e.w.Write(out); err != nil {
+		e.err = err
+		return err
+	}
+	return nil
+}
+
+// decryptReader is the reader returned by DecryptStream.
+type decryptReader struct {
+	r *bufio.Reader
+	stream
+	buf []byte
+	// plaintext is the part of the current chunk not read yet.
+	plaintext []byte
+	// done is set once the last chunk has been opened.
+	done bool
+	err  error
+}
+
+// Read implements io.Reader.
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plaintext) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.plaintext, d.err = d.next()
+	}
+	n := copy(p, d.plaintext)
+	d.plaintext = d.plaintext[n:]
+	return n, nil
+}
+
+// next reads, authenticates and decrypts the next chunk.
+func (d *decryptReader) next() ([]byte, error) {
+	n, err := io.ReadFull(d.r, d.buf)
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		// Only the last chunk can be short.
+		d.done = true
+	case err == io.EOF:
+		return nil, fmt.Errorf("decrypting data: %w", io.ErrUnexpectedEOF)
+	case err != nil:
+		return nil, err
+	default:
+		// A full chunk is the last one if nothing follows it.
+		if _, err := d.r.Peek(1); err == io.EOF {
+			d.done = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	plaintext, err := d.aead.Open(d.buf[:0], d.nonce(d.done), d.buf[:n], d.header)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting data: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("sealed key is %d bytes, want 32", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,456 @@
+// Package sealed defines a versioned envelope for data sealed to a TPM. The
+// envelope keeps the sealed object together with everything needed to unseal
+// it again: how to recreate or find its parent, the PCR selection and the
+// policy it was sealed to. MigrateTPM12 moves data sealed by a TPM 1.2 into
+// an envelope, and EncryptLarge and EncryptStream encrypt data of any size
+// under a key sealed in one.
+package sealed
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Version is the newest envelope format version this package reads and
+// writes. Data that fits in a single sealed object is still written in
+// version 1, which earlier versions of this package can read; version 2 adds
+// Shards.
+const Version = 2
+
+// maxShard is the most data a single sealed object can hold: MAX_SYM_DATA,
+// which is 128 bytes on every TPM implementing the PC Client profile.
+const maxShard = 128
+
+var (
+	// ErrNotEnvelope is returned by Parse for data that is not a sealed
+	// envelope, such as a raw sealed object. See FromRaw.
+	ErrNotEnvelope = errors.New("not a sealed envelope")
+	// ErrUnsupportedVersion is returned by Parse for envelopes written by a
+	// newer version of this package.
+	ErrUnsupportedVersion = errors.New("unsupported sealed envelope version")
+)
+
+// Parent describes the storage key that a sealed object was created under.
+type Parent struct {
+	// Hierarchy is the hierarchy the parent is a primary key of.
+	Hierarchy tpm2.TPMHandle `json:"hierarchy"`
+	// Template is the marshalled TPMT_PUBLIC the parent was created from.
+	// Primary keys are derived from the hierarchy seed, so the same template
+	// recreates the same parent for as long as the seed is not changed.
+	Template []byte `json:"template"`
+	// Handle, if set, is a persistent handle at which the parent was
+	// stored. It is used in preference to recreating the parent, as long as
+	// it still holds an object with the expected Name.
+	Handle tpm2.TPMHandle `json:"handle,omitempty"`
+	// Name is the Name of the parent when the data was sealed.
+	Name []byte `json:"name"`
+}
+
+// PrimaryParent returns a Parent that is recreated from template under
+// hierarchy.
+func PrimaryParent(hierarchy tpm2.TPMHandle, template tpm2.TPMTPublic) Parent {
+	return Parent{Hierarchy: hierarchy, Template: tpm2.Marshal(template)}
+}
+
+// Policy describes the authorization the sealed object requires.
+type Policy struct {
+	// Description is a human-readable summary of the policy.
+	Description string `json:"description"`
+	// PCRSelection is the marshalled TPML_PCR_SELECTION the object is sealed
+	// to, or empty if it is not sealed to PCRs.
+	PCRSelection []byte `json:"pcrSelection,omitempty"`
+	// Digest is the authPolicy of the sealed object.
+	Digest []byte `json:"digest,omitempty"`
+	// PIN reports whether the object's auth value is a PIN that must be
+	// given to unseal it.
+	PIN bool `json:"pin,omitempty"`
+}
+
+// Envelope is a sealed object together with its parent and policy.
+type Envelope struct {
+	// Version is the format version of the envelope.
+	Version int `json:"version"`
+	// Parent is the storage key the object was sealed under.
+	Parent Parent `json:"parent"`
+	// Policy is the authorization the object requires.
+	Policy Policy `json:"policy"`
+	// Public is the marshalled TPM2B_PUBLIC of the sealed object.
+	Public []byte `json:"public"`
+	// Private is the marshalled TPM2B_PRIVATE of the sealed object.
+	Private []byte `json:"private"`
+	// Shards are further sealed objects, with the same parent and policy,
+	// holding the rest of data too long for one object. The data is the
+	// concatenation of the first object's and theirs, in order.
+	Shards []Shard `json:"shards,omitempty"`
+}
+
+// Shard is one of the further sealed objects of an Envelope.
+type Shard struct {
+	// Public is the marshalled TPM2B_PUBLIC of the sealed object.
+	Public []byte `json:"public"`
+	// Private is the marshalled TPM2B_PRIVATE of the sealed object.
+	Private []byte `json:"private"`
+}
+
+// Seal seals data under parent, creating the parent first unless it is
+// already at its persistent handle. If sel is not nil, the data can only be
+// unsealed while the PCRs in sel have their current values. hierarchyAuth is
+// the authorization of the parent's hierarchy. The sealed object uses the
+// parent's name algorithm, and its policy is computed with it too, so data
+// sealed under a SHA-384 parent needs nothing but SHA-384 from the TPM.
+//
+// A sealed object holds at most 128 bytes, so longer data is split across as
+// many objects as it takes, which Unseal puts back together. Each object is
+// protected by the TPM, but how they fit together is not: like a whole
+// envelope being swapped for another sealed under the same parent, shards
+// could be dropped or exchanged, so the envelope still needs storing where
+// it can't be tampered with if that matters.
+func Seal(t transport.TPM, parent Parent, hierarchyAuth, data []byte, sel *tpm2.TPMLPCRSelection) (*Envelope, error) {
+	return SealWithPIN(t, parent, hierarchyAuth, data, sel, nil)
+}
+
+// SealWithPIN is like Seal, but if pin is not empty the data can only be
+// unsealed with UnsealWithPIN and the same PIN, in addition to any PCR
+// policy. Unlike objects sealed without a PIN, the object is subject to the
+// TPM's dictionary attack protection, so PINs can't be guessed quickly.
+func SealWithPIN(t transport.TPM, parent Parent, hierarchyAuth, data []byte, sel *tpm2.TPMLPCRSelection, pin []byte) (*Envelope, error) {
+	key, flush, err := parent.load(t, hierarchyAuth)
+	if err != nil {
+		return nil, err
+	}
+	defer flush()
+	parent.Name = key.Name.Buffer
+	// Use the parent's name algorithm, which the TPM is known to implement.
+	nameAlg, err := tpm2.NameHashAlg(key.Name)
+	if err != nil {
+		return nil, fmt.Errorf("parent: %w", err)
+	}
+
+	pub := tpm2.TPMTPublic{
+		Type:    tpm2.TPMAlgKeyedHash,
+		NameAlg: nameAlg,
+		ObjectAttributes: tpm2.TPMAObject{
+			FixedTPM:    true,
+			FixedParent: true,
+			NoDA:        len(pin) == 0,
+		},
+	}
+	policy := Policy{Description: "password"}
+	if len(pin) != 0 {
+		policy = Policy{Description: "PIN", PIN: true}
+	}
+	if sel != nil {
+		digest, err := pcrPolicy(t, pub.NameAlg, sel, len(pin) != 0)
+		if err != nil {
+			return nil, err
+		}
+		pub.AuthPolicy = tpm2.TPM2BDigest{Buffer: digest}
+		policy.Description = describe(sel)
+		if policy.PIN {
+			policy.Description += " PolicyAuthValue"
+		}
+		policy.PCRSelection = tpm2.Marshal(sel)
+		policy.Digest = digest
+	} else {
+		pub.ObjectAttributes.UserWithAuth = true
+	}
+
+	var shards []Shard
+	for first := true; first || len(data) > 0; first = false {
+		n := min(len(data), maxShard)
+		rsp, err := tpm2.Create{
+			ParentHandle: key,
+			InSensitive: tpm2.TPM2BSensitiveCreate{
+				Sensitive: &tpm2.TPMSSensitiveCreate{
+					UserAuth: tpm2.TPM2BAuth{Buffer: pin},
+					Data:     tpm2.NewTPMUSensitiveCreate(&tpm2.TPM2BSensitiveData{Buffer: data[:n]}),
+				},
+			},
+			InPublic: tpm2.New2B(pub),
+		}.Execute(t)
+		if err != nil {
+			return nil, fmt.Errorf("sealing data: %w", err)
+		}
+		shards = append(shards, Shard{
+			Public:  tpm2.Marshal(rsp.OutPublic),
+			Private: tpm2.Marshal(rsp.OutPrivate),
+		})
+		data = data[n:]
+	}
+	env := &Envelope{
+		Version: 1,
+		Parent:  parent,
+		Policy:  policy,
+		Public:  shards[0].Public,
+		Private: shards[0].Private,
+	}
+	if len(shards) > 1 {
+		env.Version = Version
+		env.Shards = shards[1:]
+	}
+	return env, nil
+}
+
+// FromRaw wraps a sealed object stored as a raw marshalled TPM2B_PUBLIC and
+// TPM2B_PRIVATE in an envelope, so that it can be kept in the current format.
+// parent must describe the key the object was sealed under; its Name is
+// filled in when the object is next unsealed if it is not known. sel is the
+// PCR selection the object was sealed to, or nil. FromRaw checks that the
+// object's policy agrees with sel, as far as it can without the PCR values.
+func FromRaw(public, private []byte, parent Parent, sel *tpm2.TPMLPCRSelection) (*Envelope, error) {
+	pub, err := tpm2.Unmarshal[tpm2.TPM2BPublic](public)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public area: %w", err)
+	}
+	if _, err := tpm2.Unmarshal[tpm2.TPM2BPrivate](private); err != nil {
+		return nil, fmt.Errorf("invalid private area: %w", err)
+	}
+	contents, err := pub.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("invalid public area: %w", err)
+	}
+	if contents.Type != tpm2.TPMAlgKeyedHash {
+		return nil, fmt.Errorf("object of type %v is not a sealed object", contents.Type)
+	}
+
+	policy := Policy{Description: "password", Digest: contents.AuthPolicy.Buffer}
+	switch {
+	case sel != nil && len(contents.AuthPolicy.Buffer) == 0:
+		return nil, fmt.Errorf("PCR selection given for an object with no policy")
+	case sel != nil:
+		policy.Description = describe(sel)
+		policy.PCRSelection = tpm2.Marshal(sel)
+	case len(contents.AuthPolicy.Buffer) != 0:
+		policy.Description = "unknown policy"
+	}
+	return &Envelope{
+		Version: 1,
+		Parent:  parent,
+		Policy:  policy,
+		Public:  public,
+		Private: private,
+	}, nil
+}
+
+// Marshal encodes the envelope.
+func (e *Envelope) Marshal() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// Parse decodes an envelope written by Marshal, by this or an earlier
+// version of this package.
+func Parse(data []byte) (*Envelope, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return nil, ErrNotEnvelope
+	}
+	var e Envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotEnvelope, err)
+	}
+	switch {
+	case e.Version <= 0:
+		return nil, fmt.Errorf("%w: missing version", ErrNotEnvelope)
+	case e.Version > Version:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, e.Version)
+	}
+	return &e, nil
+}
+
+// Unseal loads the sealed object under its parent, satisfies its policy and
+// returns the sealed data. hierarchyAuth is the authorization of the parent's
+// hierarchy, needed if the parent must be recreated.
+func (e *Envelope) Unseal(t transport.TPM, hierarchyAuth []byte) ([]byte, error) {
+	return e.UnsealWithPIN(t, hierarchyAuth, nil)
+}
+
+// UnsealWithPIN is like Unseal, for objects sealed with SealWithPIN.
+func (e *Envelope) UnsealWithPIN(t transport.TPM, hierarchyAuth, pin []byte) ([]byte, error) {
+	if e.Policy.PIN && len(pin) == 0 {
+		return nil, errors.New("sealed data requires a PIN")
+	}
+	objects := make([]sealedObject, 0, 1+len(e.Shards))
+	for _, sh := range append([]Shard{{Public: e.Public, Private: e.Private}}, e.Shards...) {
+		obj, err := parseObject(sh)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, *obj)
+	}
+	var sel *tpm2.TPMLPCRSelection
+	if len(e.Policy.PCRSelection) != 0 {
+		var err error
+		if sel, err = tpm2.Unmarshal[tpm2.TPMLPCRSelection](e.Policy.PCRSelection); err != nil {
+			return nil, fmt.Errorf("invalid PCR selection: %w", err)
+		}
+	}
+
+	key, flush, err := e.Parent.load(t, hierarchyAuth)
+	if err != nil {
+		return nil, err
+	}
+	defer flush()
+	if len(e.Parent.Name) == 0 {
+		e.Parent.Name = key.Name.Buffer
+	} else if !bytes.Equal(e.Parent.Name, key.Name.Buffer) {
+		return nil, fmt.Errorf("parent has Name %x, but the data was sealed under %x", key.Name.Buffer, e.Parent.Name)
+	}
+
+	var data []byte
+	for i, obj := range objects {
+		part, err := e.unsealObject(t, key, obj, sel, pin)
+		if err != nil {
+			if len(objects) > 1 {
+				return nil, fmt.Errorf("shard %d: %w", i, err)
+			}
+			return nil, err
+		}
+		data = append(data, part...)
+	}
+	return data, nil
+}
+
+// sealedObject is a sealed object of an envelope, unmarshalled.
+type sealedObject struct {
+	pub     *tpm2.TPM2BPublic
+	priv    *tpm2.TPM2BPrivate
+	nameAlg tpm2.TPMIAlgHash
+}
+
+func parseObject(sh Shard) (*sealedObject, error) {
+	pub, err := tpm2.Unmarshal[tpm2.TPM2BPublic](sh.Public)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public area: %w", err)
+	}
+	contents, err := pub.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("invalid public area: %w", err)
+	}
+	priv, err := tpm2.Unmarshal[tpm2.TPM2BPrivate](sh.Private)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private area: %w", err)
+	}
+	return &sealedObject{pub: pub, priv: priv, nameAlg: contents.NameAlg}, nil
+}
+
+// unsealObject loads obj under key, satisfies the envelope's policy for it
+// and unseals it.
+func (e *Envelope) unsealObject(t transport.TPM, key *tpm2.NamedHandle, obj sealedObject, sel *tpm2.TPMLPCRSelection, pin []byte) ([]byte, error) {
+	loaded, err := tpm2.Load{
+		ParentHandle: key,
+		InPublic:     *obj.pub,
+		InPrivate:    *obj.priv,
+	}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("loading sealed object: %w", err)
+	}
+	defer tpm2.FlushContext{FlushHandle: loaded.ObjectHandle}.Execute(t)
+
+	auth := tpm2.PasswordAuth(nil)
+	switch {
+	case sel != nil:
+		sess, cleanup, err := tpm2.PolicySession(t, obj.nameAlg, 16, tpm2.Auth(pin))
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		if _, err := (tpm2.PolicyPCR{PolicySession: sess.Handle(), Pcrs: *sel}).Execute(t); err != nil {
+			return nil, err
+		}
+		if e.Policy.PIN {
+			if _, err := (tpm2.PolicyAuthValue{PolicySession: sess.Handle()}).Execute(t); err != nil {
+				return nil, err
+			}
+		}
+		auth = sess
+	case e.Policy.PIN:
+		auth = tpm2.HMAC(obj.nameAlg, 16, tpm2.Auth(pin))
+	}
+	rsp, err := tpm2.Unseal{
+		ItemHandle: tpm2.AuthHandle{
+			Handle: loaded.ObjectHandle,
+			Name:   loaded.Name,
+			Auth:   auth,
+		},
+	}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("unsealing: %w", err)
+	}
+	return rsp.OutData.Buffer, nil
+}
+
+// load finds or recreates the parent. The returned function flushes it if it
+// was recreated.
+func (p Parent) load(t transport.TPM, hierarchyAuth []byte) (*tpm2.NamedHandle, func(), error) {
+	if p.Handle != 0 {
+		rsp, err := tpm2.ReadPublic{ObjectHandle: p.Handle}.Execute(t)
+		if err == nil && (len(p.Name) == 0 || bytes.Equal(rsp.Name.Buffer, p.Name)) {
+			return &tpm2.NamedHandle{Handle: p.Handle, Name: rsp.Name}, func() {}, nil
+		}
+	}
+	tmpl, err := tpm2.Unmarshal[tpm2.TPMTPublic](p.Template)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid parent template: %w", err)
+	}
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.AuthHandle{
+			Handle: p.Hierarchy,
+			Auth:   tpm2.PasswordAuth(hierarchyAuth),
+		},
+		InPublic: tpm2.New2B(*tmpl),
+	}.Execute(t)
+	if err != nil {
+		return nil, nil, fmt.Errorf("recreating parent: %w", err)
+	}
+	flush := func() { tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(t) }
+	return &tpm2.NamedHandle{Handle: rsp.ObjectHandle, Name: rsp.Name}, flush, nil
+}
+
+// pcrPolicy returns the digest of a policy requiring the PCRs in sel to have
+// their current values and, if authValue is set, the object's auth value.
+func pcrPolicy(t transport.TPM, alg tpm2.TPMIAlgHash, sel *tpm2.TPMLPCRSelection, authValue bool) ([]byte, error) {
+	vals, err := tpm2.ReadPCRs(t, *sel)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := tpm2.PCRCompositeDigest(alg, *sel, vals)
+	if err != nil {
+		return nil, err
+	}
+	pol, err := tpm2.NewPolicyCalculator(alg)
+	if err != nil {
+		return nil, err
+	}
+	policyPCR := tpm2.PolicyPCR{
+		PcrDigest: tpm2.TPM2BDigest{Buffer: digest},
+		Pcrs:      *sel,
+	}
+	if err := policyPCR.Update(pol); err != nil {
+		return nil, err
+	}
+	if authValue {
+		if err := (tpm2.PolicyAuthValue{}).Update(pol); err != nil {
+			return nil, err
+		}
+	}
+	return pol.Hash().Digest, nil
+}
+
+// describe summarizes a PCR policy over sel, with the selection in the form
+// accepted by tpm2.ParsePCRSelection.
+func describe(sel *tpm2.TPMLPCRSelection) string {
+	var banks []string
+	for _, s := range sel.PCRSelections {
+		var pcrs []string
+		for _, pcr := range tpm2.SelectedPCRs(s.PCRSelect) {
+			pcrs = append(pcrs, fmt.Sprint(pcr))
+		}
+		banks = append(banks, tpm2.PCRBankName(s.Hash)+":"+strings.Join(pcrs, ","))
+	}
+	return "PolicyPCR " + strings.Join(banks, "+")
+}
@@ -0,0 +1,521 @@
+package sealed
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+	"testing/iotest"
+
+	tpm12 "github.com/google/go-tpm/tpm"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+func TestSealUnseal(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	secret := []byte("secret")
+	parent := PrimaryParent(tpm2.TPMRHOwner, tpm2.ECCSRKTemplate)
+	sel, err := tpm2.ParsePCRSelection("sha256:16")
+	if err != nil {
+		t.Fatalf("ParsePCRSelection: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		sel  *tpm2.TPMLPCRSelection
+	}{
+		{"Password", nil},
+		{"PCR", sel},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env, err := Seal(thetpm, parent, nil, secret, tc.sel)
+			if err != nil {
+				t.Fatalf("Seal: %v", err)
+			}
+			data, err := env.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			// The parent is recreated from its template to unseal.
+			parsed, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			got, err := parsed.Unseal(thetpm, nil)
+			if err != nil {
+				t.Fatalf("Unseal: %v", err)
+			}
+			if !bytes.Equal(got, secret) {
+				t.Errorf("Unseal() = %q, want %q", got, secret)
+			}
+		})
+	}
+
+	t.Run("PCRChanged", func(t *testing.T) {
+		env, err := Seal(thetpm, parent, nil, secret, sel)
+		if err != nil {
+			t.Fatalf("Seal: %v", err)
+		}
+		if env.Policy.Description != "PolicyPCR sha256:16" {
+			t.Errorf("policy description = %q", env.Policy.Description)
+		}
+		if _, err := tpm2.ExtendPCR(thetpm, tpm2.TPMHandle(16), []byte("event"), tpm2.ExtendBanks(tpm2.TPMAlgSHA256)); err != nil {
+			t.Fatalf("ExtendPCR: %v", err)
+		}
+		if _, err := env.Unseal(thetpm, nil); err == nil {
+			t.Errorf("Unseal succeeded after the PCR changed")
+		}
+	})
+
+	t.Run("WrongParent", func(t *testing.T) {
+		env, err := Seal(thetpm, parent, nil, secret, nil)
+		if err != nil {
+			t.Fatalf("Seal: %v", err)
+		}
+		env.Parent.Template = tpm2.Marshal(tpm2.RSASRKTemplate)
+		if _, err := env.Unseal(thetpm, nil); err == nil {
+			t.Errorf("Unseal succeeded under a different parent")
+		}
+	})
+}
+
+func TestSealWithPIN(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	secret := []byte("secret")
+	parent := PrimaryParent(tpm2.TPMRHOwner, tpm2.ECCSRKTemplate)
+	sel, err := tpm2.ParsePCRSelection("sha256:16")
+	if err != nil {
+		t.Fatalf("ParsePCRSelection: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		sel  *tpm2.TPMLPCRSelection
+	}{
+		{"PIN", nil},
+		{"PCRAndPIN", sel},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env, err := SealWithPIN(thetpm, parent, nil, secret, tc.sel, []byte("1234"))
+			if err != nil {
+				t.Fatalf("SealWithPIN: %v", err)
+			}
+			if !env.Policy.PIN {
+				t.Errorf("Policy.PIN = false")
+			}
+			got, err := env.UnsealWithPIN(thetpm, nil, []byte("1234"))
+			if err != nil {
+				t.Fatalf("UnsealWithPIN: %v", err)
+			}
+			if !bytes.Equal(got, secret) {
+				t.Errorf("UnsealWithPIN() = %q, want %q", got, secret)
+			}
+			if _, err := env.Unseal(thetpm, nil); err == nil {
+				t.Error("Unseal without the PIN succeeded")
+			}
+			if _, err := env.UnsealWithPIN(thetpm, nil, []byte("0000")); !errors.Is(err, tpm2.TPMRCAuthFail) {
+				t.Errorf("UnsealWithPIN(wrong PIN) = %v, want %v", err, tpm2.TPMRCAuthFail)
+			}
+		})
+	}
+}
+
+func TestSealNameAlg(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	secret := []byte("secret")
+	template := tpm2.ECCSRKTemplate
+	template.NameAlg = tpm2.TPMAlgSHA384
+	parent := PrimaryParent(tpm2.TPMRHOwner, template)
+	sel, err := tpm2.ParsePCRSelection("sha384:16")
+	if err != nil {
+		t.Fatalf("ParsePCRSelection: %v", err)
+	}
+
+	env, err := SealWithPIN(thetpm, parent, nil, secret, sel, []byte("1234"))
+	if err != nil {
+		t.Fatalf("SealWithPIN: %v", err)
+	}
+	pub, err := tpm2.Unmarshal[tpm2.TPM2BPublic](env.Public)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	contents, err := pub.Contents()
+	if err != nil {
+		t.Fatalf("Contents: %v", err)
+	}
+	if contents.NameAlg != tpm2.TPMAlgSHA384 {
+		t.Errorf("sealed object has name algorithm %#x, want %#x", contents.NameAlg, tpm2.TPMAlgSHA384)
+	}
+	if len(env.Policy.Digest) != 48 {
+		t.Errorf("policy digest is %d bytes, want 48", len(env.Policy.Digest))
+	}
+	got, err := env.UnsealWithPIN(thetpm, nil, []byte("1234"))
+	if err != nil {
+		t.Fatalf("UnsealWithPIN: %v", err)
+	}
+	if !bytes.Equal(got, secret) {
+		t.Errorf("UnsealWithPIN() = %q, want %q", got, secret)
+	}
+}
+
+func TestSealShards(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	parent := PrimaryParent(tpm2.TPMRHOwner, tpm2.ECCSRKTemplate)
+	sel, err := tpm2.ParsePCRSelection("sha256:16")
+	if err != nil {
+		t.Fatalf("ParsePCRSelection: %v", err)
+	}
+	for _, tc := range []struct {
+		size, shards, version int
+	}{
+		{1, 0, 1},
+		{128, 0, 1},
+		{129, 1, 2},
+		{1000, 7, 2},
+	} {
+		t.Run(fmt.Sprint(tc.size), func(t *testing.T) {
+			secret := make([]byte, tc.size)
+			for i := range secret {
+				secret[i] = byte(i)
+			}
+			env, err := SealWithPIN(thetpm, parent, nil, secret, sel, []byte("1234"))
+			if err != nil {
+				t.Fatalf("SealWithPIN: %v", err)
+			}
+			if len(env.Shards) != tc.shards || env.Version != tc.version {
+				t.Errorf("envelope has %d shards and version %d, want %d and %d", len(env.Shards), env.Version, tc.shards, tc.version)
+			}
+			data, err := env.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			parsed, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			got, err := parsed.UnsealWithPIN(thetpm, nil, []byte("1234"))
+			if err != nil {
+				t.Fatalf("UnsealWithPIN: %v", err)
+			}
+			if !bytes.Equal(got, secret) {
+				t.Errorf("UnsealWithPIN() = %x, want %x", got, secret)
+			}
+		})
+	}
+}
+
+func TestPersistentParent(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	srk, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	persistent := tpm2.TPMHandle(0x81000010)
+	_, err = tpm2.EvictControl{
+		Auth: tpm2.TPMRHOwner,
+		ObjectHandle: &tpm2.NamedHandle{
+			Handle: srk.ObjectHandle,
+			Name:   srk.Name,
+		},
+		PersistentHandle: persistent,
+	}.Execute(thetpm)
+	tpm2.FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("EvictControl: %v", err)
+	}
+	defer tpm2.EvictControl{
+		Auth: tpm2.TPMRHOwner,
+		ObjectHandle: &tpm2.NamedHandle{
+			Handle: persistent,
+			Name:   srk.Name,
+		},
+		PersistentHandle: persistent,
+	}.Execute(thetpm)
+
+	parent := PrimaryParent(tpm2.TPMRHOwner, tpm2.ECCSRKTemplate)
+	parent.Handle = persistent
+	env, err := Seal(thetpm, parent, nil, []byte("secret"), nil)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if !bytes.Equal(env.Parent.Name, srk.Name.Buffer) {
+		t.Errorf("parent Name = %x, want %x", env.Parent.Name, srk.Name.Buffer)
+	}
+	if got, err := env.Unseal(thetpm, nil); err != nil || string(got) != "secret" {
+		t.Errorf("Unseal() = %q, %v", got, err)
+	}
+}
+
+func TestFromRaw(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	parent := PrimaryParent(tpm2.TPMRHOwner, tpm2.ECCSRKTemplate)
+	sealed, err := Seal(thetpm, parent, nil, []byte("secret"), nil)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	// A raw blob carries no parent Name; it is learned on first use.
+	env, err := FromRaw(sealed.Public, sealed.Private, PrimaryParent(tpm2.TPMRHOwner, tpm2.ECCSRKTemplate), nil)
+	if err != nil {
+		t.Fatalf("FromRaw: %v", err)
+	}
+	if got, err := env.Unseal(thetpm, nil); err != nil || string(got) != "secret" {
+		t.Errorf("Unseal() = %q, %v", got, err)
+	}
+	if !bytes.Equal(env.Parent.Name, sealed.Parent.Name) {
+		t.Errorf("parent Name = %x, want %x", env.Parent.Name, sealed.Parent.Name)
+	}
+
+	sel, _ := tpm2.ParsePCRSelection("sha256:16")
+	if _, err := FromRaw(sealed.Public, sealed.Private, parent, sel); err == nil {
+		t.Errorf("FromRaw accepted a PCR selection for an object with no policy")
+	}
+	if _, err := Parse(append(sealed.Public, sealed.Private...)); !errors.Is(err, ErrNotEnvelope) {
+		t.Errorf("Parse(raw blob) = %v, want %v", err, ErrNotEnvelope)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		want error
+	}{
+		{`{"version":1}`, nil},
+		{`{"version":2}`, nil},
+		{`{"version":3}`, ErrUnsupportedVersion},
+		{`{}`, ErrNotEnvelope},
+		{`{"version":`, ErrNotEnvelope},
+	} {
+		if _, err := Parse([]byte(tc.data)); !errors.Is(err, tc.want) {
+			t.Errorf("Parse(%s) = %v, want %v", tc.data, err, tc.want)
+		}
+	}
+}
+
+func TestEncryptLarge(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	parent := PrimaryParent(tpm2.TPMRHOwner, tpm2.ECCSRKTemplate)
+	sel, err := tpm2.ParsePCRSelection("sha256:16")
+	if err != nil {
+		t.Fatalf("ParsePCRSelection: %v", err)
+	}
+	plaintext := bytes.Repeat([]byte("large data "), 100000)
+	data, err := EncryptLarge(thetpm, parent, nil, plaintext, sel)
+	if err != nil {
+		t.Fatalf("EncryptLarge: %v", err)
+	}
+	got, err := DecryptLarge(thetpm, nil, data)
+	if err != nil {
+		t.Fatalf("DecryptLarge: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("DecryptLarge() returned %d bytes different from the %d encrypted", len(got), len(plaintext))
+	}
+
+	tampered := bytes.Clone(data)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := DecryptLarge(thetpm, nil, tampered); err == nil {
+		t.Errorf("DecryptLarge succeeded with tampered ciphertext")
+	}
+	for _, bad := range [][]byte{nil, []byte("{}"), data[:len(largeMagic)+2], data[:len(largeMagic)+100]} {
+		if _, err := DecryptLarge(thetpm, nil, bad); !errors.Is(err, ErrNotEncrypted) {
+			t.Errorf("DecryptLarge(%d bytes) = %v, want %v", len(bad), err, ErrNotEncrypted)
+		}
+	}
+
+	if _, err := tpm2.ExtendPCR(thetpm, tpm2.TPMHandle(16), []byte("event"), tpm2.ExtendBanks(tpm2.TPMAlgSHA256)); err != nil {
+		t.Fatalf("ExtendPCR: %v", err)
+	}
+	if _, err := DecryptLarge(thetpm, nil, data); err == nil {
+		t.Errorf("DecryptLarge succeeded after the PCR changed")
+	}
+}
+
+func TestEncryptStream(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	parent := PrimaryParent(tpm2.TPMRHOwner, tpm2.ECCSRKTemplate)
+	// encrypt writes plaintext to an EncryptStream writer in pieces of
+	// 1000 bytes.
+	encrypt := func(plaintext []byte) []byte {
+		var buf bytes.Buffer
+		w, err := EncryptStream(&buf, thetpm, parent, nil, nil)
+		if err != nil {
+			t.Fatalf("EncryptStream: %v", err)
+		}
+		for p := plaintext; len(p) > 0; {
+			n := min(len(p), 1000)
+			if _, err := w.Write(p[:n]); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			p = p[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		return buf.Bytes()
+	}
+	decrypt := func(data []byte) ([]byte, error) {
+		r, err := DecryptStream(bytes.NewReader(data), thetpm, nil)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(iotest.HalfReader(r))
+	}
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 100} {
+		plaintext := bytes.Repeat([]byte{0x5A}, size)
+		data := encrypt(plaintext)
+		got, err := decrypt(data)
+		if err != nil {
+			t.Errorf("%d bytes: decrypting: %v", size, err)
+		} else if !bytes.Equal(got, plaintext) {
+			t.Errorf("%d bytes: decrypted %d bytes different from those encrypted", size, len(got))
+		}
+	}
+
+	// Chunks can't be dropped, reordered or appended. The data fills
+	// seven chunks, the last of them marked as such.
+	plaintext := bytes.Repeat([]byte("stream "), chunkSize)
+	data := encrypt(plaintext)
+	chunk := chunkSize + 16
+	body := len(data) - 7*chunk
+	chunks := func(i, j int) []byte { return data[body+i*chunk : min(body+j*chunk, len(data))] }
+	for name, bad := range map[string][]byte{
+		"Truncated": data[:body+6*chunk],
+		"Reordered": slices.Concat(data[:body], chunks(1, 2), chunks(0, 1), chunks(2, 7)),
+		"Dropped":   slices.Concat(data[:body], chunks(1, 7)),
+		"Swapped":   slices.Concat(data[:body], chunks(0, 5), chunks(6, 7), chunks(5, 6)),
+		"Appended":  slices.Concat(data, chunks(0, 1)),
+	} {
+		if _, err := decrypt(bad); err == nil {
+			t.Errorf("%s: decrypting succeeded", name)
+		}
+	}
+
+	// Without Close, the last chunk is missing.
+	var buf bytes.Buffer
+	w, err := EncryptStream(&buf, thetpm, parent, nil, nil)
+	if err != nil {
+		t.Fatalf("EncryptStream: %v", err)
+	}
+	if _, err := w.Write(plaintext[:chunkSize]); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := decrypt(buf.Bytes()); err == nil {
+		t.Errorf("decrypting succeeded without Close")
+	}
+}
+
+// tpm12Blob returns a TPM_STORED_DATA12 bound to pcrs and releasable at the
+// localities loc, as sealed by a TPM 1.2. Its encrypted part is a stand-in.
+func tpm12Blob(t *testing.T, pcrs []int, loc tpm12.Locality) []byte {
+	t.Helper()
+	var mask [3]byte
+	for _, pcr := range pcrs {
+		mask[pcr/8] |= 1 << (pcr % 8)
+	}
+	type pcrSelection struct {
+		Size uint16
+		Mask [3]byte
+	}
+	info, err := tpmutil.Pack(
+		uint16(0x0006), // TPM_TAG_PCR_INFO_LONG
+		byte(tpm12.LocZero), byte(loc),
+		pcrSelection{3, mask}, pcrSelection{3, mask},
+		[20]byte{}, [20]byte{},
+	)
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	blob, err := tpmutil.Pack(uint32(0x00160005), tpmutil.U32Bytes(info), tpmutil.U32Bytes("encrypted"))
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	return blob
+}
+
+func TestFromTPM12(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	secret := []byte("secret")
+	all := tpm12.LocZero | tpm12.LocOne | tpm12.LocTwo | tpm12.LocThree | tpm12.LocFour
+	opts := TPM12Options{Parent: PrimaryParent(tpm2.TPMRHOwner, tpm2.ECCSRKTemplate)}
+
+	env, err := FromTPM12(thetpm, tpm12Blob(t, []int{7, 16}, all), secret, opts)
+	if err != nil {
+		t.Fatalf("FromTPM12: %v", err)
+	}
+	if want := "PolicyPCR sha256:7,16"; env.Policy.Description != want {
+		t.Errorf("policy = %q, want %q", env.Policy.Description, want)
+	}
+	if got, err := env.Unseal(thetpm, nil); err != nil || !bytes.Equal(got, secret) {
+		t.Errorf("Unseal() = %q, %v", got, err)
+	}
+
+	env, err = FromTPM12(thetpm, tpm12Blob(t, nil, all), secret, opts)
+	if err != nil {
+		t.Fatalf("FromTPM12: %v", err)
+	}
+	if len(env.Policy.PCRSelection) != 0 {
+		t.Errorf("data sealed without PCRs migrated with PCR policy %q", env.Policy.Description)
+	}
+
+	if _, err := FromTPM12(thetpm, tpm12Blob(t, []int{7}, tpm12.LocThree), secret, opts); !errors.Is(err, ErrLocality) {
+		t.Errorf("FromTPM12() of data sealed to locality 3 = %v, want %v", err, ErrLocality)
+	}
+	opts.AnyLocality = true
+	if _, err := FromTPM12(thetpm, tpm12Blob(t, []int{7}, tpm12.LocThree), secret, opts); err != nil {
+		t.Errorf("FromTPM12() with AnyLocality = %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package sealed
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	tpm12 "github.com/google/go-tpm/tpm"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrLocality is returned when migrating TPM 1.2 sealed data that can only
+// be unsealed from some localities, since envelopes can't express that.
+var ErrLocality = errors.New("sealed data is restricted to some localities")
+
+// TPM12Options describes how to migrate data sealed by a TPM 1.2.
+type TPM12Options struct {
+	// SRKAuth is the auth value of the TPM 1.2 SRK.
+	SRKAuth []byte
+	// DataAuth is the auth value of the sealed data, if it was sealed with
+	// its own rather than the SRK's.
+	DataAuth *tpm12.Digest
+
+	// Parent is the storage key of the TPM 2.0 to reseal the data under,
+	// and HierarchyAuth the authorization of its hierarchy.
+	Parent        Parent
+	HierarchyAuth []byte
+	// Bank is the PCR bank of the new policy. Zero selects SHA-256.
+	Bank tpm2.TPMIAlgHash
+	// PIN, if not empty, is required to unseal the migrated data, as with
+	// SealWithPIN.
+	PIN []byte
+	// AnyLocality allows migrating data that the TPM 1.2 only released
+	// at some localities. The migrated data can be unsealed from any.
+	AnyLocality bool
+}
+
+// MigrateTPM12 unseals data sealed by a TPM 1.2, with tpm.Seal, tpm.Reseal
+// or tpm.SealWithOptions, and reseals it to the TPM 2.0 t with an
+// equivalent policy, as FromTPM12 does. The PCRs of the TPM 1.2 must have
+// the values the data was sealed to.
+func MigrateTPM12(rw io.ReadWriter, sealed []byte, t transport.TPM, opts TPM12Options) (*Envelope, error) {
+	var data []byte
+	var err error
+	if opts.DataAuth != nil {
+		data, err = tpm12.UnsealWithAuth(rw, sealed, opts.SRKAuth, *opts.DataAuth)
+	} else {
+		data, err = tpm12.Unseal(rw, sealed, opts.SRKAuth)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unsealing TPM 1.2 data: %w", err)
+	}
+	defer clear(data)
+	return FromTPM12(t, sealed, data, opts)
+}
+
+// FromTPM12 seals data, which was unsealed from the TPM 1.2 sealed blob
+// sealed, to the TPM 2.0 t. The new object is bound to the same PCRs as the
+// blob, in opts.Bank, with their current values on t: the new TPM measures
+// different firmware, so the values the blob was sealed to wouldn't match.
+// Data that wasn't bound to PCRs is sealed without a PCR policy.
+func FromTPM12(t transport.TPM, sealed, data []byte, opts TPM12Options) (*Envelope, error) {
+	pcrs, loc, err := tpm12.SealedPCRs(sealed)
+	if err != nil {
+		return nil, err
+	}
+	all := tpm12.LocZero | tpm12.LocOne | tpm12.LocTwo | tpm12.LocThree | tpm12.LocFour
+	if loc&all != all && !opts.AnyLocality {
+		return nil, fmt.Errorf("%w: %#x", ErrLocality, loc)
+	}
+
+	var sel *tpm2.TPMLPCRSelection
+	if len(pcrs) != 0 {
+		bank := opts.Bank
+		if bank == 0 {
+			bank = tpm2.TPMAlgSHA256
+		}
+		mask := make([]byte, 3)
+		for _, pcr := range pcrs {
+			mask[pcr/8] |= 1 << (pcr % 8)
+		}
+		sel = &tpm2.TPMLPCRSelection{
+			PCRSelections: []tpm2.TPMSPCRSelection{{Hash: bank, PCRSelect: mask}},
+		}
+	}
+	return SealWithPIN(t, opts.Parent, opts.HierarchyAuth, data, sel, opts.PIN)
+}
@@ -33,10 +33,20 @@ type Session interface {
 	// If this is the first authorization session for a command, and
 	// there is another session (or sessions) for parameter
 	// decryption and/or encryption, then addNonces contains the
-	// nonceTPMs from each of them, respectively (see Part 1, 19.6.5)
+	// nonceTPMs from each of them, respectively (see Part 1, 19.6.5).
+	// names holds the Names of all the command's handles. authIndex is
+	// the index in names of the handle the session authorizes, len(names)
+	// if that handle has no Name, or -1 if the session authorizes no
+	// handle and is only used for audit or parameter encryption.
+	//
+	// Implementations outside this package that index names with
+	// authIndex must check for -1 and len(names): before sessions that
+	// authorize no handle were supported, authIndex was always a valid
+	// index.
 	Authorize(cc TPMCC, parms, addNonces []byte, names []TPM2BName, authIndex int) (*TPMSAuthCommand, error)
 	// Validates the response for the session.
-	// Updates NonceTPM for the session.
+	// Updates NonceTPM for the session. names and authIndex are as for
+	// Authorize.
 	Validate(rc TPMRC, cc TPMCC, parms []byte, names []TPM2BName, authIndex int, auth *TPMSAuthResponse) error
 	// Returns true if this is an encryption session.
 	IsEncryption() bool
@@ -52,6 +62,15 @@ type Session interface {
 	Handle() TPMHandle
 }
 
+// paramCrypter is implemented by the sessions in this package. A session's
+// parameter encryption key includes the auth value it was given only when it
+// authorizes one of the command's handles (Part 1, section 21.1), which
+// Encrypt and Decrypt assume.
+type paramCrypter interface {
+	encryptParam(parameter []byte, authorizing bool) error
+	decryptParam(parameter []byte, authorizing bool) error
+}
+
 // CPHash calculates the TPM command parameter hash for a given Command.
 // N.B. Authorization sessions on handles are ignored, but names aren't.
 func CPHash[R any](alg TPMIAlgHash, cmd Command[R, *R]) (*TPM2BDigest, error) {
@@ -60,10 +79,18 @@ func CPHash[R any](alg TPMIAlgHash, cmd Command[R, *R]) (*TPM2BDigest, error) {
 	if err != nil {
 		return nil, err
 	}
-	parms, err := cmdParameters(cmd, nil)
+	parms, err := cmdParameters(cmd, nil, 0)
 	if err != nil {
 		return nil, err
 	}
+	return CPHashFromParameters(alg, cc, names, parms)
+}
+
+// CPHashFromParameters calculates the TPM command parameter hash from the
+// already-marshalled parts of a command: its command code, the Names of the
+// entities referenced by its handles, and its parameter area. This is useful
+// to verifiers that only have the bytes that were sent to the TPM.
+func CPHashFromParameters(alg TPMIAlgHash, cc TPMCC, names []TPM2BName, parms []byte) (*TPM2BDigest, error) {
 	digest, err := cpHash(alg, cc, names, parms)
 	if err != nil {
 		return nil, err
@@ -73,6 +100,30 @@ func CPHash[R any](alg TPMIAlgHash, cmd Command[R, *R]) (*TPM2BDigest, error) {
 	}, nil
 }
 
+// RPHash calculates the TPM response parameter hash for a successful
+// response to the given Command.
+// Go Generics do not allow type parameters on methods, so cmd is only used
+// for its command code.
+func RPHash[C Command[R, *R], R any](alg TPMIAlgHash, cmd C, rsp *R) (*TPM2BDigest, error) {
+	parms, err := rspParameterBytes(rsp)
+	if err != nil {
+		return nil, err
+	}
+	return RPHashFromParameters(alg, TPMRCSuccess, cmd.Command(), parms)
+}
+
+// RPHashFromParameters calculates the TPM response parameter hash from a
+// response code, the command code, and the response's parameter area.
+func RPHashFromParameters(alg TPMIAlgHash, rc TPMRC, cc TPMCC, parms []byte) (*TPM2BDigest, error) {
+	digest, err := rpHash(alg, rc, cc, parms)
+	if err != nil {
+		return nil, err
+	}
+	return &TPM2BDigest{
+		Buffer: digest,
+	}, nil
+}
+
 // pwSession represents a password-pseudo-session.
 type pwSession struct {
 	auth []byte
@@ -193,6 +244,8 @@ type sessionOptions struct {
 	attrs       TPMASession
 	symmetric   TPMTSymDef
 	trialPolicy bool
+	crypto      CryptoProvider
+	fips        bool
 }
 
 // defaultOptions represents the default options used when none are provided.
@@ -203,6 +256,7 @@ func defaultOptions() sessionOptions {
 		},
 		bindHandle: TPMRHNull,
 		saltHandle: TPMRHNull,
+		crypto:     SoftwareCrypto{},
 	}
 }
 
@@ -248,6 +302,14 @@ func Salted(handle TPMIDHObject, pub TPMTPublic) AuthOption {
 	}
 }
 
+// Crypto specifies the provider used for the session's salt encryption, key
+// derivation and HMAC operations, instead of SoftwareCrypto.
+func Crypto(p CryptoProvider) AuthOption {
+	return func(o *sessionOptions) {
+		o.crypto = p
+	}
+}
+
 // parameterEncryptiontpm2ion specifies whether the session-encrypted
 // parameters are encrypted on the way into the TPM, out of the TPM, or both.
 type parameterEncryptiontpm2ion int
@@ -370,7 +432,7 @@ func HMACSession(t transport.TPM, hash TPMIAlgHash, nonceSize int, opts ...AuthO
 }
 
 // Part 1, B.10.2
-func getEncryptedSaltRSA(nameAlg TPMIAlgHash, parms *TPMSRSAParms, pub *TPM2BPublicKeyRSA) (*TPM2BEncryptedSecret, []byte, error) {
+func getEncryptedSaltRSA(nameAlg TPMIAlgHash, parms *TPMSRSAParms, pub *TPM2BPublicKeyRSA, label string) (*TPM2BEncryptedSecret, []byte, error) {
 	rsaPub, err := RSAPub(parms, pub)
 	if err != nil {
 		return nil, nil, fmt.Errorf("could not encrypt salt to RSA key: %w", err)
@@ -413,7 +475,7 @@ func getEncryptedSaltRSA(nameAlg TPMIAlgHash, parms *TPMSRSAParms, pub *TPM2BPub
 		return nil, nil, fmt.Errorf("generating random salt: %w", err)
 	}
 	// Part 1, section 4.6 specifies the trailing NULL byte for the label.
-	encSalt, err := rsa.EncryptOAEP(ha.New(), rand.Reader, rsaPub, salt, []byte("SECRET\x00"))
+	encSalt, err := rsa.EncryptOAEP(ha.New(), rand.Reader, rsaPub, salt, append([]byte(label), 0))
 	if err != nil {
 		return nil, nil, fmt.Errorf("encrypting salt: %w", err)
 	}
@@ -423,7 +485,7 @@ func getEncryptedSaltRSA(nameAlg TPMIAlgHash, parms *TPMSRSAParms, pub *TPM2BPub
 }
 
 // Part 1, 19.6.13
-func getEncryptedSaltECC(nameAlg TPMIAlgHash, parms *TPMSECCParms, pub *TPMSECCPoint) (*TPM2BEncryptedSecret, []byte, error) {
+func getEncryptedSaltECC(nameAlg TPMIAlgHash, parms *TPMSECCParms, pub *TPMSECCPoint, label string) (*TPM2BEncryptedSecret, []byte, error) {
 	curve, err := parms.CurveID.ECDHCurve()
 	if err != nil {
 		return nil, nil, fmt.Errorf("ecc salt: param curve: %w", err)
@@ -453,7 +515,7 @@ func getEncryptedSaltECC(nameAlg TPMIAlgHash, parms *TPMSECCParms, pub *TPMSECCP
 	if err != nil {
 		return nil, nil, err
 	}
-	salt := KDFe(ha, z, "SECRET", ephPubX.Bytes(), pub.X.Buffer, ha.Size()*8)
+	salt := KDFe(ha, z, label, ephPubX.Bytes(), pub.X.Buffer, ha.Size()*8)
 
 	var encSalt bytes.Buffer
 	binary.Write(&encSalt, binary.BigEndian, uint16(len(ephPubX.Bytes())))
@@ -465,9 +527,16 @@ func getEncryptedSaltECC(nameAlg TPMIAlgHash, parms *TPMSECCParms, pub *TPMSECCP
 	}, salt, nil
 }
 
-// getEncryptedSalt creates a salt value for salted sessions.
+// getEncryptedSalt creates a salt value for salted sessions using p.
 // Returns the encrypted salt and plaintext salt, or an error value.
-func getEncryptedSalt(pub TPMTPublic) (*TPM2BEncryptedSecret, []byte, error) {
+func getEncryptedSalt(p CryptoProvider, pub TPMTPublic) (*TPM2BEncryptedSecret, []byte, error) {
+	return p.EncryptSalt(pub, "SECRET")
+}
+
+// encryptSecret creates a random secret and protects it to pub, for use
+// with the given label ("SECRET" for a salt, "DUPLICATE" for the seed of a
+// duplicated object's outer wrapper).
+func encryptSecret(pub TPMTPublic, label string) (*TPM2BEncryptedSecret, []byte, error) {
 	switch pub.Type {
 	case TPMAlgRSA:
 		rsaParms, err := pub.Parameters.RSADetail()
@@ -478,7 +547,7 @@ func getEncryptedSalt(pub TPMTPublic) (*TPM2BEncryptedSecret, []byte, error) {
 		if err != nil {
 			return nil, nil, err
 		}
-		return getEncryptedSaltRSA(pub.NameAlg, rsaParms, rsaPub)
+		return getEncryptedSaltRSA(pub.NameAlg, rsaParms, rsaPub, label)
 	case TPMAlgECC:
 		eccParms, err := pub.Parameters.ECCDetail()
 		if err != nil {
@@ -488,7 +557,7 @@ func getEncryptedSalt(pub TPMTPublic) (*TPM2BEncryptedSecret, []byte, error) {
 		if err != nil {
 			return nil, nil, err
 		}
-		return getEncryptedSaltECC(pub.NameAlg, eccParms, eccPub)
+		return getEncryptedSaltECC(pub.NameAlg, eccParms, eccPub, label)
 	default:
 		return nil, nil, fmt.Errorf("salt encryption alg '%v' not supported", pub.Type)
 	}
@@ -500,6 +569,11 @@ func (s *hmacSession) Init(t transport.TPM) error {
 		// Session is already initialized.
 		return nil
 	}
+	if s.fips || fipsEnforced {
+		if err := s.checkFIPS(s.hash); err != nil {
+			return err
+		}
+	}
 
 	// Get a high-quality nonceCaller for our use.
 	// Store it with the session object for later reference.
@@ -523,7 +597,7 @@ func (s *hmacSession) Init(t transport.TPM) error {
 	if s.saltHandle != TPMRHNull {
 		var err error
 		var encSalt *TPM2BEncryptedSecret
-		encSalt, salt, err = getEncryptedSalt(s.saltPub)
+		encSalt, salt, err = getEncryptedSalt(s.sessionCrypto(), s.saltPub)
 		if err != nil {
 			return err
 		}
@@ -544,7 +618,10 @@ func (s *hmacSession) Init(t transport.TPM) error {
 		var authSalt []byte
 		authSalt = append(authSalt, s.bindAuth...)
 		authSalt = append(authSalt, salt...)
-		s.sessionKey = KDFa(ha, authSalt, "ATH", s.nonceTPM.Buffer, s.nonceCaller.Buffer, ha.Size()*8)
+		s.sessionKey, err = s.sessionCrypto().KDFa(ha, authSalt, "ATH", s.nonceTPM.Buffer, s.nonceCaller.Buffer, ha.Size()*8)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -602,18 +679,18 @@ func attrsToBytes(attrs TPMASession) []byte {
 // nonceOlder in a command is the last nonceTPM sent by the TPM for this session.
 // This may be when the session was created, or the last time it was used.
 // nonceOlder in a response is the corresponding nonceCaller sent in the command.
-func computeHMAC(alg TPMIAlgHash, key, pHash, nonceNewer, nonceOlder, addNonces []byte, attrs TPMASession) ([]byte, error) {
+func computeHMAC(p CryptoProvider, alg TPMIAlgHash, key, pHash, nonceNewer, nonceOlder, addNonces []byte, attrs TPMASession) ([]byte, error) {
 	ha, err := alg.Hash()
 	if err != nil {
 		return nil, err
 	}
-	mac := hmac.New(ha.New, key)
-	mac.Write(pHash)
-	mac.Write(nonceNewer)
-	mac.Write(nonceOlder)
-	mac.Write(addNonces)
-	mac.Write(attrsToBytes(attrs))
-	return mac.Sum(nil), nil
+	var data []byte
+	data = append(data, pHash...)
+	data = append(data, nonceNewer...)
+	data = append(data, nonceOlder...)
+	data = append(data, addNonces...)
+	data = append(data, attrsToBytes(attrs)...)
+	return p.HMAC(ha, key, data)
 }
 
 // Trim trailing zeros from the auth value. Part 1, 19.6.5, Note 2
@@ -634,6 +711,20 @@ func (s *hmacSession) NewNonceCaller() error {
 	return err
 }
 
+// hmacKey returns the key for the session's command and response HMACs.
+// Part 1, 19.6: the key is (sessionKey || auth) when the session authorizes
+// a handle other than its bind target, and sessionKey alone otherwise.
+func (s *hmacSession) hmacKey(names []TPM2BName, authIndex int) []byte {
+	key := append([]byte(nil), s.sessionKey...)
+	if authIndex < 0 {
+		return key
+	}
+	if len(s.bindName.Buffer) == 0 || authIndex >= len(names) || !bytes.Equal(names[authIndex].Buffer, s.bindName.Buffer) {
+		key = append(key, hmacKeyFromAuthValue(s.auth)...)
+	}
+	return key
+}
+
 // Authorize computes the authorization structure for the session.
 // Unlike the TPM spec, authIndex is zero-based.
 func (s *hmacSession) Authorize(cc TPMCC, parms, addNonces []byte, names []TPM2BName, authIndex int) (*TPMSAuthCommand, error) {
@@ -642,21 +733,14 @@ func (s *hmacSession) Authorize(cc TPMCC, parms, addNonces []byte, names []TPM2B
 		return nil, fmt.Errorf("session not initialized")
 	}
 
-	// Part 1, 19.6
-	// HMAC key is (sessionKey || auth) unless this session is authorizing
-	// its bind target
-	var hmacKey []byte
-	hmacKey = append(hmacKey, s.sessionKey...)
-	if len(s.bindName.Buffer) == 0 || authIndex >= len(names) || !bytes.Equal(names[authIndex].Buffer, s.bindName.Buffer) {
-		hmacKey = append(hmacKey, hmacKeyFromAuthValue(s.auth)...)
-	}
+	hmacKey := s.hmacKey(names, authIndex)
 
 	// Compute the authorization HMAC.
 	cph, err := cpHash(s.hash, cc, names, parms)
 	if err != nil {
 		return nil, err
 	}
-	hmac, err := computeHMAC(s.hash, hmacKey, cph, s.nonceCaller.Buffer, s.nonceTPM.Buffer, addNonces, s.attrs)
+	hmac, err := computeHMAC(s.sessionCrypto(), s.hash, hmacKey, cph, s.nonceCaller.Buffer, s.nonceTPM.Buffer, addNonces, s.attrs)
 	if err != nil {
 		return nil, err
 	}
@@ -681,21 +765,14 @@ func (s *hmacSession) Validate(rc TPMRC, cc TPMCC, parms []byte, names []TPM2BNa
 		s.handle = TPMRHNull
 	}
 
-	// Part 1, 19.6
-	// HMAC key is (sessionKey || auth) unless this session is authorizing
-	// its bind target
-	var hmacKey []byte
-	hmacKey = append(hmacKey, s.sessionKey...)
-	if len(s.bindName.Buffer) == 0 || authIndex >= len(names) || !bytes.Equal(names[authIndex].Buffer, s.bindName.Buffer) {
-		hmacKey = append(hmacKey, hmacKeyFromAuthValue(s.auth)...)
-	}
+	hmacKey := s.hmacKey(names, authIndex)
 
 	// Compute the authorization HMAC.
 	rph, err := rpHash(s.hash, rc, cc, parms)
 	if err != nil {
 		return err
 	}
-	mac, err := computeHMAC(s.hash, hmacKey, rph, s.nonceTPM.Buffer, s.nonceCaller.Buffer, nil, auth.Attributes)
+	mac, err := computeHMAC(s.sessionCrypto(), s.hash, hmacKey, rph, s.nonceTPM.Buffer, s.nonceCaller.Buffer, nil, auth.Attributes)
 	if err != nil {
 		return err
 	}
@@ -719,6 +796,11 @@ func (s *hmacSession) IsDecryption() bool {
 // Encrypt decrypts the parameter in place, if this session is used for
 // parameter decryption. Otherwise, it does not modify the parameter.
 func (s *hmacSession) Encrypt(parameter []byte) error {
+	return s.encryptParam(parameter, true)
+}
+
+// encryptParam is Encrypt for a session that authorizes a handle, or not.
+func (s *hmacSession) encryptParam(parameter []byte, authorizing bool) error {
 	if !s.IsDecryption() {
 		return nil
 	}
@@ -731,12 +813,19 @@ func (s *hmacSession) Encrypt(parameter []byte) error {
 	keyIVBytes := int(keyBytes) + 16
 	var sessionValue []byte
 	sessionValue = append(sessionValue, s.sessionKey...)
-	sessionValue = append(sessionValue, s.auth...)
+	// The auth value is only included for a session that authorizes a
+	// handle.
+	if authorizing {
+		sessionValue = append(sessionValue, s.auth...)
+	}
 	ha, err := s.hash.Hash()
 	if err != nil {
 		return err
 	}
-	keyIV := KDFa(ha, sessionValue, "CFB", s.nonceCaller.Buffer, s.nonceTPM.Buffer, keyIVBytes*8)
+	keyIV, err := s.sessionCrypto().KDFa(ha, sessionValue, "CFB", s.nonceCaller.Buffer, s.nonceTPM.Buffer, keyIVBytes*8)
+	if err != nil {
+		return err
+	}
 	key, err := aes.NewCipher(keyIV[:keyBytes])
 	if err != nil {
 		return err
@@ -749,6 +838,11 @@ func (s *hmacSession) Encrypt(parameter []byte) error {
 // Decrypt encrypts the parameter in place, if this session is used for
 // parameter encryption. Otherwise, it does not modify the parameter.
 func (s *hmacSession) Decrypt(parameter []byte) error {
+	return s.decryptParam(parameter, true)
+}
+
+// decryptParam is Decrypt for a session that authorizes a handle, or not.
+func (s *hmacSession) decryptParam(parameter []byte, authorizing bool) error {
 	if !s.IsEncryption() {
 		return nil
 	}
@@ -762,12 +856,19 @@ func (s *hmacSession) Decrypt(parameter []byte) error {
 	// Part 1, 21.1
 	var sessionValue []byte
 	sessionValue = append(sessionValue, s.sessionKey...)
-	sessionValue = append(sessionValue, s.auth...)
+	// The auth value is only included for a session that authorizes a
+	// handle.
+	if authorizing {
+		sessionValue = append(sessionValue, s.auth...)
+	}
 	ha, err := s.hash.Hash()
 	if err != nil {
 		return err
 	}
-	keyIV := KDFa(ha, sessionValue, "CFB", s.nonceTPM.Buffer, s.nonceCaller.Buffer, keyIVBytes*8)
+	keyIV, err := s.sessionCrypto().KDFa(ha, sessionValue, "CFB", s.nonceTPM.Buffer, s.nonceCaller.Buffer, keyIVBytes*8)
+	if err != nil {
+		return err
+	}
 	key, err := aes.NewCipher(keyIV[:keyBytes])
 	if err != nil {
 		return err
@@ -861,6 +962,11 @@ func (s *policySession) Init(t transport.TPM) error {
 		// Session is already initialized.
 		return nil
 	}
+	if s.fips || fipsEnforced {
+		if err := s.checkFIPS(s.hash); err != nil {
+			return err
+		}
+	}
 
 	// Get a high-quality nonceCaller for our use.
 	// Store it with the session object for later reference.
@@ -889,7 +995,7 @@ func (s *policySession) Init(t transport.TPM) error {
 	if s.saltHandle != TPMRHNull {
 		var err error
 		var encSalt *TPM2BEncryptedSecret
-		encSalt, salt, err = getEncryptedSalt(s.saltPub)
+		encSalt, salt, err = getEncryptedSalt(s.sessionCrypto(), s.saltPub)
 		if err != nil {
 			return err
 		}
@@ -910,7 +1016,10 @@ func (s *policySession) Init(t transport.TPM) error {
 		if err != nil {
 			return err
 		}
-		s.sessionKey = KDFa(ha, authSalt, "ATH", s.nonceTPM.Buffer, s.nonceCaller.Buffer, ha.Size()*8)
+		s.sessionKey, err = s.sessionCrypto().KDFa(ha, authSalt, "ATH", s.nonceTPM.Buffer, s.nonceCaller.Buffer, ha.Size()*8)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Call the callback to execute the policy, if needed
@@ -948,7 +1057,7 @@ func (s *policySession) NewNonceCaller() error {
 }
 
 // Authorize computes the authorization structure for the session.
-func (s *policySession) Authorize(cc TPMCC, parms, addNonces []byte, names []TPM2BName, _ int) (*TPMSAuthCommand, error) {
+func (s *policySession) Authorize(cc TPMCC, parms, addNonces []byte, names []TPM2BName, authIndex int) (*TPMSAuthCommand, error) {
 	if s.handle == TPMRHNull {
 		// Session is not initialized.
 		return nil, fmt.Errorf("session not initialized")
@@ -959,17 +1068,19 @@ func (s *policySession) Authorize(cc TPMCC, parms, addNonces []byte, names []TPM
 		hmac = s.auth
 	} else {
 		// Part 1, 19.6
-		// HMAC key is (sessionKey || auth).
-		var hmacKey []byte
-		hmacKey = append(hmacKey, s.sessionKey...)
-		hmacKey = append(hmacKey, hmacKeyFromAuthValue(s.auth)...)
+		// HMAC key is (sessionKey || auth), or sessionKey if the
+		// session authorizes no handle.
+		hmacKey := append([]byte(nil), s.sessionKey...)
+		if authIndex >= 0 {
+			hmacKey = append(hmacKey, hmacKeyFromAuthValue(s.auth)...)
+		}
 
 		// Compute the authorization HMAC.
 		cph, err := cpHash(s.hash, cc, names, parms)
 		if err != nil {
 			return nil, err
 		}
-		hmac, err = computeHMAC(s.hash, hmacKey, cph, s.nonceCaller.Buffer, s.nonceTPM.Buffer, addNonces, s.attrs)
+		hmac, err = computeHMAC(s.sessionCrypto(), s.hash, hmacKey, cph, s.nonceCaller.Buffer, s.nonceTPM.Buffer, addNonces, s.attrs)
 		if err != nil {
 			return nil, err
 		}
@@ -988,7 +1099,7 @@ func (s *policySession) Authorize(cc TPMCC, parms, addNonces []byte, names []TPM
 
 // Validate valitades the response session structure for the session.
 // Updates nonceTPM from the TPM's response.
-func (s *policySession) Validate(rc TPMRC, cc TPMCC, parms []byte, _ []TPM2BName, _ int, auth *TPMSAuthResponse) error {
+func (s *policySession) Validate(rc TPMRC, cc TPMCC, parms []byte, _ []TPM2BName, authIndex int, auth *TPMSAuthResponse) error {
 	// Track the new nonceTPM for the session.
 	s.nonceTPM = auth.Nonce
 	// Track the session being automatically flushed.
@@ -1006,16 +1117,18 @@ func (s *policySession) Validate(rc TPMRC, cc TPMCC, parms []byte, _ []TPM2BName
 		}
 	} else {
 		// Part 1, 19.6
-		// HMAC key is (sessionKey || auth).
-		var hmacKey []byte
-		hmacKey = append(hmacKey, s.sessionKey...)
-		hmacKey = append(hmacKey, hmacKeyFromAuthValue(s.auth)...)
+		// HMAC key is (sessionKey || auth), or sessionKey if the
+		// session authorizes no handle.
+		hmacKey := append([]byte(nil), s.sessionKey...)
+		if authIndex >= 0 {
+			hmacKey = append(hmacKey, hmacKeyFromAuthValue(s.auth)...)
+		}
 		// Compute the authorization HMAC.
 		rph, err := rpHash(s.hash, rc, cc, parms)
 		if err != nil {
 			return err
 		}
-		mac, err := computeHMAC(s.hash, hmacKey, rph, s.nonceTPM.Buffer, s.nonceCaller.Buffer, nil, auth.Attributes)
+		mac, err := computeHMAC(s.sessionCrypto(), s.hash, hmacKey, rph, s.nonceTPM.Buffer, s.nonceCaller.Buffer, nil, auth.Attributes)
 		if err != nil {
 			return err
 		}
@@ -1040,6 +1153,11 @@ func (s *policySession) IsDecryption() bool {
 // Encrypt encrypts the parameter in place, if this session is used for
 // parameter decryption. Otherwise, it does not modify the parameter.
 func (s *policySession) Encrypt(parameter []byte) error {
+	return s.encryptParam(parameter, true)
+}
+
+// encryptParam is Encrypt for a session that authorizes a handle, or not.
+func (s *policySession) encryptParam(parameter []byte, authorizing bool) error {
 	if !s.IsDecryption() {
 		return nil
 	}
@@ -1052,12 +1170,19 @@ func (s *policySession) Encrypt(parameter []byte) error {
 	keyIVBytes := int(keyBytes) + 16
 	var sessionValue []byte
 	sessionValue = append(sessionValue, s.sessionKey...)
-	sessionValue = append(sessionValue, s.auth...)
+	// The auth value is only included for a session that authorizes a
+	// handle.
+	if authorizing {
+		sessionValue = append(sessionValue, s.auth...)
+	}
 	ha, err := s.hash.Hash()
 	if err != nil {
 		return err
 	}
-	keyIV := KDFa(ha, sessionValue, "CFB", s.nonceCaller.Buffer, s.nonceTPM.Buffer, keyIVBytes*8)
+	keyIV, err := s.sessionCrypto().KDFa(ha, sessionValue, "CFB", s.nonceCaller.Buffer, s.nonceTPM.Buffer, keyIVBytes*8)
+	if err != nil {
+		return err
+	}
 	key, err := aes.NewCipher(keyIV[:keyBytes])
 	if err != nil {
 		return err
@@ -1070,6 +1195,11 @@ func (s *policySession) Encrypt(parameter []byte) error {
 // Decrypt decrypts the parameter in place, if this session is used for
 // parameter encryption. Otherwise, it does not modify the parameter.
 func (s *policySession) Decrypt(parameter []byte) error {
+	return s.decryptParam(parameter, true)
+}
+
+// decryptParam is Decrypt for a session that authorizes a handle, or not.
+func (s *policySession) decryptParam(parameter []byte, authorizing bool) error {
 	if !s.IsEncryption() {
 		return nil
 	}
@@ -1083,12 +1213,19 @@ func (s *policySession) Decrypt(parameter []byte) error {
 	// Part 1, 21.1
 	var sessionValue []byte
 	sessionValue = append(sessionValue, s.sessionKey...)
-	sessionValue = append(sessionValue, s.auth...)
+	// The auth value is only included for a session that authorizes a
+	// handle.
+	if authorizing {
+		sessionValue = append(sessionValue, s.auth...)
+	}
 	ha, err := s.hash.Hash()
 	if err != nil {
 		return err
 	}
-	keyIV := KDFa(ha, sessionValue, "CFB", s.nonceTPM.Buffer, s.nonceCaller.Buffer, keyIVBytes*8)
+	keyIV, err := s.sessionCrypto().KDFa(ha, sessionValue, "CFB", s.nonceTPM.Buffer, s.nonceCaller.Buffer, keyIVBytes*8)
+	if err != nil {
+		return err
+	}
 	key, err := aes.NewCipher(keyIV[:keyBytes])
 	if err != nil {
 		return err
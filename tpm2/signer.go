@@ -0,0 +1,138 @@
+package tpm2
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Signer is a crypto.Signer backed by an unrestricted TPM signing key, for
+// use with packages such as crypto/x509 and crypto/tls. RSA keys sign with
+// RSASSA, or RSAPSS when given *rsa.PSSOptions; ECC keys sign with ECDSA.
+//
+// Restricted keys, such as AKs, can only sign digests the TPM computed
+// itself, so they can't be used as a Signer.
+type Signer struct {
+	tpm transport.TPM
+	key AuthHandle
+	pub crypto.PublicKey
+}
+
+// NewSigner returns a Signer for the loaded key. key.Auth authorizes its
+// use; key.Name is filled in from the TPM if it is empty.
+func NewSigner(t transport.TPM, key AuthHandle) (*Signer, error) {
+	rsp, err := ReadPublic{ObjectHandle: key.Handle}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key: %w", err)
+	}
+	pub, err := rsp.OutPublic.Contents()
+	if err != nil {
+		return nil, err
+	}
+	if !pub.ObjectAttributes.SignEncrypt || pub.ObjectAttributes.Restricted {
+		return nil, errors.New("key is not an unrestricted signing key")
+	}
+	cpub, err := cryptoPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	if len(key.Name.Buffer) == 0 {
+		key.Name = rsp.Name
+	}
+	return &Signer{
+		tpm: t,
+		key: key,
+		pub: cpub,
+	}, nil
+}
+
+// Public returns the public key of the signing key.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// signerHashAlg returns the TPM algorithm for a signing hash.
+func signerHashAlg(h crypto.Hash) (TPMIAlgHash, error) {
+	switch h {
+	case crypto.SHA1:
+		return TPMAlgSHA1, nil
+	case crypto.SHA256:
+		return TPMAlgSHA256, nil
+	case crypto.SHA384:
+		return TPMAlgSHA384, nil
+	case crypto.SHA512:
+		return TPMAlgSHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported signing hash %v", h)
+}
+
+// Sign signs digest with the TPM key. The signature is in the form expected
+// by crypto/rsa and crypto/ecdsa: PKCS #1 for RSA, ASN.1 DER for ECDSA.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hashAlg, err := signerHashAlg(opts.HashFunc())
+	if err != nil {
+		return nil, err
+	}
+	if len(digest) != opts.HashFunc().Size() {
+		return nil, fmt.Errorf("digest is %d bytes, want %d", len(digest), opts.HashFunc().Size())
+	}
+	var scheme TPMAlgID
+	switch s.pub.(type) {
+	case *rsa.PublicKey:
+		scheme = TPMAlgRSASSA
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			// The TPM chooses the salt length, which is the
+			// digest size on current TPMs.
+			if pss.SaltLength != rsa.PSSSaltLengthAuto && pss.SaltLength != rsa.PSSSaltLengthEqualsHash {
+				return nil, fmt.Errorf("unsupported PSS salt length %d", pss.SaltLength)
+			}
+			scheme = TPMAlgRSAPSS
+		}
+	default:
+		scheme = TPMAlgECDSA
+	}
+
+	rsp, err := Sign{
+		KeyHandle: s.key,
+		Digest:    TPM2BDigest{Buffer: digest},
+		InScheme: TPMTSigScheme{
+			Scheme:  scheme,
+			Details: NewTPMUSigScheme(scheme, &TPMSSchemeHash{HashAlg: hashAlg}),
+		},
+		Validation: NullTicket(),
+	}.Execute(s.tpm)
+	if err != nil {
+		return nil, err
+	}
+
+	switch scheme {
+	case TPMAlgRSASSA:
+		sig, err := rsp.Signature.Signature.RSASSA()
+		if err != nil {
+			return nil, err
+		}
+		return sig.Sig.Buffer, nil
+	case TPMAlgRSAPSS:
+		sig, err := rsp.Signature.Signature.RSAPSS()
+		if err != nil {
+			return nil, err
+		}
+		return sig.Sig.Buffer, nil
+	}
+	sig, err := rsp.Signature.Signature.ECDSA()
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{
+		new(big.Int).SetBytes(sig.SignatureR.Buffer),
+		new(big.Int).SetBytes(sig.SignatureS.Buffer),
+	})
+}
@@ -0,0 +1,14 @@
+//go:build linux
+
+package simple
+
+import (
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/linuxtpm"
+)
+
+// open opens the kernel resource manager, which flushes whatever a call
+// leaves loaded once it closes the connection.
+func open() (transport.TPMCloser, error) {
+	return linuxtpm.OpenResourceManaged()
+}
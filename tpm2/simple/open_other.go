@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+
+package simple
+
+import (
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+func open() (transport.TPMCloser, error) {
+	return nil, ErrNoTPM
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package simple
+
+import (
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/windowstpm"
+)
+
+func open() (transport.TPMCloser, error) {
+	return windowstpm.Open()
+}
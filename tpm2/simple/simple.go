@@ -0,0 +1,287 @@
+// Package simple covers the most common uses of a TPM in a few calls:
+// reading random bytes, reading and extending PCRs, sealing data to PCRs and
+// quoting PCRs. It picks safe defaults, opens the TPM and sets up, flushes and
+// ends whatever keys and sessions each operation needs, so callers need not
+// know about any of them.
+//
+// The package-level functions open the platform's TPM for each call, through
+// the kernel resource manager on Linux and TBS on Windows. To reuse a
+// connection, or to use another transport such as a simulator, call the
+// methods of a TPM from New instead.
+//
+// Anything else, or any other choice of algorithms, hierarchies or policies,
+// needs the tpm2 package.
+package simple
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/sealed"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrNoTPM is returned when there is no default TPM on this platform.
+var ErrNoTPM = errors.New("no default TPM on this platform")
+
+// parent returns the storage key data is sealed under: the TCG reference
+// ECC SRK in the owner hierarchy, with hash as its name algorithm. It is
+// recreated for each operation, so nothing has to be provisioned first.
+func parent(hash tpm2.TPMIAlgHash) sealed.Parent {
+	srk := tpm2.ECCSRKTemplate
+	srk.NameAlg = hash
+	return sealed.PrimaryParent(tpm2.TPMRHOwner, srk)
+}
+
+// akTemplate returns the template of the attestation key: a restricted ECDSA
+// P-256 key in the owner hierarchy that uses hash for its name and
+// signatures. As it is a primary key, the same key is recreated for each
+// quote, until the owner hierarchy is cleared.
+func akTemplate(hash tpm2.TPMIAlgHash) tpm2.TPMTPublic {
+	return tpm2.TPMTPublic{
+		Type:    tpm2.TPMAlgECC,
+		NameAlg: hash,
+		ObjectAttributes: tpm2.TPMAObject{
+			FixedTPM:            true,
+			FixedParent:         true,
+			SensitiveDataOrigin: true,
+			UserWithAuth:        true,
+			NoDA:                true,
+			Restricted:          true,
+			SignEncrypt:         true,
+		},
+		Parameters: tpm2.NewTPMUPublicParms(
+			tpm2.TPMAlgECC,
+			&tpm2.TPMSECCParms{
+				Scheme: tpm2.TPMTECCScheme{
+					Scheme: tpm2.TPMAlgECDSA,
+					Details: tpm2.NewTPMUAsymScheme(
+						tpm2.TPMAlgECDSA,
+						&tpm2.TPMSSigSchemeECDSA{HashAlg: hash},
+					),
+				},
+				CurveID: tpm2.TPMECCNistP256,
+			},
+		),
+	}
+}
+
+// TPM is a connection to a TPM.
+type TPM struct {
+	t transport.TPM
+	// hash is the hash algorithm negotiated with the TPM, or zero until
+	// hashAlg is first called.
+	hash tpm2.TPMIAlgHash
+}
+
+// New returns a TPM that sends commands through t.
+func New(t transport.TPM) *TPM {
+	return &TPM{t: t}
+}
+
+// Random returns n random bytes generated by the TPM.
+func (t *TPM) Random(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(tpm2.RandReader(t.t), buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// hashAlg returns the hash algorithm used for PCRs, keys and signatures:
+// SHA-256 if the TPM implements it, or else the TPM's best alternative, as
+// chosen by tpm2.NegotiateHashAlg.
+func (t *TPM) hashAlg() (tpm2.TPMIAlgHash, error) {
+	if t.hash == 0 {
+		hash, err := tpm2.NegotiateHashAlg(t.t)
+		if err != nil {
+			return 0, err
+		}
+		t.hash = hash
+	}
+	return t.hash, nil
+}
+
+// selection returns a selection of pcrs in the bank of hash.
+func selection(hash tpm2.TPMIAlgHash, pcrs []uint) tpm2.TPMLPCRSelection {
+	return tpm2.TPMLPCRSelection{
+		PCRSelections: []tpm2.TPMSPCRSelection{{
+			Hash:      hash,
+			PCRSelect: tpm2.PCClientCompatible.PCRs(pcrs...),
+		}},
+	}
+}
+
+// PCRRead returns the values of the given PCRs in the bank of the TPM's
+// hash algorithm, SHA-256 unless the TPM doesn't implement it.
+func (t *TPM) PCRRead(pcrs ...uint) (map[uint][]byte, error) {
+	hash, err := t.hashAlg()
+	if err != nil {
+		return nil, err
+	}
+	vals, err := tpm2.ReadPCRs(t.t, selection(hash, pcrs))
+	if err != nil {
+		return nil, err
+	}
+	out := vals[hash]
+	for _, pcr := range pcrs {
+		if out[pcr] == nil {
+			return nil, fmt.Errorf("TPM did not return PCR %d", pcr)
+		}
+	}
+	return out, nil
+}
+
+// PCRExtend measures data into a PCR, in every active bank.
+func (t *TPM) PCRExtend(pcr uint, data []byte) error {
+	_, err := tpm2.ExtendPCR(t.t, tpm2.TPMHandle(pcr), data)
+	return err
+}
+
+// SealToPCRs seals data so that UnsealFromPCRs returns it only on the same
+// TPM, and only while the given PCRs have their current values in the bank
+// read by PCRRead. With no PCRs, the data is only bound to the TPM. The
+// returned blob is not secret and can be stored anywhere.
+func (t *TPM) SealToPCRs(data []byte, pcrs ...uint) ([]byte, error) {
+	hash, err := t.hashAlg()
+	if err != nil {
+		return nil, err
+	}
+	var sel *tpm2.TPMLPCRSelection
+	if len(pcrs) != 0 {
+		s := selection(hash, pcrs)
+		sel = &s
+	}
+	env, err := sealed.Seal(t.t, parent(hash), nil, data, sel)
+	if err != nil {
+		return nil, err
+	}
+	return env.Marshal()
+}
+
+// UnsealFromPCRs returns the data sealed by SealToPCRs.
+func (t *TPM) UnsealFromPCRs(blob []byte) ([]byte, error) {
+	env, err := sealed.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	return env.Unseal(t.t, nil)
+}
+
+// Quote is a TPM's signed statement of the values of some PCRs.
+type Quote struct {
+	// AK is the marshalled TPM2B_PUBLIC of the attestation key that signed
+	// the quote. A verifier must check that it belongs to the expected
+	// TPM, for example by enrolling it with the tpm2/enroll package.
+	AK []byte
+	// Quoted is the marshalled TPMS_ATTEST that was signed.
+	Quoted []byte
+	// Signature is the marshalled TPMT_SIGNATURE over Quoted.
+	Signature []byte
+}
+
+// QuoteWithAK quotes the given PCRs in every active bank with the TPM's
+// attestation key, including nonce in the quote.
+func (t *TPM) QuoteWithAK(nonce []byte, pcrs ...uint) (*Quote, error) {
+	hash, err := t.hashAlg()
+	if err != nil {
+		return nil, err
+	}
+	ak, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(akTemplate(hash)),
+	}.Execute(t.t)
+	if err != nil {
+		return nil, fmt.Errorf("creating attestation key: %w", err)
+	}
+	defer tpm2.FlushContext{FlushHandle: ak.ObjectHandle}.Execute(t.t)
+
+	rsp, err := tpm2.QuoteAllBanks(t.t, tpm2.NamedHandle{Handle: ak.ObjectHandle, Name: ak.Name}, nonce, pcrs)
+	if err != nil {
+		return nil, err
+	}
+	return &Quote{
+		AK:        tpm2.Marshal(ak.OutPublic),
+		Quoted:    rsp.Quoted.Bytes(),
+		Signature: tpm2.Marshal(rsp.Signature),
+	}, nil
+}
+
+// Verify checks that the quote is signed by its AK and includes nonce, and
+// returns its contents. It does not check that the AK can be trusted.
+func (q *Quote) Verify(nonce []byte) (*tpm2.TPMSAttest, error) {
+	pub, err := tpm2.Unmarshal[tpm2.TPM2BPublic](q.AK)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AK: %w", err)
+	}
+	ak, err := pub.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("invalid AK: %w", err)
+	}
+	sig, err := tpm2.Unmarshal[tpm2.TPMTSignature](q.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	quoted := tpm2.BytesAs2B[tpm2.TPMSAttest](q.Quoted)
+	attest, err := tpm2.VerifyAttestation(ak, &quoted, sig)
+	if err != nil {
+		return nil, err
+	}
+	if attest.Type != tpm2.TPMSTAttestQuote {
+		return nil, errors.New("attestation is not a quote")
+	}
+	if !bytes.Equal(attest.ExtraData.Buffer, nonce) {
+		return nil, errors.New("quote does not include the nonce")
+	}
+	return attest, nil
+}
+
+// openDefault opens the platform's TPM. Tests replace it.
+var openDefault = open
+
+// with runs f on the platform's TPM.
+func with[T any](f func(*TPM) (T, error)) (T, error) {
+	t, err := openDefault()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer t.Close()
+	return f(New(t))
+}
+
+// Random returns n random bytes generated by the TPM.
+func Random(n int) ([]byte, error) {
+	return with(func(t *TPM) ([]byte, error) { return t.Random(n) })
+}
+
+// PCRRead returns the values of the given PCRs. See TPM.PCRRead.
+func PCRRead(pcrs ...uint) (map[uint][]byte, error) {
+	return with(func(t *TPM) (map[uint][]byte, error) { return t.PCRRead(pcrs...) })
+}
+
+// PCRExtend measures data into a PCR, in every active bank.
+func PCRExtend(pcr uint, data []byte) error {
+	_, err := with(func(t *TPM) (struct{}, error) { return struct{}{}, t.PCRExtend(pcr, data) })
+	return err
+}
+
+// SealToPCRs seals data to the current values of the given PCRs. See
+// TPM.SealToPCRs.
+func SealToPCRs(data []byte, pcrs ...uint) ([]byte, error) {
+	return with(func(t *TPM) ([]byte, error) { return t.SealToPCRs(data, pcrs...) })
+}
+
+// UnsealFromPCRs returns the data sealed by SealToPCRs.
+func UnsealFromPCRs(blob []byte) ([]byte, error) {
+	return with(func(t *TPM) ([]byte, error) { return t.UnsealFromPCRs(blob) })
+}
+
+// QuoteWithAK quotes the given PCRs with the TPM's attestation key. See
+// TPM.QuoteWithAK.
+func QuoteWithAK(nonce []byte, pcrs ...uint) (*Quote, error) {
+	return with(func(t *TPM) (*Quote, error) { return t.QuoteWithAK(nonce, pcrs...) })
+}
@@ -0,0 +1,140 @@
+package simple
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// shared is a connection whose Close leaves the TPM open, so that the
+// package-level functions all talk to the same simulator.
+type shared struct {
+	transport.TPM
+}
+
+func (shared) Close() error { return nil }
+
+func TestSimple(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+	openDefault = func() (transport.TPMCloser, error) { return shared{thetpm}, nil }
+	defer func() { openDefault = open }()
+
+	random, err := Random(100)
+	if err != nil {
+		t.Fatalf("Random: %v", err)
+	}
+	if len(random) != 100 {
+		t.Errorf("Random(100) returned %d bytes", len(random))
+	}
+
+	before, err := PCRRead(16)
+	if err != nil {
+		t.Fatalf("PCRRead: %v", err)
+	}
+	blob, err := SealToPCRs([]byte("secret"), 16)
+	if err != nil {
+		t.Fatalf("SealToPCRs: %v", err)
+	}
+	unbound, err := SealToPCRs([]byte("unbound"))
+	if err != nil {
+		t.Fatalf("SealToPCRs: %v", err)
+	}
+	got, err := UnsealFromPCRs(blob)
+	if err != nil {
+		t.Fatalf("UnsealFromPCRs: %v", err)
+	}
+	if string(got) != "secret" {
+		t.Errorf("UnsealFromPCRs() = %q, want %q", got, "secret")
+	}
+
+	if err := PCRExtend(16, []byte("measurement")); err != nil {
+		t.Fatalf("PCRExtend: %v", err)
+	}
+	after, err := PCRRead(16)
+	if err != nil {
+		t.Fatalf("PCRRead: %v", err)
+	}
+	if bytes.Equal(before[16], after[16]) {
+		t.Errorf("PCR 16 is still %x after PCRExtend", after[16])
+	}
+	if _, err := UnsealFromPCRs(blob); err == nil {
+		t.Error("UnsealFromPCRs succeeded after the PCR changed")
+	}
+	if got, err := UnsealFromPCRs(unbound); err != nil || string(got) != "unbound" {
+		t.Errorf("UnsealFromPCRs() = %q, %v, want %q", got, err, "unbound")
+	}
+
+	nonce := []byte("nonce")
+	quote, err := QuoteWithAK(nonce, 0, 16)
+	if err != nil {
+		t.Fatalf("QuoteWithAK: %v", err)
+	}
+	if _, err := quote.Verify(nonce); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if _, err := quote.Verify([]byte("other")); err == nil {
+		t.Error("Verify succeeded with the wrong nonce")
+	}
+	again, err := QuoteWithAK(nonce, 16)
+	if err != nil {
+		t.Fatalf("QuoteWithAK: %v", err)
+	}
+	if !bytes.Equal(again.AK, quote.AK) {
+		t.Error("QuoteWithAK used a different AK the second time")
+	}
+}
+
+func TestHashAlg(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	if hash, err := New(thetpm).hashAlg(); err != nil || hash != tpm2.TPMAlgSHA256 {
+		t.Errorf("hashAlg() = %v, %v, want %v", hash, err, tpm2.TPMAlgSHA256)
+	}
+
+	// PCRs, sealing and quotes follow the hash algorithm, as on a TPM
+	// without SHA-256.
+	s := &TPM{t: thetpm, hash: tpm2.TPMAlgSHA384}
+	vals, err := s.PCRRead(16)
+	if err != nil {
+		t.Fatalf("PCRRead: %v", err)
+	}
+	if len(vals[16]) != 48 {
+		t.Errorf("PCRRead() returned a %d-byte value, want a SHA-384 one", len(vals[16]))
+	}
+	blob, err := s.SealToPCRs([]byte("secret"), 16)
+	if err != nil {
+		t.Fatalf("SealToPCRs: %v", err)
+	}
+	if got, err := s.UnsealFromPCRs(blob); err != nil || string(got) != "secret" {
+		t.Errorf("UnsealFromPCRs() = %q, %v, want %q", got, err, "secret")
+	}
+	quote, err := s.QuoteWithAK([]byte("nonce"), 16)
+	if err != nil {
+		t.Fatalf("QuoteWithAK: %v", err)
+	}
+	if _, err := quote.Verify([]byte("nonce")); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	pub, err := tpm2.Unmarshal[tpm2.TPM2BPublic](quote.AK)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ak, err := pub.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if ak.NameAlg != tpm2.TPMAlgSHA384 {
+		t.Errorf("AK name algorithm = %v, want %v", ak.NameAlg, tpm2.TPMAlgSHA384)
+	}
+}
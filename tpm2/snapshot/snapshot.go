@@ -0,0 +1,245 @@
+// Package snapshot captures the logical state of a TPM (persistent objects,
+// NV indexes, PCR values and properties) and compares snapshots, so that
+// provisioning tools can check exactly what they changed.
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Entity is the public state of a persistent object or NV index.
+type Entity struct {
+	// Name is the TPM Name of the entity. The Name of an NV index changes
+	// when it is first written.
+	Name []byte
+	// Public is the marshalled TPMT_PUBLIC or TPMS_NV_PUBLIC.
+	Public []byte
+}
+
+// Snapshot is the logical state of a TPM at a point in time.
+type Snapshot struct {
+	Persistent map[tpm2.TPMHandle]Entity
+	NV         map[tpm2.TPMHandle]Entity
+	PCRs       tpm2.PCRValues
+	Properties map[tpm2.TPMPT]uint32
+}
+
+// Take captures a snapshot of the TPM.
+func Take(t transport.TPM) (*Snapshot, error) {
+	s := &Snapshot{
+		Persistent: make(map[tpm2.TPMHandle]Entity),
+		NV:         make(map[tpm2.TPMHandle]Entity),
+	}
+	var err error
+	if s.Properties, err = properties(t); err != nil {
+		return nil, fmt.Errorf("reading properties: %w", err)
+	}
+
+	handles, err := tpm2.GetHandles(t, tpm2.TPMHTPersistent)
+	if err != nil {
+		return nil, fmt.Errorf("listing persistent handles: %w", err)
+	}
+	for _, h := range handles {
+		rsp, err := tpm2.ReadPublic{ObjectHandle: h}.Execute(t)
+		if err != nil {
+			return nil, fmt.Errorf("reading public area of 0x%08x: %w", uint32(h), err)
+		}
+		s.Persistent[h] = Entity{Name: rsp.Name.Buffer, Public: rsp.OutPublic.Bytes()}
+	}
+
+	handles, err = tpm2.GetHandles(t, tpm2.TPMHTNVIndex)
+	if err != nil {
+		return nil, fmt.Errorf("listing NV indexes: %w", err)
+	}
+	for _, h := range handles {
+		rsp, err := tpm2.NVReadPublic{NVIndex: h}.Execute(t)
+		if err != nil {
+			return nil, fmt.Errorf("reading public area of NV index 0x%08x: %w", uint32(h), err)
+		}
+		s.NV[h] = Entity{Name: rsp.NVName.Buffer, Public: rsp.NVPublic.Bytes()}
+	}
+
+	if s.PCRs, err = pcrs(t, int(s.Properties[tpm2.TPMPTPCRCount])); err != nil {
+		return nil, fmt.Errorf("reading PCRs: %w", err)
+	}
+	return s, nil
+}
+
+// properties reads all fixed and variable TPM properties. The TPM doesn't
+// return properties from more than one group at a time, so each group is
+// read separately.
+func properties(t transport.TPM) (map[tpm2.TPMPT]uint32, error) {
+	props := make(map[tpm2.TPMPT]uint32)
+	for _, group := range []tpm2.TPMPT{tpm2.TPMPTFamilyIndicator, tpm2.TPMPTPermanent} {
+		prop := uint32(group)
+		for {
+			rsp, err := tpm2.GetCapability{
+				Capability:    tpm2.TPMCapTPMProperties,
+				Property:      prop,
+				PropertyCount: 128,
+			}.Execute(t)
+			if err != nil {
+				return nil, err
+			}
+			ps, err := rsp.CapabilityData.Data.TPMProperties()
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range ps.TPMProperty {
+				props[p.Property] = p.Value
+			}
+			if !rsp.MoreData || len(ps.TPMProperty) == 0 {
+				break
+			}
+			prop = uint32(ps.TPMProperty[len(ps.TPMProperty)-1].Property) + 1
+		}
+	}
+	return props, nil
+}
+
+// pcrs reads the first count PCRs of every active bank.
+func pcrs(t transport.TPM, count int) (tpm2.PCRValues, error) {
+	banks, err := tpm2.ActivePCRBanks(t)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]uint, count)
+	for i := range all {
+		all[i] = uint(i)
+	}
+	var sel tpm2.TPMLPCRSelection
+	for _, bank := range banks {
+		sel.PCRSelections = append(sel.PCRSelections, tpm2.TPMSPCRSelection{
+			Hash:      bank,
+			PCRSelect: tpm2.PCClientCompatible.PCRs(all...),
+		})
+	}
+	return tpm2.ReadPCRs(t, sel)
+}
+
+// ChangeKind describes how an item differs between two snapshots.
+type ChangeKind int
+
+// The kinds of change.
+const (
+	Added ChangeKind = iota
+	Removed
+	Modified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is a single difference between two snapshots.
+type Change struct {
+	Kind ChangeKind
+	// Item identifies what changed, e.g. "persistent 0x81000001",
+	// "nv 0x01800001", "pcr sha256:7" or "property 0x00000201".
+	Item string
+	// Before and After describe the item in each snapshot: a Name, PCR
+	// value or property value. One of them is empty for Added and Removed.
+	Before, After string
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s: %s", c.Item, c.After)
+	case Removed:
+		return fmt.Sprintf("- %s: %s", c.Item, c.Before)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Item, c.Before, c.After)
+}
+
+// Diff returns the changes from a to b: those to persistent objects, then NV
+// indexes, PCRs and properties, each in numeric order.
+func Diff(a, b *Snapshot) []Change {
+	var changes []Change
+	diffEntities(&changes, "persistent", a.Persistent, b.Persistent)
+	diffEntities(&changes, "nv", a.NV, b.NV)
+	diffPCRs(&changes, a.PCRs, b.PCRs)
+	diffMap(&changes, a.Properties, b.Properties,
+		func(p tpm2.TPMPT) string { return fmt.Sprintf("property 0x%08x", uint32(p)) },
+		func(v uint32) string { return fmt.Sprintf("0x%08x", v) },
+		func(x, y uint32) bool { return x == y },
+		func(x, y tpm2.TPMPT) bool { return x < y })
+	return changes
+}
+
+// diffMap appends the differences between two maps, in the order of their
+// keys given by less.
+func diffMap[K comparable, V any](changes *[]Change, a, b map[K]V, item func(K) string, desc func(V) string, equal func(V, V) bool, less func(K, K) bool) {
+	keys := make([]K, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+
+	for _, k := range keys {
+		va, inA := a[k]
+		vb, inB := b[k]
+		switch {
+		case !inB:
+			*changes = append(*changes, Change{Kind: Removed, Item: item(k), Before: desc(va)})
+		case !inA:
+			*changes = append(*changes, Change{Kind: Added, Item: item(k), After: desc(vb)})
+		case !equal(va, vb):
+			*changes = append(*changes, Change{Kind: Modified, Item: item(k), Before: desc(va), After: desc(vb)})
+		}
+	}
+}
+
+func diffEntities(changes *[]Change, kind string, a, b map[tpm2.TPMHandle]Entity) {
+	diffMap(changes, a, b,
+		func(h tpm2.TPMHandle) string { return fmt.Sprintf("%s 0x%08x", kind, uint32(h)) },
+		func(e Entity) string { return fmt.Sprintf("%x", e.Name) },
+		func(x, y Entity) bool { return bytes.Equal(x.Name, y.Name) && bytes.Equal(x.Public, y.Public) },
+		func(x, y tpm2.TPMHandle) bool { return x < y })
+}
+
+// pcrKey identifies a PCR in a bank.
+type pcrKey struct {
+	alg tpm2.TPMIAlgHash
+	pcr uint
+}
+
+func diffPCRs(changes *[]Change, a, b tpm2.PCRValues) {
+	flatten := func(vals tpm2.PCRValues) map[pcrKey][]byte {
+		flat := make(map[pcrKey][]byte)
+		for alg, bank := range vals {
+			for pcr, v := range bank {
+				flat[pcrKey{alg, pcr}] = v
+			}
+		}
+		return flat
+	}
+	diffMap(changes, flatten(a), flatten(b),
+		func(k pcrKey) string { return fmt.Sprintf("pcr %s:%d", tpm2.PCRBankName(k.alg), k.pcr) },
+		func(v []byte) string { return fmt.Sprintf("%x", v) },
+		bytes.Equal,
+		func(x, y pcrKey) bool {
+			if x.alg != y.alg {
+				return x.alg < y.alg
+			}
+			return x.pcr < y.pcr
+		})
+}
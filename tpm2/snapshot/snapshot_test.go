@@ -0,0 +1,120 @@
+package snapshot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestDiff(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	before, err := Take(thetpm)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if len(before.PCRs[tpm2.TPMAlgSHA256]) != 24 {
+		t.Errorf("snapshot has %d SHA-256 PCRs, want 24", len(before.PCRs[tpm2.TPMAlgSHA256]))
+	}
+	if changes := Diff(before, before); len(changes) != 0 {
+		t.Errorf("Diff(s, s) = %v, want no changes", changes)
+	}
+
+	// Extend a PCR, persist a key and define an NV index.
+	if _, err := tpm2.ExtendPCR(thetpm, tpm2.TPMHandle(16), []byte("event"), tpm2.ExtendBanks(tpm2.TPMAlgSHA256)); err != nil {
+		t.Fatalf("ExtendPCR: %v", err)
+	}
+	srk, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer tpm2.FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+	if _, err := (tpm2.EvictControl{
+		Auth:             tpm2.TPMRHOwner,
+		ObjectHandle:     tpm2.NamedHandle{Handle: srk.ObjectHandle, Name: srk.Name},
+		PersistentHandle: 0x81000001,
+	}).Execute(thetpm); err != nil {
+		t.Fatalf("EvictControl: %v", err)
+	}
+	if _, err := (tpm2.NVDefineSpace{
+		AuthHandle: tpm2.TPMRHOwner,
+		PublicInfo: tpm2.New2B(tpm2.TPMSNVPublic{
+			NVIndex: 0x01800001,
+			NameAlg: tpm2.TPMAlgSHA256,
+			Attributes: tpm2.TPMANV{
+				OwnerWrite: true,
+				AuthRead:   true,
+				NT:         tpm2.TPMNTOrdinary,
+			},
+		}),
+	}).Execute(thetpm); err != nil {
+		t.Fatalf("NVDefineSpace: %v", err)
+	}
+
+	after, err := Take(thetpm)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	got := make(map[string]ChangeKind)
+	for _, c := range Diff(before, after) {
+		t.Log(c)
+		got[c.Item] = c.Kind
+	}
+	for item, kind := range map[string]ChangeKind{
+		"pcr sha256:16":         Modified,
+		"persistent 0x81000001": Added,
+		"nv 0x01800001":         Added,
+	} {
+		if got[item] != kind {
+			t.Errorf("Diff() change for %q = %v, want %v", item, got[item], kind)
+		}
+	}
+	if _, ok := got["pcr sha1:16"]; ok {
+		t.Error("Diff() reported a change to an unextended bank")
+	}
+
+	back := Diff(after, before)
+	for _, c := range back {
+		if c.Item == "persistent 0x81000001" && c.Kind != Removed {
+			t.Errorf("reverse Diff() change for %q = %v, want %v", c.Item, c.Kind, Removed)
+		}
+	}
+}
+
+func TestDiffOrder(t *testing.T) {
+	entity := Entity{Name: []byte{1}}
+	a := &Snapshot{
+		Persistent: map[tpm2.TPMHandle]Entity{0x81000010: entity},
+		PCRs:       tpm2.PCRValues{tpm2.TPMAlgSHA256: {2: {0}, 10: {0}}},
+	}
+	b := &Snapshot{
+		Persistent: map[tpm2.TPMHandle]Entity{0x81000002: entity},
+		NV:         map[tpm2.TPMHandle]Entity{0x01800001: entity},
+		PCRs:       tpm2.PCRValues{tpm2.TPMAlgSHA256: {2: {1}, 10: {1}}},
+		Properties: map[tpm2.TPMPT]uint32{tpm2.TPMPTPermanent: 1},
+	}
+	var got []string
+	for _, c := range Diff(a, b) {
+		got = append(got, c.Item)
+	}
+	want := []string{
+		"persistent 0x81000002",
+		"persistent 0x81000010",
+		"nv 0x01800001",
+		"pcr sha256:2",
+		"pcr sha256:10",
+		"property 0x00000200",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Diff() items = %q, want %q", got, want)
+	}
+}
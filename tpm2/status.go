@@ -0,0 +1,172 @@
+package tpm2
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// HierarchyStatus describes one hierarchy as reported by TPMA_PERMANENT and
+// TPMA_STARTUP_CLEAR.
+type HierarchyStatus struct {
+	// Enabled reports whether the hierarchy can be used.
+	Enabled bool
+	// AuthSet reports whether the hierarchy's authorization value is
+	// non-empty. The platform hierarchy's is not reported by the TPM, so
+	// it is always false.
+	AuthSet bool
+}
+
+// LockoutStatus describes the dictionary attack protection state.
+type LockoutStatus struct {
+	// InLockout reports whether the TPM is refusing DA-protected
+	// authorizations.
+	InLockout bool
+	// Counter is the current number of authorization failures, and
+	// MaxTries the number that triggers lockout.
+	Counter  uint32
+	MaxTries uint32
+	// Interval is the number of seconds after which one failure is
+	// forgotten, and Recovery the number of seconds after a failed
+	// lockoutAuth before lockoutAuth may be used again.
+	Interval uint32
+	Recovery uint32
+}
+
+// Status is a snapshot of a TPM's ownership and resource state, for health
+// checks and preflight checks before provisioning.
+type Status struct {
+	Platform    HierarchyStatus
+	Owner       HierarchyStatus
+	Endorsement HierarchyStatus
+	Lockout     HierarchyStatus
+	// DisableClear reports whether TPM2_Clear is disabled.
+	DisableClear bool
+	// Orderly reports whether the TPM was shut down with
+	// TPM2_Shutdown(CLEAR) or TPM2_Shutdown(STATE) before the last
+	// startup.
+	Orderly bool
+	// DA is the dictionary attack protection state.
+	DA LockoutStatus
+	// PersistentHandles lists the persistent objects.
+	PersistentHandles []TPMHandle
+	// PersistentAvail is the TPM's estimate of how many more persistent
+	// objects fit in NV memory. TPMs don't report free NV in bytes, so
+	// this is the best available measure of NV space remaining.
+	PersistentAvail uint32
+	// NVIndices is the number of defined NV indices.
+	NVIndices uint32
+	// NVCountersAvail is the number of additional orderly counter indices
+	// that can be defined.
+	NVCountersAvail uint32
+	// PCRBanks lists the active PCR banks.
+	PCRBanks []TPMIAlgHash
+}
+
+// GetStatus reads the TPM's hierarchy, lockout, NV and PCR state in one call.
+// It only reads capabilities, so it needs no authorization.
+func GetStatus(t transport.TPM) (*Status, error) {
+	props, err := getProperties(t, TPMPTPermanent, TPMPTLockoutRecovery)
+	if err != nil {
+		return nil, err
+	}
+	var s Status
+	var seen bool
+	for _, p := range props {
+		switch p.Property {
+		case TPMPTPermanent:
+			// TPMA_PERMANENT
+			s.Owner.AuthSet = p.Value&(1<<0) != 0
+			s.Endorsement.AuthSet = p.Value&(1<<1) != 0
+			s.Lockout.AuthSet = p.Value&(1<<2) != 0
+			s.DisableClear = p.Value&(1<<8) != 0
+			s.DA.InLockout = p.Value&(1<<9) != 0
+			seen = true
+		case TPMPTStartupClear:
+			// TPMA_STARTUP_CLEAR
+			s.Platform.Enabled = p.Value&(1<<0) != 0
+			s.Owner.Enabled = p.Value&(1<<1) != 0
+			s.Endorsement.Enabled = p.Value&(1<<2) != 0
+			s.Orderly = p.Value&(1<<31) != 0
+		case TPMPTHRNVIndex:
+			s.NVIndices = p.Value
+		case TPMPTHRPersistentAvail:
+			s.PersistentAvail = p.Value
+		case TPMPTNVCountersAvail:
+			s.NVCountersAvail = p.Value
+		case TPMPTLockoutCounter:
+			s.DA.Counter = p.Value
+		case TPMPTMaxAuthFail:
+			s.DA.MaxTries = p.Value
+		case TPMPTLockoutInterval:
+			s.DA.Interval = p.Value
+		case TPMPTLockoutRecovery:
+			s.DA.Recovery = p.Value
+		}
+	}
+	if !seen {
+		return nil, fmt.Errorf("TPM did not report TPM_PT_PERMANENT")
+	}
+	// The lockout hierarchy can't be disabled.
+	s.Lockout.Enabled = true
+
+	if s.PersistentHandles, err = GetHandles(t, TPMHTPersistent); err != nil {
+		return nil, err
+	}
+	if s.PCRBanks, err = ActivePCRBanks(t); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Problems returns a human-readable list of conditions in s that are likely
+// to make provisioning or key creation fail. It is empty for a healthy TPM.
+func (s *Status) Problems() []string {
+	var problems []string
+	if !s.Owner.Enabled {
+		problems = append(problems, "owner hierarchy is disabled")
+	}
+	if !s.Endorsement.Enabled {
+		problems = append(problems, "endorsement hierarchy is disabled")
+	}
+	if s.DA.InLockout {
+		problems = append(problems, "TPM is in dictionary attack lockout")
+	}
+	if s.PersistentAvail == 0 {
+		problems = append(problems, "no NV space for persistent objects")
+	}
+	if len(s.PCRBanks) == 0 {
+		problems = append(problems, "no PCR banks are active")
+	}
+	return problems
+}
+
+// GetLockoutStatus reads only the dictionary attack protection state, which
+// is cheaper than GetStatus when it is read often.
+func GetLockoutStatus(t transport.TPM) (*LockoutStatus, error) {
+	props, err := getProperties(t, TPMPTPermanent, TPMPTLockoutRecovery)
+	if err != nil {
+		return nil, err
+	}
+	var s LockoutStatus
+	var seen bool
+	for _, p := range props {
+		switch p.Property {
+		case TPMPTPermanent:
+			s.InLockout = p.Value&(1<<9) != 0
+			seen = true
+		case TPMPTLockoutCounter:
+			s.Counter = p.Value
+		case TPMPTMaxAuthFail:
+			s.MaxTries = p.Value
+		case TPMPTLockoutInterval:
+			s.Interval = p.Value
+		case TPMPTLockoutRecovery:
+			s.Recovery = p.Value
+		}
+	}
+	if !seen {
+		return nil, fmt.Errorf("TPM did not report TPM_PT_PERMANENT")
+	}
+	return &s, nil
+}
@@ -0,0 +1,98 @@
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrEmptyHierarchyAuth is returned by commands executed on a Strict
+// transport that would authorize the platform, owner or lockout hierarchy
+// with an empty authorization value.
+var ErrEmptyHierarchyAuth = errors.New("empty authorization value for a privileged hierarchy")
+
+// strictTPM is a transport on which Execute refuses empty hierarchy auth.
+type strictTPM struct {
+	tpm transport.TPM
+}
+
+// Strict returns a transport that sends commands to t, except that commands
+// executed on it fail with ErrEmptyHierarchyAuth, without reaching the TPM,
+// if they would use the platform, owner or lockout hierarchy with an empty
+// authorization value. A TPM whose hierarchies have no authorization has
+// not been provisioned, and code that works against it in testing would
+// fail in production; Strict catches this early. Commands that give a
+// hierarchy as a plain TPMHandle use an empty password, and so fail too.
+//
+// The check is made by Execute, which finds the returned transport beneath
+// any wrappers that implement transport.Wrapper, as those of this package
+// and the transport package do. Policy sessions are not checked, as a
+// hierarchy's policy does not depend on its authorization value.
+func Strict(t transport.TPM) transport.TPM {
+	return &strictTPM{tpm: t}
+}
+
+// Send implements transport.TPM.
+func (s *strictTPM) Send(cmd []byte) ([]byte, error) {
+	return s.tpm.Send(cmd)
+}
+
+// Unwrap implements transport.Wrapper.
+func (s *strictTPM) Unwrap() transport.TPM {
+	return s.tpm
+}
+
+// Close closes the underlying transport, if it can be closed.
+func (s *strictTPM) Close() error {
+	if c, ok := s.tpm.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// checkHierarchyAuth returns ErrEmptyHierarchyAuth if any of the
+// authorization sessions sess of cmd authorizes a privileged hierarchy with
+// an empty authorization value.
+func checkHierarchyAuth[R any](cmd Command[R, *R], sess []Session) error {
+	for i, member := range taggedMembers(reflect.ValueOf(cmd), "auth", false) {
+		h, err := asHandle(member)
+		if err != nil {
+			return err
+		}
+		var hierarchy string
+		switch h.HandleValue() {
+		case uint32(TPMRHPlatform):
+			hierarchy = "platform"
+		case uint32(TPMRHOwner):
+			hierarchy = "owner"
+		case uint32(TPMRHLockout):
+			hierarchy = "lockout"
+		default:
+			continue
+		}
+		if emptyAuth(sess[i], TPMHandle(h.HandleValue())) {
+			return fmt.Errorf("%w: %s hierarchy", ErrEmptyHierarchyAuth, hierarchy)
+		}
+	}
+	return nil
+}
+
+// emptyAuth reports whether s authorizes h with an empty authorization
+// value.
+func emptyAuth(s Session, h TPMHandle) bool {
+	switch s := s.(type) {
+	case *pwSession:
+		return len(s.auth) == 0
+	case *hmacSession:
+		// A session bound to h proves knowledge of its authorization
+		// value through the session key instead.
+		if s.bindHandle == h {
+			return len(s.bindAuth) == 0
+		}
+		return len(s.auth) == 0
+	}
+	return false
+}
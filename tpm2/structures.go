@@ -7,6 +7,7 @@ import (
 	"crypto/ecdh"
 	"crypto/elliptic"
 	"encoding/binary"
+	"io"
 	"reflect"
 
 	// Register the relevant hash implementations.
@@ -14,6 +15,8 @@ import (
 	_ "crypto/sha256"
 	_ "crypto/sha512"
 	"fmt"
+
+	"github.com/google/go-tpm/tpm2/handles"
 )
 
 // TPMCmdHeader is the header structure in front of any TPM command.
@@ -122,13 +125,12 @@ func (h TPMHandle) HandleValue() uint32 {
 // only PCR, session, and permanent values have known constant Names.
 // See definition in part 1: Architecture, section 16.
 func (h TPMHandle) KnownName() *TPM2BName {
-	switch (TPMHT)(h >> 24) {
-	case TPMHTPCR, TPMHTHMACSession, TPMHTPolicySession, TPMHTPermanent:
-		result := make([]byte, 4)
-		binary.BigEndian.PutUint32(result, h.HandleValue())
-		return &TPM2BName{Buffer: result}
+	if !handles.HasKnownName(h) {
+		return nil
 	}
-	return nil
+	result := make([]byte, 4)
+	binary.BigEndian.PutUint32(result, h.HandleValue())
+	return &TPM2BName{Buffer: result}
 }
 
 // TPMAAlgorithm represents a TPMA_ALGORITHM.
@@ -496,7 +498,6 @@ type TPMSEmpty struct {
 // TPMTHA represents a TPMT_HA.
 // See definition in Part 2: Structures, section 10.3.2.
 type TPMTHA struct {
-	marshalByReflection
 	// selector of the hash contained in the digest that implies the size of the digest
 	HashAlg TPMIAlgHash `gotpm:"nullable"`
 	// the digest data
@@ -504,6 +505,46 @@ type TPMTHA struct {
 	Digest []byte
 }
 
+// marshal implements the Marshallable interface.
+func (ha TPMTHA) marshal(buf *bytes.Buffer) {
+	binary.Write(buf, binary.BigEndian, ha.HashAlg)
+	buf.Write(ha.Digest)
+}
+
+// unmarshal implements the Unmarshallable interface.
+// The size of the digest is implied by the hash algorithm.
+func (ha *TPMTHA) unmarshal(buf *bytes.Buffer) error {
+	if err := binary.Read(buf, binary.BigEndian, &ha.HashAlg); err != nil {
+		return fmt.Errorf("unmarshalling TPMT_HA hashAlg: %w", err)
+	}
+	if ha.HashAlg == TPMAlgNull {
+		ha.Digest = nil
+		return nil
+	}
+	size, ok := digestSizes[ha.HashAlg]
+	if !ok {
+		return fmt.Errorf("unmarshalling TPMT_HA: unsupported hash algorithm %v", ha.HashAlg)
+	}
+	ha.Digest = make([]byte, size)
+	if n, err := io.ReadFull(buf, ha.Digest); err != nil {
+		return fmt.Errorf("unmarshalling TPMT_HA digest: read %v of %v bytes: %w", n, size, err)
+	}
+	return nil
+}
+
+// digestSizes contains the size of the TPMU_HA member for each hash algorithm.
+// See definition in Part 2: Structures, section 10.3.1.
+var digestSizes = map[TPMIAlgHash]int{
+	TPMAlgSHA1:    20,
+	TPMAlgSHA256:  32,
+	TPMAlgSHA384:  48,
+	TPMAlgSHA512:  64,
+	TPMAlgSM3256:  32,
+	TPMAlgSHA3256: 32,
+	TPMAlgSHA3384: 48,
+	TPMAlgSHA3512: 64,
+}
+
 // TPM2BDigest represents a TPM2B_DIGEST.
 // See definition in Part 2: Structures, section 10.4.2.
 type TPM2BDigest TPM2BData
@@ -681,7 +722,8 @@ type TPMLCCA struct {
 // See definition in Part 2: Structures, section 10.9.3.
 type TPMLAlg struct {
 	marshalByReflection
-	Algorithms []TPMAlgID `gotpm:"list"`
+	// at most MAX_ALG_LIST_SIZE algorithms
+	Algorithms []TPMAlgID `gotpm:"list,max=64"`
 }
 
 // TPMLHandle represents a TPML_HANDLE.
@@ -695,23 +737,25 @@ type TPMLHandle struct {
 // See definition in Part 2: Structures, section 10.9.5.
 type TPMLDigest struct {
 	marshalByReflection
-	// a list of digests
-	Digests []TPM2BDigest `gotpm:"list"`
+	// a list of digests, at most 8
+	Digests []TPM2BDigest `gotpm:"list,max=8"`
 }
 
 // TPMLDigestValues represents a TPML_DIGEST_VALUES.
 // See definition in Part 2: Structures, section 10.9.6.
 type TPMLDigestValues struct {
 	marshalByReflection
-	// a list of tagged digests
-	Digests []TPMTHA `gotpm:"list"`
+	// a list of tagged digests, at most one per implemented hash
+	// (HASH_COUNT), which cannot exceed the hash algorithms registered
+	Digests []TPMTHA `gotpm:"list,max=16"`
 }
 
 // TPMLPCRSelection represents a TPML_PCR_SELECTION.
 // See definition in Part 2: Structures, section 10.9.7.
 type TPMLPCRSelection struct {
 	marshalByReflection
-	PCRSelections []TPMSPCRSelection `gotpm:"list"`
+	// at most one selection per implemented hash (HASH_COUNT)
+	PCRSelections []TPMSPCRSelection `gotpm:"list,max=16"`
 }
 
 // TPMLAlgProperty represents a TPML_ALG_PROPERTY.
@@ -2868,6 +2912,38 @@ func New2BTemplate[C TemplateContents](data C) TPM2BTemplate {
 	}
 }
 
+// NewTPMTTemplate creates the TPMT_TEMPLATE form of pub for creating a
+// derived object under a derivation parent. The unique field of pub is
+// replaced with the given label and context, from which the TPM derives the
+// object; the same template, label and context always derive the same object
+// under the same parent.
+func NewTPMTTemplate(pub *TPMTPublic, label, context []byte) *TPMTTemplate {
+	return &TPMTTemplate{
+		Type:             pub.Type,
+		NameAlg:          pub.NameAlg,
+		ObjectAttributes: pub.ObjectAttributes,
+		AuthPolicy:       pub.AuthPolicy,
+		Parameters:       pub.Parameters,
+		Unique: TPMSDerive{
+			Label:   TPM2BLabel{Buffer: label},
+			Context: TPM2BLabel{Buffer: context},
+		},
+	}
+}
+
+// Public unmarshals the template as a TPMT_PUBLIC. The encoding does not say
+// which form the template is in; a TPMT_TEMPLATE whose unique field has the
+// same layout as the public ID for its type decodes without error.
+func (t TPM2BTemplate) Public() (*TPMTPublic, error) {
+	return Unmarshal[TPMTPublic](t.Buffer)
+}
+
+// Template unmarshals the template as a TPMT_TEMPLATE, the form used under a
+// derivation parent.
+func (t TPM2BTemplate) Template() (*TPMTTemplate, error) {
+	return Unmarshal[TPMTTemplate](t.Buffer)
+}
+
 // TPMUSensitiveComposite represents a TPMU_SENSITIVE_COMPOSITE.
 // See definition in Part 2: Structures, section 12.3.2.3.
 type TPMUSensitiveComposite struct {
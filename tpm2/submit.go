@@ -0,0 +1,78 @@
+package tpm2
+
+import (
+	"errors"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrSubmitSession is returned for commands submitted with sessions other
+// than password authorizations. An HMAC, policy or encryption session can't
+// authorize a command until the response to the session's previous command
+// has updated its nonce, so its commands can't be pipelined.
+var ErrSubmitSession = errors.New("tpm2: only password sessions can be used with Submit")
+
+// Future is the pending response to a command submitted with Submit.
+type Future[R any] struct {
+	done chan struct{}
+	rsp  *R
+	err  error
+}
+
+// Done returns a channel that is closed once the response has arrived.
+func (f *Future[R]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits for the response and returns it, as Execute would have.
+func (f *Future[R]) Wait() (*R, error) {
+	<-f.done
+	return f.rsp, f.err
+}
+
+// Submit marshals cmd and queues it on q, without waiting for the TPM to
+// run it. Commands submitted to the same Queue run in the order in which
+// they were submitted, so that
+//
+//	pcrs := tpm2.Submit(q, tpm2.PCRRead{...})
+//	random := tpm2.Submit(q, tpm2.GetRandom{BytesRequested: 32})
+//
+// reads the PCRs before getting the random bytes, while the caller gets on
+// with other work. Only password sessions may be used; see
+// ErrSubmitSession.
+func Submit[R any](q *transport.Queue, cmd Command[R, *R], s ...Session) *Future[R] {
+	f := &Future[R]{done: make(chan struct{})}
+	// Check the sessions before prepare initializes them.
+	sess, err := cmdAuths(cmd)
+	for _, a := range append(sess, s...) {
+		if _, ok := a.(*pwSession); !ok && err == nil {
+			err = ErrSubmitSession
+		}
+	}
+	var p *prepared
+	if err == nil {
+		p, err = prepare(q, cmd, s...)
+	}
+	if err != nil {
+		f.err = err
+		close(f.done)
+		return f
+	}
+
+	result := q.Submit(p.command)
+	go func() {
+		defer close(f.done)
+		r := <-result
+		if r.Err != nil {
+			f.err = r.Err
+			return
+		}
+		var rsp R
+		if err := cmdFieldError(cmd, parseResponse(q, r.Response, p.cc, p.names, p.authIdx, p.sess, &rsp)); err != nil {
+			f.err = err
+			return
+		}
+		f.rsp = &rsp
+	}()
+	return f
+}
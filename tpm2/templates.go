@@ -197,4 +197,36 @@ var (
 			},
 		),
 	}
+
+	// DerivationParentTemplate contains a template for a derivation parent:
+	// a restricted decryption keyed-hash object whose seed derives keys
+	// created under it with a TPMT_TEMPLATE. See DeriveKey.
+	DerivationParentTemplate = TPMTPublic{
+		Type:    TPMAlgKeyedHash,
+		NameAlg: TPMAlgSHA256,
+		ObjectAttributes: TPMAObject{
+			FixedTPM:            true,
+			FixedParent:         true,
+			SensitiveDataOrigin: true,
+			UserWithAuth:        true,
+			NoDA:                true,
+			Restricted:          true,
+			Decrypt:             true,
+		},
+		Parameters: NewTPMUPublicParms(
+			TPMAlgKeyedHash,
+			&TPMSKeyedHashParms{
+				Scheme: TPMTKeyedHashScheme{
+					Scheme: TPMAlgXOR,
+					Details: NewTPMUSchemeKeyedHash(
+						TPMAlgXOR,
+						&TPMSSchemeXOR{
+							HashAlg: TPMAlgSHA256,
+							KDF:     TPMAlgKDF1SP800108,
+						},
+					),
+				},
+			},
+		),
+	}
 )
@@ -87,3 +87,85 @@ func TestActivateCredential(t *testing.T) {
 		t.Errorf("want %x got %x", secret.Buffer, acRsp.CertInfo.Buffer)
 	}
 }
+
+// TestCreateCredential activates credentials made in software for RSA and
+// ECC EKs.
+func TestCreateCredential(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	srk, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(ECCSRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("could not generate SRK: %v", err)
+	}
+	defer FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+
+	for _, tc := range []struct {
+		name     string
+		template TPMTPublic
+	}{
+		{"RSA", RSAEKTemplate},
+		{"ECC", ECCEKTemplate},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ek, err := CreatePrimary{
+				PrimaryHandle: TPMRHEndorsement,
+				InPublic:      New2B(tc.template),
+			}.Execute(thetpm)
+			if err != nil {
+				t.Fatalf("could not generate EK: %v", err)
+			}
+			defer FlushContext{FlushHandle: ek.ObjectHandle}.Execute(thetpm)
+			ekPub, err := ek.OutPublic.Contents()
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			secret := []byte("0123456789abcdef0123456789abcdef")
+			cred, err := CreateCredential(ekPub, srk.Name, secret)
+			if err != nil {
+				t.Fatalf("CreateCredential: %v", err)
+			}
+			activate := ActivateCredential{
+				ActivateHandle: NamedHandle{
+					Handle: srk.ObjectHandle,
+					Name:   srk.Name,
+				},
+				KeyHandle: AuthHandle{
+					Handle: ek.ObjectHandle,
+					Name:   ek.Name,
+					Auth:   Policy(TPMAlgSHA256, 16, ekPolicy),
+				},
+				CredentialBlob: cred.CredentialBlob,
+				Secret:         cred.Secret,
+			}
+			rsp, err := activate.Execute(thetpm)
+			if err != nil {
+				t.Fatalf("ActivateCredential: %v", err)
+			}
+			if !bytes.Equal(rsp.CertInfo.Buffer, secret) {
+				t.Errorf("ActivateCredential() = %x, want %x", rsp.CertInfo.Buffer, secret)
+			}
+
+			// The credential is bound to the object's name.
+			other, err := CreateCredential(ekPub, ek.Name, secret)
+			if err != nil {
+				t.Fatalf("CreateCredential: %v", err)
+			}
+			activate.CredentialBlob, activate.Secret = other.CredentialBlob, other.Secret
+			if _, err := activate.Execute(thetpm); err == nil {
+				t.Errorf("ActivateCredential() of a credential for another name succeeded")
+			}
+		})
+	}
+
+	if _, err := CreateCredential(&ECCEKTemplate, srk.Name, make([]byte, 33)); err == nil {
+		t.Errorf("CreateCredential with a 33-byte secret succeeded")
+	}
+}
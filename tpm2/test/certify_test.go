@@ -5,6 +5,7 @@ import (
 	"crypto"
 	"crypto/rsa"
 	"crypto/sha256"
+	"errors"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -478,4 +479,156 @@ func TestNVCertify(t *testing.T) {
 	if !cmp.Equal([]byte("nonce"), certInfo.ExtraData.Buffer) {
 		t.Errorf("Attested buffer is different from original buffer")
 	}
+
+	writtenPub, err := nvPub.NVPublic.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	digestInfo, err := VerifyNVDigestCertify(pub, rspCert, writtenPub, []byte("nonce"))
+	if err != nil {
+		t.Fatalf("VerifyNVDigestCertify: %v", err)
+	}
+	if want := sha256.Sum256([]byte{0x01, 0x02, 0x03, 0x04}); !bytes.Equal(digestInfo.NVDigest.Buffer, want[:]) {
+		t.Errorf("certified NV digest = %x, want %x", digestInfo.NVDigest.Buffer, want)
+	}
+	if _, err := VerifyNVCertify(pub, rspCert, writtenPub, []byte("nonce")); !errors.Is(err, ErrCertifyMismatch) {
+		t.Errorf("VerifyNVCertify(digest certification) = %v, want %v", err, ErrCertifyMismatch)
+	}
+
+	nvCertify.Size = 4
+	rspCert, err = nvCertify.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("Failed to certify contents: %v", err)
+	}
+	nvInfo, err := VerifyNVCertify(pub, rspCert, writtenPub, []byte("nonce"))
+	if err != nil {
+		t.Fatalf("VerifyNVCertify: %v", err)
+	}
+	if !bytes.Equal(nvInfo.NVContents.Buffer, []byte{0x01, 0x02, 0x03, 0x04}) {
+		t.Errorf("certified NV contents = %x, want 01020304", nvInfo.NVContents.Buffer)
+	}
+	// The index's Name before it was written is not the certified one.
+	if _, err := VerifyNVCertify(pub, rspCert, nvPublic, []byte("nonce")); !errors.Is(err, ErrCertifyMismatch) {
+		t.Errorf("VerifyNVCertify(unwritten index) = %v, want %v", err, ErrCertifyMismatch)
+	}
+	if _, err := VerifyNVCertify(pub, rspCert, writtenPub, []byte("other nonce")); !errors.Is(err, ErrCertifyMismatch) {
+		t.Errorf("VerifyNVCertify(other nonce) = %v, want %v", err, ErrCertifyMismatch)
+	}
+}
+
+func TestVerifyCertification(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	profile := Profile{Type: TPMAlgECC, Curve: TPMECCNistP256, Hash: TPMAlgSHA256}
+	ak, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(profile.AKTemplate()),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("could not create AK: %v", err)
+	}
+	defer FlushContext{FlushHandle: ak.ObjectHandle}.Execute(thetpm)
+	akPub, err := ak.OutPublic.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	srk, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(ECCSRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("could not create SRK: %v", err)
+	}
+	defer FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+	srkPub, err := srk.OutPublic.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	srkHandle := NamedHandle{Handle: srk.ObjectHandle, Name: srk.Name}
+
+	created, err := Create{
+		ParentHandle: srkHandle,
+		InPublic:     New2B(profile.AKTemplate()),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	loaded, err := Load{
+		ParentHandle: srkHandle,
+		InPrivate:    created.OutPrivate,
+		InPublic:     created.OutPublic,
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	defer FlushContext{FlushHandle: loaded.ObjectHandle}.Execute(thetpm)
+	pub, err := created.OutPublic.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	creationData, err := created.CreationData.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	akHandle := AuthHandle{Handle: ak.ObjectHandle, Name: ak.Name, Auth: PasswordAuth(nil)}
+	nonce := []byte("nonce")
+	certify, err := Certify{
+		ObjectHandle: AuthHandle{
+			Handle: loaded.ObjectHandle,
+			Name:   loaded.Name,
+			Auth:   PasswordAuth(nil),
+		},
+		SignHandle:     akHandle,
+		QualifyingData: TPM2BData{Buffer: nonce},
+		InScheme:       TPMTSigScheme{Scheme: TPMAlgNull},
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("Certify: %v", err)
+	}
+	certifyCreation, err := CertifyCreation{
+		SignHandle:     akHandle,
+		ObjectHandle:   NamedHandle{Handle: loaded.ObjectHandle, Name: loaded.Name},
+		QualifyingData: TPM2BData{Buffer: nonce},
+		CreationHash:   created.CreationHash,
+		InScheme:       TPMTSigScheme{Scheme: TPMAlgNull},
+		CreationTicket: created.CreationTicket,
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CertifyCreation: %v", err)
+	}
+
+	if info, err := VerifyCertify(akPub, certify, pub, nonce); err != nil {
+		t.Errorf("VerifyCertify: %v", err)
+	} else if !bytes.Equal(info.Name.Buffer, loaded.Name.Buffer) {
+		t.Errorf("certified Name = %x, want %x", info.Name.Buffer, loaded.Name.Buffer)
+	}
+	if _, err := VerifyCertifyCreation(akPub, certifyCreation, pub, creationData, nonce); err != nil {
+		t.Errorf("VerifyCertifyCreation: %v", err)
+	}
+
+	if _, err := VerifyCertify(akPub, certify, srkPub, nonce); !errors.Is(err, ErrCertifyMismatch) {
+		t.Errorf("VerifyCertify(other object) = %v, want %v", err, ErrCertifyMismatch)
+	}
+	if _, err := VerifyCertify(akPub, certify, pub, []byte("other nonce")); !errors.Is(err, ErrCertifyMismatch) {
+		t.Errorf("VerifyCertify(other nonce) = %v, want %v", err, ErrCertifyMismatch)
+	}
+	if _, err := VerifyCertify(srkPub, certify, pub, nonce); err == nil {
+		t.Errorf("VerifyCertify(other AK) succeeded")
+	}
+	// A creation certification is not a certification, and vice versa.
+	asCertify := CertifyResponse{CertifyInfo: certifyCreation.CertifyInfo, Signature: certifyCreation.Signature}
+	if _, err := VerifyCertify(akPub, &asCertify, pub, nonce); !errors.Is(err, ErrCertifyMismatch) {
+		t.Errorf("VerifyCertify(creation certification) = %v, want %v", err, ErrCertifyMismatch)
+	}
+	other := *creationData
+	other.ParentName = ak.Name
+	if _, err := VerifyCertifyCreation(akPub, certifyCreation, pub, &other, nonce); !errors.Is(err, ErrCertifyMismatch) {
+		t.Errorf("VerifyCertifyCreation(other creation data) = %v, want %v", err, ErrCertifyMismatch)
+	}
 }
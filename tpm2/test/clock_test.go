@@ -0,0 +1,95 @@
+package tpm2test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestClock(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	before, err := ReadClock{}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("ReadClock: %v", err)
+	}
+	// Clock can only be moved forward.
+	newTime := before.CurrentTime.ClockInfo.Clock + 3600000
+	if _, err := (ClockSet{
+		Auth:    TPMRHOwner,
+		NewTime: newTime,
+	}).Execute(thetpm); err != nil {
+		t.Fatalf("ClockSet: %v", err)
+	}
+	if _, err := (ClockSet{
+		Auth:    TPMRHOwner,
+		NewTime: before.CurrentTime.ClockInfo.Clock,
+	}).Execute(thetpm); err == nil {
+		t.Errorf("ClockSet moving Clock back succeeded")
+	}
+	for _, adj := range []TPMClockAdjust{TPMClockCoarseSlower, TPMClockFineFaster, TPMClockNoChange} {
+		if _, err := (ClockRateAdjust{
+			Auth:       TPMRHOwner,
+			RateAdjust: adj,
+		}).Execute(thetpm); err != nil {
+			t.Errorf("ClockRateAdjust(%d): %v", adj, err)
+		}
+	}
+
+	profile := Profile{Type: TPMAlgECC, Curve: TPMECCNistP256, Hash: TPMAlgSHA256}
+	ak, err := CreatePrimary{
+		PrimaryHandle: TPMRHEndorsement,
+		InPublic:      New2B(profile.AKTemplate()),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("could not create AK: %v", err)
+	}
+	defer FlushContext{FlushHandle: ak.ObjectHandle}.Execute(thetpm)
+	akPub, err := ak.OutPublic.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	nonce := []byte("nonce")
+	rsp, err := GetTime{
+		PrivacyAdminHandle: TPMRHEndorsement,
+		SignHandle: AuthHandle{
+			Handle: ak.ObjectHandle,
+			Name:   ak.Name,
+			Auth:   PasswordAuth(nil),
+		},
+		QualifyingData: TPM2BData{Buffer: nonce},
+		InScheme:       TPMTSigScheme{Scheme: TPMAlgNull},
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("GetTime: %v", err)
+	}
+	info, err := VerifyGetTime(akPub, rsp, nonce)
+	if err != nil {
+		t.Fatalf("VerifyGetTime: %v", err)
+	}
+	if info.Time.ClockInfo.Clock < newTime {
+		t.Errorf("attested Clock = %d, want at least %d", info.Time.ClockInfo.Clock, newTime)
+	}
+	if info.Time.ClockInfo.ResetCount != before.CurrentTime.ClockInfo.ResetCount {
+		t.Errorf("attested resetCount = %d, want %d", info.Time.ClockInfo.ResetCount, before.CurrentTime.ClockInfo.ResetCount)
+	}
+	if _, err := VerifyGetTime(akPub, rsp, []byte("other nonce")); err == nil {
+		t.Errorf("VerifyGetTime(other nonce) succeeded")
+	}
+
+	// The signed structure round-trips.
+	attest, err := rsp.TimeInfo.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !bytes.Equal(Marshal(attest), rsp.TimeInfo.Bytes()) {
+		t.Errorf("TPMS_ATTEST did not round-trip")
+	}
+}
@@ -0,0 +1,204 @@
+package tpm2test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestCommandSize(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	// last records the size of the last command sent.
+	var last int
+	tpm := transport.Chain(thetpm, func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+		last = len(cmd)
+		return next(cmd)
+	})
+
+	srk, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(ECCSRKTemplate),
+	}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer FlushContext{FlushHandle: srk.ObjectHandle}.Execute(tpm)
+
+	sess, cleanup, err := HMACSession(tpm, TPMAlgSHA384, 24, Auth(nil))
+	if err != nil {
+		t.Fatalf("HMACSession: %v", err)
+	}
+	defer cleanup()
+
+	getRandom := GetRandom{BytesRequested: 16}
+	create := Create{
+		ParentHandle: AuthHandle{
+			Handle: srk.ObjectHandle,
+			Name:   srk.Name,
+			Auth:   PasswordAuth([]byte("parent")),
+		},
+		InSensitive: TPM2BSensitiveCreate{
+			Sensitive: &TPMSSensitiveCreate{
+				Data: NewTPMUSensitiveCreate(&TPM2BSensitiveData{Buffer: []byte("secret")}),
+			},
+		},
+		InPublic: New2B(TPMTPublic{
+			Type:    TPMAlgKeyedHash,
+			NameAlg: TPMAlgSHA256,
+			ObjectAttributes: TPMAObject{
+				FixedTPM:     true,
+				FixedParent:  true,
+				UserWithAuth: true,
+				NoDA:         true,
+			},
+		}),
+	}
+	for _, tc := range []struct {
+		name string
+		size func() (int, error)
+		exec func() error
+	}{
+		{
+			"NoSessions",
+			func() (int, error) { return CommandSize(getRandom) },
+			func() error { _, err := getRandom.Execute(tpm); return err },
+		},
+		{
+			"HMACSession",
+			func() (int, error) { return CommandSize(withAuth(create, sess)) },
+			func() error { _, err := withAuth(create, sess).Execute(tpm); return err },
+		},
+		{
+			"Password",
+			func() (int, error) { return CommandSize(create) },
+			// The SRK has no auth value, so this fails, but only after
+			// being sent.
+			func() error { create.Execute(tpm); return nil },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want, err := tc.size()
+			if err != nil {
+				t.Fatalf("CommandSize: %v", err)
+			}
+			if err := tc.exec(); err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			if last != want {
+				t.Errorf("CommandSize() = %d, but the command was %d bytes", want, last)
+			}
+			if err := CheckCommandSize(getRandom, &CommandLimits{MaxCommandSize: 11}); !errors.Is(err, ErrCommandTooLarge) {
+				t.Errorf("CheckCommandSize() = %v, want %v", err, ErrCommandTooLarge)
+			}
+		})
+	}
+}
+
+// withAuth returns cmd with its parent authorized by sess.
+func withAuth(cmd Create, sess Session) Create {
+	parent := cmd.ParentHandle.(AuthHandle)
+	parent.Auth = sess
+	cmd.ParentHandle = parent
+	return cmd
+}
+
+func TestSplitSequenceUpdate(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	limits, err := GetCommandLimits(thetpm)
+	if err != nil {
+		t.Fatalf("GetCommandLimits: %v", err)
+	}
+	if limits.MaxCommandSize == 0 || limits.InputBuffer == 0 || limits.NVBufferMax == 0 {
+		t.Fatalf("GetCommandLimits() = %+v, want all limits", limits)
+	}
+
+	seq, err := HashSequenceStart{HashAlg: TPMAlgSHA256}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("HashSequenceStart: %v", err)
+	}
+	handle := AuthHandle{Handle: seq.SequenceHandle, Auth: PasswordAuth(nil)}
+	data := bytes.Repeat([]byte("0123456789"), limits.MaxCommandSize/4)
+
+	cmds, err := SplitSequenceUpdate(SequenceUpdate{
+		SequenceHandle: handle,
+		Buffer:         TPM2BMaxBuffer{Buffer: data},
+	}, limits)
+	if err != nil {
+		t.Fatalf("SplitSequenceUpdate: %v", err)
+	}
+	if len(cmds) < 2 {
+		t.Errorf("SplitSequenceUpdate() of %d bytes gave %d commands", len(data), len(cmds))
+	}
+	for i, cmd := range cmds {
+		if err := CheckCommandSize(cmd, limits); err != nil {
+			t.Errorf("command %d: %v", i, err)
+		}
+		if _, err := cmd.Execute(thetpm); err != nil {
+			t.Fatalf("SequenceUpdate %d: %v", i, err)
+		}
+	}
+	rsp, err := SequenceComplete{
+		SequenceHandle: handle,
+		Hierarchy:      TPMRHNull,
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("SequenceComplete: %v", err)
+	}
+	if want := sha256.Sum256(data); !bytes.Equal(rsp.Result.Buffer, want[:]) {
+		t.Errorf("digest = %x, want %x", rsp.Result.Buffer, want)
+	}
+
+	if _, err := SplitSequenceUpdate(SequenceUpdate{SequenceHandle: handle}, &CommandLimits{MaxCommandSize: 16}); !errors.Is(err, ErrCommandTooLarge) {
+		t.Errorf("SplitSequenceUpdate() with no room for data = %v, want %v", err, ErrCommandTooLarge)
+	}
+}
+
+func TestSplitNVWrite(t *testing.T) {
+	limits := &CommandLimits{MaxCommandSize: 4096, NVBufferMax: 100}
+	cmds, err := SplitNVWrite(NVWrite{
+		AuthHandle: TPMRHOwner,
+		NVIndex:    TPMHandle(0x01800010),
+		Data:       TPM2BMaxNVBuffer{Buffer: make([]byte, 250)},
+		Offset:     10,
+	}, limits)
+	if err != nil {
+		t.Fatalf("SplitNVWrite: %v", err)
+	}
+	var got [][2]int
+	for _, cmd := range cmds {
+		got = append(got, [2]int{int(cmd.Offset), len(cmd.Data.Buffer)})
+	}
+	want := [][2]int{{10, 100}, {110, 100}, {210, 50}}
+	if len(got) != len(want) {
+		t.Fatalf("SplitNVWrite() wrote (offset, size) %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("SplitNVWrite() wrote (offset, size) %v, want %v", got, want)
+		}
+	}
+
+	if _, err := SplitNVWrite(NVWrite{
+		AuthHandle: TPMRHOwner,
+		NVIndex:    TPMHandle(0x01800010),
+		Data:       TPM2BMaxNVBuffer{Buffer: make([]byte, 250)},
+		Offset:     0xffc0,
+	}, limits); err == nil {
+		t.Error("SplitNVWrite() past the largest offset succeeded, want error")
+	}
+}
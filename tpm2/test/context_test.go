@@ -0,0 +1,62 @@
+package tpm2test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestExecuteContext(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	// slow holds commands until release is closed, once block is set.
+	var sent int
+	block := false
+	release := make(chan struct{})
+	slow := transport.Chain(thetpm, func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+		sent++
+		if block {
+			<-release
+		}
+		return next(cmd)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := ExecuteContext(ctx, slow, GetRandom{BytesRequested: 8}); err != nil {
+		t.Fatalf("GetRandom: %v", err)
+	}
+	cancel()
+	if _, err := ExecuteContext(ctx, slow, GetRandom{BytesRequested: 8}); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetRandom() with a canceled context = %v, want %v", err, context.Canceled)
+	}
+	if sent != 1 {
+		t.Errorf("%d commands reached the TPM, want 1", sent)
+	}
+
+	// A ProgressReporter abandons a command that outlasts the deadline, and
+	// the next command waits for it to finish. Interceptors around the
+	// reporter don't stop it seeing the context.
+	r := NewProgressReporter(slow, time.Hour, nil)
+	outer := transport.Chain(r, func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+		return next(cmd)
+	})
+	block = true
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := ExecuteContext(ctx, outer, GetRandom{BytesRequested: 8}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetRandom() past the deadline = %v, want %v", err, context.DeadlineExceeded)
+	}
+	close(release)
+	if _, err := ExecuteContext(context.Background(), outer, GetRandom{BytesRequested: 8}); err != nil {
+		t.Errorf("GetRandom after an abandoned command: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package tpm2test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// TestCPHashRPHash checks the exported parameter hashes against the audit
+// digest the TPM computes from its own cpHash and rpHash.
+func TestCPHashRPHash(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	sess, cleanup, err := HMACSession(thetpm, TPMAlgSHA256, 16, Audit())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer cleanup()
+
+	getCmd := GetCapability{
+		Capability:    TPMCapTPMProperties,
+		Property:      uint32(TPMPTManufacturer),
+		PropertyCount: 1,
+	}
+	getRsp, err := getCmd.Execute(thetpm, sess)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cp, err := CPHash[GetCapabilityResponse](TPMAlgSHA256, getCmd)
+	if err != nil {
+		t.Fatalf("CPHash() = %v", err)
+	}
+	rp, err := RPHash(TPMAlgSHA256, getCmd, getRsp)
+	if err != nil {
+		t.Fatalf("RPHash() = %v", err)
+	}
+	h := sha256.New()
+	h.Write(make([]byte, sha256.Size))
+	h.Write(cp.Buffer)
+	h.Write(rp.Buffer)
+	want := h.Sum(nil)
+
+	getAuditRsp, err := GetSessionAuditDigest{
+		PrivacyAdminHandle: TPMRHEndorsement,
+		SignHandle:         TPMRHNull,
+		SessionHandle:      sess.Handle(),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	attest, err := getAuditRsp.AuditInfo.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	aud, err := attest.Attested.SessionAudit()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if got := aud.SessionDigest.Buffer; !bytes.Equal(got, want) {
+		t.Errorf("audit digest = %x, want %x", got, want)
+	}
+}
+
+func TestParameterHashesFromParameters(t *testing.T) {
+	// GetCapability has no handles, so its parameter area is just its three
+	// parameters.
+	getCmd := GetCapability{
+		Capability:    TPMCapTPMProperties,
+		Property:      uint32(TPMPTManufacturer),
+		PropertyCount: 1,
+	}
+	parms := binary.BigEndian.AppendUint32(nil, uint32(getCmd.Capability))
+	parms = binary.BigEndian.AppendUint32(parms, getCmd.Property)
+	parms = binary.BigEndian.AppendUint32(parms, getCmd.PropertyCount)
+
+	want, err := CPHash[GetCapabilityResponse](TPMAlgSHA256, getCmd)
+	if err != nil {
+		t.Fatalf("CPHash() = %v", err)
+	}
+	got, err := CPHashFromParameters(TPMAlgSHA256, TPMCCGetCapability, nil, parms)
+	if err != nil {
+		t.Fatalf("CPHashFromParameters() = %v", err)
+	}
+	if !bytes.Equal(got.Buffer, want.Buffer) {
+		t.Errorf("CPHashFromParameters() = %x, want %x", got.Buffer, want.Buffer)
+	}
+
+	// rpHash = H(RC || CC || parms)
+	manual := sha256.Sum256(append(binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, uint32(TPMRCSuccess)), uint32(TPMCCGetRandom)), 0, 1, 0xaa))
+	rp, err := RPHash(TPMAlgSHA256, GetRandom{}, &GetRandomResponse{RandomBytes: TPM2BDigest{Buffer: []byte{0xaa}}})
+	if err != nil {
+		t.Fatalf("RPHash() = %v", err)
+	}
+	if !bytes.Equal(rp.Buffer, manual[:]) {
+		t.Errorf("RPHash() = %x, want %x", rp.Buffer, manual)
+	}
+	raw, err := RPHashFromParameters(TPMAlgSHA256, TPMRCSuccess, TPMCCGetRandom, []byte{0, 1, 0xaa})
+	if err != nil {
+		t.Fatalf("RPHashFromParameters() = %v", err)
+	}
+	if !bytes.Equal(raw.Buffer, manual[:]) {
+		t.Errorf("RPHashFromParameters() = %x, want %x", raw.Buffer, manual)
+	}
+}
@@ -1,6 +1,7 @@
 package tpm2test
 
 import (
+	"bytes"
 	"testing"
 
 	. "github.com/google/go-tpm/tpm2"
@@ -166,3 +167,64 @@ func TestCreateLoaded(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateLoadedDerivedTemplate(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	deriver := getDeriver(t, thetpm)
+	defer FlushContext{FlushHandle: deriver}.Execute(thetpm)
+
+	pub := &TPMTPublic{
+		Type:    TPMAlgECC,
+		NameAlg: TPMAlgSHA256,
+		ObjectAttributes: TPMAObject{
+			FixedParent:  true,
+			UserWithAuth: true,
+			SignEncrypt:  true,
+		},
+		Parameters: NewTPMUPublicParms(
+			TPMAlgECC,
+			&TPMSECCParms{
+				CurveID: TPMECCNistP256,
+			},
+		),
+	}
+	derive := func(label, context string) []byte {
+		t.Helper()
+		tmpl := New2BTemplate(NewTPMTTemplate(pub, []byte(label), []byte(context)))
+		got, err := tmpl.Template()
+		if err != nil {
+			t.Fatalf("could not decode template: %v", err)
+		}
+		if string(got.Unique.Label.Buffer) != label || string(got.Unique.Context.Buffer) != context {
+			t.Fatalf("template label/context = %q/%q, want %q/%q",
+				got.Unique.Label.Buffer, got.Unique.Context.Buffer, label, context)
+		}
+		rsp, err := CreateLoaded{
+			ParentHandle: deriver,
+			InPublic:     tmpl,
+		}.Execute(thetpm)
+		if err != nil {
+			t.Fatalf("error from CreateLoaded: %v", err)
+		}
+		if _, err := (FlushContext{FlushHandle: rsp.ObjectHandle}).Execute(thetpm); err != nil {
+			t.Errorf("error from FlushContext: %v", err)
+		}
+		return rsp.OutPublic.Bytes()
+	}
+
+	first := derive("label", "context")
+	if again := derive("label", "context"); !bytes.Equal(first, again) {
+		t.Errorf("deriving twice with the same label and context gave different keys")
+	}
+	if other := derive("label", "other context"); bytes.Equal(first, other) {
+		t.Errorf("deriving with different contexts gave the same key")
+	}
+	if other := derive("other label", "context"); bytes.Equal(first, other) {
+		t.Errorf("deriving with different labels gave the same key")
+	}
+}
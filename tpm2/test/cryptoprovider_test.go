@@ -0,0 +1,88 @@
+package tpm2test
+
+import (
+	"crypto"
+	"errors"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// countingCrypto counts the operations delegated to it, optionally failing
+// HMACs.
+type countingCrypto struct {
+	SoftwareCrypto
+	salts, kdfs, hmacs int
+	hmacErr            error
+}
+
+func (c *countingCrypto) EncryptSalt(pub TPMTPublic, label string) (*TPM2BEncryptedSecret, []byte, error) {
+	c.salts++
+	return c.SoftwareCrypto.EncryptSalt(pub, label)
+}
+
+func (c *countingCrypto) KDFa(h crypto.Hash, key []byte, label string, contextU, contextV []byte, bits int) ([]byte, error) {
+	c.kdfs++
+	return c.SoftwareCrypto.KDFa(h, key, label, contextU, contextV, bits)
+}
+
+func (c *countingCrypto) HMAC(h crypto.Hash, key, data []byte) ([]byte, error) {
+	c.hmacs++
+	if c.hmacErr != nil {
+		return nil, c.hmacErr
+	}
+	return c.SoftwareCrypto.HMAC(h, key, data)
+}
+
+func TestCryptoProvider(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	srk, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(ECCSRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+	srkPub, err := srk.OutPublic.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	t.Run("Delegated", func(t *testing.T) {
+		p := &countingCrypto{}
+		sess := HMAC(TPMAlgSHA256, 16, Salted(srk.ObjectHandle, *srkPub),
+			AESEncryption(128, EncryptOut), Crypto(p))
+		rsp, err := GetRandom{BytesRequested: 16}.Execute(thetpm, sess)
+		if err != nil {
+			t.Fatalf("GetRandom: %v", err)
+		}
+		if len(rsp.RandomBytes.Buffer) != 16 {
+			t.Errorf("GetRandom returned %d bytes, want 16", len(rsp.RandomBytes.Buffer))
+		}
+		// One salt; session key and response decryption key; command and
+		// response HMACs.
+		if p.salts != 1 || p.kdfs != 2 || p.hmacs != 2 {
+			t.Errorf("provider saw %d salts, %d KDFs, %d HMACs, want 1, 2, 2", p.salts, p.kdfs, p.hmacs)
+		}
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		errHSM := errors.New("hsm unavailable")
+		p := &countingCrypto{hmacErr: errHSM}
+		sess, cleanup, err := HMACSession(thetpm, TPMAlgSHA256, 16, Crypto(p))
+		if err != nil {
+			t.Fatalf("HMACSession: %v", err)
+		}
+		defer cleanup()
+		if _, err := (GetRandom{BytesRequested: 16}).Execute(thetpm, sess); !errors.Is(err, errHSM) {
+			t.Errorf("GetRandom() = %v, want %v", err, errHSM)
+		}
+	})
+}
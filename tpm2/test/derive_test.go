@@ -0,0 +1,70 @@
+package tpm2test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestDeriveKey(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	root, err := CreateDerivationParent(thetpm, TPMRHOwner, []byte("root"))
+	if err != nil {
+		t.Fatalf("CreateDerivationParent() = %v", err)
+	}
+	defer FlushContext{FlushHandle: root.Handle}.Execute(thetpm)
+
+	template := &TPMTPublic{
+		Type:    TPMAlgECC,
+		NameAlg: TPMAlgSHA256,
+		ObjectAttributes: TPMAObject{
+			FixedTPM:     true,
+			FixedParent:  true,
+			UserWithAuth: true,
+			SignEncrypt:  true,
+		},
+		Parameters: NewTPMUPublicParms(TPMAlgECC, &TPMSECCParms{
+			CurveID: TPMECCNistP256,
+		}),
+	}
+	derive := func(parent NamedHandle, parentAuth []byte, tmpl *TPMTPublic, label, context string) *CreateLoadedResponse {
+		t.Helper()
+		rsp, err := DeriveKey(thetpm, AuthHandle{
+			Handle: parent.Handle,
+			Name:   parent.Name,
+			Auth:   PasswordAuth(parentAuth),
+		}, tmpl, []byte(label), []byte(context), nil)
+		if err != nil {
+			t.Fatalf("DeriveKey(%q, %q) = %v", label, context, err)
+		}
+		return rsp
+	}
+	name := func(parent NamedHandle, parentAuth []byte, label, context string) []byte {
+		t.Helper()
+		rsp := derive(parent, parentAuth, template, label, context)
+		FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm)
+		return rsp.Name.Buffer
+	}
+
+	signing := name(*root, []byte("root"), "signing", "v1")
+	if again := name(*root, []byte("root"), "signing", "v1"); !bytes.Equal(signing, again) {
+		t.Errorf("deriving the same key twice gave different names")
+	}
+	if other := name(*root, []byte("root"), "signing", "v2"); bytes.Equal(signing, other) {
+		t.Errorf("deriving with a different context gave the same key")
+	}
+
+	// A derived derivation parent roots a subtree.
+	sub := derive(*root, []byte("root"), &DerivationParentTemplate, "tenant", "a")
+	defer FlushContext{FlushHandle: sub.ObjectHandle}.Execute(thetpm)
+	if leaf := name(NamedHandle{Handle: sub.ObjectHandle, Name: sub.Name}, nil, "signing", "v1"); bytes.Equal(signing, leaf) {
+		t.Errorf("deriving under a different parent gave the same key")
+	}
+}
@@ -0,0 +1,68 @@
+package tpm2test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestGetDeviceInfo(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	info, err := GetDeviceInfo(thetpm)
+	if err != nil {
+		t.Fatalf("GetDeviceInfo: %v", err)
+	}
+	if info.Family != "2.0" {
+		t.Errorf("Family = %q, want %q", info.Family, "2.0")
+	}
+	if info.Manufacturer == "" || info.ManufacturerID == 0 {
+		t.Errorf("Manufacturer = %q (0x%x), want a vendor ID", info.Manufacturer, info.ManufacturerID)
+	}
+	if info.Revision < 100 || info.Year < 2012 {
+		t.Errorf("Revision = %v, Year = %v, want a TPM 2.0 specification", info.Revision, info.Year)
+	}
+	if s := info.String(); !strings.Contains(s, info.FirmwareVersion()) {
+		t.Errorf("String() = %q, want it to contain firmware version %q", s, info.FirmwareVersion())
+	}
+}
+
+func TestDeviceInfoString(t *testing.T) {
+	for _, tc := range []struct {
+		info DeviceInfo
+		want string
+	}{
+		{
+			DeviceInfo{
+				Manufacturer:     "IFX",
+				VendorString:     "SLB9670",
+				FirmwareVersion1: 0x00070055,
+				FirmwareVersion2: 0x0011cf00,
+				Family:           "2.0",
+				Level:            0,
+				Revision:         138,
+				Year:             2016,
+			},
+			"Infineon (IFX) SLB9670, firmware 7.85.17.52992, TPM 2.0 level 0 revision 1.38 (2016)",
+		},
+		{
+			DeviceInfo{
+				Manufacturer: "XYZ",
+				Family:       "2.0",
+				Revision:     159,
+				Year:         2019,
+			},
+			"XYZ, firmware 0.0.0.0, TPM 2.0 level 0 revision 1.59 (2019)",
+		},
+	} {
+		if got := tc.info.String(); got != tc.want {
+			t.Errorf("String() = %q, want %q", got, tc.want)
+		}
+	}
+}
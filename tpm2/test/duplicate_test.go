@@ -1,6 +1,12 @@
 package tpm2test
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
 	"testing"
 
 	. "github.com/google/go-tpm/tpm2"
@@ -179,3 +185,258 @@ func dupPolicyDigest(thetpm transport.TPM) ([]byte, error) {
 	}
 	return pgd.PolicyDigest.Buffer, nil
 }
+
+// aes128CFB is an inner wrapper definition.
+var aes128CFB = TPMTSymDef{
+	Algorithm: TPMAlgAES,
+	KeyBits:   NewTPMUSymKeyBits(TPMAlgAES, TPMKeyBits(128)),
+	Mode:      NewTPMUSymMode(TPMAlgAES, TPMAlgCFB),
+}
+
+// TestDuplicateRewrap duplicates an object with an inner wrapper to the
+// endorsement SRK, rewraps it for a second parent and imports it there.
+func TestDuplicateRewrap(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	createParent := func(hierarchy TPMHandle, template TPMTPublic) AuthHandle {
+		t.Helper()
+		rsp, err := CreatePrimary{
+			PrimaryHandle: hierarchy,
+			InPublic:      New2B(template),
+		}.Execute(thetpm)
+		if err != nil {
+			t.Fatalf("CreatePrimary: %v", err)
+		}
+		t.Cleanup(func() { FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm) })
+		return AuthHandle{Handle: rsp.ObjectHandle, Name: rsp.Name, Auth: PasswordAuth(nil)}
+	}
+	policy, err := dupPolicyDigest(thetpm)
+	if err != nil {
+		t.Fatalf("dupPolicyDigest: %v", err)
+	}
+	srk, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(ECCSRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	obj, err := CreateLoaded{
+		ParentHandle: AuthHandle{Handle: srk.ObjectHandle, Name: srk.Name, Auth: PasswordAuth(nil)},
+		InPublic: New2BTemplate(&TPMTPublic{
+			Type:    TPMAlgECC,
+			NameAlg: TPMAlgSHA256,
+			ObjectAttributes: TPMAObject{
+				SensitiveDataOrigin: true,
+				UserWithAuth:        true,
+				SignEncrypt:         true,
+			},
+			AuthPolicy: TPM2BDigest{Buffer: policy},
+			Parameters: NewTPMUPublicParms(
+				TPMAlgECC,
+				&TPMSECCParms{CurveID: TPMECCNistP256},
+			),
+		}),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreateLoaded: %v", err)
+	}
+	// The simulator only has room for three objects.
+	FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+	oldParent := createParent(TPMRHEndorsement, ECCSRKTemplate)
+
+	dup, err := Duplicate{
+		ObjectHandle: AuthHandle{
+			Handle: obj.ObjectHandle,
+			Name:   obj.Name,
+			Auth: Policy(TPMAlgSHA256, 16, PolicyCallback(func(tpm transport.TPM, handle TPMISHPolicy, _ TPM2BNonce) error {
+				_, err := PolicyCommandCode{PolicySession: handle, Code: TPMCCDuplicate}.Execute(tpm)
+				return err
+			})),
+		},
+		NewParentHandle: oldParent,
+		Symmetric:       aes128CFB,
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("Duplicate: %v", err)
+	}
+	if len(dup.EncryptionKeyOut.Buffer) != 16 {
+		t.Fatalf("Duplicate returned a %d-byte inner wrapper key, want 16", len(dup.EncryptionKeyOut.Buffer))
+	}
+	FlushContext{FlushHandle: obj.ObjectHandle}.Execute(thetpm)
+	newParent := createParent(TPMRHEndorsement, RSASRKTemplate)
+
+	rewrapped, err := Rewrap{
+		OldParent:   oldParent,
+		NewParent:   newParent,
+		InDuplicate: dup.Duplicate,
+		Name:        obj.Name,
+		InSymSeed:   dup.OutSymSeed,
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("Rewrap: %v", err)
+	}
+
+	// The old parent can no longer import the rewrapped duplicate.
+	if _, err := (Import{
+		ParentHandle:  oldParent,
+		EncryptionKey: dup.EncryptionKeyOut,
+		ObjectPublic:  obj.OutPublic,
+		Duplicate:     rewrapped.OutDuplicate,
+		InSymSeed:     rewrapped.OutSymSeed,
+		Symmetric:     aes128CFB,
+	}).Execute(thetpm); err == nil {
+		t.Errorf("Import of the rewrapped duplicate under the old parent succeeded")
+	}
+	imported, err := Import{
+		ParentHandle:  newParent,
+		EncryptionKey: dup.EncryptionKeyOut,
+		ObjectPublic:  obj.OutPublic,
+		Duplicate:     rewrapped.OutDuplicate,
+		InSymSeed:     rewrapped.OutSymSeed,
+		Symmetric:     aes128CFB,
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	loaded, err := Load{
+		ParentHandle: newParent,
+		InPrivate:    imported.OutPrivate,
+		InPublic:     obj.OutPublic,
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	defer FlushContext{FlushHandle: loaded.ObjectHandle}.Execute(thetpm)
+	if !bytes.Equal(loaded.Name.Buffer, obj.Name.Buffer) {
+		t.Errorf("imported object's name = %x, want %x", loaded.Name.Buffer, obj.Name.Buffer)
+	}
+}
+
+// TestWrapDuplicate imports software keys wrapped with WrapDuplicate, with
+// and without an inner wrapper.
+func TestWrapDuplicate(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	srk, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(RSASRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+	srkPub, err := srk.OutPublic.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	parent := AuthHandle{Handle: srk.ObjectHandle, Name: srk.Name, Auth: PasswordAuth(nil)}
+
+	for _, tc := range []struct {
+		name  string
+		inner TPMTSymDef
+	}{
+		{"Outer", TPMTSymDef{Algorithm: TPMAlgNull}},
+		{"InnerAndOuter", aes128CFB},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				t.Fatalf("GenerateKey: %v", err)
+			}
+			pub := TPMTPublic{
+				Type:    TPMAlgECC,
+				NameAlg: TPMAlgSHA256,
+				ObjectAttributes: TPMAObject{
+					UserWithAuth: true,
+					SignEncrypt:  true,
+				},
+				Parameters: NewTPMUPublicParms(
+					TPMAlgECC,
+					&TPMSECCParms{CurveID: TPMECCNistP256},
+				),
+				Unique: NewTPMUPublicID(
+					TPMAlgECC,
+					&TPMSECCPoint{
+						X: TPM2BECCParameter{Buffer: pk.X.FillBytes(make([]byte, 32))},
+						Y: TPM2BECCParameter{Buffer: pk.Y.FillBytes(make([]byte, 32))},
+					},
+				),
+			}
+			sens := TPMTSensitive{
+				SensitiveType: TPMAlgECC,
+				SeedValue:     TPM2BDigest{Buffer: make([]byte, 32)},
+				Sensitive: NewTPMUSensitiveComposite(
+					TPMAlgECC,
+					&TPM2BECCParameter{Buffer: pk.D.FillBytes(make([]byte, 32))},
+				),
+			}
+			dup, err := WrapDuplicate(srkPub, &pub, &sens, tc.inner)
+			if err != nil {
+				t.Fatalf("WrapDuplicate: %v", err)
+			}
+			imported, err := Import{
+				ParentHandle:  parent,
+				EncryptionKey: dup.EncryptionKeyOut,
+				ObjectPublic:  New2B(pub),
+				Duplicate:     dup.Duplicate,
+				InSymSeed:     dup.OutSymSeed,
+				Symmetric:     tc.inner,
+			}.Execute(thetpm)
+			if err != nil {
+				t.Fatalf("Import: %v", err)
+			}
+			loaded, err := Load{
+				ParentHandle: parent,
+				InPrivate:    imported.OutPrivate,
+				InPublic:     New2B(pub),
+			}.Execute(thetpm)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			defer FlushContext{FlushHandle: loaded.ObjectHandle}.Execute(thetpm)
+
+			// A key the TPM signs with must be the one that was wrapped.
+			digest := sha256.Sum256([]byte("duplicate"))
+			sig, err := Sign{
+				KeyHandle: NamedHandle{Handle: loaded.ObjectHandle, Name: loaded.Name},
+				Digest:    TPM2BDigest{Buffer: digest[:]},
+				InScheme: TPMTSigScheme{
+					Scheme:  TPMAlgECDSA,
+					Details: NewTPMUSigScheme(TPMAlgECDSA, &TPMSSchemeHash{HashAlg: TPMAlgSHA256}),
+				},
+				Validation: TPMTTKHashCheck{Tag: TPMSTHashCheck},
+			}.Execute(thetpm)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			ecc, err := sig.Signature.Signature.ECDSA()
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			r := new(big.Int).SetBytes(ecc.SignatureR.Buffer)
+			s := new(big.Int).SetBytes(ecc.SignatureS.Buffer)
+			if !ecdsa.Verify(&pk.PublicKey, digest[:], r, s) {
+				t.Errorf("signature by the imported key does not verify")
+			}
+		})
+	}
+
+	// An inner wrapper needs AES-CFB.
+	ecb := TPMTSymDef{
+		Algorithm: TPMAlgAES,
+		KeyBits:   NewTPMUSymKeyBits(TPMAlgAES, TPMKeyBits(128)),
+		Mode:      NewTPMUSymMode(TPMAlgAES, TPMAlgECB),
+	}
+	if _, err := WrapDuplicate(srkPub, &ECCSRKTemplate, &TPMTSensitive{SensitiveType: TPMAlgECC}, ecb); err == nil {
+		t.Errorf("WrapDuplicate with AES-ECB succeeded")
+	}
+}
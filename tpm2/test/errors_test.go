@@ -0,0 +1,69 @@
+package tpm2test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestFmt1ErrorField(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	// A restricted decryption key can't also be a signing key.
+	badTemplate := RSASRKTemplate
+	badTemplate.ObjectAttributes.SignEncrypt = true
+
+	for _, tc := range []struct {
+		name      string
+		cmd       CreatePrimary
+		wantRC    TPMRC
+		wantField string
+	}{
+		{
+			name: "Parameter",
+			cmd: CreatePrimary{
+				PrimaryHandle: TPMRHOwner,
+				InPublic:      New2B(badTemplate),
+			},
+			wantRC:    TPMRCAttributes,
+			wantField: "InPublic",
+		},
+		{
+			name: "Handle",
+			cmd: CreatePrimary{
+				PrimaryHandle: TPMRHLockout,
+				InPublic:      New2B(RSASRKTemplate),
+			},
+			wantRC:    TPMRCValue,
+			wantField: "PrimaryHandle",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.cmd.Execute(thetpm)
+			if !errors.Is(err, tc.wantRC) {
+				t.Fatalf("CreatePrimary() = %v, want %v", err, tc.wantRC)
+			}
+			var rc TPMRC
+			if !errors.As(err, &rc) {
+				t.Errorf("CreatePrimary() error %v is not a TPMRC", err)
+			}
+			var fmt1 TPMFmt1Error
+			if !errors.As(err, &fmt1) {
+				t.Fatalf("want a Fmt1Error, got %v", err)
+			}
+			if got := fmt1.Field(); got != tc.wantField {
+				t.Errorf("Field() = %q, want %q", got, tc.wantField)
+			}
+			if !strings.Contains(err.Error(), tc.wantField) {
+				t.Errorf("error %q does not name %v", err, tc.wantField)
+			}
+		})
+	}
+}
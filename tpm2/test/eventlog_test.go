@@ -0,0 +1,119 @@
+package tpm2test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestEventLogWriter(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	const pcr = 16
+	if _, err := (PCRReset{
+		PCRHandle: AuthHandle{Handle: TPMHandle(pcr), Auth: PasswordAuth(nil)},
+	}).Execute(thetpm); err != nil {
+		t.Fatalf("PCRReset: %v", err)
+	}
+	banks, err := ActivePCRBanks(thetpm)
+	if err != nil {
+		t.Fatalf("ActivePCRBanks: %v", err)
+	}
+
+	var buf bytes.Buffer
+	w, err := NewEventLogWriter(&buf, banks)
+	if err != nil {
+		t.Fatalf("NewEventLogWriter: %v", err)
+	}
+	events := []struct {
+		typ  EventType
+		data []byte
+		opts []ExtendOption
+	}{
+		{EVIPL, []byte("first"), nil},
+		{EVEventTag, []byte("second"), []ExtendOption{ExtendEventType(EVEventTag)}},
+		{EVIPL, []byte("third"), []ExtendOption{ExtendWithPCREvent()}},
+	}
+	for _, e := range events {
+		if _, err := ExtendPCR(thetpm, TPMHandle(pcr), e.data, append(e.opts, ExtendTCGLog(w))...); err != nil {
+			t.Fatalf("ExtendPCR(%q): %v", e.data, err)
+		}
+	}
+
+	log, err := ReadEventLog(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ReadEventLog: %v", err)
+	}
+	if !reflect.DeepEqual(log.Banks, banks) {
+		t.Errorf("log banks = %v, want %v", log.Banks, banks)
+	}
+	if len(log.Entries) != len(events) {
+		t.Fatalf("log has %d entries, want %d", len(log.Entries), len(events))
+	}
+	for i, e := range events {
+		got := log.Entries[i]
+		if got.PCR != pcr || got.Type != e.typ || !bytes.Equal(got.Data, e.data) {
+			t.Errorf("entry %d = PCR %d, type %v, data %q; want PCR %d, type %v, data %q",
+				i, got.PCR, got.Type, got.Data, pcr, e.typ, e.data)
+		}
+		if len(got.Digests.Digests) != len(banks) {
+			t.Errorf("entry %d has %d digests, want %d", i, len(got.Digests.Digests), len(banks))
+		}
+	}
+
+	replayed, err := log.Replay()
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	var sel TPMLPCRSelection
+	for _, bank := range banks {
+		sel.PCRSelections = append(sel.PCRSelections, TPMSPCRSelection{
+			Hash:      bank,
+			PCRSelect: PCClientCompatible.PCRs(pcr),
+		})
+	}
+	actual, err := ReadPCRs(thetpm, sel)
+	if err != nil {
+		t.Fatalf("ReadPCRs: %v", err)
+	}
+	for _, bank := range banks {
+		if !bytes.Equal(replayed[bank][pcr], actual[bank][pcr]) {
+			t.Errorf("replayed bank %v PCR %d = %x, TPM has %x", bank, pcr, replayed[bank][pcr], actual[bank][pcr])
+		}
+	}
+}
+
+func TestEventLogWriterMissingBank(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewEventLogWriter(&buf, []TPMIAlgHash{TPMAlgSHA1, TPMAlgSHA256})
+	if err != nil {
+		t.Fatalf("NewEventLogWriter: %v", err)
+	}
+	err = w.Append(EventLogEntry{
+		PCR: 16,
+		Digests: TPMLDigestValues{Digests: []TPMTHA{
+			{HashAlg: TPMAlgSHA256, Digest: make([]byte, 32)},
+		}},
+	})
+	if err == nil {
+		t.Error("Append accepted an event without a SHA-1 digest")
+	}
+}
+
+func TestReadEventLogNotCryptoAgile(t *testing.T) {
+	// A SHA-1 log starts with a TCG_PCClientPCREvent that isn't a Spec ID
+	// event.
+	sha1Log := make([]byte, 32)
+	sha1Log[4] = byte(EVSeparator)
+	if _, err := ReadEventLog(sha1Log); !errors.Is(err, ErrNotCryptoAgileLog) {
+		t.Errorf("ReadEventLog() = %v, want %v", err, ErrNotCryptoAgileLog)
+	}
+}
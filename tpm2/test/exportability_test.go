@@ -0,0 +1,112 @@
+package tpm2test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestKeyExportability(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	srk, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(ECCSRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+
+	policy, err := dupPolicyDigest(thetpm)
+	if err != nil {
+		t.Fatalf("dupPolicyDigest: %v", err)
+	}
+
+	// A storage key that can be duplicated, and a key below it that cannot
+	// be duplicated by itself.
+	middleTemplate := ECCSRKTemplate
+	middleTemplate.ObjectAttributes.FixedTPM = false
+	middleTemplate.ObjectAttributes.FixedParent = false
+	middleTemplate.AuthPolicy = TPM2BDigest{Buffer: policy}
+	middle, err := CreateLoaded{
+		ParentHandle: NamedHandle{Handle: srk.ObjectHandle, Name: srk.Name},
+		InPublic:     New2BTemplate(&middleTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreateLoaded(middle): %v", err)
+	}
+	defer FlushContext{FlushHandle: middle.ObjectHandle}.Execute(thetpm)
+
+	leafTemplate := ECCSRKTemplate
+	leafTemplate.ObjectAttributes.FixedTPM = false
+	leafTemplate.ObjectAttributes.Restricted = false
+	leafTemplate.ObjectAttributes.Decrypt = false
+	leafTemplate.ObjectAttributes.SignEncrypt = true
+	leafTemplate.Parameters = NewTPMUPublicParms(TPMAlgECC, &TPMSECCParms{
+		Symmetric: TPMTSymDefObject{Algorithm: TPMAlgNull},
+		CurveID:   TPMECCNistP256,
+	})
+	leaf, err := CreateLoaded{
+		ParentHandle: NamedHandle{Handle: middle.ObjectHandle, Name: middle.Name},
+		InPublic:     New2BTemplate(&leafTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreateLoaded(leaf): %v", err)
+	}
+	defer FlushContext{FlushHandle: leaf.ObjectHandle}.Execute(thetpm)
+
+	t.Run("LeafWithChain", func(t *testing.T) {
+		e, err := ReadKeyExportability(thetpm, leaf.ObjectHandle, middle.ObjectHandle, srk.ObjectHandle)
+		if err != nil {
+			t.Fatalf("ReadKeyExportability: %v", err)
+		}
+		if !e.Exportable || e.Via != 1 || !e.AnyParent || !bytes.Equal(e.Policy, policy) {
+			t.Errorf("ReadKeyExportability = %+v, want exportable via its parent to any parent", e)
+		}
+	})
+
+	t.Run("LeafAlone", func(t *testing.T) {
+		e, err := ReadKeyExportability(thetpm, leaf.ObjectHandle)
+		if err != nil {
+			t.Fatalf("ReadKeyExportability: %v", err)
+		}
+		if !e.Exportable || e.Via != -1 {
+			t.Errorf("ReadKeyExportability = %+v, want exportable via an unknown ancestor", e)
+		}
+	})
+
+	t.Run("SRK", func(t *testing.T) {
+		e, err := ReadKeyExportability(thetpm, srk.ObjectHandle)
+		if err != nil {
+			t.Fatalf("ReadKeyExportability: %v", err)
+		}
+		if e.Exportable || e.ExternalOrigin || e.Via != -1 {
+			t.Errorf("ReadKeyExportability = %+v, want not exportable", e)
+		}
+	})
+
+	t.Run("EncryptedDuplicationNoPolicy", func(t *testing.T) {
+		pub := TPMTPublic{
+			Type:    TPMAlgECC,
+			NameAlg: TPMAlgSHA256,
+			ObjectAttributes: TPMAObject{
+				EncryptedDuplication: true,
+				SignEncrypt:          true,
+			},
+		}
+		e := CheckKeyExportability(&pub)
+		if !e.Exportable || !e.ExternalOrigin || e.Via != 0 || e.AnyParent || len(e.Policy) != 0 {
+			t.Errorf("CheckKeyExportability = %+v, want external, duplicable only when encrypted", e)
+		}
+		if len(e.Reasons) != 2 {
+			t.Errorf("Reasons = %q, want 2", e.Reasons)
+		}
+	})
+}
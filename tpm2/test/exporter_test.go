@@ -0,0 +1,86 @@
+package tpm2test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestExportKeyingMaterial(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	srk, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(ECCSRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+	srkPub, err := srk.OutPublic.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	salted := func() Session {
+		t.Helper()
+		sess, cleanup, err := HMACSession(thetpm, TPMAlgSHA256, 16,
+			Salted(srk.ObjectHandle, *srkPub), AESEncryption(128, EncryptOut))
+		if err != nil {
+			t.Fatalf("HMACSession: %v", err)
+		}
+		t.Cleanup(func() { cleanup() })
+		return sess
+	}
+	export := func(s Session, label string, context []byte) []byte {
+		t.Helper()
+		ekm, err := ExportKeyingMaterial(s, label, context, 48)
+		if err != nil {
+			t.Fatalf("ExportKeyingMaterial: %v", err)
+		}
+		if len(ekm) != 48 {
+			t.Fatalf("ExportKeyingMaterial returned %d bytes, want 48", len(ekm))
+		}
+		return ekm
+	}
+
+	sess := salted()
+	ekm := export(sess, "test", []byte("context"))
+
+	// Using the session rolls its nonces but not the exported material.
+	if _, err := (GetRandom{BytesRequested: 8}).Execute(thetpm, sess); err != nil {
+		t.Fatalf("GetRandom: %v", err)
+	}
+	if got := export(sess, "test", []byte("context")); !bytes.Equal(got, ekm) {
+		t.Errorf("exported material changed after the session was used")
+	}
+
+	for name, other := range map[string][]byte{
+		"OtherLabel":   export(sess, "other", []byte("context")),
+		"OtherContext": export(sess, "test", []byte("other")),
+		"OtherSession": export(salted(), "test", []byte("context")),
+	} {
+		if bytes.Equal(other, ekm) {
+			t.Errorf("%v: exported material did not change", name)
+		}
+	}
+
+	unsalted, cleanup, err := HMACSession(thetpm, TPMAlgSHA256, 16)
+	if err != nil {
+		t.Fatalf("HMACSession: %v", err)
+	}
+	defer cleanup()
+	if _, err := ExportKeyingMaterial(unsalted, "test", nil, 32); !errors.Is(err, ErrNoSessionKey) {
+		t.Errorf("ExportKeyingMaterial(unsalted) = %v, want %v", err, ErrNoSessionKey)
+	}
+	if _, err := ExportKeyingMaterial(PasswordAuth(nil), "test", nil, 32); !errors.Is(err, ErrNoSessionKey) {
+		t.Errorf("ExportKeyingMaterial(password) = %v, want %v", err, ErrNoSessionKey)
+	}
+}
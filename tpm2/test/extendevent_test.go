@@ -0,0 +1,143 @@
+package tpm2test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// flakyWriter is an event log destination that can be made to fail, as if
+// the process crashed before the event reached it.
+type flakyWriter struct {
+	bytes.Buffer
+	fail bool
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if w.fail {
+		return 0, errors.New("crashed")
+	}
+	return w.Buffer.Write(p)
+}
+
+// lostExtendTPM drops TPM2_PCR_Extend commands without a response, as if the
+// process crashed before sending them.
+type lostExtendTPM struct {
+	tpm transport.TPM
+}
+
+func (l lostExtendTPM) Send(cmd []byte) ([]byte, error) {
+	if TPMCC(binary.BigEndian.Uint32(cmd[6:10])) == TPMCCPCRExtend {
+		return nil, errors.New("crashed")
+	}
+	return l.tpm.Send(cmd)
+}
+
+func TestExtendWithEvent(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	const pcr = 16
+	if _, err := (PCRReset{
+		PCRHandle: AuthHandle{Handle: TPMHandle(pcr), Auth: PasswordAuth(nil)},
+	}).Execute(thetpm); err != nil {
+		t.Fatalf("PCRReset: %v", err)
+	}
+	banks, err := ActivePCRBanks(thetpm)
+	if err != nil {
+		t.Fatalf("ActivePCRBanks: %v", err)
+	}
+	var sel TPMLPCRSelection
+	for _, bank := range banks {
+		sel.PCRSelections = append(sel.PCRSelections, TPMSPCRSelection{
+			Hash:      bank,
+			PCRSelect: PCClientCompatible.PCRs(pcr),
+		})
+	}
+
+	var dest flakyWriter
+	log, err := NewEventLogWriter(&dest, banks)
+	if err != nil {
+		t.Fatalf("NewEventLogWriter: %v", err)
+	}
+	wal := filepath.Join(t.TempDir(), "pending-event")
+
+	// checkReplay restarts from the log written so far, recovers any
+	// interrupted measurement and checks that the log replays to the PCR.
+	checkReplay := func(wantRecovered bool) {
+		t.Helper()
+		current, err := ReadEventLog(dest.Bytes())
+		if err != nil {
+			t.Fatalf("ReadEventLog: %v", err)
+		}
+		log, err = ResumeEventLogWriter(&dest, current)
+		if err != nil {
+			t.Fatalf("ResumeEventLogWriter: %v", err)
+		}
+		recovered, err := RecoverExtend(thetpm, current, log, wal)
+		if err != nil {
+			t.Fatalf("RecoverExtend: %v", err)
+		}
+		if recovered != wantRecovered {
+			t.Errorf("RecoverExtend() = %v, want %v", recovered, wantRecovered)
+		}
+		if _, err := os.Stat(wal); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("write-ahead log was not removed: %v", err)
+		}
+
+		current, err = ReadEventLog(dest.Bytes())
+		if err != nil {
+			t.Fatalf("ReadEventLog: %v", err)
+		}
+		replayed, err := current.Replay()
+		if err != nil {
+			t.Fatalf("Replay: %v", err)
+		}
+		actual, err := ReadPCRs(thetpm, sel)
+		if err != nil {
+			t.Fatalf("ReadPCRs: %v", err)
+		}
+		for _, bank := range banks {
+			if !bytes.Equal(replayed[bank][pcr], actual[bank][pcr]) {
+				t.Errorf("replayed bank %v PCR %d = %x, TPM has %x", bank, pcr, replayed[bank][pcr], actual[bank][pcr])
+			}
+		}
+	}
+
+	if _, err := ExtendWithEvent(thetpm, TPMHandle(pcr), EVIPL, []byte("first"), log, WriteAheadLog(wal)); err != nil {
+		t.Fatalf("ExtendWithEvent: %v", err)
+	}
+	checkReplay(false)
+
+	// Crash after the extend, before the event is logged.
+	dest.fail = true
+	if _, err := ExtendWithEvent(thetpm, TPMHandle(pcr), EVIPL, []byte("second"), log, WriteAheadLog(wal)); err == nil {
+		t.Fatal("ExtendWithEvent succeeded without logging the event")
+	}
+	dest.fail = false
+	checkReplay(true)
+
+	// Crash before the extend.
+	if _, err := ExtendWithEvent(lostExtendTPM{thetpm}, TPMHandle(pcr), EVIPL, []byte("third"), log, WriteAheadLog(wal)); err == nil {
+		t.Fatal("ExtendWithEvent succeeded without extending the PCR")
+	}
+	checkReplay(false)
+
+	current, err := ReadEventLog(dest.Bytes())
+	if err != nil {
+		t.Fatalf("ReadEventLog: %v", err)
+	}
+	if len(current.Entries) != 2 {
+		t.Errorf("log has %d entries, want 2", len(current.Entries))
+	}
+}
@@ -0,0 +1,253 @@
+package tpm2test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// replayTPM records the last response from an underlying TPM and, once
+// frozen, replays it for every command.
+type replayTPM struct {
+	tpm    transport.TPM
+	last   []byte
+	frozen bool
+}
+
+func (r *replayTPM) Send(cmd []byte) ([]byte, error) {
+	if r.frozen {
+		return r.last, nil
+	}
+	rsp, err := r.tpm.Send(cmd)
+	r.last = rsp
+	return rsp, err
+}
+
+func createECCSigningKey(t testing.TB, thetpm transport.TPM, auth []byte) (*CreatePrimaryResponse, *ecdsa.PublicKey) {
+	t.Helper()
+	createPrimary := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InSensitive: TPM2BSensitiveCreate{
+			Sensitive: &TPMSSensitiveCreate{
+				UserAuth: TPM2BAuth{Buffer: auth},
+			},
+		},
+		InPublic: New2B(TPMTPublic{
+			Type:    TPMAlgECC,
+			NameAlg: TPMAlgSHA256,
+			ObjectAttributes: TPMAObject{
+				SignEncrypt:         true,
+				FixedTPM:            true,
+				FixedParent:         true,
+				SensitiveDataOrigin: true,
+				UserWithAuth:        true,
+				NoDA:                true,
+			},
+			Parameters: NewTPMUPublicParms(
+				TPMAlgECC,
+				&TPMSECCParms{
+					Scheme: TPMTECCScheme{
+						Scheme: TPMAlgECDSA,
+						Details: NewTPMUAsymScheme(
+							TPMAlgECDSA,
+							&TPMSSigSchemeECDSA{
+								HashAlg: TPMAlgSHA256,
+							},
+						),
+					},
+					CurveID: TPMECCNistP256,
+				},
+			),
+		}),
+	}
+	rsp, err := createPrimary.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary failed: %v", err)
+	}
+	pub, err := rsp.OutPublic.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	point, err := pub.Unique.ECC()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return rsp, &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(point.X.Buffer),
+		Y:     new(big.Int).SetBytes(point.Y.Buffer),
+	}
+}
+
+func TestSignFastPath(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	auth := []byte("p@ssw0rd")
+	key, pub := createECCSigningKey(t, thetpm, auth)
+	defer FlushContext{FlushHandle: key.ObjectHandle}.Execute(thetpm)
+
+	digest := sha256.Sum256([]byte("migrationpains"))
+	for _, tc := range []struct {
+		name   string
+		scheme TPMTSigScheme
+	}{
+		{"KeyScheme", TPMTSigScheme{}},
+		{"ExplicitScheme", TPMTSigScheme{
+			Scheme:  TPMAlgECDSA,
+			Details: NewTPMUSigScheme(TPMAlgECDSA, &TPMSSchemeHash{HashAlg: TPMAlgSHA256}),
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sign := Sign{
+				KeyHandle: AuthHandle{
+					Handle: key.ObjectHandle,
+					Name:   key.Name,
+					Auth:   PasswordAuth(auth),
+				},
+				Digest:     TPM2BDigest{Buffer: digest[:]},
+				InScheme:   tc.scheme,
+				Validation: TPMTTKHashCheck{Tag: TPMSTHashCheck},
+			}
+			rsp, err := sign.Execute(thetpm)
+			if err != nil {
+				t.Fatalf("Sign failed: %v", err)
+			}
+			sig, err := rsp.Signature.Signature.ECDSA()
+			if err != nil {
+				t.Fatalf("Signature is not ECDSA: %v", err)
+			}
+			if sig.Hash != TPMAlgSHA256 {
+				t.Errorf("signature hash = %v, want %v", sig.Hash, TPMAlgSHA256)
+			}
+			if !ecdsa.Verify(pub, digest[:], new(big.Int).SetBytes(sig.SignatureR.Buffer), new(big.Int).SetBytes(sig.SignatureS.Buffer)) {
+				t.Error("signature did not verify")
+			}
+		})
+	}
+
+	t.Run("BadAuth", func(t *testing.T) {
+		sign := Sign{
+			KeyHandle: AuthHandle{
+				Handle: key.ObjectHandle,
+				Name:   key.Name,
+				Auth:   PasswordAuth([]byte("wrong")),
+			},
+			Digest:     TPM2BDigest{Buffer: digest[:]},
+			Validation: TPMTTKHashCheck{Tag: TPMSTHashCheck},
+		}
+		_, err := sign.Execute(thetpm)
+		if !errors.Is(err, TPMRCBadAuth) {
+			t.Errorf("Sign with wrong password: got %v, want %v", err, TPMRCBadAuth)
+		}
+	})
+}
+
+func TestFastPathAllocs(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	key, _ := createECCSigningKey(t, thetpm, nil)
+	defer FlushContext{FlushHandle: key.ObjectHandle}.Execute(thetpm)
+
+	sign := Sign{
+		KeyHandle: AuthHandle{
+			Handle: key.ObjectHandle,
+			Name:   key.Name,
+			Auth:   PasswordAuth(nil),
+		},
+		Digest:     TPM2BDigest{Buffer: make([]byte, 32)},
+		Validation: TPMTTKHashCheck{Tag: TPMSTHashCheck},
+	}
+	getRandom := GetRandom{BytesRequested: 32}
+
+	// Replay recorded responses so that only the library's own
+	// allocations are counted.
+	for _, tc := range []struct {
+		name string
+		run  func(transport.TPM) error
+	}{
+		{"Sign", func(tpm transport.TPM) error {
+			_, err := sign.Execute(tpm)
+			return err
+		}},
+		{"GetRandom", func(tpm transport.TPM) error {
+			_, err := getRandom.Execute(tpm)
+			return err
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			replay := &replayTPM{tpm: thetpm}
+			if err := tc.run(replay); err != nil {
+				t.Fatalf("%v", err)
+			}
+			replay.frozen = true
+			allocs := testing.AllocsPerRun(100, func() {
+				if err := tc.run(replay); err != nil {
+					t.Fatalf("%v", err)
+				}
+			})
+			// The response structure and a copy of its variable-length
+			// contents are all that should be allocated.
+			if allocs > 2 {
+				t.Errorf("%v allocated %v times per call, want at most 2", tc.name, allocs)
+			}
+		})
+	}
+}
+
+func BenchmarkSign(b *testing.B) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		b.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	key, _ := createECCSigningKey(b, thetpm, nil)
+	sign := Sign{
+		KeyHandle: AuthHandle{
+			Handle: key.ObjectHandle,
+			Name:   key.Name,
+			Auth:   PasswordAuth(nil),
+		},
+		Digest:     TPM2BDigest{Buffer: make([]byte, 32)},
+		Validation: TPMTTKHashCheck{Tag: TPMSTHashCheck},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sign.Execute(thetpm); err != nil {
+			b.Fatalf("Sign failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkGetRandom(b *testing.B) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		b.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	getRandom := GetRandom{BytesRequested: 32}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := getRandom.Execute(thetpm); err != nil {
+			b.Fatalf("GetRandom failed: %v", err)
+		}
+	}
+}
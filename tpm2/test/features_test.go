@@ -0,0 +1,94 @@
+package tpm2test
+
+import (
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestGetFeatures(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	f, err := GetFeatures(thetpm)
+	if err != nil {
+		t.Fatalf("GetFeatures: %v", err)
+	}
+	for _, cc := range []TPMCC{TPMCCCreatePrimary, TPMCCCreateLoaded, TPMCCGetCapability} {
+		if !f.HasCommand(cc) {
+			t.Errorf("HasCommand(%v) = false", cc)
+		}
+	}
+	if f.HasCommand(TPMCC(0x1ff)) {
+		t.Errorf("HasCommand(0x1ff) = true")
+	}
+	if !f.HasAlgorithm(TPMAlgSHA256) || !f.HasAlgorithm(TPMAlgECC) {
+		t.Errorf("SHA-256 or ECC not reported")
+	}
+	if !f.HasCurve(TPMECCNistP256) {
+		t.Errorf("HasCurve(P-256) = false")
+	}
+	if f.HasCurve(TPMECCCurve(0x7f)) {
+		t.Errorf("HasCurve(0x7f) = true")
+	}
+}
+
+func TestCreateKey(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	srk, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(ECCSRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+
+	features, err := GetFeatures(thetpm)
+	if err != nil {
+		t.Fatalf("GetFeatures: %v", err)
+	}
+	for _, tc := range []struct {
+		name     string
+		features *Features
+	}{
+		{"CreateLoaded", features},
+		{"CreateAndLoad", &Features{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			key, pub, err := CreateKey(thetpm, tc.features, AuthHandle{
+				Handle: srk.ObjectHandle,
+				Name:   srk.Name,
+				Auth:   PasswordAuth(nil),
+			}, &ECCSRKTemplate, nil)
+			if err != nil {
+				t.Fatalf("CreateKey: %v", err)
+			}
+			defer FlushContext{FlushHandle: key.Handle}.Execute(thetpm)
+			rsp, err := ReadPublic{ObjectHandle: key.Handle}.Execute(thetpm)
+			if err != nil {
+				t.Fatalf("ReadPublic: %v", err)
+			}
+			contents, err := pub.Contents()
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			name, err := ObjectName(contents)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if string(rsp.Name.Buffer) != string(key.Name.Buffer) || string(name.Buffer) != string(key.Name.Buffer) {
+				t.Errorf("returned name and public area don't match the loaded key")
+			}
+		})
+	}
+}
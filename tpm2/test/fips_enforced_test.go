@@ -0,0 +1,35 @@
+//go:build tpm2fips
+
+package tpm2test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestFIPSEnforced(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	if !FIPSEnforced() {
+		t.Fatal("FIPSEnforced() = false in a tpm2fips build")
+	}
+	sha1Name := ECCSRKTemplate
+	sha1Name.NameAlg = TPMAlgSHA1
+	if _, err := (CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(sha1Name),
+	}).Execute(thetpm); !errors.Is(err, ErrNotFIPSApproved) {
+		t.Errorf("CreatePrimary with a SHA-1 name = %v, want %v", err, ErrNotFIPSApproved)
+	}
+	sess := HMAC(TPMAlgSHA1, 16)
+	if _, err := (GetRandom{BytesRequested: 16}).Execute(thetpm, sess); !errors.Is(err, ErrNotFIPSApproved) {
+		t.Errorf("GetRandom with a SHA-1 session = %v, want %v", err, ErrNotFIPSApproved)
+	}
+}
@@ -0,0 +1,126 @@
+package tpm2test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestCheckFIPSTemplate(t *testing.T) {
+	rsa1024 := RSASRKTemplate
+	rsa1024.Parameters = NewTPMUPublicParms(TPMAlgRSA, &TPMSRSAParms{
+		Symmetric: TPMTSymDefObject{Algorithm: TPMAlgNull},
+		KeyBits:   1024,
+	})
+	sha1Name := ECCSRKTemplate
+	sha1Name.NameAlg = TPMAlgSHA1
+	bnCurve := ECCSRKTemplate
+	bnCurve.Parameters = NewTPMUPublicParms(TPMAlgECC, &TPMSECCParms{
+		Symmetric: TPMTSymDefObject{Algorithm: TPMAlgNull},
+		CurveID:   TPMECCBNP256,
+	})
+	rsaes := RSASRKTemplate
+	rsaes.Parameters = NewTPMUPublicParms(TPMAlgRSA, &TPMSRSAParms{
+		Symmetric: TPMTSymDefObject{Algorithm: TPMAlgNull},
+		Scheme: TPMTRSAScheme{
+			Scheme:  TPMAlgRSAES,
+			Details: NewTPMUAsymScheme(TPMAlgRSAES, &TPMSEncSchemeRSAES{}),
+		},
+		KeyBits: 2048,
+	})
+	ecdsaSHA1 := ECCSRKTemplate
+	ecdsaSHA1.Parameters = NewTPMUPublicParms(TPMAlgECC, &TPMSECCParms{
+		Symmetric: TPMTSymDefObject{Algorithm: TPMAlgNull},
+		Scheme: TPMTECCScheme{
+			Scheme: TPMAlgECDSA,
+			Details: NewTPMUAsymScheme(TPMAlgECDSA,
+				&TPMSSigSchemeECDSA{HashAlg: TPMAlgSHA1}),
+		},
+		CurveID: TPMECCNistP256,
+	})
+	hmacKey := TPMTPublic{
+		Type:    TPMAlgKeyedHash,
+		NameAlg: TPMAlgSHA256,
+		Parameters: NewTPMUPublicParms(TPMAlgKeyedHash, &TPMSKeyedHashParms{
+			Scheme: TPMTKeyedHashScheme{
+				Scheme: TPMAlgHMAC,
+				Details: NewTPMUSchemeKeyedHash(TPMAlgHMAC,
+					&TPMSSchemeHMAC{HashAlg: TPMAlgSHA384}),
+			},
+		}),
+	}
+
+	for _, tc := range []struct {
+		name     string
+		template TPMTPublic
+		approved bool
+	}{
+		{"RSASRK", RSASRKTemplate, true},
+		{"ECCSRK", ECCSRKTemplate, true},
+		{"RSAEK", RSAEKTemplate, true},
+		{"HMAC", hmacKey, true},
+		{"SealedData", TPMTPublic{Type: TPMAlgKeyedHash, NameAlg: TPMAlgSHA256}, true},
+		{"RSA1024", rsa1024, false},
+		{"SHA1Name", sha1Name, false},
+		{"BNCurve", bnCurve, false},
+		{"RSAES", rsaes, false},
+		{"ECDSASHA1", ecdsaSHA1, false},
+		{"XOR", DerivationParentTemplate, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckFIPSTemplate(&tc.template)
+			if tc.approved && err != nil {
+				t.Errorf("CheckFIPSTemplate() = %v", err)
+			}
+			if !tc.approved && !errors.Is(err, ErrNotFIPSApproved) {
+				t.Errorf("CheckFIPSTemplate() = %v, want %v", err, ErrNotFIPSApproved)
+			}
+		})
+	}
+}
+
+func TestFIPSSession(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	srk, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(ECCSRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+	srkPub, err := srk.OutPublic.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	sess := HMAC(TPMAlgSHA256, 16, Salted(srk.ObjectHandle, *srkPub),
+		AESEncryption(128, EncryptOut), FIPS())
+	if _, err := (GetRandom{BytesRequested: 16}).Execute(thetpm, sess); err != nil {
+		t.Errorf("GetRandom with a FIPS session: %v", err)
+	}
+
+	sess = HMAC(TPMAlgSHA1, 16, FIPS())
+	if _, err := (GetRandom{BytesRequested: 16}).Execute(thetpm, sess); !errors.Is(err, ErrNotFIPSApproved) {
+		t.Errorf("GetRandom with a SHA-1 FIPS session = %v, want %v", err, ErrNotFIPSApproved)
+	}
+}
+
+func TestTPMFIPSMode(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	if _, err := TPMFIPSMode(thetpm); err != nil {
+		t.Errorf("TPMFIPSMode: %v", err)
+	}
+}
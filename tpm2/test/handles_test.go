@@ -0,0 +1,129 @@
+package tpm2test
+
+import (
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestGetHandles(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	var want []TPMHandle
+	for i := 0; i < 2; i++ {
+		rsp, err := CreatePrimary{
+			PrimaryHandle: TPMRHOwner,
+			InPublic:      New2B(ECCSRKTemplate),
+		}.Execute(thetpm)
+		if err != nil {
+			t.Fatalf("CreatePrimary: %v", err)
+		}
+		defer FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm)
+		want = append(want, rsp.ObjectHandle)
+	}
+
+	got, err := GetHandles(thetpm, TPMHTTransient)
+	if err != nil {
+		t.Fatalf("GetHandles: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("GetHandles() = %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("GetHandles()[%d] = 0x%x, want 0x%x", i, got[i], want[i])
+		}
+	}
+
+	// Loaded sessions are listed together, whatever their kind.
+	_, closeHMAC, err := HMACSession(thetpm, TPMAlgSHA256, 16)
+	if err != nil {
+		t.Fatalf("HMACSession: %v", err)
+	}
+	defer closeHMAC()
+	_, closePolicy, err := PolicySession(thetpm, TPMAlgSHA256, 16)
+	if err != nil {
+		t.Fatalf("PolicySession: %v", err)
+	}
+	defer closePolicy()
+	sessions, err := GetHandles(thetpm, TPMHTHMACSession)
+	if err != nil {
+		t.Fatalf("GetHandles: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Errorf("GetHandles(TPMHTHMACSession) = %x, want 2 sessions", sessions)
+	}
+
+	persistent, err := GetHandles(thetpm, TPMHTPersistent)
+	if err != nil {
+		t.Fatalf("GetHandles: %v", err)
+	}
+	if len(persistent) != 0 {
+		t.Errorf("GetHandles(TPMHTPersistent) = %v, want none", persistent)
+	}
+}
+
+func TestFlushAll(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	// Leave behind what a crashed process might: objects, loaded sessions
+	// of both kinds, and a saved session.
+	for i := 0; i < 3; i++ {
+		if _, err := (CreatePrimary{
+			PrimaryHandle: TPMRHOwner,
+			InPublic:      New2B(ECCSRKTemplate),
+		}).Execute(thetpm); err != nil {
+			t.Fatalf("CreatePrimary: %v", err)
+		}
+	}
+	if _, _, err := HMACSession(thetpm, TPMAlgSHA256, 16); err != nil {
+		t.Fatalf("HMACSession: %v", err)
+	}
+	if _, _, err := PolicySession(thetpm, TPMAlgSHA256, 16); err != nil {
+		t.Fatalf("PolicySession: %v", err)
+	}
+	saved, _, err := HMACSession(thetpm, TPMAlgSHA256, 16)
+	if err != nil {
+		t.Fatalf("HMACSession: %v", err)
+	}
+	if _, err := (ContextSave{SaveHandle: saved.Handle()}).Execute(thetpm); err != nil {
+		t.Fatalf("ContextSave: %v", err)
+	}
+
+	flushed, err := FlushAllTransient(thetpm)
+	if err != nil {
+		t.Fatalf("FlushAllTransient: %v", err)
+	}
+	if len(flushed) != 3 {
+		t.Errorf("FlushAllTransient() = %x, want 3 objects", flushed)
+	}
+	flushed, err = FlushAllSessions(thetpm)
+	if err != nil {
+		t.Fatalf("FlushAllSessions: %v", err)
+	}
+	if len(flushed) != 3 {
+		t.Errorf("FlushAllSessions() = %x, want 3 sessions", flushed)
+	}
+
+	for _, ht := range []TPMHT{TPMHTTransient, TPMHTHMACSession, TPMHTPolicySession} {
+		left, err := GetHandles(thetpm, ht)
+		if err != nil {
+			t.Fatalf("GetHandles: %v", err)
+		}
+		if len(left) != 0 {
+			t.Errorf("GetHandles(0x%x) = %x after flushing, want none", ht, left)
+		}
+	}
+	if flushed, err := FlushAllSessions(thetpm); err != nil || len(flushed) != 0 {
+		t.Errorf("FlushAllSessions() on an empty TPM = %x, %v", flushed, err)
+	}
+}
@@ -0,0 +1,79 @@
+package tpm2test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestNegotiateHashAlg(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	for _, tc := range []struct {
+		name  string
+		prefs []TPMIAlgHash
+		want  TPMIAlgHash
+	}{
+		{"Default", nil, TPMAlgSHA256},
+		{"SHA384", []TPMIAlgHash{TPMAlgSHA384, TPMAlgSHA256}, TPMAlgSHA384},
+		// There is no SM3 implementation to compute digests with.
+		{"SM3", []TPMIAlgHash{TPMAlgSM3256, TPMAlgSHA512}, TPMAlgSHA512},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NegotiateHashAlg(thetpm, tc.prefs...)
+			if err != nil {
+				t.Fatalf("NegotiateHashAlg: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("NegotiateHashAlg() = %#x, want %#x", got, tc.want)
+			}
+		})
+	}
+	if _, err := NegotiateHashAlg(thetpm, TPMIAlgHash(0x7f)); !errors.Is(err, ErrNoHashAlg) {
+		t.Errorf("NegotiateHashAlg(0x7f) = %v, want %v", err, ErrNoHashAlg)
+	}
+
+	// The zero Features implements nothing.
+	var f Features
+	if _, err := f.HashAlg(); !errors.Is(err, ErrNoHashAlg) {
+		t.Errorf("Features{}.HashAlg() = %v, want %v", err, ErrNoHashAlg)
+	}
+}
+
+func TestNameHashAlg(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	for _, alg := range []TPMIAlgHash{TPMAlgSHA256, TPMAlgSHA384} {
+		template := ECCSRKTemplate
+		template.NameAlg = alg
+		srk, err := CreatePrimary{
+			PrimaryHandle: TPMRHOwner,
+			InPublic:      New2B(template),
+		}.Execute(thetpm)
+		if err != nil {
+			t.Fatalf("CreatePrimary: %v", err)
+		}
+		got, err := NameHashAlg(srk.Name)
+		FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+		if err != nil {
+			t.Fatalf("NameHashAlg: %v", err)
+		}
+		if got != alg {
+			t.Errorf("NameHashAlg() = %#x, want %#x", got, alg)
+		}
+	}
+
+	if _, err := NameHashAlg(HandleName(TPMRHOwner)); err == nil {
+		t.Error("NameHashAlg() of a hierarchy succeeded, want error")
+	}
+}
@@ -0,0 +1,201 @@
+package tpm2test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestHashData(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	profile := Profile{Type: TPMAlgECC, Curve: TPMECCNistP256, Hash: TPMAlgSHA256}
+	ak, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(profile.AKTemplate()),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("could not create AK: %v", err)
+	}
+	defer FlushContext{FlushHandle: ak.ObjectHandle}.Execute(thetpm)
+	sign := func(digest []byte, ticket TPMTTKHashCheck) error {
+		_, err := Sign{
+			KeyHandle: AuthHandle{
+				Handle: ak.ObjectHandle,
+				Name:   ak.Name,
+				Auth:   PasswordAuth(nil),
+			},
+			Digest:     TPM2BDigest{Buffer: digest},
+			InScheme:   TPMTSigScheme{Scheme: TPMAlgNull},
+			Validation: ticket,
+		}.Execute(thetpm)
+		return err
+	}
+
+	for _, size := range []int{0, 1024, 1025, 5000} {
+		data := bytes.Repeat([]byte{0x5a}, size)
+		want := sha256.Sum256(data)
+
+		digest, ticket, err := HashData(thetpm, TPMAlgSHA256, data)
+		if err != nil {
+			t.Fatalf("HashData(%d bytes): %v", size, err)
+		}
+		if !bytes.Equal(digest, want[:]) {
+			t.Errorf("HashData(%d bytes) = %x, want %x", size, digest, want)
+		}
+		if ticket.Hierarchy != TPMRHOwner {
+			t.Errorf("HashData(%d bytes) ticket hierarchy = %v, want %v", size, ticket.Hierarchy, TPMRHOwner)
+		}
+		// The restricted AK signs the digest with its ticket, and not
+		// without one.
+		if err := sign(digest, *ticket); err != nil {
+			t.Errorf("Sign(%d-byte data with ticket): %v", size, err)
+		}
+		if err := sign(digest, NullTicket()); err == nil {
+			t.Errorf("Sign(%d-byte data without ticket) succeeded", size)
+		}
+
+		digest, ticket, err = HashData(thetpm, TPMAlgSHA256, data, HashWithoutTicket())
+		if err != nil {
+			t.Fatalf("HashData(%d bytes, HashWithoutTicket): %v", size, err)
+		}
+		if !bytes.Equal(digest, want[:]) {
+			t.Errorf("HashData(%d bytes, HashWithoutTicket) = %x, want %x", size, digest, want)
+		}
+		if ticket.Hierarchy != TPMRHNull {
+			t.Errorf("HashData(%d bytes, HashWithoutTicket) ticket hierarchy = %v, want %v", size, ticket.Hierarchy, TPMRHNull)
+		}
+	}
+
+	// The ticket may come from any enabled hierarchy.
+	digest, ticket, err := HashData(thetpm, TPMAlgSHA256, []byte("data"), HashHierarchy(TPMRHEndorsement))
+	if err != nil {
+		t.Fatalf("HashData(HashHierarchy(endorsement)): %v", err)
+	}
+	if ticket.Hierarchy != TPMRHEndorsement {
+		t.Errorf("ticket hierarchy = %v, want %v", ticket.Hierarchy, TPMRHEndorsement)
+	}
+	if err := sign(digest, *ticket); err != nil {
+		t.Errorf("Sign with an endorsement ticket: %v", err)
+	}
+
+	// Data that could pass for an attestation gets no ticket.
+	generated := binary.BigEndian.AppendUint32(nil, uint32(TPMGeneratedValue))
+	for _, size := range []int{16, 2000} {
+		data := append(generated, make([]byte, size)...)
+		if _, _, err := HashData(thetpm, TPMAlgSHA256, data); !errors.Is(err, ErrNoTicket) {
+			t.Errorf("HashData(TPM_GENERATED_VALUE, %d bytes) = %v, want %v", size, err, ErrNoTicket)
+		}
+		if _, _, err := HashData(thetpm, TPMAlgSHA256, data, HashWithoutTicket()); err != nil {
+			t.Errorf("HashData(TPM_GENERATED_VALUE, %d bytes, HashWithoutTicket): %v", size, err)
+		}
+	}
+}
+
+func TestSequenceWriter(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	want := sha256.Sum256(data)
+
+	// Writes of every size are split into pieces the TPM accepts.
+	for _, writeSize := range []int{1, 100, 1024, 1500, len(data)} {
+		w, err := NewHashWriter(thetpm, TPMAlgSHA256)
+		if err != nil {
+			t.Fatalf("NewHashWriter: %v", err)
+		}
+		for p := data; len(p) > 0; {
+			n := min(writeSize, len(p))
+			if _, err := w.Write(p[:n]); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			p = p[n:]
+		}
+		digest, ticket, err := w.Sum()
+		if err != nil {
+			t.Fatalf("Sum: %v", err)
+		}
+		if !bytes.Equal(digest, want[:]) {
+			t.Errorf("%d-byte writes: digest %x, want %x", writeSize, digest, want)
+		}
+		if ticket.Hierarchy != TPMRHOwner {
+			t.Errorf("%d-byte writes: ticket hierarchy = %v, want %v", writeSize, ticket.Hierarchy, TPMRHOwner)
+		}
+		if _, err := w.Write([]byte("more")); err == nil {
+			t.Errorf("Write after Sum succeeded")
+		}
+	}
+
+	// An event sequence extends a PCR with the digest of the data.
+	const pcr = 16
+	pcrHandle := AuthHandle{Handle: TPMHandle(pcr), Auth: PasswordAuth(nil)}
+	if _, err := (PCRReset{PCRHandle: pcrHandle}).Execute(thetpm); err != nil {
+		t.Fatalf("PCRReset: %v", err)
+	}
+	w, err := NewEventWriter(thetpm)
+	if err != nil {
+		t.Fatalf("NewEventWriter: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, _, err := w.Sum(); err == nil {
+		t.Errorf("Sum on an event sequence succeeded")
+	}
+	digests, err := w.Extend(pcrHandle)
+	if err != nil {
+		t.Fatalf("Extend: %v", err)
+	}
+	var found bool
+	for _, d := range digests.Digests {
+		if d.HashAlg == TPMAlgSHA256 {
+			found = true
+			if !bytes.Equal(d.Digest, want[:]) {
+				t.Errorf("SHA-256 event digest = %x, want %x", d.Digest, want)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("no SHA-256 event digest in %+v", digests)
+	}
+	sel := TPMLPCRSelection{PCRSelections: []TPMSPCRSelection{{
+		Hash:      TPMAlgSHA256,
+		PCRSelect: PCClientCompatible.PCRs(pcr),
+	}}}
+	vals, err := ReadPCRs(thetpm, sel)
+	if err != nil {
+		t.Fatalf("ReadPCRs: %v", err)
+	}
+	wantPCR := sha256.Sum256(append(make([]byte, sha256.Size), want[:]...))
+	if got := vals[TPMAlgSHA256][pcr]; !bytes.Equal(got, wantPCR[:]) {
+		t.Errorf("PCR %d = %x, want %x", pcr, got, wantPCR)
+	}
+
+	// A discarded sequence is flushed.
+	w, err = NewHashWriter(thetpm, TPMAlgSHA256)
+	if err != nil {
+		t.Fatalf("NewHashWriter: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
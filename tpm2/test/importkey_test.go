@@ -0,0 +1,138 @@
+package tpm2test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestImportPEM(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	pkcs8 := func(key crypto.PrivateKey) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	digest := sha256.Sum256([]byte("imported"))
+	auth := []byte("imported-key")
+	for _, tc := range []struct {
+		name   string
+		pem    []byte
+		scheme TPMTSigScheme
+		verify func(*TPMTSignature) error
+	}{
+		{
+			name:   "PKCS8RSA",
+			pem:    pkcs8(rsaKey),
+			scheme: TPMTSigScheme{Scheme: TPMAlgRSASSA, Details: NewTPMUSigScheme(TPMAlgRSASSA, &TPMSSchemeHash{HashAlg: TPMAlgSHA256})},
+			verify: func(sig *TPMTSignature) error {
+				rsassa, err := sig.Signature.RSASSA()
+				if err != nil {
+					return err
+				}
+				return rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest[:], rsassa.Sig.Buffer)
+			},
+		},
+		{
+			name:   "PKCS1RSA",
+			pem:    pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+			scheme: TPMTSigScheme{Scheme: TPMAlgRSAPSS, Details: NewTPMUSigScheme(TPMAlgRSAPSS, &TPMSSchemeHash{HashAlg: TPMAlgSHA256})},
+			verify: func(sig *TPMTSignature) error {
+				pss, err := sig.Signature.RSAPSS()
+				if err != nil {
+					return err
+				}
+				return rsa.VerifyPSS(&rsaKey.PublicKey, crypto.SHA256, digest[:], pss.Sig.Buffer, nil)
+			},
+		},
+		{
+			name:   "SEC1ECDSA",
+			pem:    pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}),
+			scheme: TPMTSigScheme{Scheme: TPMAlgECDSA, Details: NewTPMUSigScheme(TPMAlgECDSA, &TPMSSchemeHash{HashAlg: TPMAlgSHA256})},
+			verify: func(sig *TPMTSignature) error {
+				ecc, err := sig.Signature.ECDSA()
+				if err != nil {
+					return err
+				}
+				if !ecdsa.Verify(&ecKey.PublicKey, digest[:], new(big.Int).SetBytes(ecc.SignatureR.Buffer), new(big.Int).SetBytes(ecc.SignatureS.Buffer)) {
+					return errors.New("ECDSA signature did not verify")
+				}
+				return nil
+			},
+		},
+	} {
+		for srkName, srkTemplate := range map[string]TPMTPublic{
+			"ECCSRK": ECCSRKTemplate,
+			"RSASRK": RSASRKTemplate,
+		} {
+			t.Run(tc.name+"/"+srkName, func(t *testing.T) {
+				srk, err := CreatePrimary{
+					PrimaryHandle: TPMRHOwner,
+					InPublic:      New2B(srkTemplate),
+				}.Execute(thetpm)
+				if err != nil {
+					t.Fatalf("CreatePrimary: %v", err)
+				}
+				defer FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+
+				key, err := ImportPEM(thetpm, AuthHandle{Handle: srk.ObjectHandle, Auth: PasswordAuth(nil)}, tc.pem, auth)
+				if err != nil {
+					t.Fatalf("ImportPEM: %v", err)
+				}
+				defer FlushContext{FlushHandle: key.Handle.Handle}.Execute(thetpm)
+
+				rsp, err := Sign{
+					KeyHandle: AuthHandle{
+						Handle: key.Handle.Handle,
+						Name:   key.Handle.Name,
+						Auth:   PasswordAuth(auth),
+					},
+					Digest:     TPM2BDigest{Buffer: digest[:]},
+					InScheme:   tc.scheme,
+					Validation: TPMTTKHashCheck{Tag: TPMSTHashCheck},
+				}.Execute(thetpm)
+				if err != nil {
+					t.Fatalf("Sign: %v", err)
+				}
+				if err := tc.verify(&rsp.Signature); err != nil {
+					t.Errorf("signature by imported key: %v", err)
+				}
+			})
+		}
+	}
+
+	if _, err := ImportPEM(thetpm, AuthHandle{Handle: TPMRHOwner}, []byte("not PEM"), nil); err == nil {
+		t.Error("ImportPEM(garbage) succeeded, want an error")
+	}
+}
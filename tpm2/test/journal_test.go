@@ -0,0 +1,196 @@
+package tpm2test
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestJournal(t *testing.T) {
+	sim, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer sim.Close()
+
+	policy := func(tpm transport.TPM, handle TPMISHPolicy, _ TPM2BNonce) error {
+		_, err := PolicyCommandCode{
+			PolicySession: handle,
+			Code:          TPMCCSign,
+		}.Execute(tpm)
+		return err
+	}
+	trial, cleanup, err := PolicySession(sim, TPMAlgSHA256, 16, Trial())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := policy(sim, trial.Handle(), TPM2BNonce{}); err != nil {
+		t.Fatalf("%v", err)
+	}
+	digest, err := PolicyGetDigest{PolicySession: trial.Handle()}.Execute(sim)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	cleanup()
+
+	j := NewJournal(sim)
+	key, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic: New2B(TPMTPublic{
+			Type:    TPMAlgECC,
+			NameAlg: TPMAlgSHA256,
+			ObjectAttributes: TPMAObject{
+				SignEncrypt:         true,
+				FixedTPM:            true,
+				FixedParent:         true,
+				SensitiveDataOrigin: true,
+			},
+			AuthPolicy: digest.PolicyDigest,
+			Parameters: NewTPMUPublicParms(TPMAlgECC, &TPMSECCParms{
+				Scheme: TPMTECCScheme{
+					Scheme:  TPMAlgECDSA,
+					Details: NewTPMUAsymScheme(TPMAlgECDSA, &TPMSSigSchemeECDSA{HashAlg: TPMAlgSHA256}),
+				},
+				CurveID: TPMECCNistP256,
+			}),
+		}),
+	}.Execute(j)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer FlushContext{FlushHandle: key.ObjectHandle}.Execute(sim)
+
+	sign := Sign{
+		KeyHandle: AuthHandle{
+			Handle: key.ObjectHandle,
+			Name:   key.Name,
+			Auth:   Policy(TPMAlgSHA256, 16, policy),
+		},
+		Digest:     TPM2BDigest{Buffer: make([]byte, 32)},
+		Validation: TPMTTKHashCheck{Tag: TPMSTHashCheck},
+	}
+	if _, err := sign.Execute(j); err != nil {
+		t.Fatalf("Sign with policy: %v", err)
+	}
+	// The key has no user auth role, so a password is refused.
+	sign.KeyHandle = AuthHandle{Handle: key.ObjectHandle, Name: key.Name, Auth: PasswordAuth(nil)}
+	if _, err := sign.Execute(j); !errors.Is(err, TPMRCAuthUnavailable) {
+		t.Fatalf("Sign with password: got %v, want %v", err, TPMRCAuthUnavailable)
+	}
+	// Raw commands are recorded too.
+	raw := []byte{0x80, 0x01, 0, 0, 0, 12, 0, 0, 0x01, 0x7b, 0, 8}
+	if _, err := j.Send(raw); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var signs []JournalEntry
+	var policyCmds int
+	entries := j.Entries()
+	for _, e := range entries {
+		switch e.Command {
+		case "Sign":
+			signs = append(signs, e)
+		case "PolicyCommandCode":
+			policyCmds++
+		}
+	}
+	if policyCmds != 1 || len(signs) != 2 {
+		t.Fatalf("journal has %d PolicyCommandCode and %d Sign entries, want 1 and 2", policyCmds, len(signs))
+	}
+
+	keyName := hex.EncodeToString(key.Name.Buffer)
+	ok := signs[0]
+	if !reflect.DeepEqual(ok.Handles, []TPMHandle{key.ObjectHandle}) || !reflect.DeepEqual(ok.Names, []string{keyName}) {
+		t.Errorf("Sign entry references %v %v, want %v %v", ok.Handles, ok.Names, key.ObjectHandle, keyName)
+	}
+	if ok.ResponseCode != TPMRCSuccess || ok.Error != "" {
+		t.Errorf("Sign entry result = %v %q, want success", ok.ResponseCode, ok.Error)
+	}
+	if len(ok.Sessions) != 1 || ok.Sessions[0].Kind != "policy" || !reflect.DeepEqual(ok.Sessions[0].Policy, []string{"PolicyCommandCode"}) {
+		t.Errorf("Sign entry sessions = %+v, want one policy session satisfying PolicyCommandCode", ok.Sessions)
+	}
+
+	refused := signs[1]
+	if !errors.Is(refused.ResponseCode, TPMRCAuthUnavailable) || refused.Error == "" {
+		t.Errorf("refused Sign entry result = %v %q", refused.ResponseCode, refused.Error)
+	}
+	if len(refused.Sessions) != 1 || refused.Sessions[0].Kind != "password" || refused.Sessions[0].Handle != TPMRSPW {
+		t.Errorf("refused Sign entry sessions = %+v, want one password session", refused.Sessions)
+	}
+
+	last := entries[len(entries)-1]
+	if last.Command != "" || last.CommandCode != TPMCC(binary.BigEndian.Uint32(raw[6:])) || last.ResponseCode != TPMRCSuccess {
+		t.Errorf("raw entry = %+v", last)
+	}
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	var decoded []JournalEntry
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(decoded) != len(entries) || !reflect.DeepEqual(decoded[len(decoded)-2].Sessions, refused.Sessions) {
+		t.Errorf("JSON round trip lost entries:\n%s", data)
+	}
+}
+
+func TestJournalWrapped(t *testing.T) {
+	sim, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer sim.Close()
+	j := NewJournal(sim)
+	sent := 0
+	wrapped := transport.Chain(j, func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+		sent++
+		return next(cmd)
+	})
+
+	// Commands executed through a wrapper are recorded in full, and still
+	// go through the wrapper.
+	if _, err := (GetRandom{BytesRequested: 8}).Execute(wrapped); err != nil {
+		t.Fatalf("GetRandom: %v", err)
+	}
+	rsp, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(ECCSRKTemplate),
+	}.Execute(wrapped)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(sim)
+	if sent != 2 {
+		t.Errorf("%d commands went through the wrapper, want 2", sent)
+	}
+	entries := j.Entries()
+	if len(entries) != 2 || entries[0].Command != "GetRandom" || entries[1].Command != "CreatePrimary" {
+		t.Fatalf("journal entries = %+v, want GetRandom and CreatePrimary", entries)
+	}
+	if len(entries[1].Sessions) != 1 || entries[1].Sessions[0].Kind != "password" {
+		t.Errorf("CreatePrimary entry sessions = %+v, want one password session", entries[1].Sessions)
+	}
+
+	// A command that a wrapper answers itself is not recorded.
+	refuse := transport.Chain(j, func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+		return nil, errors.New("refused")
+	})
+	if _, err := (GetRandom{BytesRequested: 8}).Execute(refuse); err == nil {
+		t.Fatal("GetRandom through a refusing wrapper succeeded")
+	}
+	if _, err := j.Send([]byte{0x80, 0x01, 0, 0, 0, 12, 0, 0, 0x01, 0x7b, 0, 8}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if entries := j.Entries(); len(entries) != 3 || entries[2].Command != "" {
+		t.Errorf("journal entries after a refused command = %+v, want a third, raw one", entries)
+	}
+}
@@ -0,0 +1,107 @@
+package tpm2test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestKeyBlobFiles(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	srk, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(ECCSRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+	parent := AuthHandle{Handle: srk.ObjectHandle, Name: srk.Name, Auth: PasswordAuth(nil)}
+
+	features, err := GetFeatures(thetpm)
+	if err != nil {
+		t.Fatalf("GetFeatures: %v", err)
+	}
+	for _, tc := range []struct {
+		name     string
+		features *Features
+	}{
+		{"CreateLoaded", features},
+		{"CreateAndLoad", &Features{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			key, blob, err := CreateKeyBlob(thetpm, tc.features, parent, &ECCSRKTemplate, nil)
+			if err != nil {
+				t.Fatalf("CreateKeyBlob: %v", err)
+			}
+			FlushContext{FlushHandle: key.Handle}.Execute(thetpm)
+
+			dir := t.TempDir()
+			pubFile, privFile := filepath.Join(dir, "key.pub"), filepath.Join(dir, "key.priv")
+			if err := blob.WriteFiles(pubFile, privFile); err != nil {
+				t.Fatalf("WriteFiles: %v", err)
+			}
+			// The files hold a TPM2B_PUBLIC and a TPM2B_PRIVATE, each
+			// starting with the size of the rest.
+			for _, file := range []string{pubFile, privFile} {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatalf("ReadFile: %v", err)
+				}
+				if len(data) < 2 || int(binary.BigEndian.Uint16(data)) != len(data)-2 {
+					t.Errorf("%s is not a TPM2B: %x", filepath.Base(file), data)
+				}
+			}
+			if fi, err := os.Stat(privFile); err != nil || fi.Mode().Perm() != 0o600 {
+				t.Errorf("key.priv has mode %v, %v, want %v", fi.Mode().Perm(), err, os.FileMode(0o600))
+			}
+
+			read, err := ReadKeyBlob(pubFile, privFile)
+			if err != nil {
+				t.Fatalf("ReadKeyBlob: %v", err)
+			}
+			loaded, err := read.Load(thetpm, parent)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			defer FlushContext{FlushHandle: loaded.Handle}.Execute(thetpm)
+			if !bytes.Equal(loaded.Name.Buffer, key.Name.Buffer) {
+				t.Errorf("reloaded key has Name %x, want %x", loaded.Name.Buffer, key.Name.Buffer)
+			}
+		})
+	}
+}
+
+func TestParseKeyBlobErrors(t *testing.T) {
+	pub := Marshal(New2B(ECCSRKTemplate))
+	priv := Marshal(TPM2BPrivate{Buffer: []byte{1, 2, 3}})
+	if _, err := ParseKeyBlob(pub, priv); err != nil {
+		t.Fatalf("ParseKeyBlob: %v", err)
+	}
+	for _, tc := range []struct {
+		name      string
+		pub, priv []byte
+	}{
+		{"TruncatedPublic", pub[:len(pub)-1], priv},
+		{"TrailingPublic", append(pub[:len(pub):len(pub)], 0), priv},
+		{"TruncatedPrivate", pub, priv[:len(priv)-1]},
+		{"TrailingPrivate", pub, append(priv[:len(priv):len(priv)], 0)},
+		{"Empty", nil, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseKeyBlob(tc.pub, tc.priv); err == nil {
+				t.Error("ParseKeyBlob succeeded, want error")
+			}
+		})
+	}
+}
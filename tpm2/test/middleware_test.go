@@ -0,0 +1,73 @@
+package tpm2test
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestChain(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	var calls []string
+	// record logs the command and response codes it sees.
+	record := func(name string) transport.Interceptor {
+		return func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+			calls = append(calls, fmt.Sprintf("%s %#x", name, binary.BigEndian.Uint32(cmd[6:10])))
+			rsp, err := next(cmd)
+			if err == nil {
+				calls = append(calls, fmt.Sprintf("%s %#x", name, binary.BigEndian.Uint32(rsp[6:10])))
+			}
+			return rsp, err
+		}
+	}
+	// failRandom answers TPM2_GetRandom with TPM_RC_FAILURE.
+	failRandom := func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+		if TPMCC(binary.BigEndian.Uint32(cmd[6:10])) != TPMCCGetRandom {
+			return next(cmd)
+		}
+		rsp := []byte{0x80, 0x01, 0, 0, 0, 10, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(rsp[6:], uint32(TPMRCFailure))
+		return rsp, nil
+	}
+	tpm := transport.Chain(thetpm, record("outer"), failRandom, record("inner"))
+
+	if _, err := (GetRandom{BytesRequested: 8}).Execute(tpm); !errors.Is(err, TPMRCFailure) {
+		t.Errorf("GetRandom() = %v, want %v", err, TPMRCFailure)
+	}
+	if _, err := (ReadPublic{ObjectHandle: 0x80ffffff}).Execute(tpm); !errors.Is(err, TPMRCValue) {
+		t.Errorf("ReadPublic() = %v, want %v", err, TPMRCValue)
+	}
+	want := []string{
+		fmt.Sprintf("outer %#x", TPMCCGetRandom),
+		fmt.Sprintf("outer %#x", uint32(TPMRCFailure)),
+		fmt.Sprintf("outer %#x", TPMCCReadPublic),
+		fmt.Sprintf("inner %#x", TPMCCReadPublic),
+		// TPM_RC_VALUE for the first handle.
+		fmt.Sprintf("inner %#x", uint32(TPMRCValue)|1<<8),
+		fmt.Sprintf("outer %#x", uint32(TPMRCValue)|1<<8),
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("interceptors saw %q, want %q", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("interceptors saw %q, want %q", calls, want)
+			break
+		}
+	}
+
+	// With no interceptors, commands go straight to the TPM.
+	if _, err := (GetRandom{BytesRequested: 8}).Execute(transport.Chain(thetpm)); err != nil {
+		t.Errorf("GetRandom: %v", err)
+	}
+}
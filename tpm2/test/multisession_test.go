@@ -0,0 +1,104 @@
+package tpm2test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// TestMultipleSessions certifies a key with three sessions: one HMAC
+// session for each of TPM2_Certify's two authorized handles, and a third
+// for parameter encryption that authorizes nothing.
+func TestMultipleSessions(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	createPrimary := func(template TPMTPublic, auth []byte) *CreatePrimaryResponse {
+		t.Helper()
+		rsp, err := CreatePrimary{
+			PrimaryHandle: TPMRHOwner,
+			InSensitive: TPM2BSensitiveCreate{
+				Sensitive: &TPMSSensitiveCreate{UserAuth: TPM2BAuth{Buffer: auth}},
+			},
+			InPublic: New2B(template),
+		}.Execute(thetpm)
+		if err != nil {
+			t.Fatalf("CreatePrimary: %v", err)
+		}
+		t.Cleanup(func() { FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm) })
+		return rsp
+	}
+	subjectAuth, signerAuth := []byte("subject"), []byte("signer")
+	subject := createPrimary(ECCSRKTemplate, subjectAuth)
+	profile := Profile{Type: TPMAlgECC, Curve: TPMECCNistP256, Hash: TPMAlgSHA256}
+	signer := createPrimary(profile.AKTemplate(), signerAuth)
+
+	for _, tc := range []struct {
+		name  string
+		extra []Session
+	}{
+		{"TwoAuth", nil},
+		{"TwoAuthAndEncryption", []Session{HMAC(TPMAlgSHA256, 16, AESEncryption(128, EncryptInOut))}},
+		// The extra session authorizes no handle, so its auth value
+		// must be left out of its HMAC key.
+		{"TwoAuthAndEncryptionWithAuth", []Session{HMAC(TPMAlgSHA256, 16, AESEncryption(128, EncryptInOut), Auth([]byte("unused")))}},
+		{"TwoAuthAndAudit", []Session{HMAC(TPMAlgSHA384, 16, Audit())}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			qualifyingData := []byte("qualifying data")
+			rsp, err := Certify{
+				ObjectHandle: AuthHandle{
+					Handle: subject.ObjectHandle,
+					Name:   subject.Name,
+					Auth:   HMAC(TPMAlgSHA256, 16, Auth(subjectAuth)),
+				},
+				SignHandle: AuthHandle{
+					Handle: signer.ObjectHandle,
+					Name:   signer.Name,
+					Auth:   HMAC(TPMAlgSHA1, 20, Auth(signerAuth)),
+				},
+				QualifyingData: TPM2BData{Buffer: qualifyingData},
+				InScheme:       TPMTSigScheme{Scheme: TPMAlgNull},
+			}.Execute(thetpm, tc.extra...)
+			if err != nil {
+				t.Fatalf("Certify: %v", err)
+			}
+			attest, err := rsp.CertifyInfo.Contents()
+			if err != nil {
+				t.Fatalf("CertifyInfo: %v", err)
+			}
+			if !bytes.Equal(attest.ExtraData.Buffer, qualifyingData) {
+				t.Errorf("ExtraData = %q, want %q", attest.ExtraData.Buffer, qualifyingData)
+			}
+		})
+	}
+}
+
+func TestMultipleSessionsInvalid(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	for _, tc := range []struct {
+		name string
+		sess []Session
+	}{
+		{"Password", []Session{PasswordAuth(nil)}},
+		{"TwoAudit", []Session{HMAC(TPMAlgSHA256, 16, Audit()), HMAC(TPMAlgSHA256, 16, Audit())}},
+		{"TwoEncrypt", []Session{HMAC(TPMAlgSHA256, 16, AESEncryption(128, EncryptOut)), HMAC(TPMAlgSHA256, 16, AESEncryption(128, EncryptOut))}},
+		{"FourSessions", []Session{HMAC(TPMAlgSHA256, 16), HMAC(TPMAlgSHA256, 16), HMAC(TPMAlgSHA256, 16), HMAC(TPMAlgSHA256, 16)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := (GetRandom{BytesRequested: 8}).Execute(thetpm, tc.sess...); err == nil {
+				t.Errorf("GetRandom() succeeded, want an error")
+			}
+		})
+	}
+}
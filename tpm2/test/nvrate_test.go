@@ -0,0 +1,135 @@
+package tpm2test
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// nvRateTPM fails the first few TPM2_NV_Write commands sent to it with
+// TPM_RC_NV_RATE, as a TPM that is throttling NV writes would.
+type nvRateTPM struct {
+	tpm transport.TPM
+
+	mu       sync.Mutex
+	failures int
+	sent     int
+}
+
+func (n *nvRateTPM) Send(cmd []byte) ([]byte, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if TPMCC(binary.BigEndian.Uint32(cmd[6:10])) == TPMCCNVWrite {
+		n.sent++
+		if n.failures > 0 {
+			n.failures--
+			rsp := make([]byte, 10)
+			binary.BigEndian.PutUint16(rsp, uint16(TPMSTNoSessions))
+			binary.BigEndian.PutUint32(rsp[2:], 10)
+			binary.BigEndian.PutUint32(rsp[6:], uint32(TPMRCNVRate))
+			return rsp, nil
+		}
+	}
+	return n.tpm.Send(cmd)
+}
+
+func TestNVRateLimiter(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	if _, err := NVWriteRecovery(thetpm); err != nil {
+		t.Errorf("NVWriteRecovery: %v", err)
+	}
+
+	def := NVDefineSpace{
+		AuthHandle: TPMRHOwner,
+		PublicInfo: New2B(
+			TPMSNVPublic{
+				NVIndex: TPMHandle(0x01800010),
+				NameAlg: TPMAlgSHA256,
+				Attributes: TPMANV{
+					OwnerWrite: true,
+					OwnerRead:  true,
+					NT:         TPMNTOrdinary,
+					NoDA:       true,
+				},
+				DataSize: 4,
+			}),
+	}
+	if _, err := def.Execute(thetpm); err != nil {
+		t.Fatalf("Calling TPM2_NV_DefineSpace: %v", err)
+	}
+	pub, err := def.PublicInfo.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	nvName, err := NVName(pub)
+	if err != nil {
+		t.Fatalf("Calculating name of NV index: %v", err)
+	}
+	write := NVWrite{
+		AuthHandle: TPMRHOwner,
+		NVIndex:    NamedHandle{Handle: pub.NVIndex, Name: *nvName},
+		Data:       TPM2BMaxNVBuffer{Buffer: []byte{1, 2, 3, 4}},
+	}
+
+	t.Run("Retry", func(t *testing.T) {
+		throttled := &nvRateTPM{tpm: thetpm, failures: 2}
+		if _, err := write.Execute(NewNVRateLimiter(throttled)); err != nil {
+			t.Fatalf("NVWrite: %v", err)
+		}
+		if throttled.sent != 3 {
+			t.Errorf("NVWrite was sent %d times, want 3", throttled.sent)
+		}
+	})
+
+	t.Run("GiveUp", func(t *testing.T) {
+		throttled := &nvRateTPM{tpm: thetpm, failures: 5}
+		limiter := NewNVRateLimiter(throttled)
+		limiter.MaxRetries = 2
+		if _, err := write.Execute(limiter); !errors.Is(err, TPMRCNVRate) {
+			t.Errorf("NVWrite: %v, want %v", err, TPMRCNVRate)
+		}
+		if throttled.sent != 3 {
+			t.Errorf("NVWrite was sent %d times, want 3", throttled.sent)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		throttled := &nvRateTPM{tpm: thetpm, failures: 3}
+		limiter := NewNVRateLimiter(throttled)
+		var wg sync.WaitGroup
+		errs := make(chan error, 4)
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := write.Execute(limiter)
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Errorf("NVWrite: %v", err)
+			}
+		}
+	})
+
+	undefine := NVUndefineSpace{
+		AuthHandle: TPMRHOwner,
+		NVIndex:    NamedHandle{Handle: pub.NVIndex, Name: *nvName},
+	}
+	if _, err := undefine.Execute(thetpm); err != nil {
+		t.Errorf("Calling TPM2_NV_UndefineSpace: %v", err)
+	}
+}
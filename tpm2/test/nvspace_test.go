@@ -0,0 +1,111 @@
+package tpm2test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestNVUsage(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	before, err := GetNVUsage(thetpm)
+	if err != nil {
+		t.Fatalf("GetNVUsage: %v", err)
+	}
+	if before.IndexMax == 0 || before.BufferMax == 0 {
+		t.Errorf("IndexMax = %d, BufferMax = %d, want both set", before.IndexMax, before.BufferMax)
+	}
+
+	pub := TPMSNVPublic{
+		NVIndex: TPMHandle(0x01800010),
+		NameAlg: TPMAlgSHA256,
+		Attributes: TPMANV{
+			OwnerWrite: true,
+			OwnerRead:  true,
+			NT:         TPMNTOrdinary,
+			NoDA:       true,
+		},
+		DataSize: 64,
+	}
+	if err := before.CheckDefine(pub); err != nil {
+		t.Fatalf("CheckDefine: %v", err)
+	}
+	if _, err := (NVDefineSpace{
+		AuthHandle: TPMRHOwner,
+		PublicInfo: New2B(pub),
+	}).Execute(thetpm); err != nil {
+		t.Fatalf("NVDefineSpace: %v", err)
+	}
+	defer NVUndefineSpace{
+		AuthHandle: TPMRHOwner,
+		NVIndex:    NamedHandle{Handle: TPMHandle(pub.NVIndex), Name: mustNVName(t, pub)},
+	}.Execute(thetpm)
+
+	after, err := GetNVUsage(thetpm)
+	if err != nil {
+		t.Fatalf("GetNVUsage: %v", err)
+	}
+	if len(after.Indices) != len(before.Indices)+1 {
+		t.Errorf("got %d indices, want %d", len(after.Indices), len(before.Indices)+1)
+	}
+	if after.UsedBytes != before.UsedBytes+64 {
+		t.Errorf("UsedBytes = %d, want %d", after.UsedBytes, before.UsedBytes+64)
+	}
+	if err := after.CheckDefine(pub); err == nil {
+		t.Error("CheckDefine accepted an index that is already defined")
+	}
+
+	big := pub
+	big.NVIndex = TPMHandle(0x01800011)
+	big.DataSize = uint16(after.IndexMax + 1)
+	if err := after.CheckDefine(big); !errors.Is(err, ErrNVSpace) {
+		t.Errorf("CheckDefine(oversized) = %v, want %v", err, ErrNVSpace)
+	}
+}
+
+func TestNVUsageCheckDefineCounters(t *testing.T) {
+	u := NVUsage{
+		IndexMax:        2048,
+		Counters:        1,
+		CountersMax:     2,
+		CountersAvail:   1,
+		PersistentAvail: 4,
+	}
+	counter := func(h TPMHandle, orderly bool) TPMSNVPublic {
+		return TPMSNVPublic{
+			NVIndex:    h,
+			NameAlg:    TPMAlgSHA256,
+			Attributes: TPMANV{NT: TPMNTCounter, Orderly: orderly},
+			DataSize:   8,
+		}
+	}
+	if err := u.CheckDefine(counter(0x01800020, true)); err != nil {
+		t.Errorf("CheckDefine(one counter) = %v", err)
+	}
+	if err := u.CheckDefine(counter(0x01800020, false), counter(0x01800021, false)); !errors.Is(err, ErrNVSpace) {
+		t.Errorf("CheckDefine(two counters) = %v, want %v", err, ErrNVSpace)
+	}
+	if err := u.CheckDefine(counter(0x01800020, false), counter(0x01800020, false)); err == nil {
+		t.Error("CheckDefine accepted the same index twice")
+	}
+	u.PersistentAvail = 0
+	if err := u.CheckDefine(counter(0x01800020, false)); !errors.Is(err, ErrNVSpace) {
+		t.Errorf("CheckDefine(full) = %v, want %v", err, ErrNVSpace)
+	}
+}
+
+func mustNVName(t *testing.T, pub TPMSNVPublic) TPM2BName {
+	t.Helper()
+	name, err := NVName(&pub)
+	if err != nil {
+		t.Fatalf("NVName: %v", err)
+	}
+	return *name
+}
@@ -221,3 +221,220 @@ func TestPCREvent(t *testing.T) {
 		})
 	}
 }
+
+func TestParsePCRSelection(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    []TPMSPCRSelection
+		wantErr bool
+	}{
+		{
+			in: "sha256:0,2,4,7",
+			want: []TPMSPCRSelection{
+				{Hash: TPMAlgSHA256, PCRSelect: []byte{0x95, 0x00, 0x00}},
+			},
+		},
+		{
+			in: "sha1:0-3+sha256:16",
+			want: []TPMSPCRSelection{
+				{Hash: TPMAlgSHA1, PCRSelect: []byte{0x0f, 0x00, 0x00}},
+				{Hash: TPMAlgSHA256, PCRSelect: []byte{0x00, 0x00, 0x01}},
+			},
+		},
+		{
+			in: "sha384:",
+			want: []TPMSPCRSelection{
+				{Hash: TPMAlgSHA384, PCRSelect: []byte{0x00, 0x00, 0x00}},
+			},
+		},
+		{in: "sha256", wantErr: true},
+		{in: "md5:0", wantErr: true},
+		{in: "sha256:0+sha256:1", wantErr: true},
+		{in: "sha256:7-3", wantErr: true},
+		{in: "sha256:x", wantErr: true},
+	} {
+		t.Run(tc.in, func(t *testing.T) {
+			sel, err := ParsePCRSelection(tc.in)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("ParsePCRSelection(%q) = %v, want error", tc.in, sel)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePCRSelection(%q): %v", tc.in, err)
+			}
+			if len(sel.PCRSelections) != len(tc.want) {
+				t.Fatalf("ParsePCRSelection(%q) returned %d banks, want %d", tc.in, len(sel.PCRSelections), len(tc.want))
+			}
+			for i, got := range sel.PCRSelections {
+				if got.Hash != tc.want[i].Hash || !bytes.Equal(got.PCRSelect, tc.want[i].PCRSelect) {
+					t.Errorf("bank %d = {%v, %x}, want {%v, %x}", i, got.Hash, got.PCRSelect, tc.want[i].Hash, tc.want[i].PCRSelect)
+				}
+			}
+		})
+	}
+}
+
+func TestReadPCRs(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	if _, err := (PCREvent{
+		PCRHandle: TPMHandle(16),
+		EventData: TPM2BEvent{Buffer: []byte("hello")},
+	}).Execute(thetpm); err != nil {
+		t.Fatalf("PCREvent failed: %v", err)
+	}
+
+	sel, err := ParsePCRSelection("sha1:0-23+sha256:0-23")
+	if err != nil {
+		t.Fatalf("ParsePCRSelection: %v", err)
+	}
+	vals, err := ReadPCRs(thetpm, *sel)
+	if err != nil {
+		t.Fatalf("ReadPCRs: %v", err)
+	}
+	for _, alg := range []TPMIAlgHash{TPMAlgSHA1, TPMAlgSHA256} {
+		if got := len(vals[alg]); got != 24 {
+			t.Fatalf("ReadPCRs returned %d PCRs for bank %v, want 24", got, alg)
+		}
+		// Compare every value against a single-PCR read.
+		for _, pcr := range vals[alg].Sorted() {
+			rsp, err := PCRRead{
+				PCRSelectionIn: TPMLPCRSelection{
+					PCRSelections: []TPMSPCRSelection{
+						{Hash: alg, PCRSelect: PCClientCompatible.PCRs(pcr)},
+					},
+				},
+			}.Execute(thetpm)
+			if err != nil {
+				t.Fatalf("PCRRead: %v", err)
+			}
+			if want := rsp.PCRValues.Digests[0].Buffer; !bytes.Equal(vals[alg][pcr], want) {
+				t.Errorf("bank %v PCR %d = %x, want %x", alg, pcr, vals[alg][pcr], want)
+			}
+		}
+	}
+	if allZero(vals[TPMAlgSHA256][16]) {
+		t.Errorf("PCR 16 expected not to be all zero after PCREvent")
+	}
+
+	digest, err := PCRCompositeDigest(TPMAlgSHA256, *sel, vals)
+	if err != nil {
+		t.Fatalf("PCRCompositeDigest: %v", err)
+	}
+	var composite []byte
+	for _, alg := range []TPMIAlgHash{TPMAlgSHA1, TPMAlgSHA256} {
+		for pcr := uint(0); pcr < 24; pcr++ {
+			composite = append(composite, vals[alg][pcr]...)
+		}
+	}
+	if want := sha256.Sum256(composite); !bytes.Equal(digest, want[:]) {
+		t.Errorf("PCRCompositeDigest() = %x, want %x", digest, want)
+	}
+}
+
+func TestExtendPCR(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	banks, err := ActivePCRBanks(thetpm)
+	if err != nil {
+		t.Fatalf("ActivePCRBanks: %v", err)
+	}
+	if len(banks) == 0 {
+		t.Fatalf("ActivePCRBanks returned no banks")
+	}
+	var sel TPMLPCRSelection
+	for _, bank := range banks {
+		sel.PCRSelections = append(sel.PCRSelections, TPMSPCRSelection{
+			Hash:      bank,
+			PCRSelect: PCClientCompatible.PCRs(16),
+		})
+	}
+
+	cases := []struct {
+		name string
+		opts []ExtendOption
+	}{
+		{"PCRExtend", nil},
+		{"PCREvent", []ExtendOption{ExtendWithPCREvent()}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			before, err := ReadPCRs(thetpm, sel)
+			if err != nil {
+				t.Fatalf("ReadPCRs: %v", err)
+			}
+			var log EventLog
+			data := []byte("measured data")
+			digests, err := ExtendPCR(thetpm, TPMHandle(16), data, append(c.opts, ExtendLog(&log))...)
+			if err != nil {
+				t.Fatalf("ExtendPCR: %v", err)
+			}
+			after, err := ReadPCRs(thetpm, sel)
+			if err != nil {
+				t.Fatalf("ReadPCRs: %v", err)
+			}
+
+			for _, bank := range banks {
+				h, err := bank.Hash()
+				if err != nil {
+					t.Fatalf("%v.Hash(): %v", bank, err)
+				}
+				hasher := h.New()
+				hasher.Write(data)
+				measurement := hasher.Sum(nil)
+
+				found := false
+				for _, d := range digests.Digests {
+					if d.HashAlg == bank {
+						found = true
+						if !bytes.Equal(d.Digest, measurement) {
+							t.Errorf("digest for bank %v = %x, want %x", bank, d.Digest, measurement)
+						}
+					}
+				}
+				if !found {
+					t.Errorf("no digest returned for bank %v", bank)
+				}
+
+				hasher.Reset()
+				hasher.Write(before[bank][16])
+				hasher.Write(measurement)
+				if want := hasher.Sum(nil); !bytes.Equal(after[bank][16], want) {
+					t.Errorf("bank %v PCR 16 = %x, want %x", bank, after[bank][16], want)
+				}
+			}
+
+			if len(log.Entries) != 1 {
+				t.Fatalf("event log has %d entries, want 1", len(log.Entries))
+			}
+			if entry := log.Entries[0]; entry.PCR != 16 || !bytes.Equal(entry.Data, data) {
+				t.Errorf("unexpected event log entry: %+v", entry)
+			}
+		})
+	}
+}
+
+func TestPCRBankName(t *testing.T) {
+	for _, name := range []string{"sha1", "sha256", "sha384", "sha512", "sm3_256"} {
+		sel, err := ParsePCRSelection(name + ":0")
+		if err != nil {
+			t.Fatalf("ParsePCRSelection(%q): %v", name, err)
+		}
+		if got := PCRBankName(sel.PCRSelections[0].Hash); got != name {
+			t.Errorf("PCRBankName(0x%x) = %q, want %q", sel.PCRSelections[0].Hash, got, name)
+		}
+	}
+	if got, want := PCRBankName(TPMAlgSHA3256), "0x0027"; got != want {
+		t.Errorf("PCRBankName(TPMAlgSHA3256) = %q, want %q", got, want)
+	}
+}
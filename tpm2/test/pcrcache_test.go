@@ -0,0 +1,108 @@
+package tpm2test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// pcrReadCounter counts the TPM2_PCR_Read commands sent through it.
+type pcrReadCounter struct {
+	tpm   transport.TPM
+	reads int
+}
+
+func (c *pcrReadCounter) Send(cmd []byte) ([]byte, error) {
+	if len(cmd) >= 10 && TPMCC(binary.BigEndian.Uint32(cmd[6:10])) == TPMCCPCRRead {
+		c.reads++
+	}
+	return c.tpm.Send(cmd)
+}
+
+func TestPCRCache(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+	counter := &pcrReadCounter{tpm: thetpm}
+	cache := NewPCRCache(counter)
+
+	sel := TPMLPCRSelection{
+		PCRSelections: []TPMSPCRSelection{
+			{Hash: TPMAlgSHA1, PCRSelect: PCClientCompatible.PCRs(16)},
+			{Hash: TPMAlgSHA256, PCRSelect: PCClientCompatible.PCRs(0, 7, 16, 23)},
+		},
+	}
+	read := func() PCRValues {
+		t.Helper()
+		vals, err := cache.ReadPCRs(sel)
+		if err != nil {
+			t.Fatalf("ReadPCRs: %v", err)
+		}
+		return vals
+	}
+	checkReads := func(want int) {
+		t.Helper()
+		if counter.reads != want {
+			t.Errorf("%d PCR_Read commands sent, want %d", counter.reads, want)
+		}
+	}
+	extend := func(tpm transport.TPM) {
+		t.Helper()
+		if _, err := (PCRExtend{
+			PCRHandle: AuthHandle{Handle: TPMHandle(16), Auth: PasswordAuth(nil)},
+			Digests: TPMLDigestValues{
+				Digests: []TPMTHA{{HashAlg: TPMAlgSHA256, Digest: bytes.Repeat([]byte{1}, 32)}},
+			},
+		}).Execute(tpm); err != nil {
+			t.Fatalf("PCRExtend: %v", err)
+		}
+	}
+
+	first := read()
+	checkReads(1)
+	if len(first[TPMAlgSHA256]) != 4 || len(first[TPMAlgSHA1]) != 1 {
+		t.Fatalf("ReadPCRs returned %v, want 5 PCRs", first)
+	}
+	read()
+	checkReads(1)
+
+	// Extending through the cache drops PCR 16, which alone is read again.
+	extend(cache)
+	vals := read()
+	checkReads(2)
+	if bytes.Equal(vals[TPMAlgSHA256][16], first[TPMAlgSHA256][16]) {
+		t.Error("PCR 16 was not read again after PCR_Extend")
+	}
+	if !bytes.Equal(vals[TPMAlgSHA256][7], first[TPMAlgSHA256][7]) {
+		t.Error("PCR 7 changed")
+	}
+
+	// Extending behind the cache's back is only seen after Refresh.
+	extend(thetpm)
+	if got := read(); !bytes.Equal(got[TPMAlgSHA256][16], vals[TPMAlgSHA256][16]) {
+		t.Error("PCR 16 changed without Refresh")
+	}
+	if err := cache.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	checkReads(3)
+	want, err := ReadPCRs(thetpm, sel)
+	if err != nil {
+		t.Fatalf("ReadPCRs: %v", err)
+	}
+	got := read()
+	checkReads(3)
+	for _, s := range sel.PCRSelections {
+		for _, pcr := range SelectedPCRs(s.PCRSelect) {
+			if !bytes.Equal(got[s.Hash][pcr], want[s.Hash][pcr]) {
+				t.Errorf("cached %v PCR %d = %x, want %x", s.Hash, pcr, got[s.Hash][pcr], want[s.Hash][pcr])
+			}
+		}
+	}
+}
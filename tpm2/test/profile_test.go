@@ -0,0 +1,119 @@
+package tpm2test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// hideAlgorithms returns an interceptor that removes algs from the TPM's
+// answers to GetCapability(TPM_CAP_ALGS), as if it didn't implement them.
+func hideAlgorithms(t *testing.T, algs ...TPMAlgID) transport.Interceptor {
+	return func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+		rsp, err := next(cmd)
+		if err != nil || TPMCC(binary.BigEndian.Uint32(cmd[6:10])) != TPMCCGetCapability ||
+			TPMCap(binary.BigEndian.Uint32(cmd[10:14])) != TPMCapAlgs || len(rsp) <= 11 {
+			return rsp, err
+		}
+		data, err := Unmarshal[TPMSCapabilityData](rsp[11:])
+		if err != nil {
+			t.Fatalf("unmarshalling capability data: %v", err)
+		}
+		props, err := data.Data.Algorithms()
+		if err != nil {
+			t.Fatalf("reading algorithms: %v", err)
+		}
+		var kept []TPMSAlgProperty
+		for _, p := range props.AlgProperties {
+			hidden := false
+			for _, alg := range algs {
+				hidden = hidden || p.Alg == alg
+			}
+			if !hidden {
+				kept = append(kept, p)
+			}
+		}
+		data.Data = NewTPMUCapabilities(TPMCapAlgs, &TPMLAlgProperty{AlgProperties: kept})
+		out := append(rsp[:11:11], Marshal(data)...)
+		binary.BigEndian.PutUint32(out[2:6], uint32(len(out)))
+		return out, nil
+	}
+}
+
+func TestNegotiateProfile(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	for _, tc := range []struct {
+		name      string
+		hidden    []TPMAlgID
+		want      string
+		fallbacks int
+	}{
+		{"Preferred", nil, "ECC NIST P-256, SHA-384", 0},
+		{"NoECC", []TPMAlgID{TPMAlgECC}, "RSA-2048, SHA-384", 1},
+		{"NoSHA384", []TPMAlgID{TPMAlgSHA384}, "ECC NIST P-256, SHA-256", 1},
+		{"Neither", []TPMAlgID{TPMAlgECDSA, TPMAlgSHA384}, "RSA-2048, SHA-256", 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := GetFeatures(transport.Chain(thetpm, hideAlgorithms(t, tc.hidden...)))
+			if err != nil {
+				t.Fatalf("GetFeatures: %v", err)
+			}
+			p, err := NegotiateProfile(f)
+			if err != nil {
+				t.Fatalf("NegotiateProfile: %v", err)
+			}
+			if got := p.String(); got != tc.want {
+				t.Errorf("NegotiateProfile() = %q, want %q", got, tc.want)
+			}
+			if len(p.Fallbacks) != tc.fallbacks {
+				t.Errorf("Fallbacks = %q, want %d of them", p.Fallbacks, tc.fallbacks)
+			}
+
+			for _, k := range []struct {
+				name      string
+				hierarchy TPMHandle
+				template  TPMTPublic
+			}{
+				{"SRK", TPMRHOwner, p.SRKTemplate()},
+				{"EK", TPMRHEndorsement, p.EKTemplate()},
+				{"AK", TPMRHOwner, p.AKTemplate()},
+			} {
+				rsp, err := CreatePrimary{
+					PrimaryHandle: k.hierarchy,
+					InPublic:      New2B(k.template),
+				}.Execute(thetpm)
+				if err != nil {
+					t.Errorf("CreatePrimary(%s): %v", k.name, err)
+					continue
+				}
+				FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm)
+				pub, err := rsp.OutPublic.Contents()
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+				if pub.Type != p.Type {
+					t.Errorf("%s type = %#x, want %#x", k.name, pub.Type, p.Type)
+				}
+			}
+		})
+	}
+
+	if _, err := NegotiateProfile(&Features{}); !errors.Is(err, ErrNoProfile) {
+		t.Errorf("NegotiateProfile(no features) = %v, want %v", err, ErrNoProfile)
+	}
+	// The preferred profile with SHA-256 gives the reference SRK.
+	p := Profile{Type: TPMAlgECC, Curve: TPMECCNistP256, Hash: TPMAlgSHA256}
+	if got := p.SRKTemplate(); !bytes.Equal(Marshal(&got), Marshal(&ECCSRKTemplate)) {
+		t.Errorf("SRKTemplate() differs from ECCSRKTemplate")
+	}
+}
@@ -0,0 +1,156 @@
+package tpm2test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// busyTPM answers the first commands it gets with a warning, and delays the
+// others.
+type busyTPM struct {
+	tpm   transport.TPM
+	busy  int
+	rc    TPMRC
+	delay time.Duration
+	sent  int
+}
+
+func (b *busyTPM) Send(cmd []byte) ([]byte, error) {
+	b.sent++
+	if b.busy > 0 {
+		b.busy--
+		rsp := []byte{0x80, 0x01, 0, 0, 0, 10, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(rsp[6:], uint32(b.rc))
+		return rsp, nil
+	}
+	time.Sleep(b.delay)
+	return b.tpm.Send(cmd)
+}
+
+// progressLog records progress reports.
+type progressLog struct {
+	mu      sync.Mutex
+	reports []Progress
+}
+
+func (l *progressLog) add(p Progress) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reports = append(l.reports, p)
+}
+
+func (l *progressLog) take() []Progress {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	reports := l.reports
+	l.reports = nil
+	return reports
+}
+
+func TestProgressReporter(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+	busy := &busyTPM{tpm: thetpm, busy: 3, rc: TPMRCYielded, delay: 100 * time.Millisecond}
+	var log progressLog
+	r := NewProgressReporter(busy, 20*time.Millisecond, log.add)
+
+	// The command is resent until the TPM runs it, with reports while it
+	// runs and a last one when it is done.
+	if _, err := (GetRandom{BytesRequested: 8}).Execute(r); err != nil {
+		t.Fatalf("GetRandom: %v", err)
+	}
+	if busy.sent != 4 {
+		t.Errorf("command sent %d times, want 4", busy.sent)
+	}
+	reports := log.take()
+	if len(reports) < 3 {
+		t.Fatalf("got %d progress reports, want at least 3", len(reports))
+	}
+	last := reports[len(reports)-1]
+	if !last.Done || last.Command != TPMCCGetRandom || last.Retries != 3 || last.Elapsed < 100*time.Millisecond {
+		t.Errorf("last progress report = %+v, want a finished GetRandom after 3 retries", last)
+	}
+	for _, p := range reports[:len(reports)-1] {
+		if p.Done {
+			t.Errorf("progress report %+v is done before the last one", p)
+		}
+	}
+
+	// Retries are bounded.
+	busy.busy, busy.rc, busy.sent = 3, TPMRCRetry, 0
+	r.MaxRetries = 2
+	if _, err := (GetRandom{BytesRequested: 8}).Execute(r); !errors.Is(err, TPMRCRetry) {
+		t.Errorf("GetRandom() = %v, want %v", err, TPMRCRetry)
+	}
+	if busy.sent != 3 {
+		t.Errorf("command sent %d times, want 3", busy.sent)
+	}
+	busy.busy = 0
+	log.take()
+
+	// A command that outlives its context is abandoned; the next one waits
+	// for it.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, err := (GetRandom{BytesRequested: 8}).Execute(r.WithContext(ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetRandom() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if reports := log.take(); len(reports) == 0 || !reports[len(reports)-1].Done {
+		t.Errorf("abandoned command's progress reports = %+v, want a last one that is done", reports)
+	}
+	if _, err := (GetRandom{BytesRequested: 8}).Execute(r); err != nil {
+		t.Errorf("GetRandom after an abandoned command: %v", err)
+	}
+}
+
+// slowTPM records the commands it is sent, after a delay.
+type slowTPM struct {
+	delay time.Duration
+	mu    sync.Mutex
+	sent  [][]byte
+}
+
+func (s *slowTPM) Send(cmd []byte) ([]byte, error) {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, append([]byte(nil), cmd...))
+	return nil, errors.New("not a TPM")
+}
+
+func TestProgressReporterAbandonedBuffer(t *testing.T) {
+	slow := &slowTPM{delay: 50 * time.Millisecond}
+	r := NewProgressReporter(slow, time.Second, nil)
+
+	// The caller reuses its buffer as soon as the command is abandoned, as
+	// the pooled fast paths do; the TPM must still get the command as it
+	// was.
+	cmd := []byte{0x80, 0x01, 0, 0, 0, 12, 0, 0, 1, 0x7b, 0, 8}
+	want := append([]byte(nil), cmd...)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.SendContext(ctx, cmd); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("SendContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	for i := range cmd {
+		cmd[i] = 0xff
+	}
+	// The next command waits for the abandoned one.
+	r.Send(cmd)
+	slow.mu.Lock()
+	defer slow.mu.Unlock()
+	if len(slow.sent) == 0 || string(slow.sent[0]) != string(want) {
+		t.Errorf("TPM got %x, want %x", slow.sent, want)
+	}
+}
@@ -0,0 +1,109 @@
+package tpm2test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func getTPMProperty(t *testing.T, thetpm transport.TPM, prop TPMPT) uint32 {
+	t.Helper()
+	rsp, err := GetCapability{
+		Capability:    TPMCapTPMProperties,
+		Property:      uint32(prop),
+		PropertyCount: 1,
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("GetCapability: %v", err)
+	}
+	props, err := rsp.CapabilityData.Data.TPMProperties()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(props.TPMProperty) == 0 || props.TPMProperty[0].Property != prop {
+		t.Fatalf("TPM did not report property 0x%x", prop)
+	}
+	return props.TPMProperty[0].Value
+}
+
+func TestProvision(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	ownerAuth := []byte("owner")
+	cfg := ProvisionConfig{
+		OwnerAuth:       ownerAuth,
+		EndorsementAuth: []byte("endorsement"),
+		LockoutAuth:     []byte("lockout"),
+		DA: &DAParameters{
+			MaxTries:        10,
+			RecoveryTime:    600,
+			LockoutRecovery: 3600,
+		},
+		SRKTemplate: &ECCSRKTemplate,
+	}
+	report, err := Provision(thetpm, cfg)
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	if !report.OwnerAuthSet || !report.EndorsementAuthSet || !report.LockoutAuthSet || !report.DASet || !report.SRKCreated {
+		t.Errorf("Provision report = %+v, want every change made", report)
+	}
+	if got := len(report.Changes()); got != 5 {
+		t.Errorf("Changes() = %q, want 5 entries", report.Changes())
+	}
+	if report.SRK == nil || report.SRK.Handle != DefaultSRKHandle {
+		t.Fatalf("SRK = %+v, want handle 0x%x", report.SRK, DefaultSRKHandle)
+	}
+
+	srk, err := ReadPublic{ObjectHandle: DefaultSRKHandle}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("ReadPublic(SRK): %v", err)
+	}
+	if !bytes.Equal(srk.Name.Buffer, report.SRK.Name.Buffer) {
+		t.Errorf("SRK name = %x, want %x", srk.Name.Buffer, report.SRK.Name.Buffer)
+	}
+	if got := getTPMProperty(t, thetpm, TPMPTMaxAuthFail); got != cfg.DA.MaxTries {
+		t.Errorf("TPM_PT_MAX_AUTH_FAIL = %v, want %v", got, cfg.DA.MaxTries)
+	}
+	if got := getTPMProperty(t, thetpm, TPMPTLockoutRecovery); got != cfg.DA.LockoutRecovery {
+		t.Errorf("TPM_PT_LOCKOUT_RECOVERY = %v, want %v", got, cfg.DA.LockoutRecovery)
+	}
+
+	// The owner hierarchy now needs the new authorization value.
+	createPrimary := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(ECCSRKTemplate),
+	}
+	if _, err := createPrimary.Execute(thetpm); !errors.Is(err, TPMRCBadAuth) {
+		t.Errorf("CreatePrimary with empty owner auth: got %v, want %v", err, TPMRCBadAuth)
+	}
+	createPrimary.PrimaryHandle = AuthHandle{
+		Handle: TPMRHOwner,
+		Auth:   PasswordAuth(ownerAuth),
+	}
+	rsp, err := createPrimary.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary with owner auth: %v", err)
+	}
+	FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm)
+
+	// Running again keeps the existing SRK.
+	report, err = Provision(thetpm, ProvisionConfig{SRKTemplate: &ECCSRKTemplate})
+	if err != nil {
+		t.Fatalf("second Provision: %v", err)
+	}
+	if report.SRKCreated || len(report.Changes()) != 0 {
+		t.Errorf("second Provision changed %q, want nothing", report.Changes())
+	}
+	if report.SRK == nil || !bytes.Equal(report.SRK.Name.Buffer, srk.Name.Buffer) {
+		t.Errorf("second Provision SRK = %+v, want the existing key", report.SRK)
+	}
+}
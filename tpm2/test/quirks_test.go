@@ -0,0 +1,160 @@
+package tpm2test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// timeoutTPM records the command timeout it is given.
+type timeoutTPM struct {
+	transport.TPM
+	timeout time.Duration
+}
+
+func (t *timeoutTPM) SetCommandTimeout(timeout time.Duration) {
+	t.timeout = timeout
+}
+
+func findQuirk(t *testing.T, info DeviceInfo, name string) Quirk {
+	t.Helper()
+	for _, q := range QuirksFor(info) {
+		if q.Name == name {
+			return q
+		}
+	}
+	t.Fatalf("QuirksFor(%v) does not include %q", info.Manufacturer, name)
+	return Quirk{}
+}
+
+func TestQuirksFor(t *testing.T) {
+	if qs := QuirksFor(DeviceInfo{Manufacturer: "XYZ"}); len(qs) != 0 {
+		t.Errorf("QuirksFor(unknown vendor) = %v, want none", qs)
+	}
+
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	q := findQuirk(t, DeviceInfo{Manufacturer: "IFX"}, "infineon-slow-keygen")
+	tt := &timeoutTPM{TPM: thetpm}
+	if got := q.Apply(tt); got != tt {
+		t.Errorf("Apply wrapped the TPM, want it configured in place")
+	}
+	if tt.timeout < 5*time.Minute {
+		t.Errorf("command timeout = %v, want at least 5m", tt.timeout)
+	}
+}
+
+func TestCapabilityLimitQuirk(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	q := findQuirk(t, DeviceInfo{Manufacturer: "NTC"}, "nuvoton-capability-paging")
+	limited := q.Apply(thetpm)
+
+	getAlgs := GetCapability{
+		Capability:    TPMCapAlgs,
+		Property:      0,
+		PropertyCount: 128,
+	}
+	want, err := getAlgs.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("GetCapability: %v", err)
+	}
+	wantAlgs, err := want.CapabilityData.Data.Algorithms()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var gotAlgs []TPMSAlgProperty
+	for {
+		rsp, err := getAlgs.Execute(limited)
+		if err != nil {
+			t.Fatalf("GetCapability through quirk: %v", err)
+		}
+		algs, err := rsp.CapabilityData.Data.Algorithms()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(algs.AlgProperties) > 16 {
+			t.Fatalf("got %d algorithms in one response, want at most 16", len(algs.AlgProperties))
+		}
+		gotAlgs = append(gotAlgs, algs.AlgProperties...)
+		if !rsp.MoreData || len(algs.AlgProperties) == 0 {
+			break
+		}
+		getAlgs.Property = uint32(algs.AlgProperties[len(algs.AlgProperties)-1].Alg) + 1
+	}
+	if len(gotAlgs) != len(wantAlgs.AlgProperties) {
+		t.Errorf("paged through %d algorithms, want %d", len(gotAlgs), len(wantAlgs.AlgProperties))
+	}
+
+	if _, err := GetDeviceInfo(limited); err != nil {
+		t.Errorf("GetDeviceInfo through quirk: %v", err)
+	}
+
+	// The wrapper keeps the capabilities of the transport it wraps.
+	if _, ok := limited.(io.Closer); !ok {
+		t.Errorf("TPM with quirk can't be closed")
+	}
+	tt := &timeoutTPM{TPM: thetpm}
+	if ts, ok := q.Apply(tt).(transport.CommandTimeoutSetter); !ok {
+		t.Errorf("TPM with quirk has no command timeout")
+	} else if ts.SetCommandTimeout(time.Minute); tt.timeout != time.Minute {
+		t.Errorf("command timeout of the wrapped TPM = %v, want %v", tt.timeout, time.Minute)
+	}
+	if _, ok := limited.(transport.ResponseSizer); !ok {
+		t.Errorf("TPM with quirk has no response size")
+	}
+	if _, ok := limited.(transport.LocalitySetter); !ok {
+		t.Errorf("TPM with quirk has no locality")
+	}
+}
+
+func TestApplyQuirks(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	info, err := GetDeviceInfo(thetpm)
+	if err != nil {
+		t.Fatalf("GetDeviceInfo: %v", err)
+	}
+	var applied bool
+	RegisterQuirk(Quirk{
+		Name: "test-simulator",
+		Match: func(d DeviceInfo) bool {
+			return d.Manufacturer == info.Manufacturer && d.FirmwareVersion1 == info.FirmwareVersion1
+		},
+		Apply: func(t transport.TPM) transport.TPM {
+			applied = true
+			return t
+		},
+	})
+
+	got, quirks, err := ApplyQuirks(thetpm)
+	if err != nil {
+		t.Fatalf("ApplyQuirks: %v", err)
+	}
+	if !applied || len(quirks) == 0 || quirks[len(quirks)-1].Name != "test-simulator" {
+		t.Errorf("ApplyQuirks applied %v, want test-simulator", quirks)
+	}
+	if _, err := (GetRandom{BytesRequested: 8}).Execute(got); err != nil {
+		t.Errorf("GetRandom after ApplyQuirks: %v", err)
+	}
+	if got != thetpm {
+		t.Errorf("ApplyQuirks wrapped the TPM, though no applied quirk does")
+	}
+}
@@ -0,0 +1,179 @@
+package tpm2test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestQuoteAllBanks(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	ak, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic: New2B(TPMTPublic{
+			Type:    TPMAlgECC,
+			NameAlg: TPMAlgSHA256,
+			ObjectAttributes: TPMAObject{
+				FixedTPM:            true,
+				FixedParent:         true,
+				SensitiveDataOrigin: true,
+				UserWithAuth:        true,
+				NoDA:                true,
+				Restricted:          true,
+				SignEncrypt:         true,
+			},
+			Parameters: NewTPMUPublicParms(
+				TPMAlgECC,
+				&TPMSECCParms{
+					Scheme: TPMTECCScheme{
+						Scheme: TPMAlgECDSA,
+						Details: NewTPMUAsymScheme(
+							TPMAlgECDSA,
+							&TPMSSigSchemeECDSA{HashAlg: TPMAlgSHA256},
+						),
+					},
+					CurveID: TPMECCNistP256,
+				},
+			),
+		}),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer FlushContext{FlushHandle: ak.ObjectHandle}.Execute(thetpm)
+
+	banks, err := ActivePCRBanks(thetpm)
+	if err != nil {
+		t.Fatalf("ActivePCRBanks: %v", err)
+	}
+	if len(banks) < 2 {
+		t.Skipf("simulator has only %d PCR bank(s)", len(banks))
+	}
+
+	var log EventLog
+	for _, data := range []string{"kernel", "initrd"} {
+		if _, err := ExtendPCR(thetpm, TPMHandle(16), []byte(data), ExtendLog(&log)); err != nil {
+			t.Fatalf("ExtendPCR: %v", err)
+		}
+	}
+	pcrs := []uint{0, 16}
+
+	quote := func() *TPMSAttest {
+		t.Helper()
+		rsp, err := QuoteAllBanks(thetpm, NamedHandle{Handle: ak.ObjectHandle, Name: ak.Name}, []byte("nonce"), pcrs)
+		if err != nil {
+			t.Fatalf("QuoteAllBanks: %v", err)
+		}
+		attest, err := rsp.Quoted.Contents()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		return attest
+	}
+
+	if err := VerifyQuoteAllBanks(quote(), TPMAlgSHA256, &log, banks, pcrs); err != nil {
+		t.Errorf("VerifyQuoteAllBanks: %v", err)
+	}
+	if err := VerifyQuoteAllBanks(quote(), TPMAlgSHA256, &log, banks, []uint{16, 23}); !errors.Is(err, ErrQuoteMismatch) {
+		t.Errorf("VerifyQuoteAllBanks(other PCRs) = %v, want %v", err, ErrQuoteMismatch)
+	}
+
+	// EV_NO_ACTION events are not replayed.
+	noAction := EventLog{Entries: append([]EventLogEntry{{
+		PCR:     16,
+		Type:    EVNoAction,
+		Digests: log.Entries[0].Digests,
+	}}, log.Entries...)}
+	if err := VerifyQuoteAllBanks(quote(), TPMAlgSHA256, &noAction, banks, pcrs); err != nil {
+		t.Errorf("VerifyQuoteAllBanks(log with EV_NO_ACTION): %v", err)
+	}
+
+	// A log entry whose digest in one bank was forged is rejected.
+	forged := EventLog{Entries: append([]EventLogEntry(nil), log.Entries...)}
+	digests := append([]TPMTHA(nil), forged.Entries[0].Digests.Digests...)
+	digests[len(digests)-1].Digest = make([]byte, len(digests[len(digests)-1].Digest))
+	forged.Entries[0].Digests = TPMLDigestValues{Digests: digests}
+	if err := VerifyQuoteAllBanks(quote(), TPMAlgSHA256, &forged, banks, pcrs); !errors.Is(err, ErrQuoteMismatch) {
+		t.Errorf("VerifyQuoteAllBanks(forged log) = %v, want %v", err, ErrQuoteMismatch)
+	}
+
+	// Extending only one bank leaves the others stale, which a check of
+	// that bank alone would not notice.
+	if _, err := ExtendPCR(thetpm, TPMHandle(16), []byte("unlogged"), ExtendBanks(banks[0])); err != nil {
+		t.Fatalf("ExtendPCR: %v", err)
+	}
+	if err := VerifyQuoteAllBanks(quote(), TPMAlgSHA256, &log, banks, pcrs); !errors.Is(err, ErrQuoteMismatch) {
+		t.Errorf("VerifyQuoteAllBanks(stale bank) = %v, want %v", err, ErrQuoteMismatch)
+	}
+}
+
+func TestVerifyAttestationMagic(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ak := TPMTPublic{
+		Type:    TPMAlgECC,
+		NameAlg: TPMAlgSHA256,
+		ObjectAttributes: TPMAObject{
+			Restricted:  true,
+			SignEncrypt: true,
+		},
+		Parameters: NewTPMUPublicParms(TPMAlgECC, &TPMSECCParms{
+			Scheme: TPMTECCScheme{
+				Scheme:  TPMAlgECDSA,
+				Details: NewTPMUAsymScheme(TPMAlgECDSA, &TPMSSigSchemeECDSA{HashAlg: TPMAlgSHA256}),
+			},
+			CurveID: TPMECCNistP256,
+		}),
+		Unique: NewTPMUPublicID(TPMAlgECC, &TPMSECCPoint{
+			X: TPM2BECCParameter{Buffer: key.X.FillBytes(make([]byte, 32))},
+			Y: TPM2BECCParameter{Buffer: key.Y.FillBytes(make([]byte, 32))},
+		}),
+	}
+	// sign returns a quote with the given magic value, signed by key as
+	// a restricted AK signs a digest from TPM2_Hash.
+	sign := func(magic TPMGenerated) (*TPM2BAttest, *TPMTSignature) {
+		attest := New2B(TPMSAttest{
+			Magic:     magic,
+			Type:      TPMSTAttestQuote,
+			ExtraData: TPM2BData{Buffer: []byte("nonce")},
+			Attested: NewTPMUAttest(TPMSTAttestQuote, &TPMSQuoteInfo{
+				PCRDigest: TPM2BDigest{Buffer: make([]byte, 32)},
+			}),
+		})
+		digest := sha256.Sum256(attest.Bytes())
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		return &attest, &TPMTSignature{
+			SigAlg: TPMAlgECDSA,
+			Signature: NewTPMUSignature(TPMAlgECDSA, &TPMSSignatureECC{
+				Hash:       TPMAlgSHA256,
+				SignatureR: TPM2BECCParameter{Buffer: r.Bytes()},
+				SignatureS: TPM2BECCParameter{Buffer: s.Bytes()},
+			}),
+		}
+	}
+
+	attest, sig := sign(TPMGeneratedValue)
+	if _, err := VerifyAttestation(&ak, attest, sig); err != nil {
+		t.Errorf("VerifyAttestation: %v", err)
+	}
+	attest, sig = sign(0)
+	if _, err := VerifyAttestation(&ak, attest, sig); !errors.Is(err, ErrNotTPMGenerated) {
+		t.Errorf("VerifyAttestation(magic 0) = %v, want %v", err, ErrNotTPMGenerated)
+	}
+}
@@ -0,0 +1,76 @@
+package tpm2test
+
+import (
+	"bytes"
+	"math/rand"
+	"regexp"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestRandReader(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	// Larger than a single TPM2_GetRandom can return.
+	buf := make([]byte, 1000)
+	n, err := RandReader(thetpm).Read(buf)
+	if err != nil || n != len(buf) {
+		t.Fatalf("Read() = %v, %v, want %v, nil", n, err, len(buf))
+	}
+	if bytes.Equal(buf[500:], make([]byte, 500)) {
+		t.Errorf("Read() left the end of the buffer empty")
+	}
+}
+
+func TestRandSource(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	r := rand.New(RandSource(thetpm))
+	seen := make(map[uint64]bool)
+	for i := 0; i < 100; i++ {
+		v := r.Uint64()
+		if seen[v] {
+			t.Fatalf("Uint64() repeated %x", v)
+		}
+		seen[v] = true
+		if n := r.Int63(); n < 0 {
+			t.Fatalf("Int63() = %v, want a non-negative number", n)
+		}
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	format := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a, err := NewUUID(thetpm)
+	if err != nil {
+		t.Fatalf("NewUUID: %v", err)
+	}
+	b, err := NewUUID(thetpm)
+	if err != nil {
+		t.Fatalf("NewUUID: %v", err)
+	}
+	for _, u := range []UUID{a, b} {
+		if !format.MatchString(u.String()) {
+			t.Errorf("UUID %v is not a version 4 UUID", u)
+		}
+	}
+	if a == b {
+		t.Errorf("NewUUID returned %v twice", a)
+	}
+}
@@ -0,0 +1,75 @@
+package tpm2test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestReadOnly(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+	ro := ReadOnly(thetpm)
+
+	// Reading and transient objects are allowed.
+	if _, err := (GetRandom{BytesRequested: 8}).Execute(ro); err != nil {
+		t.Errorf("GetRandom: %v", err)
+	}
+	srk, err := CreatePrimary{
+		PrimaryHandle: TPMRHOwner,
+		InPublic:      New2B(ECCSRKTemplate),
+	}.Execute(ro)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer FlushContext{FlushHandle: srk.ObjectHandle}.Execute(ro)
+
+	for name, cmd := range map[string]func() error{
+		"EvictControl": func() error {
+			_, err := EvictControl{
+				Auth:             TPMRHOwner,
+				ObjectHandle:     &NamedHandle{Handle: srk.ObjectHandle, Name: srk.Name},
+				PersistentHandle: 0x81000020,
+			}.Execute(ro)
+			return err
+		},
+		"Clear": func() error {
+			_, err := Clear{AuthHandle: TPMRHLockout}.Execute(ro)
+			return err
+		},
+		"PCRExtend": func() error {
+			_, err := PCRExtend{
+				PCRHandle: AuthHandle{Handle: TPMHandle(16), Auth: PasswordAuth(nil)},
+				Digests: TPMLDigestValues{
+					Digests: []TPMTHA{{HashAlg: TPMAlgSHA256, Digest: make([]byte, 32)}},
+				},
+			}.Execute(ro)
+			return err
+		},
+		"HierarchyChangeAuth": func() error {
+			_, err := HierarchyChangeAuth{
+				AuthHandle: TPMRHOwner,
+				NewAuth:    TPM2BAuth{Buffer: []byte("new")},
+			}.Execute(ro)
+			return err
+		},
+	} {
+		if err := cmd(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%v through a read-only transport: %v, want %v", name, err, ErrReadOnly)
+		}
+	}
+
+	// Nothing reached the TPM.
+	handles, err := GetHandles(thetpm, TPMHTPersistent)
+	if err != nil {
+		t.Fatalf("GetHandles: %v", err)
+	}
+	if len(handles) != 0 {
+		t.Errorf("persistent handles = %v, want none", handles)
+	}
+}
@@ -0,0 +1,237 @@
+package tpm2test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// newTestCA returns a self-signed CA certificate and its key.
+func newTestCA(t *testing.T) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test AK CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return cert, key
+}
+
+// issueAKCert certifies the public key of ak with the CA.
+func issueAKCert(t *testing.T, thetpm transport.TPM, ak TPMHandle, ca *x509.Certificate, caKey crypto.Signer) []byte {
+	t.Helper()
+	rsp, err := ReadPublic{ObjectHandle: ak}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("ReadPublic: %v", err)
+	}
+	pub, err := rsp.OutPublic.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var akKey crypto.PublicKey
+	switch pub.Type {
+	case TPMAlgRSA:
+		parms, _ := pub.Parameters.RSADetail()
+		unique, _ := pub.Unique.RSA()
+		akKey, err = RSAPub(parms, unique)
+	case TPMAlgECC:
+		unique, _ := pub.Unique.ECC()
+		akKey = &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(unique.X.Buffer),
+			Y:     new(big.Int).SetBytes(unique.Y.Buffer),
+		}
+	}
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test AK"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, akKey, caKey)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return der
+}
+
+func TestResidency(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	ca, caKey := newTestCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	otherCA, _ := newTestCA(t)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(otherCA)
+
+	key, keyPub := createECCSigningKey(t, thetpm, nil)
+	defer FlushContext{FlushHandle: key.ObjectHandle}.Execute(thetpm)
+	keyHandle := AuthHandle{Handle: key.ObjectHandle, Name: key.Name, Auth: PasswordAuth(nil)}
+
+	for name, tmpl := range map[string]TPMTPublic{
+		"RSA": RSASRKTemplate,
+		"ECC": ECCSRKTemplate,
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Make a restricted signing key from the SRK template.
+			tmpl.ObjectAttributes.Decrypt = false
+			tmpl.ObjectAttributes.SignEncrypt = true
+			if tmpl.Type == TPMAlgRSA {
+				tmpl.Parameters = NewTPMUPublicParms(TPMAlgRSA, &TPMSRSAParms{
+					Scheme: TPMTRSAScheme{
+						Scheme:  TPMAlgRSASSA,
+						Details: NewTPMUAsymScheme(TPMAlgRSASSA, &TPMSSigSchemeRSASSA{HashAlg: TPMAlgSHA256}),
+					},
+					KeyBits: 2048,
+				})
+			} else {
+				tmpl.Parameters = NewTPMUPublicParms(TPMAlgECC, &TPMSECCParms{
+					Scheme: TPMTECCScheme{
+						Scheme:  TPMAlgECDSA,
+						Details: NewTPMUAsymScheme(TPMAlgECDSA, &TPMSSigSchemeECDSA{HashAlg: TPMAlgSHA256}),
+					},
+					CurveID: TPMECCNistP256,
+				})
+			}
+			ak, err := CreatePrimary{
+				PrimaryHandle: TPMRHEndorsement,
+				InPublic:      New2B(tmpl),
+			}.Execute(thetpm)
+			if err != nil {
+				t.Fatalf("CreatePrimary: %v", err)
+			}
+			defer FlushContext{FlushHandle: ak.ObjectHandle}.Execute(thetpm)
+			akCert := issueAKCert(t, thetpm, ak.ObjectHandle, ca, caKey)
+			akHandle := AuthHandle{Handle: ak.ObjectHandle, Name: ak.Name, Auth: PasswordAuth(nil)}
+
+			nonce := []byte("verifier nonce")
+			proof, err := ProveResidency(thetpm, keyHandle, akHandle, nonce, [][]byte{akCert})
+			if err != nil {
+				t.Fatalf("ProveResidency: %v", err)
+			}
+			got, err := VerifyResidency(proof, nonce, roots)
+			if err != nil {
+				t.Fatalf("VerifyResidency: %v", err)
+			}
+			if !keyPub.Equal(got) {
+				t.Errorf("VerifyResidency returned a different key")
+			}
+
+			if _, err := VerifyResidency(proof, []byte("other nonce"), roots); !errors.Is(err, ErrNotResident) {
+				t.Errorf("VerifyResidency with the wrong nonce: %v, want %v", err, ErrNotResident)
+			}
+			if _, err := VerifyResidency(proof, nonce, otherRoots); !errors.Is(err, ErrNotResident) {
+				t.Errorf("VerifyResidency with untrusted AK: %v, want %v", err, ErrNotResident)
+			}
+			// Claim that the proof is for the AK itself.
+			swapped := *proof
+			swapped.KeyPublic = proof.AKPublic
+			if _, err := VerifyResidency(&swapped, nonce, roots); !errors.Is(err, ErrNotResident) {
+				t.Errorf("VerifyResidency for a different key: %v, want %v", err, ErrNotResident)
+			}
+
+			// Forge a certification of a software key that claims to be
+			// fixedTPM and generated by the TPM, and have the AK sign it as
+			// a digest from TPM2_Hash.
+			forged := forgeResidency(t, thetpm, akHandle, nonce)
+			forged.AKPublic = proof.AKPublic
+			forged.AKCertificates = proof.AKCertificates
+			if _, err := VerifyResidency(forged, nonce, roots); !errors.Is(err, ErrNotResident) {
+				t.Errorf("VerifyResidency(forged certification) = %v, want %v", err, ErrNotResident)
+			}
+		})
+	}
+}
+
+// forgeResidency returns a proof, without the AK's public area and
+// certificates, that claims a software key is resident: a certification
+// without TPM_GENERATED_VALUE, signed by ak through TPM2_Hash and TPM2_Sign.
+func forgeResidency(t *testing.T, thetpm transport.TPM, ak AuthHandle, nonce []byte) *ResidencyProof {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	keyPub := TPMTPublic{
+		Type:    TPMAlgECC,
+		NameAlg: TPMAlgSHA256,
+		ObjectAttributes: TPMAObject{
+			FixedTPM:            true,
+			FixedParent:         true,
+			SensitiveDataOrigin: true,
+			UserWithAuth:        true,
+			SignEncrypt:         true,
+		},
+		Parameters: NewTPMUPublicParms(TPMAlgECC, &TPMSECCParms{
+			Scheme:  TPMTECCScheme{Scheme: TPMAlgNull},
+			CurveID: TPMECCNistP256,
+		}),
+		Unique: NewTPMUPublicID(TPMAlgECC, &TPMSECCPoint{
+			X: TPM2BECCParameter{Buffer: key.X.FillBytes(make([]byte, 32))},
+			Y: TPM2BECCParameter{Buffer: key.Y.FillBytes(make([]byte, 32))},
+		}),
+	}
+	name, err := ObjectName(&keyPub)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	info := New2B(TPMSAttest{
+		Type:      TPMSTAttestCertify,
+		ExtraData: TPM2BData{Buffer: nonce},
+		Attested:  NewTPMUAttest(TPMSTAttestCertify, &TPMSCertifyInfo{Name: *name}),
+	})
+	digest, ticket, err := HashData(thetpm, TPMAlgSHA256, info.Bytes(), HashHierarchy(TPMRHEndorsement))
+	if err != nil {
+		t.Fatalf("HashData: %v", err)
+	}
+	sig, err := Sign{
+		KeyHandle:  ak,
+		Digest:     TPM2BDigest{Buffer: digest},
+		InScheme:   TPMTSigScheme{Scheme: TPMAlgNull},
+		Validation: *ticket,
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return &ResidencyProof{
+		KeyPublic:   Marshal(New2B(keyPub)),
+		CertifyInfo: Marshal(info),
+		Signature:   Marshal(sig.Signature),
+	}
+}
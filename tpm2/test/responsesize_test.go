@@ -0,0 +1,79 @@
+package tpm2test
+
+import (
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// chunkReader is an io.ReadWriter that hands out a TPM's responses in
+// pieces as large as the reader's buffer.
+type chunkReader struct {
+	tpm transport.TPM
+	rsp []byte
+}
+
+func (c *chunkReader) Write(cmd []byte) (int, error) {
+	rsp, err := c.tpm.Send(cmd)
+	if err != nil {
+		return 0, err
+	}
+	c.rsp = rsp
+	return len(cmd), nil
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	n := copy(p, c.rsp)
+	c.rsp = c.rsp[n:]
+	return n, nil
+}
+
+func TestConfigureMaxResponseSize(t *testing.T) {
+	sim, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer sim.Close()
+
+	size, err := MaxResponseSize(sim)
+	if err != nil {
+		t.Fatalf("MaxResponseSize() = %v", err)
+	}
+	if size < 1024 {
+		t.Errorf("MaxResponseSize() = %d, want at least 1024", size)
+	}
+
+	// Route through a transport with a configurable buffer, and make it
+	// too small for a list of all the TPM's commands. The response is read
+	// in pieces until the size in its header has arrived.
+	thetpm := transport.FromReadWriter(&chunkReader{tpm: sim})
+	thetpm.(transport.ResponseSizer).SetMaxResponseSize(64)
+	getCommands := GetCapability{
+		Capability:    TPMCapCommands,
+		Property:      0,
+		PropertyCount: 16,
+	}
+	if _, err := getCommands.Execute(thetpm); err != nil {
+		t.Fatalf("GetCapability() with a small buffer = %v", err)
+	}
+
+	if err := ConfigureMaxResponseSize(thetpm); err != nil {
+		t.Fatalf("ConfigureMaxResponseSize() = %v", err)
+	}
+	if _, err := getCommands.Execute(thetpm); err != nil {
+		t.Errorf("GetCapability() after ConfigureMaxResponseSize() = %v", err)
+	}
+
+	// Transports without a configurable buffer are left alone.
+	if err := ConfigureMaxResponseSize(sim); err != nil {
+		t.Errorf("ConfigureMaxResponseSize() on a fixed transport = %v", err)
+	}
+	thetpm.(transport.ResponseSizer).SetMaxResponseSize(0)
+	getRandom := GetRandom{BytesRequested: tpmutil.DefaultMaxResponseSize / 256}
+	if _, err := getRandom.Execute(thetpm); err != nil {
+		t.Errorf("GetRandom() with the default buffer = %v", err)
+	}
+}
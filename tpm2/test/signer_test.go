@@ -0,0 +1,109 @@
+package tpm2test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestSigner(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	rsaTemplate := RSASRKTemplate
+	rsaTemplate.ObjectAttributes.Restricted = false
+	rsaTemplate.ObjectAttributes.Decrypt = false
+	rsaTemplate.ObjectAttributes.SignEncrypt = true
+	rsaTemplate.Parameters = NewTPMUPublicParms(TPMAlgRSA, &TPMSRSAParms{
+		KeyBits: 2048,
+	})
+
+	eccTemplate := ECCSRKTemplate
+	eccTemplate.ObjectAttributes.Restricted = false
+	eccTemplate.ObjectAttributes.Decrypt = false
+	eccTemplate.ObjectAttributes.SignEncrypt = true
+	eccTemplate.Parameters = NewTPMUPublicParms(TPMAlgECC, &TPMSECCParms{
+		CurveID: TPMECCNistP256,
+	})
+
+	load := func(t *testing.T, tmpl TPMTPublic) *Signer {
+		t.Helper()
+		rsp, err := CreatePrimary{
+			PrimaryHandle: TPMRHOwner,
+			InPublic:      New2B(tmpl),
+		}.Execute(thetpm)
+		if err != nil {
+			t.Fatalf("CreatePrimary: %v", err)
+		}
+		t.Cleanup(func() { FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm) })
+		signer, err := NewSigner(thetpm, AuthHandle{
+			Handle: rsp.ObjectHandle,
+			Auth:   PasswordAuth(nil),
+		})
+		if err != nil {
+			t.Fatalf("NewSigner: %v", err)
+		}
+		return signer
+	}
+
+	digest := sha256.Sum256([]byte("message"))
+
+	t.Run("RSASSA", func(t *testing.T) {
+		signer := load(t, rsaTemplate)
+		sig, err := signer.Sign(nil, digest[:], crypto.SHA256)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		if err := rsa.VerifyPKCS1v15(signer.Public().(*rsa.PublicKey), crypto.SHA256, digest[:], sig); err != nil {
+			t.Errorf("signature did not verify: %v", err)
+		}
+	})
+
+	t.Run("RSAPSS", func(t *testing.T) {
+		signer := load(t, rsaTemplate)
+		opts := &rsa.PSSOptions{Hash: crypto.SHA256, SaltLength: rsa.PSSSaltLengthEqualsHash}
+		sig, err := signer.Sign(nil, digest[:], opts)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		if err := rsa.VerifyPSS(signer.Public().(*rsa.PublicKey), crypto.SHA256, digest[:], sig, opts); err != nil {
+			t.Errorf("signature did not verify: %v", err)
+		}
+	})
+
+	t.Run("ECDSA", func(t *testing.T) {
+		signer := load(t, eccTemplate)
+		sig, err := signer.Sign(nil, digest[:], crypto.SHA256)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		if !ecdsa.VerifyASN1(signer.Public().(*ecdsa.PublicKey), digest[:], sig) {
+			t.Error("signature did not verify")
+		}
+		if _, err := signer.Sign(nil, digest[:16], crypto.SHA256); err == nil {
+			t.Error("Sign accepted a short digest")
+		}
+	})
+
+	t.Run("Restricted", func(t *testing.T) {
+		rsp, err := CreatePrimary{
+			PrimaryHandle: TPMRHOwner,
+			InPublic:      New2B(ECCSRKTemplate),
+		}.Execute(thetpm)
+		if err != nil {
+			t.Fatalf("CreatePrimary: %v", err)
+		}
+		defer FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm)
+		if _, err := NewSigner(thetpm, AuthHandle{Handle: rsp.ObjectHandle}); err == nil {
+			t.Error("NewSigner accepted a restricted decryption key")
+		}
+	})
+}
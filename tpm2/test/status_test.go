@@ -0,0 +1,111 @@
+package tpm2test
+
+import (
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestGetStatus(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	s, err := GetStatus(thetpm)
+	if err != nil {
+		t.Fatalf("GetStatus: %v", err)
+	}
+	if !s.Platform.Enabled || !s.Owner.Enabled || !s.Endorsement.Enabled {
+		t.Errorf("hierarchies = %+v, %+v, %+v, want all enabled", s.Platform, s.Owner, s.Endorsement)
+	}
+	if s.Owner.AuthSet || s.Endorsement.AuthSet || s.Lockout.AuthSet {
+		t.Errorf("fresh TPM reports authorization values set")
+	}
+	if s.DA.MaxTries == 0 {
+		t.Errorf("DA.MaxTries = 0")
+	}
+	if da, err := GetLockoutStatus(thetpm); err != nil {
+		t.Errorf("GetLockoutStatus: %v", err)
+	} else if *da != s.DA {
+		t.Errorf("GetLockoutStatus() = %+v, want %+v", *da, s.DA)
+	}
+	if len(s.PCRBanks) == 0 {
+		t.Errorf("no active PCR banks")
+	}
+	if p := s.Problems(); len(p) != 0 {
+		t.Errorf("Problems() = %q, want none", p)
+	}
+	persistent := len(s.PersistentHandles)
+
+	if _, err := (HierarchyChangeAuth{
+		AuthHandle: TPMRHOwner,
+		NewAuth:    TPM2BAuth{Buffer: []byte("owner")},
+	}).Execute(thetpm); err != nil {
+		t.Fatalf("HierarchyChangeAuth: %v", err)
+	}
+	defer HierarchyChangeAuth{
+		AuthHandle: AuthHandle{Handle: TPMRHOwner, Auth: PasswordAuth([]byte("owner"))},
+	}.Execute(thetpm)
+
+	srk, err := CreatePrimary{
+		PrimaryHandle: AuthHandle{Handle: TPMRHOwner, Auth: PasswordAuth([]byte("owner"))},
+		InPublic:      New2B(ECCSRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer FlushContext{FlushHandle: srk.ObjectHandle}.Execute(thetpm)
+	const handle TPMHandle = 0x81000123
+	if _, err := (EvictControl{
+		Auth:             AuthHandle{Handle: TPMRHOwner, Auth: PasswordAuth([]byte("owner"))},
+		ObjectHandle:     NamedHandle{Handle: srk.ObjectHandle, Name: srk.Name},
+		PersistentHandle: handle,
+	}).Execute(thetpm); err != nil {
+		t.Fatalf("EvictControl: %v", err)
+	}
+	defer EvictControl{
+		Auth:             AuthHandle{Handle: TPMRHOwner, Auth: PasswordAuth([]byte("owner"))},
+		ObjectHandle:     NamedHandle{Handle: handle, Name: srk.Name},
+		PersistentHandle: handle,
+	}.Execute(thetpm)
+
+	s2, err := GetStatus(thetpm)
+	if err != nil {
+		t.Fatalf("GetStatus: %v", err)
+	}
+	if !s2.Owner.AuthSet {
+		t.Errorf("Owner.AuthSet = false after setting owner authorization")
+	}
+	if len(s2.PersistentHandles) != persistent+1 {
+		t.Errorf("got %d persistent handles, want %d", len(s2.PersistentHandles), persistent+1)
+	}
+	if s2.PersistentAvail >= s.PersistentAvail && s.PersistentAvail != 0 {
+		t.Errorf("PersistentAvail = %d, want less than %d", s2.PersistentAvail, s.PersistentAvail)
+	}
+}
+
+func TestStatusProblems(t *testing.T) {
+	s := Status{
+		Owner:           HierarchyStatus{Enabled: true},
+		Endorsement:     HierarchyStatus{Enabled: false},
+		DA:              LockoutStatus{InLockout: true},
+		PersistentAvail: 3,
+		PCRBanks:        []TPMIAlgHash{TPMAlgSHA256},
+	}
+	want := []string{
+		"endorsement hierarchy is disabled",
+		"TPM is in dictionary attack lockout",
+	}
+	got := s.Problems()
+	if len(got) != len(want) {
+		t.Fatalf("Problems() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Problems()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
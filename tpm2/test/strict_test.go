@@ -0,0 +1,109 @@
+package tpm2test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestStrict(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+	sent := 0
+	strict := Strict(transport.Chain(thetpm, func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+		sent++
+		return next(cmd)
+	}))
+
+	createPrimary := func(cmd CreatePrimary) error {
+		cmd.InPublic = New2B(ECCSRKTemplate)
+		rsp, err := cmd.Execute(strict)
+		if err == nil {
+			FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(thetpm)
+		}
+		return err
+	}
+
+	// The simulator's hierarchies have no authorization values.
+	for name, cmd := range map[string]func() error{
+		"PlainHandle": func() error { return createPrimary(CreatePrimary{PrimaryHandle: TPMRHOwner}) },
+		"EmptyPassword": func() error {
+			return createPrimary(CreatePrimary{PrimaryHandle: AuthHandle{Handle: TPMRHOwner, Auth: PasswordAuth(nil)}})
+		},
+		"EmptyHMAC": func() error {
+			return createPrimary(CreatePrimary{PrimaryHandle: AuthHandle{Handle: TPMRHOwner, Auth: HMAC(TPMAlgSHA256, 16)}})
+		},
+		"Lockout": func() error {
+			_, err := DictionaryAttackLockReset{LockHandle: TPMRHLockout}.Execute(strict)
+			return err
+		},
+		"Platform": func() error { return createPrimary(CreatePrimary{PrimaryHandle: TPMRHPlatform}) },
+	} {
+		if err := cmd(); !errors.Is(err, ErrEmptyHierarchyAuth) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrEmptyHierarchyAuth)
+		}
+	}
+	if sent != 0 {
+		t.Errorf("%d refused commands reached the TPM", sent)
+	}
+
+	// Other hierarchies and objects may have empty authorization.
+	if err := createPrimary(CreatePrimary{PrimaryHandle: TPMRHEndorsement}); err != nil {
+		t.Errorf("CreatePrimary under the endorsement hierarchy: %v", err)
+	}
+
+	// Once the owner hierarchy has an authorization value, it can be used.
+	auth := []byte("owner")
+	if _, err := (HierarchyChangeAuth{
+		AuthHandle: TPMRHOwner,
+		NewAuth:    TPM2BAuth{Buffer: auth},
+	}).Execute(thetpm); err != nil {
+		t.Fatalf("HierarchyChangeAuth: %v", err)
+	}
+	defer HierarchyChangeAuth{
+		AuthHandle: AuthHandle{Handle: TPMRHOwner, Auth: PasswordAuth(auth)},
+	}.Execute(thetpm)
+	for name, sess := range map[string]Session{
+		"Password": PasswordAuth(auth),
+		"HMAC":     HMAC(TPMAlgSHA256, 16, Auth(auth)),
+		"Bound":    HMAC(TPMAlgSHA256, 16, Bound(TPMRHOwner, TPM2BName{}, auth)),
+	} {
+		if err := createPrimary(CreatePrimary{PrimaryHandle: AuthHandle{Handle: TPMRHOwner, Auth: sess}}); err != nil {
+			t.Errorf("%s: CreatePrimary: %v", name, err)
+		}
+	}
+}
+
+func TestStrictWrapped(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+	strict := Strict(thetpm)
+
+	// Execute finds the strict transport beneath other wrappers.
+	for name, wrapped := range map[string]transport.TPM{
+		"Chain":            transport.Chain(strict),
+		"WithContext":      transport.WithContext(context.Background(), strict),
+		"ProgressReporter": NewProgressReporter(strict, time.Second, nil),
+		"Queue":            transport.NewQueue(strict),
+		"Journal":          NewJournal(strict),
+	} {
+		_, err := CreatePrimary{
+			PrimaryHandle: TPMRHOwner,
+			InPublic:      New2B(ECCSRKTemplate),
+		}.Execute(wrapped)
+		if !errors.Is(err, ErrEmptyHierarchyAuth) {
+			t.Errorf("%s: CreatePrimary() = %v, want %v", name, err, ErrEmptyHierarchyAuth)
+		}
+	}
+}
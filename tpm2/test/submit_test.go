@@ -0,0 +1,124 @@
+package tpm2test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	. "github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestSubmit(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	// The queue's goroutines are the only ones sending commands, so the
+	// recorder needs no lock.
+	var sent []TPMCC
+	record := func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+		sent = append(sent, TPMCC(binary.BigEndian.Uint32(cmd[6:10])))
+		return next(cmd)
+	}
+	q := transport.NewQueue(transport.Chain(thetpm, record))
+	defer q.Close()
+
+	read := PCRRead{
+		PCRSelectionIn: TPMLPCRSelection{
+			PCRSelections: []TPMSPCRSelection{
+				{Hash: TPMAlgSHA256, PCRSelect: PCClientCompatible.PCRs(16)},
+			},
+		},
+	}
+	extend := func(data byte) PCRExtend {
+		digest := sha256.Sum256([]byte{data})
+		return PCRExtend{
+			PCRHandle: AuthHandle{Handle: TPMHandle(16), Auth: PasswordAuth(nil)},
+			Digests: TPMLDigestValues{
+				Digests: []TPMTHA{{HashAlg: TPMAlgSHA256, Digest: digest[:]}},
+			},
+		}
+	}
+
+	// Each read must see the extends submitted before it, and none after.
+	var reads []*Future[PCRReadResponse]
+	var randoms []*Future[GetRandomResponse]
+	var want []TPMCC
+	for i := byte(0); i < 4; i++ {
+		Submit(q, extend(i))
+		reads = append(reads, Submit(q, read))
+		randoms = append(randoms, Submit(q, GetRandom{BytesRequested: 16}))
+		want = append(want, TPMCCPCRExtend, TPMCCPCRRead, TPMCCGetRandom)
+	}
+
+	var values [][]byte
+	for i, f := range reads {
+		rsp, err := f.Wait()
+		if err != nil {
+			t.Fatalf("PCRRead %d: %v", i, err)
+		}
+		values = append(values, rsp.PCRValues.Digests[0].Buffer)
+	}
+	for i, f := range randoms {
+		rsp, err := f.Wait()
+		if err != nil {
+			t.Fatalf("GetRandom %d: %v", i, err)
+		}
+		if len(rsp.RandomBytes.Buffer) != 16 {
+			t.Errorf("GetRandom %d returned %d bytes, want 16", i, len(rsp.RandomBytes.Buffer))
+		}
+	}
+	for i := 1; i < len(values); i++ {
+		h := sha256.New()
+		h.Write(values[i-1])
+		d := sha256.Sum256([]byte{byte(i)})
+		h.Write(d[:])
+		if got := h.Sum(nil); !bytes.Equal(values[i], got) {
+			t.Errorf("read %d = %x, want %x, the previous read extended by the next extend", i, values[i], got)
+		}
+	}
+	if len(sent) != len(want) {
+		t.Fatalf("sent %v, want %v", sent, want)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Fatalf("sent %v, want %v", sent, want)
+		}
+	}
+
+	// Execute through the queue is ordered after the submitted commands.
+	last := Submit(q, read)
+	if _, err := extend(9).Execute(q); err != nil {
+		t.Fatalf("PCRExtend: %v", err)
+	}
+	if rsp, err := last.Wait(); err != nil {
+		t.Errorf("PCRRead: %v", err)
+	} else if got := rsp.PCRValues.Digests[0].Buffer; !bytes.Equal(got, values[len(values)-1]) {
+		t.Errorf("PCRRead submitted before PCRExtend saw its effect")
+	}
+}
+
+func TestSubmitErrors(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	q := transport.NewQueue(thetpm)
+
+	if _, err := Submit(q, GetRandom{BytesRequested: 8}, HMAC(TPMAlgSHA256, 16)).Wait(); !errors.Is(err, ErrSubmitSession) {
+		t.Errorf("Submit() with an HMAC session = %v, want %v", err, ErrSubmitSession)
+	}
+	if _, err := Submit(q, ReadPublic{ObjectHandle: 0x80ffffff}).Wait(); !errors.Is(err, TPMRCValue) {
+		t.Errorf("Submit(ReadPublic) = %v, want %v", err, TPMRCValue)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if _, err := Submit(q, GetRandom{BytesRequested: 8}).Wait(); !errors.Is(err, transport.ErrQueueClosed) {
+		t.Errorf("Submit() after Close = %v, want %v", err, transport.ErrQueueClosed)
+	}
+}
@@ -0,0 +1,105 @@
+package testutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errNoSHA256 is reported when a download URL is set without a digest.
+var errNoSHA256 = errors.New("no SHA-256 digest set for the download")
+
+// URLEnv returns the environment variable holding the URL from which the
+// backend's simulator binary is downloaded if it isn't installed:
+// GOTPM_SWTPM_URL or GOTPM_MSSIM_URL.
+func URLEnv(b Backend) string {
+	return "GOTPM_" + strings.ToUpper(string(b)) + "_URL"
+}
+
+// SHA256Env returns the environment variable holding the hex-encoded SHA-256
+// digest that a binary downloaded from URLEnv(b) must have:
+// GOTPM_SWTPM_SHA256 or GOTPM_MSSIM_SHA256. It is required, so that tests
+// never run an unverified binary.
+func SHA256Env(b Backend) string {
+	return "GOTPM_" + strings.ToUpper(string(b)) + "_SHA256"
+}
+
+// cacheRoot returns the directory under which downloaded binaries are kept.
+var cacheRoot = os.UserCacheDir
+
+// fetchBinary downloads the binary at url, which must have the SHA-256 digest
+// sum, into the cache and returns its path. A binary already in the cache is
+// used without downloading it again, so that it is only fetched once for all
+// test binaries.
+func fetchBinary(url, sum, name string) (string, error) {
+	want, err := hex.DecodeString(sum)
+	if err != nil || len(want) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 digest %q", sum)
+	}
+	root, err := cacheRoot()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(root, "go-tpm", "testutil", hex.EncodeToString(want))
+	path := filepath.Join(dir, name)
+	if got, err := fileDigest(path); err == nil && string(got) == string(want) {
+		return path, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	rsp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %s: %s", url, rsp.Status)
+	}
+	// Download next to the final path and rename, so that concurrent test
+	// binaries never see a partial file.
+	f, err := os.CreateTemp(dir, name+".*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), rsp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("fetching %s: %w", url, err)
+	}
+	if got := h.Sum(nil); string(got) != string(want) {
+		return "", fmt.Errorf("%s has SHA-256 %x, want %x", url, got, want)
+	}
+	if err := os.Chmod(f.Name(), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// fileDigest returns the SHA-256 digest of the file at path.
+func fileDigest(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,96 @@
+package testutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// handleCreators are the commands that return a new transient object or
+// session handle as their first response handle.
+var handleCreators = map[tpm2.TPMCC]string{
+	tpm2.TPMCCCreatePrimary:     "CreatePrimary",
+	tpm2.TPMCCLoad:              "Load",
+	tpm2.TPMCCLoadExternal:      "LoadExternal",
+	tpm2.TPMCCCreateLoaded:      "CreateLoaded",
+	tpm2.TPMCCStartAuthSession:  "StartAuthSession",
+	tpm2.TPMCCContextLoad:       "ContextLoad",
+	tpm2.TPMCCHashSequenceStart: "HashSequenceStart",
+	tpm2.TPMCCMACStart:          "HMACStart",
+}
+
+// leakChecker is a transport that records the handles created through it.
+type leakChecker struct {
+	tpm transport.TPM
+
+	mu      sync.Mutex
+	created map[tpm2.TPMHandle]string
+}
+
+// Unwrap implements transport.Wrapper.
+func (l *leakChecker) Unwrap() transport.TPM {
+	return l.tpm
+}
+
+// Send implements transport.TPM.
+func (l *leakChecker) Send(input []byte) ([]byte, error) {
+	rsp, err := l.tpm.Send(input)
+	if err != nil || len(input) < 10 || len(rsp) < 14 {
+		return rsp, err
+	}
+	cc := tpm2.TPMCC(binary.BigEndian.Uint32(input[6:10]))
+	name, ok := handleCreators[cc]
+	if !ok || binary.BigEndian.Uint32(rsp[6:10]) != 0 {
+		return rsp, err
+	}
+	h := tpm2.TPMHandle(binary.BigEndian.Uint32(rsp[10:14]))
+	l.mu.Lock()
+	l.created[h] = name
+	l.mu.Unlock()
+	return rsp, nil
+}
+
+// leaks returns a description of each recorded handle that is still loaded.
+func (l *leakChecker) leaks() ([]string, error) {
+	var leaks []string
+	for _, ht := range []tpm2.TPMHT{tpm2.TPMHTTransient, tpm2.TPMHTHMACSession} {
+		loaded, err := tpm2.GetHandles(l.tpm, ht)
+		if err != nil {
+			return nil, err
+		}
+		l.mu.Lock()
+		for _, h := range loaded {
+			if name, ok := l.created[h]; ok {
+				leaks = append(leaks, fmt.Sprintf("0x%08x (from %s)", uint32(h), name))
+			}
+		}
+		l.mu.Unlock()
+	}
+	return leaks, nil
+}
+
+// CheckLeaks returns a transport that records the transient objects and
+// sessions created through t, and fails the test during cleanup if any of
+// them are still loaded. It catches leaks that would exhaust the few object
+// slots of real TPMs.
+//
+// Cleanups run in reverse order, so t must stay open until after the cleanup
+// registered by CheckLeaks has run; a TPM from New does.
+func CheckLeaks(tb testing.TB, t transport.TPM) transport.TPM {
+	l := &leakChecker{tpm: t, created: make(map[tpm2.TPMHandle]string)}
+	tb.Cleanup(func() {
+		leaks, err := l.leaks()
+		if err != nil {
+			tb.Errorf("could not check for leaked handles: %v", err)
+			return
+		}
+		for _, leak := range leaks {
+			tb.Errorf("handle %s was not flushed", leak)
+		}
+	})
+	return l
+}
@@ -0,0 +1,139 @@
+package testutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// MSSimPathEnv is the environment variable holding the path of tpm_server.
+const MSSimPathEnv = "GOTPM_MSSIM_PATH"
+
+// Commands of the reference simulator's TCP protocol.
+const (
+	mssimPowerOn     = 1
+	mssimSendCommand = 8
+	mssimNVOn        = 11
+	mssimSessionEnd  = 20
+)
+
+// mssimNVFile is the file in its working directory in which tpm_server
+// keeps the TPM's NV memory, writing it through on every NV commit.
+const mssimNVFile = "NVChip"
+
+// mssim talks to tpm_server over its command and platform sockets.
+type mssim struct {
+	cmd, platform net.Conn
+	// dir is tpm_server's working directory.
+	dir string
+}
+
+// startMSSim runs tpm_server in a temporary directory, so that it
+// manufactures a fresh TPM, or starts from the NV memory in snap if it is
+// not nil, then powers it on and starts it up.
+func startMSSim(tb testing.TB, snap *Snapshot) (transport.TPMCloser, error) {
+	bin := findBinary(tb, MSSim, os.Getenv(MSSimPathEnv), "tpm_server")
+	port, err := freePorts()
+	if err != nil {
+		return nil, err
+	}
+	dir := tb.TempDir()
+	if snap != nil {
+		if err := os.WriteFile(filepath.Join(dir, mssimNVFile), snap.nvChip, 0o600); err != nil {
+			return nil, err
+		}
+	}
+	cmd := exec.Command(bin, "-port", strconv.Itoa(port))
+	cmd.Dir = dir
+	if err := startProcess(tb, cmd); err != nil {
+		return nil, err
+	}
+
+	s := &mssim{dir: dir}
+	if s.cmd, err = dial("tcp", fmt.Sprintf("localhost:%d", port)); err != nil {
+		return nil, err
+	}
+	if s.platform, err = dial("tcp", fmt.Sprintf("localhost:%d", port+1)); err != nil {
+		s.cmd.Close()
+		return nil, err
+	}
+	for _, sig := range []uint32{mssimPowerOn, mssimNVOn} {
+		if err := s.signal(sig); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("platform signal %d: %w", sig, err)
+		}
+	}
+	if err := startup(s); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// signal sends a platform signal and waits for it to be acknowledged.
+func (s *mssim) signal(sig uint32) error {
+	if err := binary.Write(s.platform, binary.BigEndian, sig); err != nil {
+		return err
+	}
+	return readAck(s.platform)
+}
+
+// readAck reads the status word that ends every simulator response.
+func readAck(r io.Reader) error {
+	var ack uint32
+	if err := binary.Read(r, binary.BigEndian, &ack); err != nil {
+		return err
+	}
+	if ack != 0 {
+		return fmt.Errorf("simulator returned status %d", ack)
+	}
+	return nil
+}
+
+// Send implements transport.TPM.
+func (s *mssim) Send(input []byte) ([]byte, error) {
+	hdr := make([]byte, 9, 9+len(input))
+	binary.BigEndian.PutUint32(hdr[0:], mssimSendCommand)
+	hdr[4] = 0 // locality
+	binary.BigEndian.PutUint32(hdr[5:], uint32(len(input)))
+	if _, err := s.cmd.Write(append(hdr, input...)); err != nil {
+		return nil, err
+	}
+	var size uint32
+	if err := binary.Read(s.cmd, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	rsp := make([]byte, size)
+	if _, err := io.ReadFull(s.cmd, rsp); err != nil {
+		return nil, err
+	}
+	if err := readAck(s.cmd); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// Close ends the sessions with the simulator.
+func (s *mssim) Close() error {
+	binary.Write(s.cmd, binary.BigEndian, uint32(mssimSessionEnd))
+	binary.Write(s.platform, binary.BigEndian, uint32(mssimSessionEnd))
+	s.platform.Close()
+	return s.cmd.Close()
+}
+
+// snapshot implements snapshotter.
+func (s *mssim) snapshot() (*Snapshot, error) {
+	nv, err := os.ReadFile(filepath.Join(s.dir, mssimNVFile))
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{backend: MSSim, nvChip: nv}, nil
+}
@@ -0,0 +1,86 @@
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// startupTimeout is how long a simulator process has to start listening.
+const startupTimeout = 10 * time.Second
+
+// findBinary returns the path of the backend's simulator binary. If it isn't
+// installed, it is downloaded from URLEnv(b), if that is set, and otherwise
+// the test is skipped.
+func findBinary(tb testing.TB, b Backend, path, name string) string {
+	tb.Helper()
+	if path == "" {
+		path = name
+	}
+	p, err := exec.LookPath(path)
+	if err == nil {
+		return p
+	}
+	url := os.Getenv(URLEnv(b))
+	if url == "" {
+		tb.Skipf("%s is not installed, and %s is not set: %v", name, URLEnv(b), err)
+	}
+	sum := os.Getenv(SHA256Env(b))
+	if sum == "" {
+		tb.Fatalf("could not fetch %s: %v: set %s", name, errNoSHA256, SHA256Env(b))
+	}
+	if p, err = fetchBinary(url, sum, name); err != nil {
+		tb.Fatalf("could not fetch %s: %v", name, err)
+	}
+	return p
+}
+
+// startProcess starts cmd and arranges for it to be killed when the test
+// finishes.
+func startProcess(tb testing.TB, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	tb.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	return nil
+}
+
+// dial connects to a simulator, retrying while it starts up.
+func dial(network, addr string) (net.Conn, error) {
+	deadline := time.Now().Add(startupTimeout)
+	for {
+		conn, err := net.Dial(network, addr)
+		if err == nil {
+			return conn, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("simulator did not start listening on %s: %w", addr, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// freePorts returns a pair of consecutive free TCP ports on localhost.
+func freePorts() (int, error) {
+	for i := 0; i < 10; i++ {
+		l, err := net.Listen("tcp", "localhost:0")
+		if err != nil {
+			return 0, err
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		l2, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", port+1))
+		l.Close()
+		if err == nil {
+			l2.Close()
+			return port, nil
+		}
+	}
+	return 0, errors.New("could not find two consecutive free ports")
+}
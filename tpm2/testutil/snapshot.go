@@ -0,0 +1,103 @@
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/swtpm"
+)
+
+// ErrSnapshotUnsupported is returned by Snapshot for the embedded simulator,
+// whose state lives in the test binary and can't be saved.
+var ErrSnapshotUnsupported = errors.New("backend does not support snapshots")
+
+// Snapshot is the permanent state of a TPM: its seeds, hierarchy settings,
+// persistent objects and NV indices. A TPM started from a snapshot with
+// WithSnapshot is as the snapshotted TPM would be after a reboot, so
+// transient objects and sessions are not included.
+type Snapshot struct {
+	backend Backend
+	// swtpm is the state of an SWTPM TPM.
+	swtpm *swtpm.State
+	// nvChip is the NV memory file of an MSSim TPM.
+	nvChip []byte
+}
+
+// Backend returns the backend that the snapshot was taken from, which is the
+// only one it can be restored to.
+func (s *Snapshot) Backend() Backend {
+	return s.backend
+}
+
+// snapshotter is implemented by the transports of backends that support
+// snapshots.
+type snapshotter interface {
+	snapshot() (*Snapshot, error)
+}
+
+// WithSnapshot starts the TPM from s rather than from a freshly manufactured
+// TPM, and selects the backend that s was taken from. With WithSRK, an SRK
+// already in s is used rather than provisioned again.
+func WithSnapshot(s *Snapshot) Option {
+	return func(c *config) {
+		c.backend = s.backend
+		c.snapshot = s
+	}
+}
+
+// Snapshot returns the TPM's permanent state, or an error wrapping
+// ErrSnapshotUnsupported for the embedded simulator.
+func (t *TPM) Snapshot() (*Snapshot, error) {
+	s, ok := t.backend.(snapshotter)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotUnsupported, t.Backend)
+	}
+	return s.snapshot()
+}
+
+var (
+	snapshotsMu sync.Mutex
+	// snapshots caches the snapshots taken by Provisioned.
+	snapshots = make(map[snapshotKey]*Snapshot)
+)
+
+type snapshotKey struct {
+	backend Backend
+	name    string
+}
+
+// Provisioned is like New, but returns a TPM that provision has been run on.
+// Provisioning that is slow, such as creating keys or defining NV indices,
+// then only happens once per test binary: the first call for each name and
+// backend runs provision and takes a snapshot of the result, and later calls
+// start from the snapshot. With the embedded simulator, which can't be
+// snapshotted, provision is run every time.
+//
+// Calls with the same name must provision the TPM the same way, and should
+// pass the same options.
+func Provisioned(tb testing.TB, name string, provision func(transport.TPM) error, opts ...Option) *TPM {
+	tb.Helper()
+	key := snapshotKey{newConfig(opts).backend, name}
+
+	snapshotsMu.Lock()
+	defer snapshotsMu.Unlock()
+	if s, ok := snapshots[key]; ok {
+		return New(tb, append(opts, WithSnapshot(s))...)
+	}
+	t := New(tb, opts...)
+	if err := provision(t); err != nil {
+		tb.Fatalf("could not provision %s TPM %q: %v", t.Backend, name, err)
+	}
+	s, err := t.Snapshot()
+	if errors.Is(err, ErrSnapshotUnsupported) {
+		return t
+	}
+	if err != nil {
+		tb.Fatalf("could not snapshot %s TPM %q: %v", t.Backend, name, err)
+	}
+	snapshots[key] = s
+	return t
+}
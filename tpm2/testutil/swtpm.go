@@ -0,0 +1,64 @@
+//go:build !windows
+
+package testutil
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/swtpm"
+)
+
+// startSWTPM runs swtpm with fresh state in a temporary directory, listening
+// on Unix domain sockets, and restores snap if it is not nil.
+func startSWTPM(tb testing.TB, snap *Snapshot) (transport.TPMCloser, error) {
+	bin := findBinary(tb, SWTPM, "", "swtpm")
+	dir := tb.TempDir()
+	sock := filepath.Join(dir, "swtpm.sock")
+	ctrl := filepath.Join(dir, "swtpm.ctrl")
+	cmd := exec.Command(bin, "socket", "--tpm2",
+		"--tpmstate", "dir="+dir,
+		"--server", "type=unixio,path="+sock,
+		"--ctrl", "type=unixio,path="+ctrl,
+		"--flags", "not-need-init")
+	if err := startProcess(tb, cmd); err != nil {
+		return nil, err
+	}
+	// Wait for the socket to appear.
+	conn, err := dial("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+
+	t, err := swtpm.Open(swtpm.Config{Network: "unix", Address: sock, CtrlAddress: ctrl})
+	if err != nil {
+		return nil, err
+	}
+	if snap != nil {
+		err = t.RestoreState(snap.swtpm)
+	} else {
+		err = startup(t)
+	}
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return &swtpmTPM{t}, nil
+}
+
+// swtpmTPM is an swtpm instance started by startSWTPM.
+type swtpmTPM struct {
+	*swtpm.TPM
+}
+
+// snapshot implements snapshotter.
+func (t *swtpmTPM) snapshot() (*Snapshot, error) {
+	state, err := t.SaveState()
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{backend: SWTPM, swtpm: state}, nil
+}
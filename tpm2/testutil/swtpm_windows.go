@@ -0,0 +1,14 @@
+package testutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// startSWTPM skips the test: swtpm is not supported on Windows.
+func startSWTPM(tb testing.TB, _ *Snapshot) (transport.TPMCloser, error) {
+	tb.Skip("swtpm is not supported on Windows")
+	return nil, errors.New("unreachable")
+}
@@ -0,0 +1,189 @@
+// Package testutil starts TPM simulators for tests and hands them out ready
+// to use: started up, optionally provisioned, and torn down when the test
+// finishes.
+//
+// By default tests use the simulator embedded in this module. Setting
+// GOTPM_TEST_BACKEND to "swtpm" or "mssim" runs the same tests against
+// swtpm or the Microsoft/IBM reference simulator (tpm_server) instead. A
+// binary that isn't installed is downloaded from the URL in GOTPM_SWTPM_URL
+// or GOTPM_MSSIM_URL, checked against the SHA-256 digest in
+// GOTPM_SWTPM_SHA256 or GOTPM_MSSIM_SHA256 and cached for later runs; with no
+// URL set, tests that need it are skipped.
+//
+// With swtpm and tpm_server, Provisioned provisions a TPM once and starts
+// later TPMs from a snapshot of its state, which makes tests that need keys
+// or NV indices set up much faster to start.
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// Backend selects the TPM implementation used by a test.
+type Backend string
+
+const (
+	// Embedded is the reference simulator compiled into the test binary.
+	Embedded Backend = "embedded"
+	// SWTPM is swtpm, run as a child process.
+	SWTPM Backend = "swtpm"
+	// MSSim is the reference simulator's tpm_server, run as a child
+	// process. Its path is taken from GOTPM_MSSIM_PATH, or found in PATH.
+	MSSim Backend = "mssim"
+)
+
+// SRKHandle is the persistent handle at which WithSRK stores the SRK.
+const SRKHandle tpm2.TPMHandle = 0x81000001
+
+// BackendEnv is the environment variable that selects the default backend.
+const BackendEnv = "GOTPM_TEST_BACKEND"
+
+type config struct {
+	backend  Backend
+	srk      bool
+	leaks    bool
+	snapshot *Snapshot
+}
+
+// newConfig applies opts to the default configuration.
+func newConfig(opts []Option) config {
+	c := config{backend: Backend(os.Getenv(BackendEnv))}
+	if c.backend == "" {
+		c.backend = Embedded
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// Option configures a TPM returned by New.
+type Option func(*config)
+
+// WithBackend selects the backend, overriding GOTPM_TEST_BACKEND.
+func WithBackend(b Backend) Option {
+	return func(c *config) {
+		c.backend = b
+	}
+}
+
+// WithSRK provisions an RSA storage root key, using the TCG reference
+// template, at SRKHandle.
+func WithSRK() Option {
+	return func(c *config) {
+		c.srk = true
+	}
+}
+
+// WithLeakCheck fails the test if any transient object or session created
+// through the TPM is still loaded when the test finishes. See CheckLeaks.
+func WithLeakCheck() Option {
+	return func(c *config) {
+		c.leaks = true
+	}
+}
+
+// TPM is a TPM that is ready for use by a test.
+type TPM struct {
+	transport.TPM
+
+	// Backend is the backend in use.
+	Backend Backend
+
+	// SRK is the storage root key, if WithSRK was given.
+	SRK tpm2.NamedHandle
+
+	// backend is the backend's own transport, which Snapshot uses.
+	backend transport.TPMCloser
+}
+
+// New starts a TPM for the test, and arranges for it to be shut down when
+// the test and its subtests finish. It fails the test if the TPM can't be
+// started, or skips it if the selected backend isn't installed.
+func New(tb testing.TB, opts ...Option) *TPM {
+	tb.Helper()
+	c := newConfig(opts)
+
+	var t transport.TPMCloser
+	var err error
+	switch c.backend {
+	case Embedded:
+		if c.snapshot != nil {
+			err = ErrSnapshotUnsupported
+		} else {
+			t, err = simulator.OpenSimulator()
+		}
+	case SWTPM:
+		t, err = startSWTPM(tb, c.snapshot)
+	case MSSim:
+		t, err = startMSSim(tb, c.snapshot)
+	default:
+		err = fmt.Errorf("unknown backend %q", c.backend)
+	}
+	if err != nil {
+		tb.Fatalf("could not start %s TPM: %v", c.backend, err)
+	}
+	tb.Cleanup(func() {
+		if err := t.Close(); err != nil {
+			tb.Errorf("could not close %s TPM: %v", c.backend, err)
+		}
+	})
+
+	tpm := &TPM{TPM: t, Backend: c.backend, backend: t}
+	if c.srk {
+		if tpm.SRK, err = loadSRK(t, c.snapshot); err != nil {
+			tb.Fatalf("could not provision SRK: %v", err)
+		}
+	}
+	if c.leaks {
+		tpm.TPM = CheckLeaks(tb, t)
+	}
+	return tpm
+}
+
+// startup sends TPM2_Startup(CLEAR) to a freshly powered-on TPM.
+func startup(t transport.TPM) error {
+	_, err := tpm2.Startup{StartupType: tpm2.TPMSUClear}.Execute(t)
+	return err
+}
+
+// loadSRK returns the SRK at SRKHandle if snap is not nil and has one, and
+// provisions it otherwise.
+func loadSRK(t transport.TPM, snap *Snapshot) (tpm2.NamedHandle, error) {
+	if snap != nil {
+		if rsp, err := (tpm2.ReadPublic{ObjectHandle: SRKHandle}).Execute(t); err == nil {
+			return tpm2.NamedHandle{Handle: SRKHandle, Name: rsp.Name}, nil
+		}
+	}
+	return provisionSRK(t)
+}
+
+// provisionSRK creates the SRK and makes it persistent at SRKHandle.
+func provisionSRK(t transport.TPM) (tpm2.NamedHandle, error) {
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.RSASRKTemplate),
+	}.Execute(t)
+	if err != nil {
+		return tpm2.NamedHandle{}, err
+	}
+	defer tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(t)
+
+	if _, err := (tpm2.EvictControl{
+		Auth: tpm2.TPMRHOwner,
+		ObjectHandle: tpm2.NamedHandle{
+			Handle: rsp.ObjectHandle,
+			Name:   rsp.Name,
+		},
+		PersistentHandle: SRKHandle,
+	}).Execute(t); err != nil {
+		return tpm2.NamedHandle{}, err
+	}
+	return tpm2.NamedHandle{Handle: SRKHandle, Name: rsp.Name}, nil
+}
@@ -0,0 +1,203 @@
+package testutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+func TestNew(t *testing.T) {
+	for _, b := range []Backend{Embedded, SWTPM, MSSim} {
+		t.Run(string(b), func(t *testing.T) {
+			tpm := New(t, WithBackend(b), WithSRK())
+			if tpm.Backend != b {
+				t.Errorf("Backend = %q, want %q", tpm.Backend, b)
+			}
+			rsp, err := tpm2.ReadPublic{ObjectHandle: SRKHandle}.Execute(tpm)
+			if err != nil {
+				t.Fatalf("ReadPublic(SRK): %v", err)
+			}
+			if string(rsp.Name.Buffer) != string(tpm.SRK.Name.Buffer) {
+				t.Errorf("SRK name = %x, want %x", tpm.SRK.Name.Buffer, rsp.Name.Buffer)
+			}
+		})
+	}
+}
+
+// recorder is a testing.TB that records errors instead of failing.
+type recorder struct {
+	testing.TB
+	cleanups []func()
+	errors   []string
+}
+
+func (r *recorder) Cleanup(f func()) { r.cleanups = append(r.cleanups, f) }
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) runCleanups() {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+}
+
+func TestCheckLeaks(t *testing.T) {
+	tpm := New(t)
+
+	for _, leak := range []bool{false, true} {
+		r := &recorder{TB: t}
+		checked := CheckLeaks(r, tpm)
+		rsp, err := tpm2.CreatePrimary{
+			PrimaryHandle: tpm2.TPMRHOwner,
+			InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+		}.Execute(checked)
+		if err != nil {
+			t.Fatalf("CreatePrimary: %v", err)
+		}
+		_, closeSession, err := tpm2.HMACSession(checked, tpm2.TPMAlgSHA256, 16)
+		if err != nil {
+			t.Fatalf("HMACSession: %v", err)
+		}
+		if !leak {
+			closeSession()
+			tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(checked)
+		}
+		r.runCleanups()
+
+		if leak && len(r.errors) != 2 {
+			t.Errorf("CheckLeaks reported %q, want the object and session", r.errors)
+		}
+		if !leak && len(r.errors) != 0 {
+			t.Errorf("CheckLeaks reported %q, want nothing", r.errors)
+		}
+		if leak {
+			closeSession()
+			tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(tpm)
+		}
+	}
+}
+
+func TestProvisioned(t *testing.T) {
+	for _, b := range []Backend{Embedded, SWTPM, MSSim} {
+		t.Run(string(b), func(t *testing.T) {
+			const index tpm2.TPMHandle = 0x01500000
+			calls, opened := 0, 0
+			provision := func(tpm transport.TPM) error {
+				calls++
+				_, err := tpm2.NVDefineSpace{
+					AuthHandle: tpm2.TPMRHOwner,
+					PublicInfo: tpm2.New2B(tpm2.TPMSNVPublic{
+						NVIndex: index,
+						NameAlg: tpm2.TPMAlgSHA256,
+						Attributes: tpm2.TPMANV{
+							OwnerWrite: true,
+							OwnerRead:  true,
+							NT:         tpm2.TPMNTOrdinary,
+						},
+						DataSize: 4,
+					}),
+				}.Execute(tpm)
+				return err
+			}
+
+			wantCalls := 1
+			if b == Embedded {
+				wantCalls = 2
+			}
+			// The embedded simulator can only be opened once at a time, so
+			// each TPM gets a subtest that closes it.
+			for i := 0; i < 2; i++ {
+				t.Run(fmt.Sprint(i), func(t *testing.T) {
+					tpm := Provisioned(t, "nv", provision, WithBackend(b), WithSRK())
+					opened++
+					if _, err := (tpm2.NVReadPublic{NVIndex: index}).Execute(tpm); err != nil {
+						t.Errorf("NVReadPublic: %v", err)
+					}
+					if _, err := (tpm2.ReadPublic{ObjectHandle: SRKHandle}).Execute(tpm); err != nil {
+						t.Errorf("ReadPublic(SRK): %v", err)
+					}
+				})
+			}
+			// Backends that aren't installed are skipped.
+			if opened == 2 && calls != wantCalls {
+				t.Errorf("provision ran %d times, want %d", calls, wantCalls)
+			}
+
+			t.Run("snapshot", func(t *testing.T) {
+				_, err := New(t, WithBackend(b)).Snapshot()
+				if b == Embedded && !errors.Is(err, ErrSnapshotUnsupported) {
+					t.Errorf("Snapshot() = %v, want %v", err, ErrSnapshotUnsupported)
+				}
+				if b != Embedded && err != nil {
+					t.Errorf("Snapshot(): %v", err)
+				}
+			})
+		})
+	}
+}
+
+func TestFetchBinary(t *testing.T) {
+	bin := []byte("#!/bin/sh\n")
+	sum := sha256.Sum256(bin)
+	hexSum := hex.EncodeToString(sum[:])
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(bin)
+	}))
+	defer srv.Close()
+	root := t.TempDir()
+	cacheRoot = func() (string, error) { return root, nil }
+	defer func() { cacheRoot = os.UserCacheDir }()
+
+	for i := 0; i < 2; i++ {
+		p, err := fetchBinary(srv.URL+"/sim", hexSum, "sim")
+		if err != nil {
+			t.Fatalf("fetchBinary: %v", err)
+		}
+		got, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if !bytes.Equal(got, bin) {
+			t.Errorf("fetched %q, want %q", got, bin)
+		}
+		if fi, err := os.Stat(p); err != nil || fi.Mode()&0o100 == 0 {
+			t.Errorf("fetched binary is not executable: %v, %v", fi, err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("downloaded %d times, want once", fetches)
+	}
+
+	wrong := strings.Repeat("00", sha256.Size)
+	if _, err := fetchBinary(srv.URL+"/sim", wrong, "sim"); err == nil {
+		t.Errorf("fetchBinary with the wrong digest succeeded")
+	}
+	if _, err := fetchBinary(srv.URL+"/missing", wrong, "other"); err == nil {
+		t.Errorf("fetchBinary of a missing file succeeded")
+	}
+	if _, err := fetchBinary(srv.URL+"/sim", "bogus", "sim"); err == nil {
+		t.Errorf("fetchBinary with an invalid digest succeeded")
+	}
+	if entries, _ := filepath.Glob(filepath.Join(root, "go-tpm", "testutil", "*", "*.*")); len(entries) != 0 {
+		t.Errorf("failed downloads left files behind: %v", entries)
+	}
+}
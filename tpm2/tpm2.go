@@ -614,6 +614,17 @@ func (GetRandom) Command() TPMCC { return TPMCCGetRandom }
 
 // Execute executes the command and returns the response.
 func (cmd GetRandom) Execute(t transport.TPM, s ...Session) (*GetRandomResponse, error) {
+	if _, journaled := transport.Find[*Journal](t); len(s) == 0 && !journaled {
+		fast, response, err := cmd.executeFast(t)
+		if err != nil || fast != nil {
+			return fast, err
+		}
+		var rsp GetRandomResponse
+		if err := cmdFieldError[GetRandomResponse](cmd, parseResponse(t, response, TPMCCGetRandom, nil, nil, nil, &rsp)); err != nil {
+			return nil, err
+		}
+		return &rsp, nil
+	}
 	var rsp GetRandomResponse
 	if err := execute[GetRandomResponse](t, cmd, &rsp, s...); err != nil {
 		return nil, err
@@ -741,6 +752,36 @@ type SequenceCompleteResponse struct {
 	Validation TPMTTKHashCheck
 }
 
+// EventSequenceComplete is the input to TPM2_EventSequenceComplete.
+// See definition in Part 3, Commands, section 17.6
+type EventSequenceComplete struct {
+	// PCR to be extended with the Event data, or TPM_RH_NULL
+	PCRHandle handle `gotpm:"handle,auth"`
+	// authorization for the sequence
+	SequenceHandle handle `gotpm:"handle,auth,anon"`
+	// data to be added to the Event
+	Buffer TPM2BMaxBuffer
+}
+
+// Command implements the Command interface.
+func (EventSequenceComplete) Command() TPMCC { return TPMCCEventSequenceComplete }
+
+// Execute executes the command and returns the response.
+func (cmd EventSequenceComplete) Execute(t transport.TPM, s ...Session) (*EventSequenceCompleteResponse, error) {
+	var rsp EventSequenceCompleteResponse
+	if err := execute[EventSequenceCompleteResponse](t, cmd, &rsp, s...); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+// EventSequenceCompleteResponse is the response from
+// TPM2_EventSequenceComplete.
+type EventSequenceCompleteResponse struct {
+	// list of digests computed for the PCR
+	Results TPMLDigestValues
+}
+
 // Certify is the input to TPM2_Certify.
 // See definition in Part 3, Commands, section 18.2.
 type Certify struct {
@@ -880,6 +921,40 @@ type GetSessionAuditDigestResponse struct {
 	Signature TPMTSignature
 }
 
+// GetTime is the input to TPM2_GetTime.
+// See definition in Part 3, Commands, section 18.7
+type GetTime struct {
+	// handle of the privacy administrator (TPM_RH_ENDORSEMENT)
+	PrivacyAdminHandle handle `gotpm:"handle,auth"`
+	// the keyHandle identifier of a loaded key that can perform digital
+	// signatures
+	SignHandle handle `gotpm:"handle,auth"`
+	// data to tick stamp
+	QualifyingData TPM2BData
+	// signing scheme to use if the scheme for signHandle is TPM_ALG_NULL
+	InScheme TPMTSigScheme
+}
+
+// Command implements the Command interface.
+func (GetTime) Command() TPMCC { return TPMCCGetTime }
+
+// Execute executes the command and returns the response.
+func (cmd GetTime) Execute(t transport.TPM, s ...Session) (*GetTimeResponse, error) {
+	var rsp GetTimeResponse
+	if err := execute[GetTimeResponse](t, cmd, &rsp, s...); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+// GetTimeResponse is the response from TPM2_GetTime.
+type GetTimeResponse struct {
+	// standard TPM-generated attestation block
+	TimeInfo TPM2BAttest
+	// the signature over timeInfo
+	Signature TPMTSignature
+}
+
 // Commit is the input to TPM2_Commit.
 // See definition in Part 3, Commands, section 19.2.
 type Commit struct {
@@ -966,6 +1041,18 @@ func (Sign) Command() TPMCC { return TPMCCSign }
 
 // Execute executes the command and returns the response.
 func (cmd Sign) Execute(t transport.TPM, s ...Session) (*SignResponse, error) {
+	if _, journaled := transport.Find[*Journal](t); len(s) == 0 && !journaled {
+		if fast, response, ok, err := cmd.executeFast(t); ok {
+			if err != nil || fast != nil {
+				return fast, err
+			}
+			var rsp SignResponse
+			if err := cmdFieldError[SignResponse](cmd, parseResponse(t, response, TPMCCSign, nil, nil, []Session{cmd.KeyHandle.(AuthHandle).Auth}, &rsp)); err != nil {
+				return nil, err
+			}
+			return &rsp, nil
+		}
+	}
 	var rsp SignResponse
 	if err := execute[SignResponse](t, cmd, &rsp, s...); err != nil {
 		return nil, err
@@ -1027,7 +1114,10 @@ func (cmd PCREvent) Execute(t transport.TPM, s ...Session) (*PCREventResponse, e
 }
 
 // PCREventResponse is the response from TPM2_PCR_Event.
-type PCREventResponse struct{}
+type PCREventResponse struct {
+	// the digests of the event data, one for each implemented bank
+	Digests TPMLDigestValues
+}
 
 // PCRRead is the input to TPM2_PCR_Read.
 // See definition in Part 3, Commands, section 22.4
@@ -1634,6 +1724,61 @@ func (cmd HierarchyChangeAuth) Execute(t transport.TPM, s ...Session) (*Hierarch
 // HierarchyChangeAuthResponse is the response from TPM2_HierarchyChangeAuth.
 type HierarchyChangeAuthResponse struct{}
 
+// DictionaryAttackLockReset is the input to TPM2_DictionaryAttackLockReset.
+// See definition in Part 3, Commands, section 25.2
+type DictionaryAttackLockReset struct {
+	// TPM_RH_LOCKOUT
+	LockHandle handle `gotpm:"handle,auth"`
+}
+
+// Command implements the Command interface.
+func (DictionaryAttackLockReset) Command() TPMCC { return TPMCCDictionaryAttackLockReset }
+
+// Execute executes the command and returns the response.
+func (cmd DictionaryAttackLockReset) Execute(t transport.TPM, s ...Session) (*DictionaryAttackLockResetResponse, error) {
+	var rsp DictionaryAttackLockResetResponse
+	if err := execute[DictionaryAttackLockResetResponse](t, cmd, &rsp, s...); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+// DictionaryAttackLockResetResponse is the response from
+// TPM2_DictionaryAttackLockReset.
+type DictionaryAttackLockResetResponse struct{}
+
+// DictionaryAttackParameters is the input to
+// TPM2_DictionaryAttackParameters.
+// See definition in Part 3, Commands, section 25.3
+type DictionaryAttackParameters struct {
+	// TPM_RH_LOCKOUT
+	LockHandle handle `gotpm:"handle,auth"`
+	// count of authorization failures before the lockout is imposed
+	NewMaxTries uint32
+	// time in seconds before the authorization failure count is
+	// automatically decremented
+	NewRecoveryTime uint32
+	// time in seconds after a lockoutAuth failure before use of
+	// lockoutAuth is allowed
+	LockoutRecovery uint32
+}
+
+// Command implements the Command interface.
+func (DictionaryAttackParameters) Command() TPMCC { return TPMCCDictionaryAttackParameters }
+
+// Execute executes the command and returns the response.
+func (cmd DictionaryAttackParameters) Execute(t transport.TPM, s ...Session) (*DictionaryAttackParametersResponse, error) {
+	var rsp DictionaryAttackParametersResponse
+	if err := execute[DictionaryAttackParametersResponse](t, cmd, &rsp, s...); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+// DictionaryAttackParametersResponse is the response from
+// TPM2_DictionaryAttackParameters.
+type DictionaryAttackParametersResponse struct{}
+
 // ContextSave is the input to TPM2_ContextSave.
 // See definition in Part 3, Commands, section 28.2
 type ContextSave struct {
@@ -1777,6 +1922,52 @@ func (cmd Duplicate) Execute(t transport.TPM, s ...Session) (*DuplicateResponse,
 	return &rsp, nil
 }
 
+// Rewrap is the input to TPM2_Rewrap.
+// See definition in Part 3, Commands, section 13.2
+type Rewrap struct {
+	// OldParent is the parent of the object, or TPM_RH_NULL if the
+	// duplicate has no outer wrapper.
+	OldParent handle `gotpm:"handle,auth"`
+
+	// NewParent is the new parent of the object, or TPM_RH_NULL to leave
+	// the duplicate without an outer wrapper.
+	NewParent handle `gotpm:"handle"`
+
+	// InDuplicate is the object, protected by the outer wrapper for
+	// OldParent.
+	InDuplicate TPM2BPrivate
+
+	// Name is the Name of the object.
+	Name TPM2BName
+
+	// InSymSeed is the seed for the outer wrapper's symmetric and HMAC
+	// keys, encrypted to OldParent.
+	InSymSeed TPM2BEncryptedSecret
+}
+
+// RewrapResponse is the response from TPM2_Rewrap.
+type RewrapResponse struct {
+	// OutDuplicate is the object, protected by an outer wrapper for
+	// NewParent.
+	OutDuplicate TPM2BPrivate
+
+	// OutSymSeed is the seed for the new outer wrapper, encrypted to
+	// NewParent.
+	OutSymSeed TPM2BEncryptedSecret
+}
+
+// Command implements the Command interface.
+func (Rewrap) Command() TPMCC { return TPMCCRewrap }
+
+// Execute executes the command and returns the response.
+func (cmd Rewrap) Execute(t transport.TPM, s ...Session) (*RewrapResponse, error) {
+	var rsp RewrapResponse
+	if err := execute[RewrapResponse](t, cmd, &rsp, s...); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
 // Import is the input to TPM2_Import.
 // See definition in Part 3, Commands, section 13.3
 type Import struct {
@@ -1819,6 +2010,75 @@ func (cmd Import) Execute(t transport.TPM, s ...Session) (*ImportResponse, error
 	return &rsp, nil
 }
 
+// ReadClock is the input to TPM2_ReadClock.
+// See definition in Part 3, Commands, section 29.1
+type ReadClock struct{}
+
+// Command implements the Command interface.
+func (ReadClock) Command() TPMCC { return TPMCCReadClock }
+
+// Execute executes the command and returns the response.
+func (cmd ReadClock) Execute(t transport.TPM, s ...Session) (*ReadClockResponse, error) {
+	var rsp ReadClockResponse
+	if err := execute[ReadClockResponse](t, cmd, &rsp, s...); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+// ReadClockResponse is the response from TPM2_ReadClock.
+type ReadClockResponse struct {
+	CurrentTime TPMSTimeInfo
+}
+
+// ClockSet is the input to TPM2_ClockSet.
+// See definition in Part 3, Commands, section 29.2
+type ClockSet struct {
+	// TPM_RH_OWNER or TPM_RH_PLATFORM+{PP}
+	Auth handle `gotpm:"handle,auth"`
+	// new Clock setting in milliseconds
+	NewTime uint64
+}
+
+// Command implements the Command interface.
+func (ClockSet) Command() TPMCC { return TPMCCClockSet }
+
+// Execute executes the command and returns the response.
+func (cmd ClockSet) Execute(t transport.TPM, s ...Session) (*ClockSetResponse, error) {
+	var rsp ClockSetResponse
+	if err := execute[ClockSetResponse](t, cmd, &rsp, s...); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+// ClockSetResponse is the response from TPM2_ClockSet.
+type ClockSetResponse struct{}
+
+// ClockRateAdjust is the input to TPM2_ClockRateAdjust.
+// See definition in Part 3, Commands, section 29.3
+type ClockRateAdjust struct {
+	// TPM_RH_OWNER or TPM_RH_PLATFORM+{PP}
+	Auth handle `gotpm:"handle,auth"`
+	// Adjustment to current Clock update rate
+	RateAdjust TPMClockAdjust
+}
+
+// Command implements the Command interface.
+func (ClockRateAdjust) Command() TPMCC { return TPMCCClockRateAdjust }
+
+// Execute executes the command and returns the response.
+func (cmd ClockRateAdjust) Execute(t transport.TPM, s ...Session) (*ClockRateAdjustResponse, error) {
+	var rsp ClockRateAdjustResponse
+	if err := execute[ClockRateAdjustResponse](t, cmd, &rsp, s...); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+// ClockRateAdjustResponse is the response from TPM2_ClockRateAdjust.
+type ClockRateAdjustResponse struct{}
+
 // GetCapability is the input to TPM2_GetCapability.
 // See definition in Part 3, Commands, section 30.2
 type GetCapability struct {
@@ -0,0 +1,103 @@
+package tpmtls
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// ErrChannelMismatch is returned by VerifyChannelQuote when a quote is not
+// bound to the TLS connection it was received on.
+var ErrChannelMismatch = errors.New("quote is not bound to this TLS connection")
+
+// channelLabel is the TLS exporter label (RFC 5705, RFC 8446 section 7.5)
+// from which channel bindings are derived.
+const channelLabel = "EXPORTER-go-tpm-attested-channel"
+
+// ChannelBinding returns the qualifying data that binds a quote to a TLS
+// connection: the SHA-256 hash of keying material exported from the
+// connection and of the attesting peer's DER-encoded certificate, if it has
+// one. Both ends of the connection compute the same value; the attester
+// passes its own certificate and the verifier the one the attester
+// presented.
+//
+// The exported keying material is unique to the connection, so a quote
+// bound to one connection can't be relayed over another. For TLS 1.2, the
+// connection must use the extended master secret.
+func ChannelBinding(cs *tls.ConnectionState, cert []byte) ([]byte, error) {
+	ekm, err := cs.ExportKeyingMaterial(channelLabel, nil, sha256.Size)
+	if err != nil {
+		return nil, fmt.Errorf("exporting keying material: %w", err)
+	}
+	certHash := sha256.Sum256(cert)
+	h := sha256.New()
+	h.Write(ekm)
+	h.Write(certHash[:])
+	return h.Sum(nil), nil
+}
+
+// ChannelQuote is a quote bound to a TLS connection, as sent by the attester
+// to the verifier.
+type ChannelQuote struct {
+	// Quoted is the marshalled TPM2B_ATTEST.
+	Quoted []byte `json:"quoted"`
+	// Signature is the marshalled TPMT_SIGNATURE over Quoted.
+	Signature []byte `json:"signature"`
+}
+
+// QuoteChannel quotes the PCRs in sel with ak, using the channel binding of
+// the connection and cert as the qualifying data.
+func QuoteChannel(t transport.TPM, cs *tls.ConnectionState, cert []byte, ak tpm2.AuthHandle, sel tpm2.TPMLPCRSelection) (*ChannelQuote, error) {
+	binding, err := ChannelBinding(cs, cert)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := tpm2.Quote{
+		SignHandle:     ak,
+		QualifyingData: tpm2.TPM2BData{Buffer: binding},
+		InScheme:       tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+		PCRSelect:      sel,
+	}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("quoting: %w", err)
+	}
+	return &ChannelQuote{
+		Quoted:    tpm2.Marshal(rsp.Quoted),
+		Signature: tpm2.Marshal(rsp.Signature),
+	}, nil
+}
+
+// VerifyChannelQuote checks that q is a quote signed by ak and bound to the
+// connection and cert, and returns it. ak must already be trusted, for
+// example through an AK certificate; the quoted PCRs must be checked
+// separately, for example with tpm2.VerifyQuoteAllBanks.
+func VerifyChannelQuote(cs *tls.ConnectionState, cert []byte, ak *tpm2.TPMTPublic, q *ChannelQuote) (*tpm2.TPMSAttest, error) {
+	quoted, err := tpm2.Unmarshal[tpm2.TPM2BAttest](q.Quoted)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quote: %w", err)
+	}
+	sig, err := tpm2.Unmarshal[tpm2.TPMTSignature](q.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	attest, err := tpm2.VerifyAttestation(ak, quoted, sig)
+	if err != nil {
+		return nil, fmt.Errorf("verifying quote: %w", err)
+	}
+	if attest.Type != tpm2.TPMSTAttestQuote {
+		return nil, fmt.Errorf("attestation is not a quote: %v", attest.Type)
+	}
+	binding, err := ChannelBinding(cs, cert)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(attest.ExtraData.Buffer, binding) {
+		return nil, ErrChannelMismatch
+	}
+	return attest, nil
+}
@@ -0,0 +1,121 @@
+package tpmtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// connect runs a mutually authenticated TLS handshake over a pipe and
+// returns both ends' connection states.
+func connect(t *testing.T, ca *testCA, clientCert, serverCert tls.Certificate) (client, server tls.ConnectionState) {
+	t.Helper()
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	srv := tls.Server(s, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    roots,
+	})
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Handshake() }()
+	cli := tls.Client(c, &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      roots,
+		ServerName:   "localhost",
+	})
+	if err := cli.Handshake(); err != nil {
+		t.Fatalf("client handshake: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+	return cli.ConnectionState(), srv.ConnectionState()
+}
+
+func TestChannelQuote(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	ca := newTestCA(t)
+	newCert := func(serial int64) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		return tls.Certificate{Certificate: [][]byte{ca.issue(t, key.Public(), serial)}, PrivateKey: key}
+	}
+	clientCert, serverCert := newCert(2), newCert(3)
+
+	akTemplate := tpm2.ECCSRKTemplate
+	akTemplate.ObjectAttributes.Decrypt = false
+	akTemplate.ObjectAttributes.SignEncrypt = true
+	akTemplate.Parameters = tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+		Scheme: tpm2.TPMTECCScheme{
+			Scheme: tpm2.TPMAlgECDSA,
+			Details: tpm2.NewTPMUAsymScheme(tpm2.TPMAlgECDSA, &tpm2.TPMSSigSchemeECDSA{
+				HashAlg: tpm2.TPMAlgSHA256,
+			}),
+		},
+		CurveID: tpm2.TPMECCNistP256,
+	})
+	ak, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHEndorsement,
+		InPublic:      tpm2.New2B(akTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer tpm2.FlushContext{FlushHandle: ak.ObjectHandle}.Execute(thetpm)
+	akPub, err := ak.OutPublic.Contents()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	akHandle := tpm2.AuthHandle{Handle: ak.ObjectHandle, Name: ak.Name, Auth: tpm2.PasswordAuth(nil)}
+	sel := tpm2.TPMLPCRSelection{
+		PCRSelections: []tpm2.TPMSPCRSelection{{
+			Hash:      tpm2.TPMAlgSHA256,
+			PCRSelect: tpm2.PCClientCompatible.PCRs(0, 7),
+		}},
+	}
+
+	// The client attests over the connection, binding its own certificate.
+	client, server := connect(t, ca, clientCert, serverCert)
+	q, err := QuoteChannel(thetpm, &client, clientCert.Certificate[0], akHandle, sel)
+	if err != nil {
+		t.Fatalf("QuoteChannel: %v", err)
+	}
+	peer := server.PeerCertificates[0].Raw
+	if _, err := VerifyChannelQuote(&server, peer, akPub, q); err != nil {
+		t.Errorf("VerifyChannelQuote: %v", err)
+	}
+
+	// The quote doesn't verify for another connection or certificate.
+	_, other := connect(t, ca, clientCert, serverCert)
+	if _, err := VerifyChannelQuote(&other, peer, akPub, q); !errors.Is(err, ErrChannelMismatch) {
+		t.Errorf("VerifyChannelQuote() on another connection = %v, want %v", err, ErrChannelMismatch)
+	}
+	if _, err := VerifyChannelQuote(&server, serverCert.Certificate[0], akPub, q); !errors.Is(err, ErrChannelMismatch) {
+		t.Errorf("VerifyChannelQuote() with another certificate = %v, want %v", err, ErrChannelMismatch)
+	}
+
+	// A tampered quote fails signature verification.
+	q.Quoted[len(q.Quoted)-1] ^= 1
+	if _, err := VerifyChannelQuote(&server, peer, akPub, q); err == nil || errors.Is(err, ErrChannelMismatch) {
+		t.Errorf("VerifyChannelQuote() of a tampered quote = %v, want a signature error", err)
+	}
+}
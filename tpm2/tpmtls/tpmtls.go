@@ -0,0 +1,364 @@
+// Package tpmtls serves TLS certificates whose private key is held in a TPM,
+// through the GetCertificate and GetClientCertificate callbacks of
+// crypto/tls.Config.
+//
+// An Identity loads its key on the first handshake, keeps an HMAC session
+// for authorizing the key's signatures open across handshakes, and reloads
+// its certificate chain from disk or NV once the current leaf certificate has
+// expired or a configured interval has passed, so that renewed certificates
+// are picked up without a restart.
+//
+// QuoteChannel and VerifyChannelQuote bind a TPM quote to a TLS connection,
+// so that a peer can prove the state of its platform over the connection
+// itself rather than over a separate, possibly relayed, exchange.
+package tpmtls
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// KeyLoader makes a key available in the TPM and returns its handle, along
+// with a function that releases it when the Identity is closed.
+type KeyLoader func(t transport.TPM) (*tpm2.NamedHandle, func() error, error)
+
+// PersistentKey returns a KeyLoader for a key at a persistent handle.
+func PersistentKey(handle tpm2.TPMHandle) KeyLoader {
+	return func(t transport.TPM) (*tpm2.NamedHandle, func() error, error) {
+		rsp, err := tpm2.ReadPublic{ObjectHandle: handle}.Execute(t)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &tpm2.NamedHandle{Handle: handle, Name: rsp.Name}, func() error { return nil }, nil
+	}
+}
+
+// CertificateSource returns a DER-encoded certificate chain, leaf first.
+type CertificateSource func(t transport.TPM) ([][]byte, error)
+
+// CertificateFile returns a CertificateSource that reads a PEM file holding
+// the certificate chain, leaf first.
+func CertificateFile(path string) CertificateSource {
+	return func(transport.TPM) ([][]byte, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var chain [][]byte
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			if block.Type == "CERTIFICATE" {
+				chain = append(chain, block.Bytes)
+			}
+		}
+		if len(chain) == 0 {
+			return nil, fmt.Errorf("%s: no certificates", path)
+		}
+		return chain, nil
+	}
+}
+
+// CertificateNV returns a CertificateSource that reads DER-encoded
+// certificates stored back to back in an NV index, as IDevID certificates
+// are. Any padding after the last certificate is ignored. The index is read
+// with empty owner authorization if it has TPMA_NV_OWNERREAD, and with its
+// own empty authorization otherwise.
+func CertificateNV(index tpm2.TPMHandle) CertificateSource {
+	return func(t transport.TPM) ([][]byte, error) {
+		data, err := readNV(t, index)
+		if err != nil {
+			return nil, fmt.Errorf("reading NV index 0x%08x: %w", uint32(index), err)
+		}
+		var chain [][]byte
+		for {
+			n := derLen(data)
+			if n == 0 {
+				break
+			}
+			if _, err := x509.ParseCertificate(data[:n]); err != nil {
+				return nil, fmt.Errorf("NV index 0x%08x: %w", uint32(index), err)
+			}
+			chain = append(chain, data[:n])
+			data = data[n:]
+		}
+		if len(chain) == 0 {
+			return nil, fmt.Errorf("NV index 0x%08x holds no certificate", uint32(index))
+		}
+		return chain, nil
+	}
+}
+
+// derLen returns the length of the DER SEQUENCE at the start of data, or 0
+// if there is none.
+func derLen(data []byte) int {
+	if len(data) < 2 || data[0] != 0x30 {
+		return 0
+	}
+	n, hdr := int(data[1]), 2
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 3 || len(data) < 2+size {
+			return 0
+		}
+		n = 0
+		for _, b := range data[2 : 2+size] {
+			n = n<<8 | int(b)
+		}
+		hdr += size
+	}
+	if hdr+n > len(data) {
+		return 0
+	}
+	return hdr + n
+}
+
+// readNV reads the whole of an NV index, in chunks the TPM accepts.
+func readNV(t transport.TPM, index tpm2.TPMHandle) ([]byte, error) {
+	pubRsp, err := tpm2.NVReadPublic{NVIndex: index}.Execute(t)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := pubRsp.NVPublic.Contents()
+	if err != nil {
+		return nil, err
+	}
+	nv := tpm2.NamedHandle{Handle: index, Name: pubRsp.NVName}
+	auth := tpm2.AuthHandle{Handle: index, Name: pubRsp.NVName, Auth: tpm2.PasswordAuth(nil)}
+	if pub.Attributes.OwnerRead {
+		auth = tpm2.AuthHandle{Handle: tpm2.TPMRHOwner, Auth: tpm2.PasswordAuth(nil)}
+	}
+
+	chunk := uint16(512)
+	capRsp, err := tpm2.GetCapability{
+		Capability:    tpm2.TPMCapTPMProperties,
+		Property:      uint32(tpm2.TPMPTNVBufferMax),
+		PropertyCount: 1,
+	}.Execute(t)
+	if err != nil {
+		return nil, err
+	}
+	if props, err := capRsp.CapabilityData.Data.TPMProperties(); err == nil &&
+		len(props.TPMProperty) == 1 && props.TPMProperty[0].Property == tpm2.TPMPTNVBufferMax {
+		chunk = uint16(props.TPMProperty[0].Value)
+	}
+
+	var data []byte
+	for offset := uint16(0); offset < pub.DataSize; {
+		size := min(chunk, pub.DataSize-offset)
+		rsp, err := tpm2.NVRead{
+			AuthHandle: auth,
+			NVIndex:    nv,
+			Size:       size,
+			Offset:     offset,
+		}.Execute(t)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, rsp.Data.Buffer...)
+		offset += size
+	}
+	return data, nil
+}
+
+// Config configures an Identity.
+type Config struct {
+	// TPM is the TPM holding the key.
+	TPM transport.TPM
+	// Key loads the key.
+	Key KeyLoader
+	// KeyAuth is the key's authorization value.
+	KeyAuth []byte
+	// Certificate supplies the key's certificate chain.
+	Certificate CertificateSource
+	// RefreshInterval, if not zero, is how often the certificate chain is
+	// reloaded. It is always reloaded once the leaf has expired.
+	RefreshInterval time.Duration
+}
+
+// Identity is a TLS identity backed by a TPM key. It is safe for concurrent
+// use; TPM operations are serialized.
+type Identity struct {
+	config Config
+
+	mu           sync.Mutex
+	key          *tpm2.NamedHandle
+	release      func() error
+	closeSession func() error
+	signer       *tpm2.Signer
+	cert         *tls.Certificate
+	loadedAt     time.Time
+}
+
+// New returns an Identity. Nothing is sent to the TPM until the first
+// handshake.
+func New(config Config) *Identity {
+	return &Identity{config: config}
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (id *Identity) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return id.certificate()
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+func (id *Identity) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return id.certificate()
+}
+
+// certificate returns the current certificate, loading the key and
+// reloading the certificate chain as needed.
+func (id *Identity) certificate() (*tls.Certificate, error) {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+
+	if err := id.loadKey(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if id.cert != nil && now.Before(id.cert.Leaf.NotAfter) &&
+		(id.config.RefreshInterval == 0 || now.Sub(id.loadedAt) < id.config.RefreshInterval) {
+		return id.cert, nil
+	}
+	cert, err := id.loadCertificate()
+	if err != nil {
+		// Keep serving a certificate that is still valid.
+		if id.cert != nil && now.Before(id.cert.Leaf.NotAfter) {
+			return id.cert, nil
+		}
+		return nil, err
+	}
+	id.cert = cert
+	id.loadedAt = now
+	return cert, nil
+}
+
+// loadKey loads the key and starts the session that authorizes it, unless
+// that has already been done.
+func (id *Identity) loadKey() error {
+	if id.signer != nil {
+		return nil
+	}
+	if id.key == nil {
+		key, release, err := id.config.Key(id.config.TPM)
+		if err != nil {
+			return fmt.Errorf("loading TLS key: %w", err)
+		}
+		id.key = key
+		id.release = release
+	}
+	return id.startSession(id.key)
+}
+
+// startSession opens the HMAC session for the key, with the key's name
+// algorithm, and creates its signer.
+func (id *Identity) startSession(key *tpm2.NamedHandle) error {
+	hash, err := tpm2.NameHashAlg(key.Name)
+	if err != nil {
+		return fmt.Errorf("TLS key: %w", err)
+	}
+	sess, closeSession, err := tpm2.HMACSession(id.config.TPM, hash, 16, tpm2.Auth(id.config.KeyAuth))
+	if err != nil {
+		return fmt.Errorf("starting session: %w", err)
+	}
+	signer, err := tpm2.NewSigner(id.config.TPM, tpm2.AuthHandle{
+		Handle: key.Handle,
+		Name:   key.Name,
+		Auth:   sess,
+	})
+	if err != nil {
+		closeSession()
+		return err
+	}
+	id.closeSession = closeSession
+	id.signer = signer
+	return nil
+}
+
+// loadCertificate reads the certificate chain and checks that it is for the
+// key.
+func (id *Identity) loadCertificate() (*tls.Certificate, error) {
+	chain, err := id.config.Certificate(id.config.TPM)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(id.signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(leaf.RawSubjectPublicKeyInfo, pub) {
+		return nil, errors.New("TLS certificate is not for the TPM key")
+	}
+	return &tls.Certificate{
+		Certificate: chain,
+		PrivateKey:  &lockedSigner{id: id, public: id.signer.Public()},
+		Leaf:        leaf,
+	}, nil
+}
+
+// Close ends the session and releases the key.
+func (id *Identity) Close() error {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+	var errs []error
+	if id.closeSession != nil {
+		errs = append(errs, id.closeSession())
+		id.closeSession = nil
+	}
+	if id.release != nil {
+		errs = append(errs, id.release())
+		id.release = nil
+	}
+	id.key = nil
+	id.signer = nil
+	id.cert = nil
+	return errors.Join(errs...)
+}
+
+// lockedSigner signs with the Identity's signer, holding its lock.
+type lockedSigner struct {
+	id     *Identity
+	public crypto.PublicKey
+}
+
+// Public implements crypto.Signer.
+func (s *lockedSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign implements crypto.Signer.
+func (s *lockedSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.id.mu.Lock()
+	defer s.id.mu.Unlock()
+	if s.id.signer == nil {
+		return nil, errors.New("TLS identity is closed")
+	}
+	sig, err := s.id.signer.Sign(rand, digest, opts)
+	if err != nil {
+		// The session may have been lost, for example if the TPM was
+		// reset. Start a new one on the next handshake.
+		s.id.closeSession()
+		s.id.closeSession = nil
+		s.id.signer = nil
+	}
+	return sig, err
+}
@@ -0,0 +1,264 @@
+package tpmtls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// signingKey returns a KeyLoader that creates an unrestricted ECC signing
+// key with the given auth value, and counts how often it is called.
+func signingKey(auth []byte, loads *int) KeyLoader {
+	tmpl := tpm2.ECCSRKTemplate
+	tmpl.ObjectAttributes.Restricted = false
+	tmpl.ObjectAttributes.Decrypt = false
+	tmpl.ObjectAttributes.SignEncrypt = true
+	tmpl.Parameters = tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+		CurveID: tpm2.TPMECCNistP256,
+	})
+	return func(t transport.TPM) (*tpm2.NamedHandle, func() error, error) {
+		*loads++
+		rsp, err := tpm2.CreatePrimary{
+			PrimaryHandle: tpm2.TPMRHOwner,
+			InSensitive: tpm2.TPM2BSensitiveCreate{
+				Sensitive: &tpm2.TPMSSensitiveCreate{
+					UserAuth: tpm2.TPM2BAuth{Buffer: auth},
+				},
+			},
+			InPublic: tpm2.New2B(tmpl),
+		}.Execute(t)
+		if err != nil {
+			return nil, nil, err
+		}
+		release := func() error {
+			_, err := tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(t)
+			return err
+		}
+		return &tpm2.NamedHandle{Handle: rsp.ObjectHandle, Name: rsp.Name}, release, nil
+	}
+}
+
+// testCA issues certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, pub crypto.PublicKey, serial int64) []byte {
+	t.Helper()
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}, ca.cert, pub, ca.key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return der
+}
+
+// handshake runs a TLS handshake between client and server over a pipe and
+// returns the certificate the client saw and the one the server saw.
+func handshake(t *testing.T, client, server *tls.Config) (serverCert, clientCert *x509.Certificate) {
+	t.Helper()
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	errc := make(chan error, 1)
+	srv := tls.Server(s, server)
+	go func() { errc <- srv.Handshake() }()
+	cli := tls.Client(c, client)
+	if err := cli.Handshake(); err != nil {
+		t.Fatalf("client handshake: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+	serverCert = cli.ConnectionState().PeerCertificates[0]
+	if certs := srv.ConnectionState().PeerCertificates; len(certs) != 0 {
+		clientCert = certs[0]
+	}
+	return serverCert, clientCert
+}
+
+func writePEM(t *testing.T, path string, ders ...[]byte) {
+	t.Helper()
+	var data []byte
+	for _, der := range ders {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	ca := newTestCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	certPath := filepath.Join(t.TempDir(), "cert.pem")
+
+	var loads int
+	id := New(Config{
+		TPM:             thetpm,
+		Key:             signingKey([]byte("key auth"), &loads),
+		KeyAuth:         []byte("key auth"),
+		Certificate:     CertificateFile(certPath),
+		RefreshInterval: time.Nanosecond,
+	})
+	defer id.Close()
+
+	// The key is needed to issue its certificate; loading it doesn't
+	// need the certificate.
+	if _, err := id.GetCertificate(nil); err == nil {
+		t.Fatal("GetCertificate succeeded without a certificate")
+	}
+	writePEM(t, certPath, ca.issue(t, id.signer.Public(), 2), ca.cert.Raw)
+
+	peerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	peerDER := ca.issue(t, peerKey.Public(), 100)
+	peer := tls.Certificate{Certificate: [][]byte{peerDER}, PrivateKey: peerKey}
+
+	// Server side, for both TLS 1.2 and 1.3.
+	for _, version := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		got, _ := handshake(t,
+			&tls.Config{RootCAs: roots, ServerName: "localhost", MinVersion: version, MaxVersion: version},
+			&tls.Config{GetCertificate: id.GetCertificate})
+		if got.SerialNumber.Int64() != 2 {
+			t.Errorf("server certificate serial = %v, want 2", got.SerialNumber)
+		}
+	}
+
+	// A renewed certificate is picked up on the next handshake.
+	writePEM(t, certPath, ca.issue(t, id.signer.Public(), 3))
+	_, got := handshake(t,
+		&tls.Config{RootCAs: roots, ServerName: "localhost", GetClientCertificate: id.GetClientCertificate},
+		&tls.Config{Certificates: []tls.Certificate{peer}, ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: roots})
+	if got == nil || got.SerialNumber.Int64() != 3 {
+		t.Errorf("client certificate = %v, want serial 3", got)
+	}
+
+	// A certificate for another key is rejected, and the current one kept.
+	writePEM(t, certPath, peerDER)
+	cert, err := id.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	if cert.Leaf.SerialNumber.Int64() != 3 {
+		t.Errorf("GetCertificate() serial = %v, want 3", cert.Leaf.SerialNumber)
+	}
+	if loads != 1 {
+		t.Errorf("key was loaded %d times, want 1", loads)
+	}
+}
+
+func TestCertificateNV(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	ca := newTestCA(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	leaf := ca.issue(t, key.Public(), 2)
+	data := append(append(append([]byte(nil), leaf...), ca.cert.Raw...), make([]byte, 64)...)
+
+	pub := tpm2.TPMSNVPublic{
+		NVIndex: tpm2.TPMHandle(0x01c90000),
+		NameAlg: tpm2.TPMAlgSHA256,
+		Attributes: tpm2.TPMANV{
+			OwnerWrite: true,
+			OwnerRead:  true,
+			AuthRead:   true,
+			NT:         tpm2.TPMNTOrdinary,
+			NoDA:       true,
+		},
+		DataSize: uint16(len(data)),
+	}
+	if _, err := (tpm2.NVDefineSpace{
+		AuthHandle: tpm2.TPMRHOwner,
+		PublicInfo: tpm2.New2B(pub),
+	}).Execute(thetpm); err != nil {
+		t.Fatalf("NVDefineSpace: %v", err)
+	}
+	name, err := tpm2.NVName(&pub)
+	if err != nil {
+		t.Fatalf("NVName: %v", err)
+	}
+	for offset := 0; offset < len(data); offset += 256 {
+		if _, err := (tpm2.NVWrite{
+			AuthHandle: tpm2.TPMRHOwner,
+			NVIndex:    tpm2.NamedHandle{Handle: tpm2.TPMHandle(pub.NVIndex), Name: *name},
+			Data:       tpm2.TPM2BMaxNVBuffer{Buffer: data[offset:min(offset+256, len(data))]},
+			Offset:     uint16(offset),
+		}).Execute(thetpm); err != nil {
+			t.Fatalf("NVWrite: %v", err)
+		}
+	}
+
+	chain, err := CertificateNV(tpm2.TPMHandle(pub.NVIndex))(thetpm)
+	if err != nil {
+		t.Fatalf("CertificateNV: %v", err)
+	}
+	if len(chain) != 2 || string(chain[0]) != string(leaf) || string(chain[1]) != string(ca.cert.Raw) {
+		t.Errorf("CertificateNV returned %d certificates, want the leaf and the CA", len(chain))
+	}
+}
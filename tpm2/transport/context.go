@@ -0,0 +1,57 @@
+package transport
+
+import "context"
+
+// ContextSender is implemented by transports that can give up on a command
+// when a context is done, such as remote.TPM and tpm2.ProgressReporter. A
+// TPM can't be interrupted, so an abandoned command may still run to
+// completion; the transport must make the next command wait for it.
+type ContextSender interface {
+	// SendContext sends cmd and returns the response, giving up when ctx
+	// is done.
+	SendContext(ctx context.Context, cmd []byte) ([]byte, error)
+}
+
+// contextTPM sends commands with a context.
+type contextTPM struct {
+	tpm TPM
+	ctx context.Context
+}
+
+// WithContext returns a TPM that sends commands to t with ctx. If t is a
+// ContextSender, commands are abandoned when ctx is done; otherwise, no
+// command is sent once ctx is done, but one that has been sent runs to
+// completion. Wrap slow transports in a tpm2.ProgressReporter to be able to
+// abandon their commands.
+//
+// APIs that take an io.ReadWriter, such as the legacy TPM 2.0 API, can be
+// given ToReadWriter(WithContext(ctx, t)).
+func WithContext(ctx context.Context, t TPM) TPM {
+	return &contextTPM{tpm: t, ctx: ctx}
+}
+
+// Send implements the TPM interface.
+func (c *contextTPM) Send(cmd []byte) ([]byte, error) {
+	if cs, ok := c.tpm.(ContextSender); ok {
+		return cs.SendContext(c.ctx, cmd)
+	}
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.tpm.Send(cmd)
+}
+
+// Unwrap implements the Wrapper interface.
+func (c *contextTPM) Unwrap() TPM {
+	return c.tpm
+}
+
+// SendContext implements the ContextSender interface, with the earlier of
+// ctx and the TPM's context.
+func (c *contextTPM) SendContext(ctx context.Context, cmd []byte) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(c.ctx, cancel)
+	defer stop()
+	return WithContext(ctx, c.tpm).Send(cmd)
+}
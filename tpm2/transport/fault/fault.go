@@ -0,0 +1,192 @@
+// Package fault injects faults into the exchanges between a program and its
+// TPM, so that tests can exercise error handling that a working TPM or
+// simulator never triggers: lost and corrupted responses, transport errors
+// and response codes such as TPM_RC_RETRY or TPM_RC_NV_RATE.
+//
+// A Schedule decides which commands are faulted, and how:
+//
+//	s := fault.NewSchedule(
+//		// The second TPM2_Sign fails with TPM_RC_RETRY.
+//		fault.Rule{Command: tpm2.TPMCCSign, After: 1, Count: 1, Fault: fault.RC(tpm2.TPMRCRetry)},
+//		// Every tenth command's response is lost after the TPM ran it.
+//		fault.Rule{Every: 10, Fault: fault.Drop()},
+//	)
+//	tpm := fault.Inject(sim, s)
+//
+// A fault is a transport.Interceptor, so tests can also write their own.
+package fault
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/internal/tpmcmd"
+)
+
+// ErrDropped is returned by Send when Drop discards a response.
+var ErrDropped = errors.New("fault: response dropped")
+
+// Fail returns a fault that fails the command with err without sending it,
+// like a transport that cannot reach the TPM.
+func Fail(err error) transport.Interceptor {
+	return func([]byte, transport.SendFunc) ([]byte, error) {
+		return nil, err
+	}
+}
+
+// Drop returns a fault that sends the command but discards the response and
+// returns ErrDropped. The TPM has run the command, so any state it changed
+// stays changed.
+func Drop() transport.Interceptor {
+	return func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+		if _, err := next(cmd); err != nil {
+			return nil, err
+		}
+		return nil, ErrDropped
+	}
+}
+
+// Truncate returns a fault that cuts the response down to its first n bytes.
+// The size in the response header is left as it was.
+func Truncate(n int) transport.Interceptor {
+	return func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+		rsp, err := next(cmd)
+		if err != nil || n >= len(rsp) {
+			return rsp, err
+		}
+		return rsp[:max(n, 0)], nil
+	}
+}
+
+// FlipBit returns a fault that inverts one bit of the response: the bit with
+// value 0x80>>(bit%8) in byte bit/8. Responses too short to hold the bit are
+// left alone.
+func FlipBit(bit int) transport.Interceptor {
+	return func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+		rsp, err := next(cmd)
+		if err != nil || bit < 0 || bit/8 >= len(rsp) {
+			return rsp, err
+		}
+		rsp = bytes.Clone(rsp)
+		rsp[bit/8] ^= 0x80 >> (bit % 8)
+		return rsp, nil
+	}
+}
+
+// RC returns a fault that answers the command with the response code rc
+// without sending it, as the TPM does for commands it refuses.
+func RC(rc tpm2.TPMRC) transport.Interceptor {
+	return func([]byte, transport.SendFunc) ([]byte, error) {
+		return tpmcmd.ErrorResponse(rc), nil
+	}
+}
+
+// Rule applies a fault to some of the commands that match it.
+type Rule struct {
+	// Command restricts the rule to commands with this command code. The
+	// zero value matches every command.
+	Command tpm2.TPMCC
+	// After is the number of matching commands that go through unharmed
+	// before the rule starts applying Fault.
+	After int
+	// Every applies Fault to one in every Every matching commands after the
+	// first After, starting with the first. Zero and one mean every command.
+	Every int
+	// Count is the number of times Fault is applied, after which the rule
+	// has no more effect. Zero means no limit.
+	Count int
+	// Fault is applied to the commands the rule selects, in place of
+	// sending them to the TPM directly.
+	Fault transport.Interceptor
+}
+
+// rule is a Rule and how far through its schedule it is.
+type rule struct {
+	Rule
+	// seen is the number of matching commands, and applied the number
+	// that Fault was applied to.
+	seen, applied int
+}
+
+// selects counts cmd if it matches r, and reports whether r would apply its
+// fault to it.
+func (r *rule) selects(cmd []byte) bool {
+	if r.Command != 0 && (len(cmd) < 10 || tpmcmd.CommandCode(cmd) != r.Command) {
+		return false
+	}
+	n := r.seen - r.After
+	r.seen++
+	if n < 0 || r.Count > 0 && r.applied >= r.Count {
+		return false
+	}
+	return r.Every <= 1 || n%r.Every == 0
+}
+
+// Schedule decides which commands are faulted. Every rule counts the
+// commands that match it; if several rules select a command, only the first
+// added applies its fault. A Schedule is safe for concurrent use.
+type Schedule struct {
+	mu    sync.Mutex
+	rules []*rule
+}
+
+// NewSchedule returns a Schedule with the given rules.
+func NewSchedule(rules ...Rule) *Schedule {
+	s := &Schedule{}
+	for _, r := range rules {
+		s.Add(r)
+	}
+	return s
+}
+
+// Add adds a rule to the schedule. It counts commands from then on.
+func (s *Schedule) Add(r Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, &rule{Rule: r})
+}
+
+// Reset removes every rule from the schedule.
+func (s *Schedule) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = nil
+}
+
+// Applied returns the number of faults the schedule has applied.
+func (s *Schedule) Applied() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, r := range s.rules {
+		n += r.applied
+	}
+	return n
+}
+
+// Intercept is a transport.Interceptor that applies the schedule's faults,
+// for use with transport.Chain.
+func (s *Schedule) Intercept(cmd []byte, next transport.SendFunc) ([]byte, error) {
+	s.mu.Lock()
+	var fault transport.Interceptor
+	for _, r := range s.rules {
+		if r.selects(cmd) && fault == nil {
+			fault = r.Fault
+			r.applied++
+		}
+	}
+	s.mu.Unlock()
+	if fault == nil {
+		return next(cmd)
+	}
+	return fault(cmd, next)
+}
+
+// Inject returns a TPM that sends commands to t, applying the faults s
+// schedules. Closing it closes t.
+func Inject(t transport.TPM, s *Schedule) transport.TPMCloser {
+	return transport.Chain(t, s.Intercept)
+}
@@ -0,0 +1,98 @@
+package fault
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func openSimulator(t *testing.T) transport.TPM {
+	t.Helper()
+	sim, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	t.Cleanup(func() { sim.Close() })
+	return sim
+}
+
+func getRandom(tpm transport.TPM) error {
+	_, err := tpm2.GetRandom{BytesRequested: 8}.Execute(tpm)
+	return err
+}
+
+func TestFaults(t *testing.T) {
+	sim := openSimulator(t)
+	errUnreachable := errors.New("unreachable")
+	for _, tc := range []struct {
+		name  string
+		fault transport.Interceptor
+		want  error
+	}{
+		{"Fail", Fail(errUnreachable), errUnreachable},
+		{"Drop", Drop(), ErrDropped},
+		{"RC", RC(tpm2.TPMRCRetry), tpm2.TPMRCRetry},
+	} {
+		tpm := Inject(sim, NewSchedule(Rule{Fault: tc.fault}))
+		if err := getRandom(tpm); !errors.Is(err, tc.want) {
+			t.Errorf("%s: GetRandom = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	// Corrupted responses fail to parse, or fail with the wrong response
+	// code; either way GetRandom must not succeed.
+	for name, fault := range map[string]transport.Interceptor{
+		"Truncate":    Truncate(12),
+		"FlipRC":      FlipBit(79),
+		"TruncateAll": Truncate(0),
+	} {
+		tpm := Inject(sim, NewSchedule(Rule{Fault: fault}))
+		if err := getRandom(tpm); err == nil {
+			t.Errorf("%s: GetRandom succeeded", name)
+		}
+	}
+	if err := getRandom(Inject(sim, NewSchedule(Rule{Fault: FlipBit(1 << 20)}))); err != nil {
+		t.Errorf("GetRandom with a bit flipped past the end of the response: %v", err)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	sim := openSimulator(t)
+	s := NewSchedule(
+		Rule{Command: tpm2.TPMCCGetRandom, After: 1, Every: 2, Count: 2, Fault: RC(tpm2.TPMRCRetry)},
+		Rule{Command: tpm2.TPMCCGetCapability, Fault: Drop()},
+	)
+	tpm := Inject(sim, s)
+
+	// Other commands don't count towards a rule.
+	if _, err := (tpm2.GetCapability{Capability: tpm2.TPMCapTPMProperties, Property: uint32(tpm2.TPMPTManufacturer), PropertyCount: 1}).Execute(tpm); !errors.Is(err, ErrDropped) {
+		t.Errorf("GetCapability = %v, want %v", err, ErrDropped)
+	}
+	var got []bool
+	for i := 0; i < 7; i++ {
+		got = append(got, getRandom(tpm) != nil)
+	}
+	want := []bool{false, true, false, true, false, false, false}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("GetRandom #%d failed: %v, want %v", i, got[i], want[i])
+		}
+	}
+	if n := s.Applied(); n != 3 {
+		t.Errorf("Applied() = %d, want 3", n)
+	}
+
+	// When two rules select a command, the first one wins.
+	s.Reset()
+	s.Add(Rule{Fault: RC(tpm2.TPMRCRetry)})
+	s.Add(Rule{Fault: Drop()})
+	if err := getRandom(tpm); !errors.Is(err, tpm2.TPMRCRetry) {
+		t.Errorf("GetRandom = %v, want %v", err, tpm2.TPMRCRetry)
+	}
+	if n := s.Applied(); n != 1 {
+		t.Errorf("Applied() = %d, want 1", n)
+	}
+}
@@ -0,0 +1,76 @@
+//go:build linux
+
+package i2ctpm
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/internal/tis"
+)
+
+// i2cSlave is the I2C_SLAVE ioctl.
+const i2cSlave = 0x0703
+
+// i2cdev is a Conn on an i2c-dev device file.
+type i2cdev struct {
+	f *os.File
+}
+
+// Read implements Conn.
+func (d *i2cdev) Read(buf []byte) error {
+	n, err := d.f.Read(buf)
+	if err == nil && n != len(buf) {
+		err = fmt.Errorf("short I2C read of %d bytes, want %d", n, len(buf))
+	}
+	return err
+}
+
+// Write implements Conn.
+func (d *i2cdev) Write(data []byte) error {
+	n, err := d.f.Write(data)
+	if err == nil && n != len(data) {
+		err = fmt.Errorf("short I2C write of %d bytes, want %d", n, len(data))
+	}
+	return err
+}
+
+// tpm is a transport.TPMCloser for a TPM on I2C.
+type tpm struct {
+	*tis.TPM
+	f *os.File
+}
+
+// Close relinquishes the locality and closes the device.
+func (t *tpm) Close() error {
+	err := t.TPM.Close()
+	if cerr := t.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Open opens the TPM at the given address (usually DefaultAddress) on the
+// i2c-dev device at path (such as /dev/i2c-1), using the given locality.
+func Open(path string, addr uint16, locality int) (transport.TPMCloser, error) {
+	if locality < 0 || locality > 4 {
+		return nil, fmt.Errorf("invalid locality %d", locality)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.IoctlSetInt(int(f.Fd()), i2cSlave, int(addr)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("setting I2C address 0x%x: %w", addr, err)
+	}
+	t, err := open(&bus{conn: &i2cdev{f: f}}, locality)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &tpm{TPM: t, f: f}, nil
+}
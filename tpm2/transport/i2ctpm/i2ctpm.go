@@ -0,0 +1,129 @@
+// Package i2ctpm provides access to a discrete TPM on an I2C bus, using the
+// TCG PC Client Platform TPM Profile (PTP) I2C protocol. It is useful where
+// the kernel has no tpm_tis_i2c driver, or where raw access to the TPM is
+// needed. On Linux, Open uses the i2c-dev driver. Elsewhere, such as on
+// single-board computers driven without an operating system, New drives the
+// TPM through any I2C controller that implements Conn.
+package i2ctpm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/internal/tis"
+)
+
+const (
+	// DefaultAddress is the usual I2C address of a TPM.
+	DefaultAddress = 0x2E
+
+	// Register addresses.
+	regLocSel   = 0x00
+	regAccess   = 0x04
+	regSts      = 0x18
+	regDataFIFO = 0x24
+
+	// retries is how many times a transaction is retried, since TPMs may
+	// NACK their address while busy.
+	retries = 3
+)
+
+// guardTime is the minimum time between transactions. The PTP allows TPMs to
+// require up to 250µs.
+var guardTime = 250 * time.Microsecond
+
+// Conn is an I2C controller addressing the TPM. The TPM supports standard
+// and fast mode, and usually fast mode plus, up to 1 MHz.
+type Conn interface {
+	// Read reads len(buf) bytes from the TPM in a single transfer.
+	Read(buf []byte) error
+	// Write writes data to the TPM in a single transfer.
+	Write(data []byte) error
+}
+
+// bus implements the PTP I2C protocol on a Conn.
+type bus struct {
+	conn Conn
+	last time.Time
+}
+
+// wait waits for the guard time since the last transaction.
+func (b *bus) wait() {
+	if d := guardTime - time.Since(b.last); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// retry runs the transaction f, retrying it if the TPM doesn't respond.
+func (b *bus) retry(f func() error) error {
+	var err error
+	for i := 0; i < retries; i++ {
+		b.wait()
+		err = f()
+		b.last = time.Now()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func register(reg tis.Register) (byte, error) {
+	switch reg {
+	case tis.Access:
+		return regAccess, nil
+	case tis.Sts:
+		return regSts, nil
+	case tis.DataFIFO:
+		return regDataFIFO, nil
+	}
+	return 0, fmt.Errorf("unknown register %d", reg)
+}
+
+// Read implements tis.Bus.
+func (b *bus) Read(reg tis.Register, buf []byte) error {
+	addr, err := register(reg)
+	if err != nil {
+		return err
+	}
+	if err := b.retry(func() error { return b.conn.Write([]byte{addr}) }); err != nil {
+		return err
+	}
+	return b.retry(func() error { return b.conn.Read(buf) })
+}
+
+// Write implements tis.Bus.
+func (b *bus) Write(reg tis.Register, data []byte) error {
+	addr, err := register(reg)
+	if err != nil {
+		return err
+	}
+	return b.retry(func() error { return b.conn.Write(append([]byte{addr}, data...)) })
+}
+
+// selectLocality selects the locality used by subsequent accesses.
+func (b *bus) selectLocality(locality int) error {
+	return b.retry(func() error { return b.conn.Write([]byte{regLocSel, byte(locality)}) })
+}
+
+// SetLocality implements tis.LocalityBus.
+func (b *bus) SetLocality(locality int) error {
+	return b.selectLocality(locality)
+}
+
+// New opens the TPM on c, using the given locality. Closing the returned
+// TPM relinquishes the locality but leaves c alone.
+func New(c Conn, locality int) (transport.TPMCloser, error) {
+	if locality < 0 || locality > 4 {
+		return nil, fmt.Errorf("invalid locality %d", locality)
+	}
+	return open(&bus{conn: c}, locality)
+}
+
+func open(b *bus, locality int) (*tis.TPM, error) {
+	if err := b.selectLocality(locality); err != nil {
+		return nil, fmt.Errorf("selecting locality %d: %w", locality, err)
+	}
+	return tis.Open(b)
+}
@@ -0,0 +1,114 @@
+package i2ctpm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/internal/tis"
+	"github.com/google/go-tpm/tpm2/transport/internal/tis/tistest"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+	testhelper "github.com/google/go-tpm/tpm2/transport/test"
+)
+
+// errNACK is returned by fakeI2C to emulate a busy TPM.
+var errNACK = errors.New("NACK")
+
+// fakeI2C decodes PTP I2C transfers and applies them to a fake device. It
+// NACKs every third transfer, to exercise retries.
+type fakeI2C struct {
+	dev      *tistest.Device
+	locality int
+	reg      byte
+	count    int
+}
+
+func (f *fakeI2C) nack() bool {
+	f.count++
+	return f.count%3 == 0
+}
+
+func tisRegister(reg byte) (tis.Register, error) {
+	switch reg {
+	case regAccess:
+		return tis.Access, nil
+	case regSts:
+		return tis.Sts, nil
+	case regDataFIFO:
+		return tis.DataFIFO, nil
+	}
+	return 0, fmt.Errorf("unexpected register 0x%x", reg)
+}
+
+func (f *fakeI2C) Read(buf []byte) error {
+	if f.nack() {
+		return errNACK
+	}
+	reg, err := tisRegister(f.reg)
+	if err != nil {
+		return err
+	}
+	return f.dev.Read(reg, buf)
+}
+
+func (f *fakeI2C) Write(data []byte) error {
+	if f.nack() {
+		return errNACK
+	}
+	f.reg = data[0]
+	if len(data) == 1 {
+		return nil
+	}
+	if f.reg == regLocSel {
+		f.locality = int(data[1])
+		return nil
+	}
+	reg, err := tisRegister(f.reg)
+	if err != nil {
+		return err
+	}
+	return f.dev.Write(reg, data[1:])
+}
+
+func TestI2C(t *testing.T) {
+	guardTime = 0
+	fake := &fakeI2C{}
+	testhelper.RunTest(t, nil, func() (transport.TPMCloser, error) {
+		sim, err := simulator.OpenSimulator()
+		if err != nil {
+			t.Fatalf("could not connect to TPM simulator: %v", err)
+		}
+		t.Cleanup(func() { sim.Close() })
+		fake.dev = tistest.New(sim)
+		return New(fake, 1)
+	})
+	if fake.locality != 1 {
+		t.Errorf("locality = %d, want 1", fake.locality)
+	}
+}
+
+func TestSetLocality(t *testing.T) {
+	guardTime = 0
+	sim, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer sim.Close()
+	fake := &fakeI2C{dev: tistest.New(sim)}
+	tpm, err := New(fake, 0)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer tpm.Close()
+	if err := transport.SetLocality(tpm, 2); err != nil {
+		t.Fatalf("SetLocality: %v", err)
+	}
+	if fake.locality != 2 {
+		t.Errorf("locality = %d, want 2", fake.locality)
+	}
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(tpm); err != nil {
+		t.Errorf("GetRandom at locality 2: %v", err)
+	}
+}
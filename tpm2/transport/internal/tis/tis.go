@@ -0,0 +1,307 @@
+// Package tis implements the TCG PC Client Platform TPM Profile (PTP) FIFO
+// (TIS) protocol on top of any bus that can read and write the FIFO
+// registers, such as memory-mapped I/O, SPI or I2C.
+package tis
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// Register identifies one of the FIFO interface registers. A Bus maps it to
+// the register's address for its locality.
+type Register int
+
+// The registers used by the FIFO protocol.
+const (
+	Access Register = iota
+	Sts
+	DataFIFO
+)
+
+// TPM_ACCESS bits.
+const (
+	accessValid          = 0x80
+	accessActiveLocality = 0x20
+	accessRequestUse     = 0x02
+)
+
+// TPM_STS bits.
+const (
+	stsValid        = 0x80
+	stsCommandReady = 0x40
+	stsGo           = 0x20
+	stsDataAvail    = 0x10
+	stsExpect       = 0x08
+	stsBurstShift   = 8
+	stsBurstMask    = 0xFFFF
+)
+
+const headerSize = 10
+
+// Timeouts from the PTP. The command timeout is generous, since some
+// commands (such as RSA key generation) are slow on real hardware.
+var (
+	timeoutA       = 750 * time.Millisecond
+	timeoutB       = 2 * time.Second
+	timeoutC       = 200 * time.Millisecond
+	timeoutD       = 30 * time.Millisecond
+	timeoutCommand = 5 * time.Minute
+)
+
+var (
+	// ErrTimeout indicates that the TPM did not reach the expected state in
+	// time.
+	ErrTimeout = errors.New("timed out waiting for the TPM")
+	// ErrResponseTooLarge indicates that the TPM reported a response larger
+	// than the maximum response size.
+	ErrResponseTooLarge = errors.New("TPM response too large")
+)
+
+// Bus gives access to the FIFO registers of one locality.
+type Bus interface {
+	// Read fills buf from the register. For DataFIFO, this reads
+	// len(buf) bytes from the FIFO.
+	Read(reg Register, buf []byte) error
+	// Write writes data to the register. For DataFIFO, this writes
+	// len(data) bytes to the FIFO.
+	Write(reg Register, data []byte) error
+}
+
+// LocalityBus is a Bus that can move to the registers of another locality.
+type LocalityBus interface {
+	Bus
+	// SetLocality makes subsequent accesses use the registers of the
+	// given locality.
+	SetLocality(locality int) error
+}
+
+// maxLocality is the highest locality defined by the PTP.
+const maxLocality = 4
+
+// TPM talks to a TPM over the FIFO interface.
+type TPM struct {
+	bus            Bus
+	commandTimeout time.Duration
+	// maxResponse bounds the response size the TPM may report, so that a
+	// corrupt header can't make Send allocate gigabytes.
+	maxResponse int
+}
+
+// Open requests use of the bus's locality and returns a TPM that uses it.
+func Open(bus Bus) (*TPM, error) {
+	t := &TPM{
+		bus:            bus,
+		commandTimeout: timeoutCommand,
+		maxResponse:    tpmutil.DefaultMaxResponseSize,
+	}
+	if err := t.requestUse(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// requestUse requests use of the bus's locality and waits until it is
+// active.
+func (t *TPM) requestUse() error {
+	if err := t.bus.Write(Access, []byte{accessRequestUse}); err != nil {
+		return err
+	}
+	if err := Poll(timeoutA, func() (bool, error) {
+		a, err := t.access()
+		return a&(accessValid|accessActiveLocality) == accessValid|accessActiveLocality, err
+	}); err != nil {
+		return fmt.Errorf("requesting locality: %w", err)
+	}
+	return nil
+}
+
+// SetLocality implements transport.LocalitySetter, for buses that are
+// LocalityBuses. It relinquishes the current locality and requests the new
+// one; if that fails, the TPM has no locality until SetLocality succeeds.
+func (t *TPM) SetLocality(locality uint8) error {
+	lb, ok := t.bus.(LocalityBus)
+	if !ok {
+		return transport.ErrLocalityUnsupported
+	}
+	if locality > maxLocality {
+		return fmt.Errorf("invalid locality %d", locality)
+	}
+	if err := t.Close(); err != nil {
+		return err
+	}
+	if err := lb.SetLocality(int(locality)); err != nil {
+		return err
+	}
+	return t.requestUse()
+}
+
+// Limits on the wait between two reads of a register by Poll.
+const (
+	minPollInterval = 100 * time.Microsecond
+	maxPollInterval = 5 * time.Millisecond
+)
+
+// Poll calls cond until it returns true or an error, or the timeout
+// expires. It waits between calls, at first for 100µs and then for twice as
+// long each time, up to 5ms, so that a slow command neither keeps a CPU busy
+// nor floods the bus with register reads.
+func Poll(timeout time.Duration, cond func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	interval := minPollInterval
+	for {
+		ok, err := cond()
+		if err != nil || ok {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return ErrTimeout
+		}
+		time.Sleep(interval)
+		interval = min(2*interval, maxPollInterval)
+	}
+}
+
+func (t *TPM) access() (byte, error) {
+	var a [1]byte
+	err := t.bus.Read(Access, a[:])
+	return a[0], err
+}
+
+func (t *TPM) sts() (uint32, error) {
+	var s [4]byte
+	err := t.bus.Read(Sts, s[:])
+	return binary.LittleEndian.Uint32(s[:]), err
+}
+
+func (t *TPM) setSts(v uint32) error {
+	var s [4]byte
+	binary.LittleEndian.PutUint32(s[:], v)
+	return t.bus.Write(Sts, s[:])
+}
+
+// waitSts waits until all of the given status bits are set.
+func (t *TPM) waitSts(timeout time.Duration, bits uint32) error {
+	return Poll(timeout, func() (bool, error) {
+		s, err := t.sts()
+		return s&bits == bits, err
+	})
+}
+
+// burstCount waits for, and returns, the number of bytes that can be moved
+// through the FIFO without waiting.
+func (t *TPM) burstCount() (int, error) {
+	var burst int
+	err := Poll(timeoutD, func() (bool, error) {
+		s, err := t.sts()
+		burst = int(s>>stsBurstShift) & stsBurstMask
+		return burst > 0, err
+	})
+	return burst, err
+}
+
+// writeFIFO writes data to the FIFO, respecting the burst count.
+func (t *TPM) writeFIFO(data []byte) error {
+	for len(data) > 0 {
+		burst, err := t.burstCount()
+		if err != nil {
+			return err
+		}
+		n := min(burst, len(data))
+		if err := t.bus.Write(DataFIFO, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// readFIFO fills buf from the FIFO, respecting the burst count.
+func (t *TPM) readFIFO(buf []byte) error {
+	for len(buf) > 0 {
+		burst, err := t.burstCount()
+		if err != nil {
+			return err
+		}
+		n := min(burst, len(buf))
+		if err := t.bus.Read(DataFIFO, buf[:n]); err != nil {
+			return err
+		}
+		buf = buf[n:]
+	}
+	return nil
+}
+
+// SetCommandTimeout implements transport.CommandTimeoutSetter.
+func (t *TPM) SetCommandTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = timeoutCommand
+	}
+	t.commandTimeout = timeout
+}
+
+// SetMaxResponseSize implements transport.ResponseSizer. Responses larger
+// than size are rejected with ErrResponseTooLarge.
+func (t *TPM) SetMaxResponseSize(size int) {
+	if size <= 0 {
+		size = tpmutil.DefaultMaxResponseSize
+	}
+	t.maxResponse = size
+}
+
+// Send sends a command and returns the response.
+func (t *TPM) Send(input []byte) ([]byte, error) {
+	if err := t.setSts(stsCommandReady); err != nil {
+		return nil, err
+	}
+	if err := t.waitSts(timeoutB, stsCommandReady); err != nil {
+		return nil, fmt.Errorf("waiting for commandReady: %w", err)
+	}
+	// Leave the TPM idle, whatever happens.
+	defer t.setSts(stsCommandReady)
+
+	if err := t.writeFIFO(input); err != nil {
+		return nil, fmt.Errorf("writing command: %w", err)
+	}
+	if err := t.waitSts(timeoutC, stsValid); err != nil {
+		return nil, fmt.Errorf("waiting for stsValid: %w", err)
+	}
+	if s, err := t.sts(); err != nil {
+		return nil, err
+	} else if s&stsExpect != 0 {
+		return nil, fmt.Errorf("TPM expects more than the %d command bytes written", len(input))
+	}
+	if err := t.setSts(stsGo); err != nil {
+		return nil, err
+	}
+
+	if err := t.waitSts(t.commandTimeout, stsValid|stsDataAvail); err != nil {
+		return nil, fmt.Errorf("waiting for response: %w", err)
+	}
+	rsp := make([]byte, headerSize)
+	if err := t.readFIFO(rsp); err != nil {
+		return nil, fmt.Errorf("reading response header: %w", err)
+	}
+	size := int(binary.BigEndian.Uint32(rsp[2:6]))
+	if size < headerSize {
+		return nil, fmt.Errorf("invalid response size %d", size)
+	}
+	if size > t.maxResponse {
+		return nil, fmt.Errorf("%w: %d bytes", ErrResponseTooLarge, size)
+	}
+	rsp = append(rsp, make([]byte, size-headerSize)...)
+	if err := t.readFIFO(rsp[headerSize:]); err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	return rsp, nil
+}
+
+// Close relinquishes the locality.
+func (t *TPM) Close() error {
+	return t.bus.Write(Access, []byte{accessActiveLocality})
+}
@@ -0,0 +1,125 @@
+package tis_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/internal/tis"
+	"github.com/google/go-tpm/tpm2/transport/internal/tis/tistest"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+	testhelper "github.com/google/go-tpm/tpm2/transport/test"
+)
+
+func TestFIFO(t *testing.T) {
+	testhelper.RunTest(t, nil, func() (transport.TPMCloser, error) {
+		sim, err := simulator.OpenSimulator()
+		if err != nil {
+			t.Fatalf("could not connect to TPM simulator: %v", err)
+		}
+		t.Cleanup(func() { sim.Close() })
+		return tis.Open(tistest.New(sim))
+	})
+}
+
+func TestSetLocality(t *testing.T) {
+	sim, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer sim.Close()
+	dev := tistest.New(sim)
+	tpm, err := tis.Open(dev)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tpm.Close()
+
+	// Through Chain, as most callers will see the transport.
+	if err := transport.SetLocality(transport.Chain(tpm), 3); err != nil {
+		t.Fatalf("SetLocality(3): %v", err)
+	}
+	if dev.Locality != 3 {
+		t.Errorf("device locality = %d, want 3", dev.Locality)
+	}
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(tpm); err != nil {
+		t.Errorf("GetRandom at locality 3: %v", err)
+	}
+	if err := transport.SetLocality(tpm, 5); err == nil {
+		t.Errorf("SetLocality(5) succeeded")
+	}
+
+	// A bus without localities can't switch.
+	fixed, err := tis.Open(struct{ tis.Bus }{tistest.New(sim)})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := transport.SetLocality(fixed, 1); !errors.Is(err, transport.ErrLocalityUnsupported) {
+		t.Errorf("SetLocality() on a bus without localities = %v, want %v", err, transport.ErrLocalityUnsupported)
+	}
+	if err := transport.SetLocality(sim, 1); !errors.Is(err, transport.ErrLocalityUnsupported) {
+		t.Errorf("SetLocality() on the simulator = %v, want %v", err, transport.ErrLocalityUnsupported)
+	}
+}
+
+// sizeTPM returns a response header claiming the given size.
+type sizeTPM uint32
+
+func (s sizeTPM) Send([]byte) ([]byte, error) {
+	rsp := make([]byte, 10)
+	binary.BigEndian.PutUint16(rsp, uint16(tpm2.TPMSTNoSessions))
+	binary.BigEndian.PutUint32(rsp[2:], uint32(s))
+	return rsp, nil
+}
+
+func TestResponseTooLarge(t *testing.T) {
+	tpm, err := tis.Open(tistest.New(sizeTPM(0xfffffff0)))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tpm.Close()
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(tpm); !errors.Is(err, tis.ErrResponseTooLarge) {
+		t.Errorf("GetRandom with a 4 GiB response = %v, want %v", err, tis.ErrResponseTooLarge)
+	}
+
+	// The limit follows the TPM's reported maximum.
+	tpm, err = tis.Open(tistest.New(sizeTPM(8000)))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tpm.Close()
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(tpm); !errors.Is(err, tis.ErrResponseTooLarge) {
+		t.Errorf("GetRandom with an 8000-byte response = %v, want %v", err, tis.ErrResponseTooLarge)
+	}
+	tpm.SetMaxResponseSize(8192)
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(tpm); errors.Is(err, tis.ErrResponseTooLarge) {
+		t.Errorf("GetRandom with an 8000-byte response after SetMaxResponseSize(8192) = %v", err)
+	}
+}
+
+func TestPollBackoff(t *testing.T) {
+	calls := 0
+	err := tis.Poll(50*time.Millisecond, func() (bool, error) {
+		calls++
+		return false, nil
+	})
+	if !errors.Is(err, tis.ErrTimeout) {
+		t.Errorf("Poll() = %v, want %v", err, tis.ErrTimeout)
+	}
+	// Backing off to 5ms, 50ms takes about 15 calls; without waiting, it
+	// would take many thousands.
+	if calls > 50 {
+		t.Errorf("Poll() read the register %d times in 50ms", calls)
+	}
+
+	calls = 0
+	if err := tis.Poll(time.Second, func() (bool, error) {
+		calls++
+		return calls == 3, nil
+	}); err != nil {
+		t.Errorf("Poll() = %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+// Package tistest provides a fake FIFO interface device for testing the
+// buses built on package tis.
+package tistest
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/internal/tis"
+)
+
+// Register bits, as seen by a bus.
+const (
+	accessValid          = 0x80
+	accessActiveLocality = 0x20
+	accessRequestUse     = 0x02
+	stsValid             = 0x80
+	stsCommandReady      = 0x40
+	stsGo                = 0x20
+	stsDataAvail         = 0x10
+	stsExpect            = 0x08
+	stsBurstShift        = 8
+)
+
+// Device emulates the FIFO registers of a single locality in front of a
+// TPM. It implements tis.LocalityBus.
+type Device struct {
+	// Burst is the burst count the device reports. It is deliberately
+	// small by default, to exercise burst handling.
+	Burst int
+	// Locality is the locality last selected with SetLocality.
+	Locality int
+
+	tpm      transport.TPM
+	active   bool
+	ready    bool
+	cmd, rsp []byte
+}
+
+// New returns a Device that sends commands to tpm.
+func New(tpm transport.TPM) *Device {
+	return &Device{Burst: 8, tpm: tpm}
+}
+
+// SetLocality implements tis.LocalityBus. The locality must have been
+// relinquished first.
+func (d *Device) SetLocality(locality int) error {
+	if d.active {
+		return fmt.Errorf("locality %d selected while locality %d is active", locality, d.Locality)
+	}
+	d.Locality = locality
+	return nil
+}
+
+// expect reports whether the command written so far is incomplete.
+func (d *Device) expect() bool {
+	return len(d.cmd) < 6 || len(d.cmd) < int(binary.BigEndian.Uint32(d.cmd[2:6]))
+}
+
+// Read implements tis.Bus.
+func (d *Device) Read(reg tis.Register, buf []byte) error {
+	switch reg {
+	case tis.Access:
+		buf[0] = accessValid
+		if d.active {
+			buf[0] |= accessActiveLocality
+		}
+	case tis.Sts:
+		sts := uint32(stsValid | d.Burst<<stsBurstShift)
+		if d.ready && len(d.cmd) == 0 {
+			sts |= stsCommandReady
+		}
+		if len(d.cmd) > 0 && d.expect() {
+			sts |= stsExpect
+		}
+		if len(d.rsp) > 0 {
+			sts |= stsDataAvail
+		}
+		binary.LittleEndian.PutUint32(buf, sts)
+	case tis.DataFIFO:
+		if len(buf) > len(d.rsp) {
+			return fmt.Errorf("read of %d bytes with %d available", len(buf), len(d.rsp))
+		}
+		n := copy(buf, d.rsp)
+		d.rsp = d.rsp[n:]
+	}
+	return nil
+}
+
+// Write implements tis.Bus.
+func (d *Device) Write(reg tis.Register, data []byte) error {
+	switch reg {
+	case tis.Access:
+		switch data[0] {
+		case accessRequestUse:
+			d.active = true
+		case accessActiveLocality:
+			d.active = false
+		}
+	case tis.Sts:
+		switch binary.LittleEndian.Uint32(data) {
+		case stsCommandReady:
+			d.ready, d.cmd, d.rsp = true, nil, nil
+		case stsGo:
+			rsp, err := d.tpm.Send(d.cmd)
+			if err != nil {
+				return err
+			}
+			d.ready, d.cmd, d.rsp = false, nil, rsp
+		}
+	case tis.DataFIFO:
+		if !d.ready {
+			return fmt.Errorf("FIFO written while not ready")
+		}
+		d.cmd = append(d.cmd, data...)
+	}
+	return nil
+}
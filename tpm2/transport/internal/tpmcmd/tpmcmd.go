@@ -0,0 +1,153 @@
+// Package tpmcmd parses the parts of marshalled TPM commands and responses
+// that transports managing handles on behalf of their users need: the
+// command's attributes, its handle and authorization areas, and response
+// codes.
+package tpmcmd
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Response code modifiers, for errors about the Nth handle, parameter or
+// session.
+const (
+	RCP = 0x040
+	RCS = 0x800
+	RC1 = 0x100
+)
+
+// Attributes reads the attributes of every command the TPM implements.
+func Attributes(t transport.TPM) (map[tpm2.TPMCC]tpm2.TPMACC, error) {
+	attrs := make(map[tpm2.TPMCC]tpm2.TPMACC)
+	property := uint32(0)
+	for {
+		rsp, err := tpm2.GetCapability{
+			Capability:    tpm2.TPMCapCommands,
+			Property:      property,
+			PropertyCount: 64,
+		}.Execute(t)
+		if err != nil {
+			return nil, fmt.Errorf("reading command attributes: %w", err)
+		}
+		cmds, err := rsp.CapabilityData.Data.Command()
+		if err != nil {
+			return nil, fmt.Errorf("reading command attributes: %w", err)
+		}
+		for _, a := range cmds.CommandAttributes {
+			attrs[commandCode(a)] = a
+			property = uint32(a.CommandIndex) + 1
+		}
+		if !rsp.MoreData || len(cmds.CommandAttributes) == 0 {
+			return attrs, nil
+		}
+	}
+}
+
+// commandCode returns the code of the command described by a.
+func commandCode(a tpm2.TPMACC) tpm2.TPMCC {
+	cc := tpm2.TPMCC(a.CommandIndex)
+	if a.V {
+		cc |= 0x20000000
+	}
+	return cc
+}
+
+// CommandCode returns the command code of cmd, which must be at least 10
+// bytes long.
+func CommandCode(cmd []byte) tpm2.TPMCC {
+	return tpm2.TPMCC(binary.BigEndian.Uint32(cmd[6:10]))
+}
+
+// Handles returns the nh handles in the handle area of cmd, or nil if cmd
+// is too short to hold them.
+func Handles(cmd []byte, nh int) []tpm2.TPMHandle {
+	if len(cmd) < 10+4*nh {
+		return nil
+	}
+	hs := make([]tpm2.TPMHandle, nh)
+	for i := range hs {
+		hs[i] = tpm2.TPMHandle(binary.BigEndian.Uint32(cmd[10+4*i:]))
+	}
+	return hs
+}
+
+// AuthSession is a session in the authorization area of a command.
+type AuthSession struct {
+	Handle tpm2.TPMHandle
+	Attrs  byte
+}
+
+// ContinueSession reports whether the session stays open after the command.
+func (s AuthSession) ContinueSession() bool {
+	// continueSession is bit 0 of the session attributes.
+	return s.Attrs&1 != 0
+}
+
+// AuthSessions returns the sessions in the authorization area of cmd, which
+// has nh handles. A malformed area is left for the TPM to reject.
+func AuthSessions(cmd []byte, nh int) []AuthSession {
+	if len(cmd) < 14+4*nh || binary.BigEndian.Uint16(cmd[0:2]) != uint16(tpm2.TPMSTSessions) {
+		return nil
+	}
+	area := cmd[10+4*nh:]
+	size := int(binary.BigEndian.Uint32(area))
+	if size > len(area)-4 {
+		return nil
+	}
+	area = area[4 : 4+size]
+	var sessions []AuthSession
+	for len(area) > 0 {
+		// sessionHandle and nonceCaller, then sessionAttributes and hmac.
+		if len(area) < 6 {
+			return sessions
+		}
+		n := 6 + int(binary.BigEndian.Uint16(area[4:]))
+		if len(area) < n+3 {
+			return sessions
+		}
+		attrs := area[n]
+		n += 3 + int(binary.BigEndian.Uint16(area[n+1:]))
+		if len(area) < n {
+			return sessions
+		}
+		sessions = append(sessions, AuthSession{
+			Handle: tpm2.TPMHandle(binary.BigEndian.Uint32(area)),
+			Attrs:  attrs,
+		})
+		area = area[n:]
+	}
+	return sessions
+}
+
+// ErrorResponse returns a response to a command that failed with rc.
+func ErrorResponse(rc tpm2.TPMRC) []byte {
+	rsp := []byte{0x80, 0x01, 0, 0, 0, 10, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(rsp[6:], uint32(rc))
+	return rsp
+}
+
+// SuccessResponse returns a response to a command with no response values.
+func SuccessResponse() []byte {
+	return ErrorResponse(0)
+}
+
+// ResponseCode returns the response code of rsp.
+func ResponseCode(rsp []byte) tpm2.TPMRC {
+	if len(rsp) < 10 {
+		return tpm2.TPMRCFailure
+	}
+	return tpm2.TPMRC(binary.BigEndian.Uint32(rsp[6:10]))
+}
+
+// ResponseHandle returns the handle in the handle area of rsp, for commands
+// that return one, or 0 if rsp is too short to hold it.
+func ResponseHandle(rsp []byte) tpm2.TPMHandle {
+	if len(rsp) < 14 {
+		return 0
+	}
+	return tpm2.TPMHandle(binary.BigEndian.Uint32(rsp[10:14]))
+}
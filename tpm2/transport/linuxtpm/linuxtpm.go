@@ -16,7 +16,9 @@ var (
 	ErrFileIsNotDevice = errors.New("TPM file is not a device")
 )
 
-// Open opens the TPM device file at the given path.
+// Open opens the TPM device file at the given path. Responses are read into a
+// buffer of tpmutil.DefaultMaxResponseSize bytes; tpm2.ConfigureMaxResponseSize
+// sizes it to the TPM instead, at the cost of a command.
 func Open(path string) (transport.TPMCloser, error) {
 	fi, err := os.Stat(path)
 	if err != nil {
@@ -3,10 +3,14 @@
 package linuxtpm
 
 import (
+	"fmt"
 	"os"
+	"reflect"
 	"testing"
 
+	"github.com/google/go-tpm/tpm2"
 	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
 	testhelper "github.com/google/go-tpm/tpm2/transport/test"
 )
 
@@ -23,3 +27,72 @@ func TestLocalTPM(t *testing.T) {
 func TestLocalResourceManagedTPM(t *testing.T) {
 	testhelper.RunTest(t, []error{os.ErrNotExist, os.ErrPermission, ErrFileIsNotDevice}, open("/dev/tpmrm0"))
 }
+
+func TestOpenResourceManaged(t *testing.T) {
+	testhelper.RunTest(t, []error{os.ErrNotExist, os.ErrPermission, ErrFileIsNotDevice}, func() (transport.TPMCloser, error) {
+		return OpenResourceManaged()
+	})
+}
+
+// keepOpen stops Close from closing the simulator, so that its state can be
+// checked afterwards.
+type keepOpen struct {
+	transport.TPM
+}
+
+func (keepOpen) Close() error { return nil }
+
+func TestCloseFlushesTransients(t *testing.T) {
+	for _, resourceManaged := range []bool{false, true} {
+		t.Run(fmt.Sprintf("resourceManaged=%v", resourceManaged), func(t *testing.T) {
+			sim, err := simulator.OpenSimulator()
+			if err != nil {
+				t.Fatalf("could not connect to TPM simulator: %v", err)
+			}
+			defer sim.Close()
+			thetpm := newTPM(keepOpen{sim}, resourceManaged)
+
+			var primaries []tpm2.TPMHandle
+			for i := 0; i < 2; i++ {
+				rsp, err := tpm2.CreatePrimary{
+					PrimaryHandle: tpm2.TPMRHOwner,
+					InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+				}.Execute(thetpm)
+				if err != nil {
+					t.Fatalf("CreatePrimary: %v", err)
+				}
+				primaries = append(primaries, rsp.ObjectHandle)
+			}
+			if _, err := (tpm2.FlushContext{FlushHandle: primaries[0]}).Execute(thetpm); err != nil {
+				t.Fatalf("FlushContext: %v", err)
+			}
+			seq, err := tpm2.HashSequenceStart{HashAlg: tpm2.TPMAlgSHA256}.Execute(thetpm)
+			if err != nil {
+				t.Fatalf("HashSequenceStart: %v", err)
+			}
+			if _, err := (tpm2.SequenceComplete{
+				SequenceHandle: tpm2.AuthHandle{Handle: seq.SequenceHandle, Auth: tpm2.PasswordAuth(nil)},
+				Hierarchy:      tpm2.TPMRHNull,
+			}).Execute(thetpm); err != nil {
+				t.Fatalf("SequenceComplete: %v", err)
+			}
+
+			if err := thetpm.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			handles, err := tpm2.GetHandles(sim, tpm2.TPMHTTransient)
+			if err != nil {
+				t.Fatalf("GetHandles: %v", err)
+			}
+			// With a resource manager, the remaining primary is left for
+			// it to flush.
+			var want []tpm2.TPMHandle
+			if resourceManaged {
+				want = primaries[1:]
+			}
+			if !reflect.DeepEqual(handles, want) {
+				t.Errorf("transient handles after Close = %v, want %v", handles, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+//go:build !windows
+
+package linuxtpm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+const (
+	// ResourceManagerPath is the device file of the kernel resource
+	// manager, present since Linux 4.12.
+	ResourceManagerPath = "/dev/tpmrm0"
+	// DirectPath is the device file that talks to the TPM directly.
+	DirectPath = "/dev/tpm0"
+)
+
+// objectCreators are the commands that load a transient object, returning
+// its handle first in the response.
+var objectCreators = map[tpm2.TPMCC]bool{
+	tpm2.TPMCCCreatePrimary:     true,
+	tpm2.TPMCCLoad:              true,
+	tpm2.TPMCCLoadExternal:      true,
+	tpm2.TPMCCCreateLoaded:      true,
+	tpm2.TPMCCContextLoad:       true,
+	tpm2.TPMCCHashSequenceStart: true,
+	tpm2.TPMCCMACStart:          true,
+}
+
+// TPM is a connection opened by OpenResourceManaged.
+type TPM struct {
+	tpm             transport.TPMCloser
+	resourceManaged bool
+
+	mu sync.Mutex
+	// transients holds the transient objects loaded through a direct
+	// connection and not yet flushed.
+	transients map[tpm2.TPMHandle]bool
+}
+
+var (
+	_ transport.TPMCloser       = (*TPM)(nil)
+	_ transport.ResourceManager = (*TPM)(nil)
+	_ transport.ResponseSizer   = (*TPM)(nil)
+)
+
+// OpenResourceManaged opens the kernel resource manager if the kernel has
+// one, and the TPM directly otherwise.
+//
+// Either way, closing the connection releases the transient objects loaded
+// through it, so callers need not flush them: the resource manager does so
+// itself, and a direct connection keeps track of them and flushes them in
+// Close. Sessions are only flushed by the resource manager; on a direct
+// connection they must be ended as usual.
+func OpenResourceManaged() (*TPM, error) {
+	path := ResourceManagerPath
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		path = DirectPath
+	}
+	t, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return newTPM(t, path == ResourceManagerPath), nil
+}
+
+func newTPM(t transport.TPMCloser, resourceManaged bool) *TPM {
+	return &TPM{
+		tpm:             t,
+		resourceManaged: resourceManaged,
+		transients:      make(map[tpm2.TPMHandle]bool),
+	}
+}
+
+// ResourceManaged implements transport.ResourceManager.
+func (t *TPM) ResourceManaged() bool {
+	return t.resourceManaged
+}
+
+// SetMaxResponseSize implements transport.ResponseSizer.
+func (t *TPM) SetMaxResponseSize(size int) {
+	if rs, ok := t.tpm.(transport.ResponseSizer); ok {
+		rs.SetMaxResponseSize(size)
+	}
+}
+
+// Send implements transport.TPM.
+func (t *TPM) Send(cmd []byte) ([]byte, error) {
+	rsp, err := t.tpm.Send(cmd)
+	if err != nil || t.resourceManaged || len(cmd) < 14 || len(rsp) < 14 {
+		return rsp, err
+	}
+	if binary.BigEndian.Uint32(rsp[6:10]) != 0 {
+		return rsp, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch cc := tpm2.TPMCC(binary.BigEndian.Uint32(cmd[6:10])); {
+	case objectCreators[cc]:
+		if h := tpm2.TPMHandle(binary.BigEndian.Uint32(rsp[10:14])); h>>24 == tpm2.TPMHandle(tpm2.TPMHTTransient) {
+			t.transients[h] = true
+		}
+	case cc == tpm2.TPMCCFlushContext, cc == tpm2.TPMCCSequenceComplete:
+		// FlushContext takes its handle as a parameter, and
+		// SequenceComplete as its first handle; both are at the same
+		// place in the command.
+		delete(t.transients, tpm2.TPMHandle(binary.BigEndian.Uint32(cmd[10:14])))
+	case cc == tpm2.TPMCCEventSequenceComplete && len(cmd) >= 18:
+		delete(t.transients, tpm2.TPMHandle(binary.BigEndian.Uint32(cmd[14:18])))
+	}
+	return rsp, nil
+}
+
+// Close flushes the transient objects loaded through a direct connection,
+// then closes the device.
+func (t *TPM) Close() error {
+	t.mu.Lock()
+	handles := t.transients
+	t.transients = make(map[tpm2.TPMHandle]bool)
+	t.mu.Unlock()
+
+	var errs []error
+	for h := range handles {
+		// The object may already be gone, for example after a TPM reset.
+		if _, err := (tpm2.FlushContext{FlushHandle: h}).Execute(t.tpm); err != nil && !errors.Is(err, tpm2.TPMRCHandle) {
+			errs = append(errs, fmt.Errorf("flushing 0x%08x: %w", uint32(h), err))
+		}
+	}
+	errs = append(errs, t.tpm.Close())
+	return errors.Join(errs...)
+}
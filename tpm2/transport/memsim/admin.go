@@ -0,0 +1,180 @@
+package memsim
+
+import (
+	"bytes"
+	"crypto/rand"
+	"sort"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+func (t *TPM) startup(c *command, r *reader) (*response, error) {
+	su := tpm2.TPMSU(r.u16())
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	if t.started {
+		return nil, tpm2.TPMRCInitialize
+	}
+	switch su {
+	case tpm2.TPMSUClear:
+		t.reset()
+	case tpm2.TPMSUState:
+		// PCRs keep their values, but loaded objects and sessions are
+		// lost, since the simulator doesn't save their contexts.
+		t.objects = make(map[tpm2.TPMHandle]*object)
+		t.sessions = make(map[tpm2.TPMHandle]*session)
+	default:
+		return nil, paramErr(tpm2.TPMRCValue, 1)
+	}
+	t.started = true
+	return &response{}, nil
+}
+
+// shutdown is treated as the TPM being powered off: until the next
+// TPM2_Startup, other commands fail with TPM_RC_INITIALIZE.
+func (t *TPM) shutdown(c *command, r *reader) (*response, error) {
+	su := tpm2.TPMSU(r.u16())
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	if su != tpm2.TPMSUClear && su != tpm2.TPMSUState {
+		return nil, paramErr(tpm2.TPMRCValue, 1)
+	}
+	t.started = false
+	return &response{}, nil
+}
+
+func (t *TPM) getRandom(c *command, r *reader) (*response, error) {
+	n := int(r.u16())
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	// Like a TPM, return at most one digest's worth of bytes.
+	n = min(n, maxDigest)
+	b := make([]byte, n)
+	rand.Read(b)
+	return &response{params: marshal(tpm2.TPM2BDigest{Buffer: b})}, nil
+}
+
+// properties are the TPM properties reported by TPM2_GetCapability, in
+// order.
+var properties = []tpm2.TPMSTaggedProperty{
+	{Property: tpm2.TPMPTFamilyIndicator, Value: 0x322e3000}, // "2.0"
+	{Property: tpm2.TPMPTLevel, Value: 0},
+	{Property: tpm2.TPMPTRevision, Value: 159},
+	{Property: tpm2.TPMPTManufacturer, Value: 0x474f4f47},  // "GOOG"
+	{Property: tpm2.TPMPTVendorString1, Value: 0x6d656d73}, // "mems"
+	{Property: tpm2.TPMPTVendorString2, Value: 0x696d0000}, // "im"
+	{Property: tpm2.TPMPTInputBuffer, Value: maxNVBuffer},
+	{Property: tpm2.TPMPTHRTransientMin, Value: maxObjects},
+	{Property: tpm2.TPMPTActiveSessionsMax, Value: maxSessions},
+	{Property: tpm2.TPMPTPCRCount, Value: pcrCount},
+	{Property: tpm2.TPMPTPCRSelectMin, Value: 3},
+	{Property: tpm2.TPMPTNVIndexMax, Value: maxNVIndexSize},
+	{Property: tpm2.TPMPTMaxCommandSize, Value: maxCommandSize},
+	{Property: tpm2.TPMPTMaxResponseSize, Value: maxCommandSize},
+	{Property: tpm2.TPMPTMaxDigest, Value: maxDigest},
+	{Property: tpm2.TPMPTNVBufferMax, Value: maxNVBuffer},
+}
+
+func (t *TPM) getCapability(c *command, r *reader) (*response, error) {
+	capability := tpm2.TPMCap(r.u32())
+	property := r.u32()
+	count := int(r.u32())
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+
+	var more bool
+	var data tpm2.TPMUCapabilities
+	switch capability {
+	case tpm2.TPMCapTPMProperties:
+		var props []tpm2.TPMSTaggedProperty
+		for _, p := range properties {
+			if uint32(p.Property) >= property {
+				props = append(props, p)
+			}
+		}
+		if len(props) > count {
+			props, more = props[:count], true
+		}
+		data = tpm2.NewTPMUCapabilities(capability, &tpm2.TPMLTaggedTPMProperty{TPMProperty: props})
+	case tpm2.TPMCapPCRs:
+		var sel tpm2.TPMLPCRSelection
+		for _, alg := range []tpm2.TPMIAlgHash{tpm2.TPMAlgSHA1, tpm2.TPMAlgSHA256} {
+			sel.PCRSelections = append(sel.PCRSelections, tpm2.TPMSPCRSelection{
+				Hash:      alg,
+				PCRSelect: bytes.Repeat([]byte{0xff}, pcrCount/8),
+			})
+		}
+		data = tpm2.NewTPMUCapabilities(capability, &sel)
+	case tpm2.TPMCapHandles:
+		var handles []tpm2.TPMHandle
+		for _, h := range t.handles(tpm2.TPMHT(property >> 24)) {
+			if uint32(h) >= property {
+				handles = append(handles, h)
+			}
+		}
+		if len(handles) > count {
+			handles, more = handles[:count], true
+		}
+		data = tpm2.NewTPMUCapabilities(capability, &tpm2.TPMLHandle{Handle: handles})
+	default:
+		return nil, paramErr(tpm2.TPMRCValue, 1)
+	}
+	var moreData byte
+	if more {
+		moreData = 1
+	}
+	return &response{
+		params: append([]byte{moreData}, marshal(&tpm2.TPMSCapabilityData{Capability: capability, Data: data})...),
+	}, nil
+}
+
+// handles returns the handles of type ht in use, in order.
+func (t *TPM) handles(ht tpm2.TPMHT) []tpm2.TPMHandle {
+	var handles []tpm2.TPMHandle
+	switch ht {
+	case tpm2.TPMHTPCR:
+		for i := 0; i < pcrCount; i++ {
+			handles = append(handles, tpm2.TPMHandle(i))
+		}
+	case tpm2.TPMHTNVIndex:
+		for h := range t.nv {
+			handles = append(handles, h)
+		}
+	case tpm2.TPMHTHMACSession, tpm2.TPMHTPolicySession:
+		for h := range t.sessions {
+			if tpm2.TPMHT(h>>24) == ht {
+				handles = append(handles, h)
+			}
+		}
+	case tpm2.TPMHTPermanent:
+		for h := range t.hierarchyAuth {
+			handles = append(handles, h)
+		}
+	case tpm2.TPMHTTransient:
+		for h := range t.objects {
+			handles = append(handles, h)
+		}
+	}
+	sort.Slice(handles, func(i, j int) bool { return handles[i] < handles[j] })
+	return handles
+}
+
+func (t *TPM) hierarchyChangeAuth(c *command, r *reader) (*response, error) {
+	auth := r.sized()
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	h := c.handles[0]
+	if _, ok := t.hierarchyAuth[h]; !ok {
+		return nil, handleErr(tpm2.TPMRCHierarchy, 1)
+	}
+	if len(auth) > maxDigest {
+		return nil, paramErr(tpm2.TPMRCSize, 1)
+	}
+	t.hierarchyAuth[h] = bytes.Clone(auth)
+	return &response{}, nil
+}
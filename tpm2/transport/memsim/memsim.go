@@ -0,0 +1,595 @@
+// Package memsim is a small TPM 2.0 simulator written in Go, which runs in
+// the test process itself. It lets users of this module unit test code that
+// talks to a TPM without building or running an external simulator.
+//
+// It implements only a subset of TPM 2.0:
+//
+//   - TPM2_Startup, TPM2_Shutdown, TPM2_GetRandom and TPM2_GetCapability
+//     (TPM properties, PCR banks and handles).
+//   - TPM2_CreatePrimary, TPM2_Create, TPM2_Load, TPM2_ReadPublic and
+//     TPM2_FlushContext, for RSA and ECC keys and sealed data objects.
+//   - TPM2_Sign with RSASSA, RSAPSS and ECDSA, and TPM2_Unseal.
+//   - TPM2_PCR_Read, TPM2_PCR_Extend, TPM2_PCR_Event and TPM2_PCR_Reset, on
+//     SHA-1 and SHA-256 banks of 24 PCRs.
+//   - TPM2_NV_DefineSpace, TPM2_NV_UndefineSpace, TPM2_NV_ReadPublic,
+//     TPM2_NV_Write, TPM2_NV_Read and TPM2_NV_Increment, for ordinary and
+//     counter indices.
+//   - Password authorization, unbound and unsalted HMAC sessions without
+//     parameter encryption, and policy sessions with TPM2_PolicyPCR,
+//     TPM2_PolicyAuthValue and TPM2_PolicyGetDigest.
+//   - TPM2_HierarchyChangeAuth.
+//
+// Other commands fail with TPM_RC_COMMAND_CODE. The simulator has no
+// dictionary attack protection, its private key blobs can only be loaded
+// into the instance that created them, and its state is lost when it is
+// closed. It is meant for tests, not for protecting secrets.
+package memsim
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Limits of the simulated TPM.
+const (
+	maxObjects     = 16
+	maxSessions    = 16
+	maxCommandSize = 4096
+	maxNVIndices   = 64
+	maxNVIndexSize = 2048
+	maxNVBuffer    = 1024
+	maxDigest      = 32
+	pcrCount       = 24
+	// The fixed part of a command or response: tag, size and code.
+	headerSize = 10
+)
+
+// rcBadTag is TPM_RC_BAD_TAG, which package tpm2 doesn't define.
+const rcBadTag tpm2.TPMRC = 0x01E
+
+// ErrClosed is returned by Send once the simulator has been closed.
+var ErrClosed = errors.New("memsim: simulator is closed")
+
+// TPM is a simulated TPM. It is safe for concurrent use.
+type TPM struct {
+	mu      sync.Mutex
+	closed  bool
+	started bool
+
+	// blobKey protects the private areas returned by TPM2_Create.
+	blobKey cipher.AEAD
+	// hierarchyAuth holds the authorization values of the hierarchies.
+	hierarchyAuth map[tpm2.TPMHandle][]byte
+	// primaries caches the keys of primary objects, so that creating the
+	// same primary object twice gives the same key, as on a real TPM.
+	primaries map[string]any
+
+	objects    map[tpm2.TPMHandle]*object
+	sessions   map[tpm2.TPMHandle]*session
+	nv         map[tpm2.TPMHandle]*nvIndex
+	pcrs       map[tpm2.TPMIAlgHash][][]byte
+	pcrCounter uint32
+	// nextHandle is used to number objects and sessions.
+	nextHandle uint32
+}
+
+var _ transport.TPMCloser = (*TPM)(nil)
+
+// New returns a simulated TPM that has been started and whose hierarchies
+// have empty authorization values.
+func New() (*TPM, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	t := &TPM{
+		blobKey: aead,
+		hierarchyAuth: map[tpm2.TPMHandle][]byte{
+			tpm2.TPMRHOwner:       nil,
+			tpm2.TPMRHEndorsement: nil,
+			tpm2.TPMRHPlatform:    nil,
+			tpm2.TPMRHLockout:     nil,
+		},
+		primaries: make(map[string]any),
+		nv:        make(map[tpm2.TPMHandle]*nvIndex),
+	}
+	t.reset()
+	t.started = true
+	return t, nil
+}
+
+// reset returns the TPM to the state it has after TPM2_Startup(CLEAR).
+func (t *TPM) reset() {
+	t.objects = make(map[tpm2.TPMHandle]*object)
+	t.sessions = make(map[tpm2.TPMHandle]*session)
+	t.pcrs = make(map[tpm2.TPMIAlgHash][][]byte)
+	for _, alg := range []tpm2.TPMIAlgHash{tpm2.TPMAlgSHA1, tpm2.TPMAlgSHA256} {
+		h, _ := alg.Hash()
+		bank := make([][]byte, pcrCount)
+		for i := range bank {
+			bank[i] = make([]byte, h.Size())
+		}
+		t.pcrs[alg] = bank
+	}
+	t.pcrCounter = 0
+}
+
+// Close discards the simulator's state.
+func (t *TPM) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrClosed
+	}
+	t.closed = true
+	return nil
+}
+
+// Send implements transport.TPM. TPM errors are reported in the response,
+// as a TPM would; Send itself only fails once the simulator is closed.
+func (t *TPM) Send(cmd []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, ErrClosed
+	}
+	rsp, err := t.execute(cmd)
+	if err != nil {
+		var rc tpm2.TPMRC
+		if !errors.As(err, &rc) {
+			rc = tpm2.TPMRCFailure
+		}
+		rsp := make([]byte, headerSize)
+		binary.BigEndian.PutUint16(rsp[0:], uint16(tpm2.TPMSTNoSessions))
+		binary.BigEndian.PutUint32(rsp[2:], headerSize)
+		binary.BigEndian.PutUint32(rsp[6:], uint32(rc))
+		return rsp, nil
+	}
+	return rsp, nil
+}
+
+// Response codes for errors in a particular handle, session or parameter,
+// numbered from 1.
+func handleErr(rc tpm2.TPMRC, n int) tpm2.TPMRC  { return rc | tpm2.TPMRC(n<<8) }
+func sessionErr(rc tpm2.TPMRC, n int) tpm2.TPMRC { return rc | 0x800 | tpm2.TPMRC(n<<8) }
+func paramErr(rc tpm2.TPMRC, n int) tpm2.TPMRC   { return rc | 0x040 | tpm2.TPMRC(n<<8) }
+
+// command is a decoded command.
+type command struct {
+	cc      tpm2.TPMCC
+	handles []tpm2.TPMHandle
+	auths   []tpm2.TPMSAuthCommand
+	// params is the parameter area, which authorization HMACs cover.
+	params      []byte
+	hasSessions bool
+}
+
+// response is a handler's result.
+type response struct {
+	handles []tpm2.TPMHandle
+	params  []byte
+}
+
+// handler runs a command whose handles have been authorized. Its
+// parameters are read from r.
+type handler func(t *TPM, c *command, r *reader) (*response, error)
+
+// commandSpec describes how to decode and authorize a command.
+type commandSpec struct {
+	// handles is the number of handles in the command, of which the first
+	// auth need authorization.
+	handles, auth int
+	run           handler
+}
+
+// commands are the commands the simulator implements.
+var commands = map[tpm2.TPMCC]commandSpec{
+	tpm2.TPMCCStartup:             {0, 0, (*TPM).startup},
+	tpm2.TPMCCShutdown:            {0, 0, (*TPM).shutdown},
+	tpm2.TPMCCGetRandom:           {0, 0, (*TPM).getRandom},
+	tpm2.TPMCCGetCapability:       {0, 0, (*TPM).getCapability},
+	tpm2.TPMCCHierarchyChanegAuth: {1, 1, (*TPM).hierarchyChangeAuth},
+	tpm2.TPMCCStartAuthSession:    {2, 0, (*TPM).startAuthSession},
+	tpm2.TPMCCPolicyPCR:           {1, 0, (*TPM).policyPCR},
+	tpm2.TPMCCPolicyAuthValue:     {1, 0, (*TPM).policyAuthValue},
+	tpm2.TPMCCPolicyGetDigest:     {1, 0, (*TPM).policyGetDigest},
+	tpm2.TPMCCCreatePrimary:       {1, 1, (*TPM).createPrimary},
+	tpm2.TPMCCCreate:              {1, 1, (*TPM).create},
+	tpm2.TPMCCLoad:                {1, 1, (*TPM).load},
+	tpm2.TPMCCReadPublic:          {1, 0, (*TPM).readPublic},
+	tpm2.TPMCCFlushContext:        {0, 0, (*TPM).flushContext},
+	tpm2.TPMCCSign:                {1, 1, (*TPM).sign},
+	tpm2.TPMCCUnseal:              {1, 1, (*TPM).unseal},
+	tpm2.TPMCCPCRRead:             {0, 0, (*TPM).pcrRead},
+	tpm2.TPMCCPCRExtend:           {1, 1, (*TPM).pcrExtend},
+	tpm2.TPMCCPCREvent:            {1, 1, (*TPM).pcrEvent},
+	tpm2.TPMCCPCRReset:            {1, 1, (*TPM).pcrReset},
+	tpm2.TPMCCNVDefineSpace:       {1, 1, (*TPM).nvDefineSpace},
+	tpm2.TPMCCNVUndefineSpace:     {2, 1, (*TPM).nvUndefineSpace},
+	tpm2.TPMCCNVReadPublic:        {1, 0, (*TPM).nvReadPublic},
+	tpm2.TPMCCNVWrite:             {2, 1, (*TPM).nvWrite},
+	tpm2.TPMCCNVRead:              {2, 1, (*TPM).nvRead},
+	tpm2.TPMCCNVIncrement:         {2, 1, (*TPM).nvIncrement},
+}
+
+// execute decodes, authorizes and runs a command, and encodes its response.
+func (t *TPM) execute(buf []byte) ([]byte, error) {
+	if len(buf) < headerSize {
+		return nil, tpm2.TPMRCCommandSize
+	}
+	tag := tpm2.TPMST(binary.BigEndian.Uint16(buf[0:]))
+	if size := binary.BigEndian.Uint32(buf[2:]); int(size) != len(buf) || size > maxCommandSize {
+		return nil, tpm2.TPMRCCommandSize
+	}
+	if tag != tpm2.TPMSTNoSessions && tag != tpm2.TPMSTSessions {
+		return nil, rcBadTag
+	}
+	c := &command{
+		cc:          tpm2.TPMCC(binary.BigEndian.Uint32(buf[6:])),
+		hasSessions: tag == tpm2.TPMSTSessions,
+	}
+	spec, ok := commands[c.cc]
+	if !ok {
+		return nil, tpm2.TPMRCCommandCode
+	}
+	if !t.started && c.cc != tpm2.TPMCCStartup {
+		return nil, tpm2.TPMRCInitialize
+	}
+
+	r := &reader{buf: buf[headerSize:]}
+	for i := 0; i < spec.handles; i++ {
+		c.handles = append(c.handles, tpm2.TPMHandle(r.u32()))
+	}
+	if c.hasSessions {
+		area := &reader{buf: r.bytes(int(r.u32()))}
+		for len(area.buf) > 0 && area.err == nil {
+			c.auths = append(c.auths, *read[tpm2.TPMSAuthCommand](area))
+		}
+		if area.err != nil {
+			return nil, tpm2.TPMRCAuthSize
+		}
+	}
+	if r.err != nil {
+		return nil, tpm2.TPMRCInsufficient
+	}
+	c.params = r.buf
+	if len(c.auths) < spec.auth {
+		return nil, tpm2.TPMRCAuthMissing
+	}
+	if len(c.auths) > spec.auth {
+		return nil, tpm2.TPMRCAuthContext
+	}
+
+	names := make([][]byte, len(c.handles))
+	for i, h := range c.handles {
+		name, err := t.name(h)
+		if err != nil {
+			return nil, handleErr(err.(tpm2.TPMRC), i+1)
+		}
+		names[i] = name
+	}
+	auths := make([]*authorization, len(c.auths))
+	for i := range c.auths {
+		a, err := t.authorize(c, names, i)
+		if err != nil {
+			return nil, err
+		}
+		auths[i] = a
+	}
+
+	rsp, err := spec.run(t, c, &reader{buf: c.params})
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	for _, h := range rsp.handles {
+		binary.Write(&out, binary.BigEndian, h)
+	}
+	if c.hasSessions {
+		binary.Write(&out, binary.BigEndian, uint32(len(rsp.params)))
+	}
+	out.Write(rsp.params)
+	for _, a := range auths {
+		out.Write(tpm2.Marshal(t.respond(c, a, rsp.params)))
+	}
+	hdr := make([]byte, headerSize)
+	binary.BigEndian.PutUint16(hdr[0:], uint16(tag))
+	binary.BigEndian.PutUint32(hdr[2:], uint32(headerSize+out.Len()))
+	return append(hdr, out.Bytes()...), nil
+}
+
+// name returns the name of the entity at handle h.
+func (t *TPM) name(h tpm2.TPMHandle) ([]byte, error) {
+	switch h >> 24 {
+	case tpm2.TPMHandle(tpm2.TPMHTTransient):
+		o, ok := t.objects[h]
+		if !ok {
+			return nil, tpm2.TPMRCHandle
+		}
+		return o.name, nil
+	case tpm2.TPMHandle(tpm2.TPMHTNVIndex):
+		nv, ok := t.nv[h]
+		if !ok {
+			return nil, tpm2.TPMRCHandle
+		}
+		return nv.name(), nil
+	case tpm2.TPMHandle(tpm2.TPMHTPCR):
+		if h >= pcrCount {
+			return nil, tpm2.TPMRCValue
+		}
+	case tpm2.TPMHandle(tpm2.TPMHTPermanent):
+		if _, ok := t.hierarchyAuth[h]; !ok && h != tpm2.TPMRHNull && h != tpm2.TPMRSPW {
+			return nil, tpm2.TPMRCHandle
+		}
+	case tpm2.TPMHandle(tpm2.TPMHTHMACSession), tpm2.TPMHandle(tpm2.TPMHTPolicySession):
+		if _, ok := t.sessions[h]; !ok {
+			return nil, tpm2.TPMRCHandle
+		}
+	default:
+		return nil, tpm2.TPMRCHandle
+	}
+	return binary.BigEndian.AppendUint32(nil, uint32(h)), nil
+}
+
+// entity returns the authorization value and policy of the entity at h,
+// and whether its authorization value may be used in the user role.
+func (t *TPM) entity(h tpm2.TPMHandle) (auth, policy []byte, withAuth bool) {
+	switch h >> 24 {
+	case tpm2.TPMHandle(tpm2.TPMHTTransient):
+		o := t.objects[h]
+		return o.auth, o.public.AuthPolicy.Buffer, o.public.ObjectAttributes.UserWithAuth
+	case tpm2.TPMHandle(tpm2.TPMHTNVIndex):
+		nv := t.nv[h]
+		return nv.auth, nv.public.AuthPolicy.Buffer, true
+	case tpm2.TPMHandle(tpm2.TPMHTPermanent):
+		return t.hierarchyAuth[h], nil, true
+	}
+	// PCRs have empty authorization values.
+	return nil, nil, true
+}
+
+// authorization is the state of a session that authorized a command.
+type authorization struct {
+	handle tpm2.TPMHandle
+	attrs  tpm2.TPMASession
+	// key is the HMAC key for the response, if any.
+	key []byte
+}
+
+// authorize checks the i'th authorization of c.
+func (t *TPM) authorize(c *command, names [][]byte, i int) (*authorization, error) {
+	ac := c.auths[i]
+	auth, policy, withAuth := t.entity(c.handles[i])
+	a := &authorization{handle: ac.Handle, attrs: ac.Attributes}
+	if ac.Attributes.Encrypt || ac.Attributes.Decrypt || ac.Attributes.Audit {
+		return nil, sessionErr(tpm2.TPMRCAttributes, i+1)
+	}
+
+	if ac.Handle == tpm2.TPMRSPW {
+		if !withAuth {
+			return nil, tpm2.TPMRCAuthUnavailable
+		}
+		if len(ac.Nonce.Buffer) != 0 {
+			return nil, sessionErr(tpm2.TPMRCNonce, i+1)
+		}
+		if !hmac.Equal(ac.Authorization.Buffer, auth) {
+			return nil, sessionErr(tpm2.TPMRCAuthFail, i+1)
+		}
+		return a, nil
+	}
+
+	s, ok := t.sessions[ac.Handle]
+	if !ok {
+		return nil, sessionErr(tpm2.TPMRCHandle, i+1)
+	}
+	useAuth := true
+	switch s.kind {
+	case tpm2.TPMSEHMAC:
+		if !withAuth {
+			return nil, tpm2.TPMRCAuthUnavailable
+		}
+	case tpm2.TPMSEPolicy:
+		if len(policy) == 0 || !hmac.Equal(s.policyDigest, policy) {
+			return nil, sessionErr(tpm2.TPMRCPolicyFail, i+1)
+		}
+		if s.pcrCounter != nil && *s.pcrCounter != t.pcrCounter {
+			// The PCRs changed after TPM2_PolicyPCR.
+			return nil, tpm2.TPMRCPCRChanged
+		}
+		useAuth = s.authValueNeeded
+	default:
+		// Trial sessions can't authorize anything.
+		return nil, sessionErr(tpm2.TPMRCAttributes, i+1)
+	}
+
+	key := append([]byte(nil), s.sessionKey...)
+	if useAuth {
+		key = append(key, trimAuth(auth)...)
+	}
+	if s.kind == tpm2.TPMSEHMAC || useAuth {
+		cpHash, err := tpm2.CPHashFromParameters(s.hash, c.cc, toNames(names), c.params)
+		if err != nil {
+			return nil, err
+		}
+		want := computeHMAC(s.hash, key, cpHash.Buffer, ac.Nonce.Buffer, s.nonceTPM, ac.Attributes)
+		if !hmac.Equal(ac.Authorization.Buffer, want) {
+			return nil, sessionErr(tpm2.TPMRCAuthFail, i+1)
+		}
+	}
+	s.nonceCaller = ac.Nonce.Buffer
+	a.key = key
+	return a, nil
+}
+
+// respond returns the response authorization for a, after the command
+// succeeded, and updates or ends its session.
+func (t *TPM) respond(c *command, a *authorization, params []byte) *tpm2.TPMSAuthResponse {
+	if a.handle == tpm2.TPMRSPW {
+		return &tpm2.TPMSAuthResponse{Attributes: tpm2.TPMASession{ContinueSession: true}}
+	}
+	s := t.sessions[a.handle]
+	s.nonceTPM = newNonce(s.hash)
+	attrs := tpm2.TPMASession{ContinueSession: a.attrs.ContinueSession}
+	rpHash, _ := tpm2.RPHashFromParameters(s.hash, tpm2.TPMRCSuccess, c.cc, params)
+	rsp := &tpm2.TPMSAuthResponse{
+		Nonce:      tpm2.TPM2BNonce{Buffer: s.nonceTPM},
+		Attributes: attrs,
+		Authorization: tpm2.TPM2BData{
+			Buffer: computeHMAC(s.hash, a.key, rpHash.Buffer, s.nonceTPM, s.nonceCaller, attrs),
+		},
+	}
+	if !a.attrs.ContinueSession {
+		delete(t.sessions, a.handle)
+	} else if s.kind == tpm2.TPMSEPolicy {
+		s.resetPolicy()
+	}
+	return rsp
+}
+
+// trimAuth removes trailing zeros from an authorization value, as the TPM
+// does before using it as an HMAC key.
+func trimAuth(auth []byte) []byte {
+	return bytes.TrimRight(auth, "\x00")
+}
+
+// computeHMAC computes a command or response authorization HMAC.
+func computeHMAC(alg tpm2.TPMIAlgHash, key, pHash, nonceNewer, nonceOlder []byte, attrs tpm2.TPMASession) []byte {
+	h, _ := alg.Hash()
+	mac := hmac.New(h.New, key)
+	mac.Write(pHash)
+	mac.Write(nonceNewer)
+	mac.Write(nonceOlder)
+	mac.Write(tpm2.Marshal(attrs))
+	return mac.Sum(nil)
+}
+
+func toNames(names [][]byte) []tpm2.TPM2BName {
+	out := make([]tpm2.TPM2BName, len(names))
+	for i, n := range names {
+		out[i] = tpm2.TPM2BName{Buffer: n}
+	}
+	return out
+}
+
+// newNonce returns a random nonce of the size of alg's digests.
+func newNonce(alg tpm2.TPMIAlgHash) []byte {
+	h, _ := alg.Hash()
+	nonce := make([]byte, h.Size())
+	rand.Read(nonce)
+	return nonce
+}
+
+// allocHandle returns an unused handle of type ht.
+func (t *TPM) allocHandle(ht tpm2.TPMHT) tpm2.TPMHandle {
+	t.nextHandle++
+	return tpm2.TPMHandle(uint32(ht)<<24 | t.nextHandle&0xffffff)
+}
+
+// reader reads parameters, remembering the first error.
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.buf) {
+		r.err = tpm2.TPMRCInsufficient
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) u8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) u32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// sized reads a TPM2B and returns its contents.
+func (r *reader) sized() []byte {
+	return r.bytes(int(r.u16()))
+}
+
+// done returns the error for a command whose parameters have all been read,
+// if any.
+func (r *reader) done() error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.buf) != 0 {
+		return tpm2.TPMRCSize
+	}
+	return nil
+}
+
+// read reads a value of a TPM type from r. The tpm2 package doesn't say how
+// much of its input Unmarshal consumed, but TPM encodings are canonical, so
+// that is the length of the value marshalled again.
+func read[T tpm2.Marshallable, P interface {
+	*T
+	tpm2.Unmarshallable
+}](r *reader) *T {
+	var zero T
+	if r.err != nil {
+		return &zero
+	}
+	v, err := tpm2.Unmarshal[T, P](r.buf)
+	if err != nil {
+		r.err = tpm2.TPMRCInsufficient
+		return &zero
+	}
+	n := len(tpm2.Marshal(P(v)))
+	if n > len(r.buf) {
+		r.err = tpm2.TPMRCInsufficient
+		return &zero
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+// marshal concatenates the encodings of values.
+func marshal(values ...tpm2.Marshallable) []byte {
+	var out []byte
+	for _, v := range values {
+		out = append(out, tpm2.Marshal(v)...)
+	}
+	return out
+}
@@ -0,0 +1,503 @@
+package memsim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	testhelper "github.com/google/go-tpm/tpm2/transport/test"
+)
+
+func newTPM(t *testing.T) *TPM {
+	t.Helper()
+	tpm, err := New()
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	t.Cleanup(func() { tpm.Close() })
+	return tpm
+}
+
+func TestMemsim(t *testing.T) {
+	testhelper.RunTest(t, nil, func() (transport.TPMCloser, error) {
+		return New()
+	})
+}
+
+// createSRK creates an ECC storage key in the owner hierarchy.
+func createSRK(t *testing.T, tpm transport.TPM) *tpm2.CreatePrimaryResponse {
+	t.Helper()
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	return rsp
+}
+
+func TestCreatePrimary(t *testing.T) {
+	tpm := newTPM(t)
+	first := createSRK(t, tpm)
+	second := createSRK(t, tpm)
+	if first.ObjectHandle == second.ObjectHandle {
+		t.Errorf("both primary keys have handle %v", first.ObjectHandle)
+	}
+	if !bytes.Equal(first.Name.Buffer, second.Name.Buffer) {
+		t.Errorf("creating the same primary key twice gave names %x and %x", first.Name.Buffer, second.Name.Buffer)
+	}
+
+	rsp, err := tpm2.ReadPublic{ObjectHandle: first.ObjectHandle}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("ReadPublic: %v", err)
+	}
+	if !bytes.Equal(rsp.Name.Buffer, first.Name.Buffer) {
+		t.Errorf("ReadPublic() name = %x, want %x", rsp.Name.Buffer, first.Name.Buffer)
+	}
+
+	if _, err := (tpm2.FlushContext{FlushHandle: first.ObjectHandle}).Execute(tpm); err != nil {
+		t.Fatalf("FlushContext: %v", err)
+	}
+	if _, err := (tpm2.ReadPublic{ObjectHandle: first.ObjectHandle}).Execute(tpm); !errors.Is(err, tpm2.TPMRCHandle) {
+		t.Errorf("ReadPublic() of a flushed object = %v, want %v", err, tpm2.TPMRCHandle)
+	}
+}
+
+func TestSign(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		public tpm2.TPMTPublic
+	}{
+		{
+			name: "ECDSA",
+			public: tpm2.TPMTPublic{
+				Type:    tpm2.TPMAlgECC,
+				NameAlg: tpm2.TPMAlgSHA256,
+				ObjectAttributes: tpm2.TPMAObject{
+					FixedTPM:            true,
+					FixedParent:         true,
+					SensitiveDataOrigin: true,
+					UserWithAuth:        true,
+					SignEncrypt:         true,
+				},
+				Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+					Scheme: tpm2.TPMTECCScheme{
+						Scheme:  tpm2.TPMAlgECDSA,
+						Details: tpm2.NewTPMUAsymScheme(tpm2.TPMAlgECDSA, &tpm2.TPMSSigSchemeECDSA{HashAlg: tpm2.TPMAlgSHA256}),
+					},
+					CurveID: tpm2.TPMECCNistP256,
+				}),
+			},
+		},
+		{
+			name: "RSASSA",
+			public: tpm2.TPMTPublic{
+				Type:    tpm2.TPMAlgRSA,
+				NameAlg: tpm2.TPMAlgSHA256,
+				ObjectAttributes: tpm2.TPMAObject{
+					FixedTPM:            true,
+					FixedParent:         true,
+					SensitiveDataOrigin: true,
+					UserWithAuth:        true,
+					SignEncrypt:         true,
+				},
+				Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgRSA, &tpm2.TPMSRSAParms{
+					Scheme: tpm2.TPMTRSAScheme{
+						Scheme:  tpm2.TPMAlgRSASSA,
+						Details: tpm2.NewTPMUAsymScheme(tpm2.TPMAlgRSASSA, &tpm2.TPMSSigSchemeRSASSA{HashAlg: tpm2.TPMAlgSHA256}),
+					},
+					KeyBits: 2048,
+				}),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tpm := newTPM(t)
+			srk := createSRK(t, tpm)
+			auth := []byte("key password")
+			parent := tpm2.AuthHandle{
+				Handle: srk.ObjectHandle,
+				Name:   srk.Name,
+				Auth:   tpm2.HMAC(tpm2.TPMAlgSHA256, 16),
+			}
+			created, err := tpm2.Create{
+				ParentHandle: parent,
+				InSensitive: tpm2.TPM2BSensitiveCreate{
+					Sensitive: &tpm2.TPMSSensitiveCreate{UserAuth: tpm2.TPM2BAuth{Buffer: auth}},
+				},
+				InPublic: tpm2.New2B(tc.public),
+			}.Execute(tpm)
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			loaded, err := tpm2.Load{
+				ParentHandle: parent,
+				InPrivate:    created.OutPrivate,
+				InPublic:     created.OutPublic,
+			}.Execute(tpm)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			digest := sha256.Sum256([]byte("message"))
+			sign := tpm2.Sign{
+				KeyHandle: tpm2.AuthHandle{
+					Handle: loaded.ObjectHandle,
+					Name:   loaded.Name,
+					Auth:   tpm2.HMAC(tpm2.TPMAlgSHA256, 16, tpm2.Auth(auth)),
+				},
+				Digest:     tpm2.TPM2BDigest{Buffer: digest[:]},
+				Validation: tpm2.TPMTTKHashCheck{Tag: tpm2.TPMSTHashCheck},
+			}
+			rsp, err := sign.Execute(tpm)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			pub, err := created.OutPublic.Contents()
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := verify(pub, digest[:], &rsp.Signature); err != nil {
+				t.Errorf("signature doesn't verify: %v", err)
+			}
+
+			sign.KeyHandle = tpm2.AuthHandle{
+				Handle: loaded.ObjectHandle,
+				Name:   loaded.Name,
+				Auth:   tpm2.PasswordAuth([]byte("wrong")),
+			}
+			if _, err := sign.Execute(tpm); !errors.Is(err, tpm2.TPMRCAuthFail) {
+				t.Errorf("Sign() with the wrong password = %v, want %v", err, tpm2.TPMRCAuthFail)
+			}
+		})
+	}
+}
+
+// verify checks a signature made by the key whose public area is pub.
+func verify(pub *tpm2.TPMTPublic, digest []byte, sig *tpm2.TPMTSignature) error {
+	switch pub.Type {
+	case tpm2.TPMAlgECC:
+		unique, err := pub.Unique.ECC()
+		if err != nil {
+			return err
+		}
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(unique.X.Buffer),
+			Y:     new(big.Int).SetBytes(unique.Y.Buffer),
+		}
+		s, err := sig.Signature.ECDSA()
+		if err != nil {
+			return err
+		}
+		r := new(big.Int).SetBytes(s.SignatureR.Buffer)
+		ss := new(big.Int).SetBytes(s.SignatureS.Buffer)
+		if !ecdsa.Verify(key, digest, r, ss) {
+			return errors.New("invalid ECDSA signature")
+		}
+		return nil
+	default:
+		parms, _ := pub.Parameters.RSADetail()
+		unique, _ := pub.Unique.RSA()
+		key, err := tpm2.RSAPub(parms, unique)
+		if err != nil {
+			return err
+		}
+		s, err := sig.Signature.RSASSA()
+		if err != nil {
+			return err
+		}
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, s.Sig.Buffer)
+	}
+}
+
+func TestSealPolicy(t *testing.T) {
+	tpm := newTPM(t)
+	srk := createSRK(t, tpm)
+
+	sel := tpm2.TPMLPCRSelection{
+		PCRSelections: []tpm2.TPMSPCRSelection{{Hash: tpm2.TPMAlgSHA256, PCRSelect: []byte{0x80, 0, 0}}},
+	}
+	policy := func(tpm transport.TPM, handle tpm2.TPMISHPolicy, _ tpm2.TPM2BNonce) error {
+		if _, err := (tpm2.PolicyPCR{PolicySession: handle, Pcrs: sel}).Execute(tpm); err != nil {
+			return err
+		}
+		_, err := tpm2.PolicyAuthValue{PolicySession: handle}.Execute(tpm)
+		return err
+	}
+
+	trial, closeTrial, err := tpm2.PolicySession(tpm, tpm2.TPMAlgSHA256, 16, tpm2.Trial())
+	if err != nil {
+		t.Fatalf("PolicySession: %v", err)
+	}
+	if err := policy(tpm, trial.Handle(), trial.NonceTPM()); err != nil {
+		t.Fatalf("%v", err)
+	}
+	digest, err := tpm2.PolicyGetDigest{PolicySession: trial.Handle()}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("PolicyGetDigest: %v", err)
+	}
+	if err := closeTrial(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	auth := []byte("p@ssw0rd")
+	secret := []byte("secret")
+	parent := tpm2.NamedHandle{Handle: srk.ObjectHandle, Name: srk.Name}
+	created, err := tpm2.Create{
+		ParentHandle: parent,
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				UserAuth: tpm2.TPM2BAuth{Buffer: auth},
+				Data:     tpm2.NewTPMUSensitiveCreate(&tpm2.TPM2BSensitiveData{Buffer: secret}),
+			},
+		},
+		InPublic: tpm2.New2B(tpm2.TPMTPublic{
+			Type:             tpm2.TPMAlgKeyedHash,
+			NameAlg:          tpm2.TPMAlgSHA256,
+			ObjectAttributes: tpm2.TPMAObject{FixedTPM: true, FixedParent: true},
+			AuthPolicy:       digest.PolicyDigest,
+		}),
+	}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	loaded, err := tpm2.Load{
+		ParentHandle: parent,
+		InPrivate:    created.OutPrivate,
+		InPublic:     created.OutPublic,
+	}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	unseal := func(s tpm2.Session) (*tpm2.UnsealResponse, error) {
+		return tpm2.Unseal{
+			ItemHandle: tpm2.AuthHandle{Handle: loaded.ObjectHandle, Name: loaded.Name, Auth: s},
+		}.Execute(tpm)
+	}
+	rsp, err := unseal(tpm2.Policy(tpm2.TPMAlgSHA256, 16, policy, tpm2.Auth(auth)))
+	if err != nil {
+		t.Fatalf("Unseal: %v", err)
+	}
+	if !bytes.Equal(rsp.OutData.Buffer, secret) {
+		t.Errorf("Unseal() = %q, want %q", rsp.OutData.Buffer, secret)
+	}
+
+	// The object has no user role authorization.
+	if _, err := unseal(tpm2.PasswordAuth(auth)); !errors.Is(err, tpm2.TPMRCAuthUnavailable) {
+		t.Errorf("Unseal() with a password = %v, want %v", err, tpm2.TPMRCAuthUnavailable)
+	}
+	if _, err := unseal(tpm2.Policy(tpm2.TPMAlgSHA256, 16, policy, tpm2.Auth([]byte("wrong")))); !errors.Is(err, tpm2.TPMRCAuthFail) {
+		t.Errorf("Unseal() with the wrong password = %v, want %v", err, tpm2.TPMRCAuthFail)
+	}
+
+	// Changing the PCR changes the policy digest.
+	if _, err := (tpm2.PCRExtend{
+		PCRHandle: tpm2.AuthHandle{Handle: 7, Auth: tpm2.PasswordAuth(nil)},
+		Digests: tpm2.TPMLDigestValues{
+			Digests: []tpm2.TPMTHA{{HashAlg: tpm2.TPMAlgSHA256, Digest: make([]byte, 32)}},
+		},
+	}).Execute(tpm); err != nil {
+		t.Fatalf("PCRExtend: %v", err)
+	}
+	if _, err := unseal(tpm2.Policy(tpm2.TPMAlgSHA256, 16, policy, tpm2.Auth(auth))); !errors.Is(err, tpm2.TPMRCPolicyFail) {
+		t.Errorf("Unseal() after extending the PCR = %v, want %v", err, tpm2.TPMRCPolicyFail)
+	}
+}
+
+func TestPCRs(t *testing.T) {
+	tpm := newTPM(t)
+	digest := sha256.Sum256([]byte("event"))
+	if _, err := (tpm2.PCRExtend{
+		PCRHandle: tpm2.AuthHandle{Handle: 16, Auth: tpm2.PasswordAuth(nil)},
+		Digests: tpm2.TPMLDigestValues{
+			Digests: []tpm2.TPMTHA{{HashAlg: tpm2.TPMAlgSHA256, Digest: digest[:]}},
+		},
+	}).Execute(tpm); err != nil {
+		t.Fatalf("PCRExtend: %v", err)
+	}
+	want := sha256.Sum256(append(make([]byte, 32), digest[:]...))
+
+	read := func() *tpm2.PCRReadResponse {
+		t.Helper()
+		rsp, err := tpm2.PCRRead{
+			PCRSelectionIn: tpm2.TPMLPCRSelection{
+				PCRSelections: []tpm2.TPMSPCRSelection{{Hash: tpm2.TPMAlgSHA256, PCRSelect: []byte{0, 0, 1}}},
+			},
+		}.Execute(tpm)
+		if err != nil {
+			t.Fatalf("PCRRead: %v", err)
+		}
+		if len(rsp.PCRValues.Digests) != 1 {
+			t.Fatalf("PCRRead() returned %d values, want 1", len(rsp.PCRValues.Digests))
+		}
+		return rsp
+	}
+	rsp := read()
+	if got := rsp.PCRValues.Digests[0].Buffer; !bytes.Equal(got, want[:]) {
+		t.Errorf("PCR 16 = %x, want %x", got, want)
+	}
+	if rsp.PCRUpdateCounter != 1 {
+		t.Errorf("PCR update counter = %v, want 1", rsp.PCRUpdateCounter)
+	}
+
+	if _, err := (tpm2.PCRReset{
+		PCRHandle: tpm2.AuthHandle{Handle: 16, Auth: tpm2.PasswordAuth(nil)},
+	}).Execute(tpm); err != nil {
+		t.Fatalf("PCRReset: %v", err)
+	}
+	if got := read().PCRValues.Digests[0].Buffer; !bytes.Equal(got, make([]byte, 32)) {
+		t.Errorf("PCR 16 after reset = %x, want zeros", got)
+	}
+	if _, err := (tpm2.PCRReset{
+		PCRHandle: tpm2.AuthHandle{Handle: 0, Auth: tpm2.PasswordAuth(nil)},
+	}).Execute(tpm); !errors.Is(err, tpm2.TPMRCLocality) {
+		t.Errorf("PCRReset(0) = %v, want %v", err, tpm2.TPMRCLocality)
+	}
+}
+
+func TestNV(t *testing.T) {
+	tpm := newTPM(t)
+	define := func(index tpm2.TPMHandle, attrs tpm2.TPMANV, size uint16) tpm2.NamedHandle {
+		t.Helper()
+		pub := tpm2.TPMSNVPublic{
+			NVIndex:    index,
+			NameAlg:    tpm2.TPMAlgSHA256,
+			Attributes: attrs,
+			DataSize:   size,
+		}
+		if _, err := (tpm2.NVDefineSpace{
+			AuthHandle: tpm2.TPMRHOwner,
+			PublicInfo: tpm2.New2B(pub),
+		}).Execute(tpm); err != nil {
+			t.Fatalf("NVDefineSpace: %v", err)
+		}
+		rsp, err := tpm2.NVReadPublic{NVIndex: index}.Execute(tpm)
+		if err != nil {
+			t.Fatalf("NVReadPublic: %v", err)
+		}
+		return tpm2.NamedHandle{Handle: index, Name: rsp.NVName}
+	}
+
+	data := define(0x01000001, tpm2.TPMANV{OwnerRead: true, OwnerWrite: true, NT: tpm2.TPMNTOrdinary}, 16)
+	owner := tpm2.AuthHandle{Handle: tpm2.TPMRHOwner, Auth: tpm2.HMAC(tpm2.TPMAlgSHA256, 16)}
+	if _, err := (tpm2.NVRead{AuthHandle: owner, NVIndex: data, Size: 16}).Execute(tpm); !errors.Is(err, tpm2.TPMRCNVUninitialized) {
+		t.Errorf("NVRead() before NVWrite = %v, want %v", err, tpm2.TPMRCNVUninitialized)
+	}
+	if _, err := (tpm2.NVWrite{
+		AuthHandle: owner,
+		NVIndex:    data,
+		Data:       tpm2.TPM2BMaxNVBuffer{Buffer: []byte("hello")},
+		Offset:     2,
+	}).Execute(tpm); err != nil {
+		t.Fatalf("NVWrite: %v", err)
+	}
+	// Writing the index changed its name.
+	pub, err := tpm2.NVReadPublic{NVIndex: data.Handle}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("NVReadPublic: %v", err)
+	}
+	data.Name = pub.NVName
+	rsp, err := tpm2.NVRead{AuthHandle: owner, NVIndex: data, Size: 8}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("NVRead: %v", err)
+	}
+	if want := []byte("\xff\xffhello\xff"); !bytes.Equal(rsp.Data.Buffer, want) {
+		t.Errorf("NVRead() = %q, want %q", rsp.Data.Buffer, want)
+	}
+	if _, err := (tpm2.NVRead{AuthHandle: owner, NVIndex: data, Size: 8, Offset: 12}).Execute(tpm); !errors.Is(err, tpm2.TPMRCNVRange) {
+		t.Errorf("NVRead() past the end = %v, want %v", err, tpm2.TPMRCNVRange)
+	}
+	indexAuth := tpm2.AuthHandle{Handle: data.Handle, Name: data.Name, Auth: tpm2.PasswordAuth(nil)}
+	if _, err := (tpm2.NVRead{AuthHandle: indexAuth, NVIndex: data, Size: 8}).Execute(tpm); !errors.Is(err, tpm2.TPMRCNVAuthorization) {
+		t.Errorf("NVRead() with the index's authorization = %v, want %v", err, tpm2.TPMRCNVAuthorization)
+	}
+
+	counter := define(0x01000002, tpm2.TPMANV{AuthRead: true, AuthWrite: true, NT: tpm2.TPMNTCounter}, 8)
+	// counterAuth authorizes with the counter's current name.
+	counterAuth := func() (tpm2.AuthHandle, tpm2.NamedHandle) {
+		t.Helper()
+		pub, err := tpm2.NVReadPublic{NVIndex: counter.Handle}.Execute(tpm)
+		if err != nil {
+			t.Fatalf("NVReadPublic: %v", err)
+		}
+		return tpm2.AuthHandle{Handle: counter.Handle, Name: pub.NVName, Auth: tpm2.PasswordAuth(nil)},
+			tpm2.NamedHandle{Handle: counter.Handle, Name: pub.NVName}
+	}
+	for i := 0; i < 3; i++ {
+		auth, index := counterAuth()
+		if _, err := (tpm2.NVIncrement{AuthHandle: auth, NVIndex: index}).Execute(tpm); err != nil {
+			t.Fatalf("NVIncrement: %v", err)
+		}
+	}
+	auth, index := counterAuth()
+	rsp, err = tpm2.NVRead{AuthHandle: auth, NVIndex: index, Size: 8}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("NVRead: %v", err)
+	}
+	if got := binary.BigEndian.Uint64(rsp.Data.Buffer); got != 3 {
+		t.Errorf("counter = %v, want 3", got)
+	}
+
+	handles, err := tpm2.GetHandles(tpm, tpm2.TPMHTNVIndex)
+	if err != nil {
+		t.Fatalf("GetHandles: %v", err)
+	}
+	if len(handles) != 2 || handles[0] != data.Handle || handles[1] != counter.Handle {
+		t.Errorf("GetHandles() = %v, want [%v %v]", handles, data.Handle, counter.Handle)
+	}
+	if _, err := (tpm2.NVUndefineSpace{AuthHandle: tpm2.TPMRHOwner, NVIndex: data}).Execute(tpm); err != nil {
+		t.Fatalf("NVUndefineSpace: %v", err)
+	}
+}
+
+func TestStartupShutdown(t *testing.T) {
+	tpm := newTPM(t)
+	if _, err := (tpm2.Startup{StartupType: tpm2.TPMSUClear}).Execute(tpm); !errors.Is(err, tpm2.TPMRCInitialize) {
+		t.Errorf("Startup() of a started TPM = %v, want %v", err, tpm2.TPMRCInitialize)
+	}
+	srk := createSRK(t, tpm)
+	if _, err := (tpm2.Shutdown{ShutdownType: tpm2.TPMSUClear}).Execute(tpm); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(tpm); !errors.Is(err, tpm2.TPMRCInitialize) {
+		t.Errorf("GetRandom() after Shutdown = %v, want %v", err, tpm2.TPMRCInitialize)
+	}
+	if _, err := (tpm2.Startup{StartupType: tpm2.TPMSUClear}).Execute(tpm); err != nil {
+		t.Fatalf("Startup: %v", err)
+	}
+	if _, err := (tpm2.ReadPublic{ObjectHandle: srk.ObjectHandle}).Execute(tpm); !errors.Is(err, tpm2.TPMRCHandle) {
+		t.Errorf("ReadPublic() after a restart = %v, want %v", err, tpm2.TPMRCHandle)
+	}
+	// The primary key is the same after the restart.
+	if again := createSRK(t, tpm); !bytes.Equal(again.Name.Buffer, srk.Name.Buffer) {
+		t.Errorf("SRK name after a restart = %x, want %x", again.Name.Buffer, srk.Name.Buffer)
+	}
+
+	if err := tpm.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := tpm.Send(nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Send() after Close = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestUnsupportedCommand(t *testing.T) {
+	tpm := newTPM(t)
+	if _, err := (tpm2.Clear{
+		AuthHandle: tpm2.AuthHandle{Handle: tpm2.TPMRHLockout, Auth: tpm2.PasswordAuth(nil)},
+	}).Execute(tpm); !errors.Is(err, tpm2.TPMRCCommandCode) {
+		t.Errorf("Clear() = %v, want %v", err, tpm2.TPMRCCommandCode)
+	}
+}
@@ -0,0 +1,212 @@
+package memsim
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// nvIndex is a defined NV index.
+type nvIndex struct {
+	public tpm2.TPMSNVPublic
+	auth   []byte
+	data   []byte
+}
+
+// name returns the index's name, which changes when it is first written.
+func (nv *nvIndex) name() []byte {
+	name, _ := tpm2.NVName(&nv.public)
+	return name.Buffer
+}
+
+func (t *TPM) nvDefineSpace(c *command, r *reader) (*response, error) {
+	auth := r.sized()
+	info := read[tpm2.TPM2BNVPublic](r)
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	hierarchy := c.handles[0]
+	if hierarchy != tpm2.TPMRHOwner && hierarchy != tpm2.TPMRHPlatform {
+		return nil, handleErr(tpm2.TPMRCHierarchy, 1)
+	}
+	pub, err := info.Contents()
+	if err != nil {
+		return nil, paramErr(tpm2.TPMRCInsufficient, 2)
+	}
+	h, err := pub.NameAlg.Hash()
+	if err != nil {
+		return nil, paramErr(tpm2.TPMRCHash, 2)
+	}
+	if len(auth) > h.Size() {
+		return nil, paramErr(tpm2.TPMRCSize, 1)
+	}
+	if pub.NVIndex>>24 != tpm2.TPMHandle(tpm2.TPMHTNVIndex) {
+		return nil, paramErr(tpm2.TPMRCNVRange, 2)
+	}
+
+	a := pub.Attributes
+	switch {
+	case a.PlatformCreate != (hierarchy == tpm2.TPMRHPlatform),
+		a.Written, a.ReadLocked, a.WriteLocked,
+		!(a.PPRead || a.OwnerRead || a.AuthRead || a.PolicyRead),
+		!(a.PPWrite || a.OwnerWrite || a.AuthWrite || a.PolicyWrite):
+		return nil, paramErr(tpm2.TPMRCAttributes, 2)
+	}
+	switch a.NT {
+	case tpm2.TPMNTOrdinary:
+		if pub.DataSize > maxNVIndexSize {
+			return nil, paramErr(tpm2.TPMRCSize, 2)
+		}
+	case tpm2.TPMNTCounter:
+		if pub.DataSize != 8 {
+			return nil, paramErr(tpm2.TPMRCSize, 2)
+		}
+	default:
+		return nil, paramErr(tpm2.TPMRCAttributes, 2)
+	}
+	if _, ok := t.nv[pub.NVIndex]; ok {
+		return nil, tpm2.TPMRCNVDefined
+	}
+	if len(t.nv) >= maxNVIndices {
+		return nil, tpm2.TPMRCNVSpace
+	}
+	t.nv[pub.NVIndex] = &nvIndex{
+		public: *pub,
+		auth:   bytes.Clone(auth),
+		data:   bytes.Repeat([]byte{0xff}, int(pub.DataSize)),
+	}
+	return &response{}, nil
+}
+
+func (t *TPM) nvUndefineSpace(c *command, r *reader) (*response, error) {
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	hierarchy := c.handles[0]
+	nv, ok := t.nv[c.handles[1]]
+	if !ok {
+		return nil, handleErr(tpm2.TPMRCHandle, 2)
+	}
+	if hierarchy != tpm2.TPMRHOwner && hierarchy != tpm2.TPMRHPlatform {
+		return nil, handleErr(tpm2.TPMRCHierarchy, 1)
+	}
+	a := nv.public.Attributes
+	if a.PolicyDelete || a.PlatformCreate != (hierarchy == tpm2.TPMRHPlatform) {
+		return nil, handleErr(tpm2.TPMRCAttributes, 2)
+	}
+	delete(t.nv, c.handles[1])
+	return &response{}, nil
+}
+
+func (t *TPM) nvReadPublic(c *command, r *reader) (*response, error) {
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	nv, ok := t.nv[c.handles[0]]
+	if !ok {
+		return nil, handleErr(tpm2.TPMRCHandle, 1)
+	}
+	return &response{
+		params: marshal(tpm2.New2B(nv.public), tpm2.TPM2BName{Buffer: nv.name()}),
+	}, nil
+}
+
+// nvAccess returns the index that c reads or writes, after checking that
+// the entity that authorized c may do so.
+func (t *TPM) nvAccess(c *command, write bool) (*nvIndex, error) {
+	nv, ok := t.nv[c.handles[1]]
+	if !ok {
+		return nil, handleErr(tpm2.TPMRCHandle, 2)
+	}
+	a := nv.public.Attributes
+	var allowed bool
+	switch c.handles[0] {
+	case tpm2.TPMRHOwner:
+		allowed = write && a.OwnerWrite || !write && a.OwnerRead
+	case tpm2.TPMRHPlatform:
+		allowed = write && a.PPWrite || !write && a.PPRead
+	case c.handles[1]:
+		if s, ok := t.sessions[c.auths[0].Handle]; ok && s.kind == tpm2.TPMSEPolicy {
+			allowed = write && a.PolicyWrite || !write && a.PolicyRead
+		} else {
+			allowed = write && a.AuthWrite || !write && a.AuthRead
+		}
+	}
+	if !allowed {
+		return nil, tpm2.TPMRCNVAuthorization
+	}
+	return nv, nil
+}
+
+func (t *TPM) nvWrite(c *command, r *reader) (*response, error) {
+	data := r.sized()
+	offset := int(r.u16())
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	nv, err := t.nvAccess(c, true)
+	if err != nil {
+		return nil, err
+	}
+	a := nv.public.Attributes
+	if a.NT != tpm2.TPMNTOrdinary {
+		return nil, tpm2.TPMRCAttributes
+	}
+	if len(data) > maxNVBuffer {
+		return nil, paramErr(tpm2.TPMRCValue, 1)
+	}
+	if offset+len(data) > len(nv.data) ||
+		a.WriteAll && (offset != 0 || len(data) != len(nv.data)) {
+		return nil, tpm2.TPMRCNVRange
+	}
+	copy(nv.data[offset:], data)
+	nv.public.Attributes.Written = true
+	return &response{}, nil
+}
+
+func (t *TPM) nvRead(c *command, r *reader) (*response, error) {
+	size := int(r.u16())
+	offset := int(r.u16())
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	nv, err := t.nvAccess(c, false)
+	if err != nil {
+		return nil, err
+	}
+	if !nv.public.Attributes.Written {
+		return nil, tpm2.TPMRCNVUninitialized
+	}
+	if size > maxNVBuffer {
+		return nil, paramErr(tpm2.TPMRCValue, 1)
+	}
+	if offset+size > len(nv.data) {
+		return nil, tpm2.TPMRCNVRange
+	}
+	return &response{
+		params: marshal(tpm2.TPM2BMaxNVBuffer{Buffer: nv.data[offset : offset+size]}),
+	}, nil
+}
+
+func (t *TPM) nvIncrement(c *command, r *reader) (*response, error) {
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	nv, err := t.nvAccess(c, true)
+	if err != nil {
+		return nil, err
+	}
+	if nv.public.Attributes.NT != tpm2.TPMNTCounter {
+		return nil, tpm2.TPMRCAttributes
+	}
+	// A counter starts at zero. A TPM starts it at the highest value any
+	// counter has had, which tests shouldn't depend on.
+	var count uint64
+	if nv.public.Attributes.Written {
+		count = binary.BigEndian.Uint64(nv.data)
+	}
+	binary.BigEndian.PutUint64(nv.data, count+1)
+	nv.public.Attributes.Written = true
+	return &response{}, nil
+}
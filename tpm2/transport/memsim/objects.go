@@ -0,0 +1,526 @@
+package memsim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// object is a loaded object.
+type object struct {
+	public        tpm2.TPMTPublic
+	name          []byte
+	qualifiedName []byte
+	auth          []byte
+	// key is the private key of an RSA or ECC object.
+	key crypto.Signer
+	// data is the sealed data of a keyed hash object.
+	data []byte
+}
+
+// isStorageParent reports whether o can be the parent of other objects.
+func (o *object) isStorageParent() bool {
+	a := o.public.ObjectAttributes
+	return a.Restricted && a.Decrypt && !a.SignEncrypt && o.public.Type != tpm2.TPMAlgKeyedHash
+}
+
+// sensitiveCreate reads a TPM2B_SENSITIVE_CREATE and returns the object's
+// authorization value and data.
+func sensitiveCreate(r *reader) (auth, data []byte) {
+	s := &reader{buf: r.sized()}
+	auth = s.sized()
+	data = s.sized()
+	if s.err != nil || len(s.buf) != 0 {
+		r.err = tpm2.TPMRCSize
+	}
+	return auth, data
+}
+
+// newObject generates the key of an object described by pub, or seals data
+// in it, and returns it with its unique field filled in. key, if not nil,
+// is used instead of generating a new key.
+func newObject(pub *tpm2.TPMTPublic, auth, data []byte, key any) (*object, error) {
+	a := pub.ObjectAttributes
+	nameHash, err := pub.NameAlg.Hash()
+	if err != nil {
+		return nil, paramErr(tpm2.TPMRCHash, 2)
+	}
+	if len(auth) > nameHash.Size() {
+		return nil, paramErr(tpm2.TPMRCSize, 1)
+	}
+	if a.SensitiveDataOrigin == (len(data) != 0) && pub.Type == tpm2.TPMAlgKeyedHash ||
+		len(data) != 0 && pub.Type != tpm2.TPMAlgKeyedHash {
+		return nil, paramErr(tpm2.TPMRCAttributes, 2)
+	}
+	if a.Restricted && a.SignEncrypt && a.Decrypt {
+		return nil, paramErr(tpm2.TPMRCAttributes, 2)
+	}
+	o := &object{public: *pub, auth: auth}
+
+	switch pub.Type {
+	case tpm2.TPMAlgECC:
+		parms, err := pub.Parameters.ECCDetail()
+		if err != nil {
+			return nil, paramErr(tpm2.TPMRCType, 2)
+		}
+		curve, ok := map[tpm2.TPMECCCurve]elliptic.Curve{
+			tpm2.TPMECCNistP256: elliptic.P256(),
+			tpm2.TPMECCNistP384: elliptic.P384(),
+			tpm2.TPMECCNistP521: elliptic.P521(),
+		}[parms.CurveID]
+		if !ok {
+			return nil, paramErr(tpm2.TPMRCCurve, 2)
+		}
+		priv, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			if priv, err = ecdsa.GenerateKey(curve, rand.Reader); err != nil {
+				return nil, err
+			}
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		o.public.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgECC, &tpm2.TPMSECCPoint{
+			X: tpm2.TPM2BECCParameter{Buffer: priv.X.FillBytes(make([]byte, size))},
+			Y: tpm2.TPM2BECCParameter{Buffer: priv.Y.FillBytes(make([]byte, size))},
+		})
+		o.key = priv
+	case tpm2.TPMAlgRSA:
+		parms, err := pub.Parameters.RSADetail()
+		if err != nil {
+			return nil, paramErr(tpm2.TPMRCType, 2)
+		}
+		if parms.KeyBits < 1024 || parms.KeyBits > 4096 || parms.KeyBits%1024 != 0 {
+			return nil, paramErr(tpm2.TPMRCKeySize, 2)
+		}
+		if parms.Exponent != 0 && parms.Exponent != 65537 {
+			return nil, paramErr(tpm2.TPMRCValue, 2)
+		}
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			if priv, err = rsa.GenerateKey(rand.Reader, int(parms.KeyBits)); err != nil {
+				return nil, err
+			}
+		}
+		o.public.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgRSA, &tpm2.TPM2BPublicKeyRSA{Buffer: priv.N.Bytes()})
+		o.key = priv
+	case tpm2.TPMAlgKeyedHash:
+		if a.SignEncrypt || a.Decrypt {
+			// HMAC and XOR keys are not supported, only sealed data.
+			return nil, paramErr(tpm2.TPMRCAttributes, 2)
+		}
+		if len(data) > 128 {
+			return nil, paramErr(tpm2.TPMRCSize, 1)
+		}
+		// The unique field is a digest of the data and a random value,
+		// which stops it from revealing the data.
+		obfuscation := make([]byte, nameHash.Size())
+		rand.Read(obfuscation)
+		d := nameHash.New()
+		d.Write(obfuscation)
+		d.Write(data)
+		o.public.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgKeyedHash, &tpm2.TPM2BDigest{Buffer: d.Sum(nil)})
+		o.data = data
+	default:
+		return nil, paramErr(tpm2.TPMRCType, 2)
+	}
+
+	name, err := tpm2.ObjectName(&o.public)
+	if err != nil {
+		return nil, err
+	}
+	o.name = name.Buffer
+	return o, nil
+}
+
+// qualify sets o's qualified name, given its parent's.
+func (o *object) qualify(parentQN []byte) {
+	h, _ := o.public.NameAlg.Hash()
+	d := h.New()
+	d.Write(parentQN)
+	d.Write(o.name)
+	o.qualifiedName = d.Sum(binary.BigEndian.AppendUint16(nil, uint16(o.public.NameAlg)))
+}
+
+// loadObject makes o a loaded object and returns its handle.
+func (t *TPM) loadObject(o *object) (tpm2.TPMHandle, error) {
+	if len(t.objects) >= maxObjects {
+		return 0, tpm2.TPMRCObjectMemory
+	}
+	h := t.allocHandle(tpm2.TPMHTTransient)
+	t.objects[h] = o
+	return h, nil
+}
+
+// creation returns the creation data of an object, its digest and the
+// creation ticket. A primary object's parent name algorithm is NULL.
+func (t *TPM) creation(o *object, parentNameAlg tpm2.TPMIAlgHash, parentName, parentQN, outsideInfo []byte, sel *tpm2.TPMLPCRSelection) ([]byte, error) {
+	values, err := t.selectedPCRs(sel)
+	if err != nil {
+		return nil, paramErr(err.(tpm2.TPMRC), 5)
+	}
+	h, _ := o.public.NameAlg.Hash()
+	d := h.New()
+	for _, v := range values {
+		d.Write(v)
+	}
+	data := tpm2.New2B(tpm2.TPMSCreationData{
+		PCRSelect:           *sel,
+		PCRDigest:           tpm2.TPM2BDigest{Buffer: d.Sum(nil)},
+		ParentNameAlg:       parentNameAlg,
+		ParentName:          tpm2.TPM2BName{Buffer: parentName},
+		ParentQualifiedName: tpm2.TPM2BName{Buffer: parentQN},
+		OutsideInfo:         tpm2.TPM2BData{Buffer: outsideInfo},
+	})
+	sum := h.New()
+	sum.Write(data.Bytes())
+	// The simulator doesn't issue tickets, so the creation ticket is a
+	// NULL ticket.
+	return marshal(
+		data,
+		tpm2.TPM2BDigest{Buffer: sum.Sum(nil)},
+		tpm2.TPMTTKCreation{Tag: tpm2.TPMSTCreation, Hierarchy: tpm2.TPMRHNull},
+	), nil
+}
+
+func (t *TPM) createPrimary(c *command, r *reader) (*response, error) {
+	auth, data := sensitiveCreate(r)
+	pub := read[tpm2.TPM2BPublic](r)
+	outsideInfo := r.sized()
+	sel := read[tpm2.TPMLPCRSelection](r)
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	hierarchy := c.handles[0]
+	switch hierarchy {
+	case tpm2.TPMRHOwner, tpm2.TPMRHEndorsement, tpm2.TPMRHPlatform, tpm2.TPMRHNull:
+	default:
+		return nil, handleErr(tpm2.TPMRCHierarchy, 1)
+	}
+	template, err := pub.Contents()
+	if err != nil {
+		return nil, paramErr(tpm2.TPMRCInsufficient, 2)
+	}
+
+	// The same template in the same hierarchy gives the same key.
+	cacheKey := string(binary.BigEndian.AppendUint32(nil, uint32(hierarchy))) + string(pub.Bytes()) + string(data)
+	o, err := newObject(template, auth, data, t.primaries[cacheKey])
+	if err != nil {
+		return nil, err
+	}
+	if o.key != nil && hierarchy != tpm2.TPMRHNull {
+		t.primaries[cacheKey] = o.key
+	}
+	hierarchyName := binary.BigEndian.AppendUint32(nil, uint32(hierarchy))
+	o.qualify(hierarchyName)
+	creation, err := t.creation(o, tpm2.TPMAlgNull, hierarchyName, hierarchyName, outsideInfo, sel)
+	if err != nil {
+		return nil, err
+	}
+	h, err := t.loadObject(o)
+	if err != nil {
+		return nil, err
+	}
+	return &response{
+		handles: []tpm2.TPMHandle{h},
+		params: append(append(marshal(tpm2.New2B(o.public)), creation...),
+			marshal(tpm2.TPM2BName{Buffer: o.name})...),
+	}, nil
+}
+
+// parent returns the storage parent at handle h.
+func (t *TPM) parent(h tpm2.TPMHandle) (*object, error) {
+	o, ok := t.objects[h]
+	if !ok || !o.isStorageParent() {
+		return nil, handleErr(tpm2.TPMRCType, 1)
+	}
+	return o, nil
+}
+
+func (t *TPM) create(c *command, r *reader) (*response, error) {
+	auth, data := sensitiveCreate(r)
+	pub := read[tpm2.TPM2BPublic](r)
+	outsideInfo := r.sized()
+	sel := read[tpm2.TPMLPCRSelection](r)
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	parent, err := t.parent(c.handles[0])
+	if err != nil {
+		return nil, err
+	}
+	template, err := pub.Contents()
+	if err != nil {
+		return nil, paramErr(tpm2.TPMRCInsufficient, 2)
+	}
+	o, err := newObject(template, auth, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	private, err := t.seal(o, parent)
+	if err != nil {
+		return nil, err
+	}
+	o.qualify(parent.qualifiedName)
+	creation, err := t.creation(o, parent.public.NameAlg, parent.name, parent.qualifiedName, outsideInfo, sel)
+	if err != nil {
+		return nil, err
+	}
+	return &response{
+		params: append(marshal(tpm2.TPM2BPrivate{Buffer: private}, tpm2.New2B(o.public)), creation...),
+	}, nil
+}
+
+// seal encodes and encrypts o's sensitive area, binding it to o's public
+// area and to its parent.
+func (t *TPM) seal(o *object, parent *object) ([]byte, error) {
+	var key []byte
+	if o.key != nil {
+		var err error
+		if key, err = x509.MarshalPKCS8PrivateKey(o.key); err != nil {
+			return nil, err
+		}
+	}
+	sensitive := marshal(
+		tpm2.TPM2BAuth{Buffer: o.auth},
+		tpm2.TPM2BSensitiveData{Buffer: o.data},
+	)
+	sensitive = append(binary.BigEndian.AppendUint16(sensitive, uint16(len(key))), key...)
+	nonce := make([]byte, t.blobKey.NonceSize())
+	rand.Read(nonce)
+	return t.blobKey.Seal(nonce, nonce, sensitive, append(parent.name, o.name...)), nil
+}
+
+// unsealObject decrypts a private area made by seal.
+func (t *TPM) unsealObject(private []byte, pub *tpm2.TPMTPublic, parent *object) (*object, error) {
+	name, err := tpm2.ObjectName(pub)
+	if err != nil {
+		return nil, paramErr(tpm2.TPMRCHash, 2)
+	}
+	n := t.blobKey.NonceSize()
+	if len(private) < n {
+		return nil, paramErr(tpm2.TPMRCIntegrity, 1)
+	}
+	sensitive, err := t.blobKey.Open(nil, private[:n], private[n:], append(append([]byte(nil), parent.name...), name.Buffer...))
+	if err != nil {
+		return nil, paramErr(tpm2.TPMRCIntegrity, 1)
+	}
+	r := &reader{buf: sensitive}
+	o := &object{
+		public: *pub,
+		name:   name.Buffer,
+		auth:   bytes.Clone(r.sized()),
+		data:   bytes.Clone(r.sized()),
+	}
+	if der := r.sized(); len(der) != 0 {
+		key, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, err
+		}
+		o.key = key.(crypto.Signer)
+	}
+	return o, nil
+}
+
+func (t *TPM) load(c *command, r *reader) (*response, error) {
+	private := r.sized()
+	pub := read[tpm2.TPM2BPublic](r)
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	parent, err := t.parent(c.handles[0])
+	if err != nil {
+		return nil, err
+	}
+	public, err := pub.Contents()
+	if err != nil {
+		return nil, paramErr(tpm2.TPMRCInsufficient, 2)
+	}
+	o, err := t.unsealObject(private, public, parent)
+	if err != nil {
+		return nil, err
+	}
+	o.qualify(parent.qualifiedName)
+	h, err := t.loadObject(o)
+	if err != nil {
+		return nil, err
+	}
+	return &response{
+		handles: []tpm2.TPMHandle{h},
+		params:  marshal(tpm2.TPM2BName{Buffer: o.name}),
+	}, nil
+}
+
+func (t *TPM) readPublic(c *command, r *reader) (*response, error) {
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	o, ok := t.objects[c.handles[0]]
+	if !ok {
+		return nil, handleErr(tpm2.TPMRCHandle, 1)
+	}
+	return &response{
+		params: marshal(
+			tpm2.New2B(o.public),
+			tpm2.TPM2BName{Buffer: o.name},
+			tpm2.TPM2BName{Buffer: o.qualifiedName},
+		),
+	}, nil
+}
+
+func (t *TPM) flushContext(c *command, r *reader) (*response, error) {
+	h := tpm2.TPMHandle(r.u32())
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	if _, ok := t.objects[h]; ok {
+		delete(t.objects, h)
+	} else if _, ok := t.sessions[h]; ok {
+		delete(t.sessions, h)
+	} else {
+		return nil, paramErr(tpm2.TPMRCHandle, 1)
+	}
+	return &response{}, nil
+}
+
+func (t *TPM) sign(c *command, r *reader) (*response, error) {
+	digest := r.sized()
+	inScheme := read[tpm2.TPMTSigScheme](r)
+	read[tpm2.TPMTTKHashCheck](r)
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	o := t.objects[c.handles[0]]
+	if o.key == nil || !o.public.ObjectAttributes.SignEncrypt {
+		return nil, handleErr(tpm2.TPMRCKey, 1)
+	}
+	if o.public.ObjectAttributes.Restricted {
+		// Restricted keys need a ticket for the digest, and the
+		// simulator doesn't issue tickets.
+		return nil, paramErr(tpm2.TPMRCTicket, 3)
+	}
+
+	scheme, hashAlg, err := signingScheme(&o.public, inScheme)
+	if err != nil {
+		return nil, err
+	}
+	h, err := hashAlg.Hash()
+	if err != nil {
+		return nil, paramErr(tpm2.TPMRCHash, 2)
+	}
+	if len(digest) != h.Size() {
+		return nil, paramErr(tpm2.TPMRCSize, 1)
+	}
+
+	var sig tpm2.TPMTSignature
+	switch scheme {
+	case tpm2.TPMAlgECDSA:
+		r, s, err := ecdsa.Sign(rand.Reader, o.key.(*ecdsa.PrivateKey), digest)
+		if err != nil {
+			return nil, err
+		}
+		sig = tpm2.TPMTSignature{
+			SigAlg: scheme,
+			Signature: tpm2.NewTPMUSignature(scheme, &tpm2.TPMSSignatureECC{
+				Hash:       hashAlg,
+				SignatureR: tpm2.TPM2BECCParameter{Buffer: r.Bytes()},
+				SignatureS: tpm2.TPM2BECCParameter{Buffer: s.Bytes()},
+			}),
+		}
+	case tpm2.TPMAlgRSASSA, tpm2.TPMAlgRSAPSS:
+		var opts crypto.SignerOpts = h
+		if scheme == tpm2.TPMAlgRSAPSS {
+			opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: h}
+		}
+		s, err := o.key.Sign(rand.Reader, digest, opts)
+		if err != nil {
+			return nil, err
+		}
+		sig = tpm2.TPMTSignature{
+			SigAlg: scheme,
+			Signature: tpm2.NewTPMUSignature(scheme, &tpm2.TPMSSignatureRSA{
+				Hash: hashAlg,
+				Sig:  tpm2.TPM2BPublicKeyRSA{Buffer: s},
+			}),
+		}
+	}
+	return &response{params: marshal(&sig)}, nil
+}
+
+// signingScheme returns the scheme and hash a key signs with: its own
+// scheme, or, if that is NULL, the one requested.
+func signingScheme(pub *tpm2.TPMTPublic, in *tpm2.TPMTSigScheme) (tpm2.TPMAlgID, tpm2.TPMIAlgHash, error) {
+	scheme, hashAlg := tpm2.TPMAlgNull, tpm2.TPMAlgNull
+	switch pub.Type {
+	case tpm2.TPMAlgECC:
+		parms, _ := pub.Parameters.ECCDetail()
+		scheme = parms.Scheme.Scheme
+		if d, err := parms.Scheme.Details.ECDSA(); err == nil && scheme == tpm2.TPMAlgECDSA {
+			hashAlg = d.HashAlg
+		}
+	case tpm2.TPMAlgRSA:
+		parms, _ := pub.Parameters.RSADetail()
+		scheme = parms.Scheme.Scheme
+		switch scheme {
+		case tpm2.TPMAlgRSASSA:
+			d, _ := parms.Scheme.Details.RSASSA()
+			hashAlg = d.HashAlg
+		case tpm2.TPMAlgRSAPSS:
+			d, _ := parms.Scheme.Details.RSAPSS()
+			hashAlg = d.HashAlg
+		}
+	}
+
+	var inHash tpm2.TPMIAlgHash
+	switch in.Scheme {
+	case tpm2.TPMAlgNull:
+	case tpm2.TPMAlgECDSA, tpm2.TPMAlgRSASSA, tpm2.TPMAlgRSAPSS:
+		var d *tpm2.TPMSSchemeHash
+		var err error
+		switch in.Scheme {
+		case tpm2.TPMAlgECDSA:
+			d, err = in.Details.ECDSA()
+		case tpm2.TPMAlgRSASSA:
+			d, err = in.Details.RSASSA()
+		default:
+			d, err = in.Details.RSAPSS()
+		}
+		if err != nil {
+			return 0, 0, paramErr(tpm2.TPMRCScheme, 2)
+		}
+		inHash = d.HashAlg
+	default:
+		return 0, 0, paramErr(tpm2.TPMRCScheme, 2)
+	}
+
+	switch {
+	case scheme == tpm2.TPMAlgNull && in.Scheme == tpm2.TPMAlgNull:
+		return 0, 0, paramErr(tpm2.TPMRCScheme, 2)
+	case scheme == tpm2.TPMAlgNull:
+		scheme, hashAlg = in.Scheme, inHash
+	case in.Scheme != tpm2.TPMAlgNull && (in.Scheme != scheme || inHash != hashAlg):
+		return 0, 0, paramErr(tpm2.TPMRCScheme, 2)
+	}
+	isECC := scheme == tpm2.TPMAlgECDSA
+	if isECC != (pub.Type == tpm2.TPMAlgECC) {
+		return 0, 0, paramErr(tpm2.TPMRCScheme, 2)
+	}
+	return scheme, hashAlg, nil
+}
+
+func (t *TPM) unseal(c *command, r *reader) (*response, error) {
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	o := t.objects[c.handles[0]]
+	a := o.public.ObjectAttributes
+	if o.public.Type != tpm2.TPMAlgKeyedHash || a.SignEncrypt || a.Decrypt || a.Restricted {
+		return nil, handleErr(tpm2.TPMRCAttributes, 1)
+	}
+	return &response{params: marshal(tpm2.TPM2BSensitiveData{Buffer: o.data})}, nil
+}
@@ -0,0 +1,142 @@
+package memsim
+
+import (
+	"encoding/binary"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// selectedPCRs returns the values of the PCRs in sel, in the order the TPM
+// hashes them: bank by bank, and by index within each bank. Banks that
+// aren't allocated are skipped.
+func (t *TPM) selectedPCRs(sel *tpm2.TPMLPCRSelection) ([][]byte, error) {
+	var values [][]byte
+	for _, s := range sel.PCRSelections {
+		if _, err := s.Hash.Hash(); err != nil {
+			return nil, tpm2.TPMRCHash
+		}
+		bank, ok := t.pcrs[s.Hash]
+		for i, b := range s.PCRSelect {
+			for bit := 0; bit < 8; bit++ {
+				if b&(1<<bit) == 0 {
+					continue
+				}
+				pcr := i*8 + bit
+				if pcr >= pcrCount {
+					return nil, tpm2.TPMRCValue
+				}
+				if ok {
+					values = append(values, bank[pcr])
+				}
+			}
+		}
+	}
+	return values, nil
+}
+
+// extend extends PCR pcr of bank alg with digest.
+func (t *TPM) extend(alg tpm2.TPMIAlgHash, pcr int, digest []byte) {
+	h, _ := alg.Hash()
+	d := h.New()
+	d.Write(t.pcrs[alg][pcr])
+	d.Write(digest)
+	t.pcrs[alg][pcr] = d.Sum(nil)
+}
+
+func (t *TPM) pcrRead(c *command, r *reader) (*response, error) {
+	sel := read[tpm2.TPMLPCRSelection](r)
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	// Like a TPM, return at most 8 PCRs, and say which ones they are.
+	var out tpm2.TPMLPCRSelection
+	var values tpm2.TPMLDigest
+	for _, s := range sel.PCRSelections {
+		if _, err := s.Hash.Hash(); err != nil {
+			return nil, paramErr(tpm2.TPMRCHash, 1)
+		}
+		bank, ok := t.pcrs[s.Hash]
+		selected := make([]byte, len(s.PCRSelect))
+		for i, b := range s.PCRSelect {
+			for bit := 0; bit < 8; bit++ {
+				pcr := i*8 + bit
+				if !ok || b&(1<<bit) == 0 || pcr >= pcrCount || len(values.Digests) == 8 {
+					continue
+				}
+				selected[i] |= 1 << bit
+				values.Digests = append(values.Digests, tpm2.TPM2BDigest{Buffer: bank[pcr]})
+			}
+		}
+		out.PCRSelections = append(out.PCRSelections, tpm2.TPMSPCRSelection{Hash: s.Hash, PCRSelect: selected})
+	}
+	return &response{params: append(binary.BigEndian.AppendUint32(nil, t.pcrCounter), marshal(&out, &values)...)}, nil
+}
+
+// pcrIndex returns the PCR at handle h, or -1 for TPM_RH_NULL, which
+// commands that change PCRs accept and do nothing with.
+func pcrIndex(h tpm2.TPMHandle) int {
+	if h == tpm2.TPMRHNull {
+		return -1
+	}
+	return int(h)
+}
+
+func (t *TPM) pcrExtend(c *command, r *reader) (*response, error) {
+	digests := read[tpm2.TPMLDigestValues](r)
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	pcr := pcrIndex(c.handles[0])
+	if pcr < 0 {
+		return &response{}, nil
+	}
+	for _, d := range digests.Digests {
+		if _, ok := t.pcrs[d.HashAlg]; ok {
+			t.extend(d.HashAlg, pcr, d.Digest)
+		}
+	}
+	t.pcrCounter++
+	return &response{}, nil
+}
+
+func (t *TPM) pcrEvent(c *command, r *reader) (*response, error) {
+	data := r.sized()
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	if len(data) > maxNVBuffer {
+		return nil, paramErr(tpm2.TPMRCSize, 1)
+	}
+	var digests tpm2.TPMLDigestValues
+	for _, alg := range []tpm2.TPMIAlgHash{tpm2.TPMAlgSHA1, tpm2.TPMAlgSHA256} {
+		h, _ := alg.Hash()
+		d := h.New()
+		d.Write(data)
+		digests.Digests = append(digests.Digests, tpm2.TPMTHA{HashAlg: alg, Digest: d.Sum(nil)})
+	}
+	if pcr := pcrIndex(c.handles[0]); pcr >= 0 {
+		for _, d := range digests.Digests {
+			t.extend(d.HashAlg, pcr, d.Digest)
+		}
+		t.pcrCounter++
+	}
+	return &response{params: marshal(&digests)}, nil
+}
+
+func (t *TPM) pcrReset(c *command, r *reader) (*response, error) {
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	// As on a PC client TPM, only the debug PCR and the application PCR
+	// can be reset at locality 0.
+	pcr := pcrIndex(c.handles[0])
+	if pcr != 16 && pcr != 23 {
+		return nil, tpm2.TPMRCLocality
+	}
+	for alg, bank := range t.pcrs {
+		h, _ := alg.Hash()
+		bank[pcr] = make([]byte, h.Size())
+	}
+	t.pcrCounter++
+	return &response{}, nil
+}
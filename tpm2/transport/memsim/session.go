@@ -0,0 +1,165 @@
+package memsim
+
+import (
+	"encoding/binary"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// session is an HMAC, policy or trial session.
+type session struct {
+	kind       tpm2.TPMSE
+	hash       tpm2.TPMIAlgHash
+	sessionKey []byte
+	nonceTPM   []byte
+	// nonceCaller is the caller's nonce from the last command.
+	nonceCaller []byte
+
+	// The policy state of policy and trial sessions.
+	policyDigest    []byte
+	authValueNeeded bool
+	// pcrCounter is the PCR update counter when TPM2_PolicyPCR was run,
+	// if it was.
+	pcrCounter *uint32
+}
+
+// resetPolicy clears the session's policy state.
+func (s *session) resetPolicy() {
+	h, _ := s.hash.Hash()
+	s.policyDigest = make([]byte, h.Size())
+	s.authValueNeeded = false
+	s.pcrCounter = nil
+}
+
+// extendPolicy updates the session's policy digest with cc and data.
+func (s *session) extendPolicy(cc tpm2.TPMCC, data ...[]byte) {
+	h, _ := s.hash.Hash()
+	d := h.New()
+	d.Write(s.policyDigest)
+	binary.Write(d, binary.BigEndian, cc)
+	for _, b := range data {
+		d.Write(b)
+	}
+	s.policyDigest = d.Sum(nil)
+}
+
+func (t *TPM) startAuthSession(c *command, r *reader) (*response, error) {
+	nonceCaller := r.sized()
+	salt := r.sized()
+	kind := tpm2.TPMSE(r.u8())
+	sym := read[tpm2.TPMTSymDef](r)
+	hash := tpm2.TPMIAlgHash(r.u16())
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	// Salted and bound sessions are not supported.
+	if c.handles[0] != tpm2.TPMRHNull {
+		return nil, handleErr(tpm2.TPMRCValue, 1)
+	}
+	if c.handles[1] != tpm2.TPMRHNull {
+		return nil, handleErr(tpm2.TPMRCValue, 2)
+	}
+	if len(salt) != 0 {
+		return nil, paramErr(tpm2.TPMRCValue, 2)
+	}
+	if kind != tpm2.TPMSEHMAC && kind != tpm2.TPMSEPolicy && kind != tpm2.TPMSETrial {
+		return nil, paramErr(tpm2.TPMRCValue, 3)
+	}
+	if sym.Algorithm != tpm2.TPMAlgNull {
+		return nil, paramErr(tpm2.TPMRCSymmetric, 4)
+	}
+	h, err := hash.Hash()
+	if err != nil || hash != tpm2.TPMAlgSHA1 && hash != tpm2.TPMAlgSHA256 {
+		return nil, paramErr(tpm2.TPMRCHash, 5)
+	}
+	if len(nonceCaller) < 16 || len(nonceCaller) > h.Size() {
+		return nil, paramErr(tpm2.TPMRCSize, 1)
+	}
+	if len(t.sessions) >= maxSessions {
+		return nil, tpm2.TPMRCSessionMemory
+	}
+
+	ht := tpm2.TPMHTHMACSession
+	if kind != tpm2.TPMSEHMAC {
+		ht = tpm2.TPMHTPolicySession
+	}
+	handle := t.allocHandle(ht)
+	s := &session{
+		kind:        kind,
+		hash:        hash,
+		nonceTPM:    newNonce(hash),
+		nonceCaller: nonceCaller,
+	}
+	s.resetPolicy()
+	t.sessions[handle] = s
+	return &response{
+		handles: []tpm2.TPMHandle{handle},
+		params:  marshal(tpm2.TPM2BNonce{Buffer: s.nonceTPM}),
+	}, nil
+}
+
+// policySession returns the policy or trial session at handle h.
+func (t *TPM) policySession(h tpm2.TPMHandle) (*session, error) {
+	s := t.sessions[h]
+	if s == nil || s.kind == tpm2.TPMSEHMAC {
+		return nil, handleErr(tpm2.TPMRCHandle, 1)
+	}
+	return s, nil
+}
+
+func (t *TPM) policyPCR(c *command, r *reader) (*response, error) {
+	pcrDigest := r.sized()
+	sel := read[tpm2.TPMLPCRSelection](r)
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	s, err := t.policySession(c.handles[0])
+	if err != nil {
+		return nil, err
+	}
+	values, err := t.selectedPCRs(sel)
+	if err != nil {
+		return nil, paramErr(err.(tpm2.TPMRC), 2)
+	}
+	h, _ := s.hash.Hash()
+	d := h.New()
+	for _, v := range values {
+		d.Write(v)
+	}
+	digest := d.Sum(nil)
+	switch {
+	case s.kind == tpm2.TPMSETrial && len(pcrDigest) != 0:
+		// A trial session takes the expected digest on trust.
+		digest = pcrDigest
+	case len(pcrDigest) != 0 && string(pcrDigest) != string(digest):
+		return nil, paramErr(tpm2.TPMRCValue, 1)
+	}
+	s.extendPolicy(tpm2.TPMCCPolicyPCR, tpm2.Marshal(sel), digest)
+	counter := t.pcrCounter
+	s.pcrCounter = &counter
+	return &response{}, nil
+}
+
+func (t *TPM) policyAuthValue(c *command, r *reader) (*response, error) {
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	s, err := t.policySession(c.handles[0])
+	if err != nil {
+		return nil, err
+	}
+	s.extendPolicy(tpm2.TPMCCPolicyAuthValue)
+	s.authValueNeeded = true
+	return &response{}, nil
+}
+
+func (t *TPM) policyGetDigest(c *command, r *reader) (*response, error) {
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	s, err := t.policySession(c.handles[0])
+	if err != nil {
+		return nil, err
+	}
+	return &response{params: marshal(tpm2.TPM2BDigest{Buffer: s.policyDigest})}, nil
+}
@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// SendFunc sends a command and returns the response, like TPM.Send.
+type SendFunc func(cmd []byte) ([]byte, error)
+
+// Interceptor sees every command sent through a TPM returned by Chain. It
+// passes the command on by calling next, and returns the response. It may
+// record or change the command before calling next and the response after,
+// or answer the command itself without calling next at all. This is how
+// metrics, audit logs, fuzzing corpora and fault injection can be added to
+// any transport.
+type Interceptor func(cmd []byte, next SendFunc) ([]byte, error)
+
+// chain is a TPM whose commands go through interceptors.
+type chain struct {
+	tpm          TPM
+	interceptors []Interceptor
+	send         SendFunc
+}
+
+// Chain returns a TPM that sends commands to t through interceptors. The
+// first interceptor sees a command first and its response last.
+//
+// Closing the returned TPM closes t, if it can be closed. Setting its
+// response size, command timeout or locality sets t's, if t supports it, and
+// it is resource managed if t is. Commands sent with a context are sent to t
+// with that context, through the interceptors.
+func Chain(t TPM, interceptors ...Interceptor) TPMCloser {
+	return &chain{tpm: t, interceptors: interceptors, send: through(interceptors, t.Send)}
+}
+
+// through returns a SendFunc that sends commands with send through
+// interceptors.
+func through(interceptors []Interceptor, send SendFunc) SendFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], send
+		send = func(cmd []byte) ([]byte, error) {
+			return interceptor(cmd, next)
+		}
+	}
+	return send
+}
+
+// Send implements the TPM interface.
+func (c *chain) Send(cmd []byte) ([]byte, error) {
+	return c.send(cmd)
+}
+
+// SendContext implements the ContextSender interface. Interceptors don't see
+// commands sent once ctx is done.
+func (c *chain) SendContext(ctx context.Context, cmd []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return through(c.interceptors, WithContext(ctx, c.tpm).Send)(cmd)
+}
+
+// Unwrap implements the Wrapper interface.
+func (c *chain) Unwrap() TPM {
+	return c.tpm
+}
+
+// Close implements the io.Closer interface.
+func (c *chain) Close() error {
+	if closer, ok := c.tpm.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// SetMaxResponseSize implements the ResponseSizer interface.
+func (c *chain) SetMaxResponseSize(size int) {
+	if rs, ok := c.tpm.(ResponseSizer); ok {
+		rs.SetMaxResponseSize(size)
+	}
+}
+
+// SetCommandTimeout implements the CommandTimeoutSetter interface.
+func (c *chain) SetCommandTimeout(timeout time.Duration) {
+	if ts, ok := c.tpm.(CommandTimeoutSetter); ok {
+		ts.SetCommandTimeout(timeout)
+	}
+}
+
+// SetLocality implements the LocalitySetter interface.
+func (c *chain) SetLocality(locality uint8) error {
+	return SetLocality(c.tpm, locality)
+}
+
+// ResourceManaged implements the ResourceManager interface.
+func (c *chain) ResourceManaged() bool {
+	rm, ok := c.tpm.(ResourceManager)
+	return ok && rm.ResourceManaged()
+}
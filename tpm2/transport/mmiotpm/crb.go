@@ -0,0 +1,168 @@
+package mmiotpm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// CRB registers, relative to the locality's window.
+const (
+	crbLocCtrl  = 0x08
+	crbLocSts   = 0x0C
+	crbCtrlReq  = 0x40
+	crbCtrlSts  = 0x44
+	crbStart    = 0x4C
+	crbCmdSize  = 0x58
+	crbCmdLAddr = 0x5C
+	crbCmdHAddr = 0x60
+	crbRspSize  = 0x64
+	crbRspAddr  = 0x68
+)
+
+// CRB register bits.
+const (
+	locCtrlRequestAccess = 0x1
+	locCtrlRelinquish    = 0x2
+	locStsGranted        = 0x1
+	ctrlReqCmdReady      = 0x1
+	ctrlReqGoIdle        = 0x2
+	ctrlStsError         = 0x1
+	ctrlStsIdle          = 0x2
+	startStart           = 0x1
+)
+
+// crb talks to a TPM through the CRB registers.
+type crb struct {
+	regs Registers
+	base uintptr
+
+	// Offsets of the command and response buffers within regs.
+	cmd, rsp         uintptr
+	cmdSize, rspSize int
+
+	commandTimeout time.Duration
+}
+
+// OpenCRB opens the TPM at regs using the CRB interface, requesting the given
+// locality. The command and response buffers must lie within regs. The
+// returned TPM is a transport.LocalitySetter.
+func OpenCRB(regs Registers, locality int) (transport.TPMCloser, error) {
+	if locality < 0 || locality > maxLocality {
+		return nil, fmt.Errorf("invalid locality %d", locality)
+	}
+	c := &crb{regs: regs, commandTimeout: timeoutCommand}
+	if err := c.request(locality); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// request requests use of the locality and locates its command and response
+// buffers.
+func (c *crb) request(locality int) error {
+	c.base = uintptr(locality) * localityStride
+	c.regs.Write32(c.base+crbLocCtrl, locCtrlRequestAccess)
+	if err := poll(timeoutA, func() bool {
+		return c.regs.Read32(c.base+crbLocSts)&locStsGranted != 0
+	}); err != nil {
+		return fmt.Errorf("requesting locality %d: %w", locality, err)
+	}
+
+	cmdAddr := uint64(c.regs.Read32(c.base+crbCmdHAddr))<<32 | uint64(c.regs.Read32(c.base+crbCmdLAddr))
+	rspAddr := uint64(c.regs.Read32(c.base+crbRspAddr+4))<<32 | uint64(c.regs.Read32(c.base+crbRspAddr))
+	c.cmdSize = int(c.regs.Read32(c.base + crbCmdSize))
+	c.rspSize = int(c.regs.Read32(c.base + crbRspSize))
+	var err error
+	if c.cmd, err = c.offset(cmdAddr, c.cmdSize); err != nil {
+		c.Close()
+		return fmt.Errorf("command buffer: %w", err)
+	}
+	if c.rsp, err = c.offset(rspAddr, c.rspSize); err != nil {
+		c.Close()
+		return fmt.Errorf("response buffer: %w", err)
+	}
+	return nil
+}
+
+// SetLocality implements transport.LocalitySetter. It relinquishes the
+// current locality and requests the new one; if that fails, the TPM has no
+// locality until SetLocality succeeds.
+func (c *crb) SetLocality(locality uint8) error {
+	if locality > maxLocality {
+		return fmt.Errorf("invalid locality %d", locality)
+	}
+	c.Close()
+	return c.request(int(locality))
+}
+
+// offset converts the physical address of a buffer to an offset within regs.
+func (c *crb) offset(addr uint64, size int) (uintptr, error) {
+	base := uint64(c.regs.Base())
+	end := base + (maxLocality+1)*localityStride
+	if size < headerSize || addr < base || addr+uint64(size) > end {
+		return 0, fmt.Errorf("0x%x (%d bytes) is outside the register window", addr, size)
+	}
+	return uintptr(addr - base), nil
+}
+
+// SetCommandTimeout implements transport.CommandTimeoutSetter.
+func (c *crb) SetCommandTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = timeoutCommand
+	}
+	c.commandTimeout = timeout
+}
+
+// Send implements the TPM interface.
+func (c *crb) Send(input []byte) ([]byte, error) {
+	if len(input) > c.cmdSize {
+		return nil, fmt.Errorf("command of %d bytes exceeds the %d byte command buffer", len(input), c.cmdSize)
+	}
+	c.regs.Write32(c.base+crbCtrlReq, ctrlReqCmdReady)
+	if err := poll(timeoutC, func() bool {
+		return c.regs.Read32(c.base+crbCtrlReq)&ctrlReqCmdReady == 0 &&
+			c.regs.Read32(c.base+crbCtrlSts)&ctrlStsIdle == 0
+	}); err != nil {
+		return nil, fmt.Errorf("waiting for cmdReady: %w", err)
+	}
+	// Leave the TPM idle, whatever happens.
+	defer c.regs.Write32(c.base+crbCtrlReq, ctrlReqGoIdle)
+
+	for i, b := range input {
+		c.regs.Write8(c.cmd+uintptr(i), b)
+	}
+	c.regs.Write32(c.base+crbStart, startStart)
+	if err := poll(c.commandTimeout, func() bool {
+		return c.regs.Read32(c.base+crbStart)&startStart == 0
+	}); err != nil {
+		return nil, fmt.Errorf("waiting for response: %w", err)
+	}
+	if c.regs.Read32(c.base+crbCtrlSts)&ctrlStsError != 0 {
+		return nil, fmt.Errorf("TPM reported a fatal error")
+	}
+
+	rsp := make([]byte, headerSize)
+	for i := range rsp {
+		rsp[i] = c.regs.Read8(c.rsp + uintptr(i))
+	}
+	size := responseSize(rsp)
+	if size < headerSize {
+		return nil, fmt.Errorf("invalid response size %d", size)
+	}
+	if size > c.rspSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrResponseTooLarge, size)
+	}
+	rsp = append(rsp, make([]byte, size-headerSize)...)
+	for i := headerSize; i < size; i++ {
+		rsp[i] = c.regs.Read8(c.rsp + uintptr(i))
+	}
+	return rsp, nil
+}
+
+// Close relinquishes the locality.
+func (c *crb) Close() error {
+	c.regs.Write32(c.base+crbLocCtrl, locCtrlRelinquish)
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build gotpm_mmio && !tinygo
+
+package mmiotpm
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// memory is a Registers backed by physical memory.
+type memory struct {
+	base unsafe.Pointer
+}
+
+// Map returns Registers for the TPM register window at the given physical
+// address, such as DefaultBase. The address must be mapped uncached, and
+// identity-mapped into the address space of the program.
+func Map(base uintptr) Registers {
+	return memory{unsafe.Pointer(base)}
+}
+
+func (m memory) Base() uintptr { return uintptr(m.base) }
+
+// The 8-bit accessors are not inlined so that the compiler cannot merge or
+// elide them; sync/atomic has no 8-bit operations.
+
+//go:noinline
+func (m memory) Read8(off uintptr) uint8 {
+	return *(*uint8)(unsafe.Add(m.base, off))
+}
+
+//go:noinline
+func (m memory) Write8(off uintptr, v uint8) {
+	*(*uint8)(unsafe.Add(m.base, off)) = v
+}
+
+func (m memory) Read32(off uintptr) uint32 {
+	return atomic.LoadUint32((*uint32)(unsafe.Add(m.base, off)))
+}
+
+func (m memory) Write32(off uintptr, v uint32) {
+	atomic.StoreUint32((*uint32)(unsafe.Add(m.base, off)), v)
+}
@@ -0,0 +1,37 @@
+//go:build tinygo
+
+package mmiotpm
+
+import (
+	"runtime/volatile"
+	"unsafe"
+)
+
+// memory is a Registers backed by physical memory.
+type memory struct {
+	base unsafe.Pointer
+}
+
+// Map returns Registers for the TPM register window at the given physical
+// address, such as DefaultBase. The address must be mapped uncached.
+func Map(base uintptr) Registers {
+	return memory{unsafe.Pointer(base)}
+}
+
+func (m memory) Base() uintptr { return uintptr(m.base) }
+
+func (m memory) Read8(off uintptr) uint8 {
+	return volatile.LoadUint8((*uint8)(unsafe.Add(m.base, off)))
+}
+
+func (m memory) Write8(off uintptr, v uint8) {
+	volatile.StoreUint8((*uint8)(unsafe.Add(m.base, off)), v)
+}
+
+func (m memory) Read32(off uintptr) uint32 {
+	return volatile.LoadUint32((*uint32)(unsafe.Add(m.base, off)))
+}
+
+func (m memory) Write32(off uintptr, v uint32) {
+	volatile.StoreUint32((*uint32)(unsafe.Add(m.base, off)), v)
+}
@@ -0,0 +1,100 @@
+// Package mmiotpm implements the TPM transport over the memory-mapped TIS
+// (FIFO) and CRB register interfaces defined by the TCG PC Client Platform
+// TPM Profile (PTP) specification, without an operating system driver.
+//
+// It is intended for bootloaders, firmware and unikernels written in Go. Map,
+// which gives access to physical memory, is only available when building with
+// TinyGo or with the gotpm_mmio build tag.
+package mmiotpm
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/internal/tis"
+)
+
+// DefaultBase is the physical address of locality 0 of the TPM registers on
+// PC Client platforms.
+const DefaultBase uintptr = 0xFED40000
+
+const (
+	// localityStride is the distance between the register windows of
+	// consecutive localities.
+	localityStride = 0x1000
+	// maxLocality is the highest locality defined by the PTP.
+	maxLocality = 4
+
+	// regInterfaceID is the TPM_INTERFACE_ID / TPM_CRB_INTF_ID register,
+	// shared by both interfaces.
+	regInterfaceID = 0x30
+
+	interfaceTypeMask = 0xF
+	interfaceTypeFIFO = 0x0
+	interfaceTypeCRB  = 0x1
+	interfaceTypeTIS  = 0xF
+)
+
+// Timeouts from the PTP. The command timeout is generous, since some
+// commands (such as RSA key generation) are slow on real hardware.
+var (
+	timeoutA       = 750 * time.Millisecond
+	timeoutC       = 200 * time.Millisecond
+	timeoutCommand = 5 * time.Minute
+)
+
+var (
+	// ErrTimeout indicates that the TPM did not reach the expected state in
+	// time.
+	ErrTimeout = tis.ErrTimeout
+	// ErrUnknownInterface indicates that the registers do not describe a
+	// supported interface.
+	ErrUnknownInterface = errors.New("unknown TPM interface type")
+	// ErrResponseTooLarge indicates that the TPM reported a response larger
+	// than the interface can carry.
+	ErrResponseTooLarge = tis.ErrResponseTooLarge
+)
+
+// Registers is a window of memory-mapped TPM registers, starting at locality
+// 0. All offsets are relative to the start of the window. Implementations
+// must not cache, merge or reorder accesses.
+type Registers interface {
+	// Base returns the physical address of the start of the window.
+	Base() uintptr
+	Read8(off uintptr) uint8
+	Write8(off uintptr, v uint8)
+	Read32(off uintptr) uint32
+	Write32(off uintptr, v uint32)
+}
+
+// Open detects which interface the TPM at regs implements and opens it at
+// the given locality.
+func Open(regs Registers, locality int) (transport.TPMCloser, error) {
+	if locality < 0 || locality > maxLocality {
+		return nil, fmt.Errorf("invalid locality %d", locality)
+	}
+	id := regs.Read32(uintptr(locality)*localityStride + regInterfaceID)
+	switch id & interfaceTypeMask {
+	case interfaceTypeFIFO, interfaceTypeTIS:
+		return OpenTIS(regs, locality)
+	case interfaceTypeCRB:
+		return OpenCRB(regs, locality)
+	}
+	return nil, fmt.Errorf("%w: 0x%x", ErrUnknownInterface, id&interfaceTypeMask)
+}
+
+// poll calls cond until it returns true or the timeout expires, waiting
+// between calls as tis.Poll does.
+func poll(timeout time.Duration, cond func() bool) error {
+	return tis.Poll(timeout, func() (bool, error) { return cond(), nil })
+}
+
+// responseSize returns the size of the response with the given header.
+func responseSize(hdr []byte) int {
+	return int(hdr[2])<<24 | int(hdr[3])<<16 | int(hdr[4])<<8 | int(hdr[5])
+}
+
+// headerSize is the size of a TPM response header.
+const headerSize = 10
@@ -0,0 +1,177 @@
+package mmiotpm
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+	testhelper "github.com/google/go-tpm/tpm2/transport/test"
+)
+
+// TIS register bits used by fakeTIS.
+const (
+	accessValid          = 0x80
+	accessActiveLocality = 0x20
+	accessRequestUse     = 0x02
+	stsValid             = 0x80
+	stsCommandReady      = 0x40
+	stsGo                = 0x20
+	stsDataAvail         = 0x10
+	stsExpect            = 0x08
+	stsBurstShift        = 8
+)
+
+// fakeTIS emulates the TIS FIFO registers of locality 0 in front of a TPM.
+type fakeTIS struct {
+	tpm      transport.TPM
+	active   bool
+	ready    bool
+	cmd, rsp []byte
+}
+
+func (f *fakeTIS) Base() uintptr { return DefaultBase }
+
+func (f *fakeTIS) Read8(off uintptr) uint8 {
+	switch off {
+	case tisAccess:
+		if f.active {
+			return accessValid | accessActiveLocality
+		}
+		return accessValid
+	case tisDataFIFO:
+		b := f.rsp[0]
+		f.rsp = f.rsp[1:]
+		return b
+	}
+	return 0xFF
+}
+
+func (f *fakeTIS) Write8(off uintptr, v uint8) {
+	switch {
+	case off == tisAccess && v == accessRequestUse:
+		f.active = true
+	case off == tisAccess && v == accessActiveLocality:
+		f.active = false
+	case off == tisDataFIFO && f.ready:
+		f.cmd = append(f.cmd, v)
+	}
+}
+
+// expect reports whether the command written so far is incomplete.
+func (f *fakeTIS) expect() bool {
+	return len(f.cmd) < 6 || len(f.cmd) < int(binary.BigEndian.Uint32(f.cmd[2:6]))
+}
+
+func (f *fakeTIS) Read32(off uintptr) uint32 {
+	switch off {
+	case regInterfaceID:
+		return interfaceTypeFIFO
+	case tisSts:
+		// Use a small burst count to exercise the burst handling.
+		sts := uint32(stsValid | 8<<stsBurstShift)
+		if f.ready && len(f.cmd) == 0 {
+			sts |= stsCommandReady
+		}
+		if len(f.cmd) > 0 && f.expect() {
+			sts |= stsExpect
+		}
+		if len(f.rsp) > 0 {
+			sts |= stsDataAvail
+		}
+		return sts
+	}
+	return 0xFFFFFFFF
+}
+
+func (f *fakeTIS) Write32(off uintptr, v uint32) {
+	if off != tisSts {
+		return
+	}
+	switch v {
+	case stsCommandReady:
+		f.ready, f.cmd, f.rsp = true, nil, nil
+	case stsGo:
+		rsp, err := f.tpm.Send(f.cmd)
+		if err != nil {
+			panic(err)
+		}
+		f.ready, f.cmd, f.rsp = false, nil, rsp
+	}
+}
+
+// fakeCRB emulates the CRB registers of locality 0 in front of a TPM.
+type fakeCRB struct {
+	tpm transport.TPM
+	mem [localityStride]byte
+}
+
+const fakeCRBBuffer = 0x80
+
+func newFakeCRB(tpm transport.TPM) *fakeCRB {
+	f := &fakeCRB{tpm: tpm}
+	f.put(regInterfaceID, interfaceTypeCRB)
+	f.put(crbCtrlSts, ctrlStsIdle)
+	f.put(crbCmdLAddr, uint32(f.Base())+fakeCRBBuffer)
+	f.put(crbCmdSize, localityStride-fakeCRBBuffer)
+	f.put(crbRspAddr, uint32(f.Base())+fakeCRBBuffer)
+	f.put(crbRspSize, localityStride-fakeCRBBuffer)
+	return f
+}
+
+func (f *fakeCRB) put(off uintptr, v uint32) {
+	binary.LittleEndian.PutUint32(f.mem[off:], v)
+}
+
+func (f *fakeCRB) Base() uintptr               { return DefaultBase }
+func (f *fakeCRB) Read8(off uintptr) uint8     { return f.mem[off] }
+func (f *fakeCRB) Write8(off uintptr, v uint8) { f.mem[off] = v }
+func (f *fakeCRB) Read32(off uintptr) uint32   { return binary.LittleEndian.Uint32(f.mem[off:]) }
+func (f *fakeCRB) Write32(off uintptr, v uint32) {
+	switch off {
+	case crbLocCtrl:
+		if v == locCtrlRequestAccess {
+			f.put(crbLocSts, locStsGranted)
+		} else {
+			f.put(crbLocSts, 0)
+		}
+	case crbCtrlReq:
+		if v == ctrlReqGoIdle {
+			f.put(crbCtrlSts, ctrlStsIdle)
+		} else {
+			f.put(crbCtrlSts, 0)
+		}
+	case crbStart:
+		buf := f.mem[fakeCRBBuffer:]
+		rsp, err := f.tpm.Send(buf[:binary.BigEndian.Uint32(buf[2:6])])
+		if err != nil {
+			panic(err)
+		}
+		copy(buf, rsp)
+	default:
+		f.put(off, v)
+	}
+}
+
+func openFake(t *testing.T, newRegs func(transport.TPM) Registers) func() (transport.TPMCloser, error) {
+	return func() (transport.TPMCloser, error) {
+		sim, err := simulator.OpenSimulator()
+		if err != nil {
+			t.Fatalf("could not connect to TPM simulator: %v", err)
+		}
+		t.Cleanup(func() { sim.Close() })
+		return Open(newRegs(sim), 0)
+	}
+}
+
+func TestTIS(t *testing.T) {
+	testhelper.RunTest(t, nil, openFake(t, func(tpm transport.TPM) Registers {
+		return &fakeTIS{tpm: tpm}
+	}))
+}
+
+func TestCRB(t *testing.T) {
+	testhelper.RunTest(t, nil, openFake(t, func(tpm transport.TPM) Registers {
+		return newFakeCRB(tpm)
+	}))
+}
@@ -0,0 +1,69 @@
+package mmiotpm
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/internal/tis"
+)
+
+// TIS (FIFO interface) registers, relative to the locality's window.
+const (
+	tisAccess   = 0x00
+	tisSts      = 0x18
+	tisDataFIFO = 0x24
+)
+
+// tisBus gives access to the FIFO registers of one locality.
+type tisBus struct {
+	regs Registers
+	base uintptr
+}
+
+func (b *tisBus) Read(reg tis.Register, buf []byte) error {
+	switch reg {
+	case tis.Access:
+		buf[0] = b.regs.Read8(b.base + tisAccess)
+	case tis.Sts:
+		v := b.regs.Read32(b.base + tisSts)
+		buf[0], buf[1], buf[2], buf[3] = byte(v), byte(v>>8), byte(v>>16), byte(v>>24)
+	case tis.DataFIFO:
+		for i := range buf {
+			buf[i] = b.regs.Read8(b.base + tisDataFIFO)
+		}
+	}
+	return nil
+}
+
+func (b *tisBus) Write(reg tis.Register, data []byte) error {
+	switch reg {
+	case tis.Access:
+		b.regs.Write8(b.base+tisAccess, data[0])
+	case tis.Sts:
+		b.regs.Write32(b.base+tisSts, uint32(data[0])|uint32(data[1])<<8|uint32(data[2])<<16|uint32(data[3])<<24)
+	case tis.DataFIFO:
+		for _, v := range data {
+			b.regs.Write8(b.base+tisDataFIFO, v)
+		}
+	}
+	return nil
+}
+
+// SetLocality implements tis.LocalityBus.
+func (b *tisBus) SetLocality(locality int) error {
+	b.base = uintptr(locality) * localityStride
+	return nil
+}
+
+// OpenTIS opens the TPM at regs using the TIS FIFO interface, requesting the
+// given locality. The returned TPM is a transport.LocalitySetter.
+func OpenTIS(regs Registers, locality int) (transport.TPMCloser, error) {
+	if locality < 0 || locality > maxLocality {
+		return nil, fmt.Errorf("invalid locality %d", locality)
+	}
+	t, err := tis.Open(&tisBus{regs: regs, base: uintptr(locality) * localityStride})
+	if err != nil {
+		return nil, fmt.Errorf("locality %d: %w", locality, err)
+	}
+	return t, nil
+}
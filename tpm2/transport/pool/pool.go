@@ -0,0 +1,398 @@
+// Package pool shares one connection to a TPM between many clients, as a
+// resource manager does, for TPMs that are accessed directly rather than
+// through one (such as /dev/tpm0, a simulator or a TPM on SPI).
+//
+// Each client sees its own virtual view of the TPM. Transient objects it
+// creates or loads are given virtual handles, and are only in the TPM while
+// one of its commands uses them: between commands, the pool keeps their
+// saved contexts and they take up none of the TPM's object slots. Sessions
+// keep their handles, but are likewise saved between commands. A client can
+// only use its own objects and sessions; a command using another handle in
+// their ranges fails with TPM_RC_HANDLE, as if the handle did not exist.
+//
+// Commands from all clients are sent one at a time. For concurrent access
+// through a resource manager that supports it, see rmmux.
+package pool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/handles"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/internal/tpmcmd"
+)
+
+var (
+	// ErrClosed indicates that the Pool or Client has been closed.
+	ErrClosed = errors.New("pool: closed")
+	// ErrHandlesExhausted indicates that a client has used up its virtual
+	// handles.
+	ErrHandlesExhausted = errors.New("pool: out of virtual handles")
+)
+
+// Pool shares a TPM between clients. It is safe for concurrent use.
+type Pool struct {
+	// mu serializes commands, and guards everything below and the state of
+	// every client.
+	mu      sync.Mutex
+	tpm     transport.TPM
+	attrs   map[tpm2.TPMCC]tpm2.TPMACC
+	clients map[*Client]bool
+	closed  bool
+}
+
+// New returns a Pool sharing t. Nothing else may send commands to t while
+// the pool is in use.
+func New(t transport.TPM) *Pool {
+	return &Pool{tpm: t, clients: make(map[*Client]bool)}
+}
+
+// Client returns a new client of the pool.
+func (p *Pool) Client() (*Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrClosed
+	}
+	c := &Client{
+		p:        p,
+		objects:  make(map[tpm2.TPMHandle]tpm2.TPMSContext),
+		sessions: make(map[tpm2.TPMHandle]*tpm2.TPMSContext),
+		next:     handles.TransientFirst,
+	}
+	p.clients[c] = true
+	return c, nil
+}
+
+// Close closes every client. It does not close the TPM.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	p.closed = true
+	var errs []error
+	for c := range p.clients {
+		errs = append(errs, c.close())
+	}
+	return errors.Join(errs...)
+}
+
+// commandAttributes returns the attributes of the command, reading the
+// TPM's command table the first time.
+func (p *Pool) commandAttributes(cc tpm2.TPMCC) (tpm2.TPMACC, bool, error) {
+	if p.attrs == nil {
+		attrs, err := tpmcmd.Attributes(p.tpm)
+		if err != nil {
+			return tpm2.TPMACC{}, false, err
+		}
+		p.attrs = attrs
+	}
+	a, ok := p.attrs[cc]
+	return a, ok, nil
+}
+
+// Client is one client's view of the TPM. It is safe for concurrent use.
+type Client struct {
+	p *Pool
+	// objects holds the saved context of each virtual handle.
+	objects map[tpm2.TPMHandle]tpm2.TPMSContext
+	// sessions holds the saved context of each of the client's sessions,
+	// or nil for sessions whose context the client saved itself.
+	sessions map[tpm2.TPMHandle]*tpm2.TPMSContext
+	next     tpm2.TPMHandle
+	closed   bool
+}
+
+var _ transport.TPMCloser = (*Client)(nil)
+
+// Close flushes the client's sessions and forgets its objects.
+func (c *Client) Close() error {
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	delete(c.p.clients, c)
+	return c.close()
+}
+
+func (c *Client) close() error {
+	c.closed = true
+	c.objects = nil
+	var errs []error
+	for h := range c.sessions {
+		// A saved session is flushed by its handle just as a loaded one.
+		// It may already be gone, for example after a TPM reset.
+		if _, err := (tpm2.FlushContext{FlushHandle: h}).Execute(c.p.tpm); err != nil && !errors.Is(err, tpm2.TPMRCHandle) {
+			errs = append(errs, fmt.Errorf("flushing session 0x%08x: %w", uint32(h), err))
+		}
+	}
+	c.sessions = nil
+	return errors.Join(errs...)
+}
+
+// Send implements transport.TPM.
+func (c *Client) Send(cmd []byte) ([]byte, error) {
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+	if c.closed || c.p.closed {
+		return nil, ErrClosed
+	}
+	if len(cmd) < 10 {
+		return c.p.tpm.Send(cmd)
+	}
+	cc := tpmcmd.CommandCode(cmd)
+	if cc == tpm2.TPMCCFlushContext && len(cmd) >= 14 {
+		return c.flush(cmd)
+	}
+	attrs, ok, err := c.p.commandAttributes(cc)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// Let the TPM reject the command.
+		return c.p.tpm.Send(cmd)
+	}
+
+	x := &exchange{c: c, cmd: bytes.Clone(cmd), objects: make(map[tpm2.TPMHandle]tpm2.TPMHandle)}
+	rsp, err := x.run(cc, attrs)
+	if serr := x.save(); err == nil {
+		err = serr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// flush handles TPM2_FlushContext, whose handle is a parameter rather than
+// in the handle area.
+func (c *Client) flush(cmd []byte) ([]byte, error) {
+	h := tpm2.TPMHandle(binary.BigEndian.Uint32(cmd[10:14]))
+	switch {
+	case handles.IsTransient(h):
+		if _, ok := c.objects[h]; !ok {
+			return tpmcmd.ErrorResponse(tpm2.TPMRCHandle + tpmcmd.RCP + tpmcmd.RC1), nil
+		}
+		// The object is not in the TPM, so there is nothing to flush.
+		delete(c.objects, h)
+		return tpmcmd.SuccessResponse(), nil
+	case handles.IsSession(h):
+		if _, ok := c.sessions[h]; !ok {
+			return tpmcmd.ErrorResponse(tpm2.TPMRCHandle + tpmcmd.RCP + tpmcmd.RC1), nil
+		}
+		rsp, err := c.p.tpm.Send(cmd)
+		if err == nil && tpmcmd.ResponseCode(rsp) == 0 {
+			delete(c.sessions, h)
+		}
+		return rsp, err
+	}
+	return c.p.tpm.Send(cmd)
+}
+
+// exchange is one command from a client, with the objects and sessions that
+// were loaded for it.
+type exchange struct {
+	c   *Client
+	cmd []byte
+	// objects maps the physical handle of each object loaded for the
+	// command to its virtual handle.
+	objects map[tpm2.TPMHandle]tpm2.TPMHandle
+	// sessions are the sessions loaded for the command.
+	sessions []tpm2.TPMHandle
+}
+
+// run loads what the command uses, sends it and records the objects and
+// sessions it creates or ends.
+func (x *exchange) run(cc tpm2.TPMCC, attrs tpm2.TPMACC) ([]byte, error) {
+	c := x.c
+	nh := int(attrs.CHandles)
+	if len(x.cmd) < 10+4*nh {
+		return c.p.tpm.Send(x.cmd)
+	}
+	// ended are the objects and sessions that the command ends, and saved
+	// the sessions that it saves for the client.
+	var ended, saved []tpm2.TPMHandle
+	for i := 0; i < nh; i++ {
+		off := 10 + 4*i
+		h := tpm2.TPMHandle(binary.BigEndian.Uint32(x.cmd[off:]))
+		switch {
+		case handles.IsTransient(h):
+			phys, err := x.loadObject(h)
+			if err != nil {
+				return nil, err
+			}
+			if phys == 0 {
+				return tpmcmd.ErrorResponse(tpm2.TPMRCHandle + tpm2.TPMRC(i+1)*tpmcmd.RC1), nil
+			}
+			binary.BigEndian.PutUint32(x.cmd[off:], uint32(phys))
+			if attrs.Flushed {
+				ended = append(ended, h)
+			}
+		case handles.IsSession(h):
+			ok, err := x.loadSession(h)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return tpmcmd.ErrorResponse(tpm2.TPMRCHandle + tpm2.TPMRC(i+1)*tpmcmd.RC1), nil
+			}
+			if cc == tpm2.TPMCCContextSave {
+				saved = append(saved, h)
+			}
+		}
+	}
+
+	// Load the sessions in the authorization area, and note those that the
+	// command ends.
+	for i, auth := range tpmcmd.AuthSessions(x.cmd, nh) {
+		if !handles.IsSession(auth.Handle) {
+			continue
+		}
+		ok, err := x.loadSession(auth.Handle)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return tpmcmd.ErrorResponse(tpm2.TPMRCHandle + tpmcmd.RCS + tpm2.TPMRC(i+1)*tpmcmd.RC1), nil
+		}
+		if !auth.ContinueSession() {
+			ended = append(ended, auth.Handle)
+		}
+	}
+
+	rsp, err := c.p.tpm.Send(x.cmd)
+	if err != nil || tpmcmd.ResponseCode(rsp) != 0 {
+		return rsp, err
+	}
+	for _, h := range ended {
+		x.end(h)
+	}
+	for _, h := range saved {
+		c.sessions[h] = nil
+		x.sessions = remove(x.sessions, h)
+	}
+	if attrs.RHandle && len(rsp) >= 14 {
+		h := tpm2.TPMHandle(binary.BigEndian.Uint32(rsp[10:14]))
+		switch {
+		case handles.IsTransient(h):
+			if c.next > handles.TransientLast {
+				tpm2.FlushContext{FlushHandle: h}.Execute(c.p.tpm)
+				return nil, ErrHandlesExhausted
+			}
+			virt := c.next
+			c.next++
+			x.objects[h] = virt
+			rsp = bytes.Clone(rsp)
+			binary.BigEndian.PutUint32(rsp[10:], uint32(virt))
+		case handles.IsSession(h):
+			c.sessions[h] = nil
+			x.sessions = append(x.sessions, h)
+		}
+	}
+	return rsp, nil
+}
+
+// loadObject loads the object with the given virtual handle and returns its
+// physical handle, or 0 if the client has no such object.
+func (x *exchange) loadObject(virt tpm2.TPMHandle) (tpm2.TPMHandle, error) {
+	for phys, v := range x.objects {
+		if v == virt {
+			return phys, nil
+		}
+	}
+	ctx, ok := x.c.objects[virt]
+	if !ok {
+		return 0, nil
+	}
+	rsp, err := tpm2.ContextLoad{Context: ctx}.Execute(x.c.p.tpm)
+	if err != nil {
+		return 0, fmt.Errorf("loading object 0x%08x: %w", uint32(virt), err)
+	}
+	x.objects[rsp.LoadedHandle] = virt
+	return rsp.LoadedHandle, nil
+}
+
+// loadSession loads one of the client's sessions, and reports whether the
+// client has it.
+func (x *exchange) loadSession(h tpm2.TPMHandle) (bool, error) {
+	ctx, ok := x.c.sessions[h]
+	if !ok {
+		return false, nil
+	}
+	for _, loaded := range x.sessions {
+		if loaded == h {
+			return true, nil
+		}
+	}
+	if ctx == nil {
+		// The client saved the session itself. Let the TPM report it
+		// if it hasn't been loaded again.
+		return true, nil
+	}
+	if _, err := (tpm2.ContextLoad{Context: *ctx}).Execute(x.c.p.tpm); err != nil {
+		return false, fmt.Errorf("loading session 0x%08x: %w", uint32(h), err)
+	}
+	x.sessions = append(x.sessions, h)
+	return true, nil
+}
+
+// end records that the command flushed the object or session with the given
+// handle, which is virtual for objects.
+func (x *exchange) end(h tpm2.TPMHandle) {
+	if handles.IsSession(h) {
+		delete(x.c.sessions, h)
+		x.sessions = remove(x.sessions, h)
+		return
+	}
+	delete(x.c.objects, h)
+	for phys, virt := range x.objects {
+		if virt == h {
+			delete(x.objects, phys)
+		}
+	}
+}
+
+func remove(hs []tpm2.TPMHandle, h tpm2.TPMHandle) []tpm2.TPMHandle {
+	for i, other := range hs {
+		if other == h {
+			return append(hs[:i], hs[i+1:]...)
+		}
+	}
+	return hs
+}
+
+// save saves the contexts of the objects and sessions loaded for the
+// command, which takes the objects out of the TPM.
+func (x *exchange) save() error {
+	var errs []error
+	p := x.c.p
+	for phys, virt := range x.objects {
+		rsp, err := tpm2.ContextSave{SaveHandle: phys}.Execute(p.tpm)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("saving object 0x%08x: %w", uint32(virt), err))
+			delete(x.c.objects, virt)
+		} else {
+			x.c.objects[virt] = rsp.Context
+		}
+		if _, err := (tpm2.FlushContext{FlushHandle: phys}).Execute(p.tpm); err != nil {
+			errs = append(errs, fmt.Errorf("flushing object 0x%08x: %w", uint32(virt), err))
+		}
+	}
+	for _, h := range x.sessions {
+		rsp, err := tpm2.ContextSave{SaveHandle: h}.Execute(p.tpm)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("saving session 0x%08x: %w", uint32(h), err))
+			continue
+		}
+		x.c.sessions[h] = &rsp.Context
+	}
+	return errors.Join(errs...)
+}
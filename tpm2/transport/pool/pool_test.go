@@ -0,0 +1,258 @@
+package pool
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/handles"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// keyedHash returns a template for an HMAC key, which is quick to create,
+// made unique by id.
+func keyedHash(id string) tpm2.TPMTPublic {
+	return tpm2.TPMTPublic{
+		Type:    tpm2.TPMAlgKeyedHash,
+		NameAlg: tpm2.TPMAlgSHA256,
+		ObjectAttributes: tpm2.TPMAObject{
+			FixedTPM:            true,
+			FixedParent:         true,
+			SensitiveDataOrigin: true,
+			UserWithAuth:        true,
+			SignEncrypt:         true,
+		},
+		Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgKeyedHash, &tpm2.TPMSKeyedHashParms{
+			Scheme: tpm2.TPMTKeyedHashScheme{
+				Scheme: tpm2.TPMAlgHMAC,
+				Details: tpm2.NewTPMUSchemeKeyedHash(tpm2.TPMAlgHMAC, &tpm2.TPMSSchemeHMAC{
+					HashAlg: tpm2.TPMAlgSHA256,
+				}),
+			},
+		}),
+		Unique: tpm2.NewTPMUPublicID(tpm2.TPMAlgKeyedHash, &tpm2.TPM2BDigest{Buffer: []byte(id)}),
+	}
+}
+
+func createPrimary(t *testing.T, tpm transport.TPM, id string) *tpm2.CreatePrimaryResponse {
+	t.Helper()
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(keyedHash(id)),
+	}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	return rsp
+}
+
+// loaded returns the handles of the given type loaded in the TPM.
+func loaded(t *testing.T, tpm transport.TPM, first uint32) []tpm2.TPMHandle {
+	t.Helper()
+	rsp, err := tpm2.GetCapability{
+		Capability:    tpm2.TPMCapHandles,
+		Property:      first,
+		PropertyCount: 64,
+	}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("GetCapability: %v", err)
+	}
+	hs, err := rsp.CapabilityData.Data.Handles()
+	if err != nil {
+		t.Fatalf("Handles: %v", err)
+	}
+	var out []tpm2.TPMHandle
+	for _, h := range hs.Handle {
+		if h>>24 == tpm2.TPMHandle(first>>24) {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+func newPool(t *testing.T) (*Pool, transport.TPM) {
+	t.Helper()
+	sim, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	t.Cleanup(func() { sim.Close() })
+	p := New(sim)
+	t.Cleanup(func() { p.Close() })
+	return p, sim
+}
+
+func TestVirtualHandles(t *testing.T) {
+	p, sim := newPool(t)
+	a, err := p.Client()
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+	b, err := p.Client()
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+
+	// More objects than the simulator has slots for stay usable.
+	var keys []*tpm2.CreatePrimaryResponse
+	for i := 0; i < 5; i++ {
+		keys = append(keys, createPrimary(t, a, fmt.Sprintf("a%d", i)))
+	}
+	if got := loaded(t, sim, handles.TransientFirst); len(got) != 0 {
+		t.Errorf("objects %x are left loaded in the TPM", got)
+	}
+	for _, key := range keys {
+		rsp, err := tpm2.ReadPublic{ObjectHandle: key.ObjectHandle}.Execute(a)
+		if err != nil {
+			t.Fatalf("ReadPublic(0x%x): %v", key.ObjectHandle, err)
+		}
+		if !bytes.Equal(rsp.Name.Buffer, key.Name.Buffer) {
+			t.Errorf("ReadPublic(0x%x) returned the Name of another object", key.ObjectHandle)
+		}
+	}
+
+	// Each client has its own handles.
+	keyB := createPrimary(t, b, "b")
+	if keyB.ObjectHandle != keys[0].ObjectHandle {
+		t.Errorf("second client's first handle is 0x%x, want 0x%x", keyB.ObjectHandle, keys[0].ObjectHandle)
+	}
+	if _, err := (tpm2.ReadPublic{ObjectHandle: keys[1].ObjectHandle}).Execute(b); !errors.Is(err, tpm2.TPMRCHandle) {
+		t.Errorf("ReadPublic of another client's object = %v, want %v", err, tpm2.TPMRCHandle)
+	}
+
+	// Objects can be used as authorized handles, and are flushed by
+	// commands that flush them in the TPM.
+	sign := tpm2.HmacStart{
+		Handle:  tpm2.AuthHandle{Handle: keys[2].ObjectHandle, Name: keys[2].Name, Auth: tpm2.PasswordAuth(nil)},
+		HashAlg: tpm2.TPMAlgNull,
+	}
+	seq, err := sign.Execute(a)
+	if err != nil {
+		t.Fatalf("HmacStart: %v", err)
+	}
+	if _, err := (tpm2.SequenceComplete{
+		SequenceHandle: tpm2.AuthHandle{Handle: seq.SequenceHandle, Auth: tpm2.PasswordAuth(nil)},
+		Buffer:         tpm2.TPM2BMaxBuffer{Buffer: []byte("data")},
+		Hierarchy:      tpm2.TPMRHOwner,
+	}).Execute(a); err != nil {
+		t.Fatalf("SequenceComplete: %v", err)
+	}
+	if _, err := (tpm2.FlushContext{FlushHandle: seq.SequenceHandle}).Execute(a); !errors.Is(err, tpm2.TPMRCHandle) {
+		t.Errorf("FlushContext of a completed sequence = %v, want %v", err, tpm2.TPMRCHandle)
+	}
+	if _, err := (tpm2.FlushContext{FlushHandle: keys[0].ObjectHandle}).Execute(a); err != nil {
+		t.Fatalf("FlushContext: %v", err)
+	}
+	if _, err := (tpm2.ReadPublic{ObjectHandle: keys[0].ObjectHandle}).Execute(a); !errors.Is(err, tpm2.TPMRCHandle) {
+		t.Errorf("ReadPublic of a flushed object = %v, want %v", err, tpm2.TPMRCHandle)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	p, sim := newPool(t)
+	a, err := p.Client()
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+	b, err := p.Client()
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+
+	key := createPrimary(t, a, "key")
+	sess, cleanup, err := tpm2.HMACSession(a, tpm2.TPMAlgSHA256, 16)
+	if err != nil {
+		t.Fatalf("HMACSession: %v", err)
+	}
+	defer cleanup()
+	// The session's nonces change with every command, so it must be saved
+	// again after each one.
+	for i := 0; i < 3; i++ {
+		seq, err := tpm2.HmacStart{
+			Handle:  tpm2.AuthHandle{Handle: key.ObjectHandle, Name: key.Name, Auth: sess},
+			HashAlg: tpm2.TPMAlgNull,
+		}.Execute(a)
+		if err != nil {
+			t.Fatalf("HmacStart with session: %v", err)
+		}
+		if _, err := (tpm2.FlushContext{FlushHandle: seq.SequenceHandle}).Execute(a); err != nil {
+			t.Fatalf("FlushContext: %v", err)
+		}
+	}
+	if got := loaded(t, sim, uint32(tpm2.TPMHTLoadedSession)<<24); len(got) != 0 {
+		t.Errorf("sessions %x are left loaded in the TPM", got)
+	}
+	keyB := createPrimary(t, b, "key")
+	if _, err := (tpm2.HmacStart{
+		Handle:  tpm2.AuthHandle{Handle: keyB.ObjectHandle, Name: keyB.Name, Auth: sess},
+		HashAlg: tpm2.TPMAlgNull,
+	}).Execute(b); !errors.Is(err, tpm2.TPMRCHandle) {
+		t.Errorf("HmacStart with another client's session = %v, want %v", err, tpm2.TPMRCHandle)
+	}
+
+	// Closing a client flushes its sessions, including those not ended
+	// yet.
+	if _, _, err := tpm2.HMACSession(b, tpm2.TPMAlgSHA256, 16); err != nil {
+		t.Fatalf("HMACSession: %v", err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := cleanup(); err != nil {
+		t.Fatalf("ending session: %v", err)
+	}
+	for _, first := range []tpm2.TPMHT{tpm2.TPMHTLoadedSession, tpm2.TPMHTSavedSession} {
+		if got := loaded(t, sim, uint32(first)<<24); len(got) != 0 {
+			t.Errorf("sessions %x are left in the TPM", got)
+		}
+	}
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(b); !errors.Is(err, ErrClosed) {
+		t.Errorf("GetRandom on a closed client = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestConcurrentClients(t *testing.T) {
+	p, _ := newPool(t)
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := p.Client()
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer c.Close()
+			for j := 0; j < 4; j++ {
+				key, err := tpm2.CreatePrimary{
+					PrimaryHandle: tpm2.TPMRHOwner,
+					InPublic:      tpm2.New2B(keyedHash(fmt.Sprintf("%d/%d", i, j))),
+				}.Execute(c)
+				if err != nil {
+					errs <- err
+					return
+				}
+				rsp, err := tpm2.ReadPublic{ObjectHandle: key.ObjectHandle}.Execute(c)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(rsp.Name.Buffer, key.Name.Buffer) {
+					errs <- fmt.Errorf("client %d read another object at 0x%x", i, key.ObjectHandle)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,97 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// Result is the response to a command submitted to a Queue, or the error
+// that prevented it.
+type Result struct {
+	Response []byte
+	Err      error
+}
+
+// ErrQueueClosed is the error for commands submitted to a closed Queue.
+var ErrQueueClosed = errors.New("transport: queue closed")
+
+// Queue sends commands to a TPM in the background, so that a caller can
+// submit several independent commands, such as PCR reads and GetRandom, and
+// collect the responses later, overlapping its own work (including
+// marshalling the next command and parsing the last response) with the
+// TPM's.
+//
+// Commands are sent one at a time, in the order in which they were
+// submitted: a command is sent only once the response to the command
+// submitted before it has arrived. This holds whichever goroutines submit
+// the commands; Submit calls that race are ordered as their calls to the
+// Queue happen to be serialized. While a Queue is in use, every command for
+// its TPM must go through it, or the order is not guaranteed.
+//
+// A Queue is safe for concurrent use, even if its TPM is not.
+type Queue struct {
+	tpm TPM
+
+	mu     sync.Mutex
+	last   chan struct{} // closed once the last submitted command is done
+	closed bool
+}
+
+// NewQueue returns a Queue that sends commands to t.
+func NewQueue(t TPM) *Queue {
+	last := make(chan struct{})
+	close(last)
+	return &Queue{tpm: t, last: last}
+}
+
+// Submit queues cmd and returns at once. The returned channel receives the
+// result once the commands submitted before cmd have completed and t has
+// answered cmd. The caller must not modify cmd until then.
+func (q *Queue) Submit(cmd []byte) <-chan Result {
+	ch := make(chan Result, 1)
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		ch <- Result{Err: ErrQueueClosed}
+		return ch
+	}
+	prev, done := q.last, make(chan struct{})
+	q.last = done
+	q.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		<-prev
+		rsp, err := q.tpm.Send(cmd)
+		ch <- Result{Response: rsp, Err: err}
+	}()
+	return ch
+}
+
+// Send implements the TPM interface. It submits cmd and waits for its
+// result, so that commands sent with it are ordered with the submitted
+// ones.
+func (q *Queue) Send(cmd []byte) ([]byte, error) {
+	r := <-q.Submit(cmd)
+	return r.Response, r.Err
+}
+
+// Unwrap implements the Wrapper interface.
+func (q *Queue) Unwrap() TPM {
+	return q.tpm
+}
+
+// Close stops the Queue from accepting commands, waits for the submitted
+// ones to complete and closes t, if it can be closed.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	q.closed = true
+	last := q.last
+	q.mu.Unlock()
+	<-last
+	if closer, ok := q.tpm.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
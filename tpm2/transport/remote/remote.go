@@ -0,0 +1,218 @@
+// Package remote sends TPM commands to a TPM on another machine, through an
+// agent that forwards them to its local TPM, so that a fleet can reach its
+// TPMs from a central service.
+//
+// Commands and responses travel as raw TPM command buffers in the bodies of
+// HTTPS POST requests. Unlike package bridge, which offers a fixed set of
+// safe operations, the agent forwards any command, so it must only accept
+// callers that are trusted with the whole TPM; Server refuses to run without
+// a way of authenticating them.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+const (
+	// maxMessageSize bounds the size of commands and responses.
+	maxMessageSize = 1 << 16
+	// defaultTimeout is how long a command may take by default, allowing
+	// for slow key generation on discrete TPMs.
+	defaultTimeout = 2 * time.Minute
+	// contentType is the media type of commands and responses.
+	contentType = "application/octet-stream"
+)
+
+// ErrUnauthenticated is returned by an authenticator passed to NewServer to
+// reject a request, and by TPM.Send when the agent rejected it.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// checkMessage checks that msg is a complete TPM command or response.
+func checkMessage(msg []byte) error {
+	if len(msg) < 10 {
+		return fmt.Errorf("message too short: %d bytes", len(msg))
+	}
+	if size := binary.BigEndian.Uint32(msg[2:6]); int(size) != len(msg) {
+		return fmt.Errorf("message size field is %d, but message is %d bytes", size, len(msg))
+	}
+	return nil
+}
+
+// Config configures a connection to an agent.
+type Config struct {
+	// URL is the agent's URL, such as "https://agent.example:8443/tpm".
+	URL string
+	// TLSConfig configures the TLS connection, for example with the
+	// agent's CA and the client's certificate.
+	TLSConfig *tls.Config
+	// Header is added to every request, for example to carry a bearer
+	// token.
+	Header http.Header
+	// Timeout bounds each command sent with Send. Zero selects two
+	// minutes.
+	Timeout time.Duration
+}
+
+// TPM is a connection to a remote TPM. It is safe for concurrent use.
+type TPM struct {
+	client  *http.Client
+	url     string
+	header  http.Header
+	timeout time.Duration
+}
+
+var _ transport.TPMCloser = (*TPM)(nil)
+
+// Open returns a connection to the agent at config.URL. Nothing is sent
+// until the first command.
+func Open(config Config) (*TPM, error) {
+	if config.URL == "" {
+		return nil, errors.New("no agent URL configured")
+	}
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	return &TPM{
+		client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig:   config.TLSConfig,
+				ForceAttemptHTTP2: true,
+			},
+		},
+		url:     config.URL,
+		header:  config.Header.Clone(),
+		timeout: timeout,
+	}, nil
+}
+
+// Send implements transport.TPM, waiting at most the configured timeout.
+func (t *TPM) Send(cmd []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	return t.SendContext(ctx, cmd)
+}
+
+// SendContext sends cmd and returns the response, giving up when ctx is
+// done. A command that is abandoned may still run on the remote TPM.
+func (t *TPM) SendContext(ctx context.Context, cmd []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(cmd))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range t.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	rsp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(rsp.Body, maxMessageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	switch rsp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, ErrUnauthenticated
+	default:
+		return nil, fmt.Errorf("agent returned %s: %s", rsp.Status, bytes.TrimSpace(body))
+	}
+	if len(body) > maxMessageSize {
+		return nil, fmt.Errorf("response larger than %d bytes", maxMessageSize)
+	}
+	if err := checkMessage(body); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return body, nil
+}
+
+// Close closes idle connections to the agent.
+func (t *TPM) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// Server is an http.Handler that forwards the commands it receives to a
+// local TPM, one at a time. All clients share the TPM connection, so any
+// transient objects and sessions they create are visible to each other.
+type Server struct {
+	tpm  transport.TPM
+	auth func(*http.Request) error
+
+	// mu serializes access to the TPM.
+	mu sync.Mutex
+}
+
+// NewServer returns a Server that forwards commands to t. auth decides
+// whether a request may use the TPM, returning nil to allow it; a
+// bridge.Authenticator such as bridge.BearerToken may be used. If auth is
+// nil, only requests over TLS with a verified client certificate are
+// allowed.
+func NewServer(t transport.TPM, auth func(*http.Request) error) *Server {
+	if auth == nil {
+		auth = verifiedClientCert
+	}
+	return &Server{tpm: t, auth: auth}
+}
+
+// verifiedClientCert accepts requests whose TLS client certificate was
+// verified.
+func verifiedClientCert(r *http.Request) error {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return ErrUnauthenticated
+	}
+	return nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.auth(r); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	cmd, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading command: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := checkMessage(cmd); err != nil {
+		http.Error(w, fmt.Sprintf("invalid command: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Don't start a command for a client that has already given up, for
+	// example while waiting for another client's command.
+	s.mu.Lock()
+	if err := r.Context().Err(); err != nil {
+		s.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	rsp, err := s.tpm.Send(cmd)
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(rsp)
+}
@@ -0,0 +1,165 @@
+package remote
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+	testhelper "github.com/google/go-tpm/tpm2/transport/test"
+)
+
+// clientCert returns a self-signed client certificate.
+func clientCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newTestServer starts an agent for the simulator that requires client
+// certificates, and returns it with a certificate it accepts.
+func newTestServer(t *testing.T, tpm transport.TPM) (*httptest.Server, tls.Certificate) {
+	t.Helper()
+	cert := clientCert(t)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(leaf)
+
+	ts := httptest.NewUnstartedServer(NewServer(tpm, nil))
+	ts.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: clientCAs}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts, cert
+}
+
+// tlsConfig returns a client TLS configuration trusting ts.
+func tlsConfig(ts *httptest.Server, certs ...tls.Certificate) *tls.Config {
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	return &tls.Config{RootCAs: roots, Certificates: certs}
+}
+
+func TestRemote(t *testing.T) {
+	sim, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer sim.Close()
+	ts, cert := newTestServer(t, sim)
+
+	testhelper.RunTest(t, nil, func() (transport.TPMCloser, error) {
+		return Open(Config{URL: ts.URL, TLSConfig: tlsConfig(ts, cert)})
+	})
+
+	// Without a client certificate, the agent refuses commands.
+	tpm, err := Open(Config{URL: ts.URL, TLSConfig: tlsConfig(ts)})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tpm.Close()
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(tpm); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("GetRandom() without a client certificate = %v, want %v", err, ErrUnauthenticated)
+	}
+}
+
+func TestHeaderAuth(t *testing.T) {
+	sim, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer sim.Close()
+	ts := httptest.NewTLSServer(NewServer(sim, func(r *http.Request) error {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			return ErrUnauthenticated
+		}
+		return nil
+	}))
+	defer ts.Close()
+
+	tpm, err := Open(Config{
+		URL:       ts.URL,
+		TLSConfig: tlsConfig(ts),
+		Header:    http.Header{"Authorization": {"Bearer token"}},
+	})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tpm.Close()
+	rsp, err := tpm2.GetRandom{BytesRequested: 8}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("GetRandom: %v", err)
+	}
+	if len(rsp.RandomBytes.Buffer) != 8 {
+		t.Errorf("GetRandom returned %d bytes, want 8", len(rsp.RandomBytes.Buffer))
+	}
+}
+
+// slowTPM delays every command.
+type slowTPM struct {
+	tpm   transport.TPM
+	delay time.Duration
+}
+
+func (s slowTPM) Send(cmd []byte) ([]byte, error) {
+	time.Sleep(s.delay)
+	return s.tpm.Send(cmd)
+}
+
+func TestDeadline(t *testing.T) {
+	sim, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer sim.Close()
+	ts, cert := newTestServer(t, slowTPM{tpm: sim, delay: 200 * time.Millisecond})
+
+	tpm, err := Open(Config{URL: ts.URL, TLSConfig: tlsConfig(ts, cert), Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tpm.Close()
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(tpm); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetRandom() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	cmd := []byte{0x80, 0x01, 0, 0, 0, 0x0c, 0, 0, 0x01, 0x7b, 0, 8} // TPM2_GetRandom(8)
+	rsp, err := tpm.SendContext(ctx, cmd)
+	if err != nil {
+		t.Fatalf("SendContext: %v", err)
+	}
+	if len(rsp) != 10+2+8 {
+		t.Errorf("SendContext returned %d bytes, want 20", len(rsp))
+	}
+}
@@ -0,0 +1,199 @@
+// Package replay records the commands sent to a TPM and the responses it
+// gave, and replays them later without the TPM. Tests can record an exchange
+// with a real TPM or simulator once, check the recording in, and then run
+// hermetically against it.
+//
+// Recordings are text, with one exchange per pair of lines:
+//
+//	# Comments and blank lines are ignored.
+//	> 80010000000c0000017b0008
+//	< 8001000000140000000000080102030405060708
+//
+// where ">" introduces a command and "<" the TPM's response, in hex.
+//
+// Replay only works for code that sends the same commands each time, such as
+// code that only uses password authorization. Every session, salted or not
+// and policy or HMAC, starts with a random nonceCaller, so the commands that
+// start and use it differ each run. Code under test that uses sessions needs
+// MatchCommandCode, and then only replays if it checks nothing that depends
+// on the nonces; HMAC sessions, whose response HMACs don't verify against
+// the new nonces, never do.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// headerSize is the size of a command header: tag, size and command code.
+const headerSize = 10
+
+var (
+	// ErrMismatch is returned by Send when a command differs from the one
+	// recorded next.
+	ErrMismatch = errors.New("replay: command differs from the recording")
+	// ErrExhausted is returned by Send once every recorded exchange has
+	// been replayed.
+	ErrExhausted = errors.New("replay: no more recorded exchanges")
+	// ErrUnused is returned by Close when some recorded exchanges were
+	// never replayed.
+	ErrUnused = errors.New("replay: recorded exchanges were not replayed")
+)
+
+// Exchange is a command and the response the TPM gave to it.
+type Exchange struct {
+	Command  []byte
+	Response []byte
+}
+
+// Record returns a TPM that sends commands to t and writes each command and
+// its response to w. Commands that fail in the transport, rather than with a
+// TPM response code, are not recorded. If writing the recording fails, Send
+// returns the error after the command has been executed.
+func Record(t transport.TPM, w io.Writer) transport.TPMCloser {
+	var mu sync.Mutex
+	return transport.Chain(t, func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+		rsp, err := next(cmd)
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := fmt.Fprintf(w, "> %x\n< %x\n", cmd, rsp); err != nil {
+			return rsp, fmt.Errorf("replay: recording: %w", err)
+		}
+		return rsp, nil
+	})
+}
+
+// Parse reads a recording written by Record.
+func Parse(r io.Reader) ([]Exchange, error) {
+	var exchanges []Exchange
+	var cmd []byte
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dir, data, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("replay: line %d: missing direction", n)
+		}
+		b, err := hex.DecodeString(strings.TrimSpace(data))
+		if err != nil {
+			return nil, fmt.Errorf("replay: line %d: %w", n, err)
+		}
+		switch {
+		case dir == ">" && cmd == nil:
+			cmd = b
+		case dir == "<" && cmd != nil:
+			exchanges = append(exchanges, Exchange{Command: cmd, Response: b})
+			cmd = nil
+		default:
+			return nil, fmt.Errorf("replay: line %d: unexpected %q", n, dir)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	if cmd != nil {
+		return nil, errors.New("replay: last command has no response")
+	}
+	return exchanges, nil
+}
+
+// Match decides whether a command matches the recorded one.
+type Match func(cmd, recorded []byte) bool
+
+// MatchExact matches commands that are byte-for-byte the same as the
+// recorded ones. It is the default.
+func MatchExact(cmd, recorded []byte) bool {
+	return bytes.Equal(cmd, recorded)
+}
+
+// MatchCommandCode matches commands with the same command code as the
+// recorded ones, whatever their handles, parameters and authorizations.
+func MatchCommandCode(cmd, recorded []byte) bool {
+	return len(cmd) >= headerSize && len(recorded) >= headerSize &&
+		binary.BigEndian.Uint32(cmd[6:headerSize]) == binary.BigEndian.Uint32(recorded[6:headerSize])
+}
+
+// TPM replays recorded exchanges. Each command sent to it must match the
+// next recorded one, in order, and gets the recorded response. It is safe for
+// concurrent use, but exchanges are replayed in the order commands arrive.
+type TPM struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+	next      int
+	match     Match
+}
+
+var _ transport.TPMCloser = (*TPM)(nil)
+
+// New returns a TPM that replays exchanges, matching commands with match. A
+// nil match is MatchExact.
+func New(exchanges []Exchange, match Match) *TPM {
+	if match == nil {
+		match = MatchExact
+	}
+	return &TPM{exchanges: exchanges, match: match}
+}
+
+// OpenFile returns a TPM that replays the recording in the named file,
+// matching commands exactly.
+func OpenFile(name string) (*TPM, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	exchanges, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return New(exchanges, nil), nil
+}
+
+// Send implements the TPM interface.
+func (t *TPM) Send(cmd []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.next == len(t.exchanges) {
+		return nil, fmt.Errorf("%w: got %x", ErrExhausted, cmd)
+	}
+	x := t.exchanges[t.next]
+	if !t.match(cmd, x.Command) {
+		return nil, fmt.Errorf("%w: exchange %d: got %x, want %x", ErrMismatch, t.next+1, cmd, x.Command)
+	}
+	t.next++
+	return bytes.Clone(x.Response), nil
+}
+
+// Remaining returns how many recorded exchanges have not been replayed.
+func (t *TPM) Remaining() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.exchanges) - t.next
+}
+
+// Close implements the io.Closer interface. It returns ErrUnused if some
+// recorded exchanges were not replayed, so that tests notice when code stops
+// sending commands it used to.
+func (t *TPM) Close() error {
+	if n := t.Remaining(); n != 0 {
+		return fmt.Errorf("%w: %d left", ErrUnused, n)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// exercise creates a primary key and reads some random bytes, returning the
+// key's Name and the bytes.
+func exercise(t *testing.T, tpm transport.TPM) ([]byte, []byte) {
+	t.Helper()
+	srk, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	if _, err := (tpm2.FlushContext{FlushHandle: srk.ObjectHandle}).Execute(tpm); err != nil {
+		t.Fatalf("FlushContext: %v", err)
+	}
+	rnd, err := tpm2.GetRandom{BytesRequested: 16}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("GetRandom: %v", err)
+	}
+	return srk.Name.Buffer, rnd.RandomBytes.Buffer
+}
+
+func TestRecordReplay(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	var rec bytes.Buffer
+	name, rnd := exercise(t, Record(thetpm, &rec))
+
+	path := filepath.Join(t.TempDir(), "exchanges.txt")
+	if err := os.WriteFile(path, append([]byte("# CreatePrimary, FlushContext, GetRandom\n\n"), rec.Bytes()...), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	replayed, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if n := replayed.Remaining(); n != 3 {
+		t.Errorf("Remaining() = %d, want 3", n)
+	}
+	gotName, gotRnd := exercise(t, replayed)
+	if !bytes.Equal(gotName, name) || !bytes.Equal(gotRnd, rnd) {
+		t.Errorf("replay gave Name %x and random bytes %x, want %x and %x", gotName, gotRnd, name, rnd)
+	}
+	if err := replayed.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if _, err := (tpm2.GetRandom{BytesRequested: 16}).Execute(replayed); !errors.Is(err, ErrExhausted) {
+		t.Errorf("GetRandom() after the recording = %v, want %v", err, ErrExhausted)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	thetpm, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer thetpm.Close()
+
+	var rec bytes.Buffer
+	if _, err := (tpm2.GetRandom{BytesRequested: 16}).Execute(Record(thetpm, &rec)); err != nil {
+		t.Fatalf("GetRandom: %v", err)
+	}
+	exchanges, err := Parse(&rec)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	exact := New(exchanges, nil)
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(exact); !errors.Is(err, ErrMismatch) {
+		t.Errorf("GetRandom(8) = %v, want %v", err, ErrMismatch)
+	}
+	if err := exact.Close(); !errors.Is(err, ErrUnused) {
+		t.Errorf("Close() = %v, want %v", err, ErrUnused)
+	}
+
+	byCode := New(exchanges, MatchCommandCode)
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(byCode); err != nil {
+		t.Errorf("GetRandom(8) with MatchCommandCode: %v", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+	}{
+		{"NoDirection", "8001\n"},
+		{"BadHex", "> 80zz\n< 8001\n"},
+		{"ResponseFirst", "< 8001\n"},
+		{"TwoCommands", "> 8001\n> 8001\n"},
+		{"NoResponse", "> 8001\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tc.in)); err == nil {
+				t.Error("Parse succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package rmmux
+
+import (
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/linuxtpm"
+)
+
+// DefaultPath is the Linux kernel resource manager's device file.
+const DefaultPath = "/dev/tpmrm0"
+
+// Open opens size connections to the resource manager device at path.
+func Open(path string, size int) (*Mux, error) {
+	return New(size, func() (transport.TPMCloser, error) {
+		return linuxtpm.Open(path)
+	})
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package rmmux
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/linuxtpm"
+	testhelper "github.com/google/go-tpm/tpm2/transport/test"
+)
+
+func TestLocalResourceManager(t *testing.T) {
+	testhelper.RunTest(t, []error{os.ErrNotExist, os.ErrPermission, linuxtpm.ErrFileIsNotDevice}, func() (transport.TPMCloser, error) {
+		return Open(DefaultPath, 2)
+	})
+}
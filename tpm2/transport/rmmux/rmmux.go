@@ -0,0 +1,224 @@
+// Package rmmux multiplexes TPM commands from many goroutines over a pool of
+// connections to a TPM resource manager, such as the Linux kernel's
+// /dev/tpmrm0.
+//
+// Every connection to a resource manager gets its own virtual view of the
+// TPM: transient objects and sessions created on one connection cannot be
+// used from another, but commands on different connections may be in flight
+// at the same time. A Mux holds several connections and offers two ways to
+// use them:
+//
+//   - Mux.Send runs each command on whichever connection is free first. It
+//     is intended for stateless traffic such as signing with persistent keys
+//     and password authorization, and refuses commands that would create a
+//     transient object or session.
+//   - Mux.Lane returns a transport pinned to a single connection. Sessions
+//     and objects created through a lane stay usable through it, and its
+//     commands are sent in the order in which Send was called.
+package rmmux
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+var (
+	// ErrClosed indicates that the Mux or Lane has been closed.
+	ErrClosed = errors.New("rmmux: closed")
+	// ErrTransientState indicates that a command sent through Mux.Send
+	// would create a transient object or session, which would then only
+	// be usable on an unpredictable connection.
+	ErrTransientState = errors.New("rmmux: command creates transient state; use a Lane")
+)
+
+// stateCreators are the commands that create a transient object or session
+// in the connection's view of the TPM.
+var stateCreators = map[tpm2.TPMCC]bool{
+	tpm2.TPMCCCreatePrimary:     true,
+	tpm2.TPMCCLoad:              true,
+	tpm2.TPMCCLoadExternal:      true,
+	tpm2.TPMCCCreateLoaded:      true,
+	tpm2.TPMCCStartAuthSession:  true,
+	tpm2.TPMCCContextLoad:       true,
+	tpm2.TPMCCHashSequenceStart: true,
+	tpm2.TPMCCMACStart:          true,
+}
+
+// conn is one connection to the resource manager.
+type conn struct {
+	mu  sync.Mutex
+	tpm transport.TPMCloser
+	// lanes is the number of open lanes pinned to this connection.
+	// It is guarded by Mux.mu.
+	lanes int
+}
+
+func (c *conn) send(cmd []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tpm == nil {
+		return nil, ErrClosed
+	}
+	return c.tpm.Send(cmd)
+}
+
+// Mux is a pool of connections to a TPM resource manager.
+// It is safe for concurrent use.
+type Mux struct {
+	conns []*conn
+	// idle holds the connections available to Send.
+	idle chan *conn
+	done chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// New opens size connections with open and returns a Mux over them.
+// Each call to open must return an independent connection to the same
+// resource manager.
+func New(size int, open func() (transport.TPMCloser, error)) (*Mux, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("rmmux: invalid pool size %d", size)
+	}
+	m := &Mux{
+		idle: make(chan *conn, size),
+		done: make(chan struct{}),
+	}
+	for i := 0; i < size; i++ {
+		tpm, err := open()
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("opening connection %d: %w", i, err)
+		}
+		c := &conn{tpm: tpm}
+		m.conns = append(m.conns, c)
+		m.idle <- c
+	}
+	return m, nil
+}
+
+// Send implements transport.TPM. The command runs on the first free
+// connection, concurrently with commands from other goroutines.
+// Commands that would create a transient object or session are refused
+// with ErrTransientState.
+func (m *Mux) Send(cmd []byte) ([]byte, error) {
+	if len(cmd) >= 10 && stateCreators[tpm2.TPMCC(binary.BigEndian.Uint32(cmd[6:10]))] {
+		return nil, ErrTransientState
+	}
+	var c *conn
+	select {
+	case c = <-m.idle:
+	case <-m.done:
+		return nil, ErrClosed
+	}
+	defer func() { m.idle <- c }()
+	return c.send(cmd)
+}
+
+// Lane returns a new transport pinned to the least-used connection.
+// Lanes sharing a connection take turns on it; lanes on different
+// connections run in parallel.
+func (m *Mux) Lane() (*Lane, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	c := m.conns[0]
+	for _, other := range m.conns[1:] {
+		if other.lanes < c.lanes {
+			c = other
+		}
+	}
+	c.lanes++
+	l := &Lane{m: m, c: c}
+	l.cond = sync.NewCond(&l.mu)
+	return l, nil
+}
+
+// Close closes every connection. Commands already in flight are allowed
+// to finish first.
+func (m *Mux) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrClosed
+	}
+	m.closed = true
+	close(m.done)
+	m.mu.Unlock()
+
+	var errs []error
+	for _, c := range m.conns {
+		c.mu.Lock()
+		if err := c.tpm.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		c.tpm = nil
+		c.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Lane is a transport pinned to one connection of a Mux. Its commands are
+// sent one at a time, in the order in which Send was called.
+// It is safe for concurrent use.
+type Lane struct {
+	m *Mux
+	c *conn
+
+	// mu and cond implement a ticket lock, so that waiting callers are
+	// served strictly in arrival order.
+	mu      sync.Mutex
+	cond    *sync.Cond
+	next    uint64
+	serving uint64
+	closed  bool
+}
+
+// Send implements transport.TPM.
+func (l *Lane) Send(cmd []byte) ([]byte, error) {
+	l.mu.Lock()
+	ticket := l.next
+	l.next++
+	for l.serving != ticket {
+		l.cond.Wait()
+	}
+	closed := l.closed
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		l.serving++
+		l.cond.Broadcast()
+		l.mu.Unlock()
+	}()
+	if closed {
+		return nil, ErrClosed
+	}
+	return l.c.send(cmd)
+}
+
+// Close detaches the lane from its connection. It does not flush anything
+// created through the lane; the resource manager only does that when the
+// underlying connection is closed with the Mux.
+func (l *Lane) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return ErrClosed
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	l.m.mu.Lock()
+	l.c.lanes--
+	l.m.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,269 @@
+package rmmux
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+	testhelper "github.com/google/go-tpm/tpm2/transport/test"
+)
+
+// fakeConn echoes commands back and records the order it saw them in.
+type fakeConn struct {
+	id    int
+	delay time.Duration
+	// inFlight counts commands being processed across all fakeConns.
+	inFlight *inFlight
+
+	mu     sync.Mutex
+	seen   [][]byte
+	closed bool
+}
+
+type inFlight struct {
+	mu       sync.Mutex
+	cur, max int
+}
+
+func (f *fakeConn) Send(cmd []byte) ([]byte, error) {
+	f.inFlight.mu.Lock()
+	f.inFlight.cur++
+	if f.inFlight.cur > f.inFlight.max {
+		f.inFlight.max = f.inFlight.cur
+	}
+	f.inFlight.mu.Unlock()
+	time.Sleep(f.delay)
+	f.inFlight.mu.Lock()
+	f.inFlight.cur--
+	f.inFlight.mu.Unlock()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seen = append(f.seen, cmd)
+	return append([]byte{byte(f.id)}, cmd...), nil
+}
+
+func (f *fakeConn) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func newFakeMux(t *testing.T, size int, delay time.Duration) (*Mux, []*fakeConn, *inFlight) {
+	t.Helper()
+	var conns []*fakeConn
+	counter := &inFlight{}
+	m, err := New(size, func() (transport.TPMCloser, error) {
+		c := &fakeConn{id: len(conns), delay: delay, inFlight: counter}
+		conns = append(conns, c)
+		return c, nil
+	})
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	return m, conns, counter
+}
+
+func command(cc tpm2.TPMCC, seq uint32) []byte {
+	cmd := make([]byte, 14)
+	binary.BigEndian.PutUint16(cmd[0:], uint16(tpm2.TPMSTNoSessions))
+	binary.BigEndian.PutUint32(cmd[2:], uint32(len(cmd)))
+	binary.BigEndian.PutUint32(cmd[6:], uint32(cc))
+	binary.BigEndian.PutUint32(cmd[10:], seq)
+	return cmd
+}
+
+func TestSendParallel(t *testing.T) {
+	m, _, counter := newFakeMux(t, 4, 20*time.Millisecond)
+	defer m.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := m.Send(command(tpm2.TPMCCSign, uint32(i))); err != nil {
+				t.Errorf("Send() = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if counter.max < 2 {
+		t.Errorf("at most %d commands were in flight, want parallel execution", counter.max)
+	}
+	if counter.max > 4 {
+		t.Errorf("%d commands were in flight on 4 connections", counter.max)
+	}
+}
+
+func TestSendRefusesTransientState(t *testing.T) {
+	m, conns, _ := newFakeMux(t, 2, 0)
+	defer m.Close()
+
+	for _, cc := range []tpm2.TPMCC{tpm2.TPMCCStartAuthSession, tpm2.TPMCCCreatePrimary, tpm2.TPMCCLoad} {
+		if _, err := m.Send(command(cc, 0)); !errors.Is(err, ErrTransientState) {
+			t.Errorf("Send(%v) = %v, want %v", cc, err, ErrTransientState)
+		}
+	}
+	for _, c := range conns {
+		if len(c.seen) != 0 {
+			t.Errorf("connection %d received %d refused commands", c.id, len(c.seen))
+		}
+	}
+}
+
+func TestLanes(t *testing.T) {
+	m, conns, _ := newFakeMux(t, 2, time.Millisecond)
+	defer m.Close()
+
+	const perLane = 20
+	var lanes []*Lane
+	for i := 0; i < 4; i++ {
+		l, err := m.Lane()
+		if err != nil {
+			t.Fatalf("Lane() = %v", err)
+		}
+		lanes = append(lanes, l)
+	}
+
+	var wg sync.WaitGroup
+	for i, l := range lanes {
+		wg.Add(1)
+		go func(i int, l *Lane) {
+			defer wg.Done()
+			var pinned byte
+			for seq := 0; seq < perLane; seq++ {
+				// Lanes may create sessions.
+				rsp, err := l.Send(command(tpm2.TPMCCStartAuthSession, uint32(i<<16|seq)))
+				if err != nil {
+					t.Errorf("Send() = %v", err)
+					return
+				}
+				if seq == 0 {
+					pinned = rsp[0]
+				} else if rsp[0] != pinned {
+					t.Errorf("lane %d moved from connection %d to %d", i, pinned, rsp[0])
+				}
+			}
+		}(i, l)
+	}
+	wg.Wait()
+
+	// Lanes are spread evenly, and each lane's commands arrive in order.
+	for _, c := range conns {
+		last := map[uint32]int{}
+		for _, cmd := range c.seen {
+			v := binary.BigEndian.Uint32(cmd[10:])
+			lane, seq := v>>16, int(v&0xffff)
+			if prev, ok := last[lane]; ok && seq != prev+1 {
+				t.Errorf("connection %d: lane %d sent %d after %d", c.id, lane, seq, prev)
+			}
+			last[lane] = seq
+		}
+		if len(last) != 2 {
+			t.Errorf("connection %d served %d lanes, want 2", c.id, len(last))
+		}
+	}
+
+	for _, l := range lanes {
+		if err := l.Close(); err != nil {
+			t.Errorf("Close() = %v", err)
+		}
+		if _, err := l.Send(command(tpm2.TPMCCGetRandom, 0)); !errors.Is(err, ErrClosed) {
+			t.Errorf("Send() after Close() = %v, want %v", err, ErrClosed)
+		}
+	}
+}
+
+func TestLaneOrdering(t *testing.T) {
+	m, conns, _ := newFakeMux(t, 1, time.Millisecond)
+	defer m.Close()
+	l, err := m.Lane()
+	if err != nil {
+		t.Fatalf("Lane() = %v", err)
+	}
+
+	// Each caller starts only once the previous one is queued, so the
+	// lane must serve them in exactly that order.
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := l.Send(command(tpm2.TPMCCGetRandom, uint32(i))); err != nil {
+				t.Errorf("Send() = %v", err)
+			}
+		}(i)
+		for {
+			l.mu.Lock()
+			queued := l.next
+			l.mu.Unlock()
+			if queued == uint64(i+1) {
+				break
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}
+	wg.Wait()
+	for i, cmd := range conns[0].seen {
+		if seq := binary.BigEndian.Uint32(cmd[10:]); seq != uint32(i) {
+			t.Errorf("command %d was sent as #%d", seq, i)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	m, conns, _ := newFakeMux(t, 3, 0)
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	for _, c := range conns {
+		if !c.closed {
+			t.Errorf("connection %d was not closed", c.id)
+		}
+	}
+	if _, err := m.Send(command(tpm2.TPMCCGetRandom, 0)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Send() after Close() = %v, want %v", err, ErrClosed)
+	}
+	if _, err := m.Lane(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Lane() after Close() = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestNewError(t *testing.T) {
+	var opened []*fakeConn
+	wantErr := errors.New("no more connections")
+	_, err := New(3, func() (transport.TPMCloser, error) {
+		if len(opened) == 2 {
+			return nil, wantErr
+		}
+		c := &fakeConn{inFlight: &inFlight{}}
+		opened = append(opened, c)
+		return c, nil
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("New() = %v, want %v", err, wantErr)
+	}
+	for i, c := range opened {
+		if !c.closed {
+			t.Errorf("connection %d was leaked", i)
+		}
+	}
+}
+
+func TestSimulator(t *testing.T) {
+	testhelper.RunTest(t, nil, func() (transport.TPMCloser, error) {
+		sim, err := simulator.OpenSimulator()
+		if err != nil {
+			return nil, err
+		}
+		return New(1, func() (transport.TPMCloser, error) { return sim, nil })
+	})
+}
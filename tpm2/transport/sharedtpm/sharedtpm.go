@@ -0,0 +1,312 @@
+//go:build linux
+
+// Package sharedtpm lets several processes share a TPM that has no resource
+// manager, such as /dev/tpm0 on a host without the kernel's /dev/tpmrm0 or
+// tpm2-abrmd, without clobbering each other's transient objects and
+// sessions.
+//
+// Cooperating processes open the TPM through the same handle table, a file
+// that records which connection owns each transient object and session in
+// the TPM. Commands are serialized by an exclusive flock(2) on the table,
+// which is held while the command runs; the device itself is only open
+// while the lock is held, as /dev/tpm0 can only be opened by one process at
+// a time. A command that uses an object or session owned by another
+// connection fails with TPM_RC_HANDLE, as if the handle did not exist, and
+// the handles of processes that have exited are flushed by the next
+// command.
+//
+// Processes that do not use the table are not kept out, and handles they
+// create are not protected. Unlike a resource manager, sharedtpm does not
+// swap objects out of the TPM, so connections still compete for its object
+// and session slots; for that within one process, see pool.
+package sharedtpm
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/handles"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/internal/tpmcmd"
+	"github.com/google/go-tpm/tpm2/transport/linuxtpm"
+)
+
+// DefaultTable is the conventional location of the handle table. /run is
+// cleared on reboot, when the TPM's transient objects and sessions are lost
+// too.
+const DefaultTable = "/run/go-tpm.handles"
+
+// ErrClosed indicates that the TPM has been closed.
+var ErrClosed = errors.New("sharedtpm: closed")
+
+// owner identifies a connection in the handle table.
+type owner struct {
+	pid int
+	id  uint64
+}
+
+// TPM is a connection to a TPM shared through a handle table. It is safe
+// for concurrent use.
+type TPM struct {
+	// mu serializes commands within the process, and guards everything
+	// below.
+	mu     sync.Mutex
+	table  *os.File
+	open   func() (transport.TPMCloser, error)
+	attrs  map[tpm2.TPMCC]tpm2.TPMACC
+	self   owner
+	closed bool
+	// maxResponse is the response buffer size for each TPM that open
+	// returns, or zero for the transport's default.
+	maxResponse int
+}
+
+var (
+	_ transport.TPMCloser     = (*TPM)(nil)
+	_ transport.ResponseSizer = (*TPM)(nil)
+)
+
+// Open opens the TPM device file at path, sharing it through the handle
+// table at table, which is created if needed.
+func Open(path, table string) (*TPM, error) {
+	return New(table, func() (transport.TPMCloser, error) {
+		return linuxtpm.Open(path)
+	})
+}
+
+// New returns a connection to the TPM opened by open, sharing it through the
+// handle table at table, which is created if needed. open is called for
+// every command, with the table locked, and the TPM it returns is closed
+// when the command completes.
+func New(table string, open func() (transport.TPMCloser, error)) (*TPM, error) {
+	f, err := os.OpenFile(table, os.O_RDWR|os.O_CREATE, 0660)
+	if err != nil {
+		return nil, err
+	}
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &TPM{
+		table: f,
+		open:  open,
+		self:  owner{pid: os.Getpid(), id: binary.BigEndian.Uint64(id[:])},
+	}, nil
+}
+
+// SetMaxResponseSize implements transport.ResponseSizer, for the TPM opened
+// for every command. tpm2.ConfigureMaxResponseSize thus only has to query
+// the TPM once, rather than every time the device is opened.
+func (t *TPM) SetMaxResponseSize(size int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.maxResponse = size
+}
+
+// Send implements transport.TPM.
+func (t *TPM) Send(cmd []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, ErrClosed
+	}
+	var rsp []byte
+	err := t.locked(func(tpm transport.TPM, owners map[tpm2.TPMHandle]owner) error {
+		var err error
+		rsp, err = t.send(tpm, owners, cmd)
+		return err
+	})
+	return rsp, err
+}
+
+// Close flushes the objects and sessions owned by the connection and
+// closes the handle table.
+func (t *TPM) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrClosed
+	}
+	t.closed = true
+	err := t.locked(func(tpm transport.TPM, owners map[tpm2.TPMHandle]owner) error {
+		var errs []error
+		for h, o := range owners {
+			if o == t.self {
+				errs = append(errs, flush(tpm, h))
+				delete(owners, h)
+			}
+		}
+		return errors.Join(errs...)
+	})
+	return errors.Join(err, t.table.Close())
+}
+
+// locked runs f with the table locked, the TPM open and the handles of
+// exited processes flushed, and saves the table f leaves behind.
+func (t *TPM) locked(f func(tpm transport.TPM, owners map[tpm2.TPMHandle]owner) error) error {
+	fd := int(t.table.Fd())
+	if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("locking handle table: %w", err)
+	}
+	defer syscall.Flock(fd, syscall.LOCK_UN)
+
+	owners, err := t.read()
+	if err != nil {
+		return err
+	}
+	tpm, err := t.open()
+	if err != nil {
+		return err
+	}
+	defer tpm.Close()
+	if rs, ok := tpm.(transport.ResponseSizer); ok && t.maxResponse != 0 {
+		rs.SetMaxResponseSize(t.maxResponse)
+	}
+
+	var errs []error
+	for h, o := range owners {
+		if !alive(o.pid) {
+			errs = append(errs, flush(tpm, h))
+			delete(owners, h)
+		}
+	}
+	errs = append(errs, f(tpm, owners))
+	errs = append(errs, t.write(owners))
+	return errors.Join(errs...)
+}
+
+// alive reports whether the process pid exists.
+func alive(pid int) bool {
+	return syscall.Kill(pid, 0) != syscall.ESRCH
+}
+
+// flush flushes h, which may already be gone, for example if its owner
+// flushed it without the table.
+func flush(tpm transport.TPM, h tpm2.TPMHandle) error {
+	if _, err := (tpm2.FlushContext{FlushHandle: h}).Execute(tpm); err != nil && !errors.Is(err, tpm2.TPMRCHandle) {
+		return fmt.Errorf("flushing 0x%08x: %w", uint32(h), err)
+	}
+	return nil
+}
+
+// read reads the handle table. Each line holds a handle in hexadecimal, then
+// the pid of the process that owns it and the id of its connection in
+// decimal.
+func (t *TPM) read() (map[tpm2.TPMHandle]owner, error) {
+	if _, err := t.table.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("reading handle table: %w", err)
+	}
+	owners := make(map[tpm2.TPMHandle]owner)
+	s := bufio.NewScanner(t.table)
+	for s.Scan() {
+		var h uint32
+		var o owner
+		// Skip lines that don't parse, rather than refusing to use the
+		// TPM until someone fixes the file.
+		if _, err := fmt.Sscanf(s.Text(), "%08x %d %d", &h, &o.pid, &o.id); err == nil {
+			owners[tpm2.TPMHandle(h)] = o
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading handle table: %w", err)
+	}
+	return owners, nil
+}
+
+// write replaces the contents of the handle table.
+func (t *TPM) write(owners map[tpm2.TPMHandle]owner) error {
+	var b bytes.Buffer
+	for h, o := range owners {
+		fmt.Fprintf(&b, "%08x %d %d\n", uint32(h), o.pid, o.id)
+	}
+	if err := t.table.Truncate(0); err != nil {
+		return fmt.Errorf("writing handle table: %w", err)
+	}
+	if _, err := t.table.WriteAt(b.Bytes(), 0); err != nil {
+		return fmt.Errorf("writing handle table: %w", err)
+	}
+	return nil
+}
+
+// send sends cmd to tpm unless it uses another connection's handles, and
+// records the handles it creates and flushes.
+func (t *TPM) send(tpm transport.TPM, owners map[tpm2.TPMHandle]owner, cmd []byte) ([]byte, error) {
+	if len(cmd) < 10 {
+		return tpm.Send(cmd)
+	}
+	// others reports whether h belongs to another connection.
+	others := func(h tpm2.TPMHandle) bool {
+		o, ok := owners[h]
+		return ok && o != t.self
+	}
+
+	cc := tpmcmd.CommandCode(cmd)
+	if cc == tpm2.TPMCCFlushContext && len(cmd) >= 14 {
+		// The handle to flush is a parameter rather than in the handle
+		// area.
+		h := tpm2.TPMHandle(binary.BigEndian.Uint32(cmd[10:14]))
+		if others(h) {
+			return tpmcmd.ErrorResponse(tpm2.TPMRCHandle + tpmcmd.RCP + tpmcmd.RC1), nil
+		}
+		rsp, err := tpm.Send(cmd)
+		if err == nil && tpmcmd.ResponseCode(rsp) == 0 {
+			delete(owners, h)
+		}
+		return rsp, err
+	}
+
+	if t.attrs == nil {
+		attrs, err := tpmcmd.Attributes(tpm)
+		if err != nil {
+			return nil, err
+		}
+		t.attrs = attrs
+	}
+	attrs, ok := t.attrs[cc]
+	if !ok {
+		// Let the TPM reject the command.
+		return tpm.Send(cmd)
+	}
+	nh := int(attrs.CHandles)
+	var ended []tpm2.TPMHandle
+	for i, h := range tpmcmd.Handles(cmd, nh) {
+		if others(h) {
+			return tpmcmd.ErrorResponse(tpm2.TPMRCHandle + tpm2.TPMRC(i+1)*tpmcmd.RC1), nil
+		}
+		if attrs.Flushed && handles.IsTransient(h) {
+			ended = append(ended, h)
+		}
+	}
+	for i, auth := range tpmcmd.AuthSessions(cmd, nh) {
+		if others(auth.Handle) {
+			return tpmcmd.ErrorResponse(tpm2.TPMRCHandle + tpmcmd.RCS + tpm2.TPMRC(i+1)*tpmcmd.RC1), nil
+		}
+		if handles.IsSession(auth.Handle) && !auth.ContinueSession() {
+			ended = append(ended, auth.Handle)
+		}
+	}
+
+	rsp, err := tpm.Send(cmd)
+	if err != nil || tpmcmd.ResponseCode(rsp) != 0 {
+		return rsp, err
+	}
+	for _, h := range ended {
+		delete(owners, h)
+	}
+	if attrs.RHandle {
+		if h := tpmcmd.ResponseHandle(rsp); handles.IsTransient(h) || handles.IsSession(h) {
+			owners[h] = t.self
+		}
+	}
+	return rsp, nil
+}
@@ -0,0 +1,201 @@
+//go:build linux
+
+package sharedtpm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/handles"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+// shared is a connection to the simulator that stays open when closed, as
+// the simulator forgets its state when its connection closes.
+type shared struct {
+	transport.TPM
+}
+
+func (shared) Close() error { return nil }
+
+// newShared returns the simulator, and a function that opens connections
+// sharing it through a handle table.
+func newShared(t *testing.T) (transport.TPM, func() *TPM) {
+	t.Helper()
+	sim, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	t.Cleanup(func() { sim.Close() })
+	table := filepath.Join(t.TempDir(), "handles")
+	return sim, func() *TPM {
+		t.Helper()
+		tpm, err := New(table, func() (transport.TPMCloser, error) { return shared{sim}, nil })
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		return tpm
+	}
+}
+
+func createPrimary(t *testing.T, tpm transport.TPM) *tpm2.CreatePrimaryResponse {
+	t.Helper()
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(tpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	return rsp
+}
+
+// loaded returns the transient objects and loaded sessions in the TPM.
+func loaded(t *testing.T, tpm transport.TPM) []tpm2.TPMHandle {
+	t.Helper()
+	var out []tpm2.TPMHandle
+	for _, first := range []uint32{handles.TransientFirst, uint32(tpm2.TPMHTLoadedSession) << 24} {
+		rsp, err := tpm2.GetCapability{
+			Capability:    tpm2.TPMCapHandles,
+			Property:      first,
+			PropertyCount: 64,
+		}.Execute(tpm)
+		if err != nil {
+			t.Fatalf("GetCapability: %v", err)
+		}
+		hs, err := rsp.CapabilityData.Data.Handles()
+		if err != nil {
+			t.Fatalf("Handles: %v", err)
+		}
+		for _, h := range hs.Handle {
+			if uint32(h)>>24 == first>>24 {
+				out = append(out, h)
+			}
+		}
+	}
+	return out
+}
+
+func TestOwnership(t *testing.T) {
+	sim, open := newShared(t)
+	a, b := open(), open()
+	defer b.Close()
+
+	key := createPrimary(t, a)
+	sess, cleanup, err := tpm2.HMACSession(a, tpm2.TPMAlgSHA256, 16)
+	if err != nil {
+		t.Fatalf("HMACSession: %v", err)
+	}
+	defer cleanup()
+	if _, err := (tpm2.ReadPublic{ObjectHandle: key.ObjectHandle}).Execute(a); err != nil {
+		t.Errorf("ReadPublic by the owner: %v", err)
+	}
+
+	// Another connection can neither use nor flush them.
+	if _, err := (tpm2.ReadPublic{ObjectHandle: key.ObjectHandle}).Execute(b); !errors.Is(err, tpm2.TPMRCHandle) {
+		t.Errorf("ReadPublic of another connection's object = %v, want %v", err, tpm2.TPMRCHandle)
+	}
+	if _, err := (tpm2.FlushContext{FlushHandle: key.ObjectHandle}).Execute(b); !errors.Is(err, tpm2.TPMRCHandle) {
+		t.Errorf("FlushContext of another connection's object = %v, want %v", err, tpm2.TPMRCHandle)
+	}
+	keyB := createPrimary(t, b)
+	if _, err := (tpm2.HmacStart{
+		Handle:  tpm2.AuthHandle{Handle: keyB.ObjectHandle, Name: keyB.Name, Auth: sess},
+		HashAlg: tpm2.TPMAlgNull,
+	}).Execute(b); !errors.Is(err, tpm2.TPMRCHandle) {
+		t.Errorf("HmacStart with another connection's session = %v, want %v", err, tpm2.TPMRCHandle)
+	}
+	if _, err := (tpm2.FlushContext{FlushHandle: keyB.ObjectHandle}).Execute(b); err != nil {
+		t.Errorf("FlushContext by the owner: %v", err)
+	}
+
+	// Closing a connection flushes what it owns.
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if got := loaded(t, sim); len(got) != 0 {
+		t.Errorf("handles %x are left in the TPM", got)
+	}
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(a); !errors.Is(err, ErrClosed) {
+		t.Errorf("GetRandom on a closed connection = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestExitedProcess(t *testing.T) {
+	sim, open := newShared(t)
+	tpm := open()
+	defer tpm.Close()
+
+	// Record an object as owned by a process that has exited.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("running a child process: %v", err)
+	}
+	key := createPrimary(t, sim)
+	if err := os.WriteFile(tpm.table.Name(), []byte(fmt.Sprintf("%08x %d 1\n", uint32(key.ObjectHandle), cmd.Process.Pid)), 0660); err != nil {
+		t.Fatalf("writing handle table: %v", err)
+	}
+
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(tpm); err != nil {
+		t.Fatalf("GetRandom: %v", err)
+	}
+	if got := loaded(t, sim); len(got) != 0 {
+		t.Errorf("handles %x of an exited process are left in the TPM", got)
+	}
+}
+
+// sizedTPM records the response size it is given.
+type sizedTPM struct {
+	shared
+	size *int
+}
+
+func (s sizedTPM) SetMaxResponseSize(size int) { *s.size = size }
+
+func TestMaxResponseSize(t *testing.T) {
+	sim, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer sim.Close()
+	opens := 0
+	var size int
+	tpm, err := New(filepath.Join(t.TempDir(), "handles"), func() (transport.TPMCloser, error) {
+		opens++
+		return sizedTPM{shared{sim}, &size}, nil
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer tpm.Close()
+
+	// Opening the device costs no query of its own.
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(tpm); err != nil {
+		t.Fatalf("GetRandom: %v", err)
+	}
+	if opens != 1 || size != 0 {
+		t.Errorf("after one command: %d opens, response size %d; want 1 and 0", opens, size)
+	}
+
+	// The size is queried once, and given to every TPM opened after.
+	if err := tpm2.ConfigureMaxResponseSize(tpm); err != nil {
+		t.Fatalf("ConfigureMaxResponseSize: %v", err)
+	}
+	want, err := tpm2.MaxResponseSize(sim)
+	if err != nil {
+		t.Fatalf("MaxResponseSize: %v", err)
+	}
+	size = 0
+	if _, err := (tpm2.GetRandom{BytesRequested: 8}).Execute(tpm); err != nil {
+		t.Fatalf("GetRandom: %v", err)
+	}
+	if size != want {
+		t.Errorf("response size of a reopened TPM = %d, want %d", size, want)
+	}
+}
@@ -0,0 +1,91 @@
+//go:build linux
+
+package spitpm
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/internal/tis"
+)
+
+// spiIOCMessage1 is SPI_IOC_MESSAGE(1).
+const spiIOCMessage1 = 0x40206B00
+
+// spiIOCTransfer is struct spi_ioc_transfer.
+type spiIOCTransfer struct {
+	txBuf          uint64
+	rxBuf          uint64
+	len            uint32
+	speedHz        uint32
+	delayUsecs     uint16
+	bitsPerWord    uint8
+	csChange       uint8
+	txNbits        uint8
+	rxNbits        uint8
+	wordDelayUsecs uint8
+	pad            uint8
+}
+
+// spidev is a Conn on a spidev device file.
+type spidev struct {
+	f *os.File
+}
+
+// Transfer implements Conn.
+func (s *spidev) Transfer(tx, rx []byte, keepCS bool) error {
+	xfer := spiIOCTransfer{
+		txBuf: uint64(uintptr(unsafe.Pointer(&tx[0]))),
+		rxBuf: uint64(uintptr(unsafe.Pointer(&rx[0]))),
+		len:   uint32(len(tx)),
+	}
+	if keepCS {
+		xfer.csChange = 1
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, s.f.Fd(), spiIOCMessage1, uintptr(unsafe.Pointer(&xfer)))
+	runtime.KeepAlive(tx)
+	runtime.KeepAlive(rx)
+	if errno != 0 {
+		return fmt.Errorf("SPI transfer: %w", errno)
+	}
+	return nil
+}
+
+// tpm is a transport.TPMCloser for a TPM on SPI.
+type tpm struct {
+	*tis.TPM
+	f *os.File
+}
+
+// Close relinquishes the locality and closes the device.
+func (t *tpm) Close() error {
+	err := t.TPM.Close()
+	if cerr := t.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Open opens the TPM on the spidev device at the given path (such as
+// /dev/spidev0.0), using the given locality. The SPI mode and clock speed
+// are left as configured on the device.
+func Open(path string, locality int) (transport.TPMCloser, error) {
+	if locality < 0 || locality > 4 {
+		return nil, fmt.Errorf("invalid locality %d", locality)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	t, err := tis.Open(&bus{conn: &spidev{f: f}, locality: locality})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &tpm{TPM: t, f: f}, nil
+}
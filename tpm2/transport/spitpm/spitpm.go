@@ -0,0 +1,127 @@
+// Package spitpm provides access to a discrete TPM on an SPI bus, using the
+// TCG PC Client Platform TPM Profile (PTP) SPI protocol. It is useful where
+// the kernel has no tpm_tis_spi driver, or where raw access to the TPM is
+// needed. On Linux, Open uses the spidev driver. Elsewhere, such as in
+// embedded programs without an operating system, New drives the TPM through
+// any SPI controller that implements Conn.
+//
+// TPMs on LPC or memory-mapped buses are accessed with mmiotpm instead.
+package spitpm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/internal/tis"
+)
+
+const (
+	// maxTransfer is the largest data phase of a single SPI transaction.
+	maxTransfer = 64
+	// maxWaitStates bounds how long the TPM may hold off a transaction.
+	maxWaitStates = 50
+
+	// Addresses of the FIFO registers of locality 0. Each locality's
+	// registers are 0x1000 apart.
+	regBase     = 0xD40000
+	regAccess   = 0x00
+	regSts      = 0x18
+	regDataFIFO = 0x24
+)
+
+// ErrWaitStates indicates that the TPM held a transaction in wait states for
+// too long.
+var ErrWaitStates = errors.New("TPM did not leave wait state")
+
+// Conn is an SPI controller with the TPM as its target. The TPM expects SPI
+// mode 0 at no more than its maximum clock frequency, usually 24 or 33 MHz.
+type Conn interface {
+	// Transfer transfers len(tx) bytes, full duplex, sending tx and
+	// filling rx, which has the same length. If keepCS is set, chip select
+	// stays asserted after the transfer so the transaction can be
+	// continued.
+	Transfer(tx, rx []byte, keepCS bool) error
+}
+
+// bus implements the PTP SPI protocol on a Conn.
+type bus struct {
+	conn     Conn
+	locality int
+}
+
+// transact performs one SPI transaction of up to maxTransfer bytes: a
+// header, any wait states the TPM requests, then the data.
+func (b *bus) transact(read bool, reg uint32, data []byte) error {
+	addr := regBase + uint32(b.locality)<<12 + reg
+	hdr := []byte{byte(len(data) - 1), byte(addr >> 16), byte(addr >> 8), byte(addr)}
+	if read {
+		hdr[0] |= 0x80
+	}
+	rx := make([]byte, len(hdr))
+	if err := b.conn.Transfer(hdr, rx, true); err != nil {
+		return err
+	}
+	// The TPM clears bit 0 of the last header byte to insert wait states.
+	for i := 0; rx[len(rx)-1]&1 == 0; i++ {
+		if i == maxWaitStates {
+			b.conn.Transfer([]byte{0}, rx[:1], false)
+			return ErrWaitStates
+		}
+		if err := b.conn.Transfer([]byte{0}, rx[len(rx)-1:], true); err != nil {
+			return err
+		}
+	}
+	if read {
+		return b.conn.Transfer(make([]byte, len(data)), data, false)
+	}
+	return b.conn.Transfer(data, make([]byte, len(data)), false)
+}
+
+// access splits an access into transactions of at most maxTransfer bytes.
+func (b *bus) access(read bool, reg tis.Register, data []byte) error {
+	var addr uint32
+	switch reg {
+	case tis.Access:
+		addr = regAccess
+	case tis.Sts:
+		addr = regSts
+	case tis.DataFIFO:
+		addr = regDataFIFO
+	default:
+		return fmt.Errorf("unknown register %d", reg)
+	}
+	for len(data) > 0 {
+		n := min(len(data), maxTransfer)
+		if err := b.transact(read, addr, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// Read implements tis.Bus.
+func (b *bus) Read(reg tis.Register, buf []byte) error {
+	return b.access(true, reg, buf)
+}
+
+// Write implements tis.Bus.
+func (b *bus) Write(reg tis.Register, data []byte) error {
+	return b.access(false, reg, data)
+}
+
+// SetLocality implements tis.LocalityBus.
+func (b *bus) SetLocality(locality int) error {
+	b.locality = locality
+	return nil
+}
+
+// New opens the TPM on c, using the given locality. Closing the returned
+// TPM relinquishes the locality but leaves c alone.
+func New(c Conn, locality int) (transport.TPMCloser, error) {
+	if locality < 0 || locality > 4 {
+		return nil, fmt.Errorf("invalid locality %d", locality)
+	}
+	return tis.Open(&bus{conn: c, locality: locality})
+}
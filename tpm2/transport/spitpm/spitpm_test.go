@@ -0,0 +1,81 @@
+package spitpm
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/internal/tis"
+	"github.com/google/go-tpm/tpm2/transport/internal/tis/tistest"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+	testhelper "github.com/google/go-tpm/tpm2/transport/test"
+)
+
+// fakeSPI decodes PTP SPI transactions and applies them to a fake device,
+// inserting a few wait states before every data phase.
+type fakeSPI struct {
+	dev           *tistest.Device
+	locality      int
+	hdr           []byte
+	waits         int
+	inTransaction bool
+}
+
+func (f *fakeSPI) Transfer(tx, rx []byte, keepCS bool) error {
+	switch {
+	case !f.inTransaction:
+		if len(tx) != 4 || !keepCS {
+			return fmt.Errorf("bad header transfer of %d bytes", len(tx))
+		}
+		f.hdr, f.waits, f.inTransaction = append([]byte(nil), tx...), 2, true
+		rx[3] = 0
+	case f.waits > 0:
+		f.waits--
+		if f.waits == 0 {
+			rx[0] = 1
+		} else {
+			rx[0] = 0
+		}
+	default:
+		f.inTransaction = false
+		read := f.hdr[0]&0x80 != 0
+		size := int(f.hdr[0]&0x3F) + 1
+		if len(tx) != size || keepCS {
+			return fmt.Errorf("bad data transfer of %d bytes, want %d", len(tx), size)
+		}
+		addr := uint32(f.hdr[1])<<16 | uint32(f.hdr[2])<<8 | uint32(f.hdr[3])
+		if want := uint32(regBase + f.locality<<12); addr&^0xFFF != want {
+			return fmt.Errorf("address 0x%x is not in locality %d", addr, f.locality)
+		}
+		var reg tis.Register
+		switch addr & 0xFFF {
+		case regAccess:
+			reg = tis.Access
+		case regSts:
+			reg = tis.Sts
+		case regDataFIFO:
+			reg = tis.DataFIFO
+		default:
+			return fmt.Errorf("unexpected register 0x%x", addr)
+		}
+		if read {
+			return f.dev.Read(reg, rx)
+		}
+		return f.dev.Write(reg, tx)
+	}
+	return nil
+}
+
+func TestSPI(t *testing.T) {
+	testhelper.RunTest(t, nil, func() (transport.TPMCloser, error) {
+		sim, err := simulator.OpenSimulator()
+		if err != nil {
+			t.Fatalf("could not connect to TPM simulator: %v", err)
+		}
+		t.Cleanup(func() { sim.Close() })
+		dev := tistest.New(sim)
+		// Use a burst count larger than a single SPI transaction.
+		dev.Burst = 100
+		return New(&fakeSPI{dev: dev, locality: 2}, 2)
+	})
+}
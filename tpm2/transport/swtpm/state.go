@@ -0,0 +1,88 @@
+package swtpm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// blobPermanent is PTM_BLOB_TYPE_PERMANENT, the TPM's NV state: its seeds,
+// hierarchy settings, persistent objects and NV indices.
+const blobPermanent uint32 = 1
+
+// maxStateSize bounds the size of a state blob read from swtpm.
+const maxStateSize = 1 << 20
+
+// State is the permanent state of an swtpm TPM, the contents of its
+// tpm2-00.permall file.
+type State struct {
+	// Blob is the state, encrypted if swtpm was started with a state
+	// encryption key.
+	Blob []byte
+	// Flags are the blob's PTM_STATE_FLAG_* flags, which tell swtpm
+	// whether it is encrypted.
+	Flags uint32
+}
+
+// SaveState returns the TPM's permanent state, with CMD_GET_STATEBLOB.
+// Together with RestoreState, it lets tests provision a TPM once and start
+// every test from the result. Transient objects and sessions are volatile
+// state, and are not saved.
+func (t *TPM) SaveState() (*State, error) {
+	var state State
+	for {
+		req := binary.BigEndian.AppendUint32(nil, 0) // state_flags
+		req = binary.BigEndian.AppendUint32(req, blobPermanent)
+		req = binary.BigEndian.AppendUint32(req, uint32(len(state.Blob)))
+		var total, n uint32
+		err := t.controlResponse(cmdGetStateBlob, req, func(r io.Reader) error {
+			var hdr struct{ Flags, TotalLength, Length uint32 }
+			if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+				return fmt.Errorf("reading state blob header: %w", err)
+			}
+			if hdr.TotalLength > maxStateSize || uint64(len(state.Blob))+uint64(hdr.Length) > uint64(hdr.TotalLength) {
+				return fmt.Errorf("invalid state blob size %d of %d", hdr.Length, hdr.TotalLength)
+			}
+			data := make([]byte, hdr.Length)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return fmt.Errorf("reading state blob: %w", err)
+			}
+			state.Blob = append(state.Blob, data...)
+			state.Flags = hdr.Flags
+			total, n = hdr.TotalLength, hdr.Length
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		// swtpm sends the whole blob over a socket, but may send it in
+		// pieces over other channels.
+		if uint32(len(state.Blob)) >= total {
+			return &state, nil
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("swtpm sent %d bytes of the %d-byte state blob", len(state.Blob), total)
+		}
+	}
+}
+
+// RestoreState replaces the TPM's permanent state with s, as returned by
+// SaveState, and starts the TPM from it as after a reboot: it powers the
+// TPM off with CMD_STOP, sets the state with CMD_SET_STATEBLOB, powers it
+// on again with CMD_INIT, discarding volatile state, and sends
+// TPM2_Startup(CLEAR).
+func (t *TPM) RestoreState(s *State) error {
+	if err := t.Stop(); err != nil {
+		return err
+	}
+	req := binary.BigEndian.AppendUint32(nil, s.Flags)
+	req = binary.BigEndian.AppendUint32(req, blobPermanent)
+	req = binary.BigEndian.AppendUint32(req, uint32(len(s.Blob)))
+	if err := t.control(cmdSetStateBlob, append(req, s.Blob...)); err != nil {
+		return err
+	}
+	if err := t.Init(true); err != nil {
+		return err
+	}
+	return t.startup()
+}
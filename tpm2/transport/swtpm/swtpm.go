@@ -0,0 +1,223 @@
+// Package swtpm provides access to the swtpm TPM emulator over its socket
+// interface, as started with "swtpm socket --tpm2 --server ... --ctrl ...".
+//
+// swtpm exposes two channels: a data channel that carries TPM commands and
+// responses, and a control channel that carries emulator commands such as
+// powering the TPM on (CMD_INIT), setting the locality of the following
+// commands (CMD_SET_LOCALITY) or reading and replacing the TPM's state
+// (CMD_GET_STATEBLOB and CMD_SET_STATEBLOB). Either may be a TCP or a Unix
+// domain socket.
+package swtpm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Control channel commands, from swtpm's tpm_ioctl.h.
+const (
+	cmdInit         uint32 = 0x02
+	cmdShutdown     uint32 = 0x03
+	cmdSetLocality  uint32 = 0x05
+	cmdGetStateBlob uint32 = 0x0c
+	cmdSetStateBlob uint32 = 0x0d
+	cmdStop         uint32 = 0x0e
+)
+
+// initDeleteVolatile is the CMD_INIT flag that discards saved volatile state.
+const initDeleteVolatile uint32 = 1
+
+// maxResponseSize bounds the size of a TPM response read from swtpm.
+const maxResponseSize = 1 << 16
+
+// ErrNoControlChannel is returned by control commands when Config has no
+// control channel address.
+var ErrNoControlChannel = errors.New("no swtpm control channel configured")
+
+// Config holds the addresses of swtpm's channels.
+type Config struct {
+	// Network and Address locate the data channel, as for net.Dial. They
+	// default to "tcp" and "127.0.0.1:2321".
+	Network string
+	Address string
+	// CtrlNetwork and CtrlAddress locate the control channel. CtrlNetwork
+	// defaults to Network. CtrlAddress defaults to "127.0.0.1:2322" for
+	// TCP; for Unix sockets there is no default and control commands fail
+	// with ErrNoControlChannel unless it is set.
+	CtrlNetwork string
+	CtrlAddress string
+	// PowerOn makes Open send CMD_INIT followed by TPM2_Startup(CLEAR), for
+	// swtpm instances not started with --flags startup-clear.
+	PowerOn bool
+}
+
+// TPM is a connection to swtpm. It is safe for concurrent use.
+type TPM struct {
+	mu          sync.Mutex
+	conn        net.Conn
+	ctrlNetwork string
+	ctrlAddress string
+}
+
+// Open connects to swtpm's data channel and, if config.PowerOn is set,
+// powers the TPM on.
+func Open(config Config) (*TPM, error) {
+	network := config.Network
+	if network == "" {
+		network = "tcp"
+	}
+	address := config.Address
+	if address == "" {
+		address = "127.0.0.1:2321"
+	}
+	t := &TPM{
+		ctrlNetwork: config.CtrlNetwork,
+		ctrlAddress: config.CtrlAddress,
+	}
+	if t.ctrlNetwork == "" {
+		t.ctrlNetwork = network
+	}
+	if t.ctrlAddress == "" && t.ctrlNetwork == "tcp" {
+		t.ctrlAddress = "127.0.0.1:2322"
+	}
+
+	if config.PowerOn {
+		if err := t.Init(false); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("dial data channel: %w", err)
+	}
+	t.conn = conn
+	if config.PowerOn {
+		if err := t.startup(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+var (
+	_ transport.TPMCloser      = (*TPM)(nil)
+	_ transport.LocalitySetter = (*TPM)(nil)
+)
+
+// Send implements transport.TPM.
+func (t *TPM) Send(cmd []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.conn.Write(cmd); err != nil {
+		return nil, err
+	}
+	// The data channel is a stream, so the response is read in two parts:
+	// the header, which holds the response size, and the rest.
+	rsp := make([]byte, 10)
+	if _, err := io.ReadFull(t.conn, rsp); err != nil {
+		return nil, fmt.Errorf("reading response header: %w", err)
+	}
+	size := binary.BigEndian.Uint32(rsp[2:6])
+	if size < 10 || size > maxResponseSize {
+		return nil, fmt.Errorf("invalid response size %d", size)
+	}
+	rsp = append(rsp, make([]byte, size-10)...)
+	if _, err := io.ReadFull(t.conn, rsp[10:]); err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	return rsp, nil
+}
+
+// Close closes the data channel. It leaves the emulator running; use
+// Shutdown to end it.
+func (t *TPM) Close() error {
+	return t.conn.Close()
+}
+
+// startup sends TPM2_Startup(CLEAR). TPM_RC_INITIALIZE, meaning that the
+// TPM was already started, is not an error.
+func (t *TPM) startup() error {
+	rsp, err := t.Send([]byte{
+		0x80, 0x01, // TPM_ST_NO_SESSIONS
+		0x00, 0x00, 0x00, 0x0c,
+		0x00, 0x00, 0x01, 0x44, // TPM_CC_Startup
+		0x00, 0x00, // TPM_SU_CLEAR
+	})
+	if err != nil {
+		return fmt.Errorf("TPM2_Startup: %w", err)
+	}
+	if rc := binary.BigEndian.Uint32(rsp[6:10]); rc != 0 && rc != 0x100 {
+		return fmt.Errorf("TPM2_Startup: response code 0x%x", rc)
+	}
+	return nil
+}
+
+// control sends a command on the control channel and checks its result.
+func (t *TPM) control(cmd uint32, payload []byte) error {
+	return t.controlResponse(cmd, payload, nil)
+}
+
+// controlResponse sends a command on the control channel, checks its
+// result, and then passes the connection to readRest, if not nil, to read
+// the rest of the response.
+func (t *TPM) controlResponse(cmd uint32, payload []byte, readRest func(io.Reader) error) error {
+	if t.ctrlAddress == "" {
+		return ErrNoControlChannel
+	}
+	conn, err := net.Dial(t.ctrlNetwork, t.ctrlAddress)
+	if err != nil {
+		return fmt.Errorf("dial control channel: %w", err)
+	}
+	defer conn.Close()
+	req := binary.BigEndian.AppendUint32(nil, cmd)
+	if _, err := conn.Write(append(req, payload...)); err != nil {
+		return err
+	}
+	var result uint32
+	if err := binary.Read(conn, binary.BigEndian, &result); err != nil {
+		return fmt.Errorf("reading control response: %w", err)
+	}
+	if result != 0 {
+		return fmt.Errorf("swtpm control command 0x%x failed: TPM result 0x%x", cmd, result)
+	}
+	if readRest != nil {
+		return readRest(conn)
+	}
+	return nil
+}
+
+// Init sends CMD_INIT, which powers the TPM on, or resets it if it is
+// already on. If deleteVolatile is set, saved volatile state is discarded
+// rather than restored. TPM2_Startup must be sent afterwards.
+func (t *TPM) Init(deleteVolatile bool) error {
+	var flags uint32
+	if deleteVolatile {
+		flags = initDeleteVolatile
+	}
+	return t.control(cmdInit, binary.BigEndian.AppendUint32(nil, flags))
+}
+
+// Shutdown sends CMD_SHUTDOWN, which powers the TPM off and makes swtpm
+// exit.
+func (t *TPM) Shutdown() error {
+	return t.control(cmdShutdown, nil)
+}
+
+// SetLocality sends CMD_SET_LOCALITY, which sets the locality of the
+// commands sent after it. It implements transport.LocalitySetter.
+func (t *TPM) SetLocality(locality uint8) error {
+	return t.control(cmdSetLocality, []byte{locality})
+}
+
+// Stop sends CMD_STOP, which powers the TPM off, leaving swtpm running so
+// that its state can be replaced. Init powers it on again.
+func (t *TPM) Stop() error {
+	return t.control(cmdStop, nil)
+}
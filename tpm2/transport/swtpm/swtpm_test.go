@@ -0,0 +1,236 @@
+package swtpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/google/go-tpm-tools/simulator"
+	"github.com/google/go-tpm/tpm2"
+)
+
+// fakeSWTPM serves swtpm's data channel from the simulator and records the
+// control commands it receives.
+type fakeSWTPM struct {
+	data, ctrl net.Listener
+
+	mu       sync.Mutex
+	ctrlCmds [][]byte
+	// state is the permanent state blob, which the fake sends in pieces
+	// of at most stateChunk bytes.
+	state []byte
+}
+
+const stateChunk = 100
+
+func newFakeSWTPM(t *testing.T, network string) *fakeSWTPM {
+	t.Helper()
+	sim, err := simulator.Get()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	t.Cleanup(func() { sim.Close() })
+
+	listen := func(name string) net.Listener {
+		addr := "127.0.0.1:0"
+		if network == "unix" {
+			addr = filepath.Join(t.TempDir(), name)
+		}
+		l, err := net.Listen(network, addr)
+		if err != nil {
+			t.Fatalf("Listen: %v", err)
+		}
+		t.Cleanup(func() { l.Close() })
+		return l
+	}
+	f := &fakeSWTPM{data: listen("data"), ctrl: listen("ctrl")}
+
+	go func() {
+		conn, err := f.data.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			hdr := make([]byte, 10)
+			if _, err := io.ReadFull(conn, hdr); err != nil {
+				return
+			}
+			cmd := append(hdr, make([]byte, binary.BigEndian.Uint32(hdr[2:6])-10)...)
+			if _, err := io.ReadFull(conn, cmd[10:]); err != nil {
+				return
+			}
+			if _, err := sim.Write(cmd); err != nil {
+				return
+			}
+			rsp := make([]byte, 4096)
+			n, err := sim.Read(rsp)
+			if err != nil {
+				return
+			}
+			// Split the response to check that it is reassembled.
+			conn.Write(rsp[:3])
+			conn.Write(rsp[3:n])
+		}
+	}()
+	go func() {
+		for {
+			conn, err := f.ctrl.Accept()
+			if err != nil {
+				return
+			}
+			f.serveControl(conn)
+			conn.Close()
+		}
+	}()
+	return f
+}
+
+// serveControl reads one control command, records it and responds to it.
+func (f *fakeSWTPM) serveControl(conn net.Conn) {
+	read := func(req []byte, n int) []byte {
+		buf := make([]byte, n)
+		io.ReadFull(conn, buf)
+		return append(req, buf...)
+	}
+	req := read(nil, 4)
+	rsp := []byte{0, 0, 0, 0}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch binary.BigEndian.Uint32(req) {
+	case cmdInit:
+		req = read(req, 4)
+	case cmdSetLocality:
+		req = read(req, 1)
+	case cmdGetStateBlob:
+		req = read(req, 12)
+		offset := min(int(binary.BigEndian.Uint32(req[12:])), len(f.state))
+		data := f.state[offset:]
+		data = data[:min(len(data), stateChunk)]
+		rsp = binary.BigEndian.AppendUint32(rsp, 0)
+		rsp = binary.BigEndian.AppendUint32(rsp, uint32(len(f.state)))
+		rsp = binary.BigEndian.AppendUint32(rsp, uint32(len(data)))
+		rsp = append(rsp, data...)
+	case cmdSetStateBlob:
+		req = read(req, 12)
+		req = read(req, int(binary.BigEndian.Uint32(req[12:])))
+		f.state = req[16:]
+		req = req[:16]
+	}
+	f.ctrlCmds = append(f.ctrlCmds, req)
+	conn.Write(rsp)
+}
+
+func (f *fakeSWTPM) commands() [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ctrlCmds
+}
+
+func TestSWTPM(t *testing.T) {
+	for _, network := range []string{"tcp", "unix"} {
+		t.Run(network, func(t *testing.T) {
+			f := newFakeSWTPM(t, network)
+			tpm, err := Open(Config{
+				Network:     network,
+				Address:     f.data.Addr().String(),
+				CtrlAddress: f.ctrl.Addr().String(),
+				PowerOn:     true,
+			})
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer tpm.Close()
+
+			rsp, err := tpm2.GetRandom{BytesRequested: 16}.Execute(tpm)
+			if err != nil {
+				t.Fatalf("GetRandom: %v", err)
+			}
+			if len(rsp.RandomBytes.Buffer) != 16 {
+				t.Errorf("GetRandom returned %d bytes, want 16", len(rsp.RandomBytes.Buffer))
+			}
+
+			if err := tpm.SetLocality(3); err != nil {
+				t.Fatalf("SetLocality: %v", err)
+			}
+			if err := tpm.Shutdown(); err != nil {
+				t.Fatalf("Shutdown: %v", err)
+			}
+			want := [][]byte{
+				{0, 0, 0, 2, 0, 0, 0, 0},
+				{0, 0, 0, 5, 3},
+				{0, 0, 0, 3},
+			}
+			if got := f.commands(); !reflect.DeepEqual(got, want) {
+				t.Errorf("control commands = %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestNoControlChannel(t *testing.T) {
+	f := newFakeSWTPM(t, "unix")
+	tpm, err := Open(Config{Network: "unix", Address: f.data.Addr().String()})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tpm.Close()
+	if err := tpm.Init(true); !errors.Is(err, ErrNoControlChannel) {
+		t.Errorf("Init() = %v, want %v", err, ErrNoControlChannel)
+	}
+}
+
+func TestState(t *testing.T) {
+	f := newFakeSWTPM(t, "unix")
+	f.state = make([]byte, 250)
+	for i := range f.state {
+		f.state[i] = byte(i)
+	}
+	tpm, err := Open(Config{
+		Network:     "unix",
+		Address:     f.data.Addr().String(),
+		CtrlAddress: f.ctrl.Addr().String(),
+		PowerOn:     true,
+	})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tpm.Close()
+
+	saved, err := tpm.SaveState()
+	if err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+	if !bytes.Equal(saved.Blob, f.state) {
+		t.Errorf("SaveState() = %x, want %x", saved.Blob, f.state)
+	}
+
+	if err := tpm.RestoreState(&State{Blob: []byte("restored")}); err != nil {
+		t.Fatalf("RestoreState: %v", err)
+	}
+	if string(f.state) != "restored" {
+		t.Errorf("state after RestoreState = %q, want %q", f.state, "restored")
+	}
+	// The TPM is usable again once the state is restored.
+	if _, err := (tpm2.GetRandom{BytesRequested: 16}).Execute(tpm); err != nil {
+		t.Errorf("GetRandom after RestoreState: %v", err)
+	}
+	want := [][]byte{
+		{0, 0, 0, 2, 0, 0, 0, 0},
+		{0, 0, 0, 0xc, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0},
+		{0, 0, 0, 0xc, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 100},
+		{0, 0, 0, 0xc, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 200},
+		{0, 0, 0, 0xe},
+		{0, 0, 0, 0xd, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 8},
+		{0, 0, 0, 2, 0, 0, 0, 1},
+	}
+	if got := f.commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("control commands = %x, want %x", got, want)
+	}
+}
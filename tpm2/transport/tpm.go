@@ -2,13 +2,19 @@
 package transport
 
 import (
+	"errors"
 	"io"
+	"time"
 
 	"github.com/google/go-tpm/tpmutil"
 )
 
 // TPM represents a logical connection to a TPM.
 type TPM interface {
+	// Send sends a command and returns the response. Implementations must
+	// not use input after Send returns, since callers may reuse its
+	// buffer for the next command; one that finishes sending in the
+	// background, such as after giving up on a deadline, must copy it.
 	Send(input []byte) ([]byte, error)
 }
 
@@ -18,16 +24,96 @@ type TPMCloser interface {
 	io.Closer
 }
 
+// ResponseSizer is implemented by transports that read responses into a
+// buffer of configurable size. tpm2.ConfigureMaxResponseSize uses it to
+// match the buffer to the TPM's TPM_PT_MAX_RESPONSE_SIZE.
+type ResponseSizer interface {
+	// SetMaxResponseSize sets the size of the response buffer.
+	// A size of zero selects tpmutil.DefaultMaxResponseSize.
+	SetMaxResponseSize(size int)
+}
+
+// CommandTimeoutSetter is implemented by transports that wait for the TPM
+// to finish executing a command themselves, rather than leaving that to a
+// driver. Vendor quirks use it to allow for unusually slow commands.
+type CommandTimeoutSetter interface {
+	// SetCommandTimeout sets how long to wait for a response once a
+	// command has been started. A timeout of zero selects the transport's
+	// default.
+	SetCommandTimeout(timeout time.Duration)
+}
+
+// ResourceManager is implemented by transports that can tell whether they
+// talk to the TPM through a resource manager. A resource manager gives each
+// connection its own view of the TPM and flushes the transient objects and
+// sessions created through a connection when it is closed.
+type ResourceManager interface {
+	// ResourceManaged reports whether commands go through a resource
+	// manager.
+	ResourceManaged() bool
+}
+
+// LocalitySetter is implemented by transports that can send commands at a
+// locality other than 0: TIS and CRB register access, and the control
+// channels of software TPMs. DRTM-style flows need it to use the PCRs and
+// authorizations reserved for localities 2, 3 and 4.
+type LocalitySetter interface {
+	// SetLocality makes the commands sent after it run at the given
+	// locality.
+	SetLocality(locality uint8) error
+}
+
+// Wrapper is implemented by transports that send their commands through
+// another transport, such as those returned by Chain and WithContext. Find
+// uses it to look beneath them.
+type Wrapper interface {
+	// Unwrap returns the transport that commands are sent through.
+	Unwrap() TPM
+}
+
+// Find returns the first transport of type T among t and the transports
+// beneath it, following Unwrap for as long as they are Wrappers.
+func Find[T TPM](t TPM) (T, bool) {
+	for t != nil {
+		if found, ok := t.(T); ok {
+			return found, true
+		}
+		w, ok := t.(Wrapper)
+		if !ok {
+			break
+		}
+		t = w.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// ErrLocalityUnsupported is returned by SetLocality for transports that
+// can't select the locality.
+var ErrLocalityUnsupported = errors.New("transport: selecting the locality is not supported")
+
+// SetLocality makes the commands sent to t after it run at the given
+// locality, if t is a LocalitySetter.
+func SetLocality(t TPM, locality uint8) error {
+	ls, ok := t.(LocalitySetter)
+	if !ok {
+		return ErrLocalityUnsupported
+	}
+	return ls.SetLocality(locality)
+}
+
 // wrappedRW represents a struct that wraps an io.ReadWriter
 // to a transport.TPM to be compatible with tpmdirect.
 type wrappedRW struct {
-	transport io.ReadWriter
+	transport   io.ReadWriter
+	maxResponse int
 }
 
 // wrappedRWC represents a struct that wraps an io.ReadWriteCloser
 // to a transport.TPM to be compatible with tpmdirect.
 type wrappedRWC struct {
-	transport io.ReadWriteCloser
+	transport   io.ReadWriteCloser
+	maxResponse int
 }
 
 // wrappedTPM represents a struct that wraps a transport.TPM's underlying
@@ -56,12 +142,15 @@ func ToReadWriter(tpm TPM) io.ReadWriter {
 }
 
 // Read copies t.response into the p buffer and return the appropriate length.
+// It returns io.EOF only once the whole response has been read, since
+// tpmutil.RunCommand reads a response with a single call and fails on any
+// error.
 func (t *wrappedTPM) Read(p []byte) (int, error) {
+	if len(t.response) == 0 && len(p) != 0 {
+		return 0, io.EOF
+	}
 	n := copy(p, t.response)
 	t.response = t.response[n:]
-	if len(t.response) == 0 {
-		return n, io.EOF
-	}
 	return n, nil
 }
 
@@ -76,15 +165,49 @@ func (t *wrappedTPM) Write(p []byte) (n int, err error) {
 
 // Send implements the TPM interface.
 func (t *wrappedRW) Send(input []byte) ([]byte, error) {
-	return tpmutil.RunCommandRaw(t.transport, input)
+	return tpmutil.RunCommandRawSize(t.transport, input, t.maxResponse)
+}
+
+// SetMaxResponseSize implements the ResponseSizer interface.
+func (t *wrappedRW) SetMaxResponseSize(size int) {
+	t.maxResponse = size
+	if rs, ok := t.transport.(ResponseSizer); ok {
+		rs.SetMaxResponseSize(size)
+	}
+}
+
+// SetLocality implements the LocalitySetter interface.
+func (t *wrappedRW) SetLocality(locality uint8) error {
+	return setLocality(t.transport, locality)
 }
 
 // Send implements the TPM interface.
 func (t *wrappedRWC) Send(input []byte) ([]byte, error) {
-	return tpmutil.RunCommandRaw(t.transport, input)
+	return tpmutil.RunCommandRawSize(t.transport, input, t.maxResponse)
+}
+
+// SetMaxResponseSize implements the ResponseSizer interface.
+func (t *wrappedRWC) SetMaxResponseSize(size int) {
+	t.maxResponse = size
+	if rs, ok := t.transport.(ResponseSizer); ok {
+		rs.SetMaxResponseSize(size)
+	}
+}
+
+// SetLocality implements the LocalitySetter interface.
+func (t *wrappedRWC) SetLocality(locality uint8) error {
+	return setLocality(t.transport, locality)
 }
 
 // Close implements the TPM interface.
 func (t *wrappedRWC) Close() error {
 	return t.transport.Close()
 }
+
+// setLocality sets the locality of a wrapped io.ReadWriter that supports it.
+func setLocality(rw io.ReadWriter, locality uint8) error {
+	if ls, ok := rw.(LocalitySetter); ok {
+		return ls.SetLocality(locality)
+	}
+	return ErrLocalityUnsupported
+}
@@ -0,0 +1,87 @@
+//go:build linux
+
+// Package vsocktpm provides access to a TPM over a virtio socket (AF_VSOCK).
+// It lets a VM guest use a vTPM run by its host without a paravirtual TPM
+// device, as confidential VMs often lack one.
+//
+// Commands and responses are sent over the stream as they are, with no
+// framing, as on swtpm's data channel. The host can serve the vTPM with
+// swtpm and relay connections to it, for example with
+//
+//	socat VSOCK-LISTEN:2321,fork TCP:127.0.0.1:2321
+package vsocktpm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// HostCID is the context ID of the host, as seen from a guest.
+const HostCID = unix.VMADDR_CID_HOST
+
+// maxResponseSize bounds the size of a TPM response read from the socket.
+const maxResponseSize = 1 << 16
+
+// TPM is a connection to a TPM over vsock. It is safe for concurrent use.
+type TPM struct {
+	mu   sync.Mutex
+	conn io.ReadWriteCloser
+}
+
+var _ transport.TPMCloser = (*TPM)(nil)
+
+// Open connects to the TPM served on the given port of the VM with the given
+// context ID, which is HostCID for a vTPM run by the host.
+func Open(cid, port uint32) (*TPM, error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("creating vsock socket: %w", err)
+	}
+	if err := unix.Connect(fd, &unix.SockaddrVM{CID: cid, Port: port}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("connecting to vsock %d:%d: %w", cid, port, err)
+	}
+	// A non-blocking descriptor is handled by the runtime poller, so that
+	// a blocked read does not tie up a thread.
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return &TPM{conn: os.NewFile(uintptr(fd), fmt.Sprintf("vsock:%d:%d", cid, port))}, nil
+}
+
+// Send implements transport.TPM.
+func (t *TPM) Send(cmd []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.conn.Write(cmd); err != nil {
+		return nil, err
+	}
+	// The response is read in two parts: the header, which holds the
+	// response size, and the rest.
+	rsp := make([]byte, 10)
+	if _, err := io.ReadFull(t.conn, rsp); err != nil {
+		return nil, fmt.Errorf("reading response header: %w", err)
+	}
+	size := binary.BigEndian.Uint32(rsp[2:6])
+	if size < 10 || size > maxResponseSize {
+		return nil, fmt.Errorf("invalid response size %d", size)
+	}
+	rsp = append(rsp, make([]byte, size-10)...)
+	if _, err := io.ReadFull(t.conn, rsp[10:]); err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	return rsp, nil
+}
+
+// Close closes the connection.
+func (t *TPM) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,93 @@
+//go:build linux
+
+package vsocktpm
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+	testhelper "github.com/google/go-tpm/tpm2/transport/test"
+)
+
+// serve relays the commands read from conn to tpm, as a host would, until
+// conn is closed.
+func serve(conn io.ReadWriteCloser, tpm transport.TPM) {
+	defer conn.Close()
+	for {
+		cmd := make([]byte, 10)
+		if _, err := io.ReadFull(conn, cmd); err != nil {
+			return
+		}
+		size := binary.BigEndian.Uint32(cmd[2:6])
+		cmd = append(cmd, make([]byte, size-10)...)
+		if _, err := io.ReadFull(conn, cmd[10:]); err != nil {
+			return
+		}
+		rsp, err := tpm.Send(cmd)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write(rsp); err != nil {
+			return
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	testhelper.RunTest(t, nil, func() (transport.TPMCloser, error) {
+		sim, err := simulator.OpenSimulator()
+		if err != nil {
+			t.Fatalf("could not connect to TPM simulator: %v", err)
+		}
+		t.Cleanup(func() { sim.Close() })
+		guest, host := net.Pipe()
+		go serve(host, sim)
+		return &TPM{conn: guest}, nil
+	})
+}
+
+// TestLoopback connects over the vsock loopback, which needs the
+// vsock_loopback kernel module.
+func TestLoopback(t *testing.T) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Skipf("vsock is not available: %v", err)
+	}
+	l := os.NewFile(uintptr(fd), "vsock listener")
+	defer l.Close()
+	if err := unix.Bind(fd, &unix.SockaddrVM{CID: unix.VMADDR_CID_LOCAL, Port: unix.VMADDR_PORT_ANY}); err != nil {
+		t.Skipf("vsock loopback is not available: %v", err)
+	}
+	if err := unix.Listen(fd, 1); err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	sa, err := unix.Getsockname(fd)
+	if err != nil {
+		t.Fatalf("Getsockname: %v", err)
+	}
+	port := sa.(*unix.SockaddrVM).Port
+
+	sim, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	defer sim.Close()
+	go func() {
+		nfd, _, err := unix.Accept(fd)
+		if err != nil {
+			return
+		}
+		serve(os.NewFile(uintptr(nfd), "vsock connection"), sim)
+	}()
+
+	testhelper.RunTest(t, []error{unix.ENODEV, unix.ECONNRESET}, func() (transport.TPMCloser, error) {
+		return Open(unix.VMADDR_CID_LOCAL, port)
+	})
+}
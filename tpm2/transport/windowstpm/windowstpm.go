@@ -4,24 +4,61 @@
 package windowstpm
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 
+	"github.com/google/go-tpm/tpm2"
 	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpmutil"
 	"github.com/google/go-tpm/tpmutil/tbs"
 )
 
 var (
 	// ErrNotTPM20 indicates that a TPM 2.0 was not found.
 	ErrNotTPM20 = errors.New("device is not a TPM 2.0")
+	// ErrCommandBlocked indicates that TBS refused to send a command to the
+	// TPM, as it does for commands blocked by Group Policy or reserved for
+	// the operating system.
+	ErrCommandBlocked = errors.New("command blocked by TBS")
+	// ErrCommandTooLarge indicates that a command exceeds the size TBS
+	// accepts.
+	ErrCommandTooLarge = errors.New("command too large for TBS")
 )
 
 const (
-	maxTPMResponse = 4096
+	// tpmECommandBlocked is the response code TBS returns in place of the
+	// TPM's response for a blocked command: TPM_E_COMMAND_BLOCKED without
+	// its facility bits.
+	tpmECommandBlocked = 0x400
+	// maxResponseSize bounds how far the response buffer grows when TBS
+	// reports that it is too small.
+	maxResponseSize = 1 << 16
 )
 
-// Open opens a channel to the TPM via TBS.
+// resendable lists the commands that are resent when TBS reports that the
+// response buffer is too small. They only read the TPM's state, so running
+// them twice gives the same response; any other command may already have
+// taken effect.
+var resendable = map[tpm2.TPMCC]bool{
+	tpm2.TPMCCGetCapability: true,
+	tpm2.TPMCCGetTestResult: true,
+	tpm2.TPMCCNVReadPublic:  true,
+	tpm2.TPMCCPCRRead:       true,
+	tpm2.TPMCCReadClock:     true,
+	tpm2.TPMCCReadPublic:    true,
+}
+
+// tbsContext is the part of tbs.Context used by winTPMBuffer.
+type tbsContext interface {
+	SubmitCommand(priority tbs.CommandPriority, commandBuffer []byte, responseBuffer []byte) (uint32, error)
+	Close() error
+}
+
+// Open opens a channel to the TPM via TBS. Responses are read into a buffer of
+// tpmutil.DefaultMaxResponseSize bytes; tpm2.ConfigureMaxResponseSize sizes
+// it to the TPM instead, at the cost of a command.
 func Open() (transport.TPMCloser, error) {
 	info, err := tbs.GetDeviceInfo()
 	if err != nil {
@@ -33,16 +70,19 @@ func Open() (transport.TPMCloser, error) {
 	}
 
 	tpmContext, err := tbs.CreateContext(tbs.TPMVersion20, tbs.IncludeTPM20)
+	if err != nil {
+		return nil, err
+	}
 	rwc := &winTPMBuffer{
 		context:   tpmContext,
-		outBuffer: make([]byte, 0, maxTPMResponse),
+		outBuffer: make([]byte, 0, tpmutil.DefaultMaxResponseSize),
 	}
-	return transport.FromReadWriteCloser(rwc), err
+	return transport.FromReadWriteCloser(rwc), nil
 }
 
 // winTPMBuffer is a ReadWriteCloser to access the TPM in Windows.
 type winTPMBuffer struct {
-	context   tbs.Context
+	context   tbsContext
 	outBuffer []byte
 }
 
@@ -51,22 +91,45 @@ type winTPMBuffer struct {
 // Executes the TPM command specified by commandBuffer (at Normal Priority), returning the number
 // of bytes in the command and any error code returned by executing the TPM command. Command
 // response can be read by calling Read().
+//
+// If the response buffer is too small, the commands listed in resendable are
+// resent with a larger buffer, provided they have no sessions, whose nonces
+// would not survive a second run. Others may have taken effect, so the
+// error is returned rather than run them twice.
 func (rwc *winTPMBuffer) Write(commandBuffer []byte) (int, error) {
-	// TPM spec defines longest possible response to be maxTPMResponse.
-	rwc.outBuffer = rwc.outBuffer[:maxTPMResponse]
-
-	outBufferLen, err := rwc.context.SubmitCommand(
-		tbs.NormalPriority,
-		commandBuffer,
-		rwc.outBuffer,
-	)
-
-	if err != nil {
+	var cc tpm2.TPMCC
+	var resend bool
+	if len(commandBuffer) >= 10 {
+		cc = tpm2.TPMCC(binary.BigEndian.Uint32(commandBuffer[6:10]))
+		resend = resendable[cc] &&
+			tpm2.TPMST(binary.BigEndian.Uint16(commandBuffer)) == tpm2.TPMSTNoSessions
+	}
+	for {
+		rwc.outBuffer = rwc.outBuffer[:cap(rwc.outBuffer)]
+		outBufferLen, err := rwc.context.SubmitCommand(
+			tbs.NormalPriority,
+			commandBuffer,
+			rwc.outBuffer,
+		)
+		if errors.Is(err, tbs.ErrInsufficientBuffer) && resend && cap(rwc.outBuffer) < maxResponseSize {
+			rwc.outBuffer = make([]byte, 0, 2*cap(rwc.outBuffer))
+			continue
+		}
+		if err != nil {
+			rwc.outBuffer = rwc.outBuffer[:0]
+			if errors.Is(err, tbs.ErrBufferTooLarge) {
+				return 0, fmt.Errorf("%w: %d-byte %v", ErrCommandTooLarge, len(commandBuffer), cc)
+			}
+			return 0, err
+		}
+		// Shrink outBuffer so it is length of response.
+		rwc.outBuffer = rwc.outBuffer[:outBufferLen]
+		break
+	}
+	if len(rwc.outBuffer) >= 10 && binary.BigEndian.Uint32(rwc.outBuffer[6:10]) == tpmECommandBlocked {
 		rwc.outBuffer = rwc.outBuffer[:0]
-		return 0, err
+		return 0, fmt.Errorf("%w: %v", ErrCommandBlocked, cc)
 	}
-	// Shrink outBuffer so it is length of response.
-	rwc.outBuffer = rwc.outBuffer[:outBufferLen]
 	return len(commandBuffer), nil
 }
 
@@ -83,6 +146,14 @@ func (rwc *winTPMBuffer) Read(responseBuffer []byte) (int, error) {
 	return lenCopied, nil
 }
 
+// SetMaxResponseSize implements the transport.ResponseSizer interface.
+func (rwc *winTPMBuffer) SetMaxResponseSize(size int) {
+	if size <= 0 {
+		size = tpmutil.DefaultMaxResponseSize
+	}
+	rwc.outBuffer = make([]byte, 0, size)
+}
+
 // Close implements the io.Closer interface.
 func (rwc *winTPMBuffer) Close() error {
 	return rwc.context.Close()
@@ -3,12 +3,84 @@
 package windowstpm
 
 import (
+	"encoding/binary"
+	"errors"
 	"os"
 	"testing"
 
+	"github.com/google/go-tpm/tpm2"
 	testhelper "github.com/google/go-tpm/tpm2/transport/test"
+	"github.com/google/go-tpm/tpmutil/tbs"
 )
 
 func TestLocalTPM(t *testing.T) {
 	testhelper.RunTest(t, []error{os.ErrNotExist, os.ErrPermission, ErrNotTPM20}, Open)
 }
+
+// fakeTBS answers every command with a response of size bytes, reporting
+// tbs.ErrInsufficientBuffer if it doesn't fit.
+type fakeTBS struct {
+	size      int
+	submitted int
+}
+
+func (f *fakeTBS) SubmitCommand(priority tbs.CommandPriority, commandBuffer []byte, responseBuffer []byte) (uint32, error) {
+	f.submitted++
+	if len(responseBuffer) < f.size {
+		return 0, tbs.ErrInsufficientBuffer
+	}
+	rsp := responseBuffer[:f.size]
+	binary.BigEndian.PutUint16(rsp, uint16(tpm2.TPMSTNoSessions))
+	binary.BigEndian.PutUint32(rsp[2:], uint32(f.size))
+	binary.BigEndian.PutUint32(rsp[6:], uint32(tpm2.TPMRCSuccess))
+	return uint32(f.size), nil
+}
+
+func (f *fakeTBS) Close() error { return nil }
+
+func TestInsufficientBuffer(t *testing.T) {
+	command := func(tag tpm2.TPMST, cc tpm2.TPMCC) []byte {
+		cmd := make([]byte, 10)
+		binary.BigEndian.PutUint16(cmd, uint16(tag))
+		binary.BigEndian.PutUint32(cmd[2:], 10)
+		binary.BigEndian.PutUint32(cmd[6:], uint32(cc))
+		return cmd
+	}
+	for _, tc := range []struct {
+		name   string
+		cmd    []byte
+		resend bool
+	}{
+		{"GetCapability", command(tpm2.TPMSTNoSessions, tpm2.TPMCCGetCapability), true},
+		{"ReadPublic", command(tpm2.TPMSTNoSessions, tpm2.TPMCCReadPublic), true},
+		{"ReadPublicWithSessions", command(tpm2.TPMSTSessions, tpm2.TPMCCReadPublic), false},
+		// GetRandom changes nothing visible, but isn't listed.
+		{"GetRandom", command(tpm2.TPMSTNoSessions, tpm2.TPMCCGetRandom), false},
+		{"Create", command(tpm2.TPMSTSessions, tpm2.TPMCCCreate), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &fakeTBS{size: 2048}
+			rwc := &winTPMBuffer{context: f, outBuffer: make([]byte, 0, 1024)}
+			_, err := rwc.Write(tc.cmd)
+			if tc.resend {
+				if err != nil {
+					t.Fatalf("Write() = %v", err)
+				}
+				if f.submitted != 2 {
+					t.Errorf("command submitted %d times, want 2", f.submitted)
+				}
+				rsp := make([]byte, 4096)
+				if n, _ := rwc.Read(rsp); n != f.size {
+					t.Errorf("Read() = %d bytes, want %d", n, f.size)
+				}
+				return
+			}
+			if !errors.Is(err, tbs.ErrInsufficientBuffer) {
+				t.Errorf("Write() = %v, want %v", err, tbs.ErrInsufficientBuffer)
+			}
+			if f.submitted != 1 {
+				t.Errorf("command submitted %d times, want 1", f.submitted)
+			}
+		})
+	}
+}
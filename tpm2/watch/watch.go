@@ -0,0 +1,217 @@
+// Package watch polls a TPM for platform events that it has no way to report
+// by itself: TPM Resets and Restarts, TPM2_Clear, loss of an orderly
+// shutdown, and changes in dictionary attack (DA) lockout state. Agents can
+// use it to notice that the TPM was reset behind their back, invalidating
+// loaded objects and sessions, or that someone is guessing authorization
+// values.
+//
+//	events, err := watch.Watch(ctx, tpm, 10*time.Second)
+//	if err != nil {
+//		return err
+//	}
+//	for ev := range events {
+//		log.Printf("TPM: %v", ev)
+//	}
+package watch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// State is what the watcher samples on every poll.
+type State struct {
+	// Clock, ResetCount, RestartCount and Safe are the TPMS_CLOCK_INFO
+	// reported by TPM2_ReadClock.
+	Clock        uint64
+	ResetCount   uint32
+	RestartCount uint32
+	Safe         bool
+	// DA is the dictionary attack protection state.
+	DA tpm2.LockoutStatus
+}
+
+// Read samples the TPM's state.
+func Read(t transport.TPM) (*State, error) {
+	clock, err := tpm2.ReadClock{}.Execute(t)
+	if err != nil {
+		return nil, fmt.Errorf("watch: reading clock: %w", err)
+	}
+	da, err := tpm2.GetLockoutStatus(t)
+	if err != nil {
+		return nil, fmt.Errorf("watch: reading lockout status: %w", err)
+	}
+	info := clock.CurrentTime.ClockInfo
+	return &State{
+		Clock:        info.Clock,
+		ResetCount:   info.ResetCount,
+		RestartCount: info.RestartCount,
+		Safe:         bool(info.Safe),
+		DA:           *da,
+	}, nil
+}
+
+// Kind is the kind of an event.
+type Kind int
+
+// The kinds of events.
+const (
+	// Reset means that the TPM went through a TPM Reset, usually a reboot:
+	// transient objects and sessions are gone and PCRs are back to their
+	// initial values.
+	Reset Kind = iota + 1
+	// Restart means that the TPM was restarted or resumed from a saved
+	// state, as after hibernation. PCRs may have been reset, but saved
+	// session contexts are still valid.
+	Restart
+	// Cleared means that TPM2_Clear ran, which zeroes the reset and restart
+	// counts and replaces the owner and endorsement hierarchies' seeds.
+	Cleared
+	// ClockUnsafe means that the TPM lost power without an orderly shutdown,
+	// so values of Clock it reported before may be reported again.
+	ClockUnsafe
+	// AuthFailures means that the DA failure counter went up: an
+	// authorization with the wrong value was attempted on a DA-protected
+	// object.
+	AuthFailures
+	// LockoutEntered means that the TPM has entered DA lockout, and refuses
+	// authorizations of DA-protected objects.
+	LockoutEntered
+	// LockoutExited means that the TPM has left DA lockout.
+	LockoutExited
+	// Error means that polling the TPM failed. The watcher keeps polling,
+	// and compares the next state it reads with the last one it read.
+	Error
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Reset:
+		return "reset"
+	case Restart:
+		return "restart"
+	case Cleared:
+		return "cleared"
+	case ClockUnsafe:
+		return "clock unsafe"
+	case AuthFailures:
+		return "authorization failures"
+	case LockoutEntered:
+		return "lockout entered"
+	case LockoutExited:
+		return "lockout exited"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Event is a change noticed by the watcher.
+type Event struct {
+	Kind Kind
+	// Time is when the change was noticed.
+	Time time.Time
+	// Old and New are the states before and after the change. Both are
+	// nil for Error events.
+	Old, New *State
+	// Err is the error of an Error event.
+	Err error
+}
+
+func (e Event) String() string {
+	switch e.Kind {
+	case Reset, Restart, Cleared:
+		return fmt.Sprintf("%v (reset count %d, restart count %d)", e.Kind, e.New.ResetCount, e.New.RestartCount)
+	case AuthFailures:
+		return fmt.Sprintf("%v (%d of %d)", e.Kind, e.New.DA.Counter, e.New.DA.MaxTries)
+	case Error:
+		return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+	}
+	return e.Kind.String()
+}
+
+// Compare returns the kinds of events that happened between two states, in
+// the order of the Kind constants.
+func Compare(old, new *State) []Kind {
+	var kinds []Kind
+	switch {
+	case new.ResetCount > old.ResetCount:
+		kinds = append(kinds, Reset)
+	case new.ResetCount < old.ResetCount:
+		kinds = append(kinds, Cleared)
+	case new.RestartCount != old.RestartCount:
+		kinds = append(kinds, Restart)
+	case new.Clock < old.Clock:
+		// Clock only goes backwards on TPM2_Clear, which may find the
+		// counts already at zero.
+		kinds = append(kinds, Cleared)
+	}
+	if old.Safe && !new.Safe {
+		kinds = append(kinds, ClockUnsafe)
+	}
+	if new.DA.Counter > old.DA.Counter {
+		kinds = append(kinds, AuthFailures)
+	}
+	if !old.DA.InLockout && new.DA.InLockout {
+		kinds = append(kinds, LockoutEntered)
+	}
+	if old.DA.InLockout && !new.DA.InLockout {
+		kinds = append(kinds, LockoutExited)
+	}
+	return kinds
+}
+
+// Watch reads the TPM's state and then polls it every interval, sending an
+// event on the returned channel for every change. The channel is
+// unbuffered; polling pauses while an event waits to be received. It is
+// closed once ctx is done.
+//
+// Watch sends commands to t from its own goroutine, so if the program uses t
+// too, t must be safe for concurrent use, and it must not be closed before
+// ctx is done. Watch returns an error if the first read fails.
+func Watch(ctx context.Context, t transport.TPM, interval time.Duration) (<-chan Event, error) {
+	last, err := Read(t)
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		send := func(ev Event) bool {
+			select {
+			case events <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			now := time.Now()
+			s, err := Read(t)
+			if err != nil {
+				if !send(Event{Kind: Error, Time: now, Err: err}) {
+					return
+				}
+				continue
+			}
+			for _, k := range Compare(last, s) {
+				if !send(Event{Kind: k, Time: now, Old: last, New: s}) {
+					return
+				}
+			}
+			last = s
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,128 @@
+package watch
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+)
+
+func TestCompare(t *testing.T) {
+	base := State{Clock: 1000, ResetCount: 3, RestartCount: 2, Safe: true, DA: tpm2.LockoutStatus{Counter: 1, MaxTries: 3}}
+	for _, tc := range []struct {
+		name   string
+		change func(s *State)
+		want   []Kind
+	}{
+		{"NoChange", func(s *State) { s.Clock += 500 }, nil},
+		{"Reset", func(s *State) { s.ResetCount++; s.RestartCount = 0; s.Clock = 10 }, []Kind{Reset}},
+		{"Restart", func(s *State) { s.RestartCount++ }, []Kind{Restart}},
+		{"Cleared", func(s *State) { s.ResetCount, s.RestartCount, s.Clock = 0, 0, 5 }, []Kind{Cleared}},
+		{"ClearedAtZero", func(s *State) { s.Clock = 5 }, []Kind{Cleared}},
+		{"ClockUnsafe", func(s *State) { s.ResetCount++; s.Safe = false }, []Kind{Reset, ClockUnsafe}},
+		{"AuthFailures", func(s *State) { s.DA.Counter = 2 }, []Kind{AuthFailures}},
+		{"Forgiven", func(s *State) { s.DA.Counter = 0 }, nil},
+		{"LockoutEntered", func(s *State) { s.DA.Counter = 3; s.DA.InLockout = true }, []Kind{AuthFailures, LockoutEntered}},
+	} {
+		s := base
+		tc.change(&s)
+		if got := Compare(&base, &s); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Compare() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	locked := base
+	locked.DA.InLockout = true
+	if got, want := Compare(&locked, &base), []Kind{LockoutExited}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Compare() after lockout = %v, want %v", got, want)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	sim, err := simulator.OpenSimulator()
+	if err != nil {
+		t.Fatalf("could not connect to TPM simulator: %v", err)
+	}
+	// The simulator is not safe for concurrent use.
+	var mu sync.Mutex
+	thetpm := transport.Chain(sim, func(cmd []byte, next transport.SendFunc) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return next(cmd)
+	})
+	defer thetpm.Close()
+
+	key, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{UserAuth: tpm2.TPM2BAuth{Buffer: []byte("password")}},
+		},
+		InPublic: tpm2.New2B(tpm2.TPMTPublic{
+			Type:    tpm2.TPMAlgECC,
+			NameAlg: tpm2.TPMAlgSHA256,
+			ObjectAttributes: tpm2.TPMAObject{
+				FixedTPM:            true,
+				FixedParent:         true,
+				SensitiveDataOrigin: true,
+				UserWithAuth:        true,
+				SignEncrypt:         true,
+			},
+			Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+				Scheme: tpm2.TPMTECCScheme{
+					Scheme:  tpm2.TPMAlgECDSA,
+					Details: tpm2.NewTPMUAsymScheme(tpm2.TPMAlgECDSA, &tpm2.TPMSSigSchemeECDSA{HashAlg: tpm2.TPMAlgSHA256}),
+				},
+				CurveID: tpm2.TPMECCNistP256,
+			}),
+		}),
+	}.Execute(thetpm)
+	if err != nil {
+		t.Fatalf("CreatePrimary: %v", err)
+	}
+	defer tpm2.FlushContext{FlushHandle: key.ObjectHandle}.Execute(thetpm)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := Watch(ctx, thetpm, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	// Nothing happens while nobody uses the TPM.
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event: %v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	digest := sha256.Sum256([]byte("message"))
+	if _, err := (tpm2.Sign{
+		KeyHandle: tpm2.AuthHandle{
+			Handle: key.ObjectHandle,
+			Name:   key.Name,
+			Auth:   tpm2.PasswordAuth([]byte("wrong")),
+		},
+		Digest:     tpm2.TPM2BDigest{Buffer: digest[:]},
+		Validation: tpm2.TPMTTKHashCheck{Tag: tpm2.TPMSTHashCheck},
+	}).Execute(thetpm); !errors.Is(err, tpm2.TPMRCAuthFail) {
+		t.Fatalf("Sign() with the wrong password = %v, want %v", err, tpm2.TPMRCAuthFail)
+	}
+	select {
+	case ev := <-events:
+		if ev.Kind != AuthFailures || ev.New.DA.Counter != ev.Old.DA.Counter+1 {
+			t.Errorf("event = %v (counter %d -> %d), want one more authorization failure", ev, ev.Old.DA.Counter, ev.New.DA.Counter)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event after a failed authorization")
+	}
+
+	cancel()
+	for range events {
+	}
+}
@@ -17,6 +17,7 @@
 package tpmutil
 
 import (
+	"encoding/binary"
 	"fmt"
 	"net"
 	"testing"
@@ -195,3 +196,26 @@ func TestEmulatorReadWriteCloserDialerError(t *testing.T) {
 		t.Errorf("incorrectly wrote when the dialer returned an error")
 	}
 }
+
+func TestEmulatorReadWriteCloserResponseTooLarge(t *testing.T) {
+	rsp := make([]byte, 64)
+	binary.BigEndian.PutUint16(rsp, 0x8001)
+	binary.BigEndian.PutUint32(rsp[2:], uint32(len(rsp)))
+
+	rwc := newMockEmulator()
+	rwc.dialer = func(_, _ string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			server.Read(make([]byte, len(input)))
+			server.Write(rsp)
+		}()
+		return client, nil
+	}
+	if _, err := rwc.Write(input); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if n, err := rwc.Read(make([]byte, 32)); err == nil {
+		t.Errorf("Read() returned %d bytes of a %d-byte response without an error", n, len(rsp))
+	}
+}
@@ -123,6 +123,9 @@ type Conn struct {
 	// Cached connection
 	conn net.Conn
 
+	// Locality of the commands sent.
+	locality uint8
+
 	// Response bytes left over from the previous read.
 	prevRead *bytes.Reader
 }
@@ -168,8 +171,7 @@ func (c *Conn) Write(b []byte) (int, error) {
 	buff := &bytes.Buffer{}
 	// "send command" flag
 	binary.Write(buff, binary.BigEndian, tpmSendCommand)
-	// locality 0
-	buff.WriteByte(0)
+	buff.WriteByte(c.locality)
 	// size of the command
 	binary.Write(buff, binary.BigEndian, uint32(len(b)))
 	// raw command
@@ -181,6 +183,13 @@ func (c *Conn) Write(b []byte) (int, error) {
 	return len(b), nil
 }
 
+// SetLocality sets the locality of the commands written after it. Besides
+// localities 0 to 4, the simulator accepts the extended localities 32 to 255.
+func (c *Conn) SetLocality(locality uint8) error {
+	c.locality = locality
+	return nil
+}
+
 // Close closes any outgoing connections to the TPM simulator.
 func (c *Conn) Close() error {
 	// See: D.4.3.12. TpmServer()
@@ -17,24 +17,37 @@
 package tpmutil
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"time"
 )
 
-// maxTPMResponse is the largest possible response from the TPM. We need to know
-// this because we don't always know the length of the TPM response, and
-// /dev/tpm insists on giving it all back in a single value rather than
+// DefaultMaxResponseSize is the size of the buffer that responses are read
+// into when the TPM's own limit (TPM_PT_MAX_RESPONSE_SIZE) is not known. We
+// need a limit because we don't always know the length of the TPM response,
+// and /dev/tpm insists on giving it all back in a single value rather than
 // returning a header and a body in separate responses.
-const maxTPMResponse = 4096
+const DefaultMaxResponseSize = 4096
 
 // RunCommandRaw executes the given raw command and returns the raw response.
 // Does not check the response code except to execute retry logic.
 func RunCommandRaw(rw io.ReadWriter, inb []byte) ([]byte, error) {
+	return RunCommandRawSize(rw, inb, DefaultMaxResponseSize)
+}
+
+// RunCommandRawSize is like RunCommandRaw, but reads the response into a
+// buffer of maxResponse bytes. A maxResponse of zero or less selects
+// DefaultMaxResponseSize.
+func RunCommandRawSize(rw io.ReadWriter, inb []byte, maxResponse int) ([]byte, error) {
 	if rw == nil {
 		return nil, errors.New("nil TPM handle")
 	}
+	if maxResponse <= 0 {
+		maxResponse = DefaultMaxResponseSize
+	}
 
 	// f(t) = (2^t)ms, up to 2s
 	var backoffFac uint
@@ -55,15 +68,8 @@ func RunCommandRaw(rw io.ReadWriter, inb []byte) ([]byte, error) {
 			}
 		}
 
-		outb = make([]byte, maxTPMResponse)
-		outlen, err := rw.Read(outb)
-		if err != nil {
-			return nil, err
-		}
-		// Resize the buffer to match the amount read from the TPM.
-		outb = outb[:outlen]
-
-		_, err = Unpack(outb, &rh)
+		var err error
+		outb, err = readResponse(rw, maxResponse, &rh)
 		if err != nil {
 			return nil, err
 		}
@@ -85,6 +91,54 @@ func RunCommandRaw(rw io.ReadWriter, inb []byte) ([]byte, error) {
 	return outb, nil
 }
 
+// maxResponseSize bounds the response size readResponse accepts from a
+// response header, so that a corrupt header can't make it allocate without
+// limit.
+const maxResponseSize = 1 << 20
+
+// readResponse reads a response into a buffer of maxResponse bytes and
+// unpacks its header into rh. Device files return the whole response from
+// a single Read, but other transports, such as sockets, may split it; if
+// the first Read returns less than the size in the header, readResponse
+// keeps reading until it has the rest, growing the buffer if the response
+// is larger than maxResponse.
+func readResponse(r io.Reader, maxResponse int, rh *responseHeader) ([]byte, error) {
+	hdrSize := binary.Size(rh)
+	// The buffer must at least hold the header, which says how much more
+	// to read.
+	outb := make([]byte, max(maxResponse, hdrSize))
+	outlen, err := r.Read(outb)
+	if err != nil {
+		return nil, err
+	}
+	if outlen < hdrSize {
+		n, err := io.ReadFull(r, outb[outlen:hdrSize])
+		if err != nil {
+			return nil, fmt.Errorf("reading response header: %w", err)
+		}
+		outlen += n
+	}
+	if _, err := Unpack(outb[:outlen], rh); err != nil {
+		return nil, err
+	}
+
+	size := int(rh.Size)
+	if size <= outlen {
+		// Resize the buffer to match the amount read from the TPM.
+		return outb[:outlen], nil
+	}
+	if size > maxResponseSize {
+		return nil, fmt.Errorf("response size %d exceeds the maximum of %d bytes", size, maxResponseSize)
+	}
+	if size > len(outb) {
+		outb = append(outb, make([]byte, size-len(outb))...)
+	}
+	if _, err := io.ReadFull(r, outb[outlen:size]); err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	return outb[:size], nil
+}
+
 // RunCommand executes cmd with given tag and arguments. Returns TPM response
 // body (without response header) and response code from the header. Returned
 // error may be nil if response code is not RCSuccess; caller should check
@@ -17,37 +17,95 @@
 package tpmutil
 
 import (
+	"encoding/binary"
 	"fmt"
 	"io"
 	"net"
+	"net/url"
 	"os"
+	"strings"
 )
 
 // OpenTPM opens a channel to the TPM at the given path. If the file is a
 // device, then it treats it like a normal TPM device, and if the file is a
-// Unix domain socket, then it opens a connection to the socket.
+// Unix domain socket, then it opens a connection to the socket. A path that
+// starts with '@' names a socket in the Linux abstract namespace.
+//
+// The path may also be a URI, which selects the transport explicitly:
+//
+//	device:///dev/tpm0        a TPM character device
+//	unix:///run/swtpm/sock    a Unix domain socket
+//	unix:@swtpm               a socket in the abstract namespace
+//	tcp://localhost:2321      a TCP socket; the port defaults to 2321
+//
+// Sockets, whether Unix or TCP, are used like NewEmulatorReadWriteCloser
+// uses them: one connection per command, carrying raw TPM commands and
+// responses. That is the framing of swtpm's server socket; the Microsoft
+// simulator (mssim) frames its commands differently, so it can't be opened
+// this way even though it listens on the same port.
 func OpenTPM(path string) (io.ReadWriteCloser, error) {
-	// If it's a regular file, then open it
-	var rwc io.ReadWriteCloser
+	// Anything that isn't a URI with one of these schemes is a file path,
+	// even if it contains a colon.
+	u, err := url.Parse(path)
+	if err != nil {
+		return openPath(path)
+	}
+	switch u.Scheme {
+	case "device":
+		return openDevice(u.Path)
+	case "unix":
+		name := u.Path
+		if u.Opaque != "" {
+			name = u.Opaque
+		}
+		if name == "" {
+			return nil, fmt.Errorf("no socket path in TPM URI %q", path)
+		}
+		return newEmulator("unix", name), nil
+	case "tcp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("no host in TPM URI %q", path)
+		}
+		addr := u.Host
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), defaultTCPPort)
+		}
+		return newEmulator("tcp", addr), nil
+	default:
+		return openPath(path)
+	}
+}
+
+// defaultTCPPort is the port swtpm listens on for commands by default. The
+// Microsoft simulator uses it too, but with its own framing; see OpenTPM.
+const defaultTCPPort = "2321"
+
+// openPath opens a TPM given by a plain path, choosing the transport from
+// the type of the file.
+func openPath(path string) (io.ReadWriteCloser, error) {
+	if strings.HasPrefix(path, "@") {
+		return NewEmulatorReadWriteCloser(path), nil
+	}
 	fi, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
 
 	if fi.Mode()&os.ModeDevice != 0 {
-		var f *os.File
-		f, err = os.OpenFile(path, os.O_RDWR, 0600)
-		if err != nil {
-			return nil, err
-		}
-		rwc = io.ReadWriteCloser(f)
+		return openDevice(path)
 	} else if fi.Mode()&os.ModeSocket != 0 {
-		rwc = NewEmulatorReadWriteCloser(path)
-	} else {
-		return nil, fmt.Errorf("unsupported TPM file mode %s", fi.Mode().String())
+		return NewEmulatorReadWriteCloser(path), nil
 	}
+	return nil, fmt.Errorf("unsupported TPM file mode %s", fi.Mode().String())
+}
 
-	return rwc, nil
+// openDevice opens the TPM character device at path.
+func openDevice(path string) (io.ReadWriteCloser, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
 // dialer abstracts the net.Dial call so test code can provide its own net.Conn
@@ -55,37 +113,76 @@ func OpenTPM(path string) (io.ReadWriteCloser, error) {
 type dialer func(network, path string) (net.Conn, error)
 
 // EmulatorReadWriteCloser manages connections with a TPM emulator over a Unix
-// domain socket. These emulators often operate in a write/read/disconnect
+// domain socket, or a TCP socket when opened by OpenTPM. These emulators often operate in a write/read/disconnect
 // sequence, so the Write method always connects, and the Read method always
 // closes. EmulatorReadWriteCloser is not thread safe.
 type EmulatorReadWriteCloser struct {
-	path   string
-	conn   net.Conn
-	dialer dialer
+	network string
+	path    string
+	conn    net.Conn
+	dialer  dialer
 }
 
 // NewEmulatorReadWriteCloser stores information about a Unix domain socket to
 // write to and read from.
 func NewEmulatorReadWriteCloser(path string) *EmulatorReadWriteCloser {
+	return newEmulator("unix", path)
+}
+
+// newEmulator returns an EmulatorReadWriteCloser that dials address on the
+// given network for each command.
+func newEmulator(network, address string) *EmulatorReadWriteCloser {
 	return &EmulatorReadWriteCloser{
-		path:   path,
-		dialer: net.Dial,
+		network: network,
+		path:    address,
+		dialer:  net.Dial,
 	}
 }
 
-// Read implements io.Reader by reading from the Unix domain socket and closing
-// it.
+// Read implements io.Reader by reading the response from the socket and
+// closing it. Since the connection is closed afterwards, Read keeps reading
+// until it has the whole response, as given by the size in its header. The
+// rest of a response larger than p can't be read later, so Read returns an
+// error instead of part of it.
 func (erw *EmulatorReadWriteCloser) Read(p []byte) (int, error) {
 	// Read is always the second operation in a Write/Read sequence.
 	if erw.conn == nil {
 		return 0, fmt.Errorf("must call Write then Read in an alternating sequence")
 	}
-	n, err := erw.conn.Read(p)
+	n, err := readFullResponse(erw.conn, p)
 	erw.conn.Close()
 	erw.conn = nil
 	return n, err
 }
 
+// readFullResponse reads a response from r into p. It reads at least the
+// header, if p can hold it, and then the rest of the response, failing if
+// the response is larger than p.
+func readFullResponse(r io.Reader, p []byte) (int, error) {
+	var rh responseHeader
+	hdrSize := binary.Size(rh)
+	n, err := io.ReadAtLeast(r, p, min(hdrSize, len(p)))
+	if err == io.ErrUnexpectedEOF {
+		// Leave it to the caller to reject a response too short to
+		// hold a header.
+		return n, nil
+	}
+	if err != nil || n < hdrSize {
+		return n, err
+	}
+	if _, err := Unpack(p[:n], &rh); err != nil {
+		return n, nil
+	}
+	if int(rh.Size) > len(p) {
+		return n, fmt.Errorf("response of %d bytes does not fit in a %d-byte buffer", rh.Size, len(p))
+	}
+	if want := int(rh.Size); n < want {
+		m, err := io.ReadFull(r, p[n:want])
+		return n + m, err
+	}
+	return n, nil
+}
+
 // Write implements io.Writer by connecting to the Unix domain socket and
 // writing.
 func (erw *EmulatorReadWriteCloser) Write(p []byte) (int, error) {
@@ -93,7 +190,7 @@ func (erw *EmulatorReadWriteCloser) Write(p []byte) (int, error) {
 		return 0, fmt.Errorf("must call Write then Read in an alternating sequence")
 	}
 	var err error
-	erw.conn, err = erw.dialer("unix", erw.path)
+	erw.conn, err = erw.dialer(erw.network, erw.path)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,125 @@
+//go:build !windows
+
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpmutil
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// echo accepts connections on l and echoes one read back on each.
+func echo(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		b := make([]byte, 64)
+		n, _ := conn.Read(b)
+		conn.Write(b[:n])
+		conn.Close()
+	}
+}
+
+func listen(t *testing.T, network, address string) net.Listener {
+	t.Helper()
+	l, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatalf("Listen(%q, %q): %v", network, address, err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go echo(l)
+	return l
+}
+
+func TestOpenTPMURI(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "sock")
+	listen(t, "unix", sock)
+	tcp := listen(t, "tcp", "127.0.0.1:0")
+
+	uris := map[string]string{
+		"Socket":  sock,
+		"UnixURI": "unix://" + sock,
+		"TCPURI":  "tcp://" + tcp.Addr().String(),
+	}
+	if runtime.GOOS == "linux" {
+		name := fmt.Sprintf("@go-tpm-test-%d", os.Getpid())
+		listen(t, "unix", name)
+		uris["Abstract"] = name
+		uris["AbstractURI"] = "unix:" + name
+	}
+	// A path containing a colon is still a path.
+	dir := filepath.Join(t.TempDir(), "a:b")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	uris["ColonInDir"] = filepath.Join(dir, "sock")
+	listen(t, "unix", uris["ColonInDir"])
+
+	for name, uri := range uris {
+		t.Run(name, func(t *testing.T) {
+			rwc, err := OpenTPM(uri)
+			if err != nil {
+				t.Fatalf("OpenTPM(%q): %v", uri, err)
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := rwc.Write(input); err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+				b := make([]byte, 64)
+				n, err := rwc.Read(b)
+				if err != nil {
+					t.Fatalf("Read: %v", err)
+				}
+				if !bytes.Equal(b[:n], input) {
+					t.Errorf("Read returned %q, want %q", b[:n], input)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenTPMDeviceURI(t *testing.T) {
+	rwc, err := OpenTPM("device:///dev/null")
+	if err != nil {
+		t.Fatalf("OpenTPM: %v", err)
+	}
+	rwc.Close()
+}
+
+func TestOpenTPMBadURI(t *testing.T) {
+	for _, uri := range []string{
+		"unix:",
+		"tcp://",
+		"device:///nonexistent",
+		"tcpp://localhost:2321",
+	} {
+		if _, err := OpenTPM(uri); err == nil {
+			t.Errorf("OpenTPM(%q) succeeded", uri)
+		}
+	}
+	// Unknown schemes are looked up as files.
+	if _, err := OpenTPM("tcpp://localhost"); err == nil || !strings.Contains(err.Error(), "tcpp://localhost") {
+		t.Errorf("OpenTPM with an unknown scheme = %v, want an error for the path", err)
+	}
+}
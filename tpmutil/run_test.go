@@ -0,0 +1,82 @@
+// Copyright (c) 2026, Google LLC All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpmutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// splitTPM answers every command with rsp, handing it out at most chunk
+// bytes per Read.
+type splitTPM struct {
+	rsp, pending []byte
+	chunk        int
+}
+
+func (s *splitTPM) Write(p []byte) (int, error) {
+	s.pending = s.rsp
+	return len(p), nil
+}
+
+func (s *splitTPM) Read(p []byte) (int, error) {
+	n := copy(p[:min(len(p), s.chunk)], s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// response returns a response with the given body.
+func response(body []byte) []byte {
+	rsp := make([]byte, 10, 10+len(body))
+	binary.BigEndian.PutUint16(rsp, 0x8001)
+	binary.BigEndian.PutUint32(rsp[2:], uint32(10+len(body)))
+	return append(rsp, body...)
+}
+
+func TestRunCommandRawChunked(t *testing.T) {
+	want := response(bytes.Repeat([]byte{0xAB}, 300))
+	for _, tc := range []struct {
+		name        string
+		chunk       int
+		maxResponse int
+	}{
+		{"Whole", len(want), 0},
+		{"SplitHeader", 3, 0},
+		{"SplitBody", 64, 0},
+		{"SmallBuffer", 64, 64},
+		{"ByteByByte", 1, 16},
+		{"BufferSmallerThanHeader", 64, 5},
+		{"OneByteBuffer", 1, 1},
+	} {
+		tpm := &splitTPM{rsp: want, chunk: tc.chunk}
+		got, err := RunCommandRawSize(tpm, []byte{0}, tc.maxResponse)
+		if err != nil {
+			t.Errorf("%s: RunCommandRawSize() = %v", tc.name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: RunCommandRawSize() returned %d bytes, want %d", tc.name, len(got), len(want))
+		}
+	}
+
+	// A header claiming an implausible size is rejected rather than
+	// waited for.
+	huge := response(nil)
+	binary.BigEndian.PutUint32(huge[2:], 1<<30)
+	if _, err := RunCommandRaw(&splitTPM{rsp: huge, chunk: len(huge)}, []byte{0}); err == nil {
+		t.Errorf("RunCommandRaw() accepted a response size of 1 GiB")
+	}
+}
@@ -30,8 +30,8 @@ type winTPMBuffer struct {
 // of bytes in the command and any error code returned by executing the TPM command. Command
 // response can be read by calling Read().
 func (rwc *winTPMBuffer) Write(commandBuffer []byte) (int, error) {
-	// TPM spec defines longest possible response to be maxTPMResponse.
-	rwc.outBuffer = rwc.outBuffer[:maxTPMResponse]
+	// TPM spec defines longest possible response to be DefaultMaxResponseSize.
+	rwc.outBuffer = rwc.outBuffer[:DefaultMaxResponseSize]
 
 	outBufferLen, err := rwc.context.SubmitCommand(
 		tbs.NormalPriority,
@@ -69,7 +69,7 @@ func OpenTPM() (io.ReadWriteCloser, error) {
 	tpmContext, err := tbs.CreateContext(tbs.TPMVersion20, tbs.IncludeTPM12|tbs.IncludeTPM20)
 	rwc := &winTPMBuffer{
 		context:   tpmContext,
-		outBuffer: make([]byte, 0, maxTPMResponse),
+		outBuffer: make([]byte, 0, DefaultMaxResponseSize),
 	}
 	return rwc, err
 }
@@ -79,6 +79,6 @@ func OpenTPM() (io.ReadWriteCloser, error) {
 func FromContext(ctx tbs.Context) io.ReadWriteCloser {
 	return &winTPMBuffer{
 		context:   ctx,
-		outBuffer: make([]byte, 0, maxTPMResponse),
+		outBuffer: make([]byte, 0, DefaultMaxResponseSize),
 	}
 }
@@ -33,6 +33,9 @@ type Version uint32
 // Flag indicates TPM versions that are supported by the application.
 type Flag uint32
 
+// OwnerAuthType selects which authorization value GetOwnerAuth returns.
+type OwnerAuthType uint32
+
 // CommandPriority is used to determine which pending command to submit whenever the TPM is free.
 type CommandPriority uint32
 
@@ -55,6 +58,14 @@ const (
 	HighPriority   CommandPriority = 300 // For high priority application use
 	SystemPriority CommandPriority = 400 // For system tasks that access the TPM
 
+	// https://learn.microsoft.com/en-us/windows/win32/api/tbs/nf-tbs-tbsi_get_ownerauth
+	OwnerAuthFull          OwnerAuthType = 1  // TPM 1.2 owner authorization
+	OwnerAuthAdmin         OwnerAuthType = 2  // TPM 1.2 administrator delegation blob
+	OwnerAuthUser          OwnerAuthType = 3  // TPM 1.2 user delegation blob
+	OwnerAuthEndorsement   OwnerAuthType = 4  // TPM 1.2 endorsement delegation blob
+	OwnerAuthEndorsement20 OwnerAuthType = 12 // TPM 2 endorsement hierarchy authorization
+	OwnerAuthStorage20     OwnerAuthType = 13 // TPM 2 storage hierarchy authorization
+
 	commandLocalityZero uint32 = 0 // Windows currently only supports TBS_COMMAND_LOCALITY_ZERO.
 )
 
@@ -135,6 +146,7 @@ var (
 	tbsContextClose  = tbsDLL.NewProc("Tbsip_Context_Close")
 	tbsSubmitCommand = tbsDLL.NewProc("Tbsip_Submit_Command")
 	tbsGetTCGLog     = tbsDLL.NewProc("Tbsi_Get_TCG_Log")
+	tbsGetOwnerAuth  = tbsDLL.NewProc("Tbsi_Get_OwnerAuth")
 )
 
 // Returns the address of the beginning of a slice or 0 for a nil slice.
@@ -265,3 +277,30 @@ func (context Context) GetTCGLog(logBuffer []byte) (uint32, error) {
 	)
 	return logBufferLen, getError(result)
 }
+
+// GetOwnerAuth gets an authorization value that Windows keeps for the TPM,
+// returning the number of bytes written to authBuffer. If authBuffer is nil,
+// the size of the value is returned. ErrOwnerauthNotFound is returned if
+// Windows does not keep the value, as it does not by default since Windows
+// 10 version 1607; ErrAccessDenied if the caller is not an administrator.
+// https://learn.microsoft.com/en-us/windows/win32/api/tbs/nf-tbs-tbsi_get_ownerauth
+func (context Context) GetOwnerAuth(ownerAuthType OwnerAuthType, authBuffer []byte) (uint32, error) {
+	authBufferLen := uint32(len(authBuffer))
+
+	// TBS_RESULT Tbsi_Get_OwnerAuth(
+	//   TBS_HCONTEXT        hContext,
+	//   TBS_OWNERAUTH_TYPE  ownerauthType,
+	//   PBYTE               pOutputBuf,
+	//   PUINT32             pOutputBufLen
+	// );
+	if err := tbsGetOwnerAuth.Find(); err != nil {
+		return 0, err
+	}
+	result, _, _ := tbsGetOwnerAuth.Call(
+		uintptr(context),
+		uintptr(ownerAuthType),
+		sliceAddress(authBuffer),
+		uintptr(unsafe.Pointer(&authBufferLen)),
+	)
+	return authBufferLen, getError(result)
+}